@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"talkify/apps/api/internal/bench"
+)
+
+// Packages holding the benchmarks of encryption, message and WebSocket hot paths. The
+// message benchmarks need a database and are skipped without -db.
+var benchPackages = []string{
+	"talkify/apps/api/internal/encryption",
+	"talkify/apps/api/internal/handlers",
+	"talkify/apps/api/internal/models",
+}
+
+// Runs the benchmarks of encryption, message and WebSocket hot paths with go test and
+// prints their results. With -baseline it exits 1 when a benchmark got slower than the
+// baseline allows, so a redesign can be measured against the results of the one before.
+// Run it from the module directory.
+func main() {
+	run := flag.String("run", ".", "only run benchmarks matching this pattern, as go test -bench takes it")
+	withDB := flag.Bool("db", false, "also run the message benchmarks against the configured database, which seeds and then removes a conversation")
+	messages := flag.Int("messages", 1000, "number of messages seeded for the message benchmarks")
+	benchtime := flag.String("benchtime", "", "run each benchmark for this long or this many times, as go test -benchtime takes it")
+	out := flag.String("out", "", "write the results as JSON to this file")
+	baseline := flag.String("baseline", "", "compare with results written by -out and fail on regressions")
+	tolerance := flag.Float64("tolerance", 0.2, "slowdown over the baseline allowed before failing, as a fraction")
+	flag.Parse()
+
+	os.Exit(runBenchmarks(*run, *withDB, *messages, *benchtime, *out, *baseline, *tolerance))
+}
+
+func runBenchmarks(run string, withDB bool, messages int, benchtime, out, baseline string, tolerance float64) int {
+	args := []string{"test", "-run", "^$", "-bench", run, "-benchmem"}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+	cmd := exec.Command("go", append(args, benchPackages...)...)
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if withDB {
+		cmd.Env = append(cmd.Env, "TALKIFY_TEST_DATABASE=1", "TALKIFY_BENCH_MESSAGES="+strconv.Itoa(messages))
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatalf("Failed to run go test: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("Failed to run go test: %v", err)
+	}
+
+	// Results are printed as they come, in the format of go test -bench
+	report, err := bench.Parse(stdout, func(r bench.Result) {
+		fmt.Printf("%-50s %10d %12d ns/op %10d B/op %8d allocs/op", r.Name, r.N, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+		for unit, value := range r.Metrics {
+			fmt.Printf(" %10g %s", value, unit)
+		}
+		fmt.Println()
+	})
+	if waitErr := cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		log.Printf("Benchmarks failed: %v", err)
+		return 1
+	}
+
+	if out != "" {
+		if err := bench.WriteReport(out, report); err != nil {
+			log.Print(err)
+			return 1
+		}
+		fmt.Printf("\nResults written to %s\n", out)
+	}
+
+	if baseline == "" {
+		return 0
+	}
+	base, err := bench.ReadReport(baseline)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	regressions := bench.Compare(base, report, tolerance)
+	if len(regressions) == 0 {
+		fmt.Printf("\nNo regressions over %s (tolerance %.0f%%)\n", baseline, tolerance*100)
+		return 0
+	}
+	fmt.Printf("\n%d regression(s) over %s (tolerance %.0f%%):\n", len(regressions), baseline, tolerance*100)
+	for _, r := range regressions {
+		fmt.Printf("  %s: %d ns/op -> %d ns/op (+%.0f%%)\n", r.Name, r.Baseline, r.Current, r.Change*100)
+	}
+	return 1
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/config"
+	database "talkify/apps/api/internal/db"
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/models"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+// Result of a check
+const (
+	pass = "PASS"
+	warn = "WARN"
+	fail = "FAIL"
+	skip = "SKIP"
+)
+
+// report collects the outcome of each check, in the order they ran
+type report struct {
+	rows   [][3]string
+	failed int
+}
+
+func (r *report) add(check, result, detail string) {
+	r.rows = append(r.rows, [3]string{check, result, detail})
+	if result == fail {
+		r.failed++
+	}
+}
+
+func (r *report) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+	for _, row := range r.rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row[0], row[1], row[2])
+	}
+	w.Flush()
+}
+
+// Checks that the environment is ready to serve the API: the configuration, database,
+// schema, encryption key, email index, JWT secret and archive storage. Exits 1 when any
+// check fails.
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	wait := flag.Duration("wait", 5*time.Second, "how long to wait for the database to answer")
+	sampleSize := flag.Int("sample", 100, "number of users whose email index is checked")
+	flag.Parse()
+
+	os.Exit(run(*configFile, *wait, *sampleSize))
+}
+
+func run(configFile string, wait time.Duration, sampleSize int) int {
+	godotenv.Load()
+
+	r := &report{}
+	runChecks(r, configFile, wait, sampleSize)
+	r.print()
+	if r.failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", r.failed)
+		return 1
+	}
+	fmt.Println("\nAll checks passed")
+	return 0
+}
+
+// runChecks runs every check it can, skipping those whose prerequisites failed
+func runChecks(r *report, configFile string, wait time.Duration, sampleSize int) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		r.add("config", fail, err.Error())
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, problem := range invalid.Problems {
+				r.add("config", fail, problem)
+			}
+		} else {
+			r.add("config", fail, err.Error())
+		}
+	} else {
+		r.add("config", pass, "profile "+cfg.Profile)
+	}
+
+	db, err := database.Connect(&cfg.Database, wait)
+	if err != nil {
+		r.add("database", fail, err.Error())
+	} else {
+		defer db.Close()
+		r.add("database", pass, fmt.Sprintf("connected to %s:%s/%s", cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName))
+		checkSchema(r, db, cfg.Database.MigrationsDir)
+	}
+
+	encryptor := checkEncryption(r, &cfg.Encryption, db)
+
+	if db == nil || encryptor == nil {
+		r.add("email index", skip, "needs the database and encryption key")
+	} else {
+		checkEmailIndex(r, models.NewUserService(db, encryptor), sampleSize)
+	}
+
+	checkJWT(r, &cfg.JWT)
+	checkStorage(r, cfg.Media.ArchiveDir)
+}
+
+// checkSchema compares the applied schema version with the migration files
+func checkSchema(r *report, db *sqlx.DB, dir string) {
+	status, err := database.CheckMigrations(db, dir)
+	switch {
+	case err != nil && status != nil:
+		r.add("schema", fail, fmt.Sprintf("%v (dirty: %t)", err, status.Dirty))
+	case err != nil:
+		r.add("schema", fail, err.Error())
+	case !status.Tracked:
+		r.add("schema", warn, fmt.Sprintf("version is not tracked, latest migration is %d", status.Latest))
+	default:
+		r.add("schema", pass, fmt.Sprintf("at version %d", status.Current))
+	}
+}
+
+// checkEncryption loads the key, encrypts and decrypts a random value with it and,
+// when the database is reachable, checks that the key reads existing data. It returns
+// nil when the key can't be used.
+func checkEncryption(r *report, cfg *config.EncryptionConfig, db *sqlx.DB) encryption.Encryptor {
+	encryptor, err := encryption.NewEncryptor(cfg.Mode, cfg.KeyFile)
+	if err != nil {
+		r.add("encryption key", fail, err.Error())
+		return nil
+	}
+	if encryption.IsPlaintext(encryptor) {
+		r.add("encryption mode", warn, "data is stored unencrypted")
+	}
+
+	probe := make([]byte, 16)
+	rand.Read(probe)
+	plaintext := hex.EncodeToString(probe)
+	encrypted, err := encryptor.EncryptString(plaintext)
+	if err != nil {
+		r.add("encryption key", fail, "failed to encrypt: "+err.Error())
+		return nil
+	}
+	decrypted, err := encryptor.DecryptString(encrypted)
+	if err != nil || decrypted != plaintext {
+		r.add("encryption key", fail, "value did not survive a round trip")
+		return nil
+	}
+
+	if db == nil {
+		r.add("encryption key", pass, "round trip ok with "+encryptor.KeyVersion()+", existing data not checked")
+		return encryptor
+	}
+	err = database.VerifyEncryptionCanary(db, encryptor)
+	switch {
+	case errors.Is(err, database.ErrCanaryUnavailable):
+		r.add("encryption key", warn, "round trip ok, but "+err.Error())
+	case err != nil:
+		r.add("encryption key", fail, fmt.Sprintf("%v (mode %s, key file %s)", err, cfg.Mode, cfg.KeyFile))
+		return nil
+	default:
+		r.add("encryption key", pass, "round trip ok with "+encryptor.KeyVersion()+", reads existing data")
+	}
+	return encryptor
+}
+
+// checkEmailIndex recomputes the blind index of a sample of users
+func checkEmailIndex(r *report, users *models.UserService, n int) {
+	sample, err := users.SampleEmailIndexes(n)
+	switch {
+	case err != nil:
+		r.add("email index", fail, err.Error())
+	case sample.Checked == 0:
+		r.add("email index", pass, "no indexed users yet")
+	case sample.Mismatched > 0 || sample.Unreadable > 0:
+		r.add("email index", fail, fmt.Sprintf("%d of %d sampled users mismatched, %d unreadable",
+			sample.Mismatched, sample.Checked, sample.Unreadable))
+	default:
+		r.add("email index", pass, fmt.Sprintf("%d sampled users consistent", sample.Checked))
+	}
+}
+
+// checkJWT holds the secret to the rules for production and loads the signing keys
+func checkJWT(r *report, cfg *config.JWTConfig) {
+	if err := config.CheckJWTSecret(cfg.SecretKey); err != nil {
+		r.add("jwt secret", fail, err.Error())
+	} else {
+		r.add("jwt secret", pass, fmt.Sprintf("%d bytes", len(cfg.SecretKey)))
+	}
+
+	keys := auth.NewKeySet(cfg.SecretKID, []byte(cfg.SecretKey))
+	if err := keys.LoadDir(cfg.KeysDir); err != nil {
+		r.add("jwt keys", fail, err.Error())
+		return
+	}
+	if cfg.ActiveKID != "" {
+		if err := keys.SetActive(cfg.ActiveKID); err != nil {
+			r.add("jwt keys", fail, err.Error())
+			return
+		}
+	}
+	r.add("jwt keys", pass, fmt.Sprintf("%d key(s), active %s", len(keys.List()), keys.ActiveKID()))
+}
+
+// checkStorage writes, reads back and removes a file where archives are kept
+func checkStorage(r *report, dir string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		r.add("storage", fail, err.Error())
+		return
+	}
+	file, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		r.add("storage", fail, "failed to write: "+err.Error())
+		return
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	content := []byte("talkify doctor " + time.Now().UTC().Format(time.RFC3339Nano))
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		r.add("storage", fail, "failed to write: "+err.Error())
+		return
+	}
+	read, err := os.ReadFile(path)
+	if err != nil {
+		r.add("storage", fail, "failed to read: "+err.Error())
+		return
+	}
+	if string(read) != string(content) {
+		r.add("storage", fail, "file read back differs from what was written")
+		return
+	}
+	r.add("storage", pass, "read and write ok in "+filepath.Clean(dir))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"talkify/apps/api/internal/config"
+	database "talkify/apps/api/internal/db"
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/models"
+)
+
+// Encrypts the media URLs of messages sent before they were stored encrypted. It can be
+// run while the API is serving and again after an interruption.
+func main() {
+	batchSize := flag.Int("batch", 500, "messages to encrypt per transaction")
+	flag.Parse()
+	if *batchSize < 1 {
+		log.Fatal("batch must be at least 1")
+	}
+
+	// Load config
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Encryption.Mode == encryption.ModePlaintext {
+		log.Fatal("ENCRYPTION_MODE is plaintext; encrypting would leave the database in both modes")
+	}
+
+	// Connect to database
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Initialize encryption manager
+	encryptor, err := encryption.NewEncryptor(cfg.Encryption.Mode, cfg.Encryption.KeyFile)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption: %v", err)
+	}
+
+	messageService := models.NewMessageService(db.DB, encryptor)
+	total := 0
+	for {
+		count, err := messageService.EncryptLegacyMedia(*batchSize)
+		if err != nil {
+			log.Fatalf("Failed to encrypt media after %d messages: %v", total, err)
+		}
+		if count == 0 {
+			break
+		}
+		total += count
+		fmt.Printf("Encrypted media of %d messages\n", total)
+	}
+
+	fmt.Printf("Successfully encrypted media of %d messages\n", total)
+}
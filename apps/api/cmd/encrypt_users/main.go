@@ -5,10 +5,8 @@ import (
 	"log"
 	"os"
 	"talkify/apps/api/internal/config"
+	database "talkify/apps/api/internal/db"
 	"talkify/apps/api/internal/encryption"
-
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 )
 
 func main() {
@@ -17,22 +15,19 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if cfg.Encryption.Mode == encryption.ModePlaintext {
+		log.Fatal("ENCRYPTION_MODE is plaintext; encrypting would leave the database in both modes")
+	}
 
 	// Connect to database
-	db, err := sqlx.Connect("postgres", cfg.Database.DSN())
+	db, err := database.New(&cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
-	// Initialize key manager
-	keyManager, err := encryption.NewKeyManager(cfg.Encryption.KeyFile)
-	if err != nil {
-		log.Fatalf("Failed to initialize key manager: %v", err)
-	}
-
 	// Initialize encryption manager
-	encryptor, err := encryption.NewManager(keyManager.GetKey())
+	encryptor, err := encryption.NewEncryptor(cfg.Encryption.Mode, cfg.Encryption.KeyFile)
 	if err != nil {
 		log.Fatalf("Failed to initialize encryption: %v", err)
 	}
@@ -2,20 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"talkify/apps/api/internal/auth"
 	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/cron"
+	database "talkify/apps/api/internal/db"
 	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/errors/reporting"
 	"talkify/apps/api/internal/handlers"
+	"talkify/apps/api/internal/lifecycle"
 	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/mail"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/password"
+	"talkify/apps/api/internal/presence"
+	"talkify/apps/api/internal/redis"
+	"talkify/apps/api/internal/server"
+	"talkify/apps/api/internal/sms"
 	"talkify/apps/api/internal/worker"
+	"text/tabwriter"
 	"time"
+	// Users pick IANA timezones, which must load even where the host has no zoneinfo
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -43,23 +62,92 @@ import (
 // @name X-User-ID
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	printAuthz := flag.Bool("print-authz", false, "print the route authorization matrix and exit")
+	flag.Parse()
+
+	if *printConfig {
+		os.Exit(runPrintConfig(*configFile))
+	}
+	if *printAuthz {
+		os.Exit(runPrintAuthz(*configFile))
+	}
+
 	// Initialize logger
 	logger.InitLogger(true) // true for development mode
 
 	// Initialize configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfigFile(*configFile)
 	if err != nil {
 		logger.Fatal("Failed to load config", err)
 	}
 
+	// Settings that can be reloaded at runtime with SIGHUP or the admin API
+	live := config.NewLive(cfg, *configFile)
+	if err := logger.SetLevel(cfg.Runtime.LogLevel); err != nil {
+		logger.Fatal("Invalid log level", err)
+	}
+	live.OnChange(func(rc config.RuntimeConfig) {
+		if err := logger.SetLevel(rc.LogLevel); err != nil {
+			logger.Error("Failed to apply log level", err)
+		}
+	})
+
+	logger.Info("Configuration loaded", map[string]interface{}{
+		"profile": cfg.Profile,
+		"file":    *configFile,
+	})
+
+	// New password hashes use the configured Argon2id cost; older ones are upgraded at login
+	password.SetHashParams(password.HashParams{
+		Memory:      uint32(cfg.Password.HashMemory),
+		Iterations:  uint32(cfg.Password.HashIterations),
+		Parallelism: uint8(cfg.Password.HashParallelism),
+	})
+
+	// Subsystems are started in the order they are added and stopped in reverse
+	app := lifecycle.New()
+
+	// Initialize error reporting; without a DSN the reporter is nil and discards everything
+	reporter, err := reporting.New(reporting.Config{
+		DSN:         cfg.Reporting.DSN,
+		Environment: cfg.Reporting.Environment,
+		Release:     cfg.Reporting.Release,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize error reporting", err)
+	}
+	if reporter != nil {
+		logger.SetErrorHook(reporter.CaptureLog)
+		app.Append(lifecycle.Hook{
+			Name: "error reporting",
+			Stop: func(context.Context) error {
+				reporter.Close(5 * time.Second)
+				return nil
+			},
+		})
+		logger.Info("Error reporting enabled", map[string]interface{}{
+			"environment": cfg.Reporting.Environment,
+			"release":     cfg.Reporting.Release,
+		})
+	}
+
 	// Initialize database
-	db, err := sqlx.Connect("postgres", cfg.Database.DSN())
+	db, err := database.Connect(&cfg.Database, cfg.Database.StartupMaxWait)
 	if err != nil {
-		logger.Fatal("Failed to connect to database", err, map[string]interface{}{
-			"dsn": cfg.Database.DSN(),
+		logger.Fatal("Startup check failed: database", err, map[string]interface{}{
+			"host":     cfg.Database.Host,
+			"port":     cfg.Database.Port,
+			"name":     cfg.Database.DBName,
+			"max_wait": cfg.Database.StartupMaxWait.String(),
+			"hint":     "check DB_HOST/DB_PORT and that Postgres is running, or raise DB_STARTUP_MAX_WAIT",
 		})
 	}
-	defer db.Close()
+	app.Append(lifecycle.Hook{
+		Name: "database",
+		Stop: func(context.Context) error { return db.Close() },
+	})
 
 	logger.Info("Successfully connected to database", map[string]interface{}{
 		"host": cfg.Database.Host,
@@ -68,92 +156,315 @@ func main() {
 	})
 
 	// Initialize encryption manager
-	keyManager, err := encryption.NewKeyManager(cfg.Encryption.KeyFile)
+	encryptor, err := encryption.NewEncryptor(cfg.Encryption.Mode, cfg.Encryption.KeyFile)
 	if err != nil {
-		logger.Fatal("Failed to initialize key manager", err, map[string]interface{}{
+		logger.Fatal("Failed to initialize encryption manager", err, map[string]interface{}{
+			"mode":    cfg.Encryption.Mode,
 			"keyFile": cfg.Encryption.KeyFile,
 		})
 	}
+	if encryption.IsPlaintext(encryptor) {
+		logger.Warn("Storing data unencrypted", map[string]interface{}{
+			"mode": cfg.Encryption.Mode,
+		})
+	}
+
+	logger.Info("Successfully initialized encryption manager", map[string]interface{}{
+		"key_version": encryptor.KeyVersion(),
+	})
 
-	encryptor, err := encryption.NewManager(keyManager.GetKey())
+	// Make sure the schema is up to date and the key can read existing data
+	migrationStatus, err := database.CheckMigrations(db, cfg.Database.MigrationsDir)
 	if err != nil {
-		logger.Fatal("Failed to initialize encryption manager", err)
+		fields := map[string]interface{}{
+			"migrations_dir": cfg.Database.MigrationsDir,
+			"hint":           "run the pending migrations with golang-migrate before starting the API",
+		}
+		if migrationStatus != nil {
+			fields["current"] = migrationStatus.Current
+			fields["latest"] = migrationStatus.Latest
+			fields["dirty"] = migrationStatus.Dirty
+		}
+		logger.Fatal("Startup check failed: migrations", err, fields)
+	}
+	if !migrationStatus.Tracked {
+		logger.Warn("Schema version is not tracked, skipping migration check", map[string]interface{}{
+			"latest": migrationStatus.Latest,
+		})
 	}
 
-	logger.Info("Successfully initialized encryption manager")
+	if err := database.VerifyEncryptionCanary(db, encryptor); err != nil {
+		if errors.Is(err, database.ErrCanaryUnavailable) {
+			logger.Warn("Skipping encryption key check", map[string]interface{}{
+				"reason": err.Error(),
+			})
+		} else {
+			hint := "the key file does not match the one existing data was encrypted with"
+			if errors.Is(err, database.ErrEncryptionModeMismatch) {
+				hint = "set ENCRYPTION_MODE to the mode the database was first started in"
+			}
+			logger.Fatal("Startup check failed: encryption key", err, map[string]interface{}{
+				"mode":    cfg.Encryption.Mode,
+				"keyFile": cfg.Encryption.KeyFile,
+				"hint":    hint,
+			})
+		}
+	}
 
-	// Initialize token manager
-	tokenManager := auth.NewTokenManager(cfg.JWT.SecretKey)
+	// Initialize signing keys and token manager
+	signingKeys := auth.NewKeySet(cfg.JWT.SecretKID, []byte(cfg.JWT.SecretKey))
+	if err := signingKeys.LoadDir(cfg.JWT.KeysDir); err != nil {
+		logger.Fatal("Failed to load JWT signing keys", err, map[string]interface{}{
+			"keysDir": cfg.JWT.KeysDir,
+		})
+	}
+	if cfg.JWT.ActiveKID != "" {
+		if err := signingKeys.SetActive(cfg.JWT.ActiveKID); err != nil {
+			logger.Fatal("Failed to activate JWT signing key", err, map[string]interface{}{
+				"kid": cfg.JWT.ActiveKID,
+			})
+		}
+	}
+	// Keys rotated through the admin API are shared with the other nodes in the database
+	if err := signingKeys.UseStore(models.NewSigningKeyStore(db, encryptor)); err != nil {
+		logger.Fatal("Failed to load stored JWT signing keys", err)
+	}
+	tokenManager := auth.NewTokenManager(signingKeys, cfg.JWT.Issuer, cfg.JWT.Audience)
 	logger.Info("Successfully initialized token manager")
 
-	// Initialize worker pool
+	// Connect to Redis when presence is shared between nodes
+	var redisClient *redis.Client
+	if cfg.Redis.URL != "" {
+		redisOpts, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			logger.Fatal("Invalid Redis URL", err)
+		}
+		redisClient = redis.New(redisOpts)
+		if _, err := redisClient.Do("PING"); err != nil {
+			logger.Fatal("Startup check failed: redis", err, map[string]interface{}{
+				"addr": redisOpts.Addr,
+				"hint": "check REDIS_URL and that Redis is running, or unset it to keep presence in the database",
+			})
+		}
+		app.Append(lifecycle.Hook{
+			Name: "redis",
+			Stop: func(context.Context) error { return redisClient.Close() },
+		})
+		logger.Info("Sharing presence through Redis", map[string]interface{}{
+			"addr": redisOpts.Addr,
+		})
+	}
+
+	// Initialize worker pool; queued tasks are drained on shutdown
 	workerPool := worker.NewPool(0) // Use number of CPU cores
-	workerPool.Start()
-	defer workerPool.Stop()
+	app.Append(lifecycle.Hook{
+		Name: "worker pool",
+		Start: func(context.Context) error {
+			workerPool.Start()
+			return nil
+		},
+		Stop: workerPool.Stop,
+	})
 
-	// Initialize Gin router
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
+	// Initialize handlers
+	h := handlers.NewHandler(cfg, live, db, encryptor, workerPool, tokenManager)
+	app.Append(lifecycle.Hook{
+		Name: "websocket hub",
+		Stop: func(context.Context) error {
+			h.Close()
+			return nil
+		},
+	})
 
-	// Configure CORS for development - allow everything
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173") // Vite's default port
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-User-ID, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	// Notification emails are only logged until an SMTP server is configured
+	mailer, err := mail.New(cfg.Mail.SMTPURL, cfg.Mail.From)
+	if err != nil {
+		logger.Fatal("Invalid mail configuration", err)
+	}
+	h.SetMailer(mailer)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// Notification text messages are only logged until an SMS gateway is configured
+	texter, err := sms.New(cfg.SMS.GatewayURL, cfg.SMS.Token)
+	if err != nil {
+		logger.Fatal("Invalid SMS configuration", err)
+	}
+	h.SetSMSSender(texter)
 
-		c.Next()
-	})
+	contentFilter, err := contentfilter.Load(cfg.ContentFilter.WordlistDir)
+	if err != nil {
+		logger.Fatal("Failed to load content filter wordlists", err)
+	}
+	h.SetContentFilter(contentFilter)
 
-	// Use our custom logger
-	r.Use(logger.RequestLogger())
-	r.Use(gin.Recovery())
+	if err := h.EnsureSupportAccount(); err != nil {
+		logger.Fatal("Failed to set up the support account", err)
+	}
 
-	// Initialize handlers
-	h := handlers.NewHandler(db, encryptor, workerPool, tokenManager)
+	if redisClient != nil {
+		h.SetPresence(presence.NewTracker(redisClient, cfg.Presence.OnlineTTL))
+		presenceCtx, stopPresence := context.WithCancel(context.Background())
+		app.Append(lifecycle.Hook{
+			Name: "presence watcher",
+			Start: func(context.Context) error {
+				go h.WatchPresence(presenceCtx)
+				return nil
+			},
+			Stop: func(context.Context) error {
+				stopPresence()
+				return nil
+			},
+		})
+	}
 
-	// API routes
-	api := r.Group("/api")
-	{
-		// WebSocket endpoint
-		api.GET("/ws", h.WebSocket)
+	// Initialize cron runner for periodic background jobs
+	cronRunner := cron.NewRunner()
+	for _, job := range h.Jobs() {
+		cronRunner.Register(job)
+	}
+	app.Append(lifecycle.Hook{
+		Name: "cron runner",
+		Start: func(context.Context) error {
+			cronRunner.Start()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			cronRunner.Stop()
+			return nil
+		},
+	})
+
+	// Initialize Gin router
+	gin.SetMode(gin.ReleaseMode)
+	r, err := server.NewRouter(cfg, server.RouterOptions{
+		Live:      live,
+		Metrics:   h.Metrics(),
+		Streaming: handlers.StreamingRoutes,
+		Reporters: []server.PanicReporter{reporter},
+	})
+	if err != nil {
+		logger.Fatal("Failed to create router", err)
+	}
+
+	registerRoutes(r, h)
 
-		// Register other routes
-		h.RegisterAuthRoutes(api.Group("/auth"))
-		h.RegisterUserRoutes(api.Group("/users"))
-		h.RegisterConversationRoutes(api.Group("/conversations"))
-		h.RegisterMessageRoutes(api.Group("/messages"))
+	// The internal router is only served when the service listener is enabled
+	internal := gin.New()
+	internal.Use(logger.RequestID())
+	internal.Use(logger.RequestLogger())
+	internal.Use(server.Recovery(reporter))
+	// The compliance stream stays open for as long as the recorder listens
+	internal.Use(server.Timeout(cfg.Server.RequestTimeout, "/internal/compliance/stream"))
+	registerInternalRoutes(internal, h)
 
-		// Swagger documentation
-		api.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Refuse to start if any route was registered without an authorization rule
+	routes := func() gin.RoutesInfo {
+		return append(r.Routes(), internal.Routes()...)
+	}
+	if uncovered := handlers.UncoveredRoutes(routes()); len(uncovered) > 0 {
+		logger.Fatal("Routes without an authorization rule", nil, map[string]interface{}{
+			"routes": uncovered,
+			"hint":   "add them to routeRules in internal/handlers/authz.go",
+		})
 	}
+	h.SetRoutes(routes)
 
 	// Create server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := cfg.Server.Port
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           server.APIVersions(r),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+	// Terminate TLS in-process when certificates or autocert are configured
+	var serverTLS *server.TLS
+	var redirectSrv *http.Server
+	if cfg.Server.TLSEnabled() {
+		serverTLS, err = server.NewTLS(cfg.Server)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", err)
+		}
+		serverTLS.Configure(srv, cfg.Server.HTTP2Enabled)
+
+		if cfg.Server.RedirectHTTP {
+			redirectSrv = &http.Server{
+				Addr:              ":" + cfg.Server.HTTPPort,
+				Handler:           serverTLS.RedirectHandler(port),
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+				MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+			}
+		}
 	}
 
-	// Start server in a goroutine
-	go func() {
-		logger.Info("Server starting", map[string]interface{}{
-			"port": port,
-			"mode": gin.Mode(),
-		})
+	app.Append(serverHook("public", srv, serverTLS, map[string]interface{}{
+		"port":  port,
+		"mode":  gin.Mode(),
+		"tls":   serverTLS != nil,
+		"http2": serverTLS != nil && cfg.Server.HTTP2Enabled,
+	}))
+	if redirectSrv != nil {
+		app.Append(serverHook("http redirect", redirectSrv, nil, map[string]interface{}{
+			"port": cfg.Server.HTTPPort,
+		}))
+	}
+
+	// Serve the internal service-to-service API on its own router and listener so that
+	// none of the public middleware or routes are reachable through it
+	if cfg.Service.Enabled {
+		internalSrv := &http.Server{
+			Addr:              cfg.Service.Addr,
+			Handler:           internal,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+			MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		}
+
+		var internalTLS *server.TLS
+		if cfg.Service.CertFile != "" && cfg.Service.KeyFile != "" {
+			internalTLS = &server.TLS{CertFile: cfg.Service.CertFile, KeyFile: cfg.Service.KeyFile}
+			if cfg.Service.CAFile != "" {
+				tlsConfig, err := auth.MutualTLSConfig(cfg.Service.CAFile)
+				if err != nil {
+					logger.Fatal("Failed to configure mutual TLS", err, map[string]interface{}{
+						"caFile": cfg.Service.CAFile,
+					})
+				}
+				internalSrv.TLSConfig = tlsConfig
+			}
+		}
+		internalSrv.RegisterOnShutdown(h.CloseStreams)
+
+		app.Append(serverHook("internal", internalSrv, internalTLS, map[string]interface{}{
+			"addr": cfg.Service.Addr,
+			"tls":  internalTLS != nil,
+			"mtls": internalSrv.TLSConfig != nil,
+		}))
+	}
+
+	if err := app.Start(context.Background()); err != nil {
+		logger.Fatal("Startup failed", err)
+	}
 
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Failed to start server", err, map[string]interface{}{
-				"port": port,
+	// Reload runtime settings on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			record, err := live.Reload("SIGHUP")
+			if err != nil {
+				logger.Error("Config reload rejected", err)
+				continue
+			}
+			logger.Info("Config reloaded", map[string]interface{}{
+				"actor":   record.Actor,
+				"changes": record.Changes,
 			})
 		}
 	}()
@@ -163,16 +474,137 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Info("Shutting down server...")
+	logger.Info("Shutting down server...", map[string]interface{}{
+		"timeout": cfg.Server.ShutdownTimeout.String(),
+	})
 
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Servers stop taking requests and finish the ones in flight first, then the jobs,
+	// connections and queued tasks are drained before the database is closed
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", err)
+	if err := app.Stop(ctx); err != nil {
+		logger.Error("Server did not shut down cleanly", err)
 	}
 
 	logger.Info("Server exiting")
 }
+
+// serverHook starts srv on a listener of its own when the app starts, so a port that
+// is taken fails startup, and shuts it down gracefully, letting requests in flight
+// finish. srv serves TLS when serverTLS is set.
+func serverHook(name string, srv *http.Server, serverTLS *server.TLS, fields map[string]interface{}) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: name + " server",
+		Start: func(context.Context) error {
+			listener, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+			fields["server"] = name
+			logger.Info("Server starting", fields)
+
+			go func() {
+				var err error
+				if serverTLS != nil {
+					err = srv.ServeTLS(listener, serverTLS.CertFile, serverTLS.KeyFile)
+				} else {
+					err = srv.Serve(listener)
+				}
+				if err != nil && err != http.ErrServerClosed {
+					logger.Fatal("Server failed", err, map[string]interface{}{
+						"server": name,
+						"addr":   srv.Addr,
+					})
+				}
+			}()
+			return nil
+		},
+		Stop: srv.Shutdown,
+	}
+}
+
+// runPrintConfig prints the effective configuration and any validation problems.
+// It returns the process exit code.
+func runPrintConfig(path string) int {
+	godotenv.Load()
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(string(out))
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// registerRoutes registers the public API on r
+func registerRoutes(r *gin.Engine, h *handlers.Handler) {
+	api := r.Group("/api")
+	h.RegisterRoutes(api)
+
+	// Swagger documentation
+	api.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+}
+
+// registerInternalRoutes registers the service-to-service API on r
+func registerInternalRoutes(r *gin.Engine, h *handlers.Handler) {
+	h.RegisterServiceRoutes(r)
+}
+
+// runPrintAuthz prints every route with its authorization rule. It returns 1 when
+// a route has no rule so it can be used as a CI check.
+func runPrintAuthz(path string) int {
+	godotenv.Load()
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Routes are only registered, never served, so no database or keys are needed
+	gin.SetMode(gin.ReleaseMode)
+	h := handlers.NewHandler(cfg, config.NewLive(cfg, path), nil, nil, nil, nil)
+	r := gin.New()
+	registerRoutes(r, h)
+	internal := gin.New()
+	registerInternalRoutes(internal, h)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tACCESS\tSCOPE\tPERMISSION\tHANDLER")
+	uncovered := 0
+	for _, entry := range handlers.AuthzMatrix(append(r.Routes(), internal.Routes()...)) {
+		access := string(entry.Access)
+		if !entry.Covered {
+			access = "UNCOVERED"
+			uncovered++
+		}
+		scope := entry.Scope
+		if scope == "" {
+			scope = "-"
+		}
+		permission := entry.Permission
+		if permission == "" {
+			permission = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Method, entry.Path, access, scope, permission, entry.Handler)
+	}
+	w.Flush()
+
+	if uncovered > 0 {
+		fmt.Fprintf(os.Stderr, "%d route(s) have no authorization rule\n", uncovered)
+		return 1
+	}
+	return 0
+}
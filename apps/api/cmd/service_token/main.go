@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/config"
+	"time"
+)
+
+func main() {
+	service := flag.String("service", "", "name of the service the token is issued to")
+	ttl := flag.Duration("ttl", 24*time.Hour, "token lifetime")
+	flag.Parse()
+
+	if *service == "" {
+		log.Fatal("Missing -service flag")
+	}
+
+	// Load config
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Service.TokenSecret == "" {
+		log.Fatal("SERVICE_TOKEN_SECRET is not set")
+	}
+
+	authenticator := auth.NewServiceAuthenticator(cfg.Service.TokenSecret, cfg.Service.AllowedServices)
+	token, err := authenticator.GenerateToken(*service, *ttl)
+	if err != nil {
+		log.Fatalf("Failed to generate token: %v", err)
+	}
+
+	fmt.Println(token)
+}
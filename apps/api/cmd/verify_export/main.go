@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"talkify/apps/api/internal/compliance"
+	"talkify/apps/api/internal/config"
+)
+
+// Checks that a compliance export is complete and unmodified
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: verify_export <export.jsonl>")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load config
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Compliance.SigningKey == "" {
+		log.Fatal("COMPLIANCE_SIGNING_KEY is not set")
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open export: %v", err)
+	}
+	defer file.Close()
+
+	lines, err := compliance.Verify(file, cfg.Compliance.SigningKey)
+	if err != nil {
+		log.Fatalf("Export failed verification: %v", err)
+	}
+	fmt.Printf("Export verified: %d lines, chain and signature intact\n", lines)
+}
@@ -0,0 +1,96 @@
+// Command embedded runs the Talkify chat backend inside another program's HTTP
+// server. The program signs its users in itself and hands them Talkify tokens, and
+// announces its own events to their connected chat clients.
+//
+// It reads the same configuration as the API server:
+//
+//	CONFIG_FILE=config.yaml go run ./examples/embedded
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"talkify/apps/api/pkg/talkify"
+
+	"github.com/google/uuid"
+)
+
+func main() {
+	cfg, err := talkify.LoadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+
+	chat, err := talkify.New(talkify.Options{Config: cfg, ConfigFile: os.Getenv("CONFIG_FILE")})
+	if err != nil {
+		log.Fatalf("start chat: %v", err)
+	}
+	if err := chat.Start(context.Background()); err != nil {
+		log.Fatalf("start chat: %v", err)
+	}
+
+	mux := http.NewServeMux()
+
+	// The whole chat API, WebSocket included
+	mux.Handle("/api/", chat.Handler())
+
+	// Users are signed in by the program, here by a proxy in front of it, and exchange
+	// that for a Talkify token
+	mux.HandleFunc("/chat-token", func(w http.ResponseWriter, r *http.Request) {
+		user, err := chat.Users().GetByUsername(r.Header.Get("X-Forwarded-User"))
+		if err != nil {
+			http.Error(w, "unknown user", http.StatusForbidden)
+			return
+		}
+		tokens, err := chat.Tokens().GenerateTokenPair(user.ID, r.UserAgent())
+		if err != nil {
+			http.Error(w, "failed to issue token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	})
+
+	// Events of the program's own show up on the users' chat connections
+	mux.HandleFunc("/deploys", func(w http.ResponseWriter, r *http.Request) {
+		var deploy struct {
+			Service  string      `json:"service"`
+			Watchers []uuid.UUID `json:"watchers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&deploy); err != nil {
+			http.Error(w, "invalid deploy", http.StatusBadRequest)
+			return
+		}
+		if err := chat.Publish(deploy.Watchers, "deploy.finished", deploy); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	srv := &http.Server{Addr: ":" + cfg.Server.Port, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("serve: %v", err)
+		}
+	}()
+	log.Printf("chat embedded on :%s", cfg.Server.Port)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	// Stop serving before the chat backend drains
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	srv.Shutdown(ctx)
+	if err := chat.Shutdown(ctx); err != nil {
+		log.Printf("chat shutdown: %v", err)
+	}
+}
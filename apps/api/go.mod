@@ -1,6 +1,6 @@
 module talkify/apps/api
 
-go 1.23.0
+go 1.24.0
 
 toolchain go1.24.3
 
@@ -15,6 +15,7 @@ require (
 
 require (
 	github.com/gin-gonic/gin v1.10.1
+	github.com/graph-gophers/graphql-go v1.9.0
 	github.com/joho/godotenv v1.5.1
 )
 
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,53 +9,244 @@ import (
 	"github.com/google/uuid"
 )
 
+// TokenType distinguishes what a token was issued for
+type TokenType string
+
+const (
+	// TokenTypeAccess is a regular user token, or an application token when ClientID is set
+	TokenTypeAccess TokenType = "access"
+	// TokenTypeRefresh can only be exchanged for a new token pair
+	TokenTypeRefresh TokenType = "refresh"
+	// TokenTypeBot is issued to automated integrations acting as a bot user
+	TokenTypeBot TokenType = "bot"
+	// TokenTypeGuest is issued to unauthenticated visitors with read-only access
+	TokenTypeGuest TokenType = "guest"
+)
+
+const (
+	// AccessTokenTTL is the lifetime of first-party access tokens
+	AccessTokenTTL = 24 * time.Hour
+	// RefreshTokenTTL is the lifetime of refresh tokens
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// AppTokenTTL is the lifetime of tokens issued to third-party applications
+	AppTokenTTL = time.Hour
+	// GuestTokenTTL is the lifetime of guest tokens
+	GuestTokenTTL = 12 * time.Hour
+)
+
+var (
+	ErrTokenExpired     = errors.New("token expired")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrInvalidTokenType = errors.New("invalid token type")
+)
+
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Type      TokenType `json:"typ"`
+	SessionID uuid.UUID `json:"sid,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	// Impersonation is set on tokens an administrator acts as the user with
+	Impersonation *Impersonation `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Impersonation identifies the approved impersonation a token was issued for
+type Impersonation struct {
+	ID      uuid.UUID `json:"id"`
+	AdminID uuid.UUID `json:"act"`
+	// ReadOnly tokens may only read
+	ReadOnly bool `json:"ro,omitempty"`
+}
+
+// IsAppToken reports whether the token was issued to a third-party application
+func (c *Claims) IsAppToken() bool {
+	return c.ClientID != ""
+}
+
+// IsRestricted reports whether the token is limited to its scopes. First-party
+// access tokens are unrestricted; application, bot and guest tokens are not.
+func (c *Claims) IsRestricted() bool {
+	return c.Type != TokenTypeAccess || c.IsAppToken()
+}
+
+// Allows reports whether the token may be used for an action requiring scope
+func (c *Claims) Allows(scope string) bool {
+	if c.Type == TokenTypeRefresh {
+		return false
+	}
+	if !c.IsRestricted() {
+		return true
+	}
+	return HasScope(c.Scopes, scope)
+}
+
+// TokenPair is the result of a login or a refresh
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	SessionID    uuid.UUID `json:"session_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
 type TokenManager struct {
-	secretKey []byte
+	keys     *KeySet
+	issuer   string
+	audience string
 }
 
-func NewTokenManager(secretKey string) *TokenManager {
+func NewTokenManager(keys *KeySet, issuer, audience string) *TokenManager {
 	return &TokenManager{
-		secretKey: []byte(secretKey),
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
 	}
 }
 
-func (tm *TokenManager) GenerateToken(userID uuid.UUID) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expires in 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+// Keys returns the key set used to sign and verify tokens
+func (tm *TokenManager) Keys() *KeySet {
+	return tm.keys
+}
+
+// GenerateTokenPair starts a new session and issues an access and refresh token for it
+func (tm *TokenManager) GenerateTokenPair(userID uuid.UUID, device string) (*TokenPair, error) {
+	return tm.generatePair(userID, uuid.New(), device)
+}
+
+// RefreshTokenPair validates a refresh token and issues a new pair for the same session
+func (tm *TokenManager) RefreshTokenPair(refreshToken string) (*TokenPair, *Claims, error) {
+	claims, err := tm.ValidateToken(refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Type != TokenTypeRefresh {
+		return nil, nil, ErrInvalidTokenType
+	}
+
+	pair, err := tm.generatePair(claims.UserID, claims.SessionID, claims.Device)
+	if err != nil {
+		return nil, nil, err
 	}
+	return pair, claims, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(tm.secretKey)
+// GenerateAppToken issues a short-lived token for a third-party application acting on behalf of a user
+func (tm *TokenManager) GenerateAppToken(userID uuid.UUID, clientID string, scopes []string) (string, error) {
+	return tm.sign(&Claims{
+		UserID:   userID,
+		Type:     TokenTypeAccess,
+		ClientID: clientID,
+		Scopes:   scopes,
+	}, AppTokenTTL)
+}
+
+// GenerateBotToken issues a token for a bot user restricted to the given scopes
+func (tm *TokenManager) GenerateBotToken(botUserID uuid.UUID, scopes []string, ttl time.Duration) (string, error) {
+	return tm.sign(&Claims{
+		UserID: botUserID,
+		Type:   TokenTypeBot,
+		Scopes: scopes,
+	}, ttl)
+}
+
+// GenerateImpersonationToken issues an access token for an administrator to act as a
+// user until expiresAt. It belongs to no session.
+func (tm *TokenManager) GenerateImpersonationToken(userID uuid.UUID, impersonation Impersonation, expiresAt time.Time) (string, error) {
+	return tm.sign(&Claims{
+		UserID:        userID,
+		Type:          TokenTypeAccess,
+		Impersonation: &impersonation,
+	}, time.Until(expiresAt))
+}
+
+// GenerateGuestToken issues a read-only token for a guest identity
+func (tm *TokenManager) GenerateGuestToken(guestID uuid.UUID) (string, error) {
+	return tm.sign(&Claims{
+		UserID: guestID,
+		Type:   TokenTypeGuest,
+		Scopes: []string{ScopeReadMessages},
+	}, GuestTokenTTL)
 }
 
 func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := tm.keys.Get(kid)
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return tm.secretKey, nil
-	})
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods(signingAlgorithms), jwt.WithIssuer(tm.issuer), jwt.WithAudience(tm.audience))
 
 	if err != nil {
-		if err == jwt.ErrTokenExpired {
-			return nil, fmt.Errorf("token expired")
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
 		}
-		return nil, fmt.Errorf("invalid token: %v", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	switch claims.Type {
+	case TokenTypeAccess, TokenTypeRefresh, TokenTypeBot, TokenTypeGuest:
+	default:
+		return nil, ErrInvalidTokenType
+	}
+
+	return claims, nil
+}
+
+func (tm *TokenManager) generatePair(userID, sessionID uuid.UUID, device string) (*TokenPair, error) {
+	access, err := tm.sign(&Claims{
+		UserID:    userID,
+		Type:      TokenTypeAccess,
+		SessionID: sessionID,
+		Device:    device,
+	}, AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := tm.sign(&Claims{
+		UserID:    userID,
+		Type:      TokenTypeRefresh,
+		SessionID: sessionID,
+		Device:    device,
+	}, RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		SessionID:    sessionID,
+		ExpiresAt:    time.Now().Add(AccessTokenTTL),
+	}, nil
+}
+
+// sign fills in the registered claims and signs the token
+func (tm *TokenManager) sign(claims *Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Issuer:    tm.issuer,
+		Subject:   claims.UserID.String(),
+		Audience:  jwt.ClaimStrings{tm.audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	key := tm.keys.Active()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
 }
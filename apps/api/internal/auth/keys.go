@@ -0,0 +1,500 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const activeKIDFile = "active_kid"
+
+// keyRefreshInterval is how long a key set with a store waits before loading it again
+// for a kid it doesn't know
+const keyRefreshInterval = 5 * time.Second
+
+var (
+	ErrKeyNotFound          = errors.New("signing key not found")
+	ErrActiveKeyRemoval     = errors.New("cannot remove the active signing key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// SigningKey is a JWT signing key identified by its kid
+type SigningKey struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	CreatedAt time.Time `json:"created_at"`
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// StoredKey is a signing key as kept in a KeyStore. Data is a PKCS#8 PEM private key,
+// or a base64 HMAC secret, as in a key directory.
+type StoredKey struct {
+	ID        string
+	Algorithm string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// KeyStore shares signing keys between the nodes of a deployment, so that tokens
+// signed with a key rotated on one node validate on the others
+type KeyStore interface {
+	// LoadKeys returns every stored key and the active kid, empty when none is set
+	LoadKeys() ([]StoredKey, string, error)
+	// SaveKey stores a new key as the active one
+	SaveKey(key StoredKey) error
+	// SetActiveKey makes kid the active key; no stored key is active when kid isn't one
+	SetActiveKey(kid string) error
+	RemoveKey(kid string) error
+}
+
+// KeySet holds every key tokens may be verified with and the one new tokens are signed with.
+// Keeping retired keys around lets tokens signed before a rotation stay valid until they expire.
+type KeySet struct {
+	mu        sync.RWMutex
+	keys      map[string]*SigningKey
+	activeKID string
+	legacyKID string
+	dir       string
+	// store, when set, holds the keys rotated through the API; stored are the kids
+	// loaded from it, and refreshedAt when it was last loaded
+	store       KeyStore
+	stored      map[string]bool
+	refreshedAt time.Time
+}
+
+// NewKeySet creates a key set whose initial key is an HMAC secret. That key is
+// also used to verify tokens issued before kid headers existed.
+func NewKeySet(legacyKID string, secret []byte) *KeySet {
+	ks := &KeySet{
+		keys:      make(map[string]*SigningKey),
+		activeKID: legacyKID,
+		legacyKID: legacyKID,
+	}
+	ks.keys[legacyKID] = newHMACKey(legacyKID, secret, time.Time{})
+	return ks
+}
+
+// LoadDir loads persisted keys from dir and remembers it for keys generated later.
+// Files named <kid>.pem hold PKCS#8 RSA or Ed25519 private keys and files named
+// <kid>.key hold base64 HMAC secrets. The active kid is read from dir/active_kid.
+func (ks *KeySet) LoadDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.dir = dir
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != ".pem" && ext != ".key" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read key %s: %w", name, err)
+		}
+
+		kid := strings.TrimSuffix(name, ext)
+		key, err := parseKey(kid, ext, data, info.ModTime())
+		if err != nil {
+			return fmt.Errorf("failed to parse key %s: %w", name, err)
+		}
+		ks.keys[kid] = key
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, activeKIDFile)); err == nil {
+		kid := strings.TrimSpace(string(data))
+		if _, ok := ks.keys[kid]; ok {
+			ks.activeKID = kid
+		}
+	}
+
+	return nil
+}
+
+// UseStore loads the keys in store and keeps the keys rotated, activated and removed
+// from then on there instead of in the key directory. Other nodes learn of them on
+// Refresh, or as soon as a token signed with an unknown kid comes in.
+func (ks *KeySet) UseStore(store KeyStore) error {
+	ks.mu.Lock()
+	ks.store = store
+	ks.stored = make(map[string]bool)
+	ks.mu.Unlock()
+	return ks.Refresh()
+}
+
+// Refresh loads the keys in the store again: keys rotated elsewhere are added, those
+// removed are dropped, and the active key follows the store's
+func (ks *KeySet) Refresh() error {
+	ks.mu.RLock()
+	store := ks.store
+	ks.mu.RUnlock()
+	if store == nil {
+		return nil
+	}
+
+	stored, activeKID, err := store.LoadKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load stored keys: %w", err)
+	}
+	keys := make(map[string]*SigningKey, len(stored))
+	for _, s := range stored {
+		key, err := parseKey(s.ID, keyExtension(s.Algorithm), s.Data, s.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to parse stored key %s: %w", s.ID, err)
+		}
+		keys[s.ID] = key
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for kid := range ks.stored {
+		if keys[kid] == nil && kid != ks.activeKID {
+			delete(ks.keys, kid)
+		}
+	}
+	ks.stored = make(map[string]bool, len(keys))
+	for kid, key := range keys {
+		ks.keys[kid] = key
+		ks.stored[kid] = true
+	}
+	if keys[activeKID] != nil {
+		ks.activeKID = activeKID
+	}
+	ks.refreshedAt = time.Now()
+	return nil
+}
+
+// SetActive makes kid the key new tokens are signed with
+func (ks *KeySet) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, ok := ks.keys[kid]; !ok {
+		return ErrKeyNotFound
+	}
+	if ks.store != nil {
+		if err := ks.store.SetActiveKey(kid); err != nil {
+			return fmt.Errorf("failed to save active key: %w", err)
+		}
+	}
+	ks.activeKID = kid
+	return ks.persistActive()
+}
+
+// Rotate generates a new key with the given algorithm, persists it and makes it active
+func (ks *KeySet) Rotate(algorithm string) (*SigningKey, error) {
+	id, err := randomKeyID()
+	if err != nil {
+		return nil, err
+	}
+	kid := strings.ToLower(algorithm) + "-" + id
+	key, encoded, ext, err := generateKey(kid, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	switch {
+	case ks.store != nil:
+		err := ks.store.SaveKey(StoredKey{ID: kid, Algorithm: key.Algorithm, Data: encoded, CreatedAt: key.CreatedAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save key: %w", err)
+		}
+		ks.stored[kid] = true
+	case ks.dir != "":
+		if err := os.WriteFile(filepath.Join(ks.dir, kid+ext), encoded, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save key: %w", err)
+		}
+	}
+	ks.keys[kid] = key
+	ks.activeKID = kid
+	if err := ks.persistActive(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Remove retires a key. Tokens signed with it stop validating immediately, and on other
+// nodes once they refresh.
+func (ks *KeySet) Remove(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if kid == ks.activeKID {
+		return ErrActiveKeyRemoval
+	}
+	if _, ok := ks.keys[kid]; !ok {
+		return ErrKeyNotFound
+	}
+	if ks.stored[kid] {
+		if err := ks.store.RemoveKey(kid); err != nil {
+			return fmt.Errorf("failed to remove key: %w", err)
+		}
+		delete(ks.stored, kid)
+	}
+	delete(ks.keys, kid)
+
+	if ks.dir != "" {
+		for _, ext := range []string{".pem", ".key"} {
+			os.Remove(filepath.Join(ks.dir, kid+ext))
+		}
+	}
+	return nil
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[ks.activeKID]
+}
+
+// ActiveKID returns the kid of the active key
+func (ks *KeySet) ActiveKID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.activeKID
+}
+
+// Get returns the key for kid. An empty kid resolves to the legacy key. A kid it
+// doesn't know may have been rotated on another node, so the store is loaded again,
+// at most every keyRefreshInterval.
+func (ks *KeySet) Get(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	if kid == "" {
+		kid = ks.legacyKID
+	}
+	key, ok := ks.keys[kid]
+	refresh := !ok && ks.store != nil && time.Since(ks.refreshedAt) >= keyRefreshInterval
+	ks.mu.RUnlock()
+	if !refresh {
+		return key, ok
+	}
+
+	if err := ks.Refresh(); err != nil {
+		return nil, false
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok = ks.keys[kid]
+	return key, ok
+}
+
+// List returns all keys sorted by creation time
+func (ks *KeySet) List() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// JWKS returns the public keys of all asymmetric keys as a JSON Web Key Set.
+// HMAC keys are never published.
+func (ks *KeySet) JWKS() map[string]interface{} {
+	jwks := []map[string]string{}
+	for _, key := range ks.List() {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"kid": key.ID,
+				"alg": key.Algorithm,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": key.ID,
+				"alg": key.Algorithm,
+				"use": "sig",
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": jwks}
+}
+
+// signingAlgorithms are the algorithms tokens may claim. Each key only validates tokens
+// of its own algorithm, so this doesn't depend on the keys loaded, and a token signed
+// with a key rotated on another node reaches the lookup of its kid.
+var signingAlgorithms = []string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}
+
+func (ks *KeySet) persistActive() error {
+	if ks.dir == "" {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(ks.dir, activeKIDFile), []byte(ks.activeKID), 0600); err != nil {
+		return fmt.Errorf("failed to save active key: %w", err)
+	}
+	return nil
+}
+
+// randomKeyID returns the random part of a new kid, so that keys rotated at the same
+// moment, on one node or several, never share one
+func randomKeyID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// keyExtension is the file extension keys of algorithm are encoded as
+func keyExtension(algorithm string) string {
+	if algorithm == AlgorithmHS256 {
+		return ".key"
+	}
+	return ".pem"
+}
+
+func newHMACKey(kid string, secret []byte, createdAt time.Time) *SigningKey {
+	return &SigningKey{
+		ID:        kid,
+		Algorithm: AlgorithmHS256,
+		CreatedAt: createdAt,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func parseKey(kid, ext string, data []byte, createdAt time.Time) (*SigningKey, error) {
+	if ext == ".key" {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		return newHMACKey(kid, secret, createdAt), nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{
+			ID:        kid,
+			Algorithm: AlgorithmRS256,
+			CreatedAt: createdAt,
+			method:    jwt.SigningMethodRS256,
+			signKey:   key,
+			verifyKey: &key.PublicKey,
+		}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{
+			ID:        kid,
+			Algorithm: AlgorithmEdDSA,
+			CreatedAt: createdAt,
+			method:    jwt.SigningMethodEdDSA,
+			signKey:   key,
+			verifyKey: key.Public(),
+		}, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// generateKey creates a new key and its on-disk encoding
+func generateKey(kid, algorithm string) (*SigningKey, []byte, string, error) {
+	now := time.Now()
+
+	switch algorithm {
+	case AlgorithmHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, "", err
+		}
+		encoded := []byte(base64.StdEncoding.EncodeToString(secret))
+		return newHMACKey(kid, secret, now), encoded, ".key", nil
+
+	case AlgorithmRS256, AlgorithmEdDSA:
+		var private interface{}
+		if algorithm == AlgorithmRS256 {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			private = key
+		} else {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			private = key
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		key, err := parseKey(kid, ".pem", encoded, now)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return key, encoded, ".pem", nil
+
+	default:
+		return nil, nil, "", ErrUnsupportedAlgorithm
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scopes that can be granted to third-party applications
+const (
+	ScopeReadMessages  = "read:messages"
+	ScopeWriteMessages = "write:messages"
+	ScopeReadProfile   = "read:profile"
+)
+
+// AllScopes lists every scope a third-party application may request
+var AllScopes = []string{
+	ScopeReadMessages,
+	ScopeWriteMessages,
+	ScopeReadProfile,
+}
+
+// ScopeDescriptions say what each scope lets an application do, for permission prompts
+var ScopeDescriptions = map[string]string{
+	ScopeReadMessages:  "Read messages and receive new ones as they are sent",
+	ScopeWriteMessages: "Send, edit and delete messages",
+	ScopeReadProfile:   "See profile details such as username and status",
+}
+
+// IsValidScope reports whether scope is a known scope
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes parses a space separated scope string and rejects unknown scopes
+func ParseScopes(raw string) ([]string, error) {
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range strings.Fields(raw) {
+		if !IsValidScope(scope) {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether scopes contains scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSubset reports whether every scope in requested is present in allowed
+func IsSubset(requested, allowed []string) bool {
+	for _, scope := range requested {
+		if !HasScope(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
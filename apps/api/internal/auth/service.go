@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// serviceAudience keeps service tokens from being accepted as user tokens and vice versa
+const serviceAudience = "talkify-internal"
+
+var (
+	ErrServiceNotAllowed = errors.New("service is not allowed")
+	ErrNoServiceIdentity = errors.New("no client certificate or service token presented")
+)
+
+// ServiceClaims identifies an internal caller such as the bridge or notification worker
+type ServiceClaims struct {
+	Service string `json:"service"`
+	jwt.RegisteredClaims
+}
+
+// ServiceAuthenticator verifies internal callers via mTLS client certificates or signed service tokens
+type ServiceAuthenticator struct {
+	secret  []byte
+	allowed map[string]bool
+}
+
+// NewServiceAuthenticator creates an authenticator accepting the given service names.
+// An empty allow list accepts every service with a valid identity.
+func NewServiceAuthenticator(secret string, allowed []string) *ServiceAuthenticator {
+	sa := &ServiceAuthenticator{
+		secret:  []byte(secret),
+		allowed: make(map[string]bool),
+	}
+	for _, name := range allowed {
+		sa.allowed[name] = true
+	}
+	return sa
+}
+
+// GenerateToken issues a service token for name
+func (sa *ServiceAuthenticator) GenerateToken(name string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &ServiceClaims{
+		Service: name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   name,
+			Audience:  jwt.ClaimStrings{serviceAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(sa.secret)
+}
+
+// Authenticate returns the name of the calling service. A verified client certificate
+// takes precedence; otherwise a bearer service token is required.
+func (sa *ServiceAuthenticator) Authenticate(r *http.Request, bearer string) (string, error) {
+	var name string
+
+	switch {
+	case r.TLS != nil && len(r.TLS.VerifiedChains) > 0:
+		name = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	case bearer != "" && len(sa.secret) > 0:
+		token, err := jwt.ParseWithClaims(bearer, &ServiceClaims{}, func(token *jwt.Token) (interface{}, error) {
+			return sa.secret, nil
+		}, jwt.WithValidMethods([]string{AlgorithmHS256}), jwt.WithAudience(serviceAudience))
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		claims, ok := token.Claims.(*ServiceClaims)
+		if !ok || !token.Valid {
+			return "", ErrInvalidToken
+		}
+		name = claims.Service
+	default:
+		return "", ErrNoServiceIdentity
+	}
+
+	if name == "" || (len(sa.allowed) > 0 && !sa.allowed[name]) {
+		return "", ErrServiceNotAllowed
+	}
+	return name, nil
+}
+
+// MutualTLSConfig builds a server TLS config that verifies client certificates against the CA
+// when they are presented. Callers without a certificate can still use a service token.
+func MutualTLSConfig(caFile string) (*tls.Config, error) {
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in CA file")
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
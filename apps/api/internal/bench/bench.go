@@ -0,0 +1,168 @@
+// Package bench reads the results of the hot path benchmarks, as printed by go test
+// -bench for cmd/bench, and compares them with a baseline to catch regressions
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is how a benchmark performed
+type Result struct {
+	Name        string `json:"name"`
+	N           int    `json:"n"`
+	NsPerOp     int64  `json:"ns_per_op"`
+	AllocsPerOp int64  `json:"allocs_per_op"`
+	BytesPerOp  int64  `json:"bytes_per_op"`
+	// Metrics are those a benchmark reports itself, such as the clients dropped by a fan-out
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Report is a run of benchmarks as written to a results file, with the machine they
+// ran on since results only compare on the same one
+type Report struct {
+	TakenAt   time.Time `json:"taken_at"`
+	GoVersion string    `json:"go_version"`
+	GOOS      string    `json:"goos"`
+	GOARCH    string    `json:"goarch"`
+	CPUs      int       `json:"cpus"`
+	Results   []Result  `json:"results"`
+}
+
+// Parse reads the output of go test -bench -benchmem, calling done with each result
+// as it comes. Lines other than results, such as the package headers, are skipped.
+func Parse(r io.Reader, done func(Result)) (*Report, error) {
+	report := &Report{
+		TakenAt:   time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		result, ok := parseResult(scanner.Text())
+		if !ok {
+			continue
+		}
+		report.Results = append(report.Results, result)
+		if done != nil {
+			done(result)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read benchmark output: %w", err)
+	}
+	return report, nil
+}
+
+// parseResult parses a result line such as
+// "BenchmarkHubFanOut/clients=100-8  5000  2400 ns/op  0 B/op  0 allocs/op  0 dropped".
+// The GOMAXPROCS suffix is dropped from the name so results compare across runs.
+func parseResult(line string) (Result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+		return Result{}, false
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Result{}, false
+	}
+	name := fields[0]
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			name = name[:i]
+		}
+	}
+
+	result := Result{Name: name, N: n}
+	for i := 2; i < len(fields); i += 2 {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Result{}, false
+		}
+		switch unit := fields[i+1]; unit {
+		case "ns/op":
+			result.NsPerOp = int64(value)
+		case "B/op":
+			result.BytesPerOp = int64(value)
+		case "allocs/op":
+			result.AllocsPerOp = int64(value)
+		default:
+			if result.Metrics == nil {
+				result.Metrics = map[string]float64{}
+			}
+			result.Metrics[unit] = value
+		}
+	}
+	return result, true
+}
+
+// Regression is a benchmark that got slower than its baseline allows
+type Regression struct {
+	Name     string
+	Baseline int64
+	Current  int64
+	// Change is the slowdown as a fraction of the baseline
+	Change float64
+}
+
+// Compare returns the benchmarks of report whose time per operation exceeds that of
+// the same benchmark in baseline by more than tolerance, a fraction such as 0.2.
+// Benchmarks missing from either are not compared, nor are those that failed (N of 0).
+func Compare(baseline, report *Report, tolerance float64) []Regression {
+	before := make(map[string]Result, len(baseline.Results))
+	for _, result := range baseline.Results {
+		before[result.Name] = result
+	}
+
+	var regressions []Regression
+	for _, result := range report.Results {
+		base, ok := before[result.Name]
+		if !ok || base.N == 0 || result.N == 0 || base.NsPerOp == 0 {
+			continue
+		}
+		change := float64(result.NsPerOp-base.NsPerOp) / float64(base.NsPerOp)
+		if change > tolerance {
+			regressions = append(regressions, Regression{
+				Name:     result.Name,
+				Baseline: base.NsPerOp,
+				Current:  result.NsPerOp,
+				Change:   change,
+			})
+		}
+	}
+	return regressions
+}
+
+// ReadReport reads a results file written by WriteReport
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("failed to parse results %s: %w", path, err)
+	}
+	return report, nil
+}
+
+// WriteReport writes report to path as JSON
+func WriteReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package bench
+
+import (
+	"fmt"
+	"strconv"
+
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Fixture is a conversation between two users created for the message benchmarks
+type Fixture struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+	// Users are the two participants, and ConversationID their direct conversation
+	Users          []uuid.UUID
+	ConversationID uuid.UUID
+}
+
+// Seed creates two users and a direct conversation between them holding messages
+// messages, for the benchmarks to read from and write to
+func Seed(db *sqlx.DB, encryptor encryption.Encryptor, messages int) (*Fixture, error) {
+	f := &Fixture{db: db, encryptor: encryptor}
+	userService := models.NewUserService(db, encryptor)
+	run := uuid.New().String()[:8]
+	for i := 0; i < 2; i++ {
+		user, err := userService.Create(&models.CreateUserInput{
+			Username: fmt.Sprintf("bench-%s-%d", run, i),
+			Email:    fmt.Sprintf("bench-%s-%d@bench.talkify.local", run, i),
+			Phone:    fmt.Sprintf("+1555%07d", uuid.New().ID()%10000000),
+			Password: uuid.New().String(),
+		})
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create benchmark user: %w", err)
+		}
+		f.Users = append(f.Users, user.ID)
+	}
+
+	conversation, err := models.NewConversationService(db, encryptor).Create(f.Users[0], &models.CreateConversationInput{
+		UserIDs: []uuid.UUID{f.Users[1]},
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create benchmark conversation: %w", err)
+	}
+	f.ConversationID = conversation.ID
+
+	messageService := models.NewMessageService(db, encryptor)
+	for i := 0; i < messages; i++ {
+		if err := messageService.Create(f.Message(i)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to seed benchmark messages: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// Message returns the i-th message of the fixture, sent by its users in turn
+func (f *Fixture) Message(i int) *models.Message {
+	return &models.Message{
+		ConversationID: f.ConversationID,
+		SenderID:       f.Users[i%len(f.Users)],
+		Content:        "Benchmark message " + strconv.Itoa(i),
+		MessageType:    string(models.TextMessage),
+	}
+}
+
+// Close removes the conversation with its messages, as purging a deleted conversation
+// does, and deactivates the users, whom the inactivity and orphan cleanups take from
+// there
+func (f *Fixture) Close() error {
+	if f.ConversationID != uuid.Nil {
+		if _, err := f.db.Exec(`DELETE FROM messages WHERE conversation_id = $1`, f.ConversationID); err != nil {
+			return fmt.Errorf("failed to remove benchmark messages: %w", err)
+		}
+		if _, err := f.db.Exec(`DELETE FROM conversations WHERE id = $1`, f.ConversationID); err != nil {
+			return fmt.Errorf("failed to remove benchmark conversation: %w", err)
+		}
+	}
+	userService := models.NewUserService(f.db, f.encryptor)
+	for _, id := range f.Users {
+		if err := userService.Delete(id); err != nil {
+			return fmt.Errorf("failed to deactivate benchmark user: %w", err)
+		}
+	}
+	return nil
+}
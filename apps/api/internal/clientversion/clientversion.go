@@ -0,0 +1,86 @@
+// Package clientversion parses and compares the app versions clients report in the
+// X-Client-Version header, so outdated apps can be told to upgrade.
+package clientversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Headers clients identify their app with
+const (
+	PlatformHeader = "X-Client-Platform"
+	VersionHeader  = "X-Client-Version"
+)
+
+// maxLength bounds the platform and version strings that are stored
+const maxLength = 32
+
+// Version is a dotted numeric app version such as 2.3.0. Missing trailing parts count
+// as zero, so 2.3 equals 2.3.0.
+type Version []int
+
+// Parse parses a version like 2.3.0. A leading v and anything after a - or + (a
+// pre-release or build suffix) are ignored.
+func Parse(s string) (Version, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" || len(s) > maxLength {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	parts := strings.Split(s, ".")
+	version := make(Version, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+// Compare returns -1 when v is older than other, 1 when it is newer and 0 when they
+// are the same version
+func (v Version) Compare(other Version) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		a, b := part(v, i), part(other, i)
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+	}
+	return 0
+}
+
+func part(v Version, i int) int {
+	if i < len(v) {
+		return v[i]
+	}
+	return 0
+}
+
+// String formats the version as dotted numbers
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Platform normalizes a reported platform name, e.g. "iOS" to "ios". It returns ""
+// when the name is missing or too long to be one.
+func Platform(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) > maxLength {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package compliance
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+)
+
+// StreamEvent is a message event as streamed to compliance recorders. Payload is the
+// event's JSON data encrypted with the stream key, in the format of the encryption
+// package; Signature is the HMAC-SHA256 of the offset, type, time and payload under
+// the compliance signing key.
+type StreamEvent struct {
+	Offset     int64     `json:"offset"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Payload    string    `json:"payload"`
+	Signature  string    `json:"signature"`
+}
+
+// Sealer encrypts and signs stream events, and checks and decrypts them for recorders
+// written in Go
+type Sealer struct {
+	cipher *encryption.Manager
+	key    []byte
+}
+
+// NewSealer creates a sealer that encrypts with a key derived from streamKey and
+// signs with signingKey
+func NewSealer(streamKey, signingKey string) *Sealer {
+	derived := sha256.Sum256([]byte("talkify/compliance-stream\n" + streamKey))
+	cipher, _ := encryption.NewManager(derived[:])
+	return &Sealer{cipher: cipher, key: []byte(signingKey)}
+}
+
+// Seal encrypts data as the event at offset and signs it
+func (s *Sealer) Seal(offset int64, eventType string, occurredAt time.Time, data interface{}) (*StreamEvent, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := s.cipher.Encrypt(raw)
+	if err != nil {
+		return nil, err
+	}
+	event := &StreamEvent{Offset: offset, Type: eventType, OccurredAt: occurredAt, Payload: payload}
+	event.Signature = sign256(s.key, streamSigned(event))
+	return event, nil
+}
+
+// Open checks the signature of an event and returns its decrypted data
+func (s *Sealer) Open(event *StreamEvent) ([]byte, error) {
+	if !hmac.Equal([]byte(event.Signature), []byte(sign256(s.key, streamSigned(event)))) {
+		return nil, ErrBadSignature
+	}
+	data, err := s.cipher.Decrypt(event.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("event %d: %w", event.Offset, err)
+	}
+	return data, nil
+}
+
+// streamSigned is what the signature of an event covers
+func streamSigned(event *StreamEvent) string {
+	return strconv.FormatInt(event.Offset, 10) + "\n" + event.Type + "\n" +
+		event.OccurredAt.UTC().Format(time.RFC3339Nano) + "\n" + event.Payload
+}
@@ -1,67 +1,941 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	"talkify/apps/api/internal/groupname"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles select a set of defaults and how strictly the configuration is validated
+const (
+	ProfileDevelopment = "development"
+	ProfileStaging     = "staging"
+	ProfileProduction  = "production"
 )
 
+// insecureJWTSecret is the development default; it is rejected outside development
+const insecureJWTSecret = "your-256-bit-secret"
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port             string   `yaml:"port"`               // PORT, default 8080
+	HTTPPort         string   `yaml:"http_port"`          // HTTP_PORT, default 80; plain HTTP redirect listener
+	TLSCertFile      string   `yaml:"tls_cert_file"`      // TLS_CERT_FILE
+	TLSKeyFile       string   `yaml:"tls_key_file"`       // TLS_KEY_FILE
+	AutocertEnabled  bool     `yaml:"autocert_enabled"`   // TLS_AUTOCERT, default false
+	AutocertHosts    []string `yaml:"autocert_hosts"`     // TLS_AUTOCERT_HOSTS, comma separated
+	AutocertCacheDir string   `yaml:"autocert_cache_dir"` // TLS_AUTOCERT_CACHE_DIR, default data/autocert
+	RedirectHTTP     bool     `yaml:"redirect_http"`      // TLS_REDIRECT_HTTP, default true
+	HTTP2Enabled     bool     `yaml:"http2_enabled"`      // HTTP2_ENABLED, default true
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`        // SERVER_READ_TIMEOUT, default 15s
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // SERVER_READ_HEADER_TIMEOUT, default 5s
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // SERVER_WRITE_TIMEOUT, default 30s
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // SERVER_IDLE_TIMEOUT, default 120s
+	RequestTimeout    time.Duration `yaml:"request_timeout"`     // SERVER_REQUEST_TIMEOUT, default 20s
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`    // SERVER_MAX_HEADER_BYTES, default 1 MiB
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`    // SERVER_SHUTDOWN_TIMEOUT, default 30s
+
+	// Client addresses are taken from RemoteIPHeaders only when the request comes
+	// through one of TrustedProxies; when none are set no peer is trusted and clients
+	// are known by the address they connect from. The proxies may also tell the
+	// client's country in CountryHeader, e.g. CF-IPCountry, which is ignored from
+	// other peers.
+	TrustedProxies  []string `yaml:"trusted_proxies"`   // SERVER_TRUSTED_PROXIES, comma separated IPs or CIDRs
+	RemoteIPHeaders []string `yaml:"remote_ip_headers"` // SERVER_REMOTE_IP_HEADERS, default X-Forwarded-For,X-Real-IP
+	CountryHeader   string   `yaml:"country_header"`    // SERVER_COUNTRY_HEADER
+}
+
+// TLSEnabled reports whether the server terminates TLS itself
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.AutocertEnabled || (c.TLSCertFile != "" && c.TLSKeyFile != "")
+}
+
 // DatabaseConfig holds database connection settings
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `yaml:"host"`     // DB_HOST, default localhost
+	Port     string `yaml:"port"`     // DB_PORT, default 5433
+	User     string `yaml:"user"`     // DB_USER
+	Password string `yaml:"password"` // DB_PASSWORD
+	DBName   string `yaml:"name"`     // DB_NAME
+	SSLMode  string `yaml:"ssl_mode"` // DB_SSL_MODE (or legacy DB_SSLMODE), default disable (require outside development)
+
+	// StartupMaxWait is how long startup keeps retrying an unreachable database
+	StartupMaxWait time.Duration `yaml:"startup_max_wait"` // DB_STARTUP_MAX_WAIT, default 60s
+	MigrationsDir  string        `yaml:"migrations_dir"`   // DB_MIGRATIONS_DIR, default migrations
+
+	// LogQueries logs every query with its arguments and duration at debug level, and
+	// has a sample of the queries slower than ExplainThreshold explained with EXPLAIN
+	// ANALYZE. Development only, as arguments hold user data.
+	LogQueries           bool          `yaml:"log_queries"`            // DB_LOG_QUERIES, default true in development
+	ExplainThreshold     time.Duration `yaml:"explain_threshold"`      // DB_EXPLAIN_THRESHOLD, default 100ms
+	ExplainSamplePercent int           `yaml:"explain_sample_percent"` // DB_EXPLAIN_SAMPLE_PERCENT, default 10
 }
 
 // EncryptionConfig holds encryption settings
 type EncryptionConfig struct {
-	KeyFile string
+	KeyFile string `yaml:"key_file"` // ENCRYPTION_KEY_FILE, default data/encryption.key
+	// Mode is the algorithm new data is encrypted with, aes-gcm or xchacha20-poly1305,
+	// which can be switched between as data is tagged with its algorithm. It can also be
+	// plaintext to store data unencrypted without a key outside production; a database
+	// is kept encrypted or not as it was first started.
+	Mode string `yaml:"mode"` // ENCRYPTION_MODE, default aes-gcm
 }
 
 // JWTConfig holds JWT settings
 type JWTConfig struct {
-	SecretKey string
+	SecretKey string `yaml:"secret_key"` // JWT_SECRET_KEY, at least 32 bytes outside development
+	SecretKID string `yaml:"secret_kid"` // JWT_SECRET_KID, default "default"
+	KeysDir   string `yaml:"keys_dir"`   // JWT_KEYS_DIR, default data/jwt
+	ActiveKID string `yaml:"active_kid"` // JWT_ACTIVE_KID
+	Issuer    string `yaml:"issuer"`     // JWT_ISSUER, default talkify
+	Audience  string `yaml:"audience"`   // JWT_AUDIENCE, default talkify-api
+}
+
+// QuotaConfig holds per-user usage limits. A zero value means unlimited.
+type QuotaConfig struct {
+	MaxStorageBytes int64 `yaml:"max_storage_bytes"` // QUOTA_MAX_STORAGE_BYTES, default 1 GiB
+	MaxMessages     int64 `yaml:"max_messages"`      // QUOTA_MAX_MESSAGES, default unlimited
+	MaxMediaSize    int64 `yaml:"max_media_size"`    // QUOTA_MAX_MEDIA_SIZE, default 25 MiB
+	// Conversations and groups a user may create per hour and per day, counting deleted
+	// ones. Users an administrator verified get the higher verified limits.
+	ConversationsPerHour         int `yaml:"conversations_per_hour"`          // QUOTA_CONVERSATIONS_PER_HOUR, default 20
+	ConversationsPerDay          int `yaml:"conversations_per_day"`           // QUOTA_CONVERSATIONS_PER_DAY, default 100
+	VerifiedConversationsPerHour int `yaml:"verified_conversations_per_hour"` // QUOTA_VERIFIED_CONVERSATIONS_PER_HOUR, default 60
+	VerifiedConversationsPerDay  int `yaml:"verified_conversations_per_day"`  // QUOTA_VERIFIED_CONVERSATIONS_PER_DAY, default 500
+}
+
+// GroupConfig holds group size settings. Groups that grow past LargeThreshold switch to
+// large-group mode for good: read receipts only follow each member's read watermark and
+// participants are listed page by page. Zero means no limit, or no large-group mode.
+type GroupConfig struct {
+	MaxParticipants int `yaml:"max_participants"` // GROUP_MAX_PARTICIPANTS, default 1000
+	LargeThreshold  int `yaml:"large_threshold"`  // GROUP_LARGE_THRESHOLD, default 256
+
+	// Groups without a name of their own are named after up to NameParticipants of
+	// their participants besides the viewer, in the language the client asks for with
+	// Accept-Language or else NameLocale. NameTemplates adds languages or overrides
+	// the built-in ones, by locale; it is only read from the config file.
+	NameParticipants int                           `yaml:"name_participants"` // GROUP_NAME_PARTICIPANTS, default 2
+	NameLocale       string                        `yaml:"name_locale"`       // GROUP_NAME_LOCALE, default en
+	NameTemplates    map[string]groupname.Template `yaml:"name_templates"`
+}
+
+// PaginationConfig bounds list endpoints. A limit above what a list allows, or above
+// MaxLimit, is lowered to it rather than refused.
+type PaginationConfig struct {
+	MaxLimit          int `yaml:"max_limit"`          // PAGINATION_MAX_LIMIT, default 1000
+	ConversationLimit int `yaml:"conversation_limit"` // PAGINATION_CONVERSATION_LIMIT, default 100
+}
+
+// PresenceConfig holds online status settings. Users are shown offline once they have
+// not been seen for OnlineTTL, whether through the WebSocket, an API call or a heartbeat.
+type PresenceConfig struct {
+	OnlineTTL     time.Duration `yaml:"online_ttl"`     // PRESENCE_ONLINE_TTL, default 2m
+	SweepInterval time.Duration `yaml:"sweep_interval"` // PRESENCE_SWEEP_INTERVAL, default 30s
+}
+
+// RetentionConfig holds settings for purging deleted data
+type RetentionConfig struct {
+	ConversationGrace time.Duration `yaml:"conversation_grace"` // RETENTION_CONVERSATION_GRACE, default 720h (30 days)
+	EmptyConversation time.Duration `yaml:"empty_conversation"` // RETENTION_EMPTY_CONVERSATION, default 720h; 0 keeps them
+	StagedAttachment  time.Duration `yaml:"staged_attachment"`  // RETENTION_STAGED_ATTACHMENT, default 168h (7 days)
+	Interval          time.Duration `yaml:"interval"`           // RETENTION_INTERVAL, default 1h
+}
+
+// InactiveConfig is the policy for accounts nobody uses. Users inactive for WarnAfter
+// are emailed, deactivated once inactive for DeactivateAfter and anonymized once
+// inactive for AnonymizeAfter. Administrators and users on legal hold are exempt.
+type InactiveConfig struct {
+	WarnAfter       time.Duration `yaml:"warn_after"`       // INACTIVE_WARN_AFTER, default 0 (policy disabled)
+	DeactivateAfter time.Duration `yaml:"deactivate_after"` // INACTIVE_DEACTIVATE_AFTER
+	AnonymizeAfter  time.Duration `yaml:"anonymize_after"`  // INACTIVE_ANONYMIZE_AFTER; 0 keeps deactivated accounts
+	Interval        time.Duration `yaml:"interval"`         // INACTIVE_INTERVAL, default 24h
+}
+
+// Enabled reports whether the policy runs
+func (c *InactiveConfig) Enabled() bool {
+	return c.WarnAfter > 0
+}
+
+// SessionConfig limits how long sign-ins last. Zero values disable each limit.
+type SessionConfig struct {
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // SESSION_IDLE_TIMEOUT, sign out after this long without requests
+	MaxLifetime time.Duration `yaml:"max_lifetime"` // SESSION_MAX_LIFETIME, sign out this long after signing in
+	MaxPerUser  int           `yaml:"max_per_user"` // SESSION_MAX_PER_USER, sign out the least recently used beyond this many
+}
+
+// LoginConfig controls how sign-ins from devices, IPs or countries a user has not used
+// before are handled. Only new devices are emailed about.
+type LoginConfig struct {
+	AlertNewDevices  bool          `yaml:"alert_new_devices"`  // LOGIN_ALERT_NEW_DEVICES, default true; notify and email the user
+	SecurityMessages bool          `yaml:"security_messages"`  // LOGIN_SECURITY_MESSAGES, default false; also message the user from the Talkify Security account
+	VerifyNewDevices bool          `yaml:"verify_new_devices"` // LOGIN_VERIFY_NEW_DEVICES, default false; require an emailed code
+	CodeTTL          time.Duration `yaml:"code_ttl"`           // LOGIN_CODE_TTL, default 10m
+}
+
+// PasswordConfig is the policy new passwords must meet. With BreachCheck, passwords are
+// also looked up in Have I Been Pwned; only the first five characters of their SHA-1
+// hash leave the server. Lookups that fail let the password through.
+type PasswordConfig struct {
+	MinLength     int           `yaml:"min_length"`     // PASSWORD_MIN_LENGTH, default 8
+	RequireUpper  bool          `yaml:"require_upper"`  // PASSWORD_REQUIRE_UPPER, default false
+	RequireLower  bool          `yaml:"require_lower"`  // PASSWORD_REQUIRE_LOWER, default false
+	RequireDigit  bool          `yaml:"require_digit"`  // PASSWORD_REQUIRE_DIGIT, default false
+	RequireSymbol bool          `yaml:"require_symbol"` // PASSWORD_REQUIRE_SYMBOL, default false
+	Banned        []string      `yaml:"banned"`         // PASSWORD_BANNED, comma separated; on top of a built-in list of common passwords
+	BreachCheck   bool          `yaml:"breach_check"`   // PASSWORD_BREACH_CHECK, default false
+	BreachURL     string        `yaml:"breach_url"`     // PASSWORD_BREACH_URL, default https://api.pwnedpasswords.com/range/
+	BreachTimeout time.Duration `yaml:"breach_timeout"` // PASSWORD_BREACH_TIMEOUT, default 3s
+	// Argon2id cost of new hashes. Hashes made with other parameters, and legacy bcrypt
+	// hashes, are replaced at the next successful login.
+	HashMemory      int `yaml:"hash_memory"`      // PASSWORD_HASH_MEMORY, in KiB, default 19456
+	HashIterations  int `yaml:"hash_iterations"`  // PASSWORD_HASH_ITERATIONS, default 2
+	HashParallelism int `yaml:"hash_parallelism"` // PASSWORD_HASH_PARALLELISM, default 1
+}
+
+// RecoveryConfig controls recovering an account through trusted contacts
+type RecoveryConfig struct {
+	Delay      time.Duration `yaml:"delay"`       // RECOVERY_DELAY, default 48h; wait before an approved request can be completed
+	RequestTTL time.Duration `yaml:"request_ttl"` // RECOVERY_REQUEST_TTL, default 168h
+}
+
+// InviteConfig holds the key invite links are signed with. Invite links are
+// unavailable without it.
+type InviteConfig struct {
+	SigningKey string        `yaml:"signing_key"` // INVITE_SIGNING_KEY, at least 32 bytes
+	TTL        time.Duration `yaml:"ttl"`         // INVITE_TTL, default 168h
+}
+
+// ComplianceConfig holds the key compliance exports are signed with. Exports are
+// unavailable without it. Recorders are the services, authenticated on the service
+// listener, that may stream every message event; the stream is signed with SigningKey
+// and its payloads are encrypted with StreamKey.
+type ComplianceConfig struct {
+	SigningKey string   `yaml:"signing_key"` // COMPLIANCE_SIGNING_KEY, at least 32 bytes
+	Recorders  []string `yaml:"recorders"`   // COMPLIANCE_RECORDERS, comma separated service names
+	StreamKey  string   `yaml:"stream_key"`  // COMPLIANCE_STREAM_KEY, at least 32 bytes
+	// StreamRetention is how long message events can be replayed from the stream
+	StreamRetention time.Duration `yaml:"stream_retention"` // COMPLIANCE_STREAM_RETENTION, default 168h
+}
+
+// MailConfig holds the SMTP server notification emails are sent through. Without a
+// URL, emails are only logged.
+type MailConfig struct {
+	SMTPURL string `yaml:"smtp_url"` // MAIL_SMTP_URL, smtp://[user:password@]host[:port]
+	From    string `yaml:"from"`     // MAIL_FROM, default Talkify <no-reply@localhost>
+}
+
+// SMSConfig holds the HTTP gateway notification text messages are sent through, which
+// gets a JSON POST of {"to", "body"}. Without a URL, text messages are only logged.
+type SMSConfig struct {
+	GatewayURL string `yaml:"gateway_url"` // SMS_GATEWAY_URL
+	Token      string `yaml:"token"`       // SMS_GATEWAY_TOKEN, sent as a bearer token
+}
+
+// RedisConfig holds the connection to the Redis server shared by all API nodes.
+// Without a URL, presence is only tracked in the database.
+type RedisConfig struct {
+	URL string `yaml:"url"` // REDIS_URL, redis://[:password@]host[:port][/db]
+}
+
+// MetricsConfig holds settings for the operational metrics served on /metrics. Only the
+// TopK busiest conversations and slowest endpoints of each window are labelled.
+type MetricsConfig struct {
+	TopK   int           `yaml:"top_k"`  // METRICS_TOP_K, default 10
+	Window time.Duration `yaml:"window"` // METRICS_WINDOW, default 1m
+}
+
+// EventsConfig bounds the in-memory log of WebSocket events that reconnecting clients
+// replay from, and how events are batched for clients that connect with batch=true
+type EventsConfig struct {
+	Retention          time.Duration `yaml:"retention"`            // EVENTS_RETENTION, default 5m
+	MaxPerConversation int           `yaml:"max_per_conversation"` // EVENTS_MAX_PER_CONVERSATION, default 500
+	MaxBytes           int64         `yaml:"max_bytes"`            // EVENTS_MAX_BYTES, default 64 MiB
+
+	// Events arriving within BatchInterval of each other are written in one frame of up
+	// to BatchMaxEvents; an interval of 0 turns batching off
+	BatchInterval  time.Duration `yaml:"batch_interval"`   // EVENTS_BATCH_INTERVAL, default 50ms
+	BatchMaxEvents int           `yaml:"batch_max_events"` // EVENTS_BATCH_MAX_EVENTS, default 64
+
+	// SingleSession keeps one WebSocket connection per user: connecting again closes
+	// the user's other connections. Otherwise a user's connections are only grouped by
+	// the device they name.
+	SingleSession bool `yaml:"single_session"` // EVENTS_SINGLE_SESSION, default false
+
+	// Connections get resume tokens, valid for ResumeWindow and renewed while connected,
+	// that let them reconnect without being authenticated again. The tokens are signed
+	// with ResumeSigningKey; resuming is off without it or with a window of 0.
+	ResumeWindow     time.Duration `yaml:"resume_window"`      // EVENTS_RESUME_WINDOW, default 2m
+	ResumeSigningKey string        `yaml:"resume_signing_key"` // EVENTS_RESUME_SIGNING_KEY, at least 32 bytes
+}
+
+// ResumeEnabled reports whether connections get resume tokens
+func (c *EventsConfig) ResumeEnabled() bool {
+	return c.ResumeWindow > 0 && c.ResumeSigningKey != ""
+}
+
+// DeliveryConfig sets how long clients that acknowledge WebSocket events have to confirm
+// a new message before it is sent again through the notification center, and by email
+// with EmailMissed. Message notifications wait NotifyGrace for the message to be seen
+// on a connected device first.
+type DeliveryConfig struct {
+	AckTimeout  time.Duration `yaml:"ack_timeout"`  // DELIVERY_ACK_TIMEOUT, default 30s
+	EmailMissed bool          `yaml:"email_missed"` // DELIVERY_EMAIL_MISSED, default false
+	NotifyGrace time.Duration `yaml:"notify_grace"` // DELIVERY_NOTIFY_GRACE, default 10s
+}
+
+// MediaConfig holds settings for serving message media through the API. Media is only
+// fetched from AllowedHosts; signed URLs need a SigningKey.
+type MediaConfig struct {
+	AllowedHosts []string      `yaml:"allowed_hosts"` // MEDIA_ALLOWED_HOSTS, comma separated
+	SigningKey   string        `yaml:"signing_key"`   // MEDIA_SIGNING_KEY, at least 32 bytes
+	URLTTL       time.Duration `yaml:"url_ttl"`       // MEDIA_URL_TTL, default 5m
+
+	// Zip archives of a conversation's files and transcript exports are kept in ArchiveDir
+	// for ArchiveTTL
+	ArchiveDir      string        `yaml:"archive_dir"`       // MEDIA_ARCHIVE_DIR, default data/archives
+	ArchiveTTL      time.Duration `yaml:"archive_ttl"`       // MEDIA_ARCHIVE_TTL, default 24h
+	ArchiveMaxBytes int64         `yaml:"archive_max_bytes"` // MEDIA_ARCHIVE_MAX_BYTES, default 1 GiB
+
+	// ReportInterval is how often storage usage is reported on for admins
+	ReportInterval time.Duration `yaml:"report_interval"` // MEDIA_REPORT_INTERVAL, default 24h
+}
+
+// AutomationConfig limits conversation automations. Webhooks are only delivered to
+// WebhookHosts, so automations can't be used to reach inside the network.
+type AutomationConfig struct {
+	WebhookHosts       []string      `yaml:"webhook_hosts"`        // AUTOMATION_WEBHOOK_HOSTS, comma separated
+	WebhookTimeout     time.Duration `yaml:"webhook_timeout"`      // AUTOMATION_WEBHOOK_TIMEOUT, default 10s
+	MaxPerConversation int           `yaml:"max_per_conversation"` // AUTOMATION_MAX_PER_CONVERSATION, default 10
+	// MaxRunsPerMinute stops an automation that keeps setting itself off, such as a
+	// webhook whose receiver posts back to the conversation
+	MaxRunsPerMinute int `yaml:"max_runs_per_minute"` // AUTOMATION_MAX_RUNS_PER_MINUTE, default 30
+}
+
+// ContentFilterConfig sets how messages are filtered for profanity where their
+// conversation doesn't say otherwise. Wordlists are read from WordlistDir, one file per
+// locale; admins can add their own terms.
+type ContentFilterConfig struct {
+	// Mode is off, mask or block
+	Mode        string `yaml:"mode"`         // CONTENT_FILTER_MODE, default off
+	Locale      string `yaml:"locale"`       // CONTENT_FILTER_LOCALE, default en
+	WordlistDir string `yaml:"wordlist_dir"` // CONTENT_FILTER_WORDLIST_DIR
+}
+
+// FederationConfig lets users of other Talkify deployments be looked up by address,
+// such as alice@chat.example.com. Domain is the one this server's users are addressed
+// at, and SigningKey signs what it answers about them; federation is off without both.
+// Only Peers are asked about their users, so lookups can't be used to reach inside the
+// network.
+type FederationConfig struct {
+	Domain     string   `yaml:"domain"`      // FEDERATION_DOMAIN
+	SigningKey string   `yaml:"signing_key"` // FEDERATION_SIGNING_KEY, at least 32 bytes
+	Peers      []string `yaml:"peers"`       // FEDERATION_PEERS, comma separated domains
+	// Timeout bounds each request to a peer
+	Timeout time.Duration `yaml:"timeout"` // FEDERATION_TIMEOUT, default 10s
+	// KeyTTL is how long the public keys of peers are trusted before being fetched again
+	KeyTTL time.Duration `yaml:"key_ttl"` // FEDERATION_KEY_TTL, default 24h
+	// DirectMessages lets users exchange direct messages with users of peers.
+	// Experimental.
+	DirectMessages bool `yaml:"direct_messages"` // FEDERATION_DIRECT_MESSAGES, default false
+}
+
+// Enabled reports whether the server takes part in federation
+func (c *FederationConfig) Enabled() bool {
+	return c.Domain != "" && c.SigningKey != ""
+}
+
+// SupportConfig holds settings for support queues. Direct messages to the support
+// account are queued for agents, who are the participants of TeamConversation; support
+// is off without it.
+type SupportConfig struct {
+	TeamConversation string `yaml:"team_conversation"` // SUPPORT_TEAM_CONVERSATION, the ID of a group conversation
+	Username         string `yaml:"username"`          // SUPPORT_USERNAME, default Support
+	// FirstResponseSLA and ResolutionSLA are how long after a ticket is queued an agent
+	// should first answer and resolve it; zero disables each timer
+	FirstResponseSLA time.Duration `yaml:"first_response_sla"` // SUPPORT_FIRST_RESPONSE_SLA, default 1h
+	ResolutionSLA    time.Duration `yaml:"resolution_sla"`     // SUPPORT_RESOLUTION_SLA, default 24h
+	Interval         time.Duration `yaml:"interval"`           // SUPPORT_SLA_INTERVAL, how often breaches are looked for, default 1m
+}
+
+// Enabled reports whether support queues are on
+func (c *SupportConfig) Enabled() bool {
+	return c.TeamConversation != ""
+}
+
+// GraphQLConfig holds settings for the GraphQL endpoint, which is off by default
+type GraphQLConfig struct {
+	Enabled bool `yaml:"enabled"` // GRAPHQL_ENABLED, default false
+	// MaxDepth and MaxParallelism bound the cost of a query: how deeply fields may nest
+	// and how many resolvers run at once
+	MaxDepth       int `yaml:"max_depth"`       // GRAPHQL_MAX_DEPTH, default 8
+	MaxParallelism int `yaml:"max_parallelism"` // GRAPHQL_MAX_PARALLELISM, default 10
+}
+
+// ServiceConfig holds settings for the internal service-to-service listener
+type ServiceConfig struct {
+	Enabled         bool     `yaml:"enabled"`          // SERVICE_AUTH_ENABLED, default false
+	Addr            string   `yaml:"addr"`             // SERVICE_ADDR, default :9090
+	CAFile          string   `yaml:"ca_file"`          // SERVICE_TLS_CA_FILE
+	CertFile        string   `yaml:"cert_file"`        // SERVICE_TLS_CERT_FILE
+	KeyFile         string   `yaml:"key_file"`         // SERVICE_TLS_KEY_FILE
+	TokenSecret     string   `yaml:"token_secret"`     // SERVICE_TOKEN_SECRET
+	AllowedServices []string `yaml:"allowed_services"` // SERVICE_ALLOWED_NAMES, comma separated
+}
+
+// ReportingConfig holds error reporting settings. Reporting is disabled without a DSN.
+type ReportingConfig struct {
+	DSN         string `yaml:"dsn"`         // ERROR_REPORTING_DSN or SENTRY_DSN
+	Environment string `yaml:"environment"` // defaults to the profile
+	Release     string `yaml:"release"`     // RELEASE_VERSION, default dev
+}
+
+// RateLimitConfig holds the per-client request rate limit
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"` // RATE_LIMIT_RPM, default 600; 0 disables limiting
+	Burst             int `yaml:"burst"`               // RATE_LIMIT_BURST, default 100
+}
+
+// NetworkConfig restricts which networks may reach the API. Empty lists allow everyone.
+type NetworkConfig struct {
+	AllowedCIDRs     []string `yaml:"allowed_cidrs"`     // NETWORK_ALLOWED_CIDRS, comma separated IPs or CIDRs
+	BlockedCountries []string `yaml:"blocked_countries"` // NETWORK_BLOCKED_COUNTRIES, comma separated ISO 3166 codes
+}
+
+// Restricted reports whether any network restriction is configured
+func (c *NetworkConfig) Restricted() bool {
+	return len(c.AllowedCIDRs) > 0 || len(c.BlockedCountries) > 0
+}
+
+// StatusConfig is what the public status endpoint reports about ongoing incidents
+type StatusConfig struct {
+	Incident bool   `yaml:"incident"` // STATUS_INCIDENT, default false
+	Message  string `yaml:"message"`  // STATUS_MESSAGE, shown in client status banners
+}
+
+// ShadowReadConfig samples reads of the denormalized conversation summaries, unread
+// counters and read watermarks to also compute them from messages, in the background,
+// and report where the two differ before reads rely on them alone
+type ShadowReadConfig struct {
+	SampleRate float64 `yaml:"sample_rate"` // SHADOW_READ_SAMPLE_RATE, default 0; share of reads compared, 0 disables
+}
+
+// RuntimeConfig holds the settings that can be reloaded without a restart
+type RuntimeConfig struct {
+	LogLevel    string          `yaml:"log_level"`    // LOG_LEVEL, default debug in development and info otherwise
+	CORSOrigins []string        `yaml:"cors_origins"` // CORS_ALLOWED_ORIGINS, comma separated; "*" allows any origin
+	RateLimit   RateLimitConfig `yaml:"rate_limit"`
+	Network     NetworkConfig   `yaml:"network"`
+	Features    map[string]bool `yaml:"features"` // FEATURE_FLAGS, e.g. "search,reactions=false"
+	Status      StatusConfig    `yaml:"status"`
+	// MinClientVersions are the oldest app versions still served, by X-Client-Platform
+	MinClientVersions map[string]string `yaml:"min_client_versions"` // MIN_CLIENT_VERSIONS, e.g. "ios=2.3.0,android=2.1.0"
+	// MinNotificationPreview is the least private notification preview users may pick:
+	// full shows the message, sender only who sent it, generic neither
+	MinNotificationPreview string `yaml:"min_notification_preview"` // NOTIFICATION_MIN_PREVIEW, default full
+	// ShadowReads compares a sample of conversation reads with values computed from messages
+	ShadowReads ShadowReadConfig `yaml:"shadow_reads"`
 }
 
 // Config holds all configuration settings
 type Config struct {
-	Database   DatabaseConfig
-	Encryption EncryptionConfig
-	JWT        JWTConfig
+	Profile       string              `yaml:"profile"` // APP_ENV: development, staging or production
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Encryption    EncryptionConfig    `yaml:"encryption"`
+	JWT           JWTConfig           `yaml:"jwt"`
+	Quota         QuotaConfig         `yaml:"quota"`
+	Presence      PresenceConfig      `yaml:"presence"`
+	Group         GroupConfig         `yaml:"group"`
+	Pagination    PaginationConfig    `yaml:"pagination"`
+	Retention     RetentionConfig     `yaml:"retention"`
+	Inactive      InactiveConfig      `yaml:"inactive"`
+	Login         LoginConfig         `yaml:"login"`
+	Session       SessionConfig       `yaml:"session"`
+	Password      PasswordConfig      `yaml:"password"`
+	Recovery      RecoveryConfig      `yaml:"recovery"`
+	Invite        InviteConfig        `yaml:"invite"`
+	Compliance    ComplianceConfig    `yaml:"compliance"`
+	Mail          MailConfig          `yaml:"mail"`
+	SMS           SMSConfig           `yaml:"sms"`
+	Redis         RedisConfig         `yaml:"redis"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Events        EventsConfig        `yaml:"events"`
+	Delivery      DeliveryConfig      `yaml:"delivery"`
+	Media         MediaConfig         `yaml:"media"`
+	Automation    AutomationConfig    `yaml:"automation"`
+	ContentFilter ContentFilterConfig `yaml:"content_filter"`
+	Federation    FederationConfig    `yaml:"federation"`
+	Support       SupportConfig       `yaml:"support"`
+	GraphQL       GraphQLConfig       `yaml:"graphql"`
+	Service       ServiceConfig       `yaml:"service"`
+	Reporting     ReportingConfig     `yaml:"reporting"`
+	Runtime       RuntimeConfig       `yaml:"runtime"`
+
+	// envErrors collects environment variables that could not be parsed
+	envErrors []string
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads and validates configuration from the file named by CONFIG_FILE,
+// if any, and environment variables
 func LoadConfig() (*Config, error) {
 	// Load .env file if it exists
 	godotenv.Load()
 
+	return LoadConfigFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadConfigFile loads and validates configuration from the YAML file at path and
+// environment variables. An empty path uses environment variables only.
+func LoadConfigFile(path string) (*Config, error) {
+	godotenv.Load()
+
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load builds the configuration without validating it. Values are layered as
+// profile defaults, then the YAML file at path (optional), then environment variables.
+func Load(path string) (*Config, error) {
 	// Create data directory if it doesn't exist
 	dataDir := "data"
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	return &Config{
+	var file []byte
+	var fileProfile struct {
+		Profile string `yaml:"profile"`
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &fileProfile); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		file = data
+	}
+
+	profile := normalizeProfile(getEnv("APP_ENV", fileProfile.Profile))
+	cfg := defaults(profile, dataDir)
+
+	if file != nil {
+		decoder := yaml.NewDecoder(bytes.NewReader(file))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		cfg.Profile = profile
+	}
+
+	cfg.applyEnv()
+	return cfg, nil
+}
+
+// defaults returns the built-in configuration for a profile
+func defaults(profile, dataDir string) *Config {
+	cfg := &Config{
+		Profile: profile,
+		Server: ServerConfig{
+			Port:             "8080",
+			HTTPPort:         "80",
+			AutocertCacheDir: filepath.Join(dataDir, "autocert"),
+			RedirectHTTP:     true,
+			HTTP2Enabled:     true,
+
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			RequestTimeout:    20 * time.Second,
+			MaxHeaderBytes:    1 << 20, // 1 MiB
+			ShutdownTimeout:   30 * time.Second,
+			RemoteIPHeaders:   []string{"X-Forwarded-For", "X-Real-IP"},
+		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5433"),
-			User:     getEnv("DB_USER", "talkify_user"),
-			Password: getEnv("DB_PASSWORD", "talkify_password"),
-			DBName:   getEnv("DB_NAME", "talkify_db"),
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Host:     "localhost",
+			Port:     "5433",
+			User:     "talkify_user",
+			Password: "talkify_password",
+			DBName:   "talkify_db",
+			SSLMode:  "disable",
+
+			StartupMaxWait: 60 * time.Second,
+			MigrationsDir:  "migrations",
+
+			LogQueries:           true,
+			ExplainThreshold:     100 * time.Millisecond,
+			ExplainSamplePercent: 10,
 		},
 		Encryption: EncryptionConfig{
 			KeyFile: filepath.Join(dataDir, "encryption.key"),
+			Mode:    "aes-gcm",
 		},
 		JWT: JWTConfig{
-			SecretKey: getEnv("JWT_SECRET_KEY", "your-256-bit-secret"),
+			SecretKey: insecureJWTSecret,
+			SecretKID: "default",
+			KeysDir:   filepath.Join(dataDir, "jwt"),
+			Issuer:    "talkify",
+			Audience:  "talkify-api",
+		},
+		Quota: QuotaConfig{
+			MaxStorageBytes: 1 << 30,  // 1 GiB
+			MaxMediaSize:    25 << 20, // 25 MiB
+
+			ConversationsPerHour:         20,
+			ConversationsPerDay:          100,
+			VerifiedConversationsPerHour: 60,
+			VerifiedConversationsPerDay:  500,
+		},
+		Group: GroupConfig{
+			MaxParticipants:  1000,
+			LargeThreshold:   256,
+			NameParticipants: 2,
+			NameLocale:       "en",
+			NameTemplates:    map[string]groupname.Template{},
+		},
+		Pagination: PaginationConfig{
+			MaxLimit:          1000,
+			ConversationLimit: 100,
+		},
+		Presence: PresenceConfig{
+			OnlineTTL:     2 * time.Minute,
+			SweepInterval: 30 * time.Second,
+		},
+		Retention: RetentionConfig{
+			ConversationGrace: 30 * 24 * time.Hour,
+			EmptyConversation: 30 * 24 * time.Hour,
+			StagedAttachment:  7 * 24 * time.Hour,
+			Interval:          time.Hour,
+		},
+		Inactive: InactiveConfig{
+			Interval: 24 * time.Hour,
+		},
+		Login: LoginConfig{
+			AlertNewDevices: true,
+			CodeTTL:         10 * time.Minute,
+		},
+		Password: PasswordConfig{
+			MinLength:       8,
+			BreachURL:       "https://api.pwnedpasswords.com/range/",
+			BreachTimeout:   3 * time.Second,
+			HashMemory:      19 * 1024,
+			HashIterations:  2,
+			HashParallelism: 1,
+		},
+		Recovery: RecoveryConfig{
+			Delay:      48 * time.Hour,
+			RequestTTL: 7 * 24 * time.Hour,
+		},
+		Invite: InviteConfig{
+			TTL: 7 * 24 * time.Hour,
+		},
+		Mail: MailConfig{
+			From: "Talkify <no-reply@localhost>",
+		},
+		Metrics: MetricsConfig{
+			TopK:   10,
+			Window: time.Minute,
+		},
+		Events: EventsConfig{
+			Retention:          5 * time.Minute,
+			MaxPerConversation: 500,
+			MaxBytes:           64 << 20, // 64 MiB
+			BatchInterval:      50 * time.Millisecond,
+			BatchMaxEvents:     64,
+			ResumeWindow:       2 * time.Minute,
+		},
+		Delivery: DeliveryConfig{
+			AckTimeout:  30 * time.Second,
+			NotifyGrace: 10 * time.Second,
+		},
+		Media: MediaConfig{
+			URLTTL:          5 * time.Minute,
+			ArchiveDir:      filepath.Join(dataDir, "archives"),
+			ArchiveTTL:      24 * time.Hour,
+			ArchiveMaxBytes: 1 << 30, // 1 GiB
+			ReportInterval:  24 * time.Hour,
+		},
+		Automation: AutomationConfig{
+			WebhookTimeout:     10 * time.Second,
+			MaxPerConversation: 10,
+			MaxRunsPerMinute:   30,
+		},
+		ContentFilter: ContentFilterConfig{
+			Mode:   "off",
+			Locale: "en",
+		},
+		Compliance: ComplianceConfig{
+			StreamRetention: 7 * 24 * time.Hour,
+		},
+		Federation: FederationConfig{
+			Timeout: 10 * time.Second,
+			KeyTTL:  24 * time.Hour,
+		},
+		Support: SupportConfig{
+			Username:         "Support",
+			FirstResponseSLA: time.Hour,
+			ResolutionSLA:    24 * time.Hour,
+			Interval:         time.Minute,
 		},
-	}, nil
+		GraphQL: GraphQLConfig{
+			MaxDepth:       8,
+			MaxParallelism: 10,
+		},
+		Service: ServiceConfig{
+			Addr: ":9090",
+		},
+		Reporting: ReportingConfig{
+			Environment: profile,
+			Release:     "dev",
+		},
+		Runtime: RuntimeConfig{
+			LogLevel:    "debug",
+			CORSOrigins: []string{"http://localhost:5173"}, // Vite's default port
+			RateLimit: RateLimitConfig{
+				RequestsPerMinute: 600,
+				Burst:             100,
+			},
+			Features:               map[string]bool{},
+			MinClientVersions:      map[string]string{},
+			MinNotificationPreview: "full",
+		},
+	}
+
+	// Outside development, secrets have no usable defaults and connections are encrypted
+	if profile != ProfileDevelopment {
+		cfg.JWT.SecretKey = ""
+		cfg.Database.Password = ""
+		cfg.Database.SSLMode = "require"
+		cfg.Database.LogQueries = false
+		cfg.Runtime.LogLevel = "info"
+		cfg.Runtime.CORSOrigins = nil
+	}
+
+	return cfg
+}
+
+// applyEnv overrides the configuration with environment variables
+func (c *Config) applyEnv() {
+	e := &envReader{}
+
+	c.Server.Port = e.getEnv("PORT", c.Server.Port)
+	c.Server.HTTPPort = e.getEnv("HTTP_PORT", c.Server.HTTPPort)
+	c.Server.TLSCertFile = e.getEnv("TLS_CERT_FILE", c.Server.TLSCertFile)
+	c.Server.TLSKeyFile = e.getEnv("TLS_KEY_FILE", c.Server.TLSKeyFile)
+	c.Server.AutocertEnabled = e.getEnvBool("TLS_AUTOCERT", c.Server.AutocertEnabled)
+	c.Server.AutocertHosts = e.getEnvList("TLS_AUTOCERT_HOSTS", c.Server.AutocertHosts)
+	c.Server.AutocertCacheDir = e.getEnv("TLS_AUTOCERT_CACHE_DIR", c.Server.AutocertCacheDir)
+	c.Server.RedirectHTTP = e.getEnvBool("TLS_REDIRECT_HTTP", c.Server.RedirectHTTP)
+	c.Server.HTTP2Enabled = e.getEnvBool("HTTP2_ENABLED", c.Server.HTTP2Enabled)
+	c.Server.ReadTimeout = e.getEnvDuration("SERVER_READ_TIMEOUT", c.Server.ReadTimeout)
+	c.Server.ReadHeaderTimeout = e.getEnvDuration("SERVER_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout)
+	c.Server.WriteTimeout = e.getEnvDuration("SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout)
+	c.Server.IdleTimeout = e.getEnvDuration("SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout)
+	c.Server.RequestTimeout = e.getEnvDuration("SERVER_REQUEST_TIMEOUT", c.Server.RequestTimeout)
+	c.Server.MaxHeaderBytes = int(e.getEnvInt64("SERVER_MAX_HEADER_BYTES", int64(c.Server.MaxHeaderBytes)))
+	c.Server.ShutdownTimeout = e.getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	c.Server.TrustedProxies = e.getEnvList("SERVER_TRUSTED_PROXIES", c.Server.TrustedProxies)
+	c.Server.RemoteIPHeaders = e.getEnvList("SERVER_REMOTE_IP_HEADERS", c.Server.RemoteIPHeaders)
+	c.Server.CountryHeader = e.getEnv("SERVER_COUNTRY_HEADER", c.Server.CountryHeader)
+
+	c.Database.Host = e.getEnv("DB_HOST", c.Database.Host)
+	c.Database.Port = e.getEnv("DB_PORT", c.Database.Port)
+	c.Database.User = e.getEnv("DB_USER", c.Database.User)
+	c.Database.Password = e.getEnv("DB_PASSWORD", c.Database.Password)
+	c.Database.DBName = e.getEnv("DB_NAME", c.Database.DBName)
+	c.Database.SSLMode = e.getEnvAlias("DB_SSL_MODE", []string{"DB_SSLMODE"}, c.Database.SSLMode)
+	c.Database.StartupMaxWait = e.getEnvDuration("DB_STARTUP_MAX_WAIT", c.Database.StartupMaxWait)
+	c.Database.MigrationsDir = e.getEnv("DB_MIGRATIONS_DIR", c.Database.MigrationsDir)
+	c.Database.LogQueries = e.getEnvBool("DB_LOG_QUERIES", c.Database.LogQueries)
+	c.Database.ExplainThreshold = e.getEnvDuration("DB_EXPLAIN_THRESHOLD", c.Database.ExplainThreshold)
+	c.Database.ExplainSamplePercent = int(e.getEnvInt64("DB_EXPLAIN_SAMPLE_PERCENT", int64(c.Database.ExplainSamplePercent)))
+
+	c.Encryption.KeyFile = e.getEnv("ENCRYPTION_KEY_FILE", c.Encryption.KeyFile)
+	c.Encryption.Mode = e.getEnv("ENCRYPTION_MODE", c.Encryption.Mode)
+
+	c.JWT.SecretKey = e.getEnv("JWT_SECRET_KEY", c.JWT.SecretKey)
+	c.JWT.SecretKID = e.getEnv("JWT_SECRET_KID", c.JWT.SecretKID)
+	c.JWT.KeysDir = e.getEnv("JWT_KEYS_DIR", c.JWT.KeysDir)
+	c.JWT.ActiveKID = e.getEnv("JWT_ACTIVE_KID", c.JWT.ActiveKID)
+	c.JWT.Issuer = e.getEnv("JWT_ISSUER", c.JWT.Issuer)
+	c.JWT.Audience = e.getEnv("JWT_AUDIENCE", c.JWT.Audience)
+
+	c.Quota.MaxStorageBytes = e.getEnvInt64("QUOTA_MAX_STORAGE_BYTES", c.Quota.MaxStorageBytes)
+	c.Quota.MaxMessages = e.getEnvInt64("QUOTA_MAX_MESSAGES", c.Quota.MaxMessages)
+	c.Quota.MaxMediaSize = e.getEnvInt64("QUOTA_MAX_MEDIA_SIZE", c.Quota.MaxMediaSize)
+	c.Quota.ConversationsPerHour = int(e.getEnvInt64("QUOTA_CONVERSATIONS_PER_HOUR", int64(c.Quota.ConversationsPerHour)))
+	c.Quota.ConversationsPerDay = int(e.getEnvInt64("QUOTA_CONVERSATIONS_PER_DAY", int64(c.Quota.ConversationsPerDay)))
+	c.Quota.VerifiedConversationsPerHour = int(e.getEnvInt64("QUOTA_VERIFIED_CONVERSATIONS_PER_HOUR", int64(c.Quota.VerifiedConversationsPerHour)))
+	c.Quota.VerifiedConversationsPerDay = int(e.getEnvInt64("QUOTA_VERIFIED_CONVERSATIONS_PER_DAY", int64(c.Quota.VerifiedConversationsPerDay)))
+	c.Group.MaxParticipants = int(e.getEnvInt64("GROUP_MAX_PARTICIPANTS", int64(c.Group.MaxParticipants)))
+	c.Group.LargeThreshold = int(e.getEnvInt64("GROUP_LARGE_THRESHOLD", int64(c.Group.LargeThreshold)))
+	c.Group.NameParticipants = int(e.getEnvInt64("GROUP_NAME_PARTICIPANTS", int64(c.Group.NameParticipants)))
+	c.Group.NameLocale = e.getEnv("GROUP_NAME_LOCALE", c.Group.NameLocale)
+	c.Pagination.MaxLimit = int(e.getEnvInt64("PAGINATION_MAX_LIMIT", int64(c.Pagination.MaxLimit)))
+	c.Pagination.ConversationLimit = int(e.getEnvInt64("PAGINATION_CONVERSATION_LIMIT", int64(c.Pagination.ConversationLimit)))
+
+	c.Presence.OnlineTTL = e.getEnvDuration("PRESENCE_ONLINE_TTL", c.Presence.OnlineTTL)
+	c.Presence.SweepInterval = e.getEnvDuration("PRESENCE_SWEEP_INTERVAL", c.Presence.SweepInterval)
+
+	c.Retention.ConversationGrace = e.getEnvDuration("RETENTION_CONVERSATION_GRACE", c.Retention.ConversationGrace)
+	c.Retention.EmptyConversation = e.getEnvDuration("RETENTION_EMPTY_CONVERSATION", c.Retention.EmptyConversation)
+	c.Retention.StagedAttachment = e.getEnvDuration("RETENTION_STAGED_ATTACHMENT", c.Retention.StagedAttachment)
+	c.Retention.Interval = e.getEnvDuration("RETENTION_INTERVAL", c.Retention.Interval)
+
+	c.Inactive.WarnAfter = e.getEnvDuration("INACTIVE_WARN_AFTER", c.Inactive.WarnAfter)
+	c.Inactive.DeactivateAfter = e.getEnvDuration("INACTIVE_DEACTIVATE_AFTER", c.Inactive.DeactivateAfter)
+	c.Inactive.AnonymizeAfter = e.getEnvDuration("INACTIVE_ANONYMIZE_AFTER", c.Inactive.AnonymizeAfter)
+	c.Inactive.Interval = e.getEnvDuration("INACTIVE_INTERVAL", c.Inactive.Interval)
+	c.Login.AlertNewDevices = e.getEnvBool("LOGIN_ALERT_NEW_DEVICES", c.Login.AlertNewDevices)
+	c.Login.SecurityMessages = e.getEnvBool("LOGIN_SECURITY_MESSAGES", c.Login.SecurityMessages)
+	c.Login.VerifyNewDevices = e.getEnvBool("LOGIN_VERIFY_NEW_DEVICES", c.Login.VerifyNewDevices)
+	c.Login.CodeTTL = e.getEnvDuration("LOGIN_CODE_TTL", c.Login.CodeTTL)
+	c.Session.IdleTimeout = e.getEnvDuration("SESSION_IDLE_TIMEOUT", c.Session.IdleTimeout)
+	c.Session.MaxLifetime = e.getEnvDuration("SESSION_MAX_LIFETIME", c.Session.MaxLifetime)
+	c.Session.MaxPerUser = int(e.getEnvInt64("SESSION_MAX_PER_USER", int64(c.Session.MaxPerUser)))
+	c.Password.MinLength = int(e.getEnvInt64("PASSWORD_MIN_LENGTH", int64(c.Password.MinLength)))
+	c.Password.RequireUpper = e.getEnvBool("PASSWORD_REQUIRE_UPPER", c.Password.RequireUpper)
+	c.Password.RequireLower = e.getEnvBool("PASSWORD_REQUIRE_LOWER", c.Password.RequireLower)
+	c.Password.RequireDigit = e.getEnvBool("PASSWORD_REQUIRE_DIGIT", c.Password.RequireDigit)
+	c.Password.RequireSymbol = e.getEnvBool("PASSWORD_REQUIRE_SYMBOL", c.Password.RequireSymbol)
+	c.Password.Banned = e.getEnvList("PASSWORD_BANNED", c.Password.Banned)
+	c.Password.BreachCheck = e.getEnvBool("PASSWORD_BREACH_CHECK", c.Password.BreachCheck)
+	c.Password.BreachURL = e.getEnv("PASSWORD_BREACH_URL", c.Password.BreachURL)
+	c.Password.BreachTimeout = e.getEnvDuration("PASSWORD_BREACH_TIMEOUT", c.Password.BreachTimeout)
+	c.Password.HashMemory = int(e.getEnvInt64("PASSWORD_HASH_MEMORY", int64(c.Password.HashMemory)))
+	c.Password.HashIterations = int(e.getEnvInt64("PASSWORD_HASH_ITERATIONS", int64(c.Password.HashIterations)))
+	c.Password.HashParallelism = int(e.getEnvInt64("PASSWORD_HASH_PARALLELISM", int64(c.Password.HashParallelism)))
+	c.Recovery.Delay = e.getEnvDuration("RECOVERY_DELAY", c.Recovery.Delay)
+	c.Recovery.RequestTTL = e.getEnvDuration("RECOVERY_REQUEST_TTL", c.Recovery.RequestTTL)
+
+	c.Invite.SigningKey = e.getEnv("INVITE_SIGNING_KEY", c.Invite.SigningKey)
+	c.Invite.TTL = e.getEnvDuration("INVITE_TTL", c.Invite.TTL)
+
+	c.Compliance.SigningKey = e.getEnv("COMPLIANCE_SIGNING_KEY", c.Compliance.SigningKey)
+	c.Compliance.Recorders = e.getEnvList("COMPLIANCE_RECORDERS", c.Compliance.Recorders)
+	c.Compliance.StreamKey = e.getEnv("COMPLIANCE_STREAM_KEY", c.Compliance.StreamKey)
+	c.Compliance.StreamRetention = e.getEnvDuration("COMPLIANCE_STREAM_RETENTION", c.Compliance.StreamRetention)
+
+	c.Mail.SMTPURL = e.getEnv("MAIL_SMTP_URL", c.Mail.SMTPURL)
+	c.Mail.From = e.getEnv("MAIL_FROM", c.Mail.From)
+
+	c.SMS.GatewayURL = e.getEnv("SMS_GATEWAY_URL", c.SMS.GatewayURL)
+	c.SMS.Token = e.getEnv("SMS_GATEWAY_TOKEN", c.SMS.Token)
+
+	c.Redis.URL = e.getEnv("REDIS_URL", c.Redis.URL)
+
+	c.Metrics.TopK = int(e.getEnvInt64("METRICS_TOP_K", int64(c.Metrics.TopK)))
+	c.Metrics.Window = e.getEnvDuration("METRICS_WINDOW", c.Metrics.Window)
+
+	c.Events.Retention = e.getEnvDuration("EVENTS_RETENTION", c.Events.Retention)
+	c.Events.MaxPerConversation = int(e.getEnvInt64("EVENTS_MAX_PER_CONVERSATION", int64(c.Events.MaxPerConversation)))
+	c.Events.MaxBytes = e.getEnvInt64("EVENTS_MAX_BYTES", c.Events.MaxBytes)
+	c.Events.BatchInterval = e.getEnvDuration("EVENTS_BATCH_INTERVAL", c.Events.BatchInterval)
+	c.Events.BatchMaxEvents = int(e.getEnvInt64("EVENTS_BATCH_MAX_EVENTS", int64(c.Events.BatchMaxEvents)))
+	c.Events.SingleSession = e.getEnvBool("EVENTS_SINGLE_SESSION", c.Events.SingleSession)
+	c.Events.ResumeWindow = e.getEnvDuration("EVENTS_RESUME_WINDOW", c.Events.ResumeWindow)
+	c.Events.ResumeSigningKey = e.getEnv("EVENTS_RESUME_SIGNING_KEY", c.Events.ResumeSigningKey)
+
+	c.Delivery.AckTimeout = e.getEnvDuration("DELIVERY_ACK_TIMEOUT", c.Delivery.AckTimeout)
+	c.Delivery.EmailMissed = e.getEnvBool("DELIVERY_EMAIL_MISSED", c.Delivery.EmailMissed)
+	c.Delivery.NotifyGrace = e.getEnvDuration("DELIVERY_NOTIFY_GRACE", c.Delivery.NotifyGrace)
+
+	c.Media.AllowedHosts = e.getEnvList("MEDIA_ALLOWED_HOSTS", c.Media.AllowedHosts)
+	c.Media.SigningKey = e.getEnv("MEDIA_SIGNING_KEY", c.Media.SigningKey)
+	c.Media.URLTTL = e.getEnvDuration("MEDIA_URL_TTL", c.Media.URLTTL)
+	c.Media.ArchiveDir = e.getEnv("MEDIA_ARCHIVE_DIR", c.Media.ArchiveDir)
+	c.Media.ArchiveTTL = e.getEnvDuration("MEDIA_ARCHIVE_TTL", c.Media.ArchiveTTL)
+	c.Media.ArchiveMaxBytes = e.getEnvInt64("MEDIA_ARCHIVE_MAX_BYTES", c.Media.ArchiveMaxBytes)
+	c.Media.ReportInterval = e.getEnvDuration("MEDIA_REPORT_INTERVAL", c.Media.ReportInterval)
+
+	c.Automation.WebhookHosts = e.getEnvList("AUTOMATION_WEBHOOK_HOSTS", c.Automation.WebhookHosts)
+	c.Automation.WebhookTimeout = e.getEnvDuration("AUTOMATION_WEBHOOK_TIMEOUT", c.Automation.WebhookTimeout)
+	c.Automation.MaxPerConversation = int(e.getEnvInt64("AUTOMATION_MAX_PER_CONVERSATION", int64(c.Automation.MaxPerConversation)))
+	c.Automation.MaxRunsPerMinute = int(e.getEnvInt64("AUTOMATION_MAX_RUNS_PER_MINUTE", int64(c.Automation.MaxRunsPerMinute)))
+
+	c.ContentFilter.Mode = e.getEnv("CONTENT_FILTER_MODE", c.ContentFilter.Mode)
+	c.ContentFilter.Locale = e.getEnv("CONTENT_FILTER_LOCALE", c.ContentFilter.Locale)
+	c.ContentFilter.WordlistDir = e.getEnv("CONTENT_FILTER_WORDLIST_DIR", c.ContentFilter.WordlistDir)
+
+	c.Federation.Domain = e.getEnv("FEDERATION_DOMAIN", c.Federation.Domain)
+	c.Federation.SigningKey = e.getEnv("FEDERATION_SIGNING_KEY", c.Federation.SigningKey)
+	c.Federation.Peers = e.getEnvList("FEDERATION_PEERS", c.Federation.Peers)
+	c.Federation.Timeout = e.getEnvDuration("FEDERATION_TIMEOUT", c.Federation.Timeout)
+	c.Federation.KeyTTL = e.getEnvDuration("FEDERATION_KEY_TTL", c.Federation.KeyTTL)
+	c.Federation.DirectMessages = e.getEnvBool("FEDERATION_DIRECT_MESSAGES", c.Federation.DirectMessages)
+
+	c.Support.TeamConversation = e.getEnv("SUPPORT_TEAM_CONVERSATION", c.Support.TeamConversation)
+	c.Support.Username = e.getEnv("SUPPORT_USERNAME", c.Support.Username)
+	c.Support.FirstResponseSLA = e.getEnvDuration("SUPPORT_FIRST_RESPONSE_SLA", c.Support.FirstResponseSLA)
+	c.Support.ResolutionSLA = e.getEnvDuration("SUPPORT_RESOLUTION_SLA", c.Support.ResolutionSLA)
+	c.Support.Interval = e.getEnvDuration("SUPPORT_SLA_INTERVAL", c.Support.Interval)
+
+	c.GraphQL.Enabled = e.getEnvBool("GRAPHQL_ENABLED", c.GraphQL.Enabled)
+	c.GraphQL.MaxDepth = int(e.getEnvInt64("GRAPHQL_MAX_DEPTH", int64(c.GraphQL.MaxDepth)))
+	c.GraphQL.MaxParallelism = int(e.getEnvInt64("GRAPHQL_MAX_PARALLELISM", int64(c.GraphQL.MaxParallelism)))
+
+	c.Service.Enabled = e.getEnvBool("SERVICE_AUTH_ENABLED", c.Service.Enabled)
+	c.Service.Addr = e.getEnv("SERVICE_ADDR", c.Service.Addr)
+	c.Service.CAFile = e.getEnv("SERVICE_TLS_CA_FILE", c.Service.CAFile)
+	c.Service.CertFile = e.getEnv("SERVICE_TLS_CERT_FILE", c.Service.CertFile)
+	c.Service.KeyFile = e.getEnv("SERVICE_TLS_KEY_FILE", c.Service.KeyFile)
+	c.Service.TokenSecret = e.getEnv("SERVICE_TOKEN_SECRET", c.Service.TokenSecret)
+	c.Service.AllowedServices = e.getEnvList("SERVICE_ALLOWED_NAMES", c.Service.AllowedServices)
+
+	c.Reporting.DSN = e.getEnvAlias("ERROR_REPORTING_DSN", []string{"SENTRY_DSN"}, c.Reporting.DSN)
+	c.Reporting.Release = e.getEnv("RELEASE_VERSION", c.Reporting.Release)
+
+	c.Runtime.LogLevel = e.getEnv("LOG_LEVEL", c.Runtime.LogLevel)
+	c.Runtime.CORSOrigins = e.getEnvList("CORS_ALLOWED_ORIGINS", c.Runtime.CORSOrigins)
+	c.Runtime.RateLimit.RequestsPerMinute = int(e.getEnvInt64("RATE_LIMIT_RPM", int64(c.Runtime.RateLimit.RequestsPerMinute)))
+	c.Runtime.RateLimit.Burst = int(e.getEnvInt64("RATE_LIMIT_BURST", int64(c.Runtime.RateLimit.Burst)))
+	c.Runtime.Network.AllowedCIDRs = e.getEnvList("NETWORK_ALLOWED_CIDRS", c.Runtime.Network.AllowedCIDRs)
+	c.Runtime.Network.BlockedCountries = e.getEnvList("NETWORK_BLOCKED_COUNTRIES", c.Runtime.Network.BlockedCountries)
+	c.Runtime.Features = e.getEnvFlags("FEATURE_FLAGS", c.Runtime.Features)
+	c.Runtime.Status.Incident = e.getEnvBool("STATUS_INCIDENT", c.Runtime.Status.Incident)
+	c.Runtime.Status.Message = e.getEnv("STATUS_MESSAGE", c.Runtime.Status.Message)
+	c.Runtime.MinClientVersions = e.getEnvMap("MIN_CLIENT_VERSIONS", c.Runtime.MinClientVersions)
+	c.Runtime.MinNotificationPreview = e.getEnv("NOTIFICATION_MIN_PREVIEW", c.Runtime.MinNotificationPreview)
+	c.Runtime.ShadowReads.SampleRate = e.getEnvFloat("SHADOW_READ_SAMPLE_RATE", c.Runtime.ShadowReads.SampleRate)
+
+	c.envErrors = e.errors
+}
+
+// IsDevelopment reports whether the development profile is active
+func (c *Config) IsDevelopment() bool {
+	return c.Profile == ProfileDevelopment
+}
+
+// normalizeProfile maps profile names and their short forms to a profile constant.
+// Unknown names are returned as-is so validation can report them.
+func normalizeProfile(profile string) string {
+	switch profile {
+	case "", "dev", ProfileDevelopment:
+		return ProfileDevelopment
+	case "stage", ProfileStaging:
+		return ProfileStaging
+	case "prod", ProfileProduction:
+		return ProfileProduction
+	default:
+		return profile
+	}
 }
 
 // DSN returns the database connection string
@@ -69,11 +943,3 @@ func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
 }
-
-// getEnv gts an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader reads typed environment variables, recording values that fail to
+// parse so validation can report them instead of silently using the default
+type envReader struct {
+	errors []string
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (e *envReader) getEnv(key, defaultValue string) string {
+	return getEnv(key, defaultValue)
+}
+
+// getEnvAlias gets the first set variable among key and its legacy aliases, or returns a default value
+func (e *envReader) getEnvAlias(key string, aliases []string, defaultValue string) string {
+	for _, name := range append([]string{key}, aliases...) {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvInt64 gets an integer environment variable or returns a default value
+func (e *envReader) getEnvInt64(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		e.invalid(key, value, "an integer")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvFloat gets a floating point environment variable or returns a default value
+func (e *envReader) getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		e.invalid(key, value, "a number")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "30s") or returns a default value
+func (e *envReader) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		e.invalid(key, value, "a duration such as 30s")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvBool gets a boolean environment variable or returns a default value
+func (e *envReader) getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.invalid(key, value, "a boolean")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList gets a comma separated environment variable or returns a default value
+func (e *envReader) getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (e *envReader) invalid(key, value, expected string) {
+	e.errors = append(e.errors, fmt.Sprintf("%s=%q is not %s", key, value, expected))
+}
+
+// getEnvFlags reads comma separated feature flags over the defaults. A bare name
+// enables a flag and name=false disables it.
+func (e *envReader) getEnvFlags(key string, defaultValue map[string]bool) map[string]bool {
+	flags := make(map[string]bool, len(defaultValue))
+	for name, enabled := range defaultValue {
+		flags[name] = enabled
+	}
+
+	for _, item := range e.getEnvList(key, nil) {
+		name, value, found := strings.Cut(item, "=")
+		enabled := true
+		if found {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				e.invalid(key, item, "a name or name=bool")
+				continue
+			}
+			enabled = parsed
+		}
+		flags[strings.TrimSpace(name)] = enabled
+	}
+	return flags
+}
+
+// getEnvMap reads comma separated name=value pairs over the defaults
+func (e *envReader) getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	values := make(map[string]string, len(defaultValue))
+	for name, value := range defaultValue {
+		values[name] = value
+	}
+
+	for _, item := range e.getEnvList(key, nil) {
+		name, value, found := strings.Cut(item, "=")
+		if !found {
+			e.invalid(key, item, "a list of name=value pairs")
+			continue
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return values
+}
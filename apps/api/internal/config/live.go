@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReloadHistory is how many reloads are kept for auditing
+const maxReloadHistory = 50
+
+// Change is a single setting altered by a reload
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ReloadRecord audits one reload attempt
+type ReloadRecord struct {
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+	Changes []Change  `json:"changes"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Live holds the runtime settings of a running server and swaps them on reload.
+// Only RuntimeConfig is reloadable; everything else still needs a restart.
+type Live struct {
+	mu        sync.RWMutex
+	path      string
+	runtime   RuntimeConfig
+	history   []ReloadRecord
+	listeners []func(RuntimeConfig)
+}
+
+// NewLive starts from the runtime settings of cfg. Reloads re-read the YAML file at
+// path, if any, and the environment.
+func NewLive(cfg *Config, path string) *Live {
+	return &Live{
+		path:    path,
+		runtime: cfg.Runtime.clone(),
+	}
+}
+
+// Runtime returns the current runtime settings. The result must not be modified.
+func (l *Live) Runtime() RuntimeConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.runtime
+}
+
+// Feature reports whether a feature flag is enabled
+func (l *Live) Feature(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.runtime.Features[name]
+}
+
+// OnChange registers fn to be called with the new settings after every applied reload
+func (l *Live) OnChange(fn func(RuntimeConfig)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
+
+// History returns past reloads, most recent first
+func (l *Live) History() []ReloadRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	history := make([]ReloadRecord, len(l.history))
+	for i, record := range l.history {
+		history[len(l.history)-1-i] = record
+	}
+	return history
+}
+
+// Reload loads and validates the configuration again and applies the runtime
+// settings if the whole configuration is valid. Nothing changes on error.
+func (l *Live) Reload(actor string) (*ReloadRecord, error) {
+	record := ReloadRecord{
+		At:    time.Now().UTC(),
+		Actor: actor,
+	}
+
+	cfg, err := Load(l.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		record.Error = err.Error()
+		l.mu.Lock()
+		l.record(record)
+		l.mu.Unlock()
+		return &record, err
+	}
+
+	l.mu.Lock()
+	next := cfg.Runtime.clone()
+	record.Changes = diffRuntime(l.runtime, next)
+	if len(record.Changes) > 0 {
+		l.runtime = next
+	}
+	l.record(record)
+	listeners := append([]func(RuntimeConfig){}, l.listeners...)
+	l.mu.Unlock()
+
+	if len(record.Changes) > 0 {
+		for _, fn := range listeners {
+			fn(next)
+		}
+	}
+	return &record, nil
+}
+
+func (l *Live) record(record ReloadRecord) {
+	l.history = append(l.history, record)
+	if len(l.history) > maxReloadHistory {
+		l.history = l.history[len(l.history)-maxReloadHistory:]
+	}
+}
+
+func (r RuntimeConfig) clone() RuntimeConfig {
+	out := r
+	out.CORSOrigins = append([]string(nil), r.CORSOrigins...)
+	out.Network.AllowedCIDRs = append([]string(nil), r.Network.AllowedCIDRs...)
+	out.Network.BlockedCountries = append([]string(nil), r.Network.BlockedCountries...)
+	out.Features = make(map[string]bool, len(r.Features))
+	for name, enabled := range r.Features {
+		out.Features[name] = enabled
+	}
+	out.MinClientVersions = make(map[string]string, len(r.MinClientVersions))
+	for platform, version := range r.MinClientVersions {
+		out.MinClientVersions[platform] = version
+	}
+	return out
+}
+
+func diffRuntime(old, next RuntimeConfig) []Change {
+	changes := []Change{}
+	add := func(key, o, n string) {
+		if o != n {
+			changes = append(changes, Change{Key: key, Old: o, New: n})
+		}
+	}
+
+	add("runtime.log_level", old.LogLevel, next.LogLevel)
+	add("runtime.cors_origins", strings.Join(old.CORSOrigins, ","), strings.Join(next.CORSOrigins, ","))
+	add("runtime.rate_limit.requests_per_minute",
+		strconv.Itoa(old.RateLimit.RequestsPerMinute), strconv.Itoa(next.RateLimit.RequestsPerMinute))
+	add("runtime.rate_limit.burst", strconv.Itoa(old.RateLimit.Burst), strconv.Itoa(next.RateLimit.Burst))
+	add("runtime.network.allowed_cidrs",
+		strings.Join(old.Network.AllowedCIDRs, ","), strings.Join(next.Network.AllowedCIDRs, ","))
+	add("runtime.network.blocked_countries",
+		strings.Join(old.Network.BlockedCountries, ","), strings.Join(next.Network.BlockedCountries, ","))
+	add("runtime.status.incident", strconv.FormatBool(old.Status.Incident), strconv.FormatBool(next.Status.Incident))
+	add("runtime.status.message", old.Status.Message, next.Status.Message)
+	add("runtime.min_notification_preview", old.MinNotificationPreview, next.MinNotificationPreview)
+	add("runtime.shadow_reads.sample_rate",
+		strconv.FormatFloat(old.ShadowReads.SampleRate, 'g', -1, 64), strconv.FormatFloat(next.ShadowReads.SampleRate, 'g', -1, 64))
+
+	names := map[string]bool{}
+	for name := range old.Features {
+		names[name] = true
+	}
+	for name := range next.Features {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		add(fmt.Sprintf("runtime.features.%s", name), flagString(old.Features, name), flagString(next.Features, name))
+	}
+
+	platforms := map[string]bool{}
+	for platform := range old.MinClientVersions {
+		platforms[platform] = true
+	}
+	for platform := range next.MinClientVersions {
+		platforms[platform] = true
+	}
+	sorted = sorted[:0]
+	for platform := range platforms {
+		sorted = append(sorted, platform)
+	}
+	sort.Strings(sorted)
+	for _, platform := range sorted {
+		add(fmt.Sprintf("runtime.min_client_versions.%s", platform),
+			old.MinClientVersions[platform], next.MinClientVersions[platform])
+	}
+
+	return changes
+}
+
+func flagString(flags map[string]bool, name string) string {
+	enabled, ok := flags[name]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatBool(enabled)
+}
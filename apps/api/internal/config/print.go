@@ -0,0 +1,77 @@
+package config
+
+import (
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with secrets masked
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Server.AutocertHosts = append([]string(nil), c.Server.AutocertHosts...)
+	out.Media.AllowedHosts = append([]string(nil), c.Media.AllowedHosts...)
+	out.Automation.WebhookHosts = append([]string(nil), c.Automation.WebhookHosts...)
+	out.Federation.Peers = append([]string(nil), c.Federation.Peers...)
+	out.Compliance.Recorders = append([]string(nil), c.Compliance.Recorders...)
+	out.Service.AllowedServices = append([]string(nil), c.Service.AllowedServices...)
+	out.Runtime = c.Runtime.clone()
+
+	out.Database.Password = redactValue(c.Database.Password)
+	out.JWT.SecretKey = redactValue(c.JWT.SecretKey)
+	out.Service.TokenSecret = redactValue(c.Service.TokenSecret)
+	out.Events.ResumeSigningKey = redactValue(c.Events.ResumeSigningKey)
+	out.Media.SigningKey = redactValue(c.Media.SigningKey)
+	out.Invite.SigningKey = redactValue(c.Invite.SigningKey)
+	out.Compliance.SigningKey = redactValue(c.Compliance.SigningKey)
+	out.Compliance.StreamKey = redactValue(c.Compliance.StreamKey)
+	out.Federation.SigningKey = redactValue(c.Federation.SigningKey)
+	out.SMS.Token = redactValue(c.SMS.Token)
+
+	if c.Reporting.DSN != "" {
+		if u, err := url.Parse(c.Reporting.DSN); err == nil && u.User != nil {
+			u.User = url.User(redacted)
+			out.Reporting.DSN = u.String()
+		} else {
+			out.Reporting.DSN = redacted
+		}
+	}
+
+	if c.Mail.SMTPURL != "" {
+		if u, err := url.Parse(c.Mail.SMTPURL); err == nil {
+			if u.User != nil {
+				u.User = url.User(redacted)
+			}
+			out.Mail.SMTPURL = u.String()
+		} else {
+			out.Mail.SMTPURL = redacted
+		}
+	}
+
+	if c.Redis.URL != "" {
+		if u, err := url.Parse(c.Redis.URL); err == nil {
+			if u.User != nil {
+				u.User = url.User(redacted)
+			}
+			out.Redis.URL = u.String()
+		} else {
+			out.Redis.URL = redacted
+		}
+	}
+
+	return &out
+}
+
+// YAML renders the configuration in the config file format
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
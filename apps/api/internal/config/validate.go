@@ -0,0 +1,651 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/clientversion"
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/groupname"
+
+	"github.com/google/uuid"
+)
+
+// minSecretLength is the shortest accepted HMAC secret, matching HS256's 256-bit key size
+const minSecretLength = 32
+
+var logLevels = map[string]bool{
+	"trace": true,
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration and reports all problems at once
+func (c *Config) Validate() error {
+	v := &validator{problems: append([]string{}, c.envErrors...)}
+
+	switch c.Profile {
+	case ProfileDevelopment, ProfileStaging, ProfileProduction:
+	default:
+		v.addf("profile %q must be one of development, staging, production", c.Profile)
+	}
+
+	// Server
+	v.port("server.port", c.Server.Port)
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		v.addf("server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	if c.Server.AutocertEnabled && len(c.Server.AutocertHosts) == 0 {
+		v.addf("server.autocert_hosts is required when autocert is enabled")
+	}
+	if c.Server.TLSEnabled() && c.Server.RedirectHTTP {
+		v.port("server.http_port", c.Server.HTTPPort)
+	}
+	v.nonNegative("server.read_timeout", int64(c.Server.ReadTimeout))
+	v.nonNegative("server.read_header_timeout", int64(c.Server.ReadHeaderTimeout))
+	v.nonNegative("server.write_timeout", int64(c.Server.WriteTimeout))
+	v.nonNegative("server.idle_timeout", int64(c.Server.IdleTimeout))
+	v.nonNegative("server.request_timeout", int64(c.Server.RequestTimeout))
+	if c.Server.WriteTimeout > 0 && c.Server.RequestTimeout >= c.Server.WriteTimeout {
+		v.addf("server.request_timeout (%s) must be shorter than server.write_timeout (%s)",
+			c.Server.RequestTimeout, c.Server.WriteTimeout)
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		v.addf("server.max_header_bytes must be positive")
+	}
+	if c.Server.ShutdownTimeout < time.Second {
+		v.addf("server.shutdown_timeout must be at least 1s")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validNetwork(proxy) {
+			v.addf("server.trusted_proxies entry %q must be an IP address or CIDR", proxy)
+		}
+	}
+	for _, header := range c.Server.RemoteIPHeaders {
+		if !validHeaderName(header) {
+			v.addf("server.remote_ip_headers entry %q must be a header name", header)
+		}
+	}
+	if len(c.Server.TrustedProxies) > 0 && len(c.Server.RemoteIPHeaders) == 0 {
+		v.addf("server.remote_ip_headers is required when server.trusted_proxies is set")
+	}
+
+	// Database
+	v.required("database.host", c.Database.Host)
+	v.port("database.port", c.Database.Port)
+	v.required("database.user", c.Database.User)
+	v.required("database.name", c.Database.DBName)
+	if !sslModes[c.Database.SSLMode] {
+		v.addf("database.ssl_mode %q is not a valid Postgres sslmode", c.Database.SSLMode)
+	}
+	v.nonNegative("database.startup_max_wait", int64(c.Database.StartupMaxWait))
+	v.required("database.migrations_dir", c.Database.MigrationsDir)
+	if !c.IsDevelopment() {
+		v.required("database.password", c.Database.Password)
+	}
+	if c.Database.LogQueries && !c.IsDevelopment() {
+		v.addf("database.log_queries is only allowed in development, as it logs user data")
+	}
+	v.nonNegative("database.explain_threshold", int64(c.Database.ExplainThreshold))
+	if c.Database.ExplainSamplePercent < 0 || c.Database.ExplainSamplePercent > 100 {
+		v.addf("database.explain_sample_percent must be between 0 and 100")
+	}
+
+	// Encryption
+	switch c.Encryption.Mode {
+	case "aes-gcm", "xchacha20-poly1305":
+		v.required("encryption.key_file", c.Encryption.KeyFile)
+	case "plaintext":
+		if c.Profile == ProfileProduction {
+			v.addf("encryption.mode plaintext is not allowed in production")
+		}
+	default:
+		v.addf("encryption.mode %q must be aes-gcm, xchacha20-poly1305 or plaintext", c.Encryption.Mode)
+	}
+
+	// JWT
+	v.required("jwt.secret_kid", c.JWT.SecretKID)
+	v.required("jwt.issuer", c.JWT.Issuer)
+	v.required("jwt.audience", c.JWT.Audience)
+	if !c.IsDevelopment() {
+		v.secret("jwt.secret_key", c.JWT.SecretKey)
+		if c.JWT.SecretKey == insecureJWTSecret {
+			v.addf("jwt.secret_key must not be the development default")
+		}
+	} else {
+		v.required("jwt.secret_key", c.JWT.SecretKey)
+	}
+
+	// Quota
+	v.nonNegative("quota.max_storage_bytes", c.Quota.MaxStorageBytes)
+	v.nonNegative("quota.max_messages", c.Quota.MaxMessages)
+	v.nonNegative("quota.max_media_size", c.Quota.MaxMediaSize)
+	v.nonNegative("quota.conversations_per_hour", int64(c.Quota.ConversationsPerHour))
+	v.nonNegative("quota.conversations_per_day", int64(c.Quota.ConversationsPerDay))
+	v.nonNegative("quota.verified_conversations_per_hour", int64(c.Quota.VerifiedConversationsPerHour))
+	v.nonNegative("quota.verified_conversations_per_day", int64(c.Quota.VerifiedConversationsPerDay))
+
+	// Group
+	v.nonNegative("group.max_participants", int64(c.Group.MaxParticipants))
+	v.nonNegative("group.large_threshold", int64(c.Group.LargeThreshold))
+	if c.Group.MaxParticipants > 0 && c.Group.LargeThreshold >= c.Group.MaxParticipants {
+		v.addf("group.large_threshold (%d) must be below group.max_participants (%d)",
+			c.Group.LargeThreshold, c.Group.MaxParticipants)
+	}
+	if c.Group.NameParticipants < 1 || c.Group.NameParticipants > groupname.MaxNamed {
+		v.addf("group.name_participants must be between 1 and %d", groupname.MaxNamed)
+	}
+	for locale, template := range c.Group.NameTemplates {
+		if normalized, ok := contentfilter.NormalizeLocale(locale); !ok || normalized != locale {
+			v.addf("group.name_templates locale %q must be lower case, such as en or pt-br", locale)
+		}
+		if !template.Complete() {
+			v.addf("group.name_templates.%s must set alone, all, one and many, with {names} in all and {count} in many", locale)
+		}
+	}
+	if !groupname.New(1, "", c.Group.NameTemplates).Has(c.Group.NameLocale) {
+		v.addf("group.name_locale %q has no template; add it to group.name_templates", c.Group.NameLocale)
+	}
+
+	// Pagination
+	if c.Pagination.MaxLimit < 1 {
+		v.addf("pagination.max_limit must be at least 1")
+	}
+	if c.Pagination.ConversationLimit < 1 || c.Pagination.ConversationLimit > c.Pagination.MaxLimit {
+		v.addf("pagination.conversation_limit must be between 1 and pagination.max_limit (%d)", c.Pagination.MaxLimit)
+	}
+
+	// Presence
+	if c.Presence.OnlineTTL < time.Minute {
+		v.addf("presence.online_ttl must be at least 1m so WebSocket pings keep users online")
+	}
+	if c.Presence.SweepInterval <= 0 {
+		v.addf("presence.sweep_interval must be positive")
+	}
+
+	// Retention
+	v.nonNegative("retention.conversation_grace", int64(c.Retention.ConversationGrace))
+	v.nonNegative("retention.empty_conversation", int64(c.Retention.EmptyConversation))
+	if c.Retention.StagedAttachment < time.Hour {
+		v.addf("retention.staged_attachment must be at least 1h")
+	}
+	if c.Retention.Interval <= 0 {
+		v.addf("retention.interval must be positive")
+	}
+
+	// Inactive accounts
+	v.nonNegative("inactive.warn_after", int64(c.Inactive.WarnAfter))
+	v.nonNegative("inactive.anonymize_after", int64(c.Inactive.AnonymizeAfter))
+	if c.Inactive.Enabled() {
+		if c.Inactive.WarnAfter < 24*time.Hour {
+			v.addf("inactive.warn_after must be at least 24h")
+		}
+		// Warned users need time to come back before anything happens to their account
+		if c.Inactive.DeactivateAfter < c.Inactive.WarnAfter+24*time.Hour {
+			v.addf("inactive.deactivate_after must be at least 24h after inactive.warn_after")
+		}
+		if c.Inactive.AnonymizeAfter > 0 && c.Inactive.AnonymizeAfter <= c.Inactive.DeactivateAfter {
+			v.addf("inactive.anonymize_after must be after inactive.deactivate_after")
+		}
+	}
+	if c.Inactive.Interval <= 0 {
+		v.addf("inactive.interval must be positive")
+	}
+
+	// Logins from new devices
+	if c.Login.VerifyNewDevices && (c.Login.CodeTTL < time.Minute || c.Login.CodeTTL > time.Hour) {
+		v.addf("login.code_ttl must be between 1m and 1h")
+	}
+
+	// Sessions; activity is only recorded once a minute, so short idle timeouts would misfire
+	v.nonNegative("session.idle_timeout", int64(c.Session.IdleTimeout))
+	v.nonNegative("session.max_lifetime", int64(c.Session.MaxLifetime))
+	v.nonNegative("session.max_per_user", int64(c.Session.MaxPerUser))
+	if c.Session.IdleTimeout > 0 && c.Session.IdleTimeout < 5*time.Minute {
+		v.addf("session.idle_timeout must be at least 5m")
+	}
+	if c.Session.MaxLifetime > 0 && c.Session.MaxLifetime < c.Session.IdleTimeout {
+		v.addf("session.max_lifetime must not be shorter than session.idle_timeout")
+	}
+
+	// Passwords; the hash cost is paid on every login, so memory is kept within reason
+	if c.Password.MinLength < 8 || c.Password.MinLength > 128 {
+		v.addf("password.min_length must be between 8 and 128")
+	}
+	if c.Password.HashMemory < 8*1024 || c.Password.HashMemory > 1024*1024 {
+		v.addf("password.hash_memory must be between 8192 and 1048576 KiB, got %d", c.Password.HashMemory)
+	}
+	if c.Password.HashIterations < 1 || c.Password.HashIterations > 10 {
+		v.addf("password.hash_iterations must be between 1 and 10, got %d", c.Password.HashIterations)
+	}
+	if c.Password.HashParallelism < 1 || c.Password.HashParallelism > 16 {
+		v.addf("password.hash_parallelism must be between 1 and 16, got %d", c.Password.HashParallelism)
+	}
+	if c.Password.BreachCheck {
+		if u, err := url.Parse(c.Password.BreachURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			v.addf("password.breach_url must be an https URL")
+		}
+		if c.Password.BreachTimeout < 100*time.Millisecond || c.Password.BreachTimeout > 30*time.Second {
+			v.addf("password.breach_timeout must be between 100ms and 30s")
+		}
+	}
+
+	// Account recovery; the delay gives the owner time to notice and cancel a request
+	v.nonNegative("recovery.delay", int64(c.Recovery.Delay))
+	if c.Recovery.RequestTTL <= c.Recovery.Delay {
+		v.addf("recovery.request_ttl must be longer than recovery.delay")
+	}
+
+	// Invite links
+	if c.Invite.SigningKey != "" {
+		v.secret("invite.signing_key", c.Invite.SigningKey)
+	}
+	if c.Invite.TTL < time.Hour {
+		v.addf("invite.ttl must be at least 1h")
+	}
+
+	// Compliance
+	if c.Compliance.SigningKey != "" {
+		v.secret("compliance.signing_key", c.Compliance.SigningKey)
+	}
+	if c.Compliance.StreamKey != "" {
+		v.secret("compliance.stream_key", c.Compliance.StreamKey)
+	}
+	if len(c.Compliance.Recorders) > 0 {
+		if c.Compliance.SigningKey == "" || c.Compliance.StreamKey == "" {
+			v.addf("compliance.recorders requires compliance.signing_key and compliance.stream_key")
+		}
+		if !c.Service.Enabled {
+			v.addf("compliance.recorders requires the service listener")
+		}
+		for _, recorder := range c.Compliance.Recorders {
+			if len(c.Service.AllowedServices) > 0 && !slices.Contains(c.Service.AllowedServices, recorder) {
+				v.addf("compliance.recorders entry %q must be listed in service.allowed_services", recorder)
+			}
+		}
+	}
+	if c.Compliance.StreamRetention < time.Hour {
+		v.addf("compliance.stream_retention must be at least 1h")
+	}
+
+	// Mail
+	if c.Mail.SMTPURL != "" {
+		if u, err := url.Parse(c.Mail.SMTPURL); err != nil || u.Scheme != "smtp" || u.Hostname() == "" {
+			v.addf("mail.smtp_url must look like smtp://[user:password@]host[:port]")
+		}
+	}
+	v.required("mail.from", c.Mail.From)
+
+	// SMS
+	if c.SMS.GatewayURL != "" {
+		if u, err := url.Parse(c.SMS.GatewayURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			v.addf("sms.gateway_url must be an http(s) URL")
+		}
+	}
+
+	// Redis
+	if c.Redis.URL != "" {
+		if u, err := url.Parse(c.Redis.URL); err != nil || u.Scheme != "redis" || u.Host == "" {
+			v.addf("redis.url must look like redis://[:password@]host[:port][/db]")
+		}
+	}
+
+	// Metrics
+	if c.Metrics.TopK < 1 || c.Metrics.TopK > 100 {
+		v.addf("metrics.top_k must be between 1 and 100, got %d", c.Metrics.TopK)
+	}
+	if c.Metrics.Window < time.Second {
+		v.addf("metrics.window must be at least 1s")
+	}
+
+	// Event log
+	if c.Events.Retention <= 0 {
+		v.addf("events.retention must be positive")
+	}
+	if c.Events.MaxPerConversation < 1 {
+		v.addf("events.max_per_conversation must be positive")
+	}
+	if c.Events.MaxBytes < 1<<20 {
+		v.addf("events.max_bytes must be at least 1 MiB")
+	}
+	if c.Events.BatchInterval < 0 || c.Events.BatchInterval > time.Second {
+		v.addf("events.batch_interval must be between 0 and 1s")
+	}
+	if c.Events.BatchMaxEvents < 1 || c.Events.BatchMaxEvents > 1000 {
+		v.addf("events.batch_max_events must be between 1 and 1000, got %d", c.Events.BatchMaxEvents)
+	}
+	if c.Events.ResumeWindow != 0 && (c.Events.ResumeWindow < 10*time.Second || c.Events.ResumeWindow > time.Hour) {
+		v.addf("events.resume_window must be 0 or between 10s and 1h")
+	}
+	if c.Events.ResumeSigningKey != "" {
+		v.secret("events.resume_signing_key", c.Events.ResumeSigningKey)
+	}
+
+	// Delivery tracking
+	if c.Delivery.AckTimeout < time.Second {
+		v.addf("delivery.ack_timeout must be at least 1s")
+	}
+	if c.Delivery.NotifyGrace < 0 || c.Delivery.NotifyGrace > time.Minute {
+		v.addf("delivery.notify_grace must be between 0 and 1m")
+	}
+
+	// Media
+	for _, host := range c.Media.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			v.addf("media.allowed_hosts entry %q must be a host name such as cdn.example.com", host)
+		}
+	}
+	if c.Media.SigningKey != "" {
+		v.secret("media.signing_key", c.Media.SigningKey)
+	}
+	if c.Media.URLTTL < time.Second || c.Media.URLTTL > time.Hour {
+		v.addf("media.url_ttl must be between 1s and 1h")
+	}
+	v.required("media.archive_dir", c.Media.ArchiveDir)
+	if c.Media.ArchiveTTL < time.Hour {
+		v.addf("media.archive_ttl must be at least 1h")
+	}
+	if c.Media.ArchiveMaxBytes < 1<<20 {
+		v.addf("media.archive_max_bytes must be at least 1 MiB")
+	}
+	if c.Media.ReportInterval < time.Hour {
+		v.addf("media.report_interval must be at least 1h")
+	}
+
+	// Conversation automations
+	for _, host := range c.Automation.WebhookHosts {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			v.addf("automation.webhook_hosts entry %q must be a host name such as hooks.example.com", host)
+		}
+	}
+	if c.Automation.WebhookTimeout < time.Second || c.Automation.WebhookTimeout > time.Minute {
+		v.addf("automation.webhook_timeout must be between 1s and 1m")
+	}
+	if c.Automation.MaxPerConversation < 1 {
+		v.addf("automation.max_per_conversation must be at least 1")
+	}
+	if c.Automation.MaxRunsPerMinute < 1 {
+		v.addf("automation.max_runs_per_minute must be at least 1")
+	}
+
+	// Content filter
+	if !contentfilter.IsMode(c.ContentFilter.Mode) {
+		v.addf("content_filter.mode must be off, mask or block")
+	}
+	if _, ok := contentfilter.NormalizeLocale(c.ContentFilter.Locale); !ok {
+		v.addf("content_filter.locale %q must be a locale such as en or pt-BR", c.ContentFilter.Locale)
+	}
+	if c.ContentFilter.WordlistDir != "" {
+		if info, err := os.Stat(c.ContentFilter.WordlistDir); err != nil || !info.IsDir() {
+			v.addf("content_filter.wordlist_dir %q must be a directory", c.ContentFilter.WordlistDir)
+		}
+	}
+
+	// Federation
+	if c.Federation.Domain != "" && !validDomain(c.Federation.Domain) {
+		v.addf("federation.domain %q must be a domain name such as chat.example.com", c.Federation.Domain)
+	}
+	if c.Federation.SigningKey != "" {
+		v.secret("federation.signing_key", c.Federation.SigningKey)
+	}
+	if (c.Federation.Domain == "") != (c.Federation.SigningKey == "") {
+		v.addf("federation.domain and federation.signing_key must be set together")
+	}
+	for _, peer := range c.Federation.Peers {
+		if !validDomain(peer) {
+			v.addf("federation.peers entry %q must be a domain name such as chat.example.com", peer)
+		} else if strings.EqualFold(peer, c.Federation.Domain) {
+			v.addf("federation.peers must not list federation.domain")
+		}
+	}
+	if c.Federation.Timeout < time.Second || c.Federation.Timeout > time.Minute {
+		v.addf("federation.timeout must be between 1s and 1m")
+	}
+	if c.Federation.KeyTTL < time.Minute {
+		v.addf("federation.key_ttl must be at least 1m")
+	}
+	if c.Federation.DirectMessages && !c.Federation.Enabled() {
+		v.addf("federation.direct_messages requires federation.domain and federation.signing_key")
+	}
+
+	// Support queues
+	if c.Support.Enabled() {
+		if _, err := uuid.Parse(c.Support.TeamConversation); err != nil {
+			v.addf("support.team_conversation %q must be a conversation ID", c.Support.TeamConversation)
+		}
+		if name := strings.TrimSpace(c.Support.Username); name == "" || len(name) > 255 {
+			v.addf("support.username must be 1 to 255 characters")
+		}
+	}
+	v.nonNegative("support.first_response_sla", int64(c.Support.FirstResponseSLA))
+	v.nonNegative("support.resolution_sla", int64(c.Support.ResolutionSLA))
+	if c.Support.Interval < time.Second {
+		v.addf("support.interval must be at least 1s")
+	}
+
+	// GraphQL
+	if c.GraphQL.Enabled {
+		if c.GraphQL.MaxDepth < 1 {
+			v.addf("graphql.max_depth must be at least 1")
+		}
+		if c.GraphQL.MaxParallelism < 1 {
+			v.addf("graphql.max_parallelism must be at least 1")
+		}
+	}
+
+	// Service listener
+	if c.Service.Enabled {
+		if _, port, err := net.SplitHostPort(c.Service.Addr); err != nil {
+			v.addf("service.addr %q must be host:port", c.Service.Addr)
+		} else {
+			v.port("service.addr", port)
+		}
+		if (c.Service.CertFile == "") != (c.Service.KeyFile == "") {
+			v.addf("service.cert_file and service.key_file must be set together")
+		}
+		if c.Service.CAFile != "" && c.Service.CertFile == "" {
+			v.addf("service.ca_file requires service.cert_file and service.key_file")
+		}
+		if c.Service.CAFile == "" && c.Service.TokenSecret == "" {
+			v.addf("service.ca_file or service.token_secret is required when the service listener is enabled")
+		}
+		if c.Service.TokenSecret != "" {
+			v.secret("service.token_secret", c.Service.TokenSecret)
+		}
+	}
+
+	// Reporting
+	if c.Reporting.DSN != "" {
+		if u, err := url.Parse(c.Reporting.DSN); err != nil || u.Host == "" || u.User == nil {
+			v.addf("reporting.dsn is not a valid DSN")
+		}
+	}
+
+	// Runtime
+	c.Runtime.validate(v)
+	// Without trusted proxies any client could claim another address or country
+	if c.Runtime.Network.Restricted() && len(c.Server.TrustedProxies) == 0 {
+		v.addf("server.trusted_proxies is required when runtime.network restricts access")
+	}
+	if len(c.Runtime.Network.BlockedCountries) > 0 && c.Server.CountryHeader == "" {
+		v.addf("server.country_header is required when runtime.network.blocked_countries is set")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validate checks the reloadable settings; reloads run it before applying anything
+func (r *RuntimeConfig) validate(v *validator) {
+	if !logLevels[r.LogLevel] {
+		v.addf("runtime.log_level %q must be one of trace, debug, info, warn, error", r.LogLevel)
+	}
+	for _, origin := range r.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			v.addf("runtime.cors_origins entry %q must be a scheme and host such as https://app.example.com", origin)
+		}
+	}
+	if r.RateLimit.RequestsPerMinute < 0 {
+		v.addf("runtime.rate_limit.requests_per_minute must not be negative")
+	}
+	if r.RateLimit.RequestsPerMinute > 0 && r.RateLimit.Burst < 1 {
+		v.addf("runtime.rate_limit.burst must be at least 1 when rate limiting is enabled")
+	}
+	for _, network := range r.Network.AllowedCIDRs {
+		if !validNetwork(network) {
+			v.addf("runtime.network.allowed_cidrs entry %q must be an IP address or CIDR", network)
+		}
+	}
+	for _, country := range r.Network.BlockedCountries {
+		if len(country) != 2 || strings.ToUpper(country) != country || strings.ToLower(country) == country {
+			v.addf("runtime.network.blocked_countries entry %q must be a two letter country code such as US", country)
+		}
+	}
+	for name := range r.Features {
+		if strings.TrimSpace(name) == "" {
+			v.addf("runtime.features contains an empty flag name")
+		}
+	}
+	if len(r.Status.Message) > 500 {
+		v.addf("runtime.status.message must be at most 500 characters")
+	}
+	for platform, version := range r.MinClientVersions {
+		if platform == "" || clientversion.Platform(platform) != platform {
+			v.addf("runtime.min_client_versions platform %q must be a lower case name such as ios", platform)
+		}
+		if _, err := clientversion.Parse(version); err != nil {
+			v.addf("runtime.min_client_versions.%s must be a version such as 2.3.0", platform)
+		}
+	}
+	switch r.MinNotificationPreview {
+	case "full", "sender", "generic":
+	default:
+		v.addf("runtime.min_notification_preview %q must be one of full, sender, generic", r.MinNotificationPreview)
+	}
+	if r.ShadowReads.SampleRate < 0 || r.ShadowReads.SampleRate > 1 {
+		v.addf("runtime.shadow_reads.sample_rate must be between 0 and 1")
+	}
+}
+
+// validDomain reports whether s is a lower case domain name without a scheme, port or
+// path
+func validDomain(s string) bool {
+	if s == "" || len(s) > 253 || strings.ToLower(s) != s || !strings.Contains(s, ".") {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validHeaderName reports whether s is a name an HTTP header can have
+func validHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validNetwork reports whether s is an IP address or CIDR block
+func validNetwork(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", name)
+	}
+}
+
+func (v *validator) port(name, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		v.addf("%s %q must be a port between 1 and 65535", name, value)
+	}
+}
+
+func (v *validator) nonNegative(name string, value int64) {
+	if value < 0 {
+		v.addf("%s must not be negative", name)
+	}
+}
+
+func (v *validator) secret(name, value string) {
+	if len(value) < minSecretLength {
+		v.addf("%s must be at least %d bytes", name, minSecretLength)
+	}
+}
+
+// CheckJWTSecret applies the rules secrets are held to outside development, whatever
+// the profile, so that a secret can be checked before going live
+func CheckJWTSecret(secret string) error {
+	if secret == insecureJWTSecret {
+		return fmt.Errorf("secret is the development default")
+	}
+	if len(secret) < minSecretLength {
+		return fmt.Errorf("secret is %d bytes, at least %d are needed", len(secret), minSecretLength)
+	}
+	distinct := map[rune]bool{}
+	for _, r := range secret {
+		distinct[r] = true
+	}
+	if len(distinct) < 8 {
+		return fmt.Errorf("secret repeats too few characters (%d distinct) to be random", len(distinct))
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package contentfilter finds profanity in messages, by locale, and masks it or has
+// the message refused. Wordlists are text files named after their locale, such as
+// en.txt or pt-br.txt, with a term on each line; lines starting with # are comments.
+// Terms only match whole words, whatever their case.
+package contentfilter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Filter modes
+const (
+	// ModeOff leaves messages as they are
+	ModeOff = "off"
+	// ModeMask replaces the letters of each matched term with asterisks
+	ModeMask = "mask"
+	// ModeBlock refuses messages with a matched term
+	ModeBlock = "block"
+)
+
+// ErrBlocked is returned for a message the block mode refuses
+var ErrBlocked = errors.New("message contains blocked terms")
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// IsMode reports whether mode is one of the filter modes
+func IsMode(mode string) bool {
+	return mode == ModeOff || mode == ModeMask || mode == ModeBlock
+}
+
+// NormalizeLocale lowercases a locale such as pt_BR to pt-br, reporting whether it is
+// a language optionally followed by a region
+func NormalizeLocale(locale string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	return locale, localePattern.MatchString(locale)
+}
+
+// NormalizeTerm lowercases a term and collapses its spaces, as terms are matched
+func NormalizeTerm(term string) string {
+	return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+// Decision is what the filter did to a message
+type Decision struct {
+	Mode   string `json:"mode" example:"mask"`
+	Locale string `json:"locale" example:"en"`
+	// Matches are the distinct terms found, in the order they first appear
+	Matches []string `json:"matches"`
+}
+
+// Filter holds the wordlists of each locale. A nil Filter has no wordlists.
+type Filter struct {
+	lists map[string][]string
+}
+
+// Load reads the wordlists in dir; an empty dir loads none
+func Load(dir string) (*Filter, error) {
+	f := &Filter{lists: map[string][]string{}}
+	if dir == "" {
+		return f, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		locale, ok := NormalizeLocale(strings.TrimSuffix(filepath.Base(path), ".txt"))
+		if !ok {
+			return nil, fmt.Errorf("wordlist %s is not named after a locale", path)
+		}
+		terms, err := readWordlist(path)
+		if err != nil {
+			return nil, err
+		}
+		f.lists[locale] = terms
+	}
+	return f, nil
+}
+
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	terms := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if term := NormalizeTerm(line); !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read wordlist %s: %w", path, err)
+	}
+	return terms, nil
+}
+
+// Locales returns the locales that have a wordlist
+func (f *Filter) Locales() []string {
+	if f == nil {
+		return nil
+	}
+	locales := make([]string, 0, len(f.lists))
+	for locale := range f.lists {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Terms returns the wordlist of a locale, falling back to its language's, so pt-br
+// uses pt.txt when there is no pt-br.txt
+func (f *Filter) Terms(locale string) []string {
+	if f == nil {
+		return nil
+	}
+	if terms, ok := f.lists[locale]; ok {
+		return terms
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	return f.lists[language]
+}
+
+// Apply runs mode over text with terms, returning the text to store and what was
+// decided, which is nil when nothing matched. Block mode returns ErrBlocked instead.
+func Apply(text, mode, locale string, terms []string) (string, *Decision, error) {
+	if mode == ModeOff || len(terms) == 0 || text == "" {
+		return text, nil, nil
+	}
+	runes := []rune(text)
+	found := find(runes, terms)
+	if len(found) == 0 {
+		return text, nil, nil
+	}
+
+	decision := &Decision{Mode: mode, Locale: locale, Matches: []string{}}
+	for _, match := range found {
+		if !slices.Contains(decision.Matches, match.term) {
+			decision.Matches = append(decision.Matches, match.term)
+		}
+	}
+	if mode == ModeBlock {
+		return text, decision, ErrBlocked
+	}
+	for _, match := range found {
+		for i := match.start; i < match.end; i++ {
+			if unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) {
+				runes[i] = '*'
+			}
+		}
+	}
+	return string(runes), decision, nil
+}
+
+type match struct {
+	term       string
+	start, end int
+}
+
+// find returns where terms appear in text as whole words, ignoring case. Spaces in a
+// term match any run of spaces.
+func find(text []rune, terms []string) []match {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var found []match
+	for _, term := range terms {
+		words := strings.Fields(term)
+		if len(words) == 0 {
+			continue
+		}
+		for start := 0; start < len(lower); start++ {
+			if start > 0 && isWord(lower[start-1]) {
+				continue
+			}
+			end, ok := matchWords(lower, start, words)
+			if ok && (end == len(lower) || !isWord(lower[end])) {
+				found = append(found, match{term: term, start: start, end: end})
+				start = end - 1
+			}
+		}
+	}
+	slices.SortFunc(found, func(a, b match) int { return a.start - b.start })
+	return found
+}
+
+// matchWords reports where words end when they follow each other from start
+func matchWords(text []rune, start int, words []string) (int, bool) {
+	i := start
+	for n, word := range words {
+		if n > 0 {
+			if i >= len(text) || !unicode.IsSpace(text[i]) {
+				return 0, false
+			}
+			for i < len(text) && unicode.IsSpace(text[i]) {
+				i++
+			}
+		}
+		for _, r := range word {
+			if i >= len(text) || text[i] != r {
+				return 0, false
+			}
+			i++
+		}
+	}
+	return i, true
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,93 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+)
+
+// Job represents a unit of work that runs on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Handler  func() error
+}
+
+// Runner runs registered jobs periodically until stopped
+type Runner struct {
+	jobs   []Job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRunner creates a new job runner
+func NewRunner() *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register adds a job to the runner. Jobs must be registered before Start.
+func (r *Runner) Register(job Job) {
+	r.jobs = append(r.jobs, job)
+}
+
+// Start launches a goroutine per registered job
+func (r *Runner) Start() {
+	logger.Info("Starting cron runner", map[string]interface{}{
+		"jobs": len(r.jobs),
+	})
+
+	for _, job := range r.jobs {
+		r.wg.Add(1)
+		go r.run(job)
+	}
+}
+
+// Stop cancels all jobs and waits for running ones to finish
+func (r *Runner) Stop() {
+	logger.Info("Stopping cron runner")
+	r.cancel()
+	r.wg.Wait()
+}
+
+// run executes the job once immediately and then on every tick
+func (r *Runner) run(job Job) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.execute(job)
+
+		select {
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			logger.Debug("Cron job stopped", map[string]interface{}{
+				"job": job.Name,
+			})
+			return
+		}
+	}
+}
+
+func (r *Runner) execute(job Job) {
+	start := time.Now()
+	if err := job.Handler(); err != nil {
+		logger.Error("Cron job failed", err, map[string]interface{}{
+			"job": job.Name,
+		})
+		return
+	}
+
+	logger.Debug("Cron job completed", map[string]interface{}{
+		"job":      job.Name,
+		"duration": time.Since(start).String(),
+	})
+}
@@ -0,0 +1,136 @@
+// Package dataloader batches the lookups made while resolving one GraphQL request.
+// Resolvers of sibling fields run concurrently and each ask for one key; a Loader
+// collects the keys asked for within a short wait and fetches them with one query,
+// so that a list of messages doesn't look up its senders one by one.
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fetch looks up keys at once, returning the values found. Keys left out of the map
+// weren't found.
+type Fetch[K comparable, V any] func(keys []K) (map[K]V, error)
+
+// Loader fetches keys in batches and remembers what it fetched. It is meant to live as
+// long as a request, so what it remembers doesn't go stale.
+type Loader[K comparable, V any] struct {
+	fetch    Fetch[K, V]
+	wait     time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	results map[K]*result[V]
+	pending *batch[K, V]
+}
+
+// result is the outcome of fetching one key, available once done is closed
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	found bool
+	err   error
+}
+
+// batch is the keys waiting to be fetched together
+type batch[K comparable, V any] struct {
+	keys    []K
+	results []*result[V]
+}
+
+// New creates a loader fetching the keys asked for within wait of the first, at most
+// maxBatch at a time
+func New[K comparable, V any](fetch Fetch[K, V], wait time.Duration, maxBatch int) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:    fetch,
+		wait:     wait,
+		maxBatch: maxBatch,
+		results:  make(map[K]*result[V]),
+	}
+}
+
+// Load returns the value of key, fetching it with the other keys asked for meanwhile
+// unless it was fetched before. found is false for keys the fetch didn't return.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (value V, found bool, err error) {
+	l.mu.Lock()
+	r, ok := l.results[key]
+	if !ok {
+		r = &result[V]{done: make(chan struct{})}
+		l.results[key] = r
+		l.enqueue(key, r)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.value, r.found, r.err
+	case <-ctx.Done():
+		return value, false, ctx.Err()
+	}
+}
+
+// Prime remembers a value fetched another way, such as with the row that referenced it.
+// Keys already loaded or being loaded are left alone.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.results[key]; ok {
+		return
+	}
+	r := &result[V]{done: make(chan struct{}), value: value, found: true}
+	close(r.done)
+	l.results[key] = r
+}
+
+// enqueue adds a key to the pending batch, starting a new one when there is none. A
+// full batch is fetched straight away. The mutex must be held.
+func (l *Loader[K, V]) enqueue(key K, r *result[V]) {
+	if l.pending == nil {
+		b := &batch[K, V]{}
+		l.pending = b
+		time.AfterFunc(l.wait, func() { l.dispatch(b) })
+	}
+	b := l.pending
+	b.keys = append(b.keys, key)
+	b.results = append(b.results, r)
+	if len(b.keys) >= l.maxBatch {
+		l.pending = nil
+		go l.run(b)
+	}
+}
+
+// dispatch fetches a batch whose wait is over, unless it was fetched once full
+func (l *Loader[K, V]) dispatch(b *batch[K, V]) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+	l.run(b)
+}
+
+// run fetches a batch and hands every key its result. Failed fetches are forgotten, so
+// that asking again tries again.
+func (l *Loader[K, V]) run(b *batch[K, V]) {
+	values, err := l.fetch(b.keys)
+	if err != nil {
+		l.mu.Lock()
+		for _, key := range b.keys {
+			delete(l.results, key)
+		}
+		l.mu.Unlock()
+	}
+	for i, key := range b.keys {
+		r := b.results[i]
+		if err != nil {
+			r.err = err
+		} else {
+			r.value, r.found = values[key]
+		}
+		close(r.done)
+	}
+}
@@ -0,0 +1,99 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadBatchesConcurrentKeys(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	loader := New(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		values := make(map[int]string)
+		for _, key := range keys {
+			if key%2 == 0 {
+				values[key] = "even"
+			}
+		}
+		return values, nil
+	}, 10*time.Millisecond, 100)
+
+	var wg sync.WaitGroup
+	for _, key := range []int{1, 2, 3, 2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, found, err := loader.Load(context.Background(), key)
+			if err != nil {
+				t.Errorf("load %d: %v", key, err)
+			}
+			if found != (key%2 == 0) || (found && value != "even") {
+				t.Errorf("load %d = %q, %v", key, value, found)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("fetched %v, want the three distinct keys in one batch", batches)
+	}
+	if _, _, err := loader.Load(context.Background(), 2); err != nil || len(batches) != 1 {
+		t.Errorf("loading a fetched key again fetched it again")
+	}
+}
+
+func TestLoadSplitsFullBatches(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	loader := New(func(keys []int) (map[int]int, error) {
+		mu.Lock()
+		sizes = append(sizes, len(keys))
+		mu.Unlock()
+		return map[int]int{}, nil
+	}, 10*time.Millisecond, 2)
+
+	var wg sync.WaitGroup
+	for key := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loader.Load(context.Background(), key)
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, size := range sizes {
+		if size > 2 {
+			t.Errorf("fetched a batch of %d keys, more than the maximum of 2", size)
+		}
+		total += size
+	}
+	if total != 5 {
+		t.Errorf("fetched %d keys, want 5", total)
+	}
+}
+
+func TestLoadRetriesAfterAFailedFetch(t *testing.T) {
+	calls := 0
+	loader := New(func(keys []int) (map[int]int, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return map[int]int{1: 1}, nil
+	}, time.Millisecond, 100)
+
+	if _, _, err := loader.Load(context.Background(), 1); err == nil {
+		t.Fatal("first load succeeded, want the fetch error")
+	}
+	if value, found, err := loader.Load(context.Background(), 1); err != nil || !found || value != 1 {
+		t.Errorf("second load = %d, %v, %v; want 1 found", value, found, err)
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	canaryKey       = "encryption_canary"
+	canaryPlaintext = "talkify-encryption-canary"
+)
+
+var (
+	// ErrEncryptionKeyMismatch means the configured key cannot read data written by a previous run
+	ErrEncryptionKeyMismatch = errors.New("encryption key does not match the key the database was encrypted with")
+	// ErrEncryptionModeMismatch means the database was started in plaintext mode and is now
+	// given a key, or the other way round. Going on would leave data half encrypted.
+	ErrEncryptionModeMismatch = errors.New("encryption mode does not match the mode the database was started in")
+	// ErrCanaryUnavailable means the app_metadata table has not been created yet
+	ErrCanaryUnavailable = errors.New("app_metadata table does not exist")
+)
+
+// VerifyEncryptionCanary decrypts a known value stored in the database to make sure
+// the loaded key is the one existing rows were encrypted with. The canary is written
+// on first start, in plaintext in plaintext mode, so it also records the mode.
+func VerifyEncryptionCanary(db *sqlx.DB, encryptor encryption.Encryptor) error {
+	var exists bool
+	if err := db.Get(&exists, `SELECT to_regclass('public.app_metadata') IS NOT NULL`); err != nil {
+		return fmt.Errorf("failed to look up app_metadata: %w", err)
+	}
+	if !exists {
+		return ErrCanaryUnavailable
+	}
+
+	var stored string
+	err := db.Get(&stored, `SELECT value FROM app_metadata WHERE key = $1`, canaryKey)
+	if err == sql.ErrNoRows {
+		encrypted, err := encryptor.EncryptString(canaryPlaintext)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt canary: %w", err)
+		}
+		_, err = db.Exec(`
+			INSERT INTO app_metadata (key, value) VALUES ($1, $2)
+			ON CONFLICT (key) DO NOTHING`, canaryKey, encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to store canary: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read canary: %w", err)
+	}
+
+	decrypted, err := encryptor.DecryptString(stored)
+	if err == nil && decrypted == canaryPlaintext {
+		return nil
+	}
+	if (stored == canaryPlaintext) != encryption.IsPlaintext(encryptor) {
+		return ErrEncryptionModeMismatch
+	}
+	return ErrEncryptionKeyMismatch
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	initialRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 5 * time.Second
+)
+
+// Connect opens the database, retrying with exponential backoff until it answers
+// or maxWait has passed. This lets the API start alongside a database that is
+// still booting, e.g. under docker-compose.
+func Connect(cfg *config.DatabaseConfig, maxWait time.Duration) (*sqlx.DB, error) {
+	deadline := time.Now().Add(maxWait)
+	delay := initialRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		db, err := open(cfg)
+		if err == nil {
+			return db, nil
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("database not reachable after %d attempts over %s: %w", attempt, maxWait, err)
+		}
+
+		logger.Warn("Database not ready, retrying", map[string]interface{}{
+			"attempt":  attempt,
+			"retry_in": delay.String(),
+			"host":     cfg.Host,
+			"port":     cfg.Port,
+			"error":    err.Error(),
+		})
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// open connects once, logging queries when the configuration asks for it
+func open(cfg *config.DatabaseConfig) (*sqlx.DB, error) {
+	if cfg.LogQueries {
+		return openLogged(cfg)
+	}
+	return sqlx.Connect("postgres", cfg.DSN())
+}
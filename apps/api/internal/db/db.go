@@ -14,8 +14,9 @@ type DB struct {
 	*sqlx.DB
 }
 
+// New connects using the shared database configuration, retrying for up to cfg.StartupMaxWait
 func New(cfg *config.DatabaseConfig) (*DB, error) {
-	db, err := sqlx.Connect("postgres", cfg.DSN())
+	db, err := Connect(cfg, cfg.StartupMaxWait)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to the database: %w", err)
 	}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrMigrationsDirty   = errors.New("database migrations are in a dirty state")
+	ErrMigrationsPending = errors.New("database migrations are pending")
+)
+
+// MigrationStatus describes the applied schema version against the migration files
+type MigrationStatus struct {
+	Current int64
+	Latest  int64
+	Dirty   bool
+	Tracked bool
+}
+
+// LatestMigration returns the highest version among the NNNNNN_name.up.sql files in dir
+func LatestMigration(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, found := strings.Cut(name, "_")
+		if !found {
+			continue
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// GetMigrationStatus reads the version recorded by golang-migrate in schema_migrations.
+// Tracked is false when the table does not exist, e.g. when the schema was loaded from init.sql.
+func GetMigrationStatus(db *sqlx.DB, dir string) (*MigrationStatus, error) {
+	latest, err := LatestMigration(dir)
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{Latest: latest}
+
+	var exists bool
+	if err := db.Get(&exists, `SELECT to_regclass('public.schema_migrations') IS NOT NULL`); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	if !exists {
+		return status, nil
+	}
+	status.Tracked = true
+
+	err = db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&status.Current, &status.Dirty)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return status, nil
+}
+
+// CheckMigrations fails when the recorded schema is dirty or behind the migration files
+func CheckMigrations(db *sqlx.DB, dir string) (*MigrationStatus, error) {
+	status, err := GetMigrationStatus(db, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Tracked {
+		return status, nil
+	}
+	if status.Dirty {
+		return status, fmt.Errorf("%w at version %d", ErrMigrationsDirty, status.Current)
+	}
+	if status.Current < status.Latest {
+		return status, fmt.Errorf("%w: at version %d, latest is %d", ErrMigrationsPending, status.Current, status.Latest)
+	}
+	return status, nil
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxLoggedArgLength is how much of a text argument is logged
+	maxLoggedArgLength = 200
+	// explainTimeout bounds each EXPLAIN ANALYZE, which runs the query again
+	explainTimeout = 30 * time.Second
+	// maxPendingExplains is how many explains may wait their turn; others are skipped
+	maxPendingExplains = 8
+)
+
+var (
+	// sensitiveColumn matches columns whose values are never logged
+	sensitiveColumn = regexp.MustCompile(`(?i)(password|secret|token|hash|key|otp|recovery|code)`)
+	// comparedColumn finds columns compared with a placeholder, as in "token_hash = $2"
+	comparedColumn = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.]*)\s*(?:=|<>|!=)\s*\$(\d+)`)
+	// insertColumns finds the columns and values of an insert
+	insertColumns = regexp.MustCompile(`(?is)INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES\s*\(`)
+	placeholder   = regexp.MustCompile(`\$(\d+)`)
+	// readOnly matches the queries that are safe to run again with EXPLAIN ANALYZE
+	readOnly  = regexp.MustCompile(`(?is)^\s*(SELECT|WITH)\b`)
+	modifying = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|FOR\s+UPDATE|FOR\s+SHARE|nextval|pg_advisory)`)
+)
+
+// openLogged opens the database with every query logged, for development. A separate
+// connection explains a sample of the slow queries.
+func openLogged(cfg *config.DatabaseConfig) (*sqlx.DB, error) {
+	connector, err := pq.NewConnector(cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	explainer := sql.OpenDB(connector)
+	explainer.SetMaxOpenConns(1)
+
+	q := &queryLogger{
+		Connector: connector,
+		threshold: cfg.ExplainThreshold,
+		percent:   cfg.ExplainSamplePercent,
+		explainer: explainer,
+		explains:  make(chan explainRequest, maxPendingExplains),
+	}
+	go q.explainLoop()
+
+	db := sqlx.NewDb(sql.OpenDB(q), "postgres")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		explainer.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// queryLogger wraps the connections of a connector to log their queries
+type queryLogger struct {
+	driver.Connector
+	threshold time.Duration
+	percent   int
+	explainer *sql.DB
+	explains  chan explainRequest
+}
+
+type explainRequest struct {
+	query string
+	args  []interface{}
+}
+
+func (q *queryLogger) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := q.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedConn{conn: conn, logger: q}, nil
+}
+
+// log records a query and, when it was slow, may have it explained
+func (q *queryLogger) log(query string, args []driver.NamedValue, took time.Duration, err error) {
+	fields := map[string]interface{}{
+		"query":       compactQuery(query),
+		"args":        redactArgs(query, args),
+		"duration_ms": float64(took.Microseconds()) / 1000,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	logger.Debug("Database query", fields)
+
+	if err != nil || q.threshold <= 0 || took < q.threshold || !explainable(query) {
+		return
+	}
+	if rand.IntN(100) >= q.percent {
+		return
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	select {
+	case q.explains <- explainRequest{query: query, args: values}:
+	default:
+	}
+}
+
+// explainLoop runs EXPLAIN ANALYZE for the sampled slow queries one at a time, off the
+// connections that serve requests
+func (q *queryLogger) explainLoop() {
+	for req := range q.explains {
+		ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+		rows, err := q.explainer.QueryContext(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+req.query, req.args...)
+		if err != nil {
+			cancel()
+			logger.Warn("Failed to explain slow query", map[string]interface{}{
+				"query": compactQuery(req.query),
+				"error": err.Error(),
+			})
+			continue
+		}
+		var plan []string
+		for rows.Next() {
+			var line string
+			if rows.Scan(&line) == nil {
+				plan = append(plan, line)
+			}
+		}
+		rows.Close()
+		cancel()
+		logger.Info("Slow query plan", map[string]interface{}{
+			"query": compactQuery(req.query),
+			"plan":  strings.Join(plan, "\n"),
+		})
+	}
+}
+
+// loggedConn logs the queries run on a connection. Queries run through prepared
+// statements are not logged.
+type loggedConn struct {
+	conn   driver.Conn
+	logger *queryLogger
+}
+
+func (c *loggedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.logger.log(query, args, time.Since(start), err)
+	}
+	return rows, err
+}
+
+func (c *loggedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.logger.log(query, args, time.Since(start), err)
+	}
+	return result, err
+}
+
+func (c *loggedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(query)
+}
+
+func (c *loggedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.conn.Prepare(query)
+}
+
+func (c *loggedConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *loggedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *loggedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *loggedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *loggedConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *loggedConn) Close() error {
+	return c.conn.Close()
+}
+
+// explainable reports whether a query only reads, so running it again is harmless
+func explainable(query string) bool {
+	return readOnly.MatchString(query) && !modifying.MatchString(query)
+}
+
+// compactQuery puts a query on one line
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// redactArgs formats the arguments of a query for the log, hiding those bound to
+// sensitive columns and shortening long ones
+func redactArgs(query string, args []driver.NamedValue) []string {
+	hidden := sensitivePlaceholders(query)
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		switch value := arg.Value.(type) {
+		case nil:
+			formatted[i] = "NULL"
+		case []byte:
+			formatted[i] = fmt.Sprintf("<%d bytes>", len(value))
+		case string:
+			if len(value) > maxLoggedArgLength {
+				value = value[:maxLoggedArgLength] + "…"
+			}
+			formatted[i] = strconv.Quote(value)
+		case time.Time:
+			formatted[i] = value.Format(time.RFC3339Nano)
+		default:
+			formatted[i] = fmt.Sprint(value)
+		}
+		if hidden[arg.Ordinal] {
+			formatted[i] = "[REDACTED]"
+		}
+	}
+	return formatted
+}
+
+// sensitivePlaceholders returns the placeholders of a query bound to sensitive
+// columns, by comparison or by an insert's column list
+func sensitivePlaceholders(query string) map[int]bool {
+	hidden := make(map[int]bool)
+	for _, match := range comparedColumn.FindAllStringSubmatch(query, -1) {
+		if sensitiveColumn.MatchString(match[1]) {
+			n, _ := strconv.Atoi(match[2])
+			hidden[n] = true
+		}
+	}
+
+	loc := insertColumns.FindStringSubmatchIndex(query)
+	if loc == nil {
+		return hidden
+	}
+	columns := strings.Split(query[loc[2]:loc[3]], ",")
+	values := splitValues(query[loc[1]:])
+	for i, column := range columns {
+		if i >= len(values) || !sensitiveColumn.MatchString(column) {
+			continue
+		}
+		for _, match := range placeholder.FindAllStringSubmatch(values[i], -1) {
+			n, _ := strconv.Atoi(match[1])
+			hidden[n] = true
+		}
+	}
+	return hidden
+}
+
+// splitValues splits the value list of an insert, which starts after its opening
+// parenthesis, at the commas outside nested parentheses
+func splitValues(list string) []string {
+	var values []string
+	depth, start := 0, 0
+	for i, r := range list {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return append(values, list[start:i])
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				values = append(values, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(values, list[start:])
+}
@@ -0,0 +1,178 @@
+// Package delivery tracks whether the conversation events pushed to users' WebSocket
+// connections were acknowledged in time, so missed ones can be sent again another way and
+// administrators can see how delivery is going for a user. Like the event log it is
+// kept in memory, per process.
+package delivery
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery is a conversation event pushed to a user that awaits acknowledgment
+type Delivery struct {
+	UserID         string    `json:"-"`
+	EventID        uint64    `json:"event_id"`
+	ConversationID string    `json:"conversation_id"`
+	Type           string    `json:"type"`
+	SentAt         time.Time `json:"sent_at"`
+	// MessageID is set on new message events
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// Health sums up delivery to one user since the process started
+type Health struct {
+	UserID       string `json:"user_id"`
+	Sent         int    `json:"sent"`
+	Acknowledged int    `json:"acknowledged"`
+	// Missed deliveries were not acknowledged within the timeout; Resent of them went
+	// out again through another channel
+	Missed  int `json:"missed"`
+	Resent  int `json:"resent"`
+	Pending int `json:"pending"`
+	// AverageAckMillis is how long acknowledged deliveries took on average
+	AverageAckMillis   int64      `json:"average_ack_ms"`
+	LastSentAt         *time.Time `json:"last_sent_at,omitempty"`
+	LastAcknowledgedAt *time.Time `json:"last_acknowledged_at,omitempty"`
+	LastMissedAt       *time.Time `json:"last_missed_at,omitempty"`
+}
+
+type key struct {
+	userID  string
+	eventID uint64
+}
+
+// userStats is what Health is built from
+type userStats struct {
+	sent, acknowledged, missed, resent int
+	ackTotal                           time.Duration
+	lastSent, lastAcknowledged         time.Time
+	lastMissed                         time.Time
+}
+
+// Tracker follows deliveries until they are acknowledged or time out
+type Tracker struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[key]Delivery
+	users   map[string]*userStats
+}
+
+// NewTracker creates a tracker whose deliveries time out after timeout
+func NewTracker(timeout time.Duration) *Tracker {
+	return &Tracker{
+		timeout: timeout,
+		pending: make(map[key]Delivery),
+		users:   make(map[string]*userStats),
+	}
+}
+
+// Sent records a delivery that the user is expected to acknowledge
+func (t *Tracker) Sent(d Delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending[key{d.UserID, d.EventID}] = d
+	stats := t.stats(d.UserID)
+	stats.sent++
+	stats.lastSent = d.SentAt
+}
+
+// Acknowledge records that the user received an event and returns its delivery. It
+// reports false for events that weren't pending, such as ones already given up on.
+func (t *Tracker) Acknowledge(userID string, eventID uint64) (Delivery, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.pending[key{userID, eventID}]
+	if !ok {
+		return Delivery{}, false
+	}
+	delete(t.pending, key{userID, eventID})
+
+	now := time.Now()
+	stats := t.stats(userID)
+	stats.acknowledged++
+	stats.ackTotal += now.Sub(d.SentAt)
+	stats.lastAcknowledged = now
+	return d, true
+}
+
+// Expired removes and returns the deliveries not acknowledged within the timeout,
+// oldest first, counting them as missed
+func (t *Tracker) Expired(now time.Time) []Delivery {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired []Delivery
+	for k, d := range t.pending {
+		if now.Sub(d.SentAt) < t.timeout {
+			continue
+		}
+		delete(t.pending, k)
+		expired = append(expired, d)
+
+		stats := t.stats(d.UserID)
+		stats.missed++
+		stats.lastMissed = now
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].SentAt.Before(expired[j].SentAt) })
+	return expired
+}
+
+// Resent records that a missed delivery went out again through another channel
+func (t *Tracker) Resent(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats(userID).resent++
+}
+
+// Health sums up delivery to a user, along with the deliveries still pending, oldest
+// first
+func (t *Tracker) Health(userID string) (Health, []Delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := []Delivery{}
+	for k, d := range t.pending {
+		if k.userID == userID {
+			pending = append(pending, d)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].SentAt.Before(pending[j].SentAt) })
+
+	health := Health{UserID: userID, Pending: len(pending)}
+	stats, ok := t.users[userID]
+	if !ok {
+		return health, pending
+	}
+	health.Sent = stats.sent
+	health.Acknowledged = stats.acknowledged
+	health.Missed = stats.missed
+	health.Resent = stats.resent
+	if stats.acknowledged > 0 {
+		health.AverageAckMillis = (stats.ackTotal / time.Duration(stats.acknowledged)).Milliseconds()
+	}
+	health.LastSentAt = timePtr(stats.lastSent)
+	health.LastAcknowledgedAt = timePtr(stats.lastAcknowledged)
+	health.LastMissedAt = timePtr(stats.lastMissed)
+	return health, pending
+}
+
+func (t *Tracker) stats(userID string) *userStats {
+	stats, ok := t.users[userID]
+	if !ok {
+		stats = &userStats{}
+		t.users[userID] = stats
+	}
+	return stats
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
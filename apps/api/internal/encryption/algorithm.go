@@ -0,0 +1,56 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithms data can be encrypted with
+const (
+	AlgorithmAESGCM            = "aes-gcm"
+	AlgorithmXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// Encrypted data is stored as $<algorithm>$<base64 of nonce and ciphertext>, so that
+// the algorithm can change without rewriting what was encrypted before. Base64 has no
+// $, so data without a tag, written before algorithms were named, is AES-GCM.
+const algorithmTag = "$"
+
+// newAEAD returns the cipher of algorithm with key
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case AlgorithmAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmXChaCha20Poly1305:
+		// Its 24-byte nonces can be random without a limit on how many a key encrypts
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unknown encryption algorithm %q", algorithm)
+	}
+}
+
+// tag prefixes encrypted data with its algorithm
+func tag(algorithm, encoded string) string {
+	return algorithmTag + algorithm + algorithmTag + encoded
+}
+
+// untag splits encrypted data into its algorithm and encoded ciphertext
+func untag(encrypted string) (algorithm, encoded string) {
+	rest, ok := strings.CutPrefix(encrypted, algorithmTag)
+	if !ok {
+		return AlgorithmAESGCM, encrypted
+	}
+	algorithm, encoded, ok = strings.Cut(rest, algorithmTag)
+	if !ok {
+		return "", encrypted
+	}
+	return algorithm, encoded
+}
@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// blobChunkSize is how much plaintext each sealed chunk of a blob holds
+const blobChunkSize = 64 * 1024
+
+// ErrWrongKey is returned when a blob's data key was wrapped with a different master key
+var ErrWrongKey = errors.New("data key was wrapped with another key")
+
+// KeyID identifies the master key, so data wrapped with it can be told apart from
+// data wrapped with a key it has since been rotated to
+func (m *Manager) KeyID() string {
+	sum := sha256.Sum256(m.key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewDataKey generates a key for one blob and returns it along with its wrapped form
+// for storage
+func (m *Manager) NewDataKey() (key []byte, wrapped string, err error) {
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", ErrKeyGeneration
+	}
+	wrapped, err = m.Encrypt(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, wrapped, nil
+}
+
+// UnwrapDataKey returns the data key of a blob from its wrapped form and the ID of
+// the key that wrapped it
+func (m *Manager) UnwrapDataKey(wrapped, keyID string) ([]byte, error) {
+	if keyID != m.KeyID() {
+		return nil, ErrWrongKey
+	}
+	key, err := m.Decrypt(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, ErrInvalidKeySize
+	}
+	return key, nil
+}
+
+// Blobs are split into chunks sealed with AES-GCM. Each data key encrypts a single
+// blob, so nonces are the chunk index, with the last chunk marked to detect truncation.
+func blobNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func blobCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// BlobWriter encrypts a blob as it is written. Close must be called to seal the last
+// chunk; it does not close the underlying writer.
+type BlobWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// NewBlobWriter encrypts everything written to it with key into w
+func NewBlobWriter(w io.Writer, key []byte) (*BlobWriter, error) {
+	aead, err := blobCipher(key)
+	if err != nil {
+		return nil, ErrEncryption
+	}
+	return &BlobWriter{w: w, aead: aead, buf: make([]byte, 0, blobChunkSize)}, nil
+}
+
+// Write encrypts p
+func (bw *BlobWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so the last chunk is
+		// always the one sealed by Close
+		if len(bw.buf) == blobChunkSize {
+			if err := bw.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(bw.buf[len(bw.buf):blobChunkSize], p)
+		bw.buf = bw.buf[:len(bw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk
+func (bw *BlobWriter) Close() error {
+	return bw.seal(true)
+}
+
+func (bw *BlobWriter) seal(last bool) error {
+	sealed := bw.aead.Seal(nil, blobNonce(bw.index, last), bw.buf, nil)
+	if _, err := bw.w.Write(sealed); err != nil {
+		return err
+	}
+	bw.index++
+	bw.buf = bw.buf[:0]
+	return nil
+}
+
+// BlobReader decrypts a blob written by a BlobWriter
+type BlobReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	chunk []byte
+	plain []byte
+	index uint64
+	done  bool
+}
+
+// NewBlobReader decrypts the blob read from r with key
+func NewBlobReader(r io.Reader, key []byte) (*BlobReader, error) {
+	aead, err := blobCipher(key)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return &BlobReader{
+		r:     bufio.NewReader(r),
+		aead:  aead,
+		chunk: make([]byte, blobChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Read decrypts into p. A blob that was cut short or altered fails with ErrDecryption.
+func (br *BlobReader) Read(p []byte) (int, error) {
+	for len(br.plain) == 0 {
+		if br.done {
+			return 0, io.EOF
+		}
+		if err := br.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, br.plain)
+	br.plain = br.plain[n:]
+	return n, nil
+}
+
+func (br *BlobReader) open() error {
+	n, err := io.ReadFull(br.r, br.chunk)
+	last := false
+	switch err {
+	case nil:
+		// A full chunk is the last one only if nothing follows it
+		if _, err := br.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF, io.EOF:
+		last = true
+	default:
+		return err
+	}
+
+	plain, err := br.aead.Open(br.chunk[:0], blobNonce(br.index, last), br.chunk[:n], nil)
+	if err != nil {
+		return ErrDecryption
+	}
+	br.plain = plain
+	br.index++
+	br.done = last
+	return nil
+}
@@ -1,10 +1,11 @@
 package encryption
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
 )
@@ -21,9 +22,13 @@ var (
 // Manager handles encryption and decryption operations
 type Manager struct {
 	key []byte
+	// algorithm new data is encrypted with. Empty writes the untagged AES-GCM format
+	// used before algorithms were named; see NewManagerWith.
+	algorithm string
 }
 
-// NewManager creates a new encryption manager with the given key
+// NewManager creates a new encryption manager with the given key. It encrypts with
+// AES-GCM in the untagged format, for data whose readers don't know of algorithms.
 func NewManager(key []byte) (*Manager, error) {
 	if len(key) != 32 {
 		return nil, ErrInvalidKeySize
@@ -31,60 +36,79 @@ func NewManager(key []byte) (*Manager, error) {
 	return &Manager{key: key}, nil
 }
 
-// Encrypt encrypts data using AES-GCM
+// NewManagerWith creates an encryption manager that encrypts with algorithm and tags
+// what it encrypts with it. It decrypts data encrypted with any algorithm.
+func NewManagerWith(key []byte, algorithm string) (*Manager, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKeySize
+	}
+	if _, err := newAEAD(algorithm, key); err != nil {
+		return nil, err
+	}
+	return &Manager{key: key, algorithm: algorithm}, nil
+}
+
+// Derive returns a manager with a subkey of this manager's key for purpose, so that
+// data kept for different purposes is never encrypted under the same key
+func (m *Manager) Derive(purpose string) Encryptor {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(purpose))
+	return &Manager{key: mac.Sum(nil), algorithm: m.algorithm}
+}
+
+// Encrypt encrypts data with the manager's algorithm
 func (m *Manager) Encrypt(plaintext []byte) (string, error) {
-	block, err := aes.NewCipher(m.key)
+	algorithm := m.algorithm
+	if algorithm == "" {
+		algorithm = AlgorithmAESGCM
+	}
+	aead, err := newAEAD(algorithm, m.key)
 	if err != nil {
 		return "", ErrEncryption
 	}
 
-	// Never use more than 2^32 random nonces with a given key
-	nonce := make([]byte, 12)
+	// Nonces are random: with AES-GCM, never use more than 2^32 of them with a given key
+	nonce := make([]byte, aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", ErrEncryption
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", ErrEncryption
-	}
-
 	// Encrypt and append nonce
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
+	ciphertext := aead.Seal(nil, nonce, plaintext, nil)
 	encryptedData := append(nonce, ciphertext...)
 
 	// Convert to base64 for storage
-	return base64.StdEncoding.EncodeToString(encryptedData), nil
+	encoded := base64.StdEncoding.EncodeToString(encryptedData)
+	if m.algorithm == "" {
+		return encoded, nil
+	}
+	return tag(m.algorithm, encoded), nil
 }
 
-// Decrypt decrypts data using AES-GCM
+// Decrypt decrypts data encrypted with any algorithm, as told by its tag
 func (m *Manager) Decrypt(encryptedString string) ([]byte, error) {
-	// Decode base64
-	encryptedData, err := base64.StdEncoding.DecodeString(encryptedString)
+	algorithm, encoded := untag(encryptedString)
+	aead, err := newAEAD(algorithm, m.key)
 	if err != nil {
 		return nil, ErrDecryption
 	}
 
-	if len(encryptedData) < 12 {
-		return nil, ErrDecryption
-	}
-
-	block, err := aes.NewCipher(m.key)
+	// Decode base64
+	encryptedData, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, ErrDecryption
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
+	if len(encryptedData) < aead.NonceSize() {
 		return nil, ErrDecryption
 	}
 
 	// Extract nonce and ciphertext
-	nonce := encryptedData[:12]
-	ciphertext := encryptedData[12:]
+	nonce := encryptedData[:aead.NonceSize()]
+	ciphertext := encryptedData[aead.NonceSize():]
 
 	// Decrypt
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		return nil, ErrDecryption
 	}
@@ -92,6 +116,15 @@ func (m *Manager) Decrypt(encryptedString string) ([]byte, error) {
 	return plaintext, nil
 }
 
+// KeyVersion names the algorithm and key new data is encrypted with
+func (m *Manager) KeyVersion() string {
+	algorithm := m.algorithm
+	if algorithm == "" {
+		algorithm = AlgorithmAESGCM
+	}
+	return algorithm + "/" + m.KeyID()
+}
+
 // EncryptString is a helper function to encrypt string data
 func (m *Manager) EncryptString(plaintext string) (string, error) {
 	return m.Encrypt([]byte(plaintext))
@@ -105,3 +138,11 @@ func (m *Manager) DecryptString(encryptedString string) (string, error) {
 	}
 	return string(decrypted), nil
 }
+
+// Index returns a keyed hash of value, so that encrypted values can be looked up by
+// equality without decrypting them. Use a derived manager to keep indexes apart.
+func (m *Manager) Index(value string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Modes data can be stored in: encrypted with an algorithm, or as it is
+const (
+	// ModeAESGCM and ModeXChaCha20Poly1305 encrypt data with the key in the key file.
+	// Data encrypted in either mode is read in both, so a database can switch between them.
+	ModeAESGCM            = AlgorithmAESGCM
+	ModeXChaCha20Poly1305 = AlgorithmXChaCha20Poly1305
+	// ModePlaintext stores data as it is, for development without a key
+	ModePlaintext = "plaintext"
+)
+
+// plaintextKeyID is the KeyID of NoopEncryptor
+const plaintextKeyID = "plaintext"
+
+// Encryptor encrypts data for storage. Services use it whatever the mode, so none of
+// them decide on their own whether data is encrypted.
+type Encryptor interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(encryptedString string) ([]byte, error)
+	EncryptString(plaintext string) (string, error)
+	DecryptString(encryptedString string) (string, error)
+	// Derive returns an encryptor for data kept for purpose
+	Derive(purpose string) Encryptor
+	// Index returns a keyed hash of value to look it up by
+	Index(value string) string
+	// KeyVersion names the algorithm and key new data is encrypted with
+	KeyVersion() string
+	// KeyID, NewDataKey and UnwrapDataKey manage the keys of blobs
+	KeyID() string
+	NewDataKey() (key []byte, wrapped string, err error)
+	UnwrapDataKey(wrapped, keyID string) ([]byte, error)
+}
+
+// NewEncryptor returns the encryptor for mode, loading or generating the key in keyFile
+// when the mode encrypts
+func NewEncryptor(mode, keyFile string) (Encryptor, error) {
+	switch mode {
+	case ModeAESGCM, ModeXChaCha20Poly1305, "":
+		if mode == "" {
+			mode = ModeAESGCM
+		}
+		keyManager, err := NewKeyManager(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewManagerWith(keyManager.GetKey(), mode)
+	case ModePlaintext:
+		return NoopEncryptor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %q", mode)
+	}
+}
+
+// IsPlaintext reports whether e stores data as it is
+func IsPlaintext(e Encryptor) bool {
+	return e.KeyID() == plaintextKeyID
+}
+
+// NoopEncryptor is the encryptor of plaintext mode. Values are stored as they are, but
+// indexes stay keyed by purpose so that they can be compared like those of a Manager.
+// Blobs are still sealed, with data keys stored unwrapped.
+type NoopEncryptor struct {
+	purpose string
+}
+
+func (n NoopEncryptor) Encrypt(plaintext []byte) (string, error) {
+	return string(plaintext), nil
+}
+
+func (n NoopEncryptor) Decrypt(encryptedString string) ([]byte, error) {
+	return []byte(encryptedString), nil
+}
+
+func (n NoopEncryptor) EncryptString(plaintext string) (string, error) {
+	return plaintext, nil
+}
+
+func (n NoopEncryptor) DecryptString(encryptedString string) (string, error) {
+	return encryptedString, nil
+}
+
+func (n NoopEncryptor) Derive(purpose string) Encryptor {
+	return NoopEncryptor{purpose: n.purpose + "/" + purpose}
+}
+
+func (n NoopEncryptor) Index(value string) string {
+	mac := hmac.New(sha256.New, []byte(n.purpose))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n NoopEncryptor) KeyVersion() string {
+	return plaintextKeyID
+}
+
+func (n NoopEncryptor) KeyID() string {
+	return plaintextKeyID
+}
+
+func (n NoopEncryptor) NewDataKey() (key []byte, wrapped string, err error) {
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", ErrKeyGeneration
+	}
+	return key, hex.EncodeToString(key), nil
+}
+
+func (n NoopEncryptor) UnwrapDataKey(wrapped, keyID string) ([]byte, error) {
+	if keyID != plaintextKeyID {
+		return nil, ErrWrongKey
+	}
+	key, err := hex.DecodeString(wrapped)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKeySize
+	}
+	return key, nil
+}
@@ -0,0 +1,65 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+// benchMessageSize is the length of the content encrypted by the benchmarks, that of a
+// longish chat message
+const benchMessageSize = 256
+
+// benchAlgorithms are the algorithms benchmarked, in the order they are run
+var benchAlgorithms = []string{AlgorithmAESGCM, AlgorithmXChaCha20Poly1305}
+
+// benchManagers returns a manager for each algorithm, with the same random key
+func benchManagers(b *testing.B) map[string]*Manager {
+	key := make([]byte, 32)
+	rand.Read(key)
+	managers := map[string]*Manager{}
+	for _, algorithm := range benchAlgorithms {
+		manager, err := NewManagerWith(key, algorithm)
+		if err != nil {
+			b.Fatal(err)
+		}
+		managers[algorithm] = manager
+	}
+	return managers
+}
+
+func BenchmarkEncryptString(b *testing.B) {
+	content := strings.Repeat("a", benchMessageSize)
+	managers := benchManagers(b)
+	for _, algorithm := range benchAlgorithms {
+		manager := managers[algorithm]
+		b.Run(algorithm, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := manager.EncryptString(content); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptString(b *testing.B) {
+	content := strings.Repeat("a", benchMessageSize)
+	managers := benchManagers(b)
+	for _, algorithm := range benchAlgorithms {
+		manager := managers[algorithm]
+		encrypted, err := manager.EncryptString(content)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(algorithm, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := manager.DecryptString(encrypted); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Package reporting forwards errors to Sentry or a Sentry-compatible error
+// aggregator. It is disabled unless a DSN is configured.
+package reporting
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Level is the severity of a reported event
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+// Event is a single error report
+type Event struct {
+	ID          string
+	Timestamp   time.Time
+	Level       Level
+	Message     string
+	Error       string
+	ErrorType   string
+	Stack       string
+	RequestID   string
+	UserID      string
+	Method      string
+	URL         string
+	Release     string
+	Environment string
+	Tags        map[string]string
+	Extra       map[string]interface{}
+}
+
+// Sink delivers events to an error aggregator
+type Sink interface {
+	Send(event *Event) error
+}
+
+// Config configures a Reporter
+type Config struct {
+	DSN         string
+	Environment string
+	Release     string
+	QueueSize   int
+}
+
+// Reporter queues events and delivers them to a sink in the background so that
+// reporting never blocks a request. Events are dropped when the queue is full.
+type Reporter struct {
+	sink        Sink
+	release     string
+	environment string
+	events      chan *Event
+	wg          sync.WaitGroup
+	mu          sync.RWMutex
+	closed      bool
+}
+
+// New creates a reporter for cfg. It returns nil when no DSN is configured;
+// a nil *Reporter is safe to use and discards everything.
+func New(cfg Config) (*Reporter, error) {
+	if cfg.DSN == "" {
+		return nil, nil
+	}
+
+	sink, err := NewSentrySink(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithSink(sink, cfg), nil
+}
+
+// NewWithSink creates a reporter delivering to sink
+func NewWithSink(sink Sink, cfg Config) *Reporter {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+
+	r := &Reporter{
+		sink:        sink,
+		release:     cfg.Release,
+		environment: cfg.Environment,
+		events:      make(chan *Event, queueSize),
+	}
+
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// Capture queues an event, filling in the ID, timestamp, release and environment
+func (r *Reporter) Capture(event *Event) {
+	if r == nil {
+		return
+	}
+
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Level == "" {
+		event.Level = LevelError
+	}
+	event.Release = r.release
+	event.Environment = r.environment
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		fmt.Fprintln(os.Stderr, "reporting: queue full, dropping event")
+	}
+}
+
+// CaptureLog reports an error logged through logger.Error. The request_id, user_id,
+// method, path and stack fields are lifted out of fields into the event.
+func (r *Reporter) CaptureLog(msg string, err error, fields map[string]interface{}) {
+	if r == nil {
+		return
+	}
+
+	event := &Event{
+		Message: msg,
+		Extra:   make(map[string]interface{}),
+	}
+	if err != nil {
+		event.Error = err.Error()
+		event.ErrorType = fmt.Sprintf("%T", err)
+	}
+
+	for k, v := range fields {
+		switch k {
+		case "request_id":
+			event.RequestID = fmt.Sprint(v)
+		case "user_id":
+			event.UserID = fmt.Sprint(v)
+		case "method":
+			event.Method = fmt.Sprint(v)
+		case "path":
+			event.URL = fmt.Sprint(v)
+		case "stack":
+			event.Stack = fmt.Sprint(v)
+		default:
+			event.Extra[k] = jsonSafe(v)
+		}
+	}
+
+	r.Capture(event)
+}
+
+// ReportPanic reports a panic recovered by the server's recovery middleware
+func (r *Reporter) ReportPanic(c *gin.Context, value interface{}, stack []byte) {
+	if r == nil {
+		return
+	}
+
+	event := &Event{
+		Level:     LevelFatal,
+		Message:   "Recovered from panic",
+		Error:     fmt.Sprint(value),
+		ErrorType: "panic",
+		Stack:     string(stack),
+		RequestID: c.GetString(logger.RequestIDKey),
+		Method:    c.Request.Method,
+		URL:       c.Request.URL.String(),
+		Tags: map[string]string{
+			"route": c.FullPath(),
+		},
+		Extra: map[string]interface{}{
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+		},
+	}
+	if userID, ok := c.Get("userID"); ok {
+		event.UserID = fmt.Sprint(userID)
+	}
+
+	r.Capture(event)
+}
+
+// Close stops accepting events and waits up to timeout for queued ones to be delivered
+func (r *Reporter) Close(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Fprintln(os.Stderr, "reporting: timed out flushing events")
+	}
+}
+
+func (r *Reporter) run() {
+	defer r.wg.Done()
+
+	// Delivery failures go to stderr rather than the logger, which would report them again
+	for event := range r.events {
+		if err := r.sink.Send(event); err != nil {
+			fmt.Fprintf(os.Stderr, "reporting: failed to send event %s: %v\n", event.ID, err)
+		}
+	}
+}
+
+// jsonSafe turns values that do not marshal usefully into strings
+func jsonSafe(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return v
+	}
+}
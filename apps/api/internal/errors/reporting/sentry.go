@@ -0,0 +1,138 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// SentrySink sends events to the store endpoint of Sentry or any server speaking its protocol
+type SentrySink struct {
+	endpoint   string
+	publicKey  string
+	secretKey  string
+	serverName string
+	client     *http.Client
+}
+
+// NewSentrySink parses a DSN of the form https://<key>@<host>/<project_id>
+func NewSentrySink(dsn string) (*SentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reporting DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("invalid reporting DSN: missing public key")
+	}
+	project := path.Base(u.Path)
+	if project == "" || project == "." || project == "/" {
+		return nil, errors.New("invalid reporting DSN: missing project ID")
+	}
+
+	secret, _ := u.User.Password()
+	prefix := strings.TrimSuffix(path.Dir(u.Path), "/")
+	hostname, _ := os.Hostname()
+
+	return &SentrySink{
+		endpoint:   fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		publicKey:  u.User.Username(),
+		secretKey:  secret,
+		serverName: hostname,
+		client:     &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// Send delivers a single event
+func (s *SentrySink) Send(event *Event) error {
+	body, err := json.Marshal(s.payload(event))
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.authHeader())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *SentrySink) authHeader() string {
+	header := fmt.Sprintf("Sentry sentry_version=7, sentry_client=talkify-api/1.0, sentry_key=%s", s.publicKey)
+	if s.secretKey != "" {
+		header += ", sentry_secret=" + s.secretKey
+	}
+	return header
+}
+
+func (s *SentrySink) payload(event *Event) map[string]interface{} {
+	tags := map[string]string{}
+	for k, v := range event.Tags {
+		tags[k] = v
+	}
+	if event.RequestID != "" {
+		tags["request_id"] = event.RequestID
+	}
+
+	extra := map[string]interface{}{}
+	for k, v := range event.Extra {
+		extra[k] = v
+	}
+	if event.Stack != "" {
+		extra["stack"] = event.Stack
+	}
+
+	payload := map[string]interface{}{
+		"event_id":    strings.ReplaceAll(event.ID, "-", ""),
+		"timestamp":   event.Timestamp.Format(time.RFC3339),
+		"level":       string(event.Level),
+		"platform":    "go",
+		"logger":      "talkify-api",
+		"server_name": s.serverName,
+		"release":     event.Release,
+		"environment": event.Environment,
+		"message":     map[string]string{"formatted": event.Message},
+		"tags":        tags,
+		"extra":       extra,
+	}
+
+	if event.Error != "" {
+		payload["exception"] = map[string]interface{}{
+			"values": []map[string]string{{
+				"type":  event.ErrorType,
+				"value": event.Error,
+			}},
+		}
+	}
+	if event.UserID != "" {
+		payload["user"] = map[string]string{"id": event.UserID}
+	}
+	if event.Method != "" || event.URL != "" {
+		payload["request"] = map[string]string{
+			"method": event.Method,
+			"url":    event.URL,
+		}
+	}
+
+	return payload
+}
@@ -0,0 +1,174 @@
+// Package eventlog keeps a short, in-memory history of the events pushed to each
+// conversation so clients that reconnect can catch up on what they missed instead of
+// reloading everything.
+package eventlog
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is an event pushed to the participants of a conversation. IDs increase
+// monotonically across all conversations and restart when the process does.
+type Event struct {
+	ID             uint64
+	ConversationID string
+	Data           []byte
+	At             time.Time
+}
+
+// Limits bound how much history the log keeps. Events are dropped once they are older
+// than Retention, when a conversation has more than MaxPerConversation events or when
+// the log holds more than MaxBytes of event data, whichever comes first.
+type Limits struct {
+	Retention          time.Duration
+	MaxPerConversation int
+	MaxBytes           int64
+}
+
+// Log is a bounded history of conversation events
+type Log struct {
+	limits Limits
+
+	mu            sync.Mutex
+	lastID        uint64
+	bytes         int64
+	floor         uint64
+	queue         []*Event
+	conversations map[string]*conversationLog
+}
+
+// conversationLog holds the retained events of one conversation, oldest first
+type conversationLog struct {
+	events []*Event
+	// dropped is the ID of the newest event no longer retained
+	dropped uint64
+}
+
+// New creates an empty log
+func New(limits Limits) *Log {
+	return &Log{
+		limits:        limits,
+		conversations: make(map[string]*conversationLog),
+	}
+}
+
+// Append records an event for a conversation. encode is given the event's ID and
+// returns the data to store, which is what gets replayed later.
+func (l *Log) Append(conversationID string, encode func(id uint64) ([]byte, error)) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := encode(l.lastID + 1)
+	if err != nil {
+		return Event{}, err
+	}
+
+	now := time.Now()
+	l.lastID++
+	event := &Event{ID: l.lastID, ConversationID: conversationID, Data: data, At: now}
+
+	conversation, ok := l.conversations[conversationID]
+	if !ok {
+		conversation = &conversationLog{}
+		l.conversations[conversationID] = conversation
+	}
+	conversation.events = append(conversation.events, event)
+	l.queue = append(l.queue, event)
+	l.bytes += int64(len(data))
+
+	if l.limits.MaxPerConversation > 0 && len(conversation.events) > l.limits.MaxPerConversation {
+		oldest := conversation.events[0]
+		conversation.dropped = oldest.ID
+		l.bytes -= int64(len(oldest.Data))
+		// The event stays queued until evict reaches it; release its data now
+		oldest.Data = nil
+		conversation.events[0] = nil
+		conversation.events = conversation.events[1:]
+	}
+
+	l.evict(now)
+	return *event, nil
+}
+
+// Since returns the events after afterID for the given conversations, oldest first.
+// complete is false when events the caller has not seen may already have been dropped,
+// or afterID was issued before a restart, so the caller has to reload instead.
+func (l *Log) Since(conversationIDs []string, afterID uint64) (events []Event, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evict(time.Now())
+	if afterID > l.lastID || afterID < l.floor {
+		return nil, false
+	}
+
+	complete = true
+	for _, id := range conversationIDs {
+		conversation, ok := l.conversations[id]
+		if !ok {
+			continue
+		}
+		if afterID < conversation.dropped {
+			complete = false
+		}
+		// Events are ordered by ID, so find the first one the caller has not seen
+		start := sort.Search(len(conversation.events), func(i int) bool {
+			return conversation.events[i].ID > afterID
+		})
+		for _, event := range conversation.events[start:] {
+			events = append(events, *event)
+		}
+	}
+	if !complete {
+		return nil, false
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, true
+}
+
+// LastID returns the ID of the newest event, so a client can start from there
+func (l *Log) LastID() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastID
+}
+
+// evict drops expired events, then the oldest events until the log fits in MaxBytes.
+// Must be called with the lock held.
+func (l *Log) evict(now time.Time) {
+	cutoff := now.Add(-l.limits.Retention)
+	for len(l.queue) > 0 {
+		oldest := l.queue[0]
+		expired := l.limits.Retention > 0 && oldest.At.Before(cutoff)
+		overBudget := l.limits.MaxBytes > 0 && l.bytes > l.limits.MaxBytes
+		if !expired && !overBudget {
+			break
+		}
+
+		l.queue[0] = nil
+		l.queue = l.queue[1:]
+
+		conversation, ok := l.conversations[oldest.ConversationID]
+		if !ok {
+			continue
+		}
+		// The event may already have left its conversation through MaxPerConversation
+		if len(conversation.events) > 0 && conversation.events[0] == oldest {
+			l.bytes -= int64(len(oldest.Data))
+			conversation.events[0] = nil
+			conversation.events = conversation.events[1:]
+			conversation.dropped = oldest.ID
+		}
+		if len(conversation.events) == 0 {
+			// Forgetting the conversation also forgets what it dropped, so anyone
+			// older than that has to reload
+			if conversation.dropped > l.floor {
+				l.floor = conversation.dropped
+			}
+			delete(l.conversations, oldest.ConversationID)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxResponseBytes bounds what is read from a peer
+	maxResponseBytes = 64 << 10
+	// keyRefetchInterval keeps a peer from being asked for its keys over and over by
+	// answers signed with a key it doesn't publish
+	keyRefetchInterval = time.Minute
+)
+
+// Client looks up users of a fixed set of peers. Addresses are typed in by users, so
+// other domains are refused rather than called from inside the network.
+type Client struct {
+	allowed map[string]bool
+	client  *http.Client
+	keyTTL  time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*peerKeys
+}
+
+// peerKeys are the public keys a peer published when last asked
+type peerKeys struct {
+	keys      map[string]ed25519.PublicKey
+	fetchedAt time.Time
+}
+
+// NewClient creates a client for the given peer domains whose requests give up after
+// timeout and that trusts the keys of peers for keyTTL
+func NewClient(peers []string, timeout, keyTTL time.Duration) *Client {
+	c := &Client{allowed: make(map[string]bool), keyTTL: keyTTL, keys: make(map[string]*peerKeys)}
+	for _, peer := range peers {
+		c.allowed[strings.ToLower(peer)] = true
+	}
+	c.client = &http.Client{
+		Timeout: timeout,
+		// A redirect could lead anywhere, and answers are only signed by the peer itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return c
+}
+
+// Lookup asks the peer at the address's domain about its account, and returns it once
+// the answer's signature checks out against the peer's published key
+func (c *Client) Lookup(ctx context.Context, address Address) (*Identity, error) {
+	if !c.allowed[address.Domain] {
+		return nil, ErrPeerNotAllowed
+	}
+
+	query := url.Values{"resource": {address.Resource()}}
+	status, header, body, err := c.get(ctx, address.Domain, WebFingerPath+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("%s answered %d", address.Domain, status)
+	}
+
+	if err := c.Verify(ctx, address.Domain, header, body); err != nil {
+		return nil, err
+	}
+	var document Document
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return document.identity(address)
+}
+
+// Allowed reports whether domain is a peer
+func (c *Client) Allowed(domain string) bool {
+	return c.allowed[strings.ToLower(domain)]
+}
+
+// Verify checks that body, sent with header, was signed by the peer domain recently
+func (c *Client) Verify(ctx context.Context, domain string, header http.Header, body []byte) error {
+	kid := header.Get(KeyIDHeader)
+	timestamp := header.Get(TimestampHeader)
+	signature, err := base64.RawURLEncoding.DecodeString(header.Get(SignatureHeader))
+	if kid == "" || err != nil {
+		return ErrBadSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("%w: the answer was signed at %s", ErrBadSignature, time.Unix(unix, 0).UTC().Format(time.RFC3339))
+	}
+
+	key, err := c.key(ctx, domain, kid)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, signedPayload(domain, timestamp, body), signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// key returns the public key kid of domain, fetching the peer's keys when they are
+// older than the key TTL or don't include kid, as after the peer rotated its key
+func (c *Client) key(ctx context.Context, domain, kid string) (ed25519.PublicKey, error) {
+	c.mu.Lock()
+	cached := c.keys[domain]
+	c.mu.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < c.keyTTL {
+		if key, ok := cached.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(cached.fetchedAt) < keyRefetchInterval {
+			return nil, fmt.Errorf("%w: %s doesn't publish key %q", ErrBadSignature, domain, kid)
+		}
+	}
+
+	fetched, err := c.fetchKeys(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.keys[domain] = fetched
+	c.mu.Unlock()
+
+	key, ok := fetched.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s doesn't publish key %q", ErrBadSignature, domain, kid)
+	}
+	return key, nil
+}
+
+// fetchKeys gets the public keys domain publishes. They are trusted as served over
+// HTTPS by the domain itself.
+func (c *Client) fetchKeys(ctx context.Context, domain string) (*peerKeys, error) {
+	status, _, body, err := c.get(ctx, domain, KeysPath)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %d for its keys", domain, status)
+	}
+	var document KeyDocument
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if !strings.EqualFold(document.Domain, domain) {
+		return nil, fmt.Errorf("%w: %s publishes the keys of %q", ErrInvalidResponse, domain, document.Domain)
+	}
+
+	fetched := &peerKeys{keys: make(map[string]ed25519.PublicKey), fetchedAt: time.Now()}
+	for _, key := range document.Keys {
+		if key.Kty != "OKP" || key.Crv != "Ed25519" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+		fetched.keys[key.KID] = ed25519.PublicKey(x)
+	}
+	return fetched, nil
+}
+
+func (c *Client) get(ctx context.Context, domain, path string) (int, http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+path, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+	return c.do(domain, req)
+}
+
+func (c *Client) do(domain string, req *http.Request) (int, http.Header, []byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to reach %s: %w", domain, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read the answer of %s: %w", domain, err)
+	}
+	if len(body) > maxResponseBytes {
+		return 0, nil, nil, fmt.Errorf("%w: the answer of %s is too large", ErrInvalidResponse, domain)
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// ReadBody reads a request body sent by a peer, refusing ones larger than any peer
+// sends
+func ReadBody(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxResponseBytes {
+		return nil, fmt.Errorf("%w: the body is too large", ErrInvalidResponse)
+	}
+	return body, nil
+}
@@ -0,0 +1,81 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InboxPath is where every deployment takes the envelopes of its users' direct messages
+const InboxPath = "/api/federation/inbox"
+
+// ReceiptDelivered acknowledges an envelope stored for its recipient
+const ReceiptDelivered = "delivered"
+
+// Envelope carries a direct message from a user of one deployment to a user of
+// another. It is signed by the sender's deployment like WebFinger documents are.
+type Envelope struct {
+	// ID is the message's ID on the sending deployment; an envelope delivered twice is
+	// only stored once
+	ID   uuid.UUID `json:"id"`
+	From string    `json:"from" example:"alice@chat.example.com"`
+	// FromUserID is the sender's ID on their deployment
+	FromUserID uuid.UUID `json:"from_user_id"`
+	To         string    `json:"to" example:"bob@talk.example.org"`
+	Content    string    `json:"content"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// Receipt is what the recipient's deployment answers an envelope with, signed
+type Receipt struct {
+	EnvelopeID  uuid.UUID `json:"envelope_id"`
+	Status      string    `json:"status" example:"delivered"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// Deliver sends an envelope, signed by signer, to the deployment of its recipient and
+// returns the signed receipt it answers with
+func (c *Client) Deliver(ctx context.Context, signer *Signer, envelope *Envelope) (*Receipt, error) {
+	to, err := ParseAddress(envelope.To)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Allowed(to.Domain) {
+		return nil, ErrPeerNotAllowed
+	}
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode envelope: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+to.Domain+InboxPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signer.Sign(req.Header, body)
+
+	status, header, answer, err := c.do(to.Domain, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %d: %s", to.Domain, status, bytes.TrimSpace(answer))
+	}
+	if err := c.Verify(ctx, to.Domain, header, answer); err != nil {
+		return nil, err
+	}
+	var receipt Receipt
+	if err := json.Unmarshal(answer, &receipt); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if receipt.EnvelopeID != envelope.ID || receipt.Status != ReceiptDelivered {
+		return nil, fmt.Errorf("%w: the receipt is for %s, %s", ErrInvalidResponse, receipt.EnvelopeID, receipt.Status)
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,130 @@
+// Package federation looks up users of other Talkify deployments by address, such as
+// alice@chat.example.com, and answers the same lookups about this server's users.
+// Answers are WebFinger documents signed with the answering server's Ed25519 key,
+// whose public half it publishes next to them. Direct messages between deployments
+// travel as envelopes signed the same way, acknowledged with signed receipts.
+package federation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Paths every deployment serves its WebFinger documents and public keys at
+const (
+	WebFingerPath = "/api/.well-known/webfinger"
+	KeysPath      = "/api/.well-known/talkify-keys"
+)
+
+// Headers signed answers carry. The signature is the base64url Ed25519 signature of
+// the answering domain, a newline, the Unix timestamp, a newline and the body.
+const (
+	KeyIDHeader     = "X-Talkify-Key-ID"
+	SignatureHeader = "X-Talkify-Signature"
+	TimestampHeader = "X-Talkify-Timestamp"
+)
+
+// Properties of a Talkify account in its WebFinger document
+const (
+	PropertyUserID   = "https://talkify.app/ns/federation#user_id"
+	PropertyUsername = "https://talkify.app/ns/federation#username"
+)
+
+// maxClockSkew is how far the timestamp of a signed answer may be from now
+const maxClockSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidAddress is returned for an address that isn't user@domain
+	ErrInvalidAddress = errors.New("invalid federated address")
+	// ErrPeerNotAllowed is returned for a domain that isn't a configured peer
+	ErrPeerNotAllowed = errors.New("domain is not a federation peer")
+	// ErrNotFound is returned when a peer has no account at the address
+	ErrNotFound = errors.New("federated user not found")
+	// ErrBadSignature is returned for an answer that isn't signed by the peer
+	ErrBadSignature = errors.New("federation signature is not valid")
+	// ErrInvalidResponse is returned for a signed answer that makes no sense
+	ErrInvalidResponse = errors.New("invalid federation response")
+)
+
+// Address identifies an account across deployments as username@domain
+type Address struct {
+	Username string
+	Domain   string
+}
+
+// ParseAddress parses user@domain, also taken as @user@domain or acct:user@domain.
+// Domains are case insensitive and returned lower case.
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "acct:"), "@")
+	at := strings.LastIndex(s, "@")
+	if at <= 0 || at == len(s)-1 {
+		return Address{}, ErrInvalidAddress
+	}
+	address := Address{Username: s[:at], Domain: strings.ToLower(s[at+1:])}
+	if strings.ContainsAny(address.Username, "@/?#: \t") || strings.ContainsAny(address.Domain, "/?#@: \t") {
+		return Address{}, ErrInvalidAddress
+	}
+	return address, nil
+}
+
+// String returns username@domain
+func (a Address) String() string {
+	return a.Username + "@" + a.Domain
+}
+
+// Resource returns the address as a WebFinger acct: resource
+func (a Address) Resource() string {
+	return "acct:" + a.String()
+}
+
+// Document is a WebFinger JSON Resource Descriptor
+type Document struct {
+	Subject    string            `json:"subject"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// NewDocument describes a local account at address
+func NewDocument(address Address, userID uuid.UUID) *Document {
+	return &Document{
+		Subject: address.Resource(),
+		Properties: map[string]string{
+			PropertyUserID:   userID.String(),
+			PropertyUsername: address.Username,
+		},
+	}
+}
+
+// Identity is a Talkify account found by address
+type Identity struct {
+	Address  string    `json:"address" example:"alice@chat.example.com"`
+	Domain   string    `json:"domain" example:"chat.example.com"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username" example:"alice"`
+	// Local is set for accounts of this server
+	Local bool `json:"local"`
+}
+
+// identity reads the identity of address from its document
+func (d *Document) identity(address Address) (*Identity, error) {
+	if !strings.EqualFold(d.Subject, address.Resource()) {
+		return nil, fmt.Errorf("%w: the document is about %q", ErrInvalidResponse, d.Subject)
+	}
+	userID, err := uuid.Parse(d.Properties[PropertyUserID])
+	if err != nil {
+		return nil, fmt.Errorf("%w: the document has no user ID", ErrInvalidResponse)
+	}
+	username := d.Properties[PropertyUsername]
+	if username == "" {
+		username = address.Username
+	}
+	return &Identity{
+		Address:  username + "@" + address.Domain,
+		Domain:   address.Domain,
+		UserID:   userID,
+		Username: username,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package federation
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PublicKey is a key peers verify signed answers with, in JSON Web Key form
+type PublicKey struct {
+	KID string `json:"kid"`
+	Kty string `json:"kty" example:"OKP"`
+	Crv string `json:"crv" example:"Ed25519"`
+	Alg string `json:"alg" example:"EdDSA"`
+	X   string `json:"x"`
+}
+
+// KeyDocument is what a deployment publishes at KeysPath
+type KeyDocument struct {
+	Domain string      `json:"domain" example:"chat.example.com"`
+	Keys   []PublicKey `json:"keys"`
+}
+
+// Signer signs what this server answers peers about its users
+type Signer struct {
+	domain string
+	key    ed25519.PrivateKey
+	keyID  string
+}
+
+// NewSigner derives the server's key from secret, so that every node of a deployment
+// signs with the same key without sharing a key file. Changing the secret rotates it.
+func NewSigner(domain, secret string) *Signer {
+	seed := sha256.Sum256([]byte("talkify/federation\n" + secret))
+	key := ed25519.NewKeyFromSeed(seed[:])
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &Signer{domain: domain, key: key, keyID: base64.RawURLEncoding.EncodeToString(sum[:12])}
+}
+
+// Domain returns the domain the server's users are addressed at
+func (s *Signer) Domain() string {
+	return s.domain
+}
+
+// Sign sets the headers that let peers check body came from this server
+func (s *Signer) Sign(header http.Header, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(s.key, signedPayload(s.domain, timestamp, body))
+	header.Set(KeyIDHeader, s.keyID)
+	header.Set(TimestampHeader, timestamp)
+	header.Set(SignatureHeader, base64.RawURLEncoding.EncodeToString(signature))
+}
+
+// Keys returns the document peers fetch the server's public key from
+func (s *Signer) Keys() *KeyDocument {
+	return &KeyDocument{
+		Domain: s.domain,
+		Keys: []PublicKey{{
+			KID: s.keyID,
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Alg: "EdDSA",
+			X:   base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		}},
+	}
+}
+
+func signedPayload(domain, timestamp string, body []byte) []byte {
+	payload := make([]byte, 0, len(domain)+len(timestamp)+2+len(body))
+	payload = append(payload, domain+"\n"+timestamp+"\n"...)
+	return append(payload, body...)
+}
@@ -0,0 +1,164 @@
+// Package fieldset trims API responses to what clients ask for. Clients list the
+// fields they want with ?fields=id,name,participants.user_id and the related objects
+// to embed with ?include=participants; everything is returned when neither is given.
+package fieldset
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Selection is what a client asked for on one endpoint
+type Selection struct {
+	fields    map[string]bool
+	include   map[string]bool
+	relations []string
+}
+
+// Parse reads the fields and include query parameters of an endpoint whose related
+// objects are relations, as dotted paths such as "participants.user". Relations left
+// out of include are dropped; include names nothing else.
+func Parse(fields, include string, relations []string) (*Selection, error) {
+	s := &Selection{relations: relations}
+
+	var err error
+	if s.fields, err = parseList("fields", fields); err != nil {
+		return nil, err
+	}
+	if s.include, err = parseList("include", include); err != nil {
+		return nil, err
+	}
+	for path := range s.include {
+		if !contains(relations, path) {
+			return nil, fmt.Errorf("include: unknown relation %q, expected one of %s", path, strings.Join(relations, ", "))
+		}
+		// Relations can only be embedded in the relation they belong to
+		for _, relation := range relations {
+			if relation != path && within(path, relation) {
+				s.include[relation] = true
+			}
+		}
+	}
+	return s, nil
+}
+
+// All reports whether the whole payload is returned
+func (s *Selection) All() bool {
+	return s.fields == nil && s.include == nil
+}
+
+// Wants reports whether anything at path is returned, so callers can skip loading
+// what would be dropped anyway
+func (s *Selection) Wants(path string) bool {
+	return s.keep(path)
+}
+
+// Apply returns v trimmed to the selection, ready to be encoded as JSON
+func (s *Selection) Apply(v interface{}) (interface{}, error) {
+	if s.All() {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return s.prune(tree, ""), nil
+}
+
+// prune drops what is not selected below prefix; arrays are trimmed element by element
+func (s *Selection) prune(node interface{}, prefix string) interface{} {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if !s.keep(path) {
+				delete(node, key)
+				continue
+			}
+			node[key] = s.prune(value, path)
+		}
+		return node
+	case []interface{}:
+		for i := range node {
+			node[i] = s.prune(node[i], prefix)
+		}
+		return node
+	default:
+		return node
+	}
+}
+
+// keep reports whether path, or something below it, is selected
+func (s *Selection) keep(path string) bool {
+	// Relations, and everything below them, need to be included
+	if s.include != nil {
+		for _, relation := range s.relations {
+			if within(path, relation) && !s.include[relation] {
+				return false
+			}
+		}
+	}
+	if s.fields == nil {
+		return true
+	}
+	for field := range s.fields {
+		// Selected fields keep their parents and everything below them
+		if within(path, field) || within(field, path) {
+			return true
+		}
+	}
+	// An included relation is returned whole unless fields pick from it
+	for relation := range s.include {
+		if within(path, relation) && !s.picksFrom(relation) {
+			return true
+		}
+	}
+	return false
+}
+
+// picksFrom reports whether fields names anything below relation
+func (s *Selection) picksFrom(relation string) bool {
+	for field := range s.fields {
+		if field != relation && within(field, relation) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is ancestor or below it
+func within(path, ancestor string) bool {
+	return path == ancestor || strings.HasPrefix(path, ancestor+".")
+}
+
+func parseList(name, raw string) (map[string]bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	list := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, ".") || strings.HasSuffix(item, ".") || strings.Contains(item, "..") {
+			return nil, fmt.Errorf("%s: invalid entry %q", name, item)
+		}
+		list[item] = true
+	}
+	return list, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+// Package groupname names groups that have no name of their own after their
+// participants, such as "alice, bob & 3 others", in the language the viewer reads.
+// Names are built from a sample of the participants kept with the conversation
+// summary, so naming a group reads no more than its summary.
+package groupname
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxNamed is the most participants a name can list
+const MaxNamed = 5
+
+// SampleSize is how many participants summaries keep for naming: one more than can be
+// named, so that the viewer can be left out
+const SampleSize = MaxNamed + 1
+
+// Template names groups in one language. All, One and Many hold {names}, the named
+// participants joined with Separator; Many also holds {count}, how many are not named.
+type Template struct {
+	Separator string `yaml:"separator"`
+	// Alone names a group the viewer is the only participant of
+	Alone string `yaml:"alone"`
+	// All names a group whose other participants are all named
+	All string `yaml:"all"`
+	// One and Many name groups with one, or more, participants left unnamed
+	One  string `yaml:"one"`
+	Many string `yaml:"many"`
+}
+
+// Complete reports whether every part of the template is set
+func (t Template) Complete() bool {
+	return t.Alone != "" && t.All != "" && t.One != "" && t.Many != "" &&
+		strings.Contains(t.All, "{names}") && strings.Contains(t.Many, "{count}")
+}
+
+// builtin are the templates of the languages names come in without configuration
+var builtin = map[string]Template{
+	"en": {Separator: ", ", Alone: "Just you", All: "{names}", One: "{names} & 1 other", Many: "{names} & {count} others"},
+	"de": {Separator: ", ", Alone: "Nur du", All: "{names}", One: "{names} und 1 weitere Person", Many: "{names} und {count} weitere"},
+	"es": {Separator: ", ", Alone: "Solo tú", All: "{names}", One: "{names} y 1 más", Many: "{names} y {count} más"},
+	"fr": {Separator: ", ", Alone: "Vous seul", All: "{names}", One: "{names} et 1 autre", Many: "{names} et {count} autres"},
+	"it": {Separator: ", ", Alone: "Solo tu", All: "{names}", One: "{names} e 1 altro", Many: "{names} e altri {count}"},
+	"nl": {Separator: ", ", Alone: "Alleen jij", All: "{names}", One: "{names} en 1 ander", Many: "{names} en {count} anderen"},
+	"pt": {Separator: ", ", Alone: "Só você", All: "{names}", One: "{names} e mais 1", Many: "{names} e mais {count}"},
+	"ja": {Separator: "、", Alone: "自分のみ", All: "{names}", One: "{names}、他1人", Many: "{names}、他{count}人"},
+	"zh": {Separator: "、", Alone: "仅你自己", All: "{names}", One: "{names}和另外1人", Many: "{names}和另外{count}人"},
+}
+
+// Member is a participant in a group's sample
+type Member struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// Namer names groups with the built-in templates and those configured
+type Namer struct {
+	named     int
+	fallback  string
+	templates map[string]Template
+}
+
+// New creates a namer listing up to named participants, in the fallback locale when
+// the viewer's has no template. Templates override the built-in ones by locale; they
+// and fallback were validated with the configuration.
+func New(named int, fallback string, templates map[string]Template) *Namer {
+	n := &Namer{
+		named:     min(max(named, 1), MaxNamed),
+		fallback:  fallback,
+		templates: make(map[string]Template, len(builtin)+len(templates)),
+	}
+	for locale, template := range builtin {
+		n.templates[locale] = template
+	}
+	for locale, template := range templates {
+		n.templates[locale] = template
+	}
+	if _, ok := n.templates[n.fallback]; !ok {
+		n.fallback = "en"
+	}
+	return n
+}
+
+// Has reports whether locale has a template of its own or through its language
+func (n *Namer) Has(locale string) bool {
+	_, ok := n.template(locale)
+	return ok
+}
+
+// Locales returns the locales that have a template
+func (n *Namer) Locales() []string {
+	locales := make([]string, 0, len(n.templates))
+	for locale := range n.templates {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// template returns the template of locale, falling back to its language's, so pt-br
+// uses pt when there is no pt-br
+func (n *Namer) template(locale string) (Template, bool) {
+	if template, ok := n.templates[locale]; ok {
+		return template, true
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	template, ok := n.templates[language]
+	return template, ok
+}
+
+// Locale picks the locale to name groups in from an Accept-Language header: the
+// preferred one with a template, or the fallback
+func (n *Namer) Locale(acceptLanguage string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+	var choices []choice
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+			q = parsed
+		}
+		choices = append(choices, choice{tag, q})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, c := range choices {
+		if n.Has(c.locale) {
+			return c.locale
+		}
+	}
+	return n.fallback
+}
+
+// Name names a group of count participants for viewer, who is left out of the name,
+// from a sample of its participants in the order they joined. Server-side uses with
+// no viewer pass uuid.Nil. mask, when not nil, is applied to each name listed, so that
+// usernames the content filter would mask don't end up in the name unmasked.
+func (n *Namer) Name(sample []Member, count int, viewer uuid.UUID, locale string, mask func(string) string) string {
+	template, ok := n.template(locale)
+	if !ok {
+		template = n.templates[n.fallback]
+	}
+
+	others := count
+	if viewer != uuid.Nil {
+		others--
+	}
+	names := make([]string, 0, n.named)
+	for _, member := range sample {
+		if len(names) == n.named {
+			break
+		}
+		if member.ID == viewer {
+			continue
+		}
+		name := member.Name
+		if mask != nil {
+			name = mask(name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return template.Alone
+	}
+
+	format := template.All
+	switch unnamed := others - len(names); {
+	case unnamed == 1:
+		format = template.One
+	case unnamed > 1:
+		format = template.Many
+	}
+	return strings.NewReplacer(
+		"{names}", strings.Join(names, template.Separator),
+		"{count}", strconv.Itoa(others-len(names)),
+	).Replace(format)
+}
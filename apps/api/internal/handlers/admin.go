@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type RotateSigningKeyRequest struct {
+	Algorithm string `json:"algorithm" binding:"required,oneof=HS256 RS256 EdDSA" example:"RS256"`
+}
+
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware(), h.AdminMiddleware())
+	{
+		r.GET("/jwt/keys", h.GetSigningKeys)
+		r.POST("/jwt/keys", h.RotateSigningKey)
+		r.PUT("/jwt/keys/:kid/active", h.ActivateSigningKey)
+		r.DELETE("/jwt/keys/:kid", h.RemoveSigningKey)
+		r.GET("/metrics", gin.WrapH(expvar.Handler()))
+		r.GET("/config", h.GetConfig)
+		r.POST("/config/reload", h.ReloadConfig)
+		r.GET("/authz", h.GetAuthzMatrix)
+		r.POST("/conversations/:id/restore", h.RestoreConversation)
+		r.GET("/users/inactive", h.GetInactiveUsers)
+		r.GET("/users/:id/delivery", h.GetDeliveryHealth)
+		r.GET("/clients/versions", h.GetClientVersions)
+		r.PUT("/users/:id/legal-hold", h.SetLegalHold)
+		r.PUT("/users/:id/password-rotation", h.SetPasswordRotation)
+		r.PUT("/users/:id/verified", h.SetUserVerified)
+		r.GET("/impersonations", h.GetImpersonations)
+		r.POST("/impersonations", h.RequestImpersonation)
+		r.POST("/impersonations/:id/approve", h.AdminApproveImpersonation)
+		r.POST("/impersonations/:id/deny", h.AdminDenyImpersonation)
+		r.POST("/impersonations/:id/token", h.GetImpersonationToken)
+		r.POST("/impersonations/:id/end", h.AdminEndImpersonation)
+		r.PUT("/conversations/:id/legal-hold", h.SetConversationLegalHold)
+		r.GET("/legal-holds", h.GetLegalHolds)
+		r.GET("/compliance/export", h.ExportCompliance)
+		r.GET("/conversation-templates", h.AdminGetConversationTemplates)
+		r.POST("/conversation-templates", h.CreateConversationTemplate)
+		r.PUT("/conversation-templates/:id", h.UpdateConversationTemplate)
+		r.DELETE("/conversation-templates/:id", h.DeleteConversationTemplate)
+		r.GET("/broadcasts", h.GetUrgentBroadcasts)
+		r.POST("/broadcasts", h.CreateUrgentBroadcast)
+		r.GET("/broadcasts/:id/acknowledgments", h.GetBroadcastAcknowledgments)
+		r.GET("/analytics/reactions", h.GetReactionAnalytics)
+		r.GET("/content-filter/terms", h.GetContentFilterTerms)
+		r.POST("/content-filter/terms", h.AddContentFilterTerm)
+		r.DELETE("/content-filter/terms/:id", h.RemoveContentFilterTerm)
+		r.PUT("/workspace/branding", h.UpdateBranding)
+		r.GET("/workspace/settings", h.GetWorkspaceSettings)
+		r.PUT("/workspace/settings", h.UpdateWorkspaceSettings)
+		r.GET("/storage", h.GetStorageReport)
+		r.POST("/storage/cleanup", h.CleanupStorage)
+		r.GET("/realtime", h.GetRealtimeStats)
+		r.DELETE("/realtime/connections/:id", h.DisconnectRealtimeConnection)
+	}
+}
+
+// AdminMiddleware only lets users flagged as administrators through. It must run after AuthMiddleware.
+func (h *Handler) AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("user")
+		user, ok := value.(*models.User)
+		if !exists || !ok || !user.IsAdmin {
+			h.respondWithError(c, http.StatusForbidden, "Administrator access required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// @Summary Get JSON Web Key Set
+// @Description Public keys that can be used to verify tokens signed with asymmetric keys
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) GetJWKS(c *gin.Context) {
+	h.respondWithSuccess(c, http.StatusOK, h.tokenManager.Keys().JWKS())
+}
+
+// @Summary List JWT signing keys
+// @Description List all keys tokens are verified with and which one new tokens are signed with
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/jwt/keys [get]
+func (h *Handler) GetSigningKeys(c *gin.Context) {
+	keys := h.tokenManager.Keys()
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"active_kid": keys.ActiveKID(),
+		"keys":       keys.List(),
+	})
+}
+
+// @Summary Rotate JWT signing key
+// @Description Generate a new signing key and make it active on every node. Existing tokens stay valid because previous keys are kept for verification.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body RotateSigningKeyRequest true "Key algorithm"
+// @Success 201 {object} auth.SigningKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/jwt/keys [post]
+func (h *Handler) RotateSigningKey(c *gin.Context) {
+	var req RotateSigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, err := h.tokenManager.Keys().Rotate(req.Algorithm)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to rotate signing key")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusCreated, key)
+}
+
+// @Summary Activate JWT signing key
+// @Description Make an existing key the one new tokens are signed with
+// @Tags admin
+// @Produce json
+// @Param kid path string true "Key ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/jwt/keys/{kid}/active [put]
+func (h *Handler) ActivateSigningKey(c *gin.Context) {
+	if err := h.tokenManager.Keys().SetActive(c.Param("kid")); err != nil {
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Signing key not found")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to activate signing key")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Signing key activated successfully"})
+}
+
+// @Summary Remove JWT signing key
+// @Description Retire a key. Tokens signed with it stop validating immediately on this node and within a minute on the others.
+// @Tags admin
+// @Produce json
+// @Param kid path string true "Key ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/jwt/keys/{kid} [delete]
+func (h *Handler) RemoveSigningKey(c *gin.Context) {
+	if err := h.tokenManager.Keys().Remove(c.Param("kid")); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrActiveKeyRemoval):
+			h.respondWithError(c, http.StatusBadRequest, "Cannot remove the active signing key")
+		case errors.Is(err, auth.ErrKeyNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Signing key not found")
+		default:
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to remove signing key")
+		}
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Signing key removed successfully"})
+}
+
+// RefreshSigningKeys picks up the keys rotated, activated and removed on other nodes
+func (h *Handler) RefreshSigningKeys() error {
+	return h.tokenManager.Keys().Refresh()
+}
+
+// @Summary Get configuration
+// @Description Effective configuration with secrets redacted, the live runtime settings and the reload history
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/config [get]
+func (h *Handler) GetConfig(c *gin.Context) {
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"config":  h.cfg.Redacted(),
+		"runtime": h.live.Runtime(),
+		"reloads": h.live.History(),
+	})
+}
+
+// @Summary Reload configuration
+// @Description Re-read the config file and environment and apply the runtime settings (log level, CORS origins, rate limits, feature flags). Nothing is applied if validation fails.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} config.ReloadRecord
+// @Failure 403 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/config/reload [post]
+func (h *Handler) ReloadConfig(c *gin.Context) {
+	actor := "admin:" + c.GetHeader("X-User-ID")
+	record, err := h.live.Reload(actor)
+	if err != nil {
+		logger.Warn("Config reload rejected", map[string]interface{}{
+			"actor": actor,
+			"error": err.Error(),
+		})
+		h.respondWithError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	logger.Info("Config reloaded", map[string]interface{}{
+		"actor":   actor,
+		"changes": record.Changes,
+	})
+	h.respondWithSuccess(c, http.StatusOK, record)
+}
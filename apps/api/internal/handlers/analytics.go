@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// @Summary Get conversation analytics
+// @Description Get member growth, message volume, most active members and media usage for a conversation. Only owners and admins can view analytics.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param days query int false "Number of days to report on (default: 30, max: 365)"
+// @Success 200 {object} models.ConversationAnalytics
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/analytics [get]
+func (h *Handler) GetConversationAnalytics(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	days, ok := h.analyticsDays(c)
+	if !ok {
+		return
+	}
+
+	if !h.canViewAnalytics(c, conversationID, userID) {
+		return
+	}
+
+	analyticsService := models.NewAnalyticsService(h.db)
+	report, err := analyticsService.GetConversationAnalytics(conversationID, days)
+	if err != nil {
+		logger.Error("Failed to get conversation analytics", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversation analytics")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
+
+// @Summary Get conversation reaction analytics
+// @Description Get the most used and trending emoji reactions and the most reacted messages of a conversation. Trending emoji are those used more than in the period of the same length before. Built from the daily rollups. Only owners and admins can view analytics.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param days query int false "Number of days to report on (default: 30, max: 365)"
+// @Success 200 {object} models.ReactionAnalytics
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/analytics/reactions [get]
+func (h *Handler) GetConversationReactionAnalytics(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	days, ok := h.analyticsDays(c)
+	if !ok {
+		return
+	}
+
+	if !h.canViewAnalytics(c, conversationID, userID) {
+		return
+	}
+
+	h.respondWithReactionAnalytics(c, &conversationID, days)
+}
+
+// @Summary Get reaction analytics across conversations
+// @Description Get the most used and trending emoji reactions and the most reacted messages across every conversation, for community engagement dashboards. Built from the daily rollups.
+// @Tags admin
+// @Produce json
+// @Param days query int false "Number of days to report on (default: 30, max: 365)"
+// @Success 200 {object} models.ReactionAnalytics
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/analytics/reactions [get]
+func (h *Handler) GetReactionAnalytics(c *gin.Context) {
+	days, ok := h.analyticsDays(c)
+	if !ok {
+		return
+	}
+
+	h.respondWithReactionAnalytics(c, nil, days)
+}
+
+func (h *Handler) respondWithReactionAnalytics(c *gin.Context, conversationID *uuid.UUID, days int) {
+	analyticsService := models.NewAnalyticsService(h.db)
+	report, err := analyticsService.GetReactionAnalytics(conversationID, days)
+	if err != nil {
+		logger.Error("Failed to get reaction analytics", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get reaction analytics")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
+
+// analyticsDays reads the number of days an analytics report covers
+func (h *Handler) analyticsDays(c *gin.Context) (int, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid days. Must be between 1 and 365")
+		return 0, false
+	}
+	return days, true
+}
+
+// canViewAnalytics reports whether userID owns or administers the conversation,
+// responding with the reason when not
+func (h *Handler) canViewAnalytics(c *gin.Context, conversationID, userID uuid.UUID) bool {
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	role, err := conversationService.GetParticipantRole(conversationID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidParticipant) {
+			h.respondWithError(c, http.StatusForbidden, "You don't have access to this conversation")
+			return false
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return false
+	}
+	if role != "owner" && role != "admin" {
+		h.respondWithError(c, http.StatusForbidden, "Only owners and admins can view analytics")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var annotationKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+
+// AnnotateMessageRequest sets an annotation of a message. Setting a key again replaces
+// its value.
+type AnnotateMessageRequest struct {
+	Key   string          `json:"key" binding:"required" example:"ticket"`
+	Value json.RawMessage `json:"value" binding:"required" swaggertype:"object"`
+}
+
+// @Summary Annotate a message
+// @Description Attach structured data to a message, such as a ticket link, a sentiment score or a CI status. Only applications can annotate, under their own keys; the value replaces any the application set under the key before. Annotations are returned with messages (include=annotations) and don't mark the message edited. Participants get a message.annotated event.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param annotation body AnnotateMessageRequest true "Annotation to set"
+// @Success 200 {object} models.MessageAnnotation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/annotations [post]
+func (h *Handler) AnnotateMessage(c *gin.Context) {
+	source, ok := h.annotationSource(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	h.annotateMessage(c, &userID, source)
+}
+
+// @Summary Remove a message annotation
+// @Description Remove an annotation the calling application set on a message
+// @Tags messages
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param key path string true "Annotation key"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/annotations/{key} [delete]
+func (h *Handler) RemoveMessageAnnotation(c *gin.Context) {
+	source, ok := h.annotationSource(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	key := c.Param("key")
+
+	conversationID, err := models.NewMessageService(h.db, h.encryptor).RemoveAnnotation(messageID, &userID, source, key)
+	if err != nil {
+		h.respondWithAnnotationError(c, err)
+		return
+	}
+	h.publishToConversation(conversationID, EventMessageAnnotated, MessageAnnotatedEvent{
+		MessageID:      messageID,
+		ConversationID: conversationID,
+		Source:         source,
+		Key:            key,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Annotation removed"})
+}
+
+// AnnotateServiceMessage annotates any message on behalf of an internal service
+func (h *Handler) AnnotateServiceMessage(c *gin.Context) {
+	h.annotateMessage(c, nil, "service:"+c.GetString("service"))
+}
+
+func (h *Handler) annotateMessage(c *gin.Context, userID *uuid.UUID, source string) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	var req AnnotateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if !annotationKeyPattern.MatchString(req.Key) {
+		h.respondWithError(c, http.StatusBadRequest, "Key must be 1 to 64 letters, digits, '_', '.', ':' or '-'")
+		return
+	}
+	if string(req.Value) == "null" {
+		h.respondWithError(c, http.StatusBadRequest, "Value is required")
+		return
+	}
+	if len(req.Value) > models.MaxAnnotationValueBytes {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Value must be at most %d bytes", models.MaxAnnotationValueBytes))
+		return
+	}
+
+	annotation, conversationID, err := models.NewMessageService(h.db, h.encryptor).Annotate(messageID, userID, source, req.Key, req.Value)
+	if err != nil {
+		h.respondWithAnnotationError(c, err)
+		return
+	}
+	h.publishToConversation(conversationID, EventMessageAnnotated, MessageAnnotatedEvent{
+		MessageID:      messageID,
+		ConversationID: conversationID,
+		Source:         source,
+		Key:            req.Key,
+		Annotation:     annotation,
+	})
+	h.respondWithSuccess(c, http.StatusOK, annotation)
+}
+
+// annotationSource names the application behind the request's token. People annotate
+// with reactions and replies, so other tokens are turned away.
+func (h *Handler) annotationSource(c *gin.Context) (string, bool) {
+	if value, ok := c.Get("claims"); ok {
+		if claims := value.(*auth.Claims); claims.IsAppToken() {
+			return "app:" + claims.ClientID, true
+		}
+	}
+	h.respondWithError(c, http.StatusForbidden, "Only applications can annotate messages")
+	return "", false
+}
+
+func (h *Handler) respondWithAnnotationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrMessageNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Message not found")
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Annotation not found")
+	case errors.Is(err, models.ErrAnnotationLimit):
+		h.respondWithError(c, http.StatusConflict, "Annotation limit reached")
+	default:
+		logger.Error("Failed to annotate message", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to annotate message")
+	}
+}
@@ -3,7 +3,11 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
 	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/server"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -11,8 +15,15 @@ import (
 
 func (h *Handler) RegisterAuthRoutes(r *gin.RouterGroup) {
 	r.POST("/login", h.LoginUser)
+	r.POST("/login/verify", h.VerifyLogin)
 	r.POST("/register", h.RegisterUser)
+	r.GET("/check", h.CheckSignup)
+	r.GET("/password-policy", h.GetPasswordPolicy)
 	r.POST("/refresh", h.RefreshToken)
+	r.POST("/recover", h.RecoverWithCode)
+	r.POST("/recovery-requests", h.StartRecovery)
+	r.POST("/recovery-requests/:id/status", h.GetRecoveryStatus)
+	r.POST("/recovery-requests/:id/complete", h.CompleteRecovery)
 }
 
 func (h *Handler) RegisterUser(c *gin.Context) {
@@ -22,14 +33,32 @@ func (h *Handler) RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// Addresses of users of other deployments are user@domain
+	if strings.Contains(input.Username, "@") {
+		h.respondWithError(c, http.StatusBadRequest, "Usernames can't contain '@'")
+		return
+	}
+	if !h.checkNewPassword(c, input.Password, input.Username, input.Email) {
+		return
+	}
+
 	userService := models.NewUserService(h.db, h.encryptor)
 
-	// Check if username already exists
+	// Check if username already exists; the security account's name is kept for it
 	existingUser, err := userService.GetByUsername(input.Username)
-	if err == nil && existingUser != nil {
+	if (err == nil && existingUser != nil) || strings.EqualFold(input.Username, models.SecurityBotUsername) {
 		h.respondWithError(c, http.StatusConflict, "Username already exists")
 		return
 	}
+	taken, err := userService.EmailTaken(input.Email)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check email")
+		return
+	}
+	if taken {
+		h.respondWithError(c, http.StatusConflict, "Email already in use")
+		return
+	}
 
 	// Create user
 	user, err := userService.Create(&input)
@@ -38,16 +67,32 @@ func (h *Handler) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := h.tokenManager.GenerateToken(user.ID)
+	// Generate tokens
+	device := h.loginDevice(c)
+	pair, err := h.tokenManager.GenerateTokenPair(user.ID, device.Name)
 	if err != nil {
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
+	if err := h.startSession(user.ID, pair, device.Name, device.IP); err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
+	// The device a user signs up on is the first they are known to use
+	deviceService := models.NewDeviceService(h.db)
+	if err := deviceService.Record(user.ID, device); err != nil {
+		logger.Error("Failed to record login device", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+	}
 
+	h.setRefreshCookie(c, pair)
 	h.respondWithSuccess(c, http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt,
 	})
 }
 
@@ -73,32 +118,95 @@ func (h *Handler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	token, err := h.tokenManager.GenerateToken(user.ID)
+	// Sign-ins from a device or country the user hasn't used before may need a code
+	device := h.loginDevice(c)
+	deviceService := models.NewDeviceService(h.db)
+	familiar, err := deviceService.IsFamiliar(user.ID, device)
 	if err != nil {
-		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		logger.Error("Failed to check login device", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Login failed")
+		return
+	}
+	if !familiar && h.cfg.Login.VerifyNewDevices && h.mailer != nil && user.Email != "" {
+		h.challengeLogin(c, user, device)
 		return
 	}
 
-	h.respondWithSuccess(c, http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	h.signIn(c, user, device, !familiar, true)
+}
+
+// refreshCookieName is the cookie browsers keep the refresh token in
+const refreshCookieName = "refresh_token"
+
+// RefreshTokenRequest carries the refresh token. Browser clients may omit it and rely on the cookie instead.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 func (h *Handler) RefreshToken(c *gin.Context) {
-	userID, err := h.getUserIDFromToken(c)
+	var req RefreshTokenRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(refreshCookieName)
+	}
+	if req.RefreshToken == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	pair, claims, err := h.tokenManager.RefreshTokenPair(req.RefreshToken)
 	if err != nil {
-		h.respondWithError(c, http.StatusUnauthorized, "Invalid token")
+		h.respondUnauthorized(c, ReasonTokenInvalid, "Invalid refresh token")
+		return
+	}
+
+	// Make sure the account is still allowed to sign in
+	userService := models.NewUserService(h.db, h.encryptor)
+	if _, err := userService.GetByID(claims.UserID); err != nil {
+		h.respondUnauthorized(c, ReasonTokenInvalid, "User not found")
 		return
 	}
 
-	token, err := h.tokenManager.GenerateToken(userID)
+	// Refreshing keeps a session alive, but not past the session policies
+	reason, err := h.refreshSession(claims, pair, c.ClientIP())
 	if err != nil {
-		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		logger.Error("Failed to refresh session", err, map[string]interface{}{
+			"session_id": claims.SessionID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to refresh session")
+		return
+	}
+	if reason != "" {
+		h.respondUnauthorized(c, reason, sessionMessage(reason))
 		return
 	}
 
-	h.respondWithSuccess(c, http.StatusOK, gin.H{"token": token})
+	h.setRefreshCookie(c, pair)
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt,
+	})
+}
+
+// setRefreshCookie stores the refresh token in an HTTP-only cookie scoped to the auth routes
+// of the API version the client uses. The cookie is only marked Secure when the server
+// terminates TLS, so local HTTP setups keep working.
+func (h *Handler) setRefreshCookie(c *gin.Context, pair *auth.TokenPair) {
+	path := "/api/auth"
+	if server.APIVersion(c.Request) >= 2 {
+		path = "/api/v2/auth"
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(refreshCookieName, pair.RefreshToken, int(auth.RefreshTokenTTL.Seconds()),
+		path, "", h.cfg.Server.TLSEnabled(), true)
 }
 
 func (h *Handler) getUserIDFromToken(c *gin.Context) (uuid.UUID, error) {
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Access is who may call a route
+type Access string
+
+const (
+	// AccessPublic routes need no credentials
+	AccessPublic Access = "public"
+	// AccessUser routes need a valid user, bot, guest or application token
+	AccessUser Access = "user"
+	// AccessAdmin routes additionally need an administrator account
+	AccessAdmin Access = "admin"
+	// AccessService routes are only served on the internal listener to authenticated services
+	AccessService Access = "service"
+)
+
+// RouteRule is the authorization rule for a single route
+type RouteRule struct {
+	Access Access `json:"access"`
+	// Scope is what a restricted (application, bot or guest) token must carry. Routes
+	// without a scope are not reachable with restricted tokens at all.
+	Scope string `json:"scope,omitempty"`
+	// Permission is the conversation action the route takes, which a group's owner can
+	// restrict. Handlers check it with requirePermission once they know the conversation.
+	Permission string `json:"permission,omitempty"`
+}
+
+// AuthzEntry is a row of the route authorization matrix
+type AuthzEntry struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+	RouteRule
+	Covered bool `json:"covered"`
+}
+
+// routeRules maps "METHOD /full/path" to its authorization rule. Every registered
+// route must have an entry; the server refuses to start otherwise. Access is enforced
+// by the middleware of each route group, and the tests check that every route not
+// marked public turns away requests without credentials.
+var routeRules = map[string]RouteRule{
+	// Authentication
+	"POST /api/auth/login":                          {Access: AccessPublic},
+	"POST /api/auth/login/verify":                   {Access: AccessPublic},
+	"POST /api/auth/register":                       {Access: AccessPublic},
+	"GET /api/auth/check":                           {Access: AccessPublic},
+	"GET /api/auth/password-policy":                 {Access: AccessPublic},
+	"POST /api/auth/refresh":                        {Access: AccessPublic},
+	"POST /api/auth/recover":                        {Access: AccessPublic},
+	"POST /api/auth/recovery-requests":              {Access: AccessPublic},
+	"POST /api/auth/recovery-requests/:id/status":   {Access: AccessPublic},
+	"POST /api/auth/recovery-requests/:id/complete": {Access: AccessPublic},
+	"POST /api/oauth/token":                         {Access: AccessPublic},
+
+	// Public infrastructure
+	"GET /api/.well-known/jwks.json":    {Access: AccessPublic},
+	"GET /api/.well-known/webfinger":    {Access: AccessPublic},
+	"GET /api/.well-known/talkify-keys": {Access: AccessPublic},
+	"GET /api/status":                   {Access: AccessPublic},
+	"GET /api/swagger/*any":             {Access: AccessPublic},
+
+	// Embedded feeds are read with an embed key, which the handler checks itself
+	"GET /api/embed/messages": {Access: AccessPublic},
+
+	// The WebSocket validates its token itself and requires the read scope
+	"GET /api/ws": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+
+	// GraphQL only reads, the WebSocket validating its token itself as /api/ws does
+	"POST /api/graphql":   {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/graphql/ws": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+
+	// Users
+	"GET /api/users/me":                               {Access: AccessUser, Scope: auth.ScopeReadProfile},
+	"PUT /api/users/me":                               {Access: AccessUser},
+	"PATCH /api/users/me":                             {Access: AccessUser},
+	"POST /api/users/me/email/confirm":                {Access: AccessUser},
+	"PUT /api/users/me/password":                      {Access: AccessUser},
+	"GET /api/users/me/usage":                         {Access: AccessUser},
+	"GET /api/users/me/devices":                       {Access: AccessUser},
+	"POST /api/users/me/login-alerts/:id/report":      {Access: AccessUser},
+	"GET /api/users/me/keyword-alerts":                {Access: AccessUser},
+	"POST /api/users/me/keyword-alerts":               {Access: AccessUser},
+	"DELETE /api/users/me/keyword-alerts/:id":         {Access: AccessUser},
+	"GET /api/users/me/notification-preferences":      {Access: AccessUser},
+	"PUT /api/users/me/notification-preferences":      {Access: AccessUser},
+	"GET /api/users/me/invite-link":                   {Access: AccessUser},
+	"GET /api/users/me/recovery-codes":                {Access: AccessUser},
+	"POST /api/users/me/recovery-codes":               {Access: AccessUser},
+	"GET /api/users/me/trusted-contacts":              {Access: AccessUser},
+	"PUT /api/users/me/trusted-contacts":              {Access: AccessUser},
+	"GET /api/users/me/recovery-requests":             {Access: AccessUser},
+	"POST /api/users/me/recovery-requests/:id/cancel": {Access: AccessUser},
+	"GET /api/users/me/recovery-approvals":            {Access: AccessUser},
+	"POST /api/users/me/recovery-approvals/:id":       {Access: AccessUser},
+	"GET /api/users/me/impersonations":                {Access: AccessUser},
+	"POST /api/users/me/impersonations/:id/approve":   {Access: AccessUser},
+	"POST /api/users/me/impersonations/:id/deny":      {Access: AccessUser},
+	"POST /api/users/me/impersonations/:id/end":       {Access: AccessUser},
+	"POST /api/users/me/heartbeat":                    {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/users/search":                           {Access: AccessUser},
+	"GET /api/federation/lookup":                      {Access: AccessUser},
+	"POST /api/federation/conversations":              {Access: AccessUser},
+	"POST /api/federation/inbox":                      {Access: AccessPublic},
+	"POST /api/users/batch":                           {Access: AccessUser},
+	"GET /api/users":                                  {Access: AccessUser},
+	"GET /api/users/:id":                              {Access: AccessUser},
+	"GET /api/users/:id/profile":                      {Access: AccessUser, Scope: auth.ScopeReadProfile},
+	"GET /api/users/:id/presence":                     {Access: AccessUser, Scope: auth.ScopeReadProfile},
+
+	// Conversations
+	"POST /api/conversations":                                       {Access: AccessUser},
+	"POST /api/conversations/invite":                                {Access: AccessUser},
+	"GET /api/conversations/templates":                              {Access: AccessUser},
+	"POST /api/conversations/from-template/:id":                     {Access: AccessUser},
+	"GET /api/conversations":                                        {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"HEAD /api/conversations":                                       {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/conversations/unread":                                 {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"HEAD /api/conversations/:id/messages":                          {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/conversations/batch":                                 {Access: AccessUser},
+	"PUT /api/conversations/pins":                                   {Access: AccessUser},
+	"GET /api/conversations/:id":                                    {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/conversations/:id/read":                              {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"PUT /api/conversations/:id/notification-preview":               {Access: AccessUser},
+	"POST /api/conversations/:id/typing":                            {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"GET /api/conversations/:id/draft":                              {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"PUT /api/conversations/:id/draft":                              {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"DELETE /api/conversations/:id/draft":                           {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"PUT /api/conversations/:id/draft/attachment":                   {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"DELETE /api/conversations/:id/draft/attachment":                {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/conversations/:id/draft/send":                        {Access: AccessUser, Scope: auth.ScopeWriteMessages, Permission: models.ActionSend},
+	"GET /api/conversations/:id/cursors":                            {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"PUT /api/conversations/:id/cursors":                            {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"GET /api/conversations/:id/analytics":                          {Access: AccessUser},
+	"GET /api/conversations/:id/analytics/reactions":                {Access: AccessUser},
+	"GET /api/conversations/:id/integrity":                          {Access: AccessUser},
+	"GET /api/conversations/:id/membership-log":                     {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/conversations/:id/files":                              {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/conversations/:id/files/archive":                     {Access: AccessUser},
+	"GET /api/conversations/:id/files/archive/:archive_id":          {Access: AccessUser},
+	"GET /api/conversations/:id/files/archive/:archive_id/download": {Access: AccessUser},
+	"POST /api/conversations/:id/exports":                           {Access: AccessUser},
+	"GET /api/conversations/:id/exports/:export_id":                 {Access: AccessUser},
+	"GET /api/conversations/:id/exports/:export_id/download":        {Access: AccessUser},
+	"POST /api/conversations/:id/delete":                            {Access: AccessUser},
+	"POST /api/conversations/:id/transfer-ownership":                {Access: AccessUser},
+	"PATCH /api/conversations/:id/settings":                         {Access: AccessUser},
+	"POST /api/conversations/:id/lock":                              {Access: AccessUser},
+	"DELETE /api/conversations/:id/lock":                            {Access: AccessUser},
+	"GET /api/conversations/:id/participants":                       {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/conversations/:id/participants":                      {Access: AccessUser},
+	"DELETE /api/conversations/:id/participants/:user_id":           {Access: AccessUser},
+	"PUT /api/conversations/:id/participants/:user_id/role":         {Access: AccessUser},
+	"GET /api/conversations/:id/automations":                        {Access: AccessUser},
+	"POST /api/conversations/:id/automations":                       {Access: AccessUser},
+	"PATCH /api/conversations/:id/automations/:automation_id":       {Access: AccessUser},
+	"DELETE /api/conversations/:id/automations/:automation_id":      {Access: AccessUser},
+	"GET /api/conversations/:id/labels":                             {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"DELETE /api/conversations/:id/labels/:label":                   {Access: AccessUser},
+	"GET /api/conversations/:id/apps":                               {Access: AccessUser},
+	"POST /api/conversations/:id/apps":                              {Access: AccessUser},
+	"DELETE /api/conversations/:id/apps/:client_id":                 {Access: AccessUser},
+	"GET /api/conversations/:id/embed-keys":                         {Access: AccessUser},
+	"POST /api/conversations/:id/embed-keys":                        {Access: AccessUser},
+	"DELETE /api/conversations/:id/embed-keys/:key_id":              {Access: AccessUser},
+	"GET /api/conversations/:id/digest":                             {Access: AccessUser},
+	"PUT /api/conversations/:id/digest":                             {Access: AccessUser},
+	"DELETE /api/conversations/:id/digest":                          {Access: AccessUser},
+
+	// Messages
+	"POST /api/messages":                        {Access: AccessUser, Scope: auth.ScopeWriteMessages, Permission: models.ActionSend},
+	"GET /api/messages/conversation/:id":        {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/messages/batch":                  {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/messages/:id/permalink":           {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/messages/:id/context":             {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"PUT /api/messages/:id":                     {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"DELETE /api/messages/:id":                  {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"DELETE /api/messages/:id/pending":          {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/messages/:id/open":               {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/messages/:id/status":             {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/messages/status/batch":           {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/messages/:id/reactions":          {Access: AccessUser, Scope: auth.ScopeWriteMessages, Permission: models.ActionReact},
+	"DELETE /api/messages/:id/reactions/:emoji": {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/messages/:id/annotations":        {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"DELETE /api/messages/:id/annotations/:key": {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"PUT /api/messages/:id/card":                {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+	"POST /api/interactions":                    {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+
+	// Media; signed URLs carry their own authorization
+	"GET /api/media/:id":         {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/media/:id/content": {Access: AccessPublic},
+
+	// Transcripts; signed URLs carry their own authorization
+	"GET /api/transcripts/:id/download": {Access: AccessPublic},
+
+	// Inbox
+	"GET /api/inbox": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+
+	// Bookmarks
+	"GET /api/bookmarks":                {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/bookmarks":               {Access: AccessUser, Scope: auth.ScopeReadMessages, Permission: models.ActionStar},
+	"PUT /api/bookmarks/:message_id":    {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"DELETE /api/bookmarks/:message_id": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/bookmarks/folders":        {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/bookmarks/folders":       {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"PUT /api/bookmarks/folders/:id":    {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"DELETE /api/bookmarks/folders/:id": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+
+	// Mentions
+	"GET /api/mentions":        {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"GET /api/mentions/unread": {Access: AccessUser, Scope: auth.ScopeReadMessages},
+	"POST /api/mentions/read":  {Access: AccessUser, Scope: auth.ScopeWriteMessages},
+
+	// Notifications
+	"GET /api/notifications":               {Access: AccessUser},
+	"POST /api/notifications/read":         {Access: AccessUser},
+	"POST /api/notifications/:id/read":     {Access: AccessUser},
+	"GET /api/broadcasts":                  {Access: AccessUser},
+	"POST /api/broadcasts/:id/acknowledge": {Access: AccessUser},
+
+	// Third-party applications
+	"POST /api/apps":                      {Access: AccessUser},
+	"GET /api/apps":                       {Access: AccessUser},
+	"DELETE /api/apps/:id":                {Access: AccessUser},
+	"GET /api/oauth/authorize":            {Access: AccessUser},
+	"POST /api/oauth/authorize":           {Access: AccessUser},
+	"GET /api/oauth/grants":               {Access: AccessUser},
+	"DELETE /api/oauth/grants/:client_id": {Access: AccessUser},
+
+	// Support queues
+	"GET /api/support":                       {Access: AccessUser},
+	"GET /api/support/tickets":               {Access: AccessUser},
+	"GET /api/support/tickets/:id":           {Access: AccessUser},
+	"POST /api/support/tickets/:id/claim":    {Access: AccessUser},
+	"POST /api/support/tickets/:id/transfer": {Access: AccessUser},
+	"POST /api/support/tickets/:id/resolve":  {Access: AccessUser},
+
+	// Workspace
+	"GET /api/workspace/branding": {Access: AccessPublic},
+
+	// Administration
+	"GET /api/admin/jwt/keys":                       {Access: AccessAdmin},
+	"POST /api/admin/jwt/keys":                      {Access: AccessAdmin},
+	"PUT /api/admin/jwt/keys/:kid/active":           {Access: AccessAdmin},
+	"DELETE /api/admin/jwt/keys/:kid":               {Access: AccessAdmin},
+	"GET /api/admin/metrics":                        {Access: AccessAdmin},
+	"GET /api/admin/config":                         {Access: AccessAdmin},
+	"POST /api/admin/config/reload":                 {Access: AccessAdmin},
+	"GET /api/admin/authz":                          {Access: AccessAdmin},
+	"POST /api/admin/conversations/:id/restore":     {Access: AccessAdmin},
+	"GET /api/admin/users/inactive":                 {Access: AccessAdmin},
+	"GET /api/admin/users/:id/delivery":             {Access: AccessAdmin},
+	"GET /api/admin/clients/versions":               {Access: AccessAdmin},
+	"PUT /api/admin/users/:id/legal-hold":           {Access: AccessAdmin},
+	"PUT /api/admin/users/:id/password-rotation":    {Access: AccessAdmin},
+	"PUT /api/admin/users/:id/verified":             {Access: AccessAdmin},
+	"GET /api/admin/impersonations":                 {Access: AccessAdmin},
+	"POST /api/admin/impersonations":                {Access: AccessAdmin},
+	"POST /api/admin/impersonations/:id/approve":    {Access: AccessAdmin},
+	"POST /api/admin/impersonations/:id/deny":       {Access: AccessAdmin},
+	"POST /api/admin/impersonations/:id/token":      {Access: AccessAdmin},
+	"POST /api/admin/impersonations/:id/end":        {Access: AccessAdmin},
+	"PUT /api/admin/conversations/:id/legal-hold":   {Access: AccessAdmin},
+	"GET /api/admin/legal-holds":                    {Access: AccessAdmin},
+	"GET /api/admin/compliance/export":              {Access: AccessAdmin},
+	"GET /api/admin/conversation-templates":         {Access: AccessAdmin},
+	"POST /api/admin/conversation-templates":        {Access: AccessAdmin},
+	"PUT /api/admin/conversation-templates/:id":     {Access: AccessAdmin},
+	"DELETE /api/admin/conversation-templates/:id":  {Access: AccessAdmin},
+	"GET /api/admin/content-filter/terms":           {Access: AccessAdmin},
+	"POST /api/admin/content-filter/terms":          {Access: AccessAdmin},
+	"DELETE /api/admin/content-filter/terms/:id":    {Access: AccessAdmin},
+	"PUT /api/admin/workspace/branding":             {Access: AccessAdmin},
+	"GET /api/admin/workspace/settings":             {Access: AccessAdmin},
+	"PUT /api/admin/workspace/settings":             {Access: AccessAdmin},
+	"GET /api/admin/storage":                        {Access: AccessAdmin},
+	"POST /api/admin/storage/cleanup":               {Access: AccessAdmin},
+	"GET /api/admin/broadcasts":                     {Access: AccessAdmin},
+	"POST /api/admin/broadcasts":                    {Access: AccessAdmin},
+	"GET /api/admin/broadcasts/:id/acknowledgments": {Access: AccessAdmin},
+	"GET /api/admin/analytics/reactions":            {Access: AccessAdmin},
+	"GET /api/admin/realtime":                       {Access: AccessAdmin},
+	"DELETE /api/admin/realtime/connections/:id":    {Access: AccessAdmin},
+
+	// Internal service-to-service listener
+	"GET /internal/whoami":                    {Access: AccessService},
+	"GET /internal/users/:id":                 {Access: AccessService},
+	"POST /internal/messages":                 {Access: AccessService},
+	"POST /internal/messages/:id/annotations": {Access: AccessService},
+	"GET /internal/compliance/stream":         {Access: AccessService},
+	"GET /internal/compliance/checkpoint":     {Access: AccessService},
+	"PUT /internal/compliance/checkpoint":     {Access: AccessService},
+	"GET /metrics":                            {Access: AccessService},
+}
+
+// requiredScope returns the scope needed to call the matched route with a restricted token, if any
+func requiredScope(c *gin.Context) (string, bool) {
+	rule, ok := routeRules[c.Request.Method+" "+c.FullPath()]
+	if !ok || rule.Scope == "" {
+		return "", false
+	}
+	return rule.Scope, true
+}
+
+// requirePermission answers 403 unless userID may take action in a conversation, as
+// restricted by its owner, and 404 unless they take part in it
+func (h *Handler) requirePermission(c *gin.Context, conversationID, userID uuid.UUID, action string) bool {
+	err := models.NewConversationService(h.db, h.encryptor).CheckPermission(conversationID, userID, action)
+	return h.respondToPermission(c, err, "Conversation not found", action)
+}
+
+// requireMessagePermission is requirePermission for the conversation of a message
+func (h *Handler) requireMessagePermission(c *gin.Context, messageID, userID uuid.UUID, action string) bool {
+	err := models.NewConversationService(h.db, h.encryptor).CheckMessagePermission(messageID, userID, action)
+	return h.respondToPermission(c, err, "Message not found", action)
+}
+
+func (h *Handler) respondToPermission(c *gin.Context, err error, notFound, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, notFound)
+	case errors.Is(err, models.ErrPermissionDenied):
+		h.respondWithError(c, http.StatusForbidden, permissionDenied[action])
+	case errors.Is(err, models.ErrConversationLocked):
+		h.respondWithError(c, http.StatusForbidden, "The conversation is locked; only admins can post until it is unlocked")
+	default:
+		logger.Error("Failed to check conversation permission", err, map[string]interface{}{
+			"action": action,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check permission")
+	}
+	return false
+}
+
+// permissionDenied explains each restricted action
+var permissionDenied = map[string]string{
+	models.ActionSend:  "You can't send messages in this conversation",
+	models.ActionReply: "You can't reply in this conversation",
+	models.ActionReact: "You can't react in this conversation",
+	models.ActionStar:  "You can't bookmark messages from this conversation",
+}
+
+// AuthzMatrix joins the registered routes with their authorization rules, sorted by path
+func AuthzMatrix(routes gin.RoutesInfo) []AuthzEntry {
+	entries := make([]AuthzEntry, 0, len(routes))
+	for _, route := range routes {
+		rule, ok := routeRules[route.Method+" "+route.Path]
+		entries = append(entries, AuthzEntry{
+			Method:    route.Method,
+			Path:      route.Path,
+			Handler:   route.Handler,
+			RouteRule: rule,
+			Covered:   ok,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Method < entries[j].Method
+	})
+	return entries
+}
+
+// UncoveredRoutes returns the registered routes that have no authorization rule.
+// A route missing here would otherwise be served without anyone deciding who may call it.
+func UncoveredRoutes(routes gin.RoutesInfo) []string {
+	var uncovered []string
+	for _, entry := range AuthzMatrix(routes) {
+		if !entry.Covered {
+			uncovered = append(uncovered, entry.Method+" "+entry.Path)
+		}
+	}
+	return uncovered
+}
+
+// @Summary Get authorization matrix
+// @Description Every registered route with who may call it, the scope restricted tokens need and the conversation permission, which group owners can restrict, that it takes
+// @Tags admin
+// @Produce json
+// @Success 200 {array} AuthzEntry
+// @Failure 403 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/authz [get]
+func (h *Handler) GetAuthzMatrix(c *gin.Context) {
+	h.respondWithSuccess(c, http.StatusOK, AuthzMatrix(h.routes()))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"talkify/apps/api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRouters registers the public and service routes the way the server does, without
+// a database or keys: requests without credentials must be turned away before needing them
+func testRouters(t *testing.T) (public, service *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.GraphQL.Enabled = true
+	h := NewHandler(cfg, config.NewLive(cfg, ""), nil, nil, nil, nil)
+	public = gin.New()
+	h.RegisterRoutes(public.Group("/api"))
+	service = gin.New()
+	h.RegisterServiceRoutes(service)
+	return public, service
+}
+
+// examplePath fills in the parameters of a route path
+func examplePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			segments[i] = "00000000-0000-0000-0000-000000000001"
+		case strings.HasPrefix(segment, "*"):
+			segments[i] = "x"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func TestEveryRouteHasARule(t *testing.T) {
+	public, service := testRouters(t)
+	for _, route := range UncoveredRoutes(append(public.Routes(), service.Routes()...)) {
+		t.Errorf("%s has no authorization rule", route)
+	}
+}
+
+func TestRoutesRejectRequestsWithoutCredentials(t *testing.T) {
+	public, service := testRouters(t)
+	for _, router := range []*gin.Engine{public, service} {
+		for _, entry := range AuthzMatrix(router.Routes()) {
+			if !entry.Covered || entry.Access == AccessPublic {
+				continue
+			}
+			t.Run(entry.Method+" "+entry.Path, func(t *testing.T) {
+				req := httptest.NewRequest(entry.Method, examplePath(entry.Path), nil)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("%s access answered %d without credentials, want 401", entry.Access, rec.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestStreamingRoutesAreRegistered(t *testing.T) {
+	public, _ := testRouters(t)
+	registered := make(map[string]bool)
+	for _, route := range public.Routes() {
+		registered[route.Path] = true
+	}
+	for _, path := range StreamingRoutes {
+		if !registered[path] {
+			t.Errorf("streaming route %s is not registered", path)
+		}
+	}
+}
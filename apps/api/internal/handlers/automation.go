@@ -0,0 +1,605 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// CreateAutomationRequest adds an automation to a group
+type CreateAutomationRequest struct {
+	Event  string `json:"event" binding:"required,oneof=participant.joined participant.left message.created" example:"participant.joined"`
+	Action string `json:"action" binding:"required,oneof=post_message webhook notify_user add_label" example:"post_message"`
+	// Posted by post_message automations and sent by notify_user ones; {user} is
+	// replaced with the username of the participant or sender
+	Message string `json:"message" binding:"max=2000" example:"Welcome, {user}!"`
+	// Called by webhook automations; must be HTTPS on a host the server allows
+	WebhookURL string `json:"webhook_url" example:"https://hooks.example.com/talkify"`
+	// Notified by notify_user automations; must take part in the conversation
+	NotifyUserID *uuid.UUID `json:"notify_user_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// Added by add_label automations
+	Label string `json:"label" binding:"max=50" example:"incident"`
+	AutomationFilters
+}
+
+// AutomationFilters narrow down the events an automation runs on and shape its webhooks
+type AutomationFilters struct {
+	// MessageTypes limits message.created automations to these message types
+	MessageTypes []string `json:"message_types" binding:"omitempty,max=6,dive,oneof=text image video audio file location" example:"text"`
+	// SenderPattern is a glob the username of the sender, or of the participant joining
+	// or leaving, has to match
+	SenderPattern *string `json:"sender_pattern" binding:"omitempty,max=64" example:"deploy-*"`
+	// PayloadTemplate is a Go template producing the JSON body of webhooks from the
+	// AutomationEvent, whose fields it reads by their JSON names; {{json .x}} writes a
+	// value as JSON
+	PayloadTemplate *string `json:"payload_template" binding:"omitempty,max=4000" example:"{\"text\": {{json .message.content}}}"`
+	// ContentPattern is a regular expression message.created automations need the
+	// message content to match
+	ContentPattern *string `json:"content_pattern" binding:"omitempty,max=200" example:"(?i)\\bdown\\b"`
+	// Keywords limits message.created automations to messages using one of them as a word
+	Keywords []string `json:"keywords" binding:"omitempty,max=20,dive,min=1,max=64" example:"outage"`
+}
+
+// CreateAutomationResponse is a new automation. Webhooks come with the secret their
+// deliveries are signed with, which is only shown once.
+type CreateAutomationResponse struct {
+	models.Automation
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// UpdateAutomationRequest turns an automation on or off and changes its filters. Fields
+// left out are kept; empty ones clear the filter or template.
+type UpdateAutomationRequest struct {
+	Enabled *bool `json:"enabled"`
+	AutomationFilters
+}
+
+// AutomationEvent is the body of automation webhooks
+type AutomationEvent struct {
+	AutomationID   uuid.UUID `json:"automation_id"`
+	Event          string    `json:"event"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Username       string    `json:"username"`
+	ActorID        uuid.UUID `json:"actor_id"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	// Message is set on message.created events, whose user is the sender
+	Message *AutomationMessage `json:"message,omitempty"`
+}
+
+// AutomationMessage is the message of a message.created automation webhook
+type AutomationMessage struct {
+	ID          uuid.UUID  `json:"id"`
+	MessageType string     `json:"message_type"`
+	Content     string     `json:"content"`
+	ReplyToID   *uuid.UUID `json:"reply_to_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// @Summary List conversation automations
+// @Description List the automations of a group. Only its owner and admins can see them.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {array} models.Automation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/automations [get]
+func (h *Handler) GetAutomations(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	automations, err := automationService.List(conversationID, userID)
+	if err != nil {
+		h.respondWithAutomationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, automations)
+}
+
+// @Summary Create a conversation automation
+// @Description Run an action whenever a participant joins or leaves a group, or a message is sent to it: post a message, send a signed webhook, notify a participant or label the group. Messages can be matched by type, by a regular expression on their content and by keywords; a glob on the username of the sender or participant narrows down any event. Shape webhook bodies with payload_template, a Go template producing JSON from the AutomationEvent. Automations running more than the server allows per minute are skipped until they calm down, and messages they post never set automations off. Webhook deliveries carry X-Talkify-Timestamp and X-Talkify-Signature, the hex HMAC-SHA256 of the timestamp, a dot and the body keyed with the returned secret. Only the owner and admins can add automations.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param automation body CreateAutomationRequest true "Automation"
+// @Success 201 {object} CreateAutomationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/automations [post]
+func (h *Handler) CreateAutomation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req CreateAutomationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	if req.Event != models.AutomationMessageCreated &&
+		(len(req.MessageTypes) > 0 || req.ContentPattern != nil || len(req.Keywords) > 0) {
+		h.respondWithError(c, http.StatusBadRequest, "message_types, content_pattern and keywords only apply to message.created")
+		return
+	}
+	if req.PayloadTemplate != nil && req.Action != models.AutomationWebhook {
+		h.respondWithError(c, http.StatusBadRequest, "Only webhook automations have a payload_template")
+		return
+	}
+	if msg := checkAutomationFilters(req.AutomationFilters); msg != "" {
+		h.respondWithError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	automation := &models.Automation{
+		ConversationID:  conversationID,
+		Event:           req.Event,
+		Action:          req.Action,
+		MessageTypes:    req.MessageTypes,
+		SenderPattern:   emptyToNil(req.SenderPattern),
+		PayloadTemplate: emptyToNil(req.PayloadTemplate),
+		ContentPattern:  emptyToNil(req.ContentPattern),
+		Keywords:        req.Keywords,
+	}
+	switch req.Action {
+	case models.AutomationPostMessage, models.AutomationNotifyUser:
+		message := strings.TrimSpace(req.Message)
+		if message == "" {
+			h.respondWithError(c, http.StatusBadRequest, req.Action+" automations need a message")
+			return
+		}
+		automation.Message = &message
+		if req.Action == models.AutomationNotifyUser {
+			if req.NotifyUserID == nil {
+				h.respondWithError(c, http.StatusBadRequest, "notify_user automations need a notify_user_id")
+				return
+			}
+			automation.NotifyUserID = req.NotifyUserID
+		}
+	case models.AutomationAddLabel:
+		label := strings.ToLower(strings.TrimSpace(req.Label))
+		if label == "" {
+			h.respondWithError(c, http.StatusBadRequest, "add_label automations need a label")
+			return
+		}
+		automation.Label = &label
+	case models.AutomationWebhook:
+		if !h.webhooks.Enabled() {
+			h.respondWithError(c, http.StatusBadRequest, "Webhooks are not enabled on this server")
+			return
+		}
+		if err := h.webhooks.Check(req.WebhookURL); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "webhook_url must be an HTTPS URL on an allowed host")
+			return
+		}
+		automation.WebhookURL = &req.WebhookURL
+	}
+
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	secret, err := automationService.Create(userID, automation, h.cfg.Automation.MaxPerConversation)
+	if err != nil {
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			h.respondWithError(c, http.StatusConflict,
+				fmt.Sprintf("A conversation can have at most %d automations", h.cfg.Automation.MaxPerConversation))
+			return
+		}
+		h.respondWithAutomationError(c, err)
+		return
+	}
+
+	logger.Info("Created conversation automation", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.automation_create",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"automation_id":   automation.ID,
+		"event":           automation.Event,
+		"automation":      automation.Action,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, CreateAutomationResponse{Automation: *automation, WebhookSecret: secret})
+}
+
+// @Summary Update a conversation automation
+// @Description Turn an automation of a group on or off, or change its filters and payload template
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param automation_id path string true "Automation ID"
+// @Param automation body UpdateAutomationRequest true "Whether the automation runs"
+// @Success 200 {object} models.Automation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/automations/{automation_id} [patch]
+func (h *Handler) UpdateAutomation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	automationID, err := uuid.Parse(c.Param("automation_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid automation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req UpdateAutomationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	if msg := checkAutomationFilters(req.AutomationFilters); msg != "" {
+		h.respondWithError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	automation, err := automationService.Update(conversationID, automationID, userID, models.AutomationUpdate{
+		Enabled:         req.Enabled,
+		MessageTypes:    req.MessageTypes,
+		SenderPattern:   req.SenderPattern,
+		PayloadTemplate: req.PayloadTemplate,
+		ContentPattern:  req.ContentPattern,
+		Keywords:        req.Keywords,
+	})
+	if err != nil {
+		h.respondWithAutomationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, automation)
+}
+
+// @Summary Delete a conversation automation
+// @Description Remove an automation from a group
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param automation_id path string true "Automation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/automations/{automation_id} [delete]
+func (h *Handler) DeleteAutomation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	automationID, err := uuid.Parse(c.Param("automation_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid automation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	if err := automationService.Delete(conversationID, automationID, userID); err != nil {
+		h.respondWithAutomationError(c, err)
+		return
+	}
+
+	logger.Info("Deleted conversation automation", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.automation_delete",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"automation_id":   automationID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Automation deleted"})
+}
+
+// @Summary List conversation labels
+// @Description List the labels automations have put on a group
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {array} models.ConversationLabel
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/labels [get]
+func (h *Handler) GetConversationLabels(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	labels, err := models.NewConversationLabelService(h.db).List(conversationID, userID)
+	if err != nil {
+		h.respondWithAutomationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, labels)
+}
+
+// @Summary Remove a conversation label
+// @Description Take a label off a group. Only its owner and admins can remove labels.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param label path string true "Label"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/labels/{label} [delete]
+func (h *Handler) RemoveConversationLabel(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	label := strings.ToLower(c.Param("label"))
+	if err := models.NewConversationLabelService(h.db).Remove(conversationID, userID, label); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Label not found")
+			return
+		}
+		h.respondWithAutomationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Label removed"})
+}
+
+// checkAutomationFilters returns what is wrong with a sender pattern or payload
+// template, or an empty string
+func checkAutomationFilters(filters AutomationFilters) string {
+	if filters.SenderPattern != nil {
+		if _, err := path.Match(*filters.SenderPattern, ""); err != nil {
+			return "sender_pattern is not a valid pattern"
+		}
+	}
+	if filters.PayloadTemplate != nil && *filters.PayloadTemplate != "" {
+		if _, err := webhook.ParseTemplate(*filters.PayloadTemplate); err != nil {
+			return err.Error()
+		}
+	}
+	if filters.ContentPattern != nil && *filters.ContentPattern != "" {
+		if _, err := regexp.Compile(*filters.ContentPattern); err != nil {
+			return "content_pattern is not a valid regular expression"
+		}
+	}
+	return ""
+}
+
+func (h *Handler) respondWithAutomationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Automation not found")
+	case errors.Is(err, models.ErrGroupOnly):
+		h.respondWithError(c, http.StatusBadRequest, "Only groups have automations")
+	case errors.Is(err, models.ErrAutomationTarget):
+		h.respondWithError(c, http.StatusBadRequest, "Only participants can be notified")
+	case errors.Is(err, models.ErrNotAdmin):
+		h.respondWithError(c, http.StatusForbidden, "Only the owner and admins can manage automations")
+	default:
+		logger.Error("Failed to manage automations", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage automations")
+	}
+}
+
+// runAutomations runs a conversation's automations for a participant event in the
+// background. userID joined or left; actorID made it happen.
+func (h *Handler) runAutomations(conversationID uuid.UUID, event string, userID, actorID uuid.UUID) {
+	occurredAt := time.Now()
+	h.submitTask("run_automations", func() error {
+		userService := models.NewUserService(h.db, h.encryptor)
+		username := ""
+		if user, err := userService.GetByID(userID); err == nil {
+			username = user.Username
+		}
+
+		return h.runAutomationRules(models.AutomationTrigger{Username: username}, AutomationEvent{
+			Event:          event,
+			ConversationID: conversationID,
+			UserID:         userID,
+			Username:       username,
+			ActorID:        actorID,
+			OccurredAt:     occurredAt,
+		})
+	})
+}
+
+// runMessageAutomations runs the message.created automations of a new message's
+// conversation in the background. content is the message's plaintext.
+func (h *Handler) runMessageAutomations(message *models.Message, content string) {
+	if message.MessageType == string(models.SystemMessage) {
+		return
+	}
+	event := AutomationEvent{
+		Event:          models.AutomationMessageCreated,
+		ConversationID: message.ConversationID,
+		UserID:         message.SenderID,
+		ActorID:        message.SenderID,
+		OccurredAt:     message.CreatedAt,
+		Message: &AutomationMessage{
+			ID:          message.ID,
+			MessageType: message.MessageType,
+			Content:     content,
+			ReplyToID:   message.ReplyToID,
+			CreatedAt:   message.CreatedAt,
+		},
+	}
+	h.submitTask("run_message_automations", func() error {
+		userService := models.NewUserService(h.db, h.encryptor)
+		if user, err := userService.GetByID(event.UserID); err == nil {
+			event.Username = user.Username
+		}
+
+		return h.runAutomationRules(models.AutomationTrigger{
+			Username:    event.Username,
+			MessageType: event.Message.MessageType,
+			Content:     content,
+		}, event)
+	})
+}
+
+// runAutomationRules runs the enabled automations of the event's conversation whose
+// conditions the trigger meets. Automations past their runs per minute are skipped, so
+// one that keeps setting itself off, say through a webhook receiver posting back,
+// stops until things calm down.
+func (h *Handler) runAutomationRules(trigger models.AutomationTrigger, event AutomationEvent) error {
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	automations, err := automationService.ForEvent(event.ConversationID, event.Event)
+	if err != nil {
+		return err
+	}
+
+	for _, automation := range automations {
+		if !automation.Matches(trigger) {
+			continue
+		}
+		claimed, err := automationService.ClaimRun(automation.ID, h.cfg.Automation.MaxRunsPerMinute)
+		if err != nil {
+			return err
+		}
+		var runErr error
+		if claimed {
+			event.AutomationID = automation.ID
+			runErr = h.runAutomation(&automation, event)
+		} else {
+			runErr = fmt.Errorf("skipped: ran more than %d times in a minute", h.cfg.Automation.MaxRunsPerMinute)
+		}
+		if err := h.recordAutomationRun(automationService, &automation, runErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAutomation carries out an automation's action
+func (h *Handler) runAutomation(automation *models.Automation, event AutomationEvent) error {
+	switch automation.Action {
+	case models.AutomationPostMessage:
+		return h.sendSystemMessage(event.ConversationID, event.ActorID, strings.ReplaceAll(*automation.Message, "{user}", event.Username))
+	case models.AutomationWebhook:
+		return h.deliverAutomation(automation, event)
+	case models.AutomationNotifyUser:
+		// The user may have left since the automation was made
+		isParticipant, err := models.NewConversationService(h.db, h.encryptor).IsParticipant(event.ConversationID, *automation.NotifyUserID)
+		if err != nil || !isParticipant {
+			return err
+		}
+		var name *string
+		if err := h.db.Get(&name, `SELECT name FROM conversations WHERE id = $1`, event.ConversationID); err != nil {
+			return err
+		}
+		title := "Automation"
+		if name != nil && *name != "" {
+			title = *name
+		}
+		return h.notify(*automation.NotifyUserID, models.NotificationAutomation, title,
+			strings.ReplaceAll(*automation.Message, "{user}", event.Username))
+	case models.AutomationAddLabel:
+		added, err := models.NewConversationLabelService(h.db).Add(event.ConversationID, automation.ID, *automation.Label)
+		if err == nil && added {
+			logger.Info("Conversation labelled by automation", map[string]interface{}{
+				"conversation_id": event.ConversationID,
+				"automation_id":   automation.ID,
+				"label":           *automation.Label,
+			})
+		}
+		return err
+	}
+	return nil
+}
+
+// deliverAutomation sends an event to an automation's webhook, shaped by its payload
+// template when it has one
+func (h *Handler) deliverAutomation(automation *models.Automation, event AutomationEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Automation.WebhookTimeout)
+	defer cancel()
+	if automation.PayloadTemplate == nil {
+		return h.webhooks.Deliver(ctx, *automation.WebhookURL, *automation.WebhookSecret, event)
+	}
+
+	tmpl, err := webhook.ParseTemplate(*automation.PayloadTemplate)
+	if err != nil {
+		return err
+	}
+	body, err := tmpl.Render(event)
+	if err != nil {
+		return err
+	}
+	return h.webhooks.DeliverBody(ctx, *automation.WebhookURL, *automation.WebhookSecret, body)
+}
+
+// recordAutomationRun logs a failed run and records how the automation last went
+func (h *Handler) recordAutomationRun(automationService *models.AutomationService, automation *models.Automation, runErr error) error {
+	if runErr != nil {
+		logger.Warn("Conversation automation failed", map[string]interface{}{
+			"conversation_id": automation.ConversationID,
+			"automation_id":   automation.ID,
+			"error":           runErr.Error(),
+		})
+	}
+	return automationService.RecordRun(automation.ID, runErr)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BatchLookupRequest lists the IDs to resolve, at most 100
+type BatchLookupRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// BatchUsersResponse maps the requested IDs to users. IDs of unknown or deactivated
+// accounts are listed as missing.
+type BatchUsersResponse struct {
+	Found   map[uuid.UUID]*models.PublicUser `json:"found"`
+	Missing []uuid.UUID                      `json:"missing"`
+}
+
+// BatchMessagesResponse maps the requested IDs to messages. IDs of messages the user
+// can't read are listed as missing, like ones that don't exist.
+type BatchMessagesResponse struct {
+	Found   map[uuid.UUID]*models.Message `json:"found"`
+	Missing []uuid.UUID                   `json:"missing"`
+}
+
+// @Summary Look up users by ID
+// @Description Resolve up to 100 user IDs at once, for mentions and participant lists. Only what other users may see of each account is returned.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body BatchLookupRequest true "User IDs"
+// @Success 200 {object} BatchUsersResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/batch [post]
+func (h *Handler) BatchGetUsers(c *gin.Context) {
+	ids, ok := h.bindBatchLookup(c)
+	if !ok {
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	users, err := userService.GetByIDs(ids)
+	if err != nil {
+		logger.Error("Failed to look up users", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get users")
+		return
+	}
+
+	response := BatchUsersResponse{Found: make(map[uuid.UUID]*models.PublicUser, len(users))}
+	for i := range users {
+		response.Found[users[i].ID] = users[i].Public()
+	}
+	response.Missing = missingIDs(ids, func(id uuid.UUID) bool { return response.Found[id] != nil })
+	h.respondWithSuccess(c, http.StatusOK, response)
+}
+
+// @Summary Look up messages by ID
+// @Description Resolve up to 100 message IDs at once, for replies and links to messages. Messages the user can't read, because they aren't in the conversation or the message is before their visible history, are reported missing.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param request body BatchLookupRequest true "Message IDs"
+// @Param compact query bool false "Return BatchCompactMessagesResponse, with reaction and read counts instead of the details; defaults to true when the Save-Data: on header is sent"
+// @Success 200 {object} BatchMessagesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/batch [post]
+func (h *Handler) BatchGetMessages(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	compact, ok := h.wantsCompact(c)
+	if !ok {
+		return
+	}
+	ids, ok := h.bindBatchLookup(c)
+	if !ok {
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	messages, err := messageService.GetByIDsForUser(ids, userID)
+	if err != nil {
+		logger.Error("Failed to look up messages", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	if compact {
+		response := BatchCompactMessagesResponse{Found: make(map[uuid.UUID]*CompactMessage, len(messages))}
+		for i := range messages {
+			response.Found[messages[i].ID] = compactMessage(&messages[i])
+		}
+		response.Missing = missingIDs(ids, func(id uuid.UUID) bool { return response.Found[id] != nil })
+		h.respondWithSuccess(c, http.StatusOK, response)
+		return
+	}
+
+	response := BatchMessagesResponse{Found: make(map[uuid.UUID]*models.Message, len(messages))}
+	for i := range messages {
+		response.Found[messages[i].ID] = &messages[i]
+	}
+	response.Missing = missingIDs(ids, func(id uuid.UUID) bool { return response.Found[id] != nil })
+	h.respondWithSuccess(c, http.StatusOK, response)
+}
+
+// bindBatchLookup reads the IDs of a batch lookup, without duplicates
+func (h *Handler) bindBatchLookup(c *gin.Context) ([]uuid.UUID, bool) {
+	var req BatchLookupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return nil, false
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.IDs))
+	ids := make([]uuid.UUID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+// missingIDs returns the ids that weren't found, in the order they were asked for
+func missingIDs(ids []uuid.UUID, found func(uuid.UUID) bool) []uuid.UUID {
+	missing := []uuid.UUID{}
+	for _, id := range ids {
+		if !found(id) {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
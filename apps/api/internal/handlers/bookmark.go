@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SaveBookmarkRequest bookmarks a message. Saving one that is bookmarked already
+// refiles it and replaces its note.
+type SaveBookmarkRequest struct {
+	MessageID uuid.UUID  `json:"message_id" binding:"required" example:"123e4567-e89b-12d3-a456-426614174000"`
+	FolderID  *uuid.UUID `json:"folder_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// Note is private to the user saving the message
+	Note *string `json:"note" binding:"omitempty,max=1000" example:"Try this one on Sunday"`
+}
+
+// UpdateBookmarkRequest refiles a bookmark and replaces its note; leaving either out
+// clears it
+type UpdateBookmarkRequest struct {
+	FolderID *uuid.UUID `json:"folder_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Note     *string    `json:"note" binding:"omitempty,max=1000" example:"Try this one on Sunday"`
+}
+
+// BookmarkFolderRequest names a bookmark folder
+type BookmarkFolderRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"Recipes"`
+}
+
+func (h *Handler) RegisterBookmarkRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetBookmarks)
+		r.POST("", h.SaveBookmark)
+		r.PUT("/:message_id", h.UpdateBookmark)
+		r.DELETE("/:message_id", h.DeleteBookmark)
+		r.GET("/folders", h.GetBookmarkFolders)
+		r.POST("/folders", h.CreateBookmarkFolder)
+		r.PUT("/folders/:id", h.RenameBookmarkFolder)
+		r.DELETE("/folders/:id", h.DeleteBookmarkFolder)
+	}
+}
+
+// @Summary List bookmarks
+// @Description List the messages the user saved, most recently saved first, with their notes. Filter by folder, and search the messages, their senders and the notes with q. Bookmarks of messages the user can no longer read are left out.
+// @Tags bookmarks
+// @Produce json
+// @Param folder_id query string false "Only bookmarks in this folder"
+// @Param q query string false "Only bookmarks whose message, sender or note contains this"
+// @Param limit query int false "Number of bookmarks to return (1-100)" default(50)
+// @Param offset query int false "Number of bookmarks to skip" default(0)
+// @Success 200 {array} models.Bookmark
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks [get]
+func (h *Handler) GetBookmarks(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	filter := models.BookmarkFilter{Query: c.Query("q")}
+	if folder := c.Query("folder_id"); folder != "" {
+		folderID, err := uuid.Parse(folder)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid folder ID")
+			return
+		}
+		filter.FolderID = &folderID
+	}
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	bookmarks, err := models.NewBookmarkService(h.db, h.encryptor).List(userID, filter, page.Limit, page.Offset)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	setPageHeaders(c, page, len(bookmarks), -1)
+	h.respondWithSuccess(c, http.StatusOK, bookmarks)
+}
+
+// @Summary Bookmark a message
+// @Description Save a message the user can read, optionally in one of their folders and with a private note. Saving a message again refiles it and replaces its note.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Param bookmark body SaveBookmarkRequest true "Message to save"
+// @Success 201 {object} models.Bookmark
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks [post]
+func (h *Handler) SaveBookmark(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req SaveBookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if !h.requireMessagePermission(c, req.MessageID, userID, models.ActionStar) {
+		return
+	}
+
+	bookmark, err := models.NewBookmarkService(h.db, h.encryptor).Save(userID, req.MessageID, req.FolderID, req.Note)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusCreated, bookmark)
+}
+
+// @Summary Update a bookmark
+// @Description Move a bookmark to another folder and replace its note. Leaving folder_id out takes it out of its folder; leaving note out clears the note.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Param message_id path string true "Message ID"
+// @Param bookmark body UpdateBookmarkRequest true "Folder and note"
+// @Success 200 {object} models.Bookmark
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/{message_id} [put]
+func (h *Handler) UpdateBookmark(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req UpdateBookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	bookmark, err := models.NewBookmarkService(h.db, h.encryptor).Update(userID, messageID, req.FolderID, req.Note)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, bookmark)
+}
+
+// @Summary Remove a bookmark
+// @Description Remove a message from the user's bookmarks
+// @Tags bookmarks
+// @Produce json
+// @Param message_id path string true "Message ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/{message_id} [delete]
+func (h *Handler) DeleteBookmark(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.NewBookmarkService(h.db, h.encryptor).Delete(userID, messageID); err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
+
+// @Summary List bookmark folders
+// @Description List the user's bookmark folders by name, with how many bookmarks each holds
+// @Tags bookmarks
+// @Produce json
+// @Success 200 {array} models.BookmarkFolder
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/folders [get]
+func (h *Handler) GetBookmarkFolders(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	folders, err := models.NewBookmarkService(h.db, h.encryptor).GetFolders(userID)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, folders)
+}
+
+// @Summary Create a bookmark folder
+// @Description Create a folder to file bookmarks in. Folder names are unique per user.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Param folder body BookmarkFolderRequest true "Folder name"
+// @Success 201 {object} models.BookmarkFolder
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/folders [post]
+func (h *Handler) CreateBookmarkFolder(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req BookmarkFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Folder name cannot be blank")
+		return
+	}
+
+	folder, err := models.NewBookmarkService(h.db, h.encryptor).CreateFolder(userID, name)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusCreated, folder)
+}
+
+// @Summary Rename a bookmark folder
+// @Description Rename one of the user's bookmark folders
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param folder body BookmarkFolderRequest true "Folder name"
+// @Success 200 {object} models.BookmarkFolder
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/folders/{id} [put]
+func (h *Handler) RenameBookmarkFolder(c *gin.Context) {
+	folderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req BookmarkFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Folder name cannot be blank")
+		return
+	}
+
+	folder, err := models.NewBookmarkService(h.db, h.encryptor).RenameFolder(folderID, userID, name)
+	if err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, folder)
+}
+
+// @Summary Delete a bookmark folder
+// @Description Delete one of the user's bookmark folders. The bookmarks in it are kept, outside any folder.
+// @Tags bookmarks
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /bookmarks/folders/{id} [delete]
+func (h *Handler) DeleteBookmarkFolder(c *gin.Context) {
+	folderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.NewBookmarkService(h.db, h.encryptor).DeleteFolder(folderID, userID); err != nil {
+		h.respondWithBookmarkError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Folder deleted"})
+}
+
+func (h *Handler) respondWithBookmarkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Message not found")
+	case errors.Is(err, models.ErrBookmarkFolderNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Folder not found")
+	case errors.Is(err, models.ErrConflict):
+		h.respondWithError(c, http.StatusConflict, "A folder with this name already exists")
+	case errors.Is(err, models.ErrBookmarkLimit):
+		h.respondWithError(c, http.StatusConflict, "Bookmark limit reached")
+	default:
+		logger.Error("Failed to manage bookmarks", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage bookmarks")
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxWorkspaceNameLength matches the workspace_branding.name column
+const maxWorkspaceNameLength = 100
+
+// UpdateBrandingRequest replaces the workspace branding; an empty logo URL or accent
+// color removes it
+type UpdateBrandingRequest struct {
+	Name          string  `json:"name" binding:"required" example:"Acme Chat"`
+	LogoURL       *string `json:"logo_url" example:"https://example.com/logo.png"`
+	AccentColor   *string `json:"accent_color" example:"#3b82f6"`
+	DefaultStatus string  `json:"default_status" binding:"required" example:"Hey, I'm using Acme Chat!"`
+}
+
+func (h *Handler) RegisterWorkspaceRoutes(r *gin.RouterGroup) {
+	r.GET("/branding", h.GetBranding)
+}
+
+// @Summary Get workspace branding
+// @Description Get the name, logo and accent color clients show for the workspace, and the status new users start with. Needs no credentials, so clients can load it at startup.
+// @Tags workspace
+// @Produce json
+// @Success 200 {object} models.WorkspaceBranding
+// @Success 304 "Not modified"
+// @Failure 500 {object} ErrorResponse
+// @Router /workspace/branding [get]
+func (h *Handler) GetBranding(c *gin.Context) {
+	branding, err := models.NewBrandingService(h.db).Get()
+	if err != nil {
+		logger.Error("Failed to get workspace branding", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get workspace branding")
+		return
+	}
+	h.respondWithETag(c, branding)
+}
+
+// @Summary Update workspace branding
+// @Description Set the name, logo and accent color clients show for the workspace, and the status new users start with. Existing users keep their status.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param branding body UpdateBrandingRequest true "Workspace branding"
+// @Success 200 {object} models.WorkspaceBranding
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/workspace/branding [put]
+func (h *Handler) UpdateBranding(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req UpdateBrandingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	branding := &models.WorkspaceBranding{
+		Name:          strings.TrimSpace(req.Name),
+		LogoURL:       emptyToNil(req.LogoURL),
+		AccentColor:   emptyToNil(req.AccentColor),
+		DefaultStatus: strings.TrimSpace(req.DefaultStatus),
+		UpdatedBy:     &adminID,
+	}
+	if problem := validateBranding(branding); problem != "" {
+		h.respondWithError(c, http.StatusBadRequest, problem)
+		return
+	}
+
+	if err := models.NewBrandingService(h.db).Update(branding); err != nil {
+		logger.Error("Failed to update workspace branding", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to update workspace branding")
+		return
+	}
+
+	logger.Info("Updated workspace branding", map[string]interface{}{
+		"audit":    true,
+		"action":   "workspace.branding_update",
+		"admin_id": adminID,
+		"name":     branding.Name,
+	})
+	h.respondWithSuccess(c, http.StatusOK, branding)
+}
+
+// validateBranding returns a message describing the first invalid field, if any
+func validateBranding(branding *models.WorkspaceBranding) string {
+	if branding.Name == "" || utf8.RuneCountInString(branding.Name) > maxWorkspaceNameLength {
+		return fmt.Sprintf("name must be 1 to %d characters", maxWorkspaceNameLength)
+	}
+	if branding.LogoURL != nil {
+		u, err := url.Parse(*branding.LogoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(*branding.LogoURL) > 2048 {
+			return "logo_url must be an http or https URL"
+		}
+	}
+	if branding.AccentColor != nil && !accentColorPattern.MatchString(*branding.AccentColor) {
+		return "accent_color must be a hex color such as #3b82f6"
+	}
+	if branding.DefaultStatus == "" || utf8.RuneCountInString(branding.DefaultStatus) > maxStatusLength {
+		return fmt.Sprintf("default_status must be 1 to %d characters", maxStatusLength)
+	}
+	return ""
+}
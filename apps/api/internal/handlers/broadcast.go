@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// broadcastDeliveryBatch bounds the recipients loaded at once while delivering
+const broadcastDeliveryBatch = 100
+
+// UrgentBroadcastRequest sends an urgent broadcast
+type UrgentBroadcastRequest struct {
+	Title string `json:"title" binding:"required,max=200" example:"Checkout is down"`
+	Body  string `json:"body" binding:"required,max=4000" example:"Join the incident bridge now."`
+	// ConversationID limits the broadcast to the conversation's participants; it goes
+	// to every active user otherwise
+	ConversationID *uuid.UUID `json:"conversation_id"`
+}
+
+// UrgentBroadcastResponse is a broadcast that was just sent
+type UrgentBroadcastResponse struct {
+	*models.UrgentBroadcast
+	Recipients int `json:"recipients"`
+}
+
+// BroadcastReport is who a broadcast reached and who acknowledged it
+type BroadcastReport struct {
+	*models.BroadcastSummary
+	// Recipients are listed with those yet to acknowledge first
+	Recipients []models.BroadcastRecipient `json:"recipient_status"`
+}
+
+// BroadcastAcknowledgment confirms a recipient acknowledged a broadcast
+type BroadcastAcknowledgment struct {
+	BroadcastID    uuid.UUID `json:"broadcast_id"`
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+}
+
+func (h *Handler) RegisterBroadcastRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetPendingBroadcasts)
+		r.POST("/:id/acknowledge", h.AcknowledgeBroadcast)
+	}
+}
+
+// @Summary Send an urgent broadcast
+// @Description Send an urgent message to every active user, or to the participants of a conversation such as an incident bridge. It is delivered through every channel a recipient can be reached on: their notification center, connected clients and email. Recipients are asked to acknowledge it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param broadcast body UrgentBroadcastRequest true "Broadcast"
+// @Success 201 {object} UrgentBroadcastResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/broadcasts [post]
+func (h *Handler) CreateUrgentBroadcast(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req UrgentBroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	broadcast := &models.UrgentBroadcast{
+		SenderID:       &adminID,
+		ConversationID: req.ConversationID,
+		Title:          strings.TrimSpace(req.Title),
+		Body:           strings.TrimSpace(req.Body),
+	}
+	if broadcast.Title == "" || broadcast.Body == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Title and body must not be blank")
+		return
+	}
+
+	broadcastService := models.NewBroadcastService(h.db)
+	recipients, err := broadcastService.Create(broadcast)
+	if err != nil {
+		h.respondWithBroadcastError(c, err)
+		return
+	}
+
+	logger.Info("Sent urgent broadcast", map[string]interface{}{
+		"audit":           true,
+		"action":          "broadcast.send",
+		"admin_id":        adminID,
+		"broadcast_id":    broadcast.ID,
+		"conversation_id": broadcast.ConversationID,
+		"recipients":      recipients,
+	})
+	h.submitTask("deliver_urgent_broadcast", func() error {
+		return h.deliverBroadcast(broadcast)
+	})
+
+	h.respondWithSuccess(c, http.StatusCreated, UrgentBroadcastResponse{
+		UrgentBroadcast: broadcast,
+		Recipients:      recipients,
+	})
+}
+
+// deliverBroadcast sends a broadcast through every channel each recipient can be
+// reached on, recording which ones it went out through
+func (h *Handler) deliverBroadcast(broadcast *models.UrgentBroadcast) error {
+	broadcastService := models.NewBroadcastService(h.db)
+	recipientIDs, err := broadcastService.RecipientIDs(broadcast.ID)
+	if err != nil {
+		return err
+	}
+
+	notificationService := models.NewNotificationService(h.db)
+	userService := models.NewUserService(h.db, h.encryptor)
+	subject := "[Urgent] " + broadcast.Title
+	emailBody := broadcast.Body + "\n\nOpen Talkify to acknowledge that you have seen this message.\n"
+
+	for start := 0; start < len(recipientIDs); start += broadcastDeliveryBatch {
+		end := start + broadcastDeliveryBatch
+		if end > len(recipientIDs) {
+			end = len(recipientIDs)
+		}
+		users, err := userService.GetByIDs(recipientIDs[start:end])
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			var channels []string
+			if _, err := notificationService.Create(user.ID, models.NotificationUrgentBroadcast, broadcast.Title, broadcast.Body); err != nil {
+				logger.Error("Failed to add urgent broadcast notification", err, map[string]interface{}{
+					"broadcast_id": broadcast.ID,
+					"user_id":      user.ID,
+				})
+			} else {
+				channels = append(channels, models.BroadcastChannelNotification)
+			}
+
+			if h.mailer != nil && user.Email != "" {
+				if err := h.mailer.Send(user.Email, subject, emailBody); err != nil {
+					logger.Error("Failed to email urgent broadcast", err, map[string]interface{}{
+						"broadcast_id": broadcast.ID,
+						"user_id":      user.ID,
+					})
+				} else {
+					channels = append(channels, models.BroadcastChannelEmail)
+				}
+			}
+
+			if len(channels) > 0 {
+				if err := broadcastService.MarkDelivered(broadcast.ID, user.ID, channels); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Connected clients are told about the broadcast itself so they can ask for an
+		// acknowledgment straight away
+		ids := make([]uuid.UUID, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+		h.publishToUsers(ids, EventUrgentBroadcast, broadcast)
+	}
+	return nil
+}
+
+// @Summary List urgent broadcasts
+// @Description List urgent broadcasts, newest first, with how many recipients they reached and how many acknowledged them
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Number of broadcasts to return (1-100)" default(20)
+// @Param offset query int false "Number of broadcasts to skip" default(0)
+// @Success 200 {array} models.BroadcastSummary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/broadcasts [get]
+func (h *Handler) GetUrgentBroadcasts(c *gin.Context) {
+	page, ok := h.parsePage(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	broadcastService := models.NewBroadcastService(h.db)
+	summaries, err := broadcastService.List(page.Limit, page.Offset)
+	if err != nil {
+		h.respondWithBroadcastError(c, err)
+		return
+	}
+	setPageHeaders(c, page, len(summaries), -1)
+	h.respondWithSuccess(c, http.StatusOK, summaries)
+}
+
+// @Summary Get an urgent broadcast's acknowledgments
+// @Description Report which recipients an urgent broadcast reached, through which channels, and who acknowledged it. Those yet to acknowledge are listed first.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/broadcasts/{id}/acknowledgments [get]
+func (h *Handler) GetBroadcastAcknowledgments(c *gin.Context) {
+	broadcastID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	broadcastService := models.NewBroadcastService(h.db)
+	summary, recipients, err := broadcastService.Report(broadcastID)
+	if err != nil {
+		h.respondWithBroadcastError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, BroadcastReport{
+		BroadcastSummary: summary,
+		Recipients:       recipients,
+	})
+}
+
+// @Summary List unacknowledged urgent broadcasts
+// @Description List the urgent broadcasts the user has yet to acknowledge, newest first
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} models.UrgentBroadcast
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /broadcasts [get]
+func (h *Handler) GetPendingBroadcasts(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	broadcastService := models.NewBroadcastService(h.db)
+	broadcasts, err := broadcastService.Pending(userID)
+	if err != nil {
+		h.respondWithBroadcastError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, broadcasts)
+}
+
+// @Summary Acknowledge an urgent broadcast
+// @Description Confirm the user has seen an urgent broadcast. Acknowledging again keeps the first time.
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastAcknowledgment
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /broadcasts/{id}/acknowledge [post]
+func (h *Handler) AcknowledgeBroadcast(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	broadcastID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid broadcast ID")
+		return
+	}
+
+	broadcastService := models.NewBroadcastService(h.db)
+	acknowledgedAt, err := broadcastService.Acknowledge(broadcastID, userID)
+	if err != nil {
+		h.respondWithBroadcastError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, BroadcastAcknowledgment{
+		BroadcastID:    broadcastID,
+		AcknowledgedAt: acknowledgedAt,
+	})
+}
+
+func (h *Handler) respondWithBroadcastError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Broadcast not found")
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	default:
+		logger.Error("Failed to handle urgent broadcast", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to handle broadcast")
+	}
+}
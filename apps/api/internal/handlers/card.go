@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// prepareAppCard checks a card sent with an application's token and marks it as the
+// application's, so that its actions are routed back to it
+func (h *Handler) prepareAppCard(c *gin.Context, card *models.MessageCard, messageType models.MessageType) bool {
+	app, ok := h.cardApplication(c)
+	if !ok {
+		return false
+	}
+	card.ApplicationID = &app.ID
+	return h.checkCard(c, card, messageType, true)
+}
+
+// cardApplication returns the application behind the request's token. Only
+// applications handle cards, so other tokens are turned away.
+func (h *Handler) cardApplication(c *gin.Context) (*models.OAuthApplication, bool) {
+	value, ok := c.Get("claims")
+	if !ok || !value.(*auth.Claims).IsAppToken() {
+		h.respondWithError(c, http.StatusForbidden, "Only applications can send cards")
+		return nil, false
+	}
+	app, err := models.NewOAuthService(h.db).GetApplicationByClientID(value.(*auth.Claims).ClientID)
+	if err != nil {
+		if errors.Is(err, models.ErrApplicationNotFound) {
+			h.respondWithError(c, http.StatusForbidden, "Access for this application has been revoked")
+		} else {
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to get application")
+		}
+		return nil, false
+	}
+	return app, true
+}
+
+// checkCard validates a card against the card schema, answering 400 when it doesn't
+// follow it
+func (h *Handler) checkCard(c *gin.Context, card *models.MessageCard, messageType models.MessageType, callbacks bool) bool {
+	if messageType != models.TextMessage {
+		h.respondWithError(c, http.StatusBadRequest, "Only text messages can have a card")
+		return false
+	}
+	if err := card.Validate(callbacks); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/clientversion"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// clientRecordInterval is how often the same user, platform and version is written
+	// to the database; requests in between only refresh the cache
+	clientRecordInterval = time.Hour
+	// maxClientCache bounds the recently recorded clients kept in memory
+	maxClientCache = 100000
+)
+
+// clientCache remembers which clients were recorded recently
+type clientCache struct {
+	mu       sync.Mutex
+	recorded map[string]time.Time
+}
+
+// due reports whether key should be recorded now, and marks it recorded when it should
+func (cc *clientCache) due(key string, now time.Time) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if at, ok := cc.recorded[key]; ok && now.Sub(at) < clientRecordInterval {
+		return false
+	}
+	if cc.recorded == nil || len(cc.recorded) >= maxClientCache {
+		cc.recorded = make(map[string]time.Time)
+	}
+	cc.recorded[key] = now
+	return true
+}
+
+// ClientVersionsReport is how the users active recently are spread over app versions
+type ClientVersionsReport struct {
+	Since time.Time `json:"since"`
+	// MinVersions are the oldest versions served on each platform
+	MinVersions map[string]string    `json:"min_versions"`
+	Versions    []ClientVersionStats `json:"versions"`
+}
+
+// ClientVersionStats is how many users are on a version, and whether it is still served
+type ClientVersionStats struct {
+	models.ClientVersionCount
+	Supported bool `json:"supported"`
+}
+
+// recordClient notes the app version the user's client reports, at most once an hour
+// for the same version. Clients that report none are not recorded.
+func (h *Handler) recordClient(c *gin.Context, userID uuid.UUID) {
+	platform := clientversion.Platform(c.GetHeader(clientversion.PlatformHeader))
+	version, err := clientversion.Parse(c.GetHeader(clientversion.VersionHeader))
+	if platform == "" || err != nil {
+		return
+	}
+
+	normalized := version.String()
+	if !h.clients.due(userID.String()+"/"+platform+"/"+normalized, time.Now()) {
+		return
+	}
+	h.submitTask("record_client_version", func() error {
+		return models.NewClientService(h.db).Record(userID, platform, normalized)
+	})
+}
+
+// @Summary Get client version distribution
+// @Description Get how many of the users active in the last days are on each app version, by the X-Client-Platform and X-Client-Version headers their clients send, to plan raising the minimum supported versions. Users are counted under the version they used last.
+// @Tags admin
+// @Produce json
+// @Param days query int false "Only count users active this many days, 1 to 365" default(30)
+// @Success 200 {object} ClientVersionsReport
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/clients/versions [get]
+func (h *Handler) GetClientVersions(c *gin.Context) {
+	days := 30
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			h.respondWithError(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = parsed
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	counts, err := models.NewClientService(h.db).Distribution(since)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get client versions")
+		return
+	}
+
+	minVersions := h.live.Runtime().MinClientVersions
+	report := ClientVersionsReport{
+		Since:       since,
+		MinVersions: minVersions,
+		Versions:    make([]ClientVersionStats, 0, len(counts)),
+	}
+	for _, count := range counts {
+		supported := true
+		if minimum, ok := minVersions[count.Platform]; ok {
+			oldest, errOldest := clientversion.Parse(minimum)
+			version, errVersion := clientversion.Parse(count.Version)
+			supported = errOldest != nil || errVersion != nil || version.Compare(oldest) >= 0
+		}
+		report.Versions = append(report.Versions, ClientVersionStats{ClientVersionCount: count, Supported: supported})
+	}
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes the server ends WebSocket connections with, in the range reserved for
+// applications. The reason of the close frame is a CloseReason in JSON, which tells the
+// client whether and when to reconnect. Connections closed by the client, or lost, get
+// no close frame from the server.
+const (
+	// CloseAuthExpired: the session of the connection was revoked. Reconnecting needs a
+	// new access token, and the user may have to sign in again.
+	CloseAuthExpired = 4001
+	// CloseDuplicateSession: in single-session mode, the user connected elsewhere. The
+	// client should not reconnect unless the user asks to.
+	CloseDuplicateSession = 4002
+	// CloseProtocolError: the client sent a frame the server could not parse.
+	// Reconnecting would fail the same way.
+	CloseProtocolError = 4003
+	// CloseRateLimited: the client sent messages faster than allowed. It can reconnect
+	// after RetryAfter.
+	CloseRateLimited = 4008
+	// CloseTooSlow: the client fell too far behind on events. It can reconnect at once
+	// with last_event_id to catch up.
+	CloseTooSlow = 4009
+	// CloseServerDraining: the server is shutting down. The client can reconnect after
+	// RetryAfter, spread out with jitter, to reach another node or the restarted one.
+	CloseServerDraining = 4010
+	// CloseDisconnected: an administrator closed the connection. The client can
+	// reconnect after RetryAfter.
+	CloseDisconnected = 4011
+)
+
+// CloseReason is the reason a connection was closed with, sent as JSON in the close frame
+type CloseReason struct {
+	// Code is sent as the close code rather than in the reason
+	Code int `json:"-"`
+	// Reason names the code, e.g. "rate_limited"
+	Reason string `json:"reason"`
+	// Reconnect tells whether reconnecting as before can succeed
+	Reconnect bool `json:"reconnect"`
+	// RetryAfter is how many seconds to wait before reconnecting
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+var (
+	closeAuthExpired      = &CloseReason{Code: CloseAuthExpired, Reason: "auth_expired"}
+	closeDuplicateSession = &CloseReason{Code: CloseDuplicateSession, Reason: "duplicate_session"}
+	closeProtocolError    = &CloseReason{Code: CloseProtocolError, Reason: "protocol_error"}
+	closeRateLimited      = &CloseReason{Code: CloseRateLimited, Reason: "rate_limited", Reconnect: true, RetryAfter: 10}
+	closeTooSlow          = &CloseReason{Code: CloseTooSlow, Reason: "too_slow", Reconnect: true}
+	closeServerDraining   = &CloseReason{Code: CloseServerDraining, Reason: "server_draining", Reconnect: true, RetryAfter: 5}
+	closeDisconnected     = &CloseReason{Code: CloseDisconnected, Reason: "disconnected", Reconnect: true, RetryAfter: 1}
+)
+
+// closeMessage returns the payload of the close frame for reason. Without a reason the
+// connection is closed normally.
+func closeMessage(reason *CloseReason) []byte {
+	if reason == nil {
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	}
+	text, err := json.Marshal(reason)
+	if err != nil {
+		text = []byte(reason.Reason)
+	}
+	return websocket.FormatCloseMessage(reason.Code, string(text))
+}
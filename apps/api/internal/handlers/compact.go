@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CompactMessage is a message without its heavy fields, for clients on slow or metered
+// connections: the reactions are counted per emoji, readers are counted, and the
+// sender and replied-to message are left to the client to resolve by ID
+type CompactMessage struct {
+	ID                uuid.UUID      `json:"id"`
+	ConversationID    uuid.UUID      `json:"conversation_id"`
+	SenderID          uuid.UUID      `json:"sender_id"`
+	ReplyToID         *uuid.UUID     `json:"reply_to_id,omitempty"`
+	Content           string         `json:"content"`
+	MessageType       string         `json:"type"`
+	MediaURL          *string        `json:"media_url,omitempty"`
+	MediaThumbnailURL *string        `json:"media_thumbnail_url,omitempty"`
+	MediaSize         *int           `json:"media_size,omitempty"`
+	MediaDuration     *int           `json:"media_duration,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	Status            *string        `json:"status,omitempty"`
+	ReadCount         int            `json:"read_count"`
+	ReactionCounts    map[string]int `json:"reaction_counts,omitempty"`
+	IsEdited          bool           `json:"is_edited"`
+	IsDeleted         bool           `json:"is_deleted"`
+	ViewOnce          bool           `json:"view_once"`
+	// Display is set like the full message's
+	Display *models.DisplayHints `json:"display,omitempty"`
+}
+
+// BatchCompactMessagesResponse is BatchMessagesResponse with compact messages
+type BatchCompactMessagesResponse struct {
+	Found   map[uuid.UUID]*CompactMessage `json:"found"`
+	Missing []uuid.UUID                   `json:"missing"`
+}
+
+// compactMessage trims a message to its compact form
+func compactMessage(message *models.Message) *CompactMessage {
+	compact := &CompactMessage{
+		ID:                message.ID,
+		ConversationID:    message.ConversationID,
+		SenderID:          message.SenderID,
+		ReplyToID:         message.ReplyToID,
+		Content:           message.Content,
+		MessageType:       message.MessageType,
+		MediaURL:          message.MediaURL,
+		MediaThumbnailURL: message.MediaThumbnailURL,
+		MediaSize:         message.MediaSize,
+		MediaDuration:     message.MediaDuration,
+		CreatedAt:         message.CreatedAt,
+		UpdatedAt:         message.UpdatedAt,
+		Status:            message.Status,
+		ReadCount:         len(message.ReadBy),
+		IsEdited:          message.IsEdited,
+		IsDeleted:         message.IsDeleted,
+		ViewOnce:          message.ViewOnce,
+		Display:           message.Display,
+	}
+	if len(message.Reactions) > 0 {
+		compact.ReactionCounts = make(map[string]int)
+		for _, reaction := range message.Reactions {
+			compact.ReactionCounts[reaction.Emoji]++
+		}
+	}
+	return compact
+}
+
+func compactMessages(messages []models.Message) []*CompactMessage {
+	compact := make([]*CompactMessage, len(messages))
+	for i := range messages {
+		compact[i] = compactMessage(&messages[i])
+	}
+	return compact
+}
+
+// wantsCompact reports whether the client asked for compact messages, with
+// ?compact=true or, when the parameter is absent, the Save-Data: on client hint. It
+// answers 400 for a compact value that isn't a boolean.
+func (h *Handler) wantsCompact(c *gin.Context) (bool, bool) {
+	// Responses differ by the hint, so caches must keep them apart
+	c.Writer.Header().Add("Vary", "Save-Data")
+
+	value, ok := c.GetQuery("compact")
+	if !ok {
+		return strings.EqualFold(strings.TrimSpace(c.GetHeader("Save-Data")), "on"), true
+	}
+	compact, err := strconv.ParseBool(value)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "compact must be true or false")
+		return false, false
+	}
+	return compact, true
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/compliance"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ExportHeader opens a compliance export and records what it covers
+type ExportHeader struct {
+	UserID         *uuid.UUID `json:"user_id,omitempty"`
+	ConversationID *uuid.UUID `json:"conversation_id,omitempty"`
+	From           *time.Time `json:"from,omitempty"`
+	To             *time.Time `json:"to,omitempty"`
+	GeneratedAt    time.Time  `json:"generated_at"`
+	GeneratedBy    string     `json:"generated_by"`
+}
+
+// @Summary List legal holds
+// @Description List the users and conversations on legal hold. Held data is skipped by retention jobs and can be exported.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.LegalHolds
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/legal-holds [get]
+func (h *Handler) GetLegalHolds(c *gin.Context) {
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+	holds, err := complianceService.ListHolds()
+	if err != nil {
+		logger.Error("Failed to list legal holds", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list legal holds")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, holds)
+}
+
+// @Summary Set a conversation's legal hold
+// @Description Put a conversation on legal hold, which keeps retention jobs from removing it even once deleted, or lift the hold
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body SetLegalHoldRequest true "Legal hold"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversations/{id}/legal-hold [put]
+func (h *Handler) SetConversationLegalHold(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	var req SetLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+	if err := complianceService.SetConversationHold(conversationID, *req.LegalHold); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+			return
+		}
+		logger.Error("Failed to set legal hold", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set legal hold")
+		return
+	}
+
+	logger.Info("Changed legal hold", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.legal_hold",
+		"conversation_id": conversationID,
+		"legal_hold":      *req.LegalHold,
+		"admin_id":        c.GetHeader("X-User-ID"),
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"conversation_id": conversationID, "legal_hold": *req.LegalHold})
+}
+
+// @Summary Export held messages
+// @Description Export the messages sent by a user or in a conversation on legal hold, including deleted ones, as JSON Lines. Each line carries the hash of the previous one and the final manifest line is signed with the compliance key, so the export can be checked for tampering with cmd/verify_export.
+// @Tags admin
+// @Produce application/x-ndjson
+// @Param user_id query string false "Export messages sent by this user"
+// @Param conversation_id query string false "Export messages in this conversation"
+// @Param from query string false "Only messages sent at or after this time (RFC 3339)"
+// @Param to query string false "Only messages sent before this time (RFC 3339)"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/compliance/export [get]
+func (h *Handler) ExportCompliance(c *gin.Context) {
+	if h.cfg.Compliance.SigningKey == "" {
+		h.respondWithError(c, http.StatusServiceUnavailable, "Compliance exports are not configured")
+		return
+	}
+
+	var filter models.ExportFilter
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		filter.UserID = &id
+	}
+	if raw := c.Query("conversation_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+			return
+		}
+		filter.ConversationID = &id
+	}
+	if (filter.UserID == nil) == (filter.ConversationID == nil) {
+		h.respondWithError(c, http.StatusBadRequest, "Exactly one of user_id and conversation_id is required")
+		return
+	}
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid from. Must be an RFC 3339 time")
+			return
+		}
+		filter.From = &from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid to. Must be an RFC 3339 time")
+			return
+		}
+		filter.To = &to
+	}
+
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+	held, err := complianceService.IsHeld(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User or conversation not found")
+			return
+		}
+		logger.Error("Failed to check legal hold", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check legal hold")
+		return
+	}
+	if !held {
+		h.respondWithError(c, http.StatusConflict, "Only data on legal hold can be exported")
+		return
+	}
+
+	adminID := c.GetHeader("X-User-ID")
+	logger.Info("Compliance export started", map[string]interface{}{
+		"audit":           true,
+		"action":          "compliance.export",
+		"user_id":         filter.UserID,
+		"conversation_id": filter.ConversationID,
+		"admin_id":        adminID,
+	})
+
+	// Exports can take longer to send than the server's write timeout allows
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="compliance-%s.jsonl"`, time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+
+	// Once streaming has started a failure can only cut the export short; the missing
+	// manifest makes that detectable
+	export := compliance.NewWriter(c.Writer, h.cfg.Compliance.SigningKey)
+	err = export.Write(compliance.KindHeader, ExportHeader{
+		UserID:         filter.UserID,
+		ConversationID: filter.ConversationID,
+		From:           filter.From,
+		To:             filter.To,
+		GeneratedAt:    time.Now(),
+		GeneratedBy:    adminID,
+	})
+	if err == nil {
+		err = complianceService.ExportMessages(filter, func(message *models.ComplianceMessage) error {
+			return export.Write(compliance.KindMessage, message)
+		})
+	}
+	if err == nil {
+		err = export.Close()
+	}
+	if err != nil {
+		logger.Error("Compliance export failed", err, map[string]interface{}{
+			"user_id":         filter.UserID,
+			"conversation_id": filter.ConversationID,
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// complianceStreamBatch is how many events the stream reads at a time
+	complianceStreamBatch = 500
+	// complianceStreamPoll is how often the stream looks for new events once it has
+	// caught up
+	complianceStreamPoll = time.Second
+	// complianceStreamKeepalive is how long the stream may stay silent before it sends
+	// a comment, so proxies don't take it for dead
+	complianceStreamKeepalive = 15 * time.Second
+)
+
+// ComplianceCheckpointRequest records the offset up to which a recorder has stored
+// the stream
+type ComplianceCheckpointRequest struct {
+	Offset *int64 `json:"offset" binding:"required"`
+}
+
+// ComplianceCheckpoint is where a recorder's stream resumes
+type ComplianceCheckpoint struct {
+	Recorder string `json:"recorder"`
+	Offset   int64  `json:"offset"`
+	// OldestOffset and LatestOffset bound the events that can still be replayed
+	OldestOffset int64 `json:"oldest_offset"`
+	LatestOffset int64 `json:"latest_offset"`
+}
+
+// complianceRecorder returns the name of the calling service when it is a configured
+// compliance recorder, answering 503 or 403 otherwise
+func (h *Handler) complianceRecorder(c *gin.Context) (string, bool) {
+	if h.complianceSealer == nil {
+		h.respondWithError(c, http.StatusServiceUnavailable, "The compliance stream is not configured")
+		return "", false
+	}
+	service := c.GetString("service")
+	if !slices.Contains(h.cfg.Compliance.Recorders, service) {
+		h.respondWithError(c, http.StatusForbidden, "Only compliance recorders can read the compliance stream")
+		return "", false
+	}
+	return service, true
+}
+
+// StreamComplianceEvents streams every new, edited and deleted message as server-sent
+// events, for compliance recorders. Each event's id is its offset and its data a
+// compliance.StreamEvent, encrypted with the stream key and signed with the compliance
+// key. The stream starts after the offset given by after, or by Last-Event-ID when a
+// recorder reconnects, or else after the recorder's checkpoint. Starting before the
+// oldest retained event is refused with 410.
+func (h *Handler) StreamComplianceEvents(c *gin.Context) {
+	recorder, ok := h.complianceRecorder(c)
+	if !ok {
+		return
+	}
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+
+	raw := c.Query("after")
+	if raw == "" {
+		raw = c.GetHeader("Last-Event-ID")
+	}
+	var after int64
+	if raw != "" {
+		offset, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || offset < 0 {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		after = offset
+	} else {
+		checkpoint, err := complianceService.Checkpoint(recorder)
+		if err != nil {
+			logger.Error("Failed to get compliance checkpoint", err, map[string]interface{}{
+				"recorder": recorder,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to start the compliance stream")
+			return
+		}
+		after = checkpoint
+	}
+
+	oldest, _, err := complianceService.StreamBounds()
+	if err != nil {
+		logger.Error("Failed to get compliance stream bounds", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to start the compliance stream")
+		return
+	}
+	if oldest > 0 && after < oldest-1 {
+		h.respondWithError(c, http.StatusGone, fmt.Sprintf("Events after offset %d are no longer retained; the oldest is %d", after, oldest))
+		return
+	}
+
+	logger.Info("Compliance stream started", map[string]interface{}{
+		"audit":    true,
+		"action":   "compliance.stream",
+		"recorder": recorder,
+		"after":    after,
+	})
+
+	// The stream stays open for as long as the recorder listens
+	controller := http.NewResponseController(c.Writer)
+	controller.SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	controller.Flush()
+
+	ticker := time.NewTicker(complianceStreamPoll)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		events, err := complianceService.StreamEventsAfter(after, complianceStreamBatch)
+		if err != nil {
+			// The recorder reconnects and resumes from the last event it got
+			logger.Error("Compliance stream failed", err, map[string]interface{}{
+				"recorder": recorder,
+				"after":    after,
+			})
+			return
+		}
+		for i := range events {
+			event := &events[i]
+			sealed, err := h.complianceSealer.Seal(event.Offset, event.Event, event.OccurredAt, event)
+			if err != nil {
+				logger.Error("Failed to seal compliance event", err, map[string]interface{}{
+					"offset": event.Offset,
+				})
+				return
+			}
+			data, err := json.Marshal(sealed)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Offset, event.Event, data); err != nil {
+				return
+			}
+			after = event.Offset
+		}
+		if len(events) > 0 {
+			lastWrite = time.Now()
+			if controller.Flush() != nil {
+				return
+			}
+		}
+		if len(events) == complianceStreamBatch {
+			continue
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-h.streamsClosed:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(lastWrite) >= complianceStreamKeepalive {
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil || controller.Flush() != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+	}
+}
+
+// GetComplianceCheckpoint returns where the calling recorder's stream resumes
+func (h *Handler) GetComplianceCheckpoint(c *gin.Context) {
+	recorder, ok := h.complianceRecorder(c)
+	if !ok {
+		return
+	}
+	h.respondWithComplianceCheckpoint(c, recorder)
+}
+
+// SetComplianceCheckpoint records the offset up to which the calling recorder has
+// durably stored the stream, which is where its stream resumes when it connects
+// without an offset
+func (h *Handler) SetComplianceCheckpoint(c *gin.Context) {
+	recorder, ok := h.complianceRecorder(c)
+	if !ok {
+		return
+	}
+	var req ComplianceCheckpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+	_, latest, err := complianceService.StreamBounds()
+	if err != nil {
+		logger.Error("Failed to get compliance stream bounds", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to save checkpoint")
+		return
+	}
+	if *req.Offset < 0 || *req.Offset > latest {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Offset must be between 0 and %d", latest))
+		return
+	}
+	if err := complianceService.SaveCheckpoint(recorder, *req.Offset); err != nil {
+		logger.Error("Failed to save compliance checkpoint", err, map[string]interface{}{
+			"recorder": recorder,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to save checkpoint")
+		return
+	}
+	h.respondWithComplianceCheckpoint(c, recorder)
+}
+
+func (h *Handler) respondWithComplianceCheckpoint(c *gin.Context, recorder string) {
+	complianceService := models.NewComplianceService(h.db, h.encryptor)
+	offset, err := complianceService.Checkpoint(recorder)
+	if err != nil {
+		logger.Error("Failed to get compliance checkpoint", err, map[string]interface{}{
+			"recorder": recorder,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get checkpoint")
+		return
+	}
+	oldest, latest, err := complianceService.StreamBounds()
+	if err != nil {
+		logger.Error("Failed to get compliance stream bounds", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get checkpoint")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, ComplianceCheckpoint{
+		Recorder:     recorder,
+		Offset:       offset,
+		OldestOffset: oldest,
+		LatestOffset: latest,
+	})
+}
+
+// PurgeComplianceEvents forgets stream events older than the stream retention
+func (h *Handler) PurgeComplianceEvents() error {
+	purged, err := models.NewComplianceService(h.db, h.encryptor).PurgeStreamEvents(time.Now().Add(-h.cfg.Compliance.StreamRetention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged compliance stream events", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// contentFilterSource and contentFilterKey are where the filter's decision about a
+	// message is kept among its annotations
+	contentFilterSource = "content_filter"
+	contentFilterKey    = "decision"
+	// maxContentFilterTermLength matches the content_filter_terms.term column
+	maxContentFilterTermLength = 100
+)
+
+// AddContentFilterTermRequest adds a term to the profanity wordlist of a locale
+type AddContentFilterTermRequest struct {
+	Locale string `json:"locale" binding:"required" example:"en"`
+	Term   string `json:"term" binding:"required"`
+}
+
+// SetContentFilter sets the wordlists messages are filtered with
+func (h *Handler) SetContentFilter(filter *contentfilter.Filter) {
+	h.contentFilter = filter
+}
+
+// filterContent runs the profanity filter of a conversation over content, returning
+// what to store and the annotation recording what the filter did, which is nil when
+// nothing matched. Content the conversation blocks returns contentfilter.ErrBlocked.
+func (h *Handler) filterContent(conversationID uuid.UUID, content string) (string, *models.MessageAnnotation, error) {
+	contentFilterService := models.NewContentFilterService(h.db)
+	override, err := contentFilterService.ConversationOverride(conversationID)
+	if err != nil {
+		return "", nil, err
+	}
+	mode, locale := h.cfg.ContentFilter.Mode, h.cfg.ContentFilter.Locale
+	if override.Mode != nil {
+		mode = *override.Mode
+	}
+	if override.Locale != nil {
+		locale = *override.Locale
+	}
+	if mode == contentfilter.ModeOff || content == "" {
+		return content, nil, nil
+	}
+	locale, _ = contentfilter.NormalizeLocale(locale)
+
+	custom, err := contentFilterService.Terms(locale)
+	if err != nil {
+		return "", nil, err
+	}
+	terms := append(append([]string{}, h.contentFilter.Terms(locale)...), custom...)
+	filtered, decision, err := contentfilter.Apply(content, mode, locale, terms)
+	if decision == nil {
+		return content, nil, err
+	}
+	value, _ := json.Marshal(decision)
+	return filtered, &models.MessageAnnotation{
+		Source: contentFilterSource,
+		Key:    contentFilterKey,
+		Value:  value,
+	}, err
+}
+
+// filterMessage filters a new or edited message before it is stored, adding the
+// decision to its annotations
+func (h *Handler) filterMessage(message *models.Message) error {
+	content, annotation, err := h.filterContent(message.ConversationID, message.Content)
+	if err != nil {
+		return err
+	}
+	message.Content = content
+	if annotation != nil {
+		message.Annotations = append(message.Annotations, *annotation)
+	}
+	return nil
+}
+
+// applyContentFilter runs filterMessage, answering 422 when the conversation blocks the
+// message
+func (h *Handler) applyContentFilter(c *gin.Context, message *models.Message) bool {
+	if err := h.filterMessage(message); err != nil {
+		h.respondWithContentFilterError(c, message, err)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) respondWithContentFilterError(c *gin.Context, message *models.Message, err error) {
+	switch {
+	case errors.Is(err, contentfilter.ErrBlocked):
+		logger.Info("Blocked message by the content filter", map[string]interface{}{
+			"conversation_id": message.ConversationID,
+			"sender_id":       message.SenderID,
+		})
+		h.respondWithError(c, http.StatusUnprocessableEntity, "The message contains words this conversation doesn't allow")
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	default:
+		logger.Error("Failed to filter message", err, map[string]interface{}{
+			"conversation_id": message.ConversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to filter message")
+	}
+}
+
+// @Summary List content filter terms
+// @Description List the terms admins added to the profanity wordlists, on top of those the server is deployed with
+// @Tags admin
+// @Produce json
+// @Param locale query string false "Only list the terms of this locale"
+// @Success 200 {array} models.ContentFilterTerm
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/content-filter/terms [get]
+func (h *Handler) GetContentFilterTerms(c *gin.Context) {
+	locale := c.Query("locale")
+	if locale != "" {
+		normalized, ok := contentfilter.NormalizeLocale(locale)
+		if !ok {
+			h.respondWithError(c, http.StatusBadRequest, "locale must be a locale such as en or pt-BR")
+			return
+		}
+		locale = normalized
+	}
+
+	terms, err := models.NewContentFilterService(h.db).List(locale)
+	if err != nil {
+		logger.Error("Failed to list content filter terms", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list terms")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, terms)
+}
+
+// @Summary Add a content filter term
+// @Description Add a term to the profanity wordlist of a locale. Terms match whole words whatever their case, and apply to new and edited messages in conversations filtered with the locale or a regional variant of it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param term body AddContentFilterTermRequest true "Term to add"
+// @Success 201 {object} models.ContentFilterTerm
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/content-filter/terms [post]
+func (h *Handler) AddContentFilterTerm(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req AddContentFilterTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	locale, ok := contentfilter.NormalizeLocale(req.Locale)
+	if !ok {
+		h.respondWithError(c, http.StatusBadRequest, "locale must be a locale such as en or pt-BR")
+		return
+	}
+	term := contentfilter.NormalizeTerm(req.Term)
+	if term == "" || utf8.RuneCountInString(term) > maxContentFilterTermLength {
+		h.respondWithError(c, http.StatusBadRequest, "term must be 1 to 100 characters")
+		return
+	}
+
+	added := &models.ContentFilterTerm{Locale: locale, Term: term, CreatedBy: &adminID}
+	if err := models.NewContentFilterService(h.db).Add(added); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			h.respondWithError(c, http.StatusConflict, "The term is already listed for this locale")
+			return
+		}
+		logger.Error("Failed to add content filter term", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to add term")
+		return
+	}
+
+	logger.Info("Added content filter term", map[string]interface{}{
+		"audit":    true,
+		"action":   "content_filter.term_add",
+		"admin_id": adminID,
+		"term_id":  added.ID,
+		"locale":   locale,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, added)
+}
+
+// @Summary Remove a content filter term
+// @Description Remove a term an admin added to a profanity wordlist. Messages it was masked in stay masked.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Term ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/content-filter/terms/{id} [delete]
+func (h *Handler) RemoveContentFilterTerm(c *gin.Context) {
+	termID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid term ID")
+		return
+	}
+
+	removed, err := models.NewContentFilterService(h.db).Remove(termID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Term not found")
+			return
+		}
+		logger.Error("Failed to remove content filter term", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to remove term")
+		return
+	}
+
+	logger.Info("Removed content filter term", map[string]interface{}{
+		"audit":    true,
+		"action":   "content_filter.term_remove",
+		"admin_id": c.GetHeader("X-User-ID"),
+		"term_id":  termID,
+		"locale":   removed.Locale,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Term removed"})
+}
@@ -3,7 +3,14 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/fieldset"
 	"talkify/apps/api/internal/logger"
 	"talkify/apps/api/internal/models"
 
@@ -12,6 +19,15 @@ import (
 	"github.com/pkg/errors"
 )
 
+// syncTokenHeader carries the token for the next conversation list delta
+const syncTokenHeader = "X-Sync-Token"
+
+// previewFillBatch is how many missing last message previews a job run computes
+const previewFillBatch = 500
+
+// orphanCleanupBatch is how many rows of each kind a cleanup job run removes
+const orphanCleanupBatch = 1000
+
 type CreateConversationRequest struct {
 	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1" example:"['123e4567-e89b-12d3-a456-426614174000']"`
 	Name    *string     `json:"name,omitempty" example:"My Group Chat"`
@@ -26,27 +42,138 @@ type UpdateParticipantRoleRequest struct {
 	Role   string    `json:"role" binding:"required" example:"admin"`
 }
 
+type TransferOwnershipRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// UpdateConversationSettingsRequest changes a conversation's settings. Omitted fields
+// are left as they are; empty strings clear them.
+type UpdateConversationSettingsRequest struct {
+	AvatarURL   *string              `json:"avatar_url,omitempty" example:"https://example.com/avatar.png"`
+	AccentColor *string              `json:"accent_color,omitempty" example:"#3b82f6"`
+	Theme       *string              `json:"theme,omitempty" example:"ocean"`
+	Nicknames   map[uuid.UUID]string `json:"nicknames,omitempty"`
+	// ContentFilterMode is off, mask or block and ContentFilterLocale picks the wordlist,
+	// such as en or pt-BR; empty strings follow the server. In groups only the owner and
+	// admins can set them.
+	ContentFilterMode   *string `json:"content_filter_mode,omitempty" example:"mask"`
+	ContentFilterLocale *string `json:"content_filter_locale,omitempty" example:"pt-BR"`
+	// WelcomeMessage and Rules can only be set on groups, by the owner
+	WelcomeMessage *string `json:"welcome_message,omitempty" example:"Welcome! Please read the rules."`
+	Rules          *string `json:"rules,omitempty" example:"Be kind. No spam."`
+	// HistoryVisibility is "shared" to show new members earlier messages or "joined" to
+	// only show them messages from when they joined. Groups only, by the owner.
+	HistoryVisibility *string `json:"history_visibility,omitempty" example:"joined"`
+	// IntegrityChain true starts keeping a tamper-evident hash chain of the messages; it
+	// can't be turned off. In groups only the owner can start it.
+	IntegrityChain *bool `json:"integrity_chain,omitempty" example:"true"`
+	// Permissions sets who may send, reply, react and star: everyone, admins or owner.
+	// Actions left out keep their permission. Groups only, by the owner.
+	Permissions map[string]string `json:"permissions,omitempty"`
+}
+
+var (
+	// conversationRelations can be left out of a conversation with ?include=
+	conversationRelations = []string{"participants", "participants.user"}
+	// conversationListRelations can be left out of each listed conversation
+	conversationListRelations = []string{"participants", "participants.user", "last_message"}
+)
+
+// participantRoles are the roles participants can be listed by
+var participantRoles = map[string]bool{"owner": true, "admin": true, "member": true}
+
+var (
+	accentColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	themePattern       = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+)
+
+const (
+	// maxNicknameLength matches the nickname column
+	maxNicknameLength = 64
+	// maxWelcomeMessageLength and maxRulesLength bound the group texts
+	maxWelcomeMessageLength = 2000
+	maxRulesLength          = 10000
+)
+
+type UpdateCursorsRequest struct {
+	LastReadMessageID      *uuid.UUID `json:"last_read_message_id,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	LastDeliveredMessageID *uuid.UUID `json:"last_delivered_message_id,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
 func (h *Handler) RegisterConversationRoutes(r *gin.RouterGroup) {
 	r.Use(h.AuthMiddleware())
 	{
 		r.POST("", h.CreateConversation)
+		r.POST("/invite", h.AcceptInvite)
 		r.GET("/:id", h.GetConversation)
 		r.GET("", h.GetUserConversations)
+		r.HEAD("", h.HeadUserConversations)
+		r.GET("/unread", h.GetUnreadSummary)
+		r.POST("/batch", h.BatchConversations)
+		r.PUT("/pins", h.SetConversationPins)
+		r.HEAD("/:id/messages", h.HeadConversationMessages)
 		r.POST("/:id/read", h.MarkConversationRead)
+		r.PUT("/:id/notification-preview", h.SetConversationNotificationPreview)
+		r.POST("/:id/typing", h.SendTyping)
+		r.GET("/:id/cursors", h.GetConversationCursors)
+		r.PUT("/:id/cursors", h.UpdateConversationCursors)
+		r.GET("/:id/analytics", h.GetConversationAnalytics)
+		r.GET("/:id/analytics/reactions", h.GetConversationReactionAnalytics)
+		r.GET("/:id/integrity", h.GetConversationIntegrity)
+		r.GET("/:id/membership-log", h.GetConversationMembershipLog)
+		r.GET("/:id/files", h.GetConversationFiles)
+		r.POST("/:id/files/archive", h.CreateFileArchive)
+		r.GET("/:id/files/archive/:archive_id", h.GetFileArchive)
+		r.GET("/:id/files/archive/:archive_id/download", h.DownloadFileArchive)
+		r.POST("/:id/exports", h.CreateTranscriptExport)
+		r.GET("/:id/exports/:export_id", h.GetTranscriptExport)
+		r.GET("/:id/exports/:export_id/download", h.DownloadTranscriptExport)
+		r.GET("/:id/draft", h.GetDraft)
+		r.PUT("/:id/draft", h.SaveDraft)
+		r.DELETE("/:id/draft", h.DeleteDraft)
+		r.PUT("/:id/draft/attachment", h.StageDraftAttachment)
+		r.DELETE("/:id/draft/attachment", h.UnstageDraftAttachment)
+		r.POST("/:id/draft/send", h.SendDraft)
+		r.POST("/:id/delete", h.DeleteConversation)
+		r.POST("/:id/transfer-ownership", h.TransferConversationOwnership)
+		r.PATCH("/:id/settings", h.UpdateConversationSettings)
+		r.POST("/:id/lock", h.LockConversation)
+		r.DELETE("/:id/lock", h.UnlockConversation)
+		r.GET("/:id/participants", h.GetConversationParticipants)
 		r.POST("/:id/participants", h.AddParticipant)
 		r.DELETE("/:id/participants/:user_id", h.RemoveParticipant)
 		r.PUT("/:id/participants/:user_id/role", h.UpdateParticipantRole)
+		r.GET("/:id/automations", h.GetAutomations)
+		r.POST("/:id/automations", h.CreateAutomation)
+		r.PATCH("/:id/automations/:automation_id", h.UpdateAutomation)
+		r.DELETE("/:id/automations/:automation_id", h.DeleteAutomation)
+		r.GET("/:id/labels", h.GetConversationLabels)
+		r.DELETE("/:id/labels/:label", h.RemoveConversationLabel)
+		r.GET("/:id/apps", h.GetConversationApps)
+		r.POST("/:id/apps", h.InstallConversationApp)
+		r.DELETE("/:id/apps/:client_id", h.RemoveConversationApp)
+		r.GET("/:id/embed-keys", h.GetEmbedKeys)
+		r.POST("/:id/embed-keys", h.CreateEmbedKey)
+		r.DELETE("/:id/embed-keys/:key_id", h.RevokeEmbedKey)
+		r.GET("/:id/digest", h.GetConversationDigest)
+		r.PUT("/:id/digest", h.SetConversationDigest)
+		r.DELETE("/:id/digest", h.DeleteConversationDigest)
+		r.GET("/templates", h.GetConversationTemplates)
+		r.POST("/from-template/:id", h.CreateConversationFromTemplate)
 	}
 }
 
 // @Summary Create a new conversation
-// @Description Start a new conversation with one or more users. Creates a direct chat for one user, or a group chat for multiple users.
+// @Description Start a new conversation with one or more users. Creates a direct chat for one user, or a group chat for multiple users. The workspace settings may restrict creating groups to verified users or administrators; others get a 403. Users may create a limited number of conversations per hour and per day, higher once an administrator verified them; past it the answer is 429 with reason conversation_limit and a Retry-After header. Groups without a name of their own are named after some of their participants, in the language of Accept-Language, with name_generated set.
 // @Tags conversations
 // @Accept json
 // @Produce json
 // @Param conversation body CreateConversationRequest true "Conversation information"
+// @Param Accept-Language header string false "Languages to name groups in, e.g. de-CH, en;q=0.8"
 // @Success 201 {object} models.Conversation
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /conversations [post]
@@ -75,31 +202,46 @@ func (h *Handler) CreateConversation(c *gin.Context) {
 		UserIDs: req.UserIDs,
 		Name:    req.Name,
 	}
+	if len(input.UserIDs) > 1 && !h.mayCreateGroup(c, currentUserID) {
+		return
+	}
 
-	conversationService := models.NewConversationService(h.db, h.encryptor)
+	conversationService := h.conversationService()
 	conversation, err := conversationService.Create(currentUserID, input)
 	if err != nil {
+		if h.respondWithConversationLimit(c, currentUserID, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, models.ErrUserNotFound):
 			h.respondWithError(c, http.StatusNotFound, "One or more users not found")
 		case errors.Is(err, models.ErrDuplicateParticipant):
 			h.respondWithError(c, http.StatusConflict, "Direct conversation already exists with this user")
+		case errors.Is(err, models.ErrGroupFull):
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Groups can have at most %d participants", h.cfg.Group.MaxParticipants))
 		default:
 			h.respondWithError(c, http.StatusInternalServerError, "Failed to create conversation")
 		}
 		return
 	}
 
+	h.nameGroup(c, currentUserID, conversation)
 	h.respondWithSuccess(c, http.StatusCreated, conversation)
 }
 
 // @Summary Get conversation by ID
-// @Description Get conversation details including participants
+// @Description Get conversation details including the participant count and the first page of participants, owners and admins first, and for groups the welcome message and rules. The other participants are listed by GET /conversations/{id}/participants. Responses carry an ETag; sending it back in If-None-Match gets a 304 while the conversation is unchanged. Groups without a name of their own are named after some of their participants, in the language of Accept-Language, with name_generated set.
 // @Tags conversations
 // @Accept json
 // @Produce json
 // @Param id path string true "Conversation ID"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,participants.user_id"
+// @Param include query string false "Comma-separated relations to embed: participants, participants.user"
+// @Param If-None-Match header string false "ETag of the copy the client has"
+// @Param Accept-Language header string false "Languages to name groups in, e.g. de-CH, en;q=0.8"
 // @Success 200 {object} models.Conversation
+// @Header 200 {string} ETag "Tag of the returned payload"
+// @Success 304 "Not modified"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Security ApiKeyAuth
@@ -123,6 +265,10 @@ func (h *Handler) GetConversation(c *gin.Context) {
 		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
+	selection, ok := h.selectFields(c, conversationRelations)
+	if !ok {
+		return
+	}
 
 	// Create conversation service
 	conversationService := models.NewConversationService(h.db, h.encryptor)
@@ -142,13 +288,12 @@ func (h *Handler) GetConversation(c *gin.Context) {
 		return
 	}
 
-	// Check if current user is a participant
-	isParticipant := false
-	for _, p := range conv.Participants {
-		if p.UserID == currentUserID && p.Role != "" {
-			isParticipant = true
-			break
-		}
+	// Check if current user is a participant; only the first page of participants is
+	// embedded, so the caller may not be among them
+	isParticipant, err := conversationService.IsParticipant(id, currentUserID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return
 	}
 
 	if !isParticipant {
@@ -156,15 +301,31 @@ func (h *Handler) GetConversation(c *gin.Context) {
 		return
 	}
 
-	h.respondWithSuccess(c, http.StatusOK, conv)
+	h.nameGroup(c, currentUserID, conv)
+	if trimmed, ok := h.applySelection(c, selection, conv); ok {
+		h.respondWithETag(c, trimmed)
+	}
 }
 
 // @Summary Get user conversations
-// @Description Get all conversations for the authenticated user
+// @Description Get the authenticated user's conversations a page at a time, most recently updated first unless sort says otherwise; X-Total-Count has how many they have and X-Next-Offset where the next page starts. The X-Sync-Token header can be passed back as updated_since to get a models.ConversationDelta with only the conversations that changed, or were left, since. Full lists carry an ETag; sending it back in If-None-Match gets a 304 while nothing changed. Groups without a name of their own are named after some of their participants, in the language of Accept-Language, with name_generated set.
 // @Tags conversations
 // @Accept json
 // @Produce json
+// @Param limit query int false "Number of conversations to return; the default and maximum are configured"
+// @Param offset query int false "Number of conversations to skip" default(0)
+// @Param sort query string false "updated_at lists the most recently changed first; last_message_at those with the latest message first; unread_first those with unread messages first, then by latest message; alphabetical by name, naming direct conversations and groups without a name after their first other participant; manual the conversations pinned with PUT /conversations/pins in their order first, then by latest message. Deltas aren't sorted." default(updated_at)
+// @Param updated_since query string false "Sync token or RFC 3339 timestamp to fetch changes since; deltas aren't paged"
+// @Param fields query string false "Comma-separated fields of each conversation to return, e.g. id,name,unread_count"
+// @Param include query string false "Comma-separated relations to embed: participants, participants.user, last_message. Leaving participants out skips loading them, and leaving last_message out leaves last_message_preview as the only, cheaper, sign of it."
+// @Param display_hints query bool false "Add display to each conversation: whether its last activity was today and on which local day and time, in the user's timezone"
+// @Param If-None-Match header string false "ETag of the list the client has"
+// @Param Accept-Language header string false "Languages to name groups in, e.g. de-CH, en;q=0.8"
 // @Success 200 {array} models.Conversation
+// @Header 200 {string} X-Sync-Token "Token for the next delta request"
+// @Header 200 {string} ETag "Tag of the returned list"
+// @Header 200 {integer} X-Total-Count "Total number of conversations"
+// @Success 304 "Not modified"
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
@@ -183,8 +344,44 @@ func (h *Handler) GetUserConversations(c *gin.Context) {
 		"user_id": userID,
 	})
 
+	selection, ok := h.selectFields(c, conversationListRelations)
+	if !ok {
+		return
+	}
+	details := models.ConversationDetails{
+		Participants: selection.Wants("participants"),
+		LastMessage:  selection.Wants("last_message"),
+	}
+	timezone, ok := h.displayTimezone(c, userID)
+	if !ok {
+		return
+	}
+
 	conversationService := models.NewConversationService(h.db, h.encryptor)
-	conversations, err := conversationService.GetUserConversations(userID)
+
+	if updatedSince := c.Query("updated_since"); updatedSince != "" {
+		h.getConversationDelta(c, conversationService, userID, updatedSince, selection, details, timezone)
+		return
+	}
+
+	page, ok := h.parsePage(c, h.cfg.Pagination.ConversationLimit, h.cfg.Pagination.MaxLimit)
+	if !ok {
+		return
+	}
+	sort := c.DefaultQuery("sort", models.ConversationSortUpdated)
+	if !slices.Contains(models.ConversationSorts, sort) {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid sort. Must be updated_at, last_message_at, unread_first, alphabetical or manual")
+		return
+	}
+
+	// Taken before listing so that changes made meanwhile show up in the next delta
+	syncToken, err := conversationService.SyncToken()
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversations")
+		return
+	}
+
+	conversations, total, err := conversationService.GetUserConversations(userID, details, sort, page.Limit, page.Offset)
 	if err != nil {
 		logger.Error("Failed to get user conversations", err, map[string]interface{}{
 			"user_id": userID,
@@ -203,17 +400,73 @@ func (h *Handler) GetUserConversations(c *gin.Context) {
 		"user_id":            userID,
 		"conversation_count": len(conversations),
 	})
+	if timezone != "" {
+		addConversationHints(conversations, timezone)
+	}
+	h.nameGroups(c, userID, conversations)
+	h.shadowRead(shadowReadConversations, userID, listedConversationIDs(conversations))
 
-	h.respondWithSuccess(c, http.StatusOK, conversations)
+	c.Header(syncTokenHeader, syncToken)
+	setPageHeaders(c, page, len(conversations), total)
+	if trimmed, ok := h.applySelection(c, selection, conversations); ok {
+		h.respondWithETag(c, trimmed)
+	}
+}
+
+// getConversationDelta answers a conversation list request with only what changed since
+// the token, with display hints in timezone unless it is ""
+func (h *Handler) getConversationDelta(c *gin.Context, conversationService *models.ConversationService, userID uuid.UUID, token string,
+	selection *fieldset.Selection, details models.ConversationDetails, timezone string) {
+	since, err := models.ParseSyncToken(token)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid updated_since. Must be a sync token or RFC 3339 timestamp")
+		return
+	}
+
+	delta, err := conversationService.GetUserConversationsSince(userID, since, details)
+	if err != nil {
+		logger.Error("Failed to get conversation delta", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversations")
+		return
+	}
+	if timezone != "" {
+		addConversationHints(delta.Conversations, timezone)
+	}
+	h.nameGroups(c, userID, delta.Conversations)
+
+	c.Header(syncTokenHeader, delta.SyncToken)
+	if selection.All() {
+		h.respondWithSuccess(c, http.StatusOK, delta)
+		return
+	}
+	// The selection applies to the conversations, not to the delta around them
+	conversations, err := selection.Apply(delta.Conversations)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversations")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"conversations": conversations,
+		"removed_ids":   delta.RemovedIDs,
+		"sync_token":    delta.SyncToken,
+	})
+}
+
+// MarkConversationReadResponse is the reader's unread summary once a conversation is read
+type MarkConversationReadResponse struct {
+	Message string                `json:"message" example:"Conversation marked as read"`
+	Unread  *models.UnreadSummary `json:"unread"`
 }
 
 // @Summary Mark conversation as read
-// @Description Mark all messages in a conversation as read for the authenticated user
+// @Description Mark all messages in a conversation as read for the authenticated user, moving their read cursor and watermark and clearing their unread count at once. Their connected devices get a conversation.read event to clear the conversation's unread badge, and the senders of the messages newly read get a messages.read event. The response has the user's unread counts across conversations.
 // @Tags conversations
 // @Accept json
 // @Produce json
 // @Param id path string true "Conversation ID"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} MarkConversationReadResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
@@ -232,21 +485,597 @@ func (h *Handler) MarkConversationRead(c *gin.Context) {
 	}
 
 	conversationService := models.NewConversationService(h.db, h.encryptor)
-	if err := conversationService.UpdateLastRead(conversationID, userID); err != nil {
+	read, err := conversationService.UpdateLastRead(conversationID, userID)
+	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrInvalidParticipant):
 			h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
 		default:
+			logger.Error("Failed to mark conversation as read", err, map[string]interface{}{
+				"conversation_id": conversationID,
+				"user_id":         userID,
+			})
 			h.respondWithError(c, http.StatusInternalServerError, "Failed to mark conversation as read")
 		}
 		return
 	}
+	h.conversationRead(conversationID, read.Cursor)
+	h.messagesRead(conversationID, read)
+
+	h.respondWithSuccess(c, http.StatusOK, MarkConversationReadResponse{
+		Message: "Conversation marked as read",
+		Unread:  read.Unread,
+	})
+}
+
+// @Summary Get conversation cursors
+// @Description Get the last read and last delivered message of every participant. Large groups only return the caller's own cursors.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {array} models.ConversationCursor
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/cursors [get]
+func (h *Handler) GetConversationCursors(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	isParticipant, err := conversationService.IsParticipant(conversationID, userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return
+	}
+	if !isParticipant {
+		h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		return
+	}
+
+	cursors, err := conversationService.GetCursors(conversationID, userID)
+	if err != nil {
+		logger.Error("Failed to get conversation cursors", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversation cursors")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, cursors)
+}
+
+// @Summary Update conversation cursors
+// @Description Move the authenticated user's read and delivered cursors. Cursors only move forward and reading a message also marks it delivered, so devices can sync without overwriting each other. Moving the read cursor sends the user's connected devices a conversation.read event.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param cursors body UpdateCursorsRequest true "New cursor positions"
+// @Success 200 {object} models.ConversationCursor
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/cursors [put]
+func (h *Handler) UpdateConversationCursors(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req UpdateCursorsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.LastReadMessageID == nil && req.LastDeliveredMessageID == nil {
+		h.respondWithError(c, http.StatusBadRequest, "last_read_message_id or last_delivered_message_id is required")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	cursor, err := conversationService.SetCursor(conversationID, userID, models.CursorUpdate{
+		ReadMessageID:      req.LastReadMessageID,
+		DeliveredMessageID: req.LastDeliveredMessageID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidParticipant):
+			h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		case errors.Is(err, models.ErrInvalidCursor):
+			h.respondWithError(c, http.StatusBadRequest, "Message does not belong to this conversation")
+		default:
+			logger.Error("Failed to update conversation cursors", err, map[string]interface{}{
+				"conversation_id": conversationID,
+				"user_id":         userID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to update conversation cursors")
+		}
+		return
+	}
+	if req.LastReadMessageID != nil {
+		h.conversationRead(conversationID, cursor)
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, cursor)
+}
+
+// @Summary Delete conversation
+// @Description Delete a conversation for all participants. Only the owner can delete it; an administrator can restore it until the retention grace period ends, after which it is purged.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/delete [post]
+func (h *Handler) DeleteConversation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	if err := conversationService.SoftDelete(conversationID, userID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidParticipant), errors.Is(err, models.ErrConversationNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+		case errors.Is(err, models.ErrNotOwner):
+			h.respondWithError(c, http.StatusForbidden, "Only the conversation owner can delete it")
+		default:
+			logger.Error("Failed to delete conversation", err, map[string]interface{}{
+				"conversation_id": conversationID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to delete conversation")
+		}
+		return
+	}
+
+	logger.Info("Conversation deleted", map[string]interface{}{
+		"conversation_id": conversationID,
+		"user_id":         userID,
+	})
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Conversation deleted"})
+}
+
+// @Summary Restore deleted conversation
+// @Description Restore a deleted conversation while it is still within the retention grace period
+// @Tags admin
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversations/{id}/restore [post]
+func (h *Handler) RestoreConversation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	if err := conversationService.Restore(conversationID, h.cfg.Retention.ConversationGrace); err != nil {
+		switch {
+		case errors.Is(err, models.ErrConversationNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Deleted conversation not found")
+		case errors.Is(err, models.ErrGracePeriodExpired):
+			h.respondWithError(c, http.StatusConflict, "Conversation is past its grace period and can no longer be restored")
+		default:
+			logger.Error("Failed to restore conversation", err, map[string]interface{}{
+				"conversation_id": conversationID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to restore conversation")
+		}
+		return
+	}
+
+	logger.Info("Conversation restored", map[string]interface{}{
+		"conversation_id": conversationID,
+		"admin_id":        c.GetHeader("X-User-ID"),
+	})
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Conversation restored"})
+}
+
+// PurgeDeletedConversations removes conversations whose grace period has ended
+func (h *Handler) PurgeDeletedConversations() error {
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	purged, err := conversationService.PurgeDeleted(h.cfg.Retention.ConversationGrace)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged deleted conversations", map[string]interface{}{
+			"conversations": purged,
+		})
+	}
+	return nil
+}
+
+// @Summary Transfer conversation ownership
+// @Description Hand a group conversation over to another participant. The previous owner becomes an admin, a system message is posted and participants receive a conversation.ownership_transferred event.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param owner body TransferOwnershipRequest true "New owner"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/transfer-ownership [post]
+func (h *Handler) TransferConversationOwnership(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ownerID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	if err := conversationService.TransferOwnership(conversationID, ownerID, req.UserID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrConversationNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+		case errors.Is(err, models.ErrNotOwner):
+			h.respondWithError(c, http.StatusForbidden, "Only the conversation owner can transfer ownership")
+		case errors.Is(err, models.ErrInvalidParticipant):
+			h.respondWithError(c, http.StatusBadRequest, "New owner must be a participant in this conversation")
+		case errors.Is(err, models.ErrInvalidInput):
+			h.respondWithError(c, http.StatusBadRequest, "You already own this conversation")
+		case errors.Is(err, models.ErrDirectConversation):
+			h.respondWithError(c, http.StatusBadRequest, "Direct conversations have no owner to transfer")
+		default:
+			logger.Error("Failed to transfer conversation ownership", err, map[string]interface{}{
+				"conversation_id": conversationID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to transfer ownership")
+		}
+		return
+	}
+
+	logger.Info("Conversation ownership transferred", map[string]interface{}{
+		"audit":             true,
+		"action":            "conversation.ownership_transfer",
+		"conversation_id":   conversationID,
+		"previous_owner_id": ownerID,
+		"new_owner_id":      req.UserID,
+	})
+
+	h.publishToConversation(conversationID, EventOwnershipTransferred, OwnershipTransferredEvent{
+		ConversationID:  conversationID,
+		PreviousOwnerID: ownerID,
+		NewOwnerID:      req.UserID,
+	})
+	userService := models.NewUserService(h.db, h.encryptor)
+	previousOwner, err := userService.GetByID(ownerID)
+	if err == nil {
+		var newOwner *models.User
+		newOwner, err = userService.GetByID(req.UserID)
+		if err == nil {
+			h.postSystemMessage(conversationID, ownerID,
+				fmt.Sprintf("%s made %s the owner", previousOwner.Username, newOwner.Username))
+		}
+	}
+	if err != nil {
+		logger.Warn("Skipped ownership transfer announcement", map[string]interface{}{
+			"conversation_id": conversationID,
+			"error":           err.Error(),
+		})
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Ownership transferred"})
+}
+
+// @Summary Update conversation settings
+// @Description Change the avatar, accent color and theme of a conversation, the nicknames of its participants, and a group's welcome message, rules and history visibility, or start keeping an integrity chain. Any participant may set nicknames; in groups only the owner and admins may change the appearance, and only the owner the welcome message, rules, history visibility and permissions, which restrict who may send, reply, react and star, or the integrity chain, which can't be turned off again. The avatar is a URL to an already uploaded image.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param settings body UpdateConversationSettingsRequest true "Settings to change"
+// @Success 200 {object} models.Conversation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/settings [patch]
+func (h *Handler) UpdateConversationSettings(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req UpdateConversationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := validateConversationSettings(&req); msg != "" {
+		h.respondWithError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	err = conversationService.UpdateSettings(conversationID, userID, models.ConversationSettings{
+		AvatarURL:           req.AvatarURL,
+		AccentColor:         req.AccentColor,
+		Theme:               req.Theme,
+		ContentFilterMode:   req.ContentFilterMode,
+		ContentFilterLocale: req.ContentFilterLocale,
+		WelcomeMessage:      req.WelcomeMessage,
+		Rules:               req.Rules,
+		HistoryVisibility:   req.HistoryVisibility,
+		Nicknames:           req.Nicknames,
+		IntegrityChain:      req.IntegrityChain,
+		Permissions:         req.Permissions,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrConversationNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+		case errors.Is(err, models.ErrNotAdmin):
+			h.respondWithError(c, http.StatusForbidden, "Only the owner and admins can change the group's appearance and content filter")
+		case errors.Is(err, models.ErrNotOwner):
+			h.respondWithError(c, http.StatusForbidden, "Only the owner can change the welcome message, rules, history visibility, permissions and integrity chain")
+		case errors.Is(err, models.ErrGroupOnly):
+			h.respondWithError(c, http.StatusBadRequest, "Only groups have a welcome message, rules, history visibility and permissions")
+		case errors.Is(err, models.ErrInvalidParticipant):
+			h.respondWithError(c, http.StatusBadRequest, "Nicknames can only be set for participants")
+		default:
+			logger.Error("Failed to update conversation settings", err, map[string]interface{}{
+				"conversation_id": conversationID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to update conversation settings")
+		}
+		return
+	}
+
+	conversation, err := conversationService.GetByID(conversationID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversation")
+		return
+	}
+
+	h.nameGroup(c, userID, conversation)
+	h.respondWithSuccess(c, http.StatusOK, conversation)
+}
 
-	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Conversation marked as read"})
+// validateConversationSettings returns a message describing the first invalid setting, if any
+func validateConversationSettings(req *UpdateConversationSettingsRequest) string {
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(*req.AvatarURL) > 2048 {
+			return "avatar_url must be an http or https URL"
+		}
+	}
+	if req.AccentColor != nil && *req.AccentColor != "" && !accentColorPattern.MatchString(*req.AccentColor) {
+		return "accent_color must be a hex color such as #3b82f6"
+	}
+	if req.Theme != nil && *req.Theme != "" && !themePattern.MatchString(*req.Theme) {
+		return "theme must be up to 32 lowercase letters, digits or dashes"
+	}
+	if req.ContentFilterMode != nil && *req.ContentFilterMode != "" && !contentfilter.IsMode(*req.ContentFilterMode) {
+		return "content_filter_mode must be off, mask or block"
+	}
+	if req.ContentFilterLocale != nil && *req.ContentFilterLocale != "" {
+		locale, ok := contentfilter.NormalizeLocale(*req.ContentFilterLocale)
+		if !ok {
+			return "content_filter_locale must be a locale such as en or pt-BR"
+		}
+		// Stored as the filter looks wordlists up
+		*req.ContentFilterLocale = locale
+	}
+	if req.WelcomeMessage != nil && utf8.RuneCountInString(*req.WelcomeMessage) > maxWelcomeMessageLength {
+		return fmt.Sprintf("welcome_message must be at most %d characters", maxWelcomeMessageLength)
+	}
+	if req.Rules != nil && utf8.RuneCountInString(*req.Rules) > maxRulesLength {
+		return fmt.Sprintf("rules must be at most %d characters", maxRulesLength)
+	}
+	if req.HistoryVisibility != nil && *req.HistoryVisibility != models.HistoryShared && *req.HistoryVisibility != models.HistoryJoined {
+		return "history_visibility must be shared or joined"
+	}
+	if req.IntegrityChain != nil && !*req.IntegrityChain {
+		return "integrity_chain can't be turned off once started"
+	}
+	for action, level := range req.Permissions {
+		if !models.IsConversationAction(action) {
+			return fmt.Sprintf("permissions can only be set for %s", strings.Join(models.ConversationActions, ", "))
+		}
+		if !models.IsPermissionLevel(level) {
+			return "permissions must be everyone, admins or owner"
+		}
+	}
+	for _, nickname := range req.Nicknames {
+		if utf8.RuneCountInString(nickname) > maxNicknameLength {
+			return fmt.Sprintf("nicknames must be at most %d characters", maxNicknameLength)
+		}
+	}
+	return ""
+}
+
+// PurgeEmptyConversations removes conversations that were never messaged
+func (h *Handler) PurgeEmptyConversations() error {
+	if h.cfg.Retention.EmptyConversation <= 0 {
+		return nil
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	removed, err := conversationService.PurgeEmpty(h.cfg.Retention.EmptyConversation)
+	if err != nil {
+		return err
+	}
+	for _, conversation := range removed {
+		logger.Info("Removed empty conversation", map[string]interface{}{
+			"audit":           true,
+			"action":          "conversation.auto_delete",
+			"conversation_id": conversation.ID,
+			"type":            conversation.Type,
+			"created_by":      conversation.CreatedBy,
+			"created_at":      conversation.CreatedAt,
+		})
+	}
+	return nil
+}
+
+// CleanupOrphans removes the memberships, statuses and reactions left behind by
+// deactivated users and deleted messages, a batch at a time
+func (h *Handler) CleanupOrphans() error {
+	cleanup, err := models.NewOrphanService(h.db).Cleanup(orphanCleanupBatch)
+	if err != nil {
+		return err
+	}
+	if cleanup.Total() > 0 {
+		logger.Info("Removed orphaned rows", map[string]interface{}{
+			"participants": cleanup.Participants,
+			"statuses":     cleanup.Statuses,
+			"reactions":    cleanup.Reactions,
+		})
+	}
+	return nil
+}
+
+// FillMissingPreviews computes last message previews the write path didn't leave, a
+// batch at a time
+func (h *Handler) FillMissingPreviews() error {
+	filled, err := models.NewMessageService(h.db, h.encryptor).FillMissingPreviews(previewFillBatch)
+	if err != nil {
+		return err
+	}
+	if filled > 0 {
+		logger.Debug("Filled missing message previews", map[string]interface{}{
+			"filled": filled,
+		})
+	}
+	return nil
+}
+
+// @Summary List conversation participants
+// @Description List a conversation's participants page by page, owners and admins first and then in the order they joined, optionally only those with a role or whose username or nickname starts with q. The total number of matches is in the X-Total-Count header.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param q query string false "Username or nickname prefix to search for"
+// @Param role query string false "Only participants with this role: owner, admin or member"
+// @Param limit query int false "Number of participants to return (default: 50, at most 200)"
+// @Param offset query int false "Number of participants to skip (default: 0)"
+// @Success 200 {array} models.ConversationParticipant
+// @Header 200 {integer} X-Total-Count "Total number of matching participants"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/participants [get]
+func (h *Handler) GetConversationParticipants(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	page, ok := h.parsePage(c, 50, 200)
+	if !ok {
+		return
+	}
+	role := c.Query("role")
+	if role != "" && !participantRoles[role] {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid role. Must be owner, admin or member")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	isParticipant, err := conversationService.IsParticipant(conversationID, userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return
+	}
+	if !isParticipant {
+		h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		return
+	}
+
+	participants, total, err := conversationService.ListParticipants(conversationID, models.ParticipantListOptions{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Role:   role,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	})
+	if err != nil {
+		logger.Error("Failed to list participants", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list participants")
+		return
+	}
+
+	setPageHeaders(c, page, len(participants), total)
+	h.respondWithSuccess(c, http.StatusOK, participants)
 }
 
 // @Summary Add participant to conversation
-// @Description Add a new participant to a group conversation
+// @Description Add a new participant to a group conversation. If the group has a welcome message it is posted as a system message. Groups have a participant limit; groups that grow past the large-group threshold switch to large-group mode for good.
 // @Tags conversations
 // @Accept json
 // @Produce json
@@ -256,6 +1085,7 @@ func (h *Handler) MarkConversationRead(c *gin.Context) {
 // @Failure 400 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /conversations/{id}/participants [post]
 func (h *Handler) AddParticipant(c *gin.Context) {
@@ -277,7 +1107,7 @@ func (h *Handler) AddParticipant(c *gin.Context) {
 		return
 	}
 
-	conversationService := models.NewConversationService(h.db, h.encryptor)
+	conversationService := h.conversationService()
 	err = conversationService.AddParticipant(conversationID, req.UserID, adderID)
 	if err != nil {
 		switch {
@@ -289,6 +1119,8 @@ func (h *Handler) AddParticipant(c *gin.Context) {
 			h.respondWithError(c, http.StatusForbidden, "Not authorized to add participants")
 		case errors.Is(err, models.ErrDuplicateParticipant):
 			h.respondWithError(c, http.StatusConflict, "User is already a participant")
+		case errors.Is(err, models.ErrGroupFull):
+			h.respondWithError(c, http.StatusConflict, fmt.Sprintf("Group has reached its limit of %d participants", h.cfg.Group.MaxParticipants))
 		case err.Error() == "cannot add participants to direct conversations":
 			h.respondWithError(c, http.StatusBadRequest, err.Error())
 		case err.Error() == "insufficient permissions to add participants":
@@ -299,6 +1131,20 @@ func (h *Handler) AddParticipant(c *gin.Context) {
 		return
 	}
 
+	logger.Info("Participant added", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.member_add",
+		"conversation_id": conversationID,
+		"user_id":         req.UserID,
+		"actor_id":        adderID,
+	})
+
+	// Greet the new participant with the group's welcome message, if it has one
+	if conversation, err := conversationService.GetByID(conversationID); err == nil && conversation.WelcomeMessage != nil {
+		h.postSystemMessage(conversationID, adderID, *conversation.WelcomeMessage)
+	}
+	h.runAutomations(conversationID, models.AutomationParticipantJoined, req.UserID, adderID)
+
 	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Participant added successfully"})
 }
 
@@ -354,6 +1200,15 @@ func (h *Handler) RemoveParticipant(c *gin.Context) {
 		return
 	}
 
+	logger.Info("Participant removed", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.member_remove",
+		"conversation_id": conversationID,
+		"user_id":         userID,
+		"actor_id":        removerID,
+	})
+
+	h.runAutomations(conversationID, models.AutomationParticipantLeft, userID, removerID)
 	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Participant removed successfully"})
 }
 
@@ -418,5 +1273,14 @@ func (h *Handler) UpdateParticipantRole(c *gin.Context) {
 		return
 	}
 
+	logger.Info("Participant role updated", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.member_role",
+		"conversation_id": conversationID,
+		"user_id":         userID,
+		"actor_id":        updaterID,
+		"role":            req.Role,
+	})
+
 	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Role updated successfully"})
 }
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// InstallAppRequest installs a third-party application in a group. Without approve,
+// nothing is installed and the permission prompt to show is returned instead.
+type InstallAppRequest struct {
+	ClientID string `json:"client_id" binding:"required"`
+	// Scopes to grant in the group; all those the application registered by default
+	Scopes  []string `json:"scopes" example:"read:messages"`
+	Approve bool     `json:"approve"`
+}
+
+// AppPermissionPrompt describes what an application asks to do in a group, for members
+// to approve before installing it
+type AppPermissionPrompt struct {
+	Name     string        `json:"name"`
+	ClientID string        `json:"client_id"`
+	Scopes   []ScopePrompt `json:"scopes"`
+}
+
+// ScopePrompt is a scope with what it lets an application do
+type ScopePrompt struct {
+	Scope       string `json:"scope" example:"read:messages"`
+	Description string `json:"description"`
+}
+
+// @Summary List apps installed in a conversation
+// @Description List the third-party applications installed in a group, with the scopes granted to each. Any participant can see them.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {array} models.ConversationApp
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/apps [get]
+func (h *Handler) GetConversationApps(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	apps, err := models.NewOAuthService(h.db).GetApps(conversationID, userID)
+	if err != nil {
+		h.respondWithAppError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, apps)
+}
+
+// @Summary Install an app in a conversation
+// @Description Install a third-party application in a group. Without approve, the permission prompt describing the requested scopes is returned and nothing is installed; show it, then send the same request with approve. Apps granted read:messages receive the group's events over WebSocket, connecting with a bot token from the client_credentials grant. Only the owner and admins can install apps.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param app body InstallAppRequest true "Application to install"
+// @Success 200 {object} AppPermissionPrompt
+// @Success 201 {object} models.ConversationApp
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/apps [post]
+func (h *Handler) InstallConversationApp(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req InstallAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	app, err := oauthService.GetApplicationByClientID(req.ClientID)
+	if err != nil {
+		h.respondWithAppError(c, err)
+		return
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = app.Scopes
+	}
+	if !auth.IsSubset(scopes, app.Scopes) {
+		h.respondWithAppError(c, models.ErrInvalidScope)
+		return
+	}
+
+	if !req.Approve {
+		prompt := AppPermissionPrompt{Name: app.Name, ClientID: app.ClientID, Scopes: make([]ScopePrompt, len(scopes))}
+		for i, scope := range scopes {
+			prompt.Scopes[i] = ScopePrompt{Scope: scope, Description: auth.ScopeDescriptions[scope]}
+		}
+		h.respondWithSuccess(c, http.StatusOK, prompt)
+		return
+	}
+
+	installed, err := oauthService.InstallApp(conversationID, userID, app, scopes)
+	if err != nil {
+		h.respondWithAppError(c, err)
+		return
+	}
+
+	logger.Info("App installed in conversation", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.app_install",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"client_id":       app.ClientID,
+		"scopes":          scopes,
+	})
+	h.announceApp(conversationID, userID, "added", app.Name)
+	h.respondWithSuccess(c, http.StatusCreated, installed)
+}
+
+// @Summary Remove an app from a conversation
+// @Description Uninstall a third-party application from a group. It stops receiving the group's events straight away. Only the owner and admins can remove apps.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param client_id path string true "Client ID of the application"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/apps/{client_id} [delete]
+func (h *Handler) RemoveConversationApp(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	removed, err := models.NewOAuthService(h.db).RemoveApp(conversationID, userID, c.Param("client_id"))
+	if err != nil {
+		h.respondWithAppError(c, err)
+		return
+	}
+
+	logger.Info("App removed from conversation", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.app_remove",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"client_id":       removed.ClientID,
+	})
+	h.announceApp(conversationID, userID, "removed", removed.Name)
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "App removed"})
+}
+
+// announceApp tells a group's members that an app was added or removed, since
+// installed apps can read what they write
+func (h *Handler) announceApp(conversationID, userID uuid.UUID, change, appName string) {
+	user, err := models.NewUserService(h.db, h.encryptor).GetByID(userID)
+	if err != nil {
+		logger.Warn("Skipped app announcement", map[string]interface{}{
+			"conversation_id": conversationID,
+			"error":           err.Error(),
+		})
+		return
+	}
+	h.postSystemMessage(conversationID, userID, fmt.Sprintf("%s %s the app %s", user.Username, change, appName))
+}
+
+func (h *Handler) respondWithAppError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrApplicationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Application not found")
+	case errors.Is(err, models.ErrInvalidScope):
+		h.respondWithError(c, http.StatusBadRequest, "Requested scope is not allowed for this application")
+	case errors.Is(err, models.ErrGroupOnly):
+		h.respondWithError(c, http.StatusBadRequest, "Only groups have apps")
+	case errors.Is(err, models.ErrNotAdmin):
+		h.respondWithError(c, http.StatusForbidden, "Only the owner and admins can manage apps")
+	default:
+		logger.Error("Failed to manage conversation apps", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage apps")
+	}
+}
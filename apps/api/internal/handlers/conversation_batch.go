@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Actions of a conversation batch
+const (
+	BatchMute        = "mute"
+	BatchUnmute      = "unmute"
+	BatchArchive     = "archive"
+	BatchUnarchive   = "unarchive"
+	BatchMarkRead    = "mark_read"
+	BatchAddLabel    = "add_label"
+	BatchRemoveLabel = "remove_label"
+)
+
+// Why a conversation of a batch failed
+const (
+	BatchFailedNotFound  = "not_found"
+	BatchFailedForbidden = "forbidden"
+	BatchFailedGroupOnly = "group_only"
+	BatchFailedError     = "error"
+)
+
+// BatchConversationsRequest takes one action on up to 100 conversations
+type BatchConversationsRequest struct {
+	ConversationIDs []uuid.UUID `json:"conversation_ids" binding:"required,min=1,max=100"`
+	Action          string      `json:"action" binding:"required,oneof=mute unmute archive unarchive mark_read add_label remove_label" example:"mute"`
+	// MutedUntil ends a mute; conversations stay muted until unmuted without it
+	MutedUntil *time.Time `json:"muted_until"`
+	// Label is added or removed by the label actions
+	Label string `json:"label" binding:"max=50" example:"incident"`
+}
+
+// BatchConversationsResponse lists the conversations the action was taken on, and why
+// it failed on the others
+type BatchConversationsResponse struct {
+	Succeeded []uuid.UUID          `json:"succeeded"`
+	Failed    map[uuid.UUID]string `json:"failed"`
+	// Unread is the user's unread summary once conversations are marked read
+	Unread *models.UnreadSummary `json:"unread,omitempty"`
+}
+
+// @Summary Act on several conversations
+// @Description Mute, unmute, archive, unarchive, mark read, or add or remove a label on up to 100 conversations at once, for select-all flows. Muted conversations don't notify of messages, except mentions, until unmuted or until muted_until; archived ones stay in the list with archived_at set. The user's devices get a conversations.state_changed event for mutes and archives, and conversation.read events as conversations are marked read. Labels are shared by all participants, so only the owner and admins of a group can change them. Each conversation succeeds or fails on its own; failed ones are answered not_found when the user isn't in them, forbidden when they may not change labels and group_only for labels on direct conversations.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param request body BatchConversationsRequest true "Conversations and action"
+// @Success 200 {object} BatchConversationsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/batch [post]
+func (h *Handler) BatchConversations(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req BatchConversationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if req.MutedUntil != nil && (req.Action != BatchMute || !req.MutedUntil.After(time.Now())) {
+		h.respondWithError(c, http.StatusBadRequest, "muted_until must be in the future, and only goes with mute")
+		return
+	}
+	label := strings.ToLower(strings.TrimSpace(req.Label))
+	if (req.Action == BatchAddLabel || req.Action == BatchRemoveLabel) != (label != "") {
+		h.respondWithError(c, http.StatusBadRequest, "label is required by the label actions, and only goes with them")
+		return
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.ConversationIDs))
+	ids := make([]uuid.UUID, 0, len(req.ConversationIDs))
+	for _, id := range req.ConversationIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	response := BatchConversationsResponse{Succeeded: []uuid.UUID{}, Failed: make(map[uuid.UUID]string)}
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	switch req.Action {
+	case BatchMute, BatchUnmute, BatchArchive, BatchUnarchive:
+		event := ConversationsStateEvent{}
+		var changed []uuid.UUID
+		if req.Action == BatchMute || req.Action == BatchUnmute {
+			muted := req.Action == BatchMute
+			event.Muted, event.MutedUntil = &muted, req.MutedUntil
+			changed, err = conversationService.SetMuted(ids, userID, muted, req.MutedUntil)
+		} else {
+			archived := req.Action == BatchArchive
+			event.Archived = &archived
+			changed, err = conversationService.SetArchived(ids, userID, archived)
+		}
+		if err != nil {
+			logger.Error("Failed to update conversations", err, map[string]interface{}{
+				"user_id": userID,
+				"action":  req.Action,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to update conversations")
+			return
+		}
+		response.Succeeded = changed
+		for _, id := range missingIDs(ids, func(id uuid.UUID) bool { return containsID(changed, id) }) {
+			response.Failed[id] = BatchFailedNotFound
+		}
+		if len(changed) > 0 {
+			event.ConversationIDs = changed
+			h.publishToUsers([]uuid.UUID{userID}, EventConversationsChanged, event)
+		}
+
+	case BatchMarkRead:
+		for _, id := range ids {
+			read, err := conversationService.UpdateLastRead(id, userID)
+			if err != nil {
+				response.Failed[id] = h.batchFailure(err, id, req.Action)
+				continue
+			}
+			h.conversationRead(id, read.Cursor)
+			h.messagesRead(id, read)
+			response.Succeeded = append(response.Succeeded, id)
+			response.Unread = read.Unread
+		}
+
+	case BatchAddLabel, BatchRemoveLabel:
+		labelService := models.NewConversationLabelService(h.db)
+		for _, id := range ids {
+			if req.Action == BatchAddLabel {
+				_, err = labelService.AddByAdmin(id, userID, label)
+			} else if err = labelService.Remove(id, userID, label); errors.Is(err, models.ErrNotFound) {
+				// A conversation without the label already is as asked
+				err = nil
+			}
+			if err != nil {
+				response.Failed[id] = h.batchFailure(err, id, req.Action)
+				continue
+			}
+			response.Succeeded = append(response.Succeeded, id)
+		}
+	}
+	h.respondWithSuccess(c, http.StatusOK, response)
+}
+
+// batchFailure tells why the action of a batch failed on a conversation, logging
+// unexpected errors
+func (h *Handler) batchFailure(err error, conversationID uuid.UUID, action string) string {
+	switch {
+	case errors.Is(err, models.ErrInvalidParticipant), errors.Is(err, models.ErrConversationNotFound):
+		return BatchFailedNotFound
+	case errors.Is(err, models.ErrNotAdmin):
+		return BatchFailedForbidden
+	case errors.Is(err, models.ErrGroupOnly):
+		return BatchFailedGroupOnly
+	}
+	logger.Error("Failed to update conversation in batch", err, map[string]interface{}{
+		"conversation_id": conversationID,
+		"action":          action,
+	})
+	return BatchFailedError
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ReasonConversationLimit is given with 429 responses to users who created as many
+// conversations as they may for now
+const ReasonConversationLimit = "conversation_limit"
+
+// SetUserVerifiedRequest marks a user verified or unmarks them
+type SetUserVerifiedRequest struct {
+	Verified *bool `json:"verified" binding:"required" example:"true"`
+}
+
+// respondWithConversationLimit answers 429 when err is a *models.ConversationLimitError,
+// telling the limit reached and when the user can create a conversation again
+func (h *Handler) respondWithConversationLimit(c *gin.Context, userID uuid.UUID, err error) bool {
+	var limitErr *models.ConversationLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+
+	logger.Warn("Conversation limit reached", map[string]interface{}{
+		"user_id":  userID,
+		"limit":    limitErr.Limit,
+		"window":   limitErr.Window.String(),
+		"retry_at": limitErr.RetryAt,
+	})
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(limitErr.RetryAt).Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":          "Too many conversations created, try again later",
+		"reason":         ReasonConversationLimit,
+		"limit":          limitErr.Limit,
+		"window_seconds": int(limitErr.Window.Seconds()),
+		"retry_at":       limitErr.RetryAt,
+	})
+	return true
+}
+
+// @Summary Mark a user verified
+// @Description Mark a user verified, giving them the higher verified limits on the conversations and groups they can create per hour and day, or unmark them
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetUserVerifiedRequest true "Whether the user is verified"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/verified [put]
+func (h *Handler) SetUserVerified(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req SetUserVerifiedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	if err := userService.SetVerified(userID, *req.Verified); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to set user verified", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set user verified")
+		return
+	}
+
+	logger.Info("Changed user verification", map[string]interface{}{
+		"audit":    true,
+		"action":   "user.verified",
+		"user_id":  userID,
+		"verified": *req.Verified,
+		"admin_id": c.GetHeader("X-User-ID"),
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"user_id": userID, "verified": *req.Verified})
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultLockMinutes is how long a group stays locked when no duration is given
+	defaultLockMinutes = 60
+	// lockReleaseBatch is how many expired locks a job run lifts
+	lockReleaseBatch = 100
+)
+
+// LockConversationRequest locks a group for a while
+type LockConversationRequest struct {
+	// DurationMinutes defaults to 60 and is at most 7 days
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=1" example:"30"`
+	Reason          string `json:"reason" binding:"max=200" example:"Cooling down"`
+}
+
+// @Summary Lock a group
+// @Description Keep everyone but the owner and admins from posting in a group for a while, such as during a moderation incident. Reactions and bookmarks still work. The lock lifts by itself when the time is up; locking again replaces it. Participants see a system message and get a conversation.locked event. Only the owner and admins can lock a group.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param lock body LockConversationRequest false "Duration and reason"
+// @Success 200 {object} models.ConversationLock
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/lock [post]
+func (h *Handler) LockConversation(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	var req LockConversationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+			return
+		}
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = defaultLockMinutes
+	}
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	if duration > models.MaxLockDuration {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("duration_minutes must be at most %d", int(models.MaxLockDuration/time.Minute)))
+		return
+	}
+	var reason *string
+	if trimmed := strings.TrimSpace(req.Reason); trimmed != "" {
+		reason = &trimmed
+	}
+
+	lock, err := models.NewConversationService(h.db, h.encryptor).Lock(conversationID, userID, duration, reason)
+	if err != nil {
+		h.respondWithLockError(c, err)
+		return
+	}
+	logger.Info("Conversation locked", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.lock",
+		"conversation_id": conversationID,
+		"user_id":         userID,
+		"locked_until":    lock.LockedUntil,
+	})
+
+	h.publishToConversation(conversationID, EventConversationLocked, ConversationLockEvent{
+		ConversationID: conversationID,
+		UserID:         &userID,
+		LockedUntil:    &lock.LockedUntil,
+		Reason:         reason,
+	})
+	text := fmt.Sprintf("locked the conversation for %s; only admins can post", lockDuration(duration))
+	if reason != nil {
+		text += ": " + *reason
+	}
+	h.announceLock(conversationID, userID, text)
+	h.respondWithSuccess(c, http.StatusOK, lock)
+}
+
+// @Summary Unlock a group
+// @Description Lift a group's lock before it expires. Participants see a system message and get a conversation.unlocked event. Only the owner and admins can unlock a group.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/lock [delete]
+func (h *Handler) UnlockConversation(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	if err := models.NewConversationService(h.db, h.encryptor).Unlock(conversationID, userID); err != nil {
+		h.respondWithLockError(c, err)
+		return
+	}
+	logger.Info("Conversation unlocked", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.unlock",
+		"conversation_id": conversationID,
+		"user_id":         userID,
+	})
+
+	h.publishToConversation(conversationID, EventConversationUnlocked, ConversationLockEvent{
+		ConversationID: conversationID,
+		UserID:         &userID,
+	})
+	h.announceLock(conversationID, userID, "unlocked the conversation")
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Conversation unlocked"})
+}
+
+// ReleaseExpiredLocks lifts the locks whose time is up and tells their groups
+func (h *Handler) ReleaseExpiredLocks() error {
+	locks, err := models.NewConversationService(h.db, h.encryptor).ClearExpiredLocks(lockReleaseBatch)
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		h.publishToConversation(lock.ConversationID, EventConversationUnlocked, ConversationLockEvent{
+			ConversationID: lock.ConversationID,
+		})
+		if lock.LockedBy == nil {
+			continue
+		}
+		if err := h.sendSystemMessage(lock.ConversationID, *lock.LockedBy, "The conversation lock expired; everyone can post again"); err != nil {
+			logger.Error("Failed to announce expired lock", err, map[string]interface{}{
+				"conversation_id": lock.ConversationID,
+			})
+		}
+	}
+	return nil
+}
+
+// announceLock posts a system message naming the admin who locked or unlocked a group
+func (h *Handler) announceLock(conversationID, userID uuid.UUID, text string) {
+	user, err := models.NewUserService(h.db, h.encryptor).GetByID(userID)
+	if err != nil {
+		logger.Warn("Skipped lock announcement", map[string]interface{}{
+			"conversation_id": conversationID,
+			"error":           err.Error(),
+		})
+		return
+	}
+	h.postSystemMessage(conversationID, userID, user.Username+" "+text)
+}
+
+// lockDuration writes a lock duration in the largest whole unit
+func lockDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		n := int(d / (24 * time.Hour))
+		return fmt.Sprintf("%d %s", n, plural(n, "day", "days"))
+	case d%time.Hour == 0:
+		n := int(d / time.Hour)
+		return fmt.Sprintf("%d %s", n, plural(n, "hour", "hours"))
+	default:
+		n := int(d / time.Minute)
+		return fmt.Sprintf("%d %s", n, plural(n, "minute", "minutes"))
+	}
+}
+
+func (h *Handler) respondWithLockError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrGroupOnly):
+		h.respondWithError(c, http.StatusBadRequest, "Only groups can be locked")
+	case errors.Is(err, models.ErrNotAdmin):
+		h.respondWithError(c, http.StatusForbidden, "Only the owner and admins can lock the conversation")
+	case errors.Is(err, models.ErrNotLocked):
+		h.respondWithError(c, http.StatusNotFound, "The conversation is not locked")
+	default:
+		logger.Error("Failed to lock conversation", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to lock conversation")
+	}
+}
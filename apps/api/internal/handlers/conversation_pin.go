@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SetConversationPinsRequest lists the conversations to pin, in order
+type SetConversationPinsRequest struct {
+	ConversationIDs []uuid.UUID `json:"conversation_ids" binding:"max=50"`
+}
+
+// @Summary Pin conversations
+// @Description Pin up to 50 conversations in the order given, replacing the user's pins; an empty list unpins them all. Pinned conversations come first, in this order, in conversation lists sorted manually, and carry pin_position. The user's devices get a conversations.state_changed event with the new pins.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param request body SetConversationPinsRequest true "Conversations to pin"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/pins [put]
+func (h *Handler) SetConversationPins(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req SetConversationPinsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	pins := make([]uuid.UUID, 0, len(req.ConversationIDs))
+	for _, id := range req.ConversationIDs {
+		if containsID(pins, id) {
+			h.respondWithError(c, http.StatusBadRequest, "Conversations can only be pinned once")
+			return
+		}
+		pins = append(pins, id)
+	}
+
+	changed, err := models.NewConversationService(h.db, h.encryptor).SetPins(userID, pins)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidParticipant) {
+			h.respondWithError(c, http.StatusForbidden, "User is not a participant in all of these conversations")
+			return
+		}
+		logger.Error("Failed to pin conversations", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to pin conversations")
+		return
+	}
+
+	if len(changed) > 0 {
+		h.publishToUsers([]uuid.UUID{userID}, EventConversationsChanged, ConversationsStateEvent{
+			ConversationIDs: changed,
+			Pins:            &pins,
+		})
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"pins": pins})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/delivery"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// DeliveryHealthReport is how delivery to a user's WebSocket connections has been
+// going on this server, for looking into messages that never arrived
+type DeliveryHealthReport struct {
+	delivery.Health
+	// Connected is whether the user has a connection open to this server
+	Connected bool `json:"connected"`
+	// PendingDeliveries await acknowledgment, oldest first
+	PendingDeliveries []delivery.Delivery `json:"pending_deliveries"`
+}
+
+// missedUpdates is a conversation a user missed events of
+type missedUpdates struct {
+	userID         string
+	conversationID string
+}
+
+// ResendMissedDeliveries tells users about the conversation events their connections
+// didn't acknowledge in time through their notification center, and by email when
+// configured. Each user gets one notification per conversation, however many of its
+// events were missed.
+func (h *Handler) ResendMissedDeliveries() error {
+	expired := h.deliveries.Expired(time.Now())
+	if len(expired) == 0 {
+		return nil
+	}
+
+	counts := make(map[missedUpdates]int)
+	var order []missedUpdates
+	for _, d := range expired {
+		missed := missedUpdates{userID: d.UserID, conversationID: d.ConversationID}
+		if counts[missed] == 0 {
+			order = append(order, missed)
+		}
+		counts[missed]++
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	userService := models.NewUserService(h.db, h.encryptor)
+	for _, missed := range order {
+		userID, err := uuid.Parse(missed.userID)
+		if err != nil {
+			continue
+		}
+		conversationID, err := uuid.Parse(missed.conversationID)
+		if err != nil {
+			continue
+		}
+
+		// Nothing to catch up on in conversations that are gone or were left meanwhile
+		conversation, err := conversationService.GetByID(conversationID)
+		if errors.Is(err, models.ErrConversationNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		isParticipant, err := conversationService.IsParticipant(conversationID, userID)
+		if err != nil {
+			return err
+		}
+		if !isParticipant {
+			continue
+		}
+
+		if conversation.Unnamed() {
+			name := h.groupName(userID, &models.GroupNameSource{Sample: conversation.NameSample, ParticipantCount: conversation.ParticipantCount})
+			conversation.Name = &name
+		}
+		title, body := missedUpdatesNotice(conversation, counts[missed])
+		if err := h.notify(userID, models.NotificationMissedUpdates, title, body); err != nil {
+			logger.Error("Failed to resend missed updates", err, map[string]interface{}{
+				"user_id":         userID,
+				"conversation_id": conversationID,
+			})
+			continue
+		}
+		h.deliveries.Resent(missed.userID)
+
+		if h.cfg.Delivery.EmailMissed && h.mailer != nil {
+			user, err := userService.GetByID(userID)
+			if err != nil || user.Email == "" {
+				continue
+			}
+			if err := h.mailer.Send(user.Email, title, body+"\n"); err != nil {
+				logger.Error("Failed to email missed updates", err, map[string]interface{}{
+					"user_id":         userID,
+					"conversation_id": conversationID,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// messageSeen notes in the delivery ledger that a connection acknowledged a new message
+func (h *Handler) messageSeen(d delivery.Delivery) {
+	h.submitTask("record_message_seen", func() error {
+		return h.recordSeen(d.MessageID, []string{d.UserID})
+	})
+}
+
+// recordSeen notes in the delivery ledger that a message reached connected devices of
+// users, so they aren't notified of it, and marks it delivered to them
+func (h *Handler) recordSeen(messageID string, userIDs []string) error {
+	id, err := uuid.Parse(messageID)
+	if err != nil {
+		return err
+	}
+	seen := make([]uuid.UUID, 0, len(userIDs))
+	for _, raw := range userIDs {
+		if userID, err := uuid.Parse(raw); err == nil {
+			seen = append(seen, userID)
+		}
+	}
+	if err := models.NewNotificationService(h.db).RecordDeliveries(id, models.ChannelWebSocket, seen); err != nil {
+		return err
+	}
+	return models.NewMessageService(h.db, h.encryptor).MarkDelivered(id, seen)
+}
+
+// PurgeMessageDeliveries forgets ledger entries of messages from over a day ago, long
+// after their notifications went out
+func (h *Handler) PurgeMessageDeliveries() error {
+	purged, err := models.NewNotificationService(h.db).PurgeDeliveries(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged message deliveries", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
+
+// missedUpdatesNotice is the notification about a conversation's missed events
+func missedUpdatesNotice(conversation *models.Conversation, count int) (title, body string) {
+	name := "a direct conversation"
+	if conversation.Name != nil && *conversation.Name != "" {
+		name = *conversation.Name
+	}
+	updates := "update"
+	if count != 1 {
+		updates = "updates"
+	}
+	return "Updates you may have missed",
+		fmt.Sprintf("%d %s in %s did not reach your device. Open the conversation to catch up.", count, updates, name)
+}
+
+// @Summary Get a user's delivery health
+// @Description Report how delivery of conversation events to a user's WebSocket connections has been going on this server since it started: how many were acknowledged and how quickly, how many were missed and resent, and which still await acknowledgment. Only connections opened with acks=true are tracked.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} DeliveryHealthReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/delivery [get]
+func (h *Handler) GetDeliveryHealth(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	if _, err := userService.GetByID(userID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	health, pending := h.deliveries.Health(userID.String())
+	connected := false
+	for _, id := range h.hub.ConnectedUserIDs() {
+		if id == userID.String() {
+			connected = true
+			break
+		}
+	}
+	h.respondWithSuccess(c, http.StatusOK, DeliveryHealthReport{
+		Health:            health,
+		Connected:         connected,
+		PendingDeliveries: pending,
+	})
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/server"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// VerifyLoginRequest completes a sign-in from a new device with the emailed code
+type VerifyLoginRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	Code        string `json:"code" binding:"required" example:"123456"`
+}
+
+// LoginChallengeResponse tells the client to ask for the code emailed to the user
+type LoginChallengeResponse struct {
+	VerificationRequired bool      `json:"verification_required"`
+	ChallengeID          uuid.UUID `json:"challenge_id"`
+	ExpiresAt            time.Time `json:"expires_at"`
+}
+
+// deviceFingerprint identifies the client a sign-in comes from. Clients that can keep
+// an ID of their own send it as X-Device-ID; browsers are told apart by user agent.
+func deviceFingerprint(c *gin.Context) string {
+	sum := sha256.Sum256([]byte(c.GetHeader("X-Device-ID") + "\n" + c.Request.UserAgent()))
+	return hex.EncodeToString(sum[:])
+}
+
+// loginDevice describes where the current request comes from
+func (h *Handler) loginDevice(c *gin.Context) *models.LoginDevice {
+	device := &models.LoginDevice{
+		Fingerprint: deviceFingerprint(c),
+		Name:        deviceName(c),
+		IP:          c.ClientIP(),
+	}
+	// Proxies use values such as XX or T1 for unknown and Tor traffic; those still
+	// count as a country of their own
+	if country := server.ClientCountry(c); len(country) == 2 {
+		device.Country = country
+	}
+	return device
+}
+
+// signIn finishes a sign-in: it issues the tokens, remembers the device and, for new
+// devices, IPs and countries, alerts the user. The email alert is only sent for new
+// devices, and skipped when the user just proved they can read their email.
+func (h *Handler) signIn(c *gin.Context, user *models.User, device *models.LoginDevice, newDevice, emailAlert bool) {
+	pair, err := h.tokenManager.GenerateTokenPair(user.ID, device.Name)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	if err := h.startSession(user.ID, pair, device.Name, device.IP); err != nil {
+		logger.Error("Failed to start session", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Login failed")
+		return
+	}
+
+	deviceService := models.NewDeviceService(h.db)
+	if err := deviceService.Record(user.ID, device); err != nil {
+		logger.Error("Failed to record login device", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+	}
+	newLocation, err := deviceService.RecordLocation(user.ID, device.IP, device.Country)
+	if err != nil {
+		logger.Error("Failed to record login location", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+	}
+	if newDevice || newLocation {
+		action := "user.new_location_login"
+		if newDevice {
+			action = "user.new_device_login"
+		}
+		logger.Info("Sign-in from new device or location", map[string]interface{}{
+			"audit":   true,
+			"action":  action,
+			"user_id": user.ID,
+			"ip":      device.IP,
+			"country": device.Country,
+		})
+		if h.cfg.Login.AlertNewDevices {
+			h.alertLogin(user, device, newDevice && emailAlert)
+		}
+	}
+
+	h.setRefreshCookie(c, pair)
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"user":          user,
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt,
+	})
+}
+
+// alertLogin tells a user in their notification center, and by email if asked, that
+// their account was signed in to from a new device or location. The notification
+// carries the alert users report sign-ins that weren't theirs with. With security
+// messages on, Talkify Security also messages the user about it.
+func (h *Handler) alertLogin(user *models.User, device *models.LoginDevice, email bool) {
+	where := device.IP
+	if device.Country != "" {
+		where = fmt.Sprintf("%s (%s)", device.IP, device.Country)
+	}
+	body := fmt.Sprintf("Your account was signed in to on %s from %s at %s. "+
+		"If this wasn't you, change your password.",
+		device.Name, where, time.Now().UTC().Format("January 2, 2006 15:04 MST"))
+
+	userID, address := user.ID, user.Email
+	h.submitTask("alert_login", func() error {
+		alertService := models.NewLoginAlertService(h.db, h.encryptor)
+		alert, err := alertService.Create(userID, device)
+		if err != nil {
+			return err
+		}
+		notification, err := models.NewNotificationService(h.db).CreateLoginAlert(alert, "New sign-in to your account", body)
+		if err != nil {
+			return err
+		}
+		h.publishToUsers([]uuid.UUID{userID}, EventNotificationCreated, notification)
+
+		if h.cfg.Login.SecurityMessages {
+			text := body + " Report it from the sign-in notification to sign out everywhere else and choose a new password."
+			if err := h.messageFromSecurity(userID, text); err != nil {
+				logger.Error("Failed to message user about sign-in", err, map[string]interface{}{
+					"user_id": userID,
+				})
+			}
+		}
+		if email && h.mailer != nil && address != "" {
+			return h.mailer.Send(address, "New sign-in to your Talkify account", body+"\n")
+		}
+		return nil
+	})
+}
+
+// messageFromSecurity posts a system message to a user in their direct conversation
+// with Talkify Security, starting it when needed
+func (h *Handler) messageFromSecurity(userID uuid.UUID, text string) error {
+	if err := models.NewLoginAlertService(h.db, h.encryptor).EnsureSecurityBot(); err != nil {
+		return err
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	conversationID, err := conversationService.FindDirect(models.SecurityBotID, userID)
+	if errors.Is(err, models.ErrConversationNotFound) {
+		var conversation *models.Conversation
+		conversation, err = conversationService.Create(models.SecurityBotID, &models.CreateConversationInput{
+			UserIDs: []uuid.UUID{userID},
+		})
+		if errors.Is(err, models.ErrDuplicateParticipant) {
+			conversationID, err = conversationService.FindDirect(models.SecurityBotID, userID)
+		} else if err == nil {
+			conversationID = conversation.ID
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return h.sendSystemMessage(conversationID, models.SecurityBotID, text)
+}
+
+// challengeLogin holds back a sign-in from a new device and emails the user a code
+func (h *Handler) challengeLogin(c *gin.Context, user *models.User, device *models.LoginDevice) {
+	deviceService := models.NewDeviceService(h.db)
+	challenge, code, err := deviceService.CreateChallenge(user.ID, device, h.cfg.Login.CodeTTL)
+	if err != nil {
+		logger.Error("Failed to create login challenge", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Login failed")
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Someone is signing in to your account on %s from %s. If it's you, enter this code "+
+		"to continue:\n\n    %s\n\nThe code expires in %d minutes. If this wasn't you, change your password.\n",
+		user.Username, device.Name, device.IP, code, int(h.cfg.Login.CodeTTL.Minutes()))
+	if err := h.mailer.Send(user.Email, "Your Talkify sign-in code", body); err != nil {
+		logger.Error("Failed to send sign-in code", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusServiceUnavailable, "Failed to send the verification code")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusAccepted, LoginChallengeResponse{
+		VerificationRequired: true,
+		ChallengeID:          challenge.ID,
+		ExpiresAt:            challenge.ExpiresAt,
+	})
+}
+
+// @Summary Verify a sign-in from a new device
+// @Description Complete a sign-in that login answered with verification_required, using the code emailed to the user. A challenge is ended after five wrong codes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyLoginRequest true "Challenge and code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/login/verify [post]
+func (h *Handler) VerifyLogin(c *gin.Context) {
+	var req VerifyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	challengeID, err := uuid.Parse(req.ChallengeID)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid challenge ID")
+		return
+	}
+
+	deviceService := models.NewDeviceService(h.db)
+	challenge, err := deviceService.VerifyChallenge(challengeID, strings.TrimSpace(req.Code))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnauthorized):
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid code")
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusUnauthorized, "Verification expired. Sign in again.")
+		default:
+			logger.Error("Failed to verify login challenge", err)
+			h.respondWithError(c, http.StatusInternalServerError, "Login failed")
+		}
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	user, err := userService.GetByID(challenge.UserID)
+	if err != nil {
+		h.respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+	h.signIn(c, user, challenge.Device(), true, false)
+}
+
+// @Summary List my devices
+// @Description List the devices the user has signed in from, most recently used first
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.UserDevice
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/devices [get]
+func (h *Handler) GetMyDevices(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	deviceService := models.NewDeviceService(h.db)
+	devices, err := deviceService.List(userID)
+	if err != nil {
+		logger.Error("Failed to list devices", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list devices")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, devices)
+}
+
+// @Summary Report a sign-in that wasn't me
+// @Description Report a sign-in the user was alerted about as not theirs. Every other session of the user is signed out and they have to choose a new password before using the API again. The alert ID is the login_alert_id of the sign-in notification.
+// @Tags users
+// @Produce json
+// @Param id path string true "Login alert ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/login-alerts/{id}/report [post]
+func (h *Handler) ReportLoginAlert(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	alertID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid login alert ID")
+		return
+	}
+
+	alert, err := models.NewLoginAlertService(h.db, h.encryptor).Report(userID, alertID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Login alert not found")
+			return
+		}
+		logger.Error("Failed to report login alert", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to report sign-in")
+		return
+	}
+
+	// The session reporting the sign-in stays, so the user can choose a new password
+	var sessionID uuid.UUID
+	if claims, ok := c.Get("claims"); ok {
+		sessionID = claims.(*auth.Claims).SessionID
+	}
+	revoked, err := models.NewSessionService(h.db).RevokeOthers(userID, sessionID, models.RevokedLoginReported)
+	if err != nil {
+		logger.Error("Failed to revoke sessions", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to report sign-in")
+		return
+	}
+	h.hub.endSessions(userID, func(id uuid.UUID) bool { return id != sessionID })
+	userService := models.NewUserService(h.db, h.encryptor)
+	if err := userService.SetPasswordChangeRequired(userID, true); err != nil {
+		logger.Error("Failed to require a new password", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to report sign-in")
+		return
+	}
+
+	logger.Info("Sign-in reported as not the user's", map[string]interface{}{
+		"audit":            true,
+		"action":           "user.login_reported",
+		"user_id":          userID,
+		"login_alert_id":   alert.ID,
+		"ip":               alert.IP,
+		"country":          alert.Country,
+		"sessions_revoked": revoked,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"login_alert":              alert,
+		"sessions_revoked":         revoked,
+		"password_change_required": true,
+	})
+}
+
+// PurgeExpiredLoginChallenges removes sign-in challenges that were never completed
+func (h *Handler) PurgeExpiredLoginChallenges() error {
+	deviceService := models.NewDeviceService(h.db)
+	purged, err := deviceService.PurgeExpiredChallenges()
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged expired login challenges", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
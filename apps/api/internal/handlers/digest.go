@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// digestBatch is how many due digests a job run posts
+const digestBatch = 50
+
+// SetDigestRequest schedules a group's digest. Its hour and weekday are in its timezone.
+type SetDigestRequest struct {
+	Frequency string `json:"frequency" binding:"required,oneof=daily weekly" example:"weekly"`
+	Hour      *int   `json:"hour" binding:"required,min=0,max=23" example:"9"`
+	// Weekday is required for weekly digests, from Sunday (0) to Saturday (6)
+	Weekday *int `json:"weekday" binding:"omitempty,min=0,max=6" example:"1"`
+	// Timezone is an IANA zone, the owner's own by default
+	Timezone string `json:"timezone" binding:"max=64" example:"Europe/Berlin"`
+}
+
+// @Summary Get a conversation's digest
+// @Description Get when the group's activity digest is posted. Any participant can see it.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.ConversationDigest
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/digest [get]
+func (h *Handler) GetConversationDigest(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	digest, err := models.NewDigestService(h.db, h.encryptor).Get(conversationID, userID)
+	if err != nil {
+		h.respondWithDigestError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, digest)
+}
+
+// @Summary Schedule a conversation's digest
+// @Description Post a daily or weekly digest into the group, summarizing its messages, new members, most active members and most replied threads. Daily digests cover the day before and weekly ones the seven days before. Digests are posted at the given hour in the given timezone, or the owner's, and skipped when nothing happened. Only the owner can schedule it.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param digest body SetDigestRequest true "Digest schedule"
+// @Success 200 {object} models.ConversationDigest
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/digest [put]
+func (h *Handler) SetConversationDigest(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req SetDigestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if req.Frequency == models.DigestWeekly && req.Weekday == nil {
+		h.respondWithError(c, http.StatusBadRequest, "Weekly digests need a weekday")
+		return
+	}
+	if req.Timezone == "" {
+		if req.Timezone, err = models.NewUserService(h.db, h.encryptor).Timezone(userID); err != nil {
+			logger.Error("Failed to get timezone", err)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to schedule digest")
+			return
+		}
+	} else if !models.ValidTimezone(req.Timezone) {
+		h.respondWithError(c, http.StatusBadRequest, "Timezone must be an IANA timezone, such as Europe/Berlin")
+		return
+	}
+
+	digest, err := models.NewDigestService(h.db, h.encryptor).Set(conversationID, userID, req.Frequency, *req.Hour, req.Weekday, req.Timezone)
+	if err != nil {
+		h.respondWithDigestError(c, err)
+		return
+	}
+
+	logger.Info("Conversation digest scheduled", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.digest_set",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"frequency":       digest.Frequency,
+	})
+	h.respondWithSuccess(c, http.StatusOK, digest)
+}
+
+// @Summary Stop a conversation's digest
+// @Description Stop posting the group's activity digest. Only the owner can stop it.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/digest [delete]
+func (h *Handler) DeleteConversationDigest(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.NewDigestService(h.db, h.encryptor).Delete(conversationID, userID); err != nil {
+		h.respondWithDigestError(c, err)
+		return
+	}
+
+	logger.Info("Conversation digest stopped", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.digest_delete",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Digest stopped"})
+}
+
+// PostDueDigests posts the digests that are due, as their group's owner
+func (h *Handler) PostDueDigests() error {
+	digestService := models.NewDigestService(h.db, h.encryptor)
+	due, err := digestService.ClaimDue(digestBatch)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	// The rollups are refreshed every few minutes; settle yesterday's before reporting on it
+	now := time.Now()
+	if err := models.NewAnalyticsService(h.db).RefreshDailyRollups(now.AddDate(0, 0, -1)); err != nil {
+		logger.Warn("Posting digests from rollups that may be behind", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	for i := range due {
+		digest := &due[i]
+		if digest.OwnerID == nil {
+			continue
+		}
+		report, err := digestService.Report(&digest.ConversationDigest, now)
+		if err != nil {
+			logger.Error("Failed to build conversation digest", err, map[string]interface{}{
+				"conversation_id": digest.ConversationID,
+			})
+			continue
+		}
+		if report.TotalMessages == 0 && report.MembersJoined == 0 {
+			continue
+		}
+		if err := h.sendSystemMessage(digest.ConversationID, *digest.OwnerID, digestText(digest.Frequency, report)); err != nil {
+			logger.Error("Failed to post conversation digest", err, map[string]interface{}{
+				"conversation_id": digest.ConversationID,
+			})
+		}
+	}
+	return nil
+}
+
+// digestText writes a digest report as the system message posting it
+func digestText(frequency string, report *models.DigestReport) string {
+	var b strings.Builder
+	if frequency == models.DigestWeekly {
+		fmt.Fprintf(&b, "Weekly digest, %s to %s: ", report.From.Format("Mon 2 Jan"), report.To.Format("Mon 2 Jan"))
+	} else {
+		fmt.Fprintf(&b, "Daily digest for %s: ", report.To.Format("Mon 2 Jan"))
+	}
+	fmt.Fprintf(&b, "%d %s", report.TotalMessages, plural(report.TotalMessages, "message", "messages"))
+	if report.MembersJoined > 0 {
+		fmt.Fprintf(&b, ", %d new %s", report.MembersJoined, plural(report.MembersJoined, "member", "members"))
+		if len(report.NewMembers) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(report.NewMembers, ", "))
+		}
+	}
+	b.WriteString(".")
+
+	if len(report.MostActive) > 0 {
+		active := make([]string, len(report.MostActive))
+		for i, member := range report.MostActive {
+			active[i] = fmt.Sprintf("%s (%d)", member.Username, member.MessageCount)
+		}
+		fmt.Fprintf(&b, "\nMost active: %s.", strings.Join(active, ", "))
+	}
+
+	if len(report.TopThreads) > 0 {
+		threads := make([]string, len(report.TopThreads))
+		for i, thread := range report.TopThreads {
+			replies := fmt.Sprintf("%d %s", thread.ReplyCount, plural(thread.ReplyCount, "reply", "replies"))
+			if thread.Preview != "" {
+				threads[i] = fmt.Sprintf("%s's \"%s\" (%s)", thread.SenderUsername, thread.Preview, replies)
+			} else {
+				threads[i] = fmt.Sprintf("a message by %s (%s)", thread.SenderUsername, replies)
+			}
+		}
+		fmt.Fprintf(&b, "\nTop threads: %s.", strings.Join(threads, "; "))
+	}
+	return b.String()
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func (h *Handler) respondWithDigestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "This conversation has no digest")
+	case errors.Is(err, models.ErrGroupOnly):
+		h.respondWithError(c, http.StatusBadRequest, "Only groups have digests")
+	case errors.Is(err, models.ErrNotOwner):
+		h.respondWithError(c, http.StatusForbidden, "Only the owner can manage the digest")
+	default:
+		logger.Error("Failed to manage conversation digest", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage digest")
+	}
+}
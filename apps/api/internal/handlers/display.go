@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// displayTimezone returns the user's timezone when the client asked for display hints
+// with ?display_hints=true, and "" when it didn't. It answers 400 for a value that
+// isn't a boolean.
+func (h *Handler) displayTimezone(c *gin.Context, userID uuid.UUID) (string, bool) {
+	value, ok := c.GetQuery("display_hints")
+	if !ok {
+		return "", true
+	}
+	wanted, err := strconv.ParseBool(value)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "display_hints must be true or false")
+		return "", false
+	}
+	if !wanted {
+		return "", true
+	}
+	timezone, err := models.NewUserService(h.db, h.encryptor).Timezone(userID)
+	if err != nil {
+		logger.Error("Failed to get timezone", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get timezone")
+		return "", false
+	}
+	return timezone, true
+}
+
+// addMessageHints labels when each message was sent in timezone
+func addMessageHints(messages []models.Message, timezone string) {
+	now := time.Now()
+	for i := range messages {
+		messages[i].Display = models.NewDisplayHints(messages[i].CreatedAt, timezone, now)
+	}
+}
+
+// addConversationHints labels the last activity of each conversation in timezone,
+// falling back to when it was created
+func addConversationHints(conversations []models.Conversation, timezone string) {
+	now := time.Now()
+	for i := range conversations {
+		at := conversations[i].CreatedAt
+		if conversations[i].LastActivityAt != nil {
+			at = *conversations[i].LastActivityAt
+		}
+		conversations[i].Display = models.NewDisplayHints(at, timezone, now)
+	}
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SaveDraftRequest is the text of a draft and the message it replies to
+type SaveDraftRequest struct {
+	Content   string     `json:"content" example:"Let me check and get back to"`
+	ReplyToID *uuid.UUID `json:"reply_to_id"`
+}
+
+// StageAttachmentRequest is media the client uploaded to the media host, to send with
+// a draft
+type StageAttachmentRequest struct {
+	Type              string  `json:"type" binding:"required,oneof=image video audio file" example:"image"`
+	MediaURL          string  `json:"media_url" binding:"required,max=2048" example:"https://example.com/image.jpg"`
+	MediaThumbnailURL *string `json:"media_thumbnail_url" binding:"omitempty,max=2048" example:"https://example.com/thumbnail.jpg"`
+	MediaSize         *int    `json:"media_size" binding:"omitempty,min=0" example:"1024"`
+	MediaDuration     *int    `json:"media_duration" binding:"omitempty,min=0" example:"60"`
+	// ViewOnce media is hidden from message lists once sent; each recipient can open it once
+	ViewOnce bool `json:"view_once" example:"false"`
+}
+
+// @Summary Get a draft
+// @Description Get the message the user is writing in a conversation, with the media staged for it, as saved from any of their devices
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.MessageDraft
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft [get]
+func (h *Handler) GetDraft(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+
+	draft, err := models.NewDraftService(h.db, h.encryptor).Get(conversationID, userID)
+	if err != nil {
+		h.respondWithDraftError(c, err, "Failed to get draft")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, draft)
+}
+
+// @Summary Save a draft
+// @Description Save the text of the message the user is writing in a conversation, and the message it replies to, keeping any staged media. The user's other devices get a conversation.draft_changed event.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body SaveDraftRequest true "Draft"
+// @Success 200 {object} models.MessageDraft
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft [put]
+func (h *Handler) SaveDraft(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+	var req SaveDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	draft, err := models.NewDraftService(h.db, h.encryptor).Save(conversationID, userID, req.Content, req.ReplyToID)
+	if err != nil {
+		h.respondWithDraftError(c, err, "Failed to save draft")
+		return
+	}
+	h.draftChanged(conversationID, userID, draft)
+	h.respondWithSuccess(c, http.StatusOK, draft)
+}
+
+// @Summary Discard a draft
+// @Description Discard the user's draft in a conversation with its staged media
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft [delete]
+func (h *Handler) DeleteDraft(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+
+	if err := models.NewDraftService(h.db, h.encryptor).Delete(conversationID, userID); err != nil {
+		h.respondWithDraftError(c, err, "Failed to discard draft")
+		return
+	}
+	h.draftChanged(conversationID, userID, nil)
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Draft discarded"})
+}
+
+// @Summary Stage media for a draft
+// @Description Attach media the client uploaded to the media host to the user's draft, starting an empty draft when there is none. A draft has one attachment, as a message has; staging again replaces it. Sending the draft turns the staged media into the media of the message, and media staged for drafts left untouched for a while, a week by default, is removed.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body StageAttachmentRequest true "Uploaded media"
+// @Success 200 {object} models.MessageDraft
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft/attachment [put]
+func (h *Handler) StageDraftAttachment(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+	var req StageAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	for _, raw := range []*string{&req.MediaURL, req.MediaThumbnailURL} {
+		if raw == nil {
+			continue
+		}
+		if u, err := url.Parse(*raw); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			h.respondWithError(c, http.StatusBadRequest, "media_url and media_thumbnail_url must be http or https URLs")
+			return
+		}
+	}
+	if req.ViewOnce && req.Type == string(models.FileMessage) {
+		h.respondWithError(c, http.StatusBadRequest, "Only image, video and audio messages can be view-once")
+		return
+	}
+	if req.MediaSize != nil && h.cfg.Quota.MaxMediaSize > 0 && int64(*req.MediaSize) > h.cfg.Quota.MaxMediaSize {
+		h.respondWithError(c, http.StatusRequestEntityTooLarge, "Media exceeds the maximum allowed size")
+		return
+	}
+
+	draft, err := models.NewDraftService(h.db, h.encryptor).Stage(conversationID, userID, &models.StagedAttachment{
+		MessageType:       req.Type,
+		MediaURL:          req.MediaURL,
+		MediaThumbnailURL: req.MediaThumbnailURL,
+		MediaSize:         req.MediaSize,
+		MediaDuration:     req.MediaDuration,
+		ViewOnce:          req.ViewOnce,
+	})
+	if err != nil {
+		h.respondWithDraftError(c, err, "Failed to stage attachment")
+		return
+	}
+	h.draftChanged(conversationID, userID, draft)
+	h.respondWithSuccess(c, http.StatusOK, draft)
+}
+
+// @Summary Remove staged media from a draft
+// @Description Remove the media staged for the user's draft, keeping its text
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.MessageDraft
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft/attachment [delete]
+func (h *Handler) UnstageDraftAttachment(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+
+	draftService := models.NewDraftService(h.db, h.encryptor)
+	if err := draftService.Unstage(conversationID, userID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "No attachment is staged")
+			return
+		}
+		h.respondWithDraftError(c, err, "Failed to remove attachment")
+		return
+	}
+	draft, err := draftService.Get(conversationID, userID)
+	if err != nil {
+		h.respondWithDraftError(c, err, "Failed to get draft")
+		return
+	}
+	h.draftChanged(conversationID, userID, draft)
+	h.respondWithSuccess(c, http.StatusOK, draft)
+}
+
+// @Summary Send a draft
+// @Description Send the user's draft as a message, with its staged media, and discard it, all at once: a draft sent twice is only sent once, and the second attempt gets 404. Drafts are sent as POST /messages sends messages, so permissions, quotas, the content filter and the sender's undo send window apply, and a held message is answered 202.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 201 {object} models.Message
+// @Success 202 {object} PendingMessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/draft/send [post]
+func (h *Handler) SendDraft(c *gin.Context) {
+	conversationID, userID, ok := h.draftParams(c)
+	if !ok {
+		return
+	}
+
+	draftService := models.NewDraftService(h.db, h.encryptor)
+	draft, err := draftService.Get(conversationID, userID)
+	if err != nil {
+		h.respondWithDraftError(c, err, "Failed to get draft")
+		return
+	}
+	if !h.requirePermission(c, conversationID, userID, models.ActionSend) {
+		return
+	}
+	if draft.ReplyToID != nil && !h.requirePermission(c, conversationID, userID, models.ActionReply) {
+		return
+	}
+	var mediaSize int64
+	if draft.Attachment != nil && draft.Attachment.MediaSize != nil {
+		mediaSize = int64(*draft.Attachment.MediaSize)
+	}
+	if err := h.quotaService().CheckMessage(userID, mediaSize); err != nil {
+		switch {
+		case errors.Is(err, models.ErrMediaTooLarge):
+			h.respondWithError(c, http.StatusRequestEntityTooLarge, "Media exceeds the maximum allowed size")
+		case errors.Is(err, models.ErrQuotaExceeded):
+			h.respondWithError(c, http.StatusPaymentRequired, "Quota exceeded")
+		default:
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check quota")
+		}
+		return
+	}
+
+	var hold time.Duration
+	if user, ok := c.Get("user"); ok {
+		if sender, ok := user.(*models.User); ok {
+			hold = time.Duration(sender.UndoSendSeconds) * time.Second
+		}
+	}
+	message, content, pending, err := draftService.Send(conversationID, userID, hold, h.filterMessage)
+	if err != nil {
+		if errors.Is(err, models.ErrDraftEmpty) {
+			h.respondWithError(c, http.StatusBadRequest, "Write something before sending the draft")
+			return
+		}
+		if errors.Is(err, contentfilter.ErrBlocked) {
+			h.respondWithContentFilterError(c, &models.Message{ConversationID: conversationID, SenderID: userID}, err)
+			return
+		}
+		h.respondWithDraftError(c, err, "Failed to send draft")
+		return
+	}
+	h.draftChanged(conversationID, userID, nil)
+
+	if pending != nil {
+		h.respondWithSuccess(c, http.StatusAccepted, PendingMessageResponse{
+			Message:   message,
+			Pending:   true,
+			ReleaseAt: pending.ReleaseAt,
+		})
+		return
+	}
+	h.metrics.RecordMessage(message.ConversationID.String())
+	h.messageCreated(message, content)
+	h.respondWithSuccess(c, http.StatusCreated, message)
+}
+
+// draftParams parses the conversation and user of a draft request, responding itself
+// when ok is false
+func (h *Handler) draftParams(c *gin.Context) (conversationID, userID uuid.UUID, ok bool) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	conversationID, err = uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return conversationID, userID, true
+}
+
+// draftChanged tells the user's devices about their draft in a conversation, which is
+// nil once it is gone
+func (h *Handler) draftChanged(conversationID, userID uuid.UUID, draft *models.MessageDraft) {
+	h.publishToUsers([]uuid.UUID{userID}, EventDraftChanged, DraftChangedEvent{
+		ConversationID: conversationID,
+		Draft:          draft,
+	})
+}
+
+func (h *Handler) respondWithDraftError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrDraftNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Draft not found")
+	case errors.Is(err, models.ErrInvalidParticipant):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrInvalidInput):
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		logger.Error(message, err, nil)
+		h.respondWithError(c, http.StatusInternalServerError, message)
+	}
+}
+
+// PurgeStagedAttachments removes media staged for drafts nobody touched within the
+// configured time, and the drafts of users who left their conversation
+func (h *Handler) PurgeStagedAttachments() error {
+	purged, err := models.NewDraftService(h.db, h.encryptor).PurgeStaged(h.cfg.Retention.StagedAttachment)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Removed abandoned staged attachments", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// maxEmbedCounters bounds the keys whose requests are counted in memory
+const maxEmbedCounters = 100000
+
+// CreateEmbedKeyRequest issues a read-only key to a group's messages
+type CreateEmbedKeyRequest struct {
+	// Name tells what the key is used for
+	Name string `json:"name" binding:"required,max=100" example:"Status page"`
+	// AllowedDomains restricts the key to pages on these sites, such as example.com or
+	// *.example.com; any site can use it when empty
+	AllowedDomains []string `json:"allowed_domains"`
+	// RequestsPerMinute is how often the key may be used; 60 by default, at most 600
+	RequestsPerMinute int `json:"requests_per_minute" example:"60"`
+}
+
+// CreateEmbedKeyResponse is a new embed key, with the key itself
+type CreateEmbedKeyResponse struct {
+	models.EmbedKey
+	// Key is only returned when the key is created
+	Key string `json:"key"`
+}
+
+// EmbedFeedResponse is the feed an embed key grants
+type EmbedFeedResponse struct {
+	ConversationID uuid.UUID             `json:"conversation_id"`
+	Name           *string               `json:"name,omitempty"`
+	Messages       []models.EmbedMessage `json:"messages"`
+}
+
+// embedRequestCounter counts each embed key's requests in one minute windows
+type embedRequestCounter struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*embedRequestCount
+}
+
+type embedRequestCount struct {
+	start    time.Time
+	requests int
+}
+
+// take counts a request by key, allowed up to limit a minute. It returns whether the
+// request is allowed and when the key's window ends.
+func (ec *embedRequestCounter) take(key uuid.UUID, limit int, now time.Time) (bool, time.Time) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	count, ok := ec.keys[key]
+	if !ok || now.Sub(count.start) >= time.Minute {
+		if ec.keys == nil || len(ec.keys) >= maxEmbedCounters {
+			ec.keys = make(map[uuid.UUID]*embedRequestCount)
+		}
+		count = &embedRequestCount{start: now}
+		ec.keys[key] = count
+	}
+	reset := count.start.Add(time.Minute)
+	if count.requests >= limit {
+		return false, reset
+	}
+	count.requests++
+	return true, reset
+}
+
+func (h *Handler) RegisterEmbedRoutes(r *gin.RouterGroup) {
+	r.GET("/messages", h.GetEmbedFeed)
+}
+
+// @Summary List a conversation's embed keys
+// @Description List the keys giving read-only access to a group's messages, revoked ones included, newest first. Keys themselves are never shown again after being created. Only the owner can list them.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {array} models.EmbedKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/embed-keys [get]
+func (h *Handler) GetEmbedKeys(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	keys, err := models.NewEmbedKeyService(h.db, h.encryptor).List(conversationID, userID)
+	if err != nil {
+		h.respondWithEmbedKeyError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, keys)
+}
+
+// @Summary Create an embed key
+// @Description Issue a key giving read-only access to a group's messages, for embedding a live feed on a website or status screen with GET /embed/messages. The key is only returned now; store it. Keys can be restricted to pages on some domains, which browsers enforce, and are limited to a number of requests a minute. Only the owner can create keys, and a group can have 20 at once.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param key body CreateEmbedKeyRequest true "Key to create"
+// @Success 201 {object} CreateEmbedKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/embed-keys [post]
+func (h *Handler) CreateEmbedKey(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	var req CreateEmbedKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	key, secret, err := models.NewEmbedKeyService(h.db, h.encryptor).Create(conversationID, userID, &models.EmbedKeyInput{
+		Name:              req.Name,
+		AllowedDomains:    req.AllowedDomains,
+		RequestsPerMinute: req.RequestsPerMinute,
+	})
+	if err != nil {
+		h.respondWithEmbedKeyError(c, err)
+		return
+	}
+
+	logger.Info("Created embed key", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.embed_key_create",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"embed_key_id":    key.ID,
+		"allowed_domains": key.AllowedDomains,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, CreateEmbedKeyResponse{EmbedKey: *key, Key: secret})
+}
+
+// @Summary Revoke an embed key
+// @Description Stop an embed key from working; feeds using it get 401 from then on. Only the owner can revoke keys.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param key_id path string true "Embed key ID"
+// @Success 204 "Revoked"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/embed-keys/{key_id} [delete]
+func (h *Handler) RevokeEmbedKey(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid embed key ID")
+		return
+	}
+
+	if err := models.NewEmbedKeyService(h.db, h.encryptor).Revoke(conversationID, keyID, userID); err != nil {
+		h.respondWithEmbedKeyError(c, err)
+		return
+	}
+
+	logger.Info("Revoked embed key", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.embed_key_revoke",
+		"user_id":         userID,
+		"conversation_id": conversationID,
+		"embed_key_id":    keyID,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get an embedded feed
+// @Description Get the messages of the conversation an embed key was issued for, oldest first, without signing in. Without after, the latest messages are returned; poll with the ID of the last message received as after to get newer ones. Pages pass the key as the key query parameter; other clients may send it in X-Embed-Key instead. Keys restricted to domains only answer pages on them, and requests beyond the key's limit get 429 with a Retry-After header. Deleted and view-once messages are left out.
+// @Tags embed
+// @Produce json
+// @Param key query string false "Embed key"
+// @Param X-Embed-Key header string false "Embed key"
+// @Param after query string false "ID of the last message received"
+// @Param limit query int false "Number of messages to return" default(50) maximum(100)
+// @Success 200 {object} EmbedFeedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /embed/messages [get]
+func (h *Handler) GetEmbedFeed(c *gin.Context) {
+	secret := c.GetHeader("X-Embed-Key")
+	if secret == "" {
+		secret = c.Query("key")
+	}
+	if secret == "" {
+		h.respondWithError(c, http.StatusUnauthorized, "An embed key is required")
+		return
+	}
+
+	embedService := models.NewEmbedKeyService(h.db, h.encryptor)
+	key, err := embedService.Authenticate(secret)
+	if err != nil {
+		if errors.Is(err, models.ErrEmbedKeyNotFound) {
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid embed key")
+			return
+		}
+		logger.Error("Failed to authenticate embed key", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get feed")
+		return
+	}
+
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		origin = c.GetHeader("Referer")
+	}
+	if len(key.AllowedDomains) > 0 {
+		page, err := url.Parse(origin)
+		if err != nil || !key.AllowsHost(page.Hostname()) {
+			h.respondWithError(c, http.StatusForbidden, "This embed key can't be used on this site")
+			return
+		}
+	}
+	// Pages embedding the feed may be on any site the key allows, whatever CORS allows
+	if c.GetHeader("Origin") != "" {
+		c.Header("Access-Control-Allow-Origin", c.GetHeader("Origin"))
+		c.Writer.Header().Del("Access-Control-Allow-Credentials")
+		c.Header("Access-Control-Expose-Headers", "Retry-After, X-Page-Limit")
+		c.Header("Vary", "Origin")
+	}
+
+	now := time.Now()
+	allowed, reset := h.embedRequests.take(key.ID, key.RequestsPerMinute, now)
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reset.Sub(now).Seconds()))))
+		h.respondWithError(c, http.StatusTooManyRequests, "Too many requests for this embed key")
+		return
+	}
+
+	limit, ok := h.parseLimit(c, 50, models.MaxEmbedMessages)
+	if !ok {
+		return
+	}
+	var after *uuid.UUID
+	if value := strings.TrimSpace(c.Query("after")); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid after. Must be a message ID")
+			return
+		}
+		after = &id
+	}
+
+	messages, err := embedService.Messages(key, after, limit)
+	if err != nil {
+		logger.Error("Failed to get embed feed", err, map[string]interface{}{
+			"embed_key_id": key.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get feed")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, EmbedFeedResponse{
+		ConversationID: key.ConversationID,
+		Name:           key.ConversationName,
+		Messages:       messages,
+	})
+}
+
+func (h *Handler) respondWithEmbedKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidInput):
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrEmbedKeyNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Embed key not found")
+	case errors.Is(err, models.ErrGroupOnly):
+		h.respondWithError(c, http.StatusBadRequest, "Only groups can be embedded")
+	case errors.Is(err, models.ErrNotOwner):
+		h.respondWithError(c, http.StatusForbidden, "Only the owner can manage embed keys")
+	case errors.Is(err, models.ErrEmbedKeyLimit):
+		h.respondWithError(c, http.StatusConflict, "The group has as many embed keys as allowed; revoke one first")
+	default:
+		logger.Error("Failed to manage embed keys", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage embed keys")
+	}
+}
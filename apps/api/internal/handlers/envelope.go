@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"reflect"
+	"strconv"
+
+	"talkify/apps/api/internal/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageOffsetKey is where parsePage leaves the offset of a list request
+const pageOffsetKey = "page_offset"
+
+// ListEnvelope is how version 2 of the API responds with a list, so that paging and
+// other metadata can be added without changing the shape of the response
+type ListEnvelope struct {
+	Data interface{} `json:"data"`
+	// Paging is null for lists that aren't paged
+	Paging *Paging  `json:"paging"`
+	Meta   ListMeta `json:"meta"`
+}
+
+// Paging tells where a page of a list sits and where the next one starts. It carries
+// what version 1 sends in the X-Page-Limit, X-Total-Count, X-Next-Offset and
+// X-Next-Cursor headers, which version 2 still sends.
+type Paging struct {
+	Limit  int  `json:"limit"`
+	Offset *int `json:"offset,omitempty"`
+	// Total is left out when the list isn't counted
+	Total *int `json:"total,omitempty"`
+	// NextOffset and NextCursor are null on the last page
+	NextOffset *int    `json:"next_offset"`
+	NextCursor *string `json:"next_cursor,omitempty"`
+}
+
+// ListMeta describes the response rather than the list. It holds nothing that changes
+// from one request to the next, such as the request ID, so that tagged lists keep their
+// ETag.
+type ListMeta struct {
+	APIVersion int `json:"api_version" example:"2"`
+}
+
+// serialize returns what to respond with for data: version 2 of the API wraps lists in
+// a ListEnvelope, and everything else is sent as it is. Handlers set the page headers
+// before responding, as the paging is read from them.
+func (h *Handler) serialize(c *gin.Context, data interface{}) interface{} {
+	if server.APIVersion(c.Request) < 2 || !isList(data) {
+		return data
+	}
+	envelope := ListEnvelope{
+		Data:   data,
+		Paging: paging(c),
+		Meta:   ListMeta{APIVersion: 2},
+	}
+	if reflect.ValueOf(data).IsNil() {
+		envelope.Data = []interface{}{}
+	}
+	return envelope
+}
+
+// isList reports whether data is sent as a JSON array
+func isList(data interface{}) bool {
+	t := reflect.TypeOf(data)
+	if t == nil || t.Kind() != reflect.Slice {
+		return false
+	}
+	// Byte slices are sent as strings, and raw JSON as whatever it holds
+	return t.Elem().Kind() != reflect.Uint8
+}
+
+// paging reads the page headers of a response, returning nil when there are none
+func paging(c *gin.Context) *Paging {
+	header := c.Writer.Header()
+	limit, err := strconv.Atoi(header.Get("X-Page-Limit"))
+	if err != nil {
+		return nil
+	}
+	p := &Paging{Limit: limit}
+	if offset, ok := c.Get(pageOffsetKey); ok {
+		if offset, ok := offset.(int); ok {
+			p.Offset = &offset
+		}
+	}
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		p.Total = &total
+	}
+	if next, err := strconv.Atoi(header.Get("X-Next-Offset")); err == nil {
+		p.NextOffset = &next
+	}
+	if cursor := header.Get("X-Next-Cursor"); cursor != "" {
+		p.NextCursor = &cursor
+	}
+	return p
+}
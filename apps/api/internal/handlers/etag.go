@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithETag responds with data as JSON, tagged so that polling clients can send
+// the tag back in If-None-Match and get a bodiless 304 while nothing changed
+func (h *Handler) respondWithETag(c *gin.Context, data interface{}) {
+	body, err := json.Marshal(h.serialize(c, data))
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	h.respondWithETagData(c, "application/json; charset=utf-8", body)
+}
+
+// respondWithETagData responds with body, tagged with its hash. The tag covers the
+// whole payload rather than updated_at alone: unread counts, read receipts and
+// presence change without touching it.
+func (h *Handler) respondWithETagData(c *gin.Context, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	// Payloads are per user and must be revalidated before being reused
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing weakly as
+// RFC 9110 asks for
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
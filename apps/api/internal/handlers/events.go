@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"talkify/apps/api/internal/delivery"
+	"talkify/apps/api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// WebSocket event types pushed by the server
+const (
+	EventNewMessage           = "new_message"
+	EventMessageUpdated       = "message.updated"
+	EventMessageDeleted       = "message.deleted"
+	EventMessageOpened        = "message.opened"
+	EventMessageDelivered     = "message.delivered"
+	EventMessageAnnotated     = "message.annotated"
+	EventInteractionCreated   = "interaction.created"
+	EventOwnershipTransferred = "conversation.ownership_transferred"
+	EventConversationLocked   = "conversation.locked"
+	EventConversationUnlocked = "conversation.unlocked"
+	EventConversationRead     = "conversation.read"
+	EventConversationsChanged = "conversations.state_changed"
+	EventDraftChanged         = "conversation.draft_changed"
+	EventMessagesRead         = "messages.read"
+	EventPresenceChanged      = "presence.changed"
+	EventTypingStart          = "typing_start"
+	EventTypingStop           = "typing_stop"
+	EventNotificationCreated  = "notification.created"
+	EventUrgentBroadcast      = "broadcast.urgent"
+	// EventsReset tells a reconnecting client that events it missed are no longer
+	// retained, so it has to reload its conversations instead of replaying
+	EventsReset = "events.reset"
+	// EventBatch carries several events, oldest first, as its payload. Only clients that
+	// connect with batch=true get them.
+	EventBatch = "batch"
+	// EventSessionSuperseded tells a connection that a newer one of the same device, or
+	// in single-session mode of the same user, took over its events
+	EventSessionSuperseded = "session.superseded"
+	// EventSessionResumed tells a waiting connection that it gets its device's events
+	// again, the newer connection having closed. Events sent meanwhile went to that one.
+	EventSessionResumed = "session.resumed"
+	// EventResumeToken gives a connection the token to reconnect with once it is lost.
+	// It is sent on connecting and again before the previous token expires.
+	EventResumeToken = "session.resume_token"
+)
+
+// PresenceChangedEvent is the payload of a presence.changed event
+type PresenceChangedEvent struct {
+	UserID   uuid.UUID `json:"user_id"`
+	IsOnline bool      `json:"is_online"`
+}
+
+// TypingEvent is the payload of typing_start and typing_stop events. Clients stop
+// showing a participant as typing once ExpiresAt passes without another event.
+type TypingEvent struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	IsTyping       bool       `json:"is_typing"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// SessionSupersededEvent is the payload of a session.superseded event
+type SessionSupersededEvent struct {
+	// ConnectionID is the connection that took over
+	ConnectionID uuid.UUID `json:"connection_id"`
+	// Closing is set in single-session mode, where the connection is closed after this
+	// event. Otherwise it stays open but gets no events until it is resumed.
+	Closing bool `json:"closing"`
+}
+
+// ResumeTokenEvent is the payload of a session.resume_token event
+type ResumeTokenEvent struct {
+	// Token is passed as resume when reconnecting, in place of the access token
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EventsResetEvent is the payload of an events.reset event
+type EventsResetEvent struct {
+	LastEventID uint64 `json:"last_event_id"`
+}
+
+// MessageDeletedEvent is the payload of a message.deleted event
+type MessageDeletedEvent struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
+
+// MessageOpenedEvent is the payload of a message.opened event, sent to the sender of a
+// view-once message when a recipient opens it
+type MessageOpenedEvent struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	OpenedAt       time.Time `json:"opened_at"`
+}
+
+// MessageDeliveredEvent is the payload of a message.delivered event, sent to the sender
+// of a message once the deployment of a federated recipient acknowledged it
+type MessageDeliveredEvent struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
+
+// MessageAnnotatedEvent is the payload of a message.annotated event, sent when an
+// integration sets or removes an annotation. Annotation is left out on removal.
+type MessageAnnotatedEvent struct {
+	MessageID      uuid.UUID                 `json:"message_id"`
+	ConversationID uuid.UUID                 `json:"conversation_id"`
+	Source         string                    `json:"source"`
+	Key            string                    `json:"key"`
+	Annotation     *models.MessageAnnotation `json:"annotation,omitempty"`
+}
+
+// OwnershipTransferredEvent is the payload of a conversation.ownership_transferred event
+type OwnershipTransferredEvent struct {
+	ConversationID  uuid.UUID `json:"conversation_id"`
+	PreviousOwnerID uuid.UUID `json:"previous_owner_id"`
+	NewOwnerID      uuid.UUID `json:"new_owner_id"`
+}
+
+// ConversationReadEvent is the payload of a conversation.read event, sent to every
+// device of a user who read a conversation so that its unread badge clears everywhere
+type ConversationReadEvent struct {
+	ConversationID    uuid.UUID  `json:"conversation_id"`
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id"`
+	LastReadAt        time.Time  `json:"last_read_at"`
+	UnreadCount       int        `json:"unread_count"`
+}
+
+// ConversationsStateEvent is the payload of a conversations.state_changed event, sent to
+// a user's devices when they mute, unmute, archive or unarchive conversations, or change
+// their notification preview or pins. Only the fields that changed are set.
+type ConversationsStateEvent struct {
+	ConversationIDs []uuid.UUID `json:"conversation_ids"`
+	Muted           *bool       `json:"muted,omitempty"`
+	MutedUntil      *time.Time  `json:"muted_until,omitempty"`
+	Archived        *bool       `json:"archived,omitempty"`
+	// NotificationPreview is "default" once the conversation goes back to the user's
+	// default preview
+	NotificationPreview *string `json:"notification_preview,omitempty"`
+	// Pins is the user's pinned conversations in order once they change, empty when
+	// none are left
+	Pins *[]uuid.UUID `json:"pins,omitempty"`
+}
+
+// DraftChangedEvent is the payload of a conversation.draft_changed event, sent to a
+// user's devices when they save, stage media for, discard or send a draft. Draft is
+// left out once the draft is gone.
+type DraftChangedEvent struct {
+	ConversationID uuid.UUID            `json:"conversation_id"`
+	Draft          *models.MessageDraft `json:"draft,omitempty"`
+}
+
+// MessagesReadEvent is the payload of a messages.read event, sent to a sender when a
+// participant reads their messages: Count of them were read, up to LastReadMessageID
+type MessagesReadEvent struct {
+	ConversationID    uuid.UUID `json:"conversation_id"`
+	ReaderID          uuid.UUID `json:"reader_id"`
+	LastReadMessageID uuid.UUID `json:"last_read_message_id"`
+	Count             int       `json:"count"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// ConversationLockEvent is the payload of conversation.locked and conversation.unlocked
+// events. LockedUntil and Reason are left out on unlock, and UserID when a lock expires.
+type ConversationLockEvent struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	UserID         *uuid.UUID `json:"user_id,omitempty"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	Reason         *string    `json:"reason,omitempty"`
+}
+
+// publishToConversation pushes an event to the connected participants of a conversation
+// and keeps it in the event log for clients that reconnect. It runs on the worker pool
+// so the request does not wait on the participant lookup.
+func (h *Handler) publishToConversation(conversationID uuid.UUID, eventType string, payload interface{}) {
+	h.submitTask("publish_"+eventType, func() error {
+		// Logged first so the event ID is part of what reconnecting clients replay
+		event, err := h.events.Append(conversationID.String(), func(id uint64) ([]byte, error) {
+			return json.Marshal(Message{ID: id, Type: eventType, Payload: payload})
+		})
+		if err != nil {
+			return err
+		}
+
+		conversationService := models.NewConversationService(h.db, h.encryptor)
+		participants, err := conversationService.ParticipantIDs(conversationID)
+		if err != nil {
+			return err
+		}
+
+		// Apps installed in the conversation receive its events too, connected as themselves
+		apps, err := models.NewOAuthService(h.db).EventAppIDs(conversationID)
+		if err != nil {
+			return err
+		}
+
+		userIDs := make([]string, 0, len(participants)+len(apps))
+		for _, id := range append(participants, apps...) {
+			userIDs = append(userIDs, id.String())
+		}
+		acking, untracked := h.hub.SendToUsers(userIDs, event.Data)
+		h.metrics.RecordFanout(conversationID.String(), len(userIDs))
+
+		var messageID string
+		if message, ok := payload.(*models.Message); ok && eventType == EventNewMessage {
+			messageID = message.ID.String()
+		}
+		for _, userID := range acking {
+			h.deliveries.Sent(delivery.Delivery{
+				UserID:         userID,
+				EventID:        event.ID,
+				ConversationID: conversationID.String(),
+				Type:           eventType,
+				SentAt:         event.At,
+				MessageID:      messageID,
+			})
+		}
+		// Connections that don't acknowledge events are taken to have shown the message
+		if messageID != "" && len(untracked) > 0 {
+			return h.recordSeen(messageID, untracked)
+		}
+		return nil
+	})
+}
+
+// publishToUsers pushes an event to specific users only. These events are not kept in
+// the event log, which replays to every participant of a conversation.
+func (h *Handler) publishToUsers(userIDs []uuid.UUID, eventType string, payload interface{}) {
+	h.submitTask("publish_"+eventType, func() error {
+		message, err := json.Marshal(Message{Type: eventType, Payload: payload})
+		if err != nil {
+			return err
+		}
+
+		recipients := make([]string, len(userIDs))
+		for i, id := range userIDs {
+			recipients[i] = id.String()
+		}
+		h.hub.SendToUsers(recipients, message)
+		return nil
+	})
+}
+
+// PublishToUsers pushes an event to the connected clients of specific users, for
+// programs embedding the API that have events of their own
+func (h *Handler) PublishToUsers(userIDs []uuid.UUID, eventType string, payload interface{}) {
+	h.publishToUsers(userIDs, eventType, payload)
+}
+
+// messageCreated runs what follows a user's new message being stored: notifications,
+// keyword alerts and message automations. content is the message's plaintext.
+func (h *Handler) messageCreated(message *models.Message, content string) {
+	h.notifyMessage(message)
+	h.alertKeywords(message, content)
+	h.runMessageAutomations(message, content)
+	h.federateMessage(message)
+}
+
+// conversationRead tells a user's devices that they read a conversation up to cursor
+func (h *Handler) conversationRead(conversationID uuid.UUID, cursor *models.ConversationCursor) {
+	h.publishToUsers([]uuid.UUID{cursor.UserID}, EventConversationRead, ConversationReadEvent{
+		ConversationID:    conversationID,
+		LastReadMessageID: cursor.LastReadMessageID,
+		LastReadAt:        cursor.LastReadAt,
+		UnreadCount:       cursor.UnreadCount,
+	})
+}
+
+// messagesRead tells the senders of messages a participant newly read that they were
+// read
+func (h *Handler) messagesRead(conversationID uuid.UUID, read *models.ConversationRead) {
+	for _, receipt := range read.Receipts {
+		h.publishToUsers([]uuid.UUID{receipt.SenderID}, EventMessagesRead, MessagesReadEvent{
+			ConversationID:    conversationID,
+			ReaderID:          read.Cursor.UserID,
+			LastReadMessageID: receipt.MessageID,
+			Count:             receipt.Count,
+			ReadAt:            read.Cursor.LastReadAt,
+		})
+	}
+}
+
+// postSystemMessage writes a server-authored message to a conversation and pushes it
+// to the connected participants as a new message
+func (h *Handler) postSystemMessage(conversationID, actorID uuid.UUID, content string) {
+	h.submitTask("post_system_message", func() error {
+		return h.sendSystemMessage(conversationID, actorID, content)
+	})
+}
+
+// sendSystemMessage stores a system message and pushes it to the participants, for
+// callers already running in the background
+func (h *Handler) sendSystemMessage(conversationID, actorID uuid.UUID, content string) error {
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	message := &models.Message{
+		ConversationID: conversationID,
+		SenderID:       actorID,
+		Content:        content,
+		MessageType:    string(models.SystemMessage),
+	}
+	if err := messageService.Create(message); err != nil {
+		return err
+	}
+	h.metrics.RecordMessage(conversationID.String())
+
+	// Create leaves the stored, encrypted content behind
+	message.Content = content
+	h.publishToConversation(conversationID, EventNewMessage, message)
+	return nil
+}
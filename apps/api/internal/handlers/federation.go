@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"talkify/apps/api/internal/federation"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func (h *Handler) RegisterFederationRoutes(r *gin.RouterGroup) {
+	// The inbox authenticates deployments by their signatures rather than a user token
+	r.POST("/inbox", h.ReceiveFederatedMessage)
+
+	authorized := r.Group("", h.AuthMiddleware())
+	{
+		authorized.GET("/lookup", h.LookupFederatedUser)
+		authorized.POST("/conversations", h.StartFederatedConversation)
+	}
+}
+
+// @Summary Look up a user by address
+// @Description Resolve an address such as alice@chat.example.com to a Talkify account, on this server or on another deployment it federates with. Other deployments are asked for a signed WebFinger document, which is only trusted once its signature checks out against the key the deployment publishes. Only configured peers are asked; addresses elsewhere are refused with 403.
+// @Tags users
+// @Produce json
+// @Param address query string true "Address, as user@domain" example(alice@chat.example.com)
+// @Success 200 {object} federation.Identity
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /federation/lookup [get]
+func (h *Handler) LookupFederatedUser(c *gin.Context) {
+	if h.federationSigner == nil {
+		h.respondWithError(c, http.StatusServiceUnavailable, "Federation is not configured")
+		return
+	}
+	address, err := federation.ParseAddress(c.Query("address"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "The address must look like user@domain")
+		return
+	}
+
+	if address.Domain == h.federationSigner.Domain() {
+		user, ok := h.federatedUser(c, address)
+		if !ok {
+			return
+		}
+		h.respondWithSuccess(c, http.StatusOK, federation.Identity{
+			Address:  address.String(),
+			Domain:   address.Domain,
+			UserID:   user.ID,
+			Username: user.Username,
+			Local:    true,
+		})
+		return
+	}
+
+	identity, err := h.federation.Lookup(c.Request.Context(), address)
+	if err != nil {
+		h.respondWithFederationError(c, address.Domain, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, identity)
+}
+
+// @Summary WebFinger
+// @Description Describe an account of this server to other deployments, as a WebFinger document signed with the server's key; see /.well-known/talkify-keys. Only active accounts are described.
+// @Tags federation
+// @Produce json
+// @Param resource query string true "Account, as acct:user@domain" example(acct:alice@chat.example.com)
+// @Success 200 {object} federation.Document
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /.well-known/webfinger [get]
+func (h *Handler) GetWebFinger(c *gin.Context) {
+	if h.federationSigner == nil {
+		h.respondWithError(c, http.StatusNotFound, "Federation is not enabled")
+		return
+	}
+	address, err := federation.ParseAddress(c.Query("resource"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "The resource must look like acct:user@domain")
+		return
+	}
+	if address.Domain != h.federationSigner.Domain() {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	user, ok := h.federatedUser(c, address)
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(federation.NewDocument(address, user.ID))
+	if err != nil {
+		logger.Error("Failed to encode WebFinger document", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to describe user")
+		return
+	}
+	h.federationSigner.Sign(c.Writer.Header(), body)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/jrd+json", body)
+}
+
+// @Summary Get federation keys
+// @Description Public keys other deployments verify this server's WebFinger documents with
+// @Tags federation
+// @Produce json
+// @Success 200 {object} federation.KeyDocument
+// @Failure 404 {object} ErrorResponse
+// @Router /.well-known/talkify-keys [get]
+func (h *Handler) GetFederationKeys(c *gin.Context) {
+	if h.federationSigner == nil {
+		h.respondWithError(c, http.StatusNotFound, "Federation is not enabled")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	h.respondWithSuccess(c, http.StatusOK, h.federationSigner.Keys())
+}
+
+// federatedUser returns the active account at a local address, answering 404 when
+// there is none
+func (h *Handler) federatedUser(c *gin.Context, address federation.Address) (*models.User, bool) {
+	user, err := models.NewUserService(h.db, h.encryptor).GetByUsername(address.Username)
+	if err == sql.ErrNoRows || (err == nil && (!user.IsActive || user.IsSystem)) {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to look up user", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to look up user")
+		return nil, false
+	}
+	return user, true
+}
+
+// respondWithFederationError answers for a lookup of a user of domain that failed
+func (h *Handler) respondWithFederationError(c *gin.Context, domain string, err error) {
+	switch {
+	case errors.Is(err, federation.ErrPeerNotAllowed):
+		h.respondWithError(c, http.StatusForbidden, "Users of "+domain+" can't be looked up from this server")
+	case errors.Is(err, federation.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, federation.ErrBadSignature), errors.Is(err, federation.ErrInvalidResponse):
+		logger.Warn("Rejected federation answer", map[string]interface{}{
+			"domain": domain,
+			"error":  err.Error(),
+		})
+		h.respondWithError(c, http.StatusBadGateway, "The answer of "+domain+" could not be verified")
+	default:
+		logger.Error("Failed to look up federated user", err, map[string]interface{}{
+			"domain": domain,
+		})
+		h.respondWithError(c, http.StatusBadGateway, "Could not reach "+domain)
+	}
+}
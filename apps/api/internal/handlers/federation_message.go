@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/federation"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// federationBatch is how many federated messages one run of the delivery job offers
+const federationBatch = 50
+
+// StartFederatedConversationRequest names the user of another deployment to message
+type StartFederatedConversationRequest struct {
+	Address string `json:"address" binding:"required" example:"alice@chat.example.com"`
+}
+
+// federatedMessagesEnabled reports whether direct messages are exchanged with peers
+func (h *Handler) federatedMessagesEnabled() bool {
+	return h.federationSigner != nil && h.cfg.Federation.DirectMessages
+}
+
+// @Summary Message a user of another deployment
+// @Description Open the direct conversation with a user of a federated deployment, found by address as with lookup, starting it when needed. The user is shown as a participant named by their address; messages sent in the conversation are delivered to their deployment. Experimental.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param request body StartFederatedConversationRequest true "User to message"
+// @Success 200 {object} models.Conversation "Existing conversation"
+// @Success 201 {object} models.Conversation "New conversation"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /federation/conversations [post]
+func (h *Handler) StartFederatedConversation(c *gin.Context) {
+	if !h.federatedMessagesEnabled() {
+		h.respondWithError(c, http.StatusServiceUnavailable, "Federated messages are not enabled")
+		return
+	}
+	currentUserID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req StartFederatedConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	address, err := federation.ParseAddress(req.Address)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "The address must look like user@domain")
+		return
+	}
+	if address.Domain == h.federationSigner.Domain() {
+		h.respondWithError(c, http.StatusBadRequest, address.String()+" is a user of this server")
+		return
+	}
+
+	identity, err := h.federation.Lookup(c.Request.Context(), address)
+	if err != nil {
+		h.respondWithFederationError(c, address.Domain, err)
+		return
+	}
+	shadow, err := models.NewFederationService(h.db, h.encryptor).EnsureShadowUser(identity.Address, identity.UserID)
+	if errors.Is(err, models.ErrConflict) {
+		h.respondWithError(c, http.StatusConflict, "A user of this server is named "+identity.Address)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to create shadow account", err, map[string]interface{}{
+			"address": identity.Address,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to open conversation")
+		return
+	}
+
+	conversationService := h.conversationService()
+	status := http.StatusOK
+	conversationID, err := h.openFederatedConversation(currentUserID, shadow.ID, &status)
+	if h.respondWithConversationLimit(c, currentUserID, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open federated conversation", err, map[string]interface{}{
+			"user_id": currentUserID,
+			"address": identity.Address,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to open conversation")
+		return
+	}
+
+	conversation, err := conversationService.GetByID(conversationID)
+	if err != nil {
+		logger.Error("Failed to get conversation", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to open conversation")
+		return
+	}
+	h.respondWithSuccess(c, status, conversation)
+}
+
+// openFederatedConversation returns the direct conversation between creatorID and
+// otherID, starting it as creatorID when needed, in which case status is set to 201
+func (h *Handler) openFederatedConversation(creatorID, otherID uuid.UUID, status *int) (uuid.UUID, error) {
+	conversationService := h.conversationService()
+	conversationID, err := conversationService.FindDirect(creatorID, otherID)
+	if errors.Is(err, models.ErrConversationNotFound) {
+		var conversation *models.Conversation
+		conversation, err = conversationService.Create(creatorID, &models.CreateConversationInput{
+			UserIDs: []uuid.UUID{otherID},
+		})
+		if errors.Is(err, models.ErrDuplicateParticipant) {
+			// Started concurrently
+			conversationID, err = conversationService.FindDirect(creatorID, otherID)
+		} else if err == nil {
+			conversationID, *status = conversation.ID, http.StatusCreated
+		}
+	}
+	return conversationID, err
+}
+
+// @Summary Receive a federated message
+// @Description Take a direct message from a user of a federated deployment to a user of this server. The envelope must be signed by the sender's deployment, which has to be a configured peer. The answer is a receipt signed with this server's key. An envelope delivered again is acknowledged without storing the message twice.
+// @Tags federation
+// @Accept json
+// @Produce json
+// @Param envelope body federation.Envelope true "Signed envelope"
+// @Success 200 {object} federation.Receipt
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /federation/inbox [post]
+func (h *Handler) ReceiveFederatedMessage(c *gin.Context) {
+	if !h.federatedMessagesEnabled() {
+		h.respondWithError(c, http.StatusNotFound, "Federated messages are not enabled")
+		return
+	}
+	body, err := federation.ReadBody(c.Request.Body)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid envelope")
+		return
+	}
+	var envelope federation.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.ID == uuid.Nil || envelope.Content == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid envelope")
+		return
+	}
+	from, err := federation.ParseAddress(envelope.From)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid sender address")
+		return
+	}
+	if !h.federation.Allowed(from.Domain) {
+		h.respondWithError(c, http.StatusForbidden, from.Domain+" is not a peer of this server")
+		return
+	}
+	if err := h.federation.Verify(c.Request.Context(), from.Domain, c.Request.Header, body); err != nil {
+		if errors.Is(err, federation.ErrBadSignature) || errors.Is(err, federation.ErrInvalidResponse) {
+			logger.Warn("Rejected federated message", map[string]interface{}{
+				"domain": from.Domain,
+				"error":  err.Error(),
+			})
+			h.respondWithError(c, http.StatusUnauthorized, "The envelope is not signed by "+from.Domain)
+			return
+		}
+		logger.Error("Failed to verify federated message", err, map[string]interface{}{
+			"domain": from.Domain,
+		})
+		h.respondWithError(c, http.StatusServiceUnavailable, "Could not get the keys of "+from.Domain)
+		return
+	}
+
+	to, err := federation.ParseAddress(envelope.To)
+	if err != nil || to.Domain != h.federationSigner.Domain() {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	recipient, ok := h.federatedUser(c, to)
+	if !ok {
+		return
+	}
+
+	federationService := models.NewFederationService(h.db, h.encryptor)
+	shadow, err := federationService.EnsureShadowUser(from.String(), envelope.FromUserID)
+	if errors.Is(err, models.ErrConflict) {
+		h.respondWithError(c, http.StatusConflict, "A user of this server is named "+from.String())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to create shadow account", err, map[string]interface{}{
+			"address": from.String(),
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to store message")
+		return
+	}
+
+	status := http.StatusOK
+	conversationID, err := h.openFederatedConversation(shadow.ID, recipient.ID, &status)
+	if h.respondWithConversationLimit(c, shadow.ID, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open federated conversation", err, map[string]interface{}{
+			"user_id": recipient.ID,
+			"address": from.String(),
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to store message")
+		return
+	}
+
+	content := envelope.Content
+	message, duplicate, err := federationService.StoreIncoming(from.Domain, envelope.ID, &models.Message{
+		ConversationID: conversationID,
+		SenderID:       shadow.ID,
+		Content:        content,
+		MessageType:    string(models.TextMessage),
+	})
+	if err != nil {
+		logger.Error("Failed to store federated message", err, map[string]interface{}{
+			"domain":      from.Domain,
+			"envelope_id": envelope.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to store message")
+		return
+	}
+	if !duplicate {
+		h.metrics.RecordMessage(conversationID.String())
+		message.Content = content
+		h.publishToConversation(conversationID, EventNewMessage, message)
+		h.messageCreated(message, content)
+	}
+
+	answer, err := json.Marshal(federation.Receipt{
+		EnvelopeID:  envelope.ID,
+		Status:      federation.ReceiptDelivered,
+		DeliveredAt: message.CreatedAt,
+	})
+	if err != nil {
+		logger.Error("Failed to encode receipt", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to store message")
+		return
+	}
+	h.federationSigner.Sign(c.Writer.Header(), answer)
+	c.Data(http.StatusOK, "application/json", answer)
+}
+
+// federateMessage queues a new text message in a direct conversation with a user of
+// another deployment for delivery there, and offers it right away
+func (h *Handler) federateMessage(message *models.Message) {
+	if !h.federatedMessagesEnabled() || models.MessageType(message.MessageType) != models.TextMessage {
+		return
+	}
+	h.submitTask("federate_message", func() error {
+		federationService := models.NewFederationService(h.db, h.encryptor)
+		// Messages from shadow accounts have no federated peer on the other side
+		peer, err := federationService.FederatedPeer(message.ConversationID, message.SenderID)
+		if err != nil || peer == nil {
+			return err
+		}
+		address, err := federation.ParseAddress(*peer.FederatedAddress)
+		if err != nil {
+			return err
+		}
+		if err := federationService.QueueOutgoing(message.ID, address.Domain); err != nil {
+			return err
+		}
+		return h.deliverFederatedMessages(&message.ID)
+	})
+}
+
+// DeliverFederatedMessages offers the federated messages that are due, such as those
+// whose earlier delivery failed, to the deployments of their recipients
+func (h *Handler) DeliverFederatedMessages() error {
+	if !h.federatedMessagesEnabled() {
+		return nil
+	}
+	return h.deliverFederatedMessages(nil)
+}
+
+// deliverFederatedMessages claims the due outgoing messages, or just messageID, and
+// delivers them
+func (h *Handler) deliverFederatedMessages(messageID *uuid.UUID) error {
+	federationService := models.NewFederationService(h.db, h.encryptor)
+	due, err := federationService.ClaimOutgoing(messageID, federationBatch)
+	if err != nil {
+		return err
+	}
+
+	for i := range due {
+		outgoing := &due[i]
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Federation.Timeout)
+		receipt, err := h.federation.Deliver(ctx, h.federationSigner, &federation.Envelope{
+			ID:         outgoing.MessageID,
+			From:       outgoing.SenderUsername + "@" + h.federationSigner.Domain(),
+			FromUserID: outgoing.SenderID,
+			To:         outgoing.RecipientAddress,
+			Content:    outgoing.Content,
+			SentAt:     outgoing.SentAt,
+		})
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to deliver federated message", map[string]interface{}{
+				"message_id": outgoing.MessageID,
+				"peer":       outgoing.Peer,
+				"attempt":    outgoing.Attempts + 1,
+				"error":      err.Error(),
+			})
+			if err := federationService.MarkAttemptFailed(outgoing.MessageID, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := federationService.MarkDelivered(outgoing.MessageID, receipt.DeliveredAt); err != nil {
+			return err
+		}
+		if err := models.NewMessageService(h.db, h.encryptor).MarkDelivered(outgoing.MessageID, []uuid.UUID{outgoing.RecipientID}); err != nil {
+			return err
+		}
+		h.publishToUsers([]uuid.UUID{outgoing.SenderID}, EventMessageDelivered, MessageDeliveredEvent{
+			MessageID:      outgoing.MessageID,
+			ConversationID: outgoing.ConversationID,
+			UserID:         outgoing.RecipientID,
+			DeliveredAt:    receipt.DeliveredAt,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// archiveBuildTimeout bounds how long fetching the files of one archive may take
+const archiveBuildTimeout = 30 * time.Minute
+
+// errArchiveTooLarge stops an archive that would exceed the configured size
+var errArchiveTooLarge = errors.New("archive too large")
+
+// @Summary List conversation files
+// @Description List the file attachments of a conversation the user can see, with who uploaded them and the message they were sent with.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param sort query string false "Sort by date, name or size" default(date)
+// @Param order query string false "asc or desc" default(desc)
+// @Param limit query int false "Number of files to return (1-100)" default(50)
+// @Param offset query int false "Number of files to skip" default(0)
+// @Success 200 {array} models.ConversationFile
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/files [get]
+func (h *Handler) GetConversationFiles(c *gin.Context) {
+	conversationID, userID, ok := h.fileAccess(c)
+	if !ok {
+		return
+	}
+
+	sortBy := c.DefaultQuery("sort", models.FileSortDate)
+	switch sortBy {
+	case models.FileSortDate, models.FileSortName, models.FileSortSize:
+	default:
+		h.respondWithError(c, http.StatusBadRequest, "Invalid sort. Must be date, name or size")
+		return
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid order. Must be asc or desc")
+		return
+	}
+
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	files, err := messageService.GetConversationFiles(conversationID, userID, sortBy, order == "desc")
+	if err != nil {
+		logger.Error("Failed to get conversation files", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get conversation files")
+		return
+	}
+
+	total := len(files)
+	if page.Offset < total {
+		files = files[page.Offset:]
+	} else {
+		files = files[:0]
+	}
+	if len(files) > page.Limit {
+		files = files[:page.Limit]
+	}
+	setPageHeaders(c, page, len(files), total)
+	h.respondWithSuccess(c, http.StatusOK, files)
+}
+
+// @Summary Request a zip of conversation files
+// @Description Start building a zip of every file in the conversation the user can see. Poll the returned archive until it is ready, then download it. Files on hosts the server does not fetch from are skipped. The workspace settings may leave exporting to the owners and admins of groups, or to nobody.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 202 {object} models.FileArchive
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/files/archive [post]
+func (h *Handler) CreateFileArchive(c *gin.Context) {
+	conversationID, userID, ok := h.fileAccess(c)
+	if !ok || !h.mayExport(c, conversationID, userID) {
+		return
+	}
+
+	archiveService := models.NewFileArchiveService(h.db)
+	archive, created, err := archiveService.Create(conversationID, userID, h.cfg.Media.ArchiveTTL)
+	if err != nil {
+		logger.Error("Failed to create file archive", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create file archive")
+		return
+	}
+
+	if created {
+		job := *archive
+		h.workerPool.Submit(worker.Task{
+			Name:    "file_archive",
+			Handler: func() error { return h.buildFileArchive(&job) },
+		})
+	}
+
+	h.respondWithSuccess(c, http.StatusAccepted, archive)
+}
+
+// @Summary Get a file archive
+// @Description Get the status of a zip requested with POST /conversations/{id}/files/archive
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param archive_id path string true "Archive ID"
+// @Success 200 {object} models.FileArchive
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/files/archive/{archive_id} [get]
+func (h *Handler) GetFileArchive(c *gin.Context) {
+	archive, ok := h.requestedArchive(c)
+	if !ok {
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, archive)
+}
+
+// @Summary Download a file archive
+// @Description Download a zip once its status is ready
+// @Tags conversations
+// @Produce application/zip
+// @Param id path string true "Conversation ID"
+// @Param archive_id path string true "Archive ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/files/archive/{archive_id}/download [get]
+func (h *Handler) DownloadFileArchive(c *gin.Context) {
+	archive, ok := h.requestedArchive(c)
+	if !ok {
+		return
+	}
+	if archive.Status != models.ArchiveReady {
+		h.respondWithError(c, http.StatusConflict, "Archive is not ready")
+		return
+	}
+
+	archivePath := h.archivePath(archive.ID)
+	if _, err := os.Stat(archivePath); err != nil {
+		h.respondWithError(c, http.StatusNotFound, "Archive not found")
+		return
+	}
+	// Large archives can take longer to send than the server's write timeout allows
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	fileName := fmt.Sprintf("files-%s.zip", archive.ConversationID)
+
+	// Archives built before encryption at rest are stored as plain zips
+	if archive.DataKey == nil {
+		c.FileAttachment(archivePath, fileName)
+		return
+	}
+
+	dataKey, err := h.encryptor.UnwrapDataKey(*archive.DataKey, *archive.KeyID)
+	if err != nil {
+		logger.Error("Failed to unwrap archive key", err, map[string]interface{}{
+			"archive_id": archive.ID,
+			"key_id":     *archive.KeyID,
+		})
+		h.respondWithError(c, http.StatusGone, "Archive can no longer be decrypted. Request a new one.")
+		return
+	}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		h.respondWithError(c, http.StatusNotFound, "Archive not found")
+		return
+	}
+	defer file.Close()
+	reader, err := encryption.NewBlobReader(file, dataKey)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to read archive")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.DataFromReader(http.StatusOK, archive.SizeBytes, "application/zip", reader, nil)
+	if err := c.Errors.Last(); err != nil {
+		// Headers are sent by now, so the client only sees the download cut short
+		logger.Error("Failed to send file archive", err.Err, map[string]interface{}{
+			"archive_id": archive.ID,
+		})
+	}
+}
+
+// fileAccess parses the conversation and user of a files request and checks the user
+// takes part in the conversation. It responds itself when ok is false.
+func (h *Handler) fileAccess(c *gin.Context) (conversationID, userID uuid.UUID, ok bool) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, err = uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	isParticipant, err := conversationService.IsParticipant(conversationID, userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !isParticipant {
+		h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return conversationID, userID, true
+}
+
+// requestedArchive loads the archive named in the path. Archives hold what their
+// requester could see, so nobody else gets them.
+func (h *Handler) requestedArchive(c *gin.Context) (*models.FileArchive, bool) {
+	conversationID, userID, ok := h.fileAccess(c)
+	if !ok {
+		return nil, false
+	}
+
+	archiveID, err := uuid.Parse(c.Param("archive_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid archive ID")
+		return nil, false
+	}
+
+	archiveService := models.NewFileArchiveService(h.db)
+	archive, err := archiveService.Get(conversationID, archiveID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Archive not found")
+			return nil, false
+		}
+		logger.Error("Failed to get file archive", err, map[string]interface{}{
+			"archive_id": archiveID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get file archive")
+		return nil, false
+	}
+	if archive.RequestedBy != userID {
+		h.respondWithError(c, http.StatusNotFound, "Archive not found")
+		return nil, false
+	}
+	return archive, true
+}
+
+func (h *Handler) archivePath(archiveID uuid.UUID) string {
+	return filepath.Join(h.cfg.Media.ArchiveDir, archiveID.String()+".zip")
+}
+
+// buildFileArchive fetches the files of an archive into a zip and records the outcome
+func (h *Handler) buildFileArchive(archive *models.FileArchive) error {
+	archiveService := models.NewFileArchiveService(h.db)
+	fileCount, skipped, size, err := h.writeFileArchive(archive)
+	if err != nil {
+		reason := "Failed to build archive"
+		if errors.Is(err, errArchiveTooLarge) {
+			reason = fmt.Sprintf("Files exceed the %d byte archive limit", h.cfg.Media.ArchiveMaxBytes)
+		}
+		if failErr := archiveService.Fail(archive.ID, reason); failErr != nil {
+			logger.Error("Failed to mark file archive failed", failErr, map[string]interface{}{
+				"archive_id": archive.ID,
+			})
+		}
+		return errors.Wrap(err, "failed to build file archive")
+	}
+
+	logger.Info("Built file archive", map[string]interface{}{
+		"archive_id":      archive.ID,
+		"conversation_id": archive.ConversationID,
+		"files":           fileCount,
+		"skipped":         skipped,
+		"bytes":           size,
+	})
+	archive.FileCount, archive.SkippedCount, archive.SizeBytes = fileCount, skipped, size
+	return archiveService.Complete(archive)
+}
+
+func (h *Handler) writeFileArchive(archive *models.FileArchive) (fileCount, skipped int, size int64, err error) {
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	files, err := messageService.GetConversationFiles(archive.ConversationID, archive.RequestedBy, models.FileSortDate, false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := os.MkdirAll(h.cfg.Media.ArchiveDir, 0700); err != nil {
+		return 0, 0, 0, err
+	}
+	// Build under a temporary name so a half-written zip is never served
+	finalPath := h.archivePath(archive.ID)
+	tmpPath := finalPath + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	// Each archive is encrypted at rest with its own data key
+	dataKey, wrappedKey, err := h.encryptor.NewDataKey()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	sealed, err := encryption.NewBlobWriter(out, dataKey)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	plain := &countingWriter{w: sealed}
+
+	ctx, cancel := context.WithTimeout(context.Background(), archiveBuildTimeout)
+	defer cancel()
+
+	zw := zip.NewWriter(plain)
+	names := make(map[string]int)
+	remaining := h.cfg.Media.ArchiveMaxBytes
+	for _, file := range files {
+		body, err := h.mediaFetcher.Fetch(ctx, file.MediaURL)
+		if err != nil {
+			logger.Warn("Skipping file in archive", map[string]interface{}{
+				"archive_id": archive.ID,
+				"message_id": file.MessageID,
+				"error":      err.Error(),
+			})
+			skipped++
+			continue
+		}
+
+		entry, err := zw.Create(uniqueName(names, file.Name))
+		if err != nil {
+			body.Close()
+			return 0, 0, 0, err
+		}
+		// Read one byte past the budget to tell an exact fit from an overflow
+		n, err := io.Copy(entry, io.LimitReader(body, remaining+1))
+		body.Close()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if n > remaining {
+			return 0, 0, 0, errArchiveTooLarge
+		}
+		remaining -= n
+		fileCount++
+	}
+	if err := zw.Close(); err != nil {
+		return 0, 0, 0, err
+	}
+	if err := sealed.Close(); err != nil {
+		return 0, 0, 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return 0, 0, 0, err
+	}
+	keyID := h.encryptor.KeyID()
+	archive.DataKey, archive.KeyID = &wrappedKey, &keyID
+	return fileCount, skipped, plain.n, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// uniqueName makes a file name safe for a zip entry and distinct from earlier entries
+func uniqueName(seen map[string]int, name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+
+	seen[name]++
+	if seen[name] == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), seen[name], ext)
+}
+
+// PurgeExpiredArchives deletes file archives past their expiry, along with zips left
+// behind by archives that no longer exist
+func (h *Handler) PurgeExpiredArchives() error {
+	archiveService := models.NewFileArchiveService(h.db)
+	ids, err := archiveService.PurgeExpired()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := os.Remove(h.archivePath(id)); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove file archive", map[string]interface{}{
+				"archive_id": id,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	// Archives of purged conversations are deleted with them, leaving their zips behind
+	entries, err := os.ReadDir(h.cfg.Media.ArchiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	cutoff := time.Now().Add(-h.cfg.Media.ArchiveTTL)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(h.cfg.Media.ArchiveDir, entry.Name()))
+	}
+	return nil
+}
@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+const (
+	// graphqlMaxQueryLength bounds the query text of a GraphQL request
+	graphqlMaxQueryLength = 16 << 10
+	// graphqlMaxOperations bounds the operations running at once on a GraphQL WebSocket
+	graphqlMaxOperations = 20
+	// graphqlInitTimeout is how long a GraphQL WebSocket may take to send connection_init
+	graphqlInitTimeout = 10 * time.Second
+	// graphqlBatchWait and graphqlBatchSize are how long resolvers' lookups are collected
+	// to be fetched together, and at most how many at once
+	graphqlBatchWait = 2 * time.Millisecond
+	graphqlBatchSize = 100
+)
+
+// graphqlSubprotocol is the graphql-ws library's protocol, which GraphQL WebSockets speak
+const graphqlSubprotocol = "graphql-transport-ws"
+
+// Messages of the graphql-transport-ws protocol
+const (
+	graphqlConnectionInit = "connection_init"
+	graphqlConnectionAck  = "connection_ack"
+	graphqlPing           = "ping"
+	graphqlPong           = "pong"
+	graphqlSubscribe      = "subscribe"
+	graphqlNext           = "next"
+	graphqlError          = "error"
+	graphqlComplete       = "complete"
+)
+
+// Close codes of the graphql-transport-ws protocol
+var (
+	closeGraphQLInvalidMessage = &CloseReason{Code: 4400, Reason: "invalid_message"}
+	closeGraphQLUnauthorized   = &CloseReason{Code: 4401, Reason: "unauthorized"}
+	closeGraphQLInitTimeout    = &CloseReason{Code: 4408, Reason: "connection_initialisation_timeout", Reconnect: true}
+	closeGraphQLDuplicateID    = &CloseReason{Code: 4409, Reason: "subscriber_already_exists"}
+	closeGraphQLTooManyInits   = &CloseReason{Code: 4429, Reason: "too_many_initialisation_requests"}
+)
+
+var graphqlUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{graphqlSubprotocol},
+	CheckOrigin:     upgrader.CheckOrigin,
+}
+
+// graphqlSchema is served at /api/graphql over the same models as the REST API. Users
+// are shown as other users see them, and only conversations the user takes part in
+// and messages they may read are found.
+const graphqlSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	# The authenticated user
+	me: User!
+	# An active user, or null
+	user(id: ID!): User
+	# The user's conversations, most recently updated first unless sort says otherwise:
+	# updated_at, last_message_at, unread_first, alphabetical or manual
+	conversations(first: Int = 20, offset: Int = 0, sort: String = "updated_at"): [Conversation!]!
+	# A conversation the user takes part in, or null
+	conversation(id: ID!): Conversation
+	# A message the user may read, or null
+	message(id: ID!): Message
+}
+
+type Subscription {
+	# The events the user's WebSocket connections get, optionally only those of some
+	# types or of one conversation. Served over the WebSocket at /api/graphql/ws.
+	events(types: [String!], conversationId: ID): Event!
+}
+
+type User {
+	id: ID!
+	username: String!
+	status: String!
+	isOnline: Boolean!
+	lastSeen: Time
+	createdAt: Time!
+}
+
+type Conversation {
+	id: ID!
+	# direct or group
+	type: String!
+	# Groups without a name of their own are named after some of their participants
+	name: String
+	avatarUrl: String
+	createdAt: Time!
+	updatedAt: Time!
+	unreadCount: Int!
+	participantCount: Int!
+	lockedUntil: Time
+	# The first participants, owners and admins first
+	participants: [Participant!]!
+	lastMessage: Message
+	# The messages the user may read, oldest first
+	messages(first: Int = 50, offset: Int = 0): [Message!]!
+}
+
+type Participant {
+	user: User!
+	role: String!
+	nickname: String
+	joinedAt: Time!
+}
+
+type Message {
+	id: ID!
+	conversationId: ID!
+	# Null once the sender's account is deactivated; senderUsername remains
+	sender: User
+	senderUsername: String!
+	content: String!
+	type: String!
+	mediaUrl: String
+	mediaThumbnailUrl: String
+	createdAt: Time!
+	updatedAt: Time!
+	isEdited: Boolean!
+	isDeleted: Boolean!
+	viewOnce: Boolean!
+	# IDs of the participants who read the message
+	readBy: [ID!]!
+	# The message replied to, unless the user can't read it
+	replyTo: Message
+}
+
+type Event {
+	# The event's ID in the event log, which /api/ws takes as last_event_id; null for
+	# events that aren't logged
+	id: String
+	# The event type, as on /api/ws: new_message, message.updated, typing_start and so on
+	type: String!
+	conversationId: ID
+	# The message of new_message and message.updated events
+	message: Message
+	# The event's payload as JSON
+	payload: String!
+}
+`
+
+// GraphQLRequest is a GraphQL operation sent over HTTP
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// newGraphQLSchema parses the schema against its resolvers, failing at startup when
+// they don't match
+func (h *Handler) newGraphQLSchema() *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &graphqlResolver{h: h},
+		graphql.UseFieldResolvers(),
+		graphql.MaxDepth(h.cfg.GraphQL.MaxDepth),
+		graphql.MaxParallelism(h.cfg.GraphQL.MaxParallelism),
+		graphql.MaxQueryLength(graphqlMaxQueryLength),
+	)
+}
+
+// RegisterGraphQLRoutes registers the GraphQL endpoint and its WebSocket
+func (h *Handler) RegisterGraphQLRoutes(r *gin.RouterGroup) {
+	// The WebSocket authenticates its token itself, like /api/ws
+	r.GET("/ws", h.GraphQLWebSocket)
+	r.POST("", h.AuthMiddleware(), h.GraphQL)
+}
+
+// @Summary Run a GraphQL query
+// @Description Run a query against the GraphQL schema over users, conversations and messages, selecting just the fields needed, nested as deep as graphql.max_depth allows. Lookups of senders and replied messages are batched. Subscriptions are served over the WebSocket at /graphql/ws. Only served when graphql.enabled is set.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body GraphQLRequest true "GraphQL operation"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /graphql [post]
+func (h *Handler) GraphQL(c *gin.Context) {
+	var req GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	ctx := withGraphQLRequest(c.Request.Context(), h.newGraphQLRequest(c, userID, nil))
+	c.JSON(http.StatusOK, h.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// GraphQLWebSocket godoc
+// @Summary GraphQL WebSocket
+// @Description Runs GraphQL operations, subscriptions among them, over the graphql-transport-ws protocol of the graphql-ws library. The events subscription gets the events /ws does. Only served when graphql.enabled is set.
+// @Tags graphql
+// @Param token query string true "Authentication token"
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /graphql/ws [get]
+func (h *Handler) GraphQLWebSocket(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		h.respondWithError(c, http.StatusUnauthorized, "Missing token")
+		return
+	}
+	identity, ok := h.authenticateWebSocket(c, token)
+	if !ok {
+		return
+	}
+
+	conn, err := graphqlUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+	socket := &graphqlSocket{
+		h:          h,
+		c:          c,
+		conn:       conn,
+		identity:   identity,
+		operations: make(map[string]context.CancelFunc),
+		streams:    make(map[chan []byte]bool),
+	}
+	// The request's context stays usable as long as the socket is served
+	socket.serve()
+}
+
+// graphqlSocket is a GraphQL WebSocket. Its subscriptions share one hub client, whose
+// events it hands each of them.
+type graphqlSocket struct {
+	h        *Handler
+	c        *gin.Context
+	conn     *websocket.Conn
+	identity *resumeClaims
+	client   *Client
+	writeMu  sync.Mutex
+
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+	streams    map[chan []byte]bool
+}
+
+// graphqlMessage is a message of the graphql-transport-ws protocol
+type graphqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// serve reads the socket's messages until it closes, running the operations it is sent
+func (s *graphqlSocket) serve() {
+	ctx, cancel := context.WithCancel(s.c.Request.Context())
+	defer func() {
+		cancel()
+		s.conn.Close()
+	}()
+
+	s.conn.SetReadDeadline(time.Now().Add(graphqlInitTimeout))
+	var init graphqlMessage
+	if err := s.conn.ReadJSON(&init); err != nil {
+		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			s.closeWith(closeGraphQLInitTimeout)
+		}
+		return
+	}
+	switch init.Type {
+	case graphqlConnectionInit:
+	case graphqlSubscribe:
+		s.closeWith(closeGraphQLUnauthorized)
+		return
+	default:
+		s.closeWith(closeGraphQLInvalidMessage)
+		return
+	}
+
+	s.client = &Client{
+		hub:         s.h.hub,
+		send:        make(chan []byte, clientSendBuffer),
+		userID:      s.identity.UserID.String(),
+		sessionID:   s.identity.SessionID,
+		clientID:    s.identity.ClientID,
+		id:          uuid.New(),
+		ip:          s.c.ClientIP(),
+		connectedAt: time.Now(),
+	}
+	select {
+	case s.h.hub.register <- s.client:
+	case <-s.h.hub.quit:
+		s.closeWith(closeServerDraining)
+		return
+	}
+	defer func() {
+		select {
+		case s.h.hub.unregister <- s.client:
+		case <-s.h.hub.quit:
+		}
+	}()
+	go s.forwardEvents(ctx)
+	go s.keepAlive(ctx)
+
+	if err := s.write(graphqlMessage{Type: graphqlConnectionAck}); err != nil {
+		return
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	for {
+		var message graphqlMessage
+		if err := s.conn.ReadJSON(&message); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				s.closeWith(closeGraphQLInvalidMessage)
+			}
+			return
+		}
+		s.h.hub.received.add(1)
+
+		switch message.Type {
+		case graphqlPing:
+			s.write(graphqlMessage{Type: graphqlPong})
+		case graphqlPong:
+		case graphqlSubscribe:
+			if !s.start(ctx, message) {
+				return
+			}
+		case graphqlComplete:
+			s.stop(message.ID)
+		case graphqlConnectionInit:
+			s.closeWith(closeGraphQLTooManyInits)
+			return
+		default:
+			s.closeWith(closeGraphQLInvalidMessage)
+			return
+		}
+	}
+}
+
+// start runs an operation, returning false when the socket is closed over it
+func (s *graphqlSocket) start(ctx context.Context, message graphqlMessage) bool {
+	var payload GraphQLRequest
+	if message.ID == "" || json.Unmarshal(message.Payload, &payload) != nil {
+		s.closeWith(closeGraphQLInvalidMessage)
+		return false
+	}
+
+	s.mu.Lock()
+	if _, ok := s.operations[message.ID]; ok {
+		s.mu.Unlock()
+		s.closeWith(closeGraphQLDuplicateID)
+		return false
+	}
+	if len(s.operations) >= graphqlMaxOperations {
+		s.mu.Unlock()
+		s.sendErrors(message.ID, "Too many operations are running on this connection")
+		return true
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.operations[message.ID] = cancel
+	s.mu.Unlock()
+
+	go s.run(ctx, message.ID, payload)
+	return true
+}
+
+// run sends the results of an operation until it ends or the client completes it
+func (s *graphqlSocket) run(ctx context.Context, id string, payload GraphQLRequest) {
+	defer s.stop(id)
+
+	ctx = withGraphQLRequest(ctx, s.h.newGraphQLRequest(s.c, s.identity.UserID, s))
+	responses, err := s.h.graphql.Subscribe(ctx, payload.Query, payload.OperationName, payload.Variables)
+	if err != nil {
+		s.sendErrors(id, err.Error())
+		return
+	}
+	for response := range responses {
+		result, ok := response.(*graphql.Response)
+		if !ok {
+			continue
+		}
+		// Operations that couldn't run at all get an error instead of results
+		if result.Data == nil && len(result.Errors) > 0 {
+			errorsJSON, _ := json.Marshal(result.Errors)
+			s.write(graphqlMessage{ID: id, Type: graphqlError, Payload: errorsJSON})
+			return
+		}
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			continue
+		}
+		if s.write(graphqlMessage{ID: id, Type: graphqlNext, Payload: resultJSON}) != nil {
+			return
+		}
+	}
+	if ctx.Err() == nil {
+		s.write(graphqlMessage{ID: id, Type: graphqlComplete})
+	}
+}
+
+// stop cancels an operation, which the client completed or which ended
+func (s *graphqlSocket) stop(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.operations[id]; ok {
+		cancel()
+		delete(s.operations, id)
+	}
+}
+
+// subscribe returns a stream of the events the socket gets, until unsubscribe
+func (s *graphqlSocket) subscribe() chan []byte {
+	stream := make(chan []byte, clientSendBuffer)
+	s.mu.Lock()
+	s.streams[stream] = true
+	s.mu.Unlock()
+	return stream
+}
+
+func (s *graphqlSocket) unsubscribe(stream chan []byte) {
+	s.mu.Lock()
+	delete(s.streams, stream)
+	s.mu.Unlock()
+}
+
+// forwardEvents hands the events the hub sends the socket to its subscriptions. When the
+// hub closes it, or a subscription can't keep up, the socket is closed as /ws would be.
+func (s *graphqlSocket) forwardEvents(ctx context.Context) {
+	for {
+		select {
+		case event, ok := <-s.client.send:
+			if !ok {
+				s.closeWith(s.client.closeReason)
+				s.conn.Close()
+				return
+			}
+			s.mu.Lock()
+			slow := false
+			for stream := range s.streams {
+				select {
+				case stream <- event:
+				default:
+					slow = true
+				}
+			}
+			s.mu.Unlock()
+			if slow {
+				s.h.hub.dropped.Add(1)
+				s.closeWith(closeTooSlow)
+				s.conn.Close()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// keepAlive pings the client like the write pump of /ws does
+func (s *graphqlSocket) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.writeMu.Lock()
+			s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write sends a protocol message; the socket's operations write concurrently
+func (s *graphqlSocket) write(message graphqlMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	s.h.hub.sent.add(1)
+	return nil
+}
+
+// sendErrors ends an operation with an error message
+func (s *graphqlSocket) sendErrors(id, message string) {
+	payload, _ := json.Marshal([]map[string]string{{"message": message}})
+	s.write(graphqlMessage{ID: id, Type: graphqlError, Payload: payload})
+}
+
+// closeWith sends a close frame with reason, or a normal one when reason is nil
+func (s *graphqlSocket) closeWith(reason *CloseReason) {
+	if err := s.conn.WriteControl(websocket.CloseMessage, closeMessage(reason), time.Now().Add(writeWait)); err != nil {
+		logger.Debug("Failed to close GraphQL WebSocket", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
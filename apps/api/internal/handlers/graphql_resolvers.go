@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/dataloader"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/pkg/errors"
+)
+
+// graphqlRequestKey holds the graphqlRequest of an operation in its context
+type graphqlRequestKey struct{}
+
+// graphqlRequest is what resolvers of one operation share: who is asking, and loaders
+// batching their lookups. Each event of a subscription gets a request of its own, so
+// that what the loaders remember doesn't go stale.
+type graphqlRequest struct {
+	h        *Handler
+	c        *gin.Context
+	viewerID uuid.UUID
+	// socket is the WebSocket the operation runs on; nil over HTTP
+	socket *graphqlSocket
+
+	users    *dataloader.Loader[uuid.UUID, *models.User]
+	messages *dataloader.Loader[uuid.UUID, *models.Message]
+}
+
+func (h *Handler) newGraphQLRequest(c *gin.Context, viewerID uuid.UUID, socket *graphqlSocket) *graphqlRequest {
+	userService := models.NewUserService(h.db, h.encryptor)
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	return &graphqlRequest{
+		h:        h,
+		c:        c,
+		viewerID: viewerID,
+		socket:   socket,
+		users: dataloader.New(func(ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+			users, err := userService.GetByIDs(ids)
+			if err != nil {
+				return nil, err
+			}
+			found := make(map[uuid.UUID]*models.User, len(users))
+			for i := range users {
+				found[users[i].ID] = &users[i]
+			}
+			return found, nil
+		}, graphqlBatchWait, graphqlBatchSize),
+		messages: dataloader.New(func(ids []uuid.UUID) (map[uuid.UUID]*models.Message, error) {
+			messages, err := messageService.GetByIDsForUser(ids, viewerID)
+			if err != nil {
+				return nil, err
+			}
+			found := make(map[uuid.UUID]*models.Message, len(messages))
+			for i := range messages {
+				found[messages[i].ID] = &messages[i]
+			}
+			return found, nil
+		}, graphqlBatchWait, graphqlBatchSize),
+	}
+}
+
+func withGraphQLRequest(ctx context.Context, req *graphqlRequest) context.Context {
+	return context.WithValue(ctx, graphqlRequestKey{}, req)
+}
+
+func graphqlRequestFrom(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlRequestKey{}).(*graphqlRequest)
+}
+
+// graphqlFailure logs an error and returns one that tells the client no more than what
+// failed
+func graphqlFailure(message string, err error) error {
+	logger.Error(message, err, nil)
+	return errors.New(message)
+}
+
+// parseGraphQLID parses a UUID argument; IDs that aren't UUIDs find nothing
+func parseGraphQLID(id graphql.ID) (uuid.UUID, bool) {
+	parsed, err := uuid.Parse(string(id))
+	return parsed, err == nil
+}
+
+func graphqlTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+// user returns an active user, or nil
+func (req *graphqlRequest) user(ctx context.Context, id uuid.UUID) (*userResolver, error) {
+	user, found, err := req.users.Load(ctx, id)
+	if err != nil {
+		return nil, graphqlFailure("Failed to get user", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &userResolver{user: user.Public()}, nil
+}
+
+// message returns a message the viewer may read, or nil
+func (req *graphqlRequest) message(ctx context.Context, id uuid.UUID) (*messageResolver, error) {
+	message, found, err := req.messages.Load(ctx, id)
+	if err != nil {
+		return nil, graphqlFailure("Failed to get message", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &messageResolver{req: req, message: message}, nil
+}
+
+// graphqlResolver resolves the fields of Query and Subscription
+type graphqlResolver struct {
+	h *Handler
+}
+
+func (r *graphqlResolver) Me(ctx context.Context) (*userResolver, error) {
+	req := graphqlRequestFrom(ctx)
+	user, err := req.user(ctx, req.viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("User not found")
+	}
+	return user, nil
+}
+
+func (r *graphqlResolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	id, ok := parseGraphQLID(args.ID)
+	if !ok {
+		return nil, nil
+	}
+	return graphqlRequestFrom(ctx).user(ctx, id)
+}
+
+func (r *graphqlResolver) Conversations(ctx context.Context, args struct {
+	First  int32
+	Offset int32
+	Sort   string
+}) ([]*conversationResolver, error) {
+	req := graphqlRequestFrom(ctx)
+	if args.First < 1 || int(args.First) > r.h.cfg.Pagination.MaxLimit {
+		return nil, fmt.Errorf("Invalid first. Must be between 1 and %d", r.h.cfg.Pagination.MaxLimit)
+	}
+	if args.Offset < 0 {
+		return nil, errors.New("Invalid offset")
+	}
+
+	conversationService := models.NewConversationService(r.h.db, r.h.encryptor)
+	conversations, _, err := conversationService.GetUserConversations(req.viewerID, models.AllConversationDetails, args.Sort, int(args.First), int(args.Offset))
+	if errors.Is(err, models.ErrInvalidInput) {
+		return nil, errors.New("Invalid sort")
+	}
+	if err != nil {
+		return nil, graphqlFailure("Failed to get conversations", err)
+	}
+	r.h.nameGroups(req.c, req.viewerID, conversations)
+
+	resolvers := make([]*conversationResolver, len(conversations))
+	for i := range conversations {
+		resolvers[i] = newConversationResolver(req, &conversations[i])
+	}
+	return resolvers, nil
+}
+
+func (r *graphqlResolver) Conversation(ctx context.Context, args struct{ ID graphql.ID }) (*conversationResolver, error) {
+	req := graphqlRequestFrom(ctx)
+	id, ok := parseGraphQLID(args.ID)
+	if !ok {
+		return nil, nil
+	}
+
+	conversationService := models.NewConversationService(r.h.db, r.h.encryptor)
+	conversation, err := conversationService.GetByID(id)
+	if errors.Is(err, models.ErrConversationNotFound) || errors.Is(err, models.ErrInvalidParticipant) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlFailure("Failed to get conversation", err)
+	}
+	// The viewer's counters double as the check that they take part; only the first
+	// page of participants is embedded, so they may not be among them
+	counters, err := conversationService.GetConversationUnreadCounters(id, req.viewerID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlFailure("Failed to get conversation", err)
+	}
+	conversation.UnreadCount = counters.UnreadCount
+	r.h.nameGroup(req.c, req.viewerID, conversation)
+	return newConversationResolver(req, conversation), nil
+}
+
+func (r *graphqlResolver) Message(ctx context.Context, args struct{ ID graphql.ID }) (*messageResolver, error) {
+	id, ok := parseGraphQLID(args.ID)
+	if !ok {
+		return nil, nil
+	}
+	return graphqlRequestFrom(ctx).message(ctx, id)
+}
+
+func (r *graphqlResolver) Events(ctx context.Context, args struct {
+	Types          *[]string
+	ConversationID *graphql.ID
+}) (<-chan *eventResolver, error) {
+	req := graphqlRequestFrom(ctx)
+	if req.socket == nil {
+		return nil, errors.New("Subscriptions are served over the WebSocket at /api/graphql/ws")
+	}
+	var types map[string]bool
+	if args.Types != nil {
+		types = make(map[string]bool, len(*args.Types))
+		for _, eventType := range *args.Types {
+			types[eventType] = true
+		}
+	}
+	var conversationID string
+	if args.ConversationID != nil {
+		id, ok := parseGraphQLID(*args.ConversationID)
+		if !ok {
+			return nil, errors.New("Invalid conversationId")
+		}
+		conversationID = id.String()
+	}
+
+	stream := req.socket.subscribe()
+	events := make(chan *eventResolver)
+	go func() {
+		defer close(events)
+		defer req.socket.unsubscribe(stream)
+		for {
+			select {
+			case frame := <-stream:
+				event, ok := decodeGraphQLEvent(frame)
+				if !ok || (types != nil && !types[event.eventType]) {
+					continue
+				}
+				if conversationID != "" && event.conversationID != conversationID {
+					continue
+				}
+				event.req = r.h.newGraphQLRequest(req.c, req.viewerID, req.socket)
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// userResolver shows a user as other users see them
+type userResolver struct {
+	user *models.PublicUser
+}
+
+func (r *userResolver) ID() graphql.ID          { return graphql.ID(r.user.ID.String()) }
+func (r *userResolver) Username() string        { return r.user.Username }
+func (r *userResolver) Status() string          { return r.user.Status }
+func (r *userResolver) IsOnline() bool          { return r.user.IsOnline }
+func (r *userResolver) LastSeen() *graphql.Time { return graphqlTime(r.user.LastSeen) }
+func (r *userResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.user.CreatedAt} }
+
+type conversationResolver struct {
+	req          *graphqlRequest
+	conversation *models.Conversation
+}
+
+// newConversationResolver wraps a conversation, remembering its last message for
+// replies to it
+func newConversationResolver(req *graphqlRequest, conversation *models.Conversation) *conversationResolver {
+	if last := conversation.LastMessage; last != nil && !last.IsDeleted {
+		req.messages.Prime(last.ID, last)
+	}
+	return &conversationResolver{req: req, conversation: conversation}
+}
+
+func (r *conversationResolver) ID() graphql.ID {
+	return graphql.ID(r.conversation.ID.String())
+}
+func (r *conversationResolver) Type() string       { return r.conversation.Type }
+func (r *conversationResolver) Name() *string      { return r.conversation.Name }
+func (r *conversationResolver) AvatarURL() *string { return r.conversation.AvatarURL }
+func (r *conversationResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.conversation.CreatedAt}
+}
+func (r *conversationResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.conversation.UpdatedAt}
+}
+func (r *conversationResolver) UnreadCount() int32 { return int32(r.conversation.UnreadCount) }
+func (r *conversationResolver) ParticipantCount() int32 {
+	return int32(r.conversation.ParticipantCount)
+}
+func (r *conversationResolver) LockedUntil() *graphql.Time {
+	return graphqlTime(r.conversation.LockedUntil)
+}
+
+func (r *conversationResolver) Participants() []*participantResolver {
+	participants := make([]*participantResolver, len(r.conversation.Participants))
+	for i := range r.conversation.Participants {
+		participants[i] = &participantResolver{participant: &r.conversation.Participants[i]}
+	}
+	return participants
+}
+
+func (r *conversationResolver) LastMessage() *messageResolver {
+	if r.conversation.LastMessage == nil {
+		return nil
+	}
+	return &messageResolver{req: r.req, message: r.conversation.LastMessage}
+}
+
+func (r *conversationResolver) Messages(ctx context.Context, args struct {
+	First  int32
+	Offset int32
+}) ([]*messageResolver, error) {
+	if args.First < 1 || args.First > 100 {
+		return nil, errors.New("Invalid first. Must be between 1 and 100")
+	}
+	if args.Offset < 0 {
+		return nil, errors.New("Invalid offset")
+	}
+
+	messageService := models.NewMessageService(r.req.h.db, r.req.h.encryptor)
+	messages, err := messageService.GetConversationMessages(r.conversation.ID, r.req.viewerID, int(args.First), int(args.Offset))
+	if err != nil {
+		return nil, graphqlFailure("Failed to get messages", err)
+	}
+	resolvers := make([]*messageResolver, len(messages))
+	for i := range messages {
+		if !messages[i].IsDeleted {
+			r.req.messages.Prime(messages[i].ID, &messages[i])
+		}
+		resolvers[i] = &messageResolver{req: r.req, message: &messages[i]}
+	}
+	return resolvers, nil
+}
+
+// participantResolver resolves a participant from the user fields loaded along with it
+type participantResolver struct {
+	participant *models.ConversationParticipant
+}
+
+func (r *participantResolver) User() *userResolver {
+	p := r.participant
+	return &userResolver{user: &models.PublicUser{
+		ID:        p.UserID,
+		Username:  p.UserUsername,
+		Status:    p.UserStatus,
+		LastSeen:  p.UserLastSeen,
+		IsOnline:  p.UserIsOnline,
+		CreatedAt: p.UserCreatedAt,
+	}}
+}
+
+func (r *participantResolver) Role() string      { return r.participant.Role }
+func (r *participantResolver) Nickname() *string { return r.participant.Nickname }
+func (r *participantResolver) JoinedAt() graphql.Time {
+	return graphql.Time{Time: r.participant.JoinedAt}
+}
+
+type messageResolver struct {
+	req     *graphqlRequest
+	message *models.Message
+}
+
+func (r *messageResolver) ID() graphql.ID { return graphql.ID(r.message.ID.String()) }
+func (r *messageResolver) ConversationID() graphql.ID {
+	return graphql.ID(r.message.ConversationID.String())
+}
+
+func (r *messageResolver) Sender(ctx context.Context) (*userResolver, error) {
+	return r.req.user(ctx, r.message.SenderID)
+}
+
+func (r *messageResolver) SenderUsername() string     { return r.message.SenderUsername }
+func (r *messageResolver) Content() string            { return r.message.Content }
+func (r *messageResolver) Type() string               { return r.message.MessageType }
+func (r *messageResolver) MediaURL() *string          { return r.message.MediaURL }
+func (r *messageResolver) MediaThumbnailURL() *string { return r.message.MediaThumbnailURL }
+func (r *messageResolver) CreatedAt() graphql.Time    { return graphql.Time{Time: r.message.CreatedAt} }
+func (r *messageResolver) UpdatedAt() graphql.Time    { return graphql.Time{Time: r.message.UpdatedAt} }
+func (r *messageResolver) IsEdited() bool             { return r.message.IsEdited }
+func (r *messageResolver) IsDeleted() bool            { return r.message.IsDeleted }
+func (r *messageResolver) ViewOnce() bool             { return r.message.ViewOnce }
+
+func (r *messageResolver) ReadBy() []graphql.ID {
+	readBy := make([]graphql.ID, len(r.message.ReadBy))
+	for i, id := range r.message.ReadBy {
+		readBy[i] = graphql.ID(id)
+	}
+	return readBy
+}
+
+func (r *messageResolver) ReplyTo(ctx context.Context) (*messageResolver, error) {
+	if r.message.ReplyToID == nil {
+		return nil, nil
+	}
+	return r.req.message(ctx, *r.message.ReplyToID)
+}
+
+// eventResolver is an event sent to the user's connections
+type eventResolver struct {
+	req            *graphqlRequest
+	id             uint64
+	eventType      string
+	conversationID string
+	messageID      uuid.UUID
+	payload        json.RawMessage
+}
+
+// decodeGraphQLEvent reads an event the hub sent, as /api/ws would get it
+func decodeGraphQLEvent(frame []byte) (*eventResolver, bool) {
+	var event struct {
+		ID      uint64          `json:"id"`
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(frame, &event); err != nil {
+		return nil, false
+	}
+	var subject struct {
+		ID             string `json:"id"`
+		ConversationID string `json:"conversation_id"`
+	}
+	// Payloads that aren't objects name no conversation
+	_ = json.Unmarshal(event.Payload, &subject)
+
+	decoded := &eventResolver{
+		id:             event.ID,
+		eventType:      event.Type,
+		conversationID: subject.ConversationID,
+		payload:        event.Payload,
+	}
+	if event.Type == EventNewMessage || event.Type == EventMessageUpdated {
+		decoded.messageID, _ = uuid.Parse(subject.ID)
+	}
+	return decoded, true
+}
+
+func (r *eventResolver) ID() *string {
+	if r.id == 0 {
+		return nil
+	}
+	id := fmt.Sprint(r.id)
+	return &id
+}
+
+func (r *eventResolver) Type() string { return r.eventType }
+
+func (r *eventResolver) ConversationID() *graphql.ID {
+	if r.conversationID == "" {
+		return nil
+	}
+	id := graphql.ID(r.conversationID)
+	return &id
+}
+
+// Message is looked up again rather than taken from the payload, so that it is shown
+// as the viewer may see it
+func (r *eventResolver) Message(ctx context.Context) (*messageResolver, error) {
+	if r.messageID == uuid.Nil {
+		return nil, nil
+	}
+	return r.req.message(ctx, r.messageID)
+}
+
+func (r *eventResolver) Payload() string {
+	if r.payload == nil {
+		return "null"
+	}
+	return string(r.payload)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// groupNamingKey holds the groupNaming of a request once a group was named in it
+const groupNamingKey = "groupNaming"
+
+// groupNaming is how groups are named for a request: in which language, masking which
+// terms
+type groupNaming struct {
+	locale string
+	mask   func(string) string
+}
+
+// nameGroups names the groups among conversations without a name of their own, as
+// viewerID sees them
+func (h *Handler) nameGroups(c *gin.Context, viewerID uuid.UUID, conversations []models.Conversation) {
+	for i := range conversations {
+		h.nameGroup(c, viewerID, &conversations[i])
+	}
+}
+
+// nameGroup names a group without a name of its own after its participants other than
+// viewerID, in the language the client asks for with Accept-Language
+func (h *Handler) nameGroup(c *gin.Context, viewerID uuid.UUID, conversation *models.Conversation) {
+	if !conversation.Unnamed() {
+		return
+	}
+	name := h.generateGroupName(c, viewerID, conversation.NameSample, conversation.ParticipantCount)
+	conversation.Name = &name
+	conversation.NameGenerated = true
+}
+
+// nameInboxGroups names the groups of an inbox without a name of their own
+func (h *Handler) nameInboxGroups(c *gin.Context, viewerID uuid.UUID, inbox []models.InboxConversation) {
+	for i := range inbox {
+		conversation := &inbox[i]
+		if !conversation.Unnamed() {
+			continue
+		}
+		name := h.generateGroupName(c, viewerID, conversation.NameSample, conversation.ParticipantCount)
+		conversation.Name = &name
+		conversation.NameGenerated = true
+	}
+}
+
+// generateGroupName names a group of count participants from its sample, for a request
+func (h *Handler) generateGroupName(c *gin.Context, viewerID uuid.UUID, sample models.GroupNameSample, count int) string {
+	naming, ok := c.Value(groupNamingKey).(*groupNaming)
+	if !ok {
+		locale := h.groupNames.Locale(c.GetHeader("Accept-Language"))
+		naming = &groupNaming{locale: locale, mask: h.profanityMask(locale)}
+		c.Set(groupNamingKey, naming)
+	}
+	return h.groupNames.Name(sample, count, viewerID, naming.locale, naming.mask)
+}
+
+// groupName names a group for text the server writes, such as notifications, in the
+// default language. With uuid.Nil for viewerID no participant is left out.
+func (h *Handler) groupName(viewerID uuid.UUID, source *models.GroupNameSource) string {
+	locale := h.groupNames.Locale("")
+	return h.groupNames.Name(source.Sample, source.ParticipantCount, viewerID, locale, h.profanityMask(locale))
+}
+
+// profanityMask returns a function masking the terms of a locale's wordlists, those
+// deployed and those added by admins, whatever the conversations' filter modes. It
+// keeps usernames from putting profanity in the names the server makes up.
+func (h *Handler) profanityMask(locale string) func(string) string {
+	terms := h.contentFilter.Terms(locale)
+	custom, err := models.NewContentFilterService(h.db).Terms(locale)
+	if err != nil {
+		logger.Error("Failed to get content filter terms", err, map[string]interface{}{
+			"locale": locale,
+		})
+	}
+	terms = append(append([]string{}, terms...), custom...)
+	return func(name string) string {
+		masked, _, _ := contentfilter.Apply(name, contentfilter.ModeMask, locale, terms)
+		return masked
+	}
+}
@@ -4,35 +4,169 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/compliance"
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/delivery"
 	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/eventlog"
+	"talkify/apps/api/internal/federation"
+	"talkify/apps/api/internal/fieldset"
+	"talkify/apps/api/internal/groupname"
+	"talkify/apps/api/internal/invite"
+	"talkify/apps/api/internal/mail"
+	"talkify/apps/api/internal/media"
+	"talkify/apps/api/internal/metrics"
 	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/password"
+	"talkify/apps/api/internal/presence"
+	"talkify/apps/api/internal/sms"
+	"talkify/apps/api/internal/transcript"
+	"talkify/apps/api/internal/webhook"
 	"talkify/apps/api/internal/worker"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 type Handler struct {
+	cfg          *config.Config
+	live         *config.Live
 	db           *sqlx.DB
-	encryptor    *encryption.Manager
+	encryptor    encryption.Encryptor
 	workerPool   *worker.Pool
 	tokenManager *auth.TokenManager
 	hub          *Hub
+	metrics      *metrics.Recorder
+	events       *eventlog.Log
+	deliveries   *delivery.Tracker
+	presence     *presence.Tracker
+	mediaFetcher *media.Fetcher
+	mediaSigner  *media.Signer
+	inviteSigner *invite.Signer
+	webhooks     *webhook.Client
+	federation   *federation.Client
+	// federationSigner is nil unless federation is enabled
+	federationSigner *federation.Signer
+	// contentFilter holds the wordlists deployed with the server; nil has none
+	contentFilter *contentfilter.Filter
+	// groupNames names groups without a name of their own
+	groupNames *groupname.Namer
+	// complianceSealer is nil unless compliance recorders are configured
+	complianceSealer *compliance.Sealer
+	// streamsClosed is closed once compliance streams have to end
+	streamsClosed chan struct{}
+	closeStreams  sync.Once
+	mailer        *mail.Mailer
+	texter        *sms.Sender
+	passwords     *password.Checker
+	routes        func() gin.RoutesInfo
+	startedAt     time.Time
+	status        statusCache
+	clients       clientCache
+	signupChecks  signupCheckCounter
+	typing        typingThrottle
+	embedRequests embedRequestCounter
+	transcripts   transcript.Renderer
+	// graphql is nil unless GraphQL is enabled
+	graphql *graphql.Schema
 }
 
-func NewHandler(db *sqlx.DB, encryptor *encryption.Manager, workerPool *worker.Pool, tokenManager *auth.TokenManager) *Handler {
-	hub := NewHub()
+func NewHandler(cfg *config.Config, live *config.Live, db *sqlx.DB, encryptor encryption.Encryptor, workerPool *worker.Pool, tokenManager *auth.TokenManager) *Handler {
+	hub := NewHub(cfg.Events.SingleSession)
 	go hub.Run() // Start the hub in a goroutine
 
-	return &Handler{
+	// Signed media URLs are only offered once a signing key is configured
+	var mediaSigner *media.Signer
+	if cfg.Media.SigningKey != "" {
+		mediaSigner = media.NewSigner(cfg.Media.SigningKey, cfg.Media.URLTTL)
+	}
+
+	// Invite links are only offered once a signing key is configured
+	var inviteSigner *invite.Signer
+	if cfg.Invite.SigningKey != "" {
+		inviteSigner = invite.NewSigner(cfg.Invite.SigningKey, cfg.Invite.TTL)
+	}
+
+	// Users can only be looked up across deployments once federation is configured
+	var federationSigner *federation.Signer
+	if cfg.Federation.Enabled() {
+		federationSigner = federation.NewSigner(cfg.Federation.Domain, cfg.Federation.SigningKey)
+	}
+
+	// Recorders can only stream messages once the stream can be sealed
+	var complianceSealer *compliance.Sealer
+	if len(cfg.Compliance.Recorders) > 0 {
+		complianceSealer = compliance.NewSealer(cfg.Compliance.StreamKey, cfg.Compliance.SigningKey)
+	}
+
+	h := &Handler{
+		cfg:          cfg,
+		live:         live,
 		db:           db,
 		encryptor:    encryptor,
 		workerPool:   workerPool,
 		tokenManager: tokenManager,
 		hub:          hub,
+		metrics:      metrics.NewRecorder(cfg.Metrics.TopK, cfg.Metrics.Window),
+		events: eventlog.New(eventlog.Limits{
+			Retention:          cfg.Events.Retention,
+			MaxPerConversation: cfg.Events.MaxPerConversation,
+			MaxBytes:           cfg.Events.MaxBytes,
+		}),
+		deliveries:       delivery.NewTracker(cfg.Delivery.AckTimeout),
+		mediaFetcher:     media.NewFetcher(cfg.Media.AllowedHosts),
+		mediaSigner:      mediaSigner,
+		inviteSigner:     inviteSigner,
+		webhooks:         webhook.NewClient(cfg.Automation.WebhookHosts, cfg.Automation.WebhookTimeout),
+		federation:       federation.NewClient(cfg.Federation.Peers, cfg.Federation.Timeout, cfg.Federation.KeyTTL),
+		federationSigner: federationSigner,
+		groupNames:       groupname.New(cfg.Group.NameParticipants, cfg.Group.NameLocale, cfg.Group.NameTemplates),
+		complianceSealer: complianceSealer,
+		streamsClosed:    make(chan struct{}),
+		passwords:        newPasswordChecker(&cfg.Password),
+		transcripts:      transcript.NewPDFRenderer(),
+		startedAt:        time.Now(),
+	}
+	// The schema's resolvers are checked against it as it is parsed
+	if cfg.GraphQL.Enabled {
+		h.graphql = h.newGraphQLSchema()
 	}
+	return h
+}
+
+// Close ends every WebSocket connection; no new ones are accepted afterwards
+func (h *Handler) Close() {
+	h.hub.Stop()
+}
+
+// CloseStreams ends every compliance stream, so that shutting down the service
+// listener doesn't wait for recorders to hang up. They reconnect elsewhere and resume.
+func (h *Handler) CloseStreams() {
+	h.closeStreams.Do(func() { close(h.streamsClosed) })
+}
+
+// Metrics returns the recorder behind /metrics, for middleware that reports into it
+func (h *Handler) Metrics() *metrics.Recorder {
+	return h.metrics
+}
+
+// SetPresence shares online status with other nodes through the tracker instead of
+// writing it to the database on every request
+func (h *Handler) SetPresence(tracker *presence.Tracker) {
+	h.presence = tracker
+}
+
+// SetRoutes tells the handler how to list the registered routes, for the authorization matrix
+func (h *Handler) SetRoutes(routes func() gin.RoutesInfo) {
+	h.routes = routes
 }
 
 func (h *Handler) respondWithError(c *gin.Context, code int, message string) {
@@ -40,7 +174,35 @@ func (h *Handler) respondWithError(c *gin.Context, code int, message string) {
 }
 
 func (h *Handler) respondWithSuccess(c *gin.Context, code int, data interface{}) {
-	c.JSON(code, data)
+	c.JSON(code, h.serialize(c, data))
+}
+
+// selectFields reads the fields and include query parameters of an endpoint whose
+// payload embeds relations, answering 400 when they don't make sense
+func (h *Handler) selectFields(c *gin.Context, relations []string) (*fieldset.Selection, bool) {
+	selection, err := fieldset.Parse(c.Query("fields"), c.Query("include"), relations)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid field selection: %v", err))
+		return nil, false
+	}
+	return selection, true
+}
+
+// respondWithSelection responds with data trimmed to what the client selected
+func (h *Handler) respondWithSelection(c *gin.Context, code int, selection *fieldset.Selection, data interface{}) {
+	if trimmed, ok := h.applySelection(c, selection, data); ok {
+		c.JSON(code, h.serialize(c, trimmed))
+	}
+}
+
+// applySelection trims data to what the client selected, answering 500 when it can't
+func (h *Handler) applySelection(c *gin.Context, selection *fieldset.Selection, data interface{}) (interface{}, bool) {
+	trimmed, err := selection.Apply(data)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to encode response")
+		return nil, false
+	}
+	return trimmed, true
 }
 
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
@@ -69,45 +231,179 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 		// Validate the token
 		claims, err := h.tokenManager.ValidateToken(parts[1])
 		if err != nil {
-			h.respondWithError(c, http.StatusUnauthorized, fmt.Sprintf("Invalid token: %v", err))
+			reason := ReasonTokenInvalid
+			if errors.Is(err, auth.ErrTokenExpired) {
+				reason = ReasonTokenExpired
+			}
+			h.respondUnauthorized(c, reason, fmt.Sprintf("Invalid token: %v", err))
 			c.Abort()
 			return
 		}
 
-		// Get full user object
-		userService := models.NewUserService(h.db, h.encryptor)
-		user, err := userService.GetByID(claims.UserID)
-		if err != nil {
-			if err == models.ErrNotFound {
-				h.respondWithError(c, http.StatusUnauthorized, "User not found")
-			} else {
-				h.respondWithError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get user: %v", err))
-			}
+		if claims.Type == auth.TokenTypeRefresh {
+			h.respondUnauthorized(c, ReasonTokenInvalid, "Refresh tokens cannot be used to access the API")
 			c.Abort()
 			return
 		}
 
-		// Check if user is active
-		if !user.IsActive {
-			h.respondWithError(c, http.StatusForbidden, "User account is inactive")
+		// Signed-in users' tokens belong to a session, which the policies may have ended
+		if claims.SessionID != uuid.Nil {
+			reason, err := h.checkSession(claims.SessionID)
+			if err != nil {
+				h.respondWithError(c, http.StatusInternalServerError, "Failed to check session")
+				c.Abort()
+				return
+			}
+			if reason != "" {
+				h.respondUnauthorized(c, reason, sessionMessage(reason))
+				c.Abort()
+				return
+			}
+		}
+
+		// Administrators acting as the user are held to what was approved
+		if claims.Impersonation != nil && !h.checkImpersonation(c, claims) {
 			c.Abort()
 			return
 		}
 
-		// Set both user ID and full user object in context
+		// Restricted tokens may only reach routes covered by one of their scopes
+		var scope string
+		if claims.IsRestricted() {
+			var ok bool
+			scope, ok = requiredScope(c)
+			if !ok || !claims.Allows(scope) {
+				h.respondWithError(c, http.StatusForbidden, "Token does not have the required scope")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("claims", claims)
 		c.Set("userID", claims.UserID)
-		c.Set("user", user)
 		c.Request.Header.Set("X-User-ID", claims.UserID.String())
 
-		// Submit user status update to worker pool
-		h.submitTask("update_user_status", func() error {
-			return userService.SetOnlineStatus(claims.UserID, true)
-		})
+		user, ok := h.checkAccess(c, claims, scope)
+		if !ok {
+			c.Abort()
+			return
+		}
+		// Guests have no user account to load
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		c.Set("user", user)
+
+		if user.PasswordChangeRequired && !passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "Choose a new password to continue",
+				"reason": ReasonPasswordChangeRequired,
+			})
+			c.Abort()
+			return
+		}
+
+		// Submit user status update to worker pool; impersonation doesn't count as the
+		// user being around
+		if claims.Impersonation == nil {
+			h.markOnline(claims.UserID)
+			h.recordClient(c, claims.UserID)
+		}
 
 		c.Next()
 	}
 }
 
+// checkAccess makes the checks a valid token is held to on every request and when a
+// WebSocket is opened: an application's grant must still cover scope, guests must be
+// let into the workspace, and users must exist and be active. It returns the user,
+// which is nil for guests, or responds and returns false.
+func (h *Handler) checkAccess(c *gin.Context, claims *auth.Claims, scope string) (*models.User, bool) {
+	if claims.IsAppToken() {
+		granted, err := models.NewOAuthService(h.db).GetGrantScopes(claims.ClientID, claims.UserID)
+		if err != nil || !auth.HasScope(granted, scope) {
+			h.respondWithError(c, http.StatusForbidden, "Access for this application has been revoked")
+			return nil, false
+		}
+	}
+
+	if claims.Type == auth.TokenTypeGuest {
+		settings, err := models.NewWorkspaceSettingsService(h.db).Get()
+		if err != nil {
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check guest access")
+			return nil, false
+		}
+		if !settings.GuestAccess {
+			h.respondWithError(c, http.StatusForbidden, "Guest access is disabled in this workspace")
+			return nil, false
+		}
+		return nil, true
+	}
+
+	user, err := models.NewUserService(h.db, h.encryptor).GetByID(claims.UserID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			h.respondWithError(c, http.StatusUnauthorized, "User not found")
+		} else {
+			h.respondWithError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get user: %v", err))
+		}
+		return nil, false
+	}
+	if !user.IsActive {
+		h.respondWithError(c, http.StatusForbidden, "User account is inactive")
+		return nil, false
+	}
+	return user, true
+}
+
+// quotaService builds a quota service from the configured limits
+func (h *Handler) quotaService() *models.QuotaService {
+	return models.NewQuotaService(h.db, models.Quotas{
+		MaxStorageBytes: h.cfg.Quota.MaxStorageBytes,
+		MaxMessages:     h.cfg.Quota.MaxMessages,
+		MaxMediaSize:    h.cfg.Quota.MaxMediaSize,
+	})
+}
+
+// conversationService builds a conversation service that enforces the configured limits
+// on conversations users create and on group sizes
+func (h *Handler) conversationService() *models.ConversationService {
+	return models.NewConversationService(h.db, h.encryptor).WithLimits(models.ConversationLimits{
+		PerHour:         h.cfg.Quota.ConversationsPerHour,
+		PerDay:          h.cfg.Quota.ConversationsPerDay,
+		VerifiedPerHour: h.cfg.Quota.VerifiedConversationsPerHour,
+		VerifiedPerDay:  h.cfg.Quota.VerifiedConversationsPerDay,
+		MaxParticipants: h.cfg.Group.MaxParticipants,
+
+		LargeGroupThreshold: h.cfg.Group.LargeThreshold,
+	})
+}
+
+// deviceName identifies the client a token is issued to
+func deviceName(c *gin.Context) string {
+	device := c.GetHeader("X-Device-Name")
+	if device == "" {
+		device = c.Request.UserAgent()
+	}
+	if len(device) > 128 {
+		device = device[:128]
+	}
+	return device
+}
+
+// markOnline records in the background that the user was just seen
+func (h *Handler) markOnline(userID uuid.UUID) {
+	h.submitTask("update_user_status", func() error {
+		if h.presence != nil {
+			return h.presence.Touch(userID.String())
+		}
+		userService := models.NewUserService(h.db, h.encryptor)
+		return userService.SetOnlineStatus(userID, true)
+	})
+}
+
 func (h *Handler) submitTask(name string, task func() error) {
 	h.workerPool.Submit(worker.Task{
 		Name:    name,
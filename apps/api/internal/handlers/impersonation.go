@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Reasons given with responses refused to impersonation tokens
+const (
+	ReasonImpersonationEnded     = "impersonation_ended"
+	ReasonImpersonationReadOnly  = "impersonation_read_only"
+	ReasonImpersonationForbidden = "impersonation_forbidden"
+)
+
+// Headers flagging every response to a request made while impersonating
+const (
+	HeaderImpersonatedBy   = "X-Impersonated-By"
+	HeaderImpersonationID  = "X-Impersonation-ID"
+	HeaderImpersonationEnd = "X-Impersonation-Expires-At"
+)
+
+// impersonationBlockedRoutes guard the account itself: administrators acting as a user
+// can't change their credentials, contact details or recovery options, grant
+// applications access, or decide impersonations
+var impersonationBlockedRoutes = map[string]bool{
+	"PUT /api/users/me":                             true,
+	"PATCH /api/users/me":                           true,
+	"POST /api/users/me/email/confirm":              true,
+	"PUT /api/users/me/password":                    true,
+	"POST /api/users/me/login-alerts/:id/report":    true,
+	"POST /api/users/me/recovery-codes":             true,
+	"PUT /api/users/me/trusted-contacts":            true,
+	"POST /api/users/me/recovery-approvals/:id":     true,
+	"POST /api/oauth/authorize":                     true,
+	"GET /api/users/me/impersonations":              true,
+	"POST /api/users/me/impersonations/:id/approve": true,
+	"POST /api/users/me/impersonations/:id/deny":    true,
+	"POST /api/users/me/impersonations/:id/end":     true,
+}
+
+// RequestImpersonationRequest asks to act as a user for support
+type RequestImpersonationRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Mode   string    `json:"mode" binding:"required,oneof=full read_only" example:"read_only"`
+	Reason string    `json:"reason" binding:"required,max=500" example:"Ticket 4821: messages fail to send"`
+	// DurationMinutes is how long the impersonation lasts once approved
+	DurationMinutes int `json:"duration_minutes" binding:"required,min=5,max=240" example:"30"`
+	// BreakGlass skips the user's consent; another administrator approves instead
+	BreakGlass bool `json:"break_glass"`
+}
+
+// ImpersonationTokenResponse is an access token acting as the impersonated user
+type ImpersonationTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Mode      string    `json:"mode" example:"read_only"`
+}
+
+// checkImpersonation holds a request made with an impersonation token to what was
+// approved, flags the response and audits the request. It answers and returns false
+// when the request may not go on.
+func (h *Handler) checkImpersonation(c *gin.Context, claims *auth.Claims) bool {
+	impersonation, err := models.NewImpersonationService(h.db).Active(claims.Impersonation.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrImpersonationInactive) {
+			h.respondUnauthorized(c, ReasonImpersonationEnded, "Impersonation has ended")
+		} else {
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check impersonation")
+		}
+		return false
+	}
+
+	c.Header(HeaderImpersonatedBy, impersonation.AdminID.String())
+	c.Header(HeaderImpersonationID, impersonation.ID.String())
+	c.Header(HeaderImpersonationEnd, impersonation.ExpiresAt.UTC().Format(time.RFC3339))
+
+	route := c.Request.Method + " " + c.FullPath()
+	logger.Info("Request made while impersonating", map[string]interface{}{
+		"audit":            true,
+		"action":           "impersonation.request",
+		"impersonation_id": impersonation.ID,
+		"admin_id":         impersonation.AdminID,
+		"user_id":          impersonation.UserID,
+		"route":            route,
+		"path":             c.Request.URL.Path,
+	})
+
+	if impersonation.Mode == models.ImpersonationReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This impersonation is read-only", "reason": ReasonImpersonationReadOnly})
+		return false
+	}
+	if impersonationBlockedRoutes[route] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not available while impersonating", "reason": ReasonImpersonationForbidden})
+		return false
+	}
+	return true
+}
+
+// @Summary Request to impersonate a user
+// @Description Ask to act as a user for support, in full or read-only. The user is notified and has to consent, unless the request is break-glass, in which case another administrator approves it. Once approved, the impersonation lasts the given duration. Administrators and system accounts can't be impersonated.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body RequestImpersonationRequest true "Impersonation request"
+// @Success 201 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations [post]
+func (h *Handler) RequestImpersonation(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req RequestImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	impersonation, err := models.NewImpersonationService(h.db).Request(adminID, req.UserID, req.Mode, req.Reason, duration, req.BreakGlass)
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+
+	logger.Info("Impersonation requested", map[string]interface{}{
+		"audit":            true,
+		"action":           "impersonation.request_created",
+		"impersonation_id": impersonation.ID,
+		"admin_id":         adminID,
+		"user_id":          impersonation.UserID,
+		"mode":             impersonation.Mode,
+		"break_glass":      impersonation.BreakGlass,
+		"reason":           impersonation.Reason,
+	})
+	if !impersonation.BreakGlass {
+		h.submitTask("notify_impersonation_request", func() error {
+			return h.notify(impersonation.UserID, models.NotificationImpersonationRequested,
+				"Support asked to access your account", impersonationNotice(impersonation)+
+					" Approve or deny it from your impersonation requests.")
+		})
+	}
+	h.respondWithSuccess(c, http.StatusCreated, impersonation)
+}
+
+// @Summary List impersonations
+// @Description List the latest impersonation requests of every administrator, newest first, optionally of one user
+// @Tags admin
+// @Produce json
+// @Param user_id query string false "Only impersonations of this user"
+// @Param limit query int false "Number of impersonations to return (1-500)" default(100)
+// @Success 200 {array} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations [get]
+func (h *Handler) GetImpersonations(c *gin.Context) {
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		userID = &id
+	}
+	limit, ok := h.parseLimit(c, 100, 500)
+	if !ok {
+		return
+	}
+
+	impersonations, err := models.NewImpersonationService(h.db).List(userID, limit)
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, impersonations)
+}
+
+// @Summary Approve a break-glass impersonation
+// @Description Approve another administrator's break-glass request to impersonate a user. The user is told their account is being accessed.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations/{id}/approve [post]
+func (h *Handler) AdminApproveImpersonation(c *gin.Context) {
+	h.decideImpersonation(c, true, true)
+}
+
+// @Summary Deny a break-glass impersonation
+// @Description Deny another administrator's break-glass request to impersonate a user
+// @Tags admin
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations/{id}/deny [post]
+func (h *Handler) AdminDenyImpersonation(c *gin.Context) {
+	h.decideImpersonation(c, true, false)
+}
+
+// @Summary Get an impersonation token
+// @Description Get an access token acting as the user of an approved impersonation, valid until the impersonation ends. Only the requesting administrator can get it. Every response to it carries the X-Impersonated-By, X-Impersonation-ID and X-Impersonation-Expires-At headers, and every request is audited. Read-only tokens can only read, and no token can change the account's credentials, contact details or recovery options.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} ImpersonationTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations/{id}/token [post]
+func (h *Handler) GetImpersonationToken(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid impersonation ID")
+		return
+	}
+
+	impersonation, err := models.NewImpersonationService(h.db).Active(id)
+	if err == nil && impersonation.AdminID != adminID {
+		err = models.ErrNotFound
+	}
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+
+	token, err := h.tokenManager.GenerateImpersonationToken(impersonation.UserID, auth.Impersonation{
+		ID:       impersonation.ID,
+		AdminID:  adminID,
+		ReadOnly: impersonation.Mode == models.ImpersonationReadOnly,
+	}, impersonation.ExpiresAt)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	logger.Info("Impersonation token issued", map[string]interface{}{
+		"audit":            true,
+		"action":           "impersonation.token",
+		"impersonation_id": impersonation.ID,
+		"admin_id":         adminID,
+		"user_id":          impersonation.UserID,
+		"mode":             impersonation.Mode,
+	})
+	h.respondWithSuccess(c, http.StatusOK, ImpersonationTokenResponse{
+		Token:     token,
+		ExpiresAt: impersonation.ExpiresAt,
+		Mode:      impersonation.Mode,
+	})
+}
+
+// @Summary End an impersonation
+// @Description End a pending or active impersonation; its tokens stop working at once. Any administrator can end any impersonation.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/impersonations/{id}/end [post]
+func (h *Handler) AdminEndImpersonation(c *gin.Context) {
+	h.endImpersonation(c, false)
+}
+
+// @Summary List requests to impersonate me
+// @Description List the latest requests of administrators to act as the user, newest first, including break-glass ones
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/impersonations [get]
+func (h *Handler) GetMyImpersonations(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	impersonations, err := models.NewImpersonationService(h.db).List(&userID, 100)
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, impersonations)
+}
+
+// @Summary Consent to an impersonation
+// @Description Let the administrator who asked act as the user for the requested duration
+// @Tags users
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/impersonations/{id}/approve [post]
+func (h *Handler) ApproveImpersonation(c *gin.Context) {
+	h.decideImpersonation(c, false, true)
+}
+
+// @Summary Refuse an impersonation
+// @Description Refuse an administrator's request to act as the user
+// @Tags users
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/impersonations/{id}/deny [post]
+func (h *Handler) DenyImpersonation(c *gin.Context) {
+	h.decideImpersonation(c, false, false)
+}
+
+// @Summary End an impersonation of me
+// @Description End a pending or active impersonation of the user, break-glass ones included; its tokens stop working at once
+// @Tags users
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/impersonations/{id}/end [post]
+func (h *Handler) EndMyImpersonation(c *gin.Context) {
+	h.endImpersonation(c, true)
+}
+
+// decideImpersonation approves or denies a request, as the user for consent requests
+// or as an administrator for break-glass ones
+func (h *Handler) decideImpersonation(c *gin.Context, asAdmin, approve bool) {
+	deciderID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid impersonation ID")
+		return
+	}
+
+	impersonationService := models.NewImpersonationService(h.db)
+	var impersonation *models.Impersonation
+	if asAdmin {
+		impersonation, err = impersonationService.DecideAsAdmin(deciderID, id, approve)
+	} else {
+		impersonation, err = impersonationService.DecideAsUser(deciderID, id, approve)
+	}
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+
+	logger.Info("Impersonation decided", map[string]interface{}{
+		"audit":            true,
+		"action":           "impersonation.decide",
+		"impersonation_id": impersonation.ID,
+		"admin_id":         impersonation.AdminID,
+		"user_id":          impersonation.UserID,
+		"decided_by":       deciderID,
+		"break_glass":      impersonation.BreakGlass,
+		"status":           impersonation.Status,
+	})
+	h.submitTask("notify_impersonation_decision", func() error {
+		if impersonation.BreakGlass && approve {
+			if err := h.notify(impersonation.UserID, models.NotificationImpersonationApproved,
+				"Support is accessing your account", impersonationNotice(impersonation)+
+					" It was approved without your consent; you can end it from your impersonation requests."); err != nil {
+				return err
+			}
+		}
+		return h.notify(impersonation.AdminID, models.NotificationImpersonationDecided,
+			"Impersonation "+impersonation.Status, fmt.Sprintf("Your request to impersonate a user was %s.", impersonation.Status))
+	})
+	h.respondWithSuccess(c, http.StatusOK, impersonation)
+}
+
+// endImpersonation ends an impersonation, as its user or as any administrator
+func (h *Handler) endImpersonation(c *gin.Context, byUser bool) {
+	actorID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid impersonation ID")
+		return
+	}
+
+	impersonation, err := models.NewImpersonationService(h.db).End(actorID, id, byUser)
+	if err != nil {
+		h.respondWithImpersonationError(c, err)
+		return
+	}
+
+	logger.Info("Impersonation ended", map[string]interface{}{
+		"audit":            true,
+		"action":           "impersonation.end",
+		"impersonation_id": impersonation.ID,
+		"admin_id":         impersonation.AdminID,
+		"user_id":          impersonation.UserID,
+		"ended_by":         actorID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, impersonation)
+}
+
+// impersonationNotice describes a request to the impersonated user
+func impersonationNotice(impersonation *models.Impersonation) string {
+	access := "full access to"
+	if impersonation.Mode == models.ImpersonationReadOnly {
+		access = "read-only access to"
+	}
+	return fmt.Sprintf("An administrator asked for %s your account for %s, because: %s.",
+		access, (time.Duration(impersonation.DurationSeconds) * time.Second).String(), impersonation.Reason)
+}
+
+func (h *Handler) respondWithImpersonationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Impersonation not found")
+	case errors.Is(err, models.ErrUserNotFound):
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, models.ErrCannotImpersonate):
+		h.respondWithError(c, http.StatusBadRequest, "This user cannot be impersonated")
+	case errors.Is(err, models.ErrConflict):
+		h.respondWithError(c, http.StatusConflict, "An impersonation of this user is already pending or active")
+	case errors.Is(err, models.ErrImpersonationNotPending):
+		h.respondWithError(c, http.StatusConflict, "This impersonation was already decided, ended or has expired")
+	case errors.Is(err, models.ErrImpersonationInactive):
+		h.respondWithError(c, http.StatusConflict, "This impersonation is not active")
+	case errors.Is(err, models.ErrSelfApproval):
+		h.respondWithError(c, http.StatusForbidden, "Break-glass impersonations need another administrator's approval")
+	default:
+		logger.Error("Failed to manage impersonation", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage impersonation")
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/mail"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// inactiveBatchSize bounds how many users each step of the policy handles per run
+const inactiveBatchSize = 500
+
+// SetLegalHoldRequest represents the request body for changing a user's legal hold
+type SetLegalHoldRequest struct {
+	LegalHold *bool `json:"legal_hold" binding:"required" example:"true"`
+}
+
+// InactiveUsersReport lists the upcoming steps of the inactive account policy
+type InactiveUsersReport struct {
+	Enabled         bool                  `json:"enabled"`
+	WarnAfter       string                `json:"warn_after"`
+	DeactivateAfter string                `json:"deactivate_after"`
+	AnonymizeAfter  string                `json:"anonymize_after"`
+	Users           []models.InactiveUser `json:"users"`
+}
+
+// SetMailer sets where notification emails are sent through
+func (h *Handler) SetMailer(mailer *mail.Mailer) {
+	h.mailer = mailer
+}
+
+func (h *Handler) inactivityPolicy() models.InactivityPolicy {
+	return models.InactivityPolicy{
+		WarnAfter:       h.cfg.Inactive.WarnAfter,
+		DeactivateAfter: h.cfg.Inactive.DeactivateAfter,
+		AnonymizeAfter:  h.cfg.Inactive.AnonymizeAfter,
+	}
+}
+
+// EnforceInactivePolicy warns, deactivates and anonymizes inactive users as configured
+func (h *Handler) EnforceInactivePolicy() error {
+	if !h.cfg.Inactive.Enabled() || h.mailer == nil {
+		return nil
+	}
+
+	policy := h.inactivityPolicy()
+	userService := models.NewUserService(h.db, h.encryptor)
+
+	// Deactivate first so users warned in this run always get their full notice period
+	deactivated, err := userService.DeactivateInactive(policy)
+	if err != nil {
+		return err
+	}
+	for _, user := range deactivated {
+		logger.Info("Deactivated inactive user", map[string]interface{}{
+			"audit":          true,
+			"action":         "user.inactive_deactivate",
+			"user_id":        user.ID,
+			"last_active_at": user.LastActiveAt,
+			"warned_at":      user.WarnedAt,
+		})
+	}
+
+	anonymized, err := userService.AnonymizeInactive(policy, inactiveBatchSize)
+	for _, user := range anonymized {
+		logger.Info("Anonymized inactive user", map[string]interface{}{
+			"audit":          true,
+			"action":         "user.inactive_anonymize",
+			"user_id":        user.ID,
+			"last_active_at": user.LastActiveAt,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	users, err := userService.UsersToWarn(policy, inactiveBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		subject, body := inactivityWarning(policy, &user)
+		if err := h.mailer.Send(user.Email, subject, body); err != nil {
+			// Not marking the user warned means the next run tries again
+			logger.Error("Failed to send inactivity warning", err, map[string]interface{}{
+				"user_id": user.ID,
+			})
+			continue
+		}
+		if err := userService.MarkInactivityWarned(user.ID); err != nil {
+			return err
+		}
+		logger.Info("Warned inactive user", map[string]interface{}{
+			"audit":          true,
+			"action":         "user.inactive_warn",
+			"user_id":        user.ID,
+			"last_active_at": user.LastActiveAt,
+		})
+	}
+	return nil
+}
+
+// inactivityWarning is the email telling a user what happens to their account
+func inactivityWarning(policy models.InactivityPolicy, user *models.InactiveUser) (subject, body string) {
+	deactivateAt := user.LastActiveAt.Add(policy.DeactivateAfter)
+	if notice := time.Now().Add(policy.DeactivateAfter - policy.WarnAfter); notice.After(deactivateAt) {
+		deactivateAt = notice
+	}
+
+	body = fmt.Sprintf("Hi %s,\n\n"+
+		"You have not used Talkify since %s. Sign in before %s to keep your account, "+
+		"otherwise it will be deactivated.\n",
+		user.Username, user.LastActiveAt.Format("January 2, 2006"), deactivateAt.Format("January 2, 2006"))
+	if policy.AnonymizeAfter > 0 {
+		body += fmt.Sprintf("\nDeactivated accounts are anonymized after %s, "+
+			"which permanently removes your name and contact details.\n",
+			user.LastActiveAt.Add(policy.AnonymizeAfter).Format("January 2, 2006"))
+	}
+	return "Your Talkify account is inactive", body
+}
+
+// @Summary List upcoming inactive account actions
+// @Description List the users the inactive account policy will warn, deactivate or anonymize within the given time, soonest first. Users on legal hold are listed but skipped by the policy.
+// @Tags admin
+// @Produce json
+// @Param within query string false "How far ahead to look, as a duration" default(720h)
+// @Param limit query int false "Maximum number of users (1-1000)" default(100)
+// @Success 200 {object} InactiveUsersReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/users/inactive [get]
+func (h *Handler) GetInactiveUsers(c *gin.Context) {
+	within, err := time.ParseDuration(c.DefaultQuery("within", "720h"))
+	if err != nil || within < 0 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid within. Must be a duration such as 720h")
+		return
+	}
+	limit, ok := h.parseLimit(c, 100, 1000)
+	if !ok {
+		return
+	}
+
+	report := InactiveUsersReport{
+		Enabled:         h.cfg.Inactive.Enabled(),
+		WarnAfter:       h.cfg.Inactive.WarnAfter.String(),
+		DeactivateAfter: h.cfg.Inactive.DeactivateAfter.String(),
+		AnonymizeAfter:  h.cfg.Inactive.AnonymizeAfter.String(),
+		Users:           []models.InactiveUser{},
+	}
+	if report.Enabled {
+		userService := models.NewUserService(h.db, h.encryptor)
+		report.Users, err = userService.UpcomingInactive(h.inactivityPolicy(), within, limit)
+		if err != nil {
+			logger.Error("Failed to get inactive users", err)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to get inactive users")
+			return
+		}
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
+
+// @Summary Set a user's legal hold
+// @Description Exempt a user from the inactive account policy, or lift the exemption
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetLegalHoldRequest true "Legal hold"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/legal-hold [put]
+func (h *Handler) SetLegalHold(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req SetLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	if err := userService.SetLegalHold(userID, *req.LegalHold); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to set legal hold", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set legal hold")
+		return
+	}
+
+	logger.Info("Changed legal hold", map[string]interface{}{
+		"audit":      true,
+		"action":     "user.legal_hold",
+		"user_id":    userID,
+		"legal_hold": *req.LegalHold,
+		"admin_id":   c.GetHeader("X-User-ID"),
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"user_id": userID, "legal_hold": *req.LegalHold})
+}
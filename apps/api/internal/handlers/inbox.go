@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (h *Handler) RegisterInboxRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetInbox)
+	}
+}
+
+// @Summary Get inbox
+// @Description Get the most recent unread messages across all conversations, grouped by conversation
+// @Tags messages
+// @Produce json
+// @Param limit query int false "Maximum number of conversations (1-50)" default(20)
+// @Param per_conversation query int false "Maximum number of messages per conversation (1-20)" default(3)
+// @Success 200 {array} models.InboxConversation
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /inbox [get]
+func (h *Handler) GetInbox(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	limit, ok := h.parseLimit(c, 20, 50)
+	if !ok {
+		return
+	}
+	perConversation, err := strconv.Atoi(c.DefaultQuery("per_conversation", "3"))
+	if err != nil || perConversation < 1 || perConversation > 20 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid per_conversation. Must be between 1 and 20")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	inbox, err := messageService.GetInbox(userID, limit, perConversation)
+	if err != nil {
+		logger.Error("Failed to get inbox", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get inbox")
+		return
+	}
+
+	h.nameInboxGroups(c, userID, inbox)
+	h.respondWithSuccess(c, http.StatusOK, inbox)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// @Summary Verify conversation integrity
+// @Description Check the conversation's integrity chain: that no link was altered or removed and that every message sent since the chain started is stored as it was last written, edited or deleted. Keep the returned head hash to prove later that history up to now was not rewritten. Conversation owners and admins, and administrators, can run the check.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.IntegrityReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/integrity [get]
+func (h *Handler) GetConversationIntegrity(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	user, _ := c.Get("user")
+	if current, ok := user.(*models.User); !ok || !current.IsAdmin {
+		role, err := conversationService.GetParticipantRole(conversationID, userID)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidParticipant) {
+				h.respondWithError(c, http.StatusForbidden, "You don't have access to this conversation")
+				return
+			}
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+			return
+		}
+		if role != "owner" && role != "admin" {
+			h.respondWithError(c, http.StatusForbidden, "Only owners and admins can verify integrity")
+			return
+		}
+	}
+
+	report, err := conversationService.VerifyIntegrity(conversationID)
+	if err != nil {
+		if errors.Is(err, models.ErrConversationNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+			return
+		}
+		logger.Error("Failed to verify conversation integrity", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to verify conversation integrity")
+		return
+	}
+
+	if !report.Valid {
+		logger.Warn("Conversation integrity check failed", map[string]interface{}{
+			"audit":           true,
+			"action":          "conversation.integrity_failed",
+			"conversation_id": conversationID,
+			"user_id":         userID,
+			"problems":        report.ProblemCount,
+		})
+	}
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
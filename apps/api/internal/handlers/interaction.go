@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// CreateInteractionRequest clicks a card's button or picks from one of its select menus
+type CreateInteractionRequest struct {
+	// CallbackToken is the callback_token of the button or select menu
+	CallbackToken string `json:"callback_token" binding:"required,max=512"`
+	// Values holds the option picked from a select menu; buttons take none
+	Values []string `json:"values" binding:"max=1"`
+}
+
+// UpdateMessageCardRequest replaces the card of a message
+type UpdateMessageCardRequest struct {
+	Card *models.MessageCard `json:"card" binding:"required"`
+}
+
+func (h *Handler) RegisterInteractionRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.POST("", h.CreateInteraction)
+	}
+}
+
+// @Summary Interact with a card
+// @Description Click a button or pick from a select menu of a message's card, with the component's callback token. The application that posted the card gets an interaction.created event on its bot connection, and may answer by updating the card with PUT /messages/{id}/card.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param interaction body CreateInteractionRequest true "Component interacted with"
+// @Success 202 {object} models.Interaction
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /interactions [post]
+func (h *Handler) CreateInteraction(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req CreateInteractionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	interaction, err := models.NewMessageService(h.db, h.encryptor).Interact(req.CallbackToken, userID, req.Values)
+	if err != nil {
+		h.respondWithCardError(c, err)
+		return
+	}
+	h.publishToUsers([]uuid.UUID{interaction.ApplicationID}, EventInteractionCreated, interaction)
+	h.respondWithSuccess(c, http.StatusAccepted, interaction)
+}
+
+// @Summary Update a message's card
+// @Description Replace the card of a message in place, for the application that posted it, typically in answer to an interaction. The message isn't marked edited; participants get a message.updated event.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param card body UpdateMessageCardRequest true "New card"
+// @Success 200 {object} models.Message
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/card [put]
+func (h *Handler) UpdateMessageCard(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	app, ok := h.cardApplication(c)
+	if !ok {
+		return
+	}
+	var req UpdateMessageCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if !h.checkCard(c, req.Card, models.TextMessage, true) {
+		return
+	}
+
+	message, err := models.NewMessageService(h.db, h.encryptor).UpdateCard(messageID, userID, app.ID, req.Card)
+	if err != nil {
+		h.respondWithCardError(c, err)
+		return
+	}
+	h.publishToConversation(message.ConversationID, EventMessageUpdated, message)
+	h.respondWithSuccess(c, http.StatusOK, message)
+}
+
+func (h *Handler) respondWithCardError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrMessageNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Message not found")
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "The message has no card of this application")
+	case errors.Is(err, models.ErrInvalidCallback):
+		h.respondWithError(c, http.StatusBadRequest, "Invalid callback token or values")
+	case errors.Is(err, models.ErrApplicationNotFound):
+		h.respondWithError(c, http.StatusGone, "The application that sent this card is no longer available")
+	default:
+		logger.Error("Failed to handle card", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to handle card")
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/metrics"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ServiceMessageRequest is sent by internal callers to post a message on behalf of a user
+type ServiceMessageRequest struct {
+	SenderID       uuid.UUID          `json:"sender_id" binding:"required"`
+	ConversationID uuid.UUID          `json:"conversation_id" binding:"required"`
+	Content        string             `json:"content" binding:"required"`
+	MessageType    models.MessageType `json:"message_type" binding:"required"`
+	// Card may only have link buttons, since services can't answer actions
+	Card *models.MessageCard `json:"card"`
+}
+
+// RegisterInternalRoutes registers the routes served on the service-to-service listener.
+// They use their own middleware chain and never accept user tokens.
+func (h *Handler) RegisterInternalRoutes(r *gin.RouterGroup) {
+	r.Use(h.ServiceAuthMiddleware())
+	{
+		r.GET("/whoami", h.GetServiceIdentity)
+		r.GET("/users/:id", h.GetUser)
+		r.POST("/messages", h.CreateServiceMessage)
+		r.POST("/messages/:id/annotations", h.AnnotateServiceMessage)
+		r.GET("/compliance/stream", h.StreamComplianceEvents)
+		r.GET("/compliance/checkpoint", h.GetComplianceCheckpoint)
+		r.PUT("/compliance/checkpoint", h.SetComplianceCheckpoint)
+	}
+}
+
+// RegisterMetricsRoutes registers the Prometheus scrape endpoint on the service-to-service listener
+func (h *Handler) RegisterMetricsRoutes(r *gin.RouterGroup) {
+	r.Use(h.ServiceAuthMiddleware())
+	{
+		r.GET("", h.GetMetrics)
+	}
+}
+
+// GetMetrics writes the busiest conversations and slowest endpoints of the last
+// window in the Prometheus text format
+func (h *Handler) GetMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := h.metrics.WritePrometheus(c.Writer); err != nil {
+		logger.Warn("Failed to write metrics", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// ServiceAuthMiddleware authenticates internal callers by mTLS client certificate or service token
+func (h *Handler) ServiceAuthMiddleware() gin.HandlerFunc {
+	authenticator := auth.NewServiceAuthenticator(h.cfg.Service.TokenSecret, h.cfg.Service.AllowedServices)
+
+	return func(c *gin.Context) {
+		bearer := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		service, err := authenticator.Authenticate(c.Request, bearer)
+		if err != nil {
+			logger.Warn("Rejected internal request", map[string]interface{}{
+				"path":  c.Request.URL.Path,
+				"error": err.Error(),
+			})
+			h.respondWithError(c, http.StatusUnauthorized, "Service authentication required")
+			c.Abort()
+			return
+		}
+
+		c.Set("service", service)
+		c.Next()
+	}
+}
+
+// GetServiceIdentity returns the name the caller authenticated as
+func (h *Handler) GetServiceIdentity(c *gin.Context) {
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"service": c.GetString("service")})
+}
+
+// CreateServiceMessage posts a message on behalf of a participant
+func (h *Handler) CreateServiceMessage(c *gin.Context) {
+	var req ServiceMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Card != nil {
+		req.Card.ApplicationID = nil
+		if !h.checkCard(c, req.Card, req.MessageType, false) {
+			return
+		}
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	isParticipant, err := conversationService.IsParticipant(req.ConversationID, req.SenderID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+		return
+	}
+	if !isParticipant {
+		h.respondWithError(c, http.StatusForbidden, "Sender is not a participant in this conversation")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	message := &models.Message{
+		ConversationID: req.ConversationID,
+		SenderID:       req.SenderID,
+		Content:        req.Content,
+		MessageType:    string(req.MessageType),
+		Card:           req.Card,
+	}
+	if err := messageService.Create(message); err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create message")
+		return
+	}
+	h.metrics.RecordMessage(req.ConversationID.String())
+	h.messageCreated(message, req.Content)
+
+	logger.Info("Internal message created", map[string]interface{}{
+		"service":         c.GetString("service"),
+		"conversation_id": req.ConversationID,
+		"sender_id":       req.SenderID,
+	})
+
+	h.respondWithSuccess(c, http.StatusCreated, message)
+}
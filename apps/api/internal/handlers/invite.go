@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/invite"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// InviteLinkResponse is a link that opens a direct conversation with the user who
+// shared it
+type InviteLinkResponse struct {
+	Token     string    `json:"token"`
+	Link      string    `json:"link" example:"talkify://invite/4f0c7d5e-8a61-4c4e-9b1e-2d3f4a5b6c7d.1767225600.c2lnbmF0dXJl"`
+	QRPayload string    `json:"qr_payload"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcceptInviteRequest opens the conversation an invite link is for
+type AcceptInviteRequest struct {
+	// The token, or the whole link
+	Token string `json:"token" binding:"required"`
+}
+
+// @Summary Get my invite link
+// @Description Get a signed link, and the payload for its QR code, that opens a direct conversation with the user when another user opens it. Links expire; a new one is issued on every call.
+// @Tags users
+// @Produce json
+// @Success 200 {object} InviteLinkResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/invite-link [get]
+func (h *Handler) GetInviteLink(c *gin.Context) {
+	if h.inviteSigner == nil {
+		h.respondWithError(c, http.StatusServiceUnavailable, "Invite links are not configured")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	token, expiresAt := h.inviteSigner.Sign(userID)
+	link := invite.Link(token)
+	h.respondWithSuccess(c, http.StatusOK, InviteLinkResponse{
+		Token:     token,
+		Link:      link,
+		QRPayload: link,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// @Summary Accept an invite link
+// @Description Open the direct conversation with the user who shared an invite link, creating it if there is none yet
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param request body AcceptInviteRequest true "Invite token or link"
+// @Success 200 {object} models.Conversation "Existing conversation"
+// @Success 201 {object} models.Conversation "New conversation"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/invite [post]
+func (h *Handler) AcceptInvite(c *gin.Context) {
+	if h.inviteSigner == nil {
+		h.respondWithError(c, http.StatusServiceUnavailable, "Invite links are not configured")
+		return
+	}
+	currentUserID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	inviterID, err := h.inviteSigner.Verify(req.Token)
+	if err != nil {
+		if errors.Is(err, invite.ErrExpired) {
+			h.respondWithError(c, http.StatusGone, "Invite link has expired")
+			return
+		}
+		h.respondWithError(c, http.StatusBadRequest, "Invalid invite link")
+		return
+	}
+	if inviterID == currentUserID {
+		h.respondWithError(c, http.StatusBadRequest, "Cannot create a conversation with yourself")
+		return
+	}
+
+	// The inviter may have left since sharing the link
+	userService := models.NewUserService(h.db, h.encryptor)
+	if _, err := userService.GetByID(inviterID); err != nil {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	conversationService := h.conversationService()
+	status := http.StatusOK
+	conversationID, err := conversationService.FindDirect(currentUserID, inviterID)
+	if errors.Is(err, models.ErrConversationNotFound) {
+		var conversation *models.Conversation
+		conversation, err = conversationService.Create(currentUserID, &models.CreateConversationInput{
+			UserIDs: []uuid.UUID{inviterID},
+		})
+		if errors.Is(err, models.ErrDuplicateParticipant) {
+			// Created concurrently, by the other link holder or the inviter
+			conversationID, err = conversationService.FindDirect(currentUserID, inviterID)
+		} else if err == nil {
+			conversationID, status = conversation.ID, http.StatusCreated
+		}
+	}
+	if h.respondWithConversationLimit(c, currentUserID, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open conversation from invite", err, map[string]interface{}{
+			"user_id":    currentUserID,
+			"inviter_id": inviterID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to open conversation")
+		return
+	}
+
+	conversation, err := conversationService.GetByID(conversationID)
+	if err != nil {
+		logger.Error("Failed to get conversation", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to open conversation")
+		return
+	}
+	h.respondWithSuccess(c, status, conversation)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// CreateKeywordAlertRequest asks to be notified when a keyword comes up in a
+// conversation, or in any of the user's conversations when conversation_id is left out
+type CreateKeywordAlertRequest struct {
+	Keyword        string     `json:"keyword" binding:"required,max=64" example:"deploy"`
+	ConversationID *uuid.UUID `json:"conversation_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// @Summary List my keyword alerts
+// @Description List the keywords the user is notified about, the ones for all their conversations first
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.KeywordAlert
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/keyword-alerts [get]
+func (h *Handler) GetKeywordAlerts(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	alerts, err := models.NewKeywordAlertService(h.db).List(userID)
+	if err != nil {
+		h.respondWithKeywordAlertError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, alerts)
+}
+
+// @Summary Add a keyword alert
+// @Description Get a notification whenever someone else uses a keyword in a conversation, or in any of the user's conversations when conversation_id is left out. Keywords match whole words, ignoring case.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param alert body CreateKeywordAlertRequest true "Keyword to be alerted about"
+// @Success 201 {object} models.KeywordAlert
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/keyword-alerts [post]
+func (h *Handler) CreateKeywordAlert(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req CreateKeywordAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Keyword cannot be blank")
+		return
+	}
+
+	alert, err := models.NewKeywordAlertService(h.db).Create(userID, req.ConversationID, keyword)
+	if err != nil {
+		h.respondWithKeywordAlertError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusCreated, alert)
+}
+
+// @Summary Remove a keyword alert
+// @Description Stop notifying the user about one of their keywords
+// @Tags users
+// @Produce json
+// @Param id path string true "Keyword alert ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/keyword-alerts/{id} [delete]
+func (h *Handler) DeleteKeywordAlert(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	alertID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid keyword alert ID")
+		return
+	}
+
+	if err := models.NewKeywordAlertService(h.db).Delete(alertID, userID); err != nil {
+		h.respondWithKeywordAlertError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Keyword alert removed"})
+}
+
+func (h *Handler) respondWithKeywordAlertError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Keyword alert not found")
+	case errors.Is(err, models.ErrConversationNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, models.ErrConflict):
+		h.respondWithError(c, http.StatusConflict, "You already have an alert for this keyword")
+	case errors.Is(err, models.ErrKeywordAlertLimit):
+		h.respondWithError(c, http.StatusConflict, "Keyword alert limit reached")
+	default:
+		logger.Error("Failed to manage keyword alerts", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage keyword alerts")
+	}
+}
+
+// alertKeywords notifies, in the background, the participants whose keyword alerts come
+// up in a new message. content is the message's plaintext; the notification names the
+// keyword but doesn't copy the message.
+func (h *Handler) alertKeywords(message *models.Message, content string) {
+	if message.MessageType == string(models.SystemMessage) || content == "" {
+		return
+	}
+	message = &models.Message{ID: message.ID, ConversationID: message.ConversationID, SenderID: message.SenderID}
+	h.submitTask("alert_keywords", func() error {
+		matches, err := models.NewKeywordAlertService(h.db).Match(message, content)
+		if err != nil || len(matches) == 0 {
+			return err
+		}
+
+		var source struct {
+			Username string  `db:"username"`
+			Type     string  `db:"type"`
+			Name     *string `db:"name"`
+			models.GroupNameSource
+		}
+		err = h.db.Get(&source, `
+			SELECT u.username, c.type, c.name,
+				COALESCE(s.name_sample, '[]') AS name_sample, COALESCE(s.participant_count, 0) AS participant_count
+			FROM users u, conversations c
+			LEFT JOIN conversation_summaries s ON s.conversation_id = c.id
+			WHERE u.id = $1 AND c.id = $2
+		`, message.SenderID, message.ConversationID)
+		if err != nil {
+			return err
+		}
+		named := source.Name != nil && *source.Name != ""
+		where := "a conversation"
+		if named {
+			where = *source.Name
+		}
+
+		notificationService := models.NewNotificationService(h.db)
+		for _, match := range matches {
+			title := fmt.Sprintf("\"%s\" was mentioned", match.Keywords[0])
+			in := where
+			if !named && source.Type == "group" {
+				in = h.groupName(match.UserID, &source.GroupNameSource)
+			}
+			body := fmt.Sprintf("@%s used %s in %s", source.Username, quoteKeywords(match.Keywords), in)
+			notification, err := notificationService.CreateKeywordAlert(match.UserID, message, title, body)
+			if err != nil {
+				return err
+			}
+			h.publishToUsers([]uuid.UUID{match.UserID}, EventNotificationCreated, notification)
+		}
+		return nil
+	})
+}
+
+func quoteKeywords(keywords []string) string {
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = fmt.Sprintf("\"%s\"", keyword)
+	}
+	return strings.Join(quoted, ", ")
+}
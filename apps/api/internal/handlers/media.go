@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/media"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SignedMediaURL is a short-lived URL that serves media without further credentials
+type SignedMediaURL struct {
+	URL       string    `json:"url" example:"/api/media/123e4567-e89b-12d3-a456-426614174000/content?expires=1700000000&signature=..."`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (h *Handler) RegisterMediaRoutes(r *gin.RouterGroup) {
+	// Signed URLs carry their own authorization, for clients that cannot send headers
+	r.GET("/:id/content", h.GetSignedMedia)
+
+	authorized := r.Group("")
+	authorized.Use(h.AuthMiddleware())
+	{
+		authorized.GET("/:id", h.GetMedia)
+	}
+}
+
+// @Summary Get message media
+// @Description Stream the media of a message to a participant of its conversation, with range request support. With signed=true a short-lived signed URL is returned instead, for use where headers cannot be sent such as img and video tags; view-once media has none.
+// @Tags media
+// @Produce json,octet-stream
+// @Param id path string true "Message ID"
+// @Param signed query bool false "Return a signed URL instead of the media"
+// @Param Range header string false "Byte range to fetch"
+// @Success 200 {object} SignedMediaURL
+// @Success 206 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /media/{id} [get]
+func (h *Handler) GetMedia(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	attachment, err := messageService.GetMedia(messageID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Media not found")
+			return
+		}
+		logger.Error("Failed to get media", err, map[string]interface{}{
+			"message_id": messageID,
+			"user_id":    userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get media")
+		return
+	}
+
+	if c.Query("signed") == "true" {
+		if attachment.ViewOnce {
+			h.respondWithError(c, http.StatusBadRequest, "View-once media has no signed URL")
+			return
+		}
+		if h.mediaSigner == nil {
+			h.respondWithError(c, http.StatusServiceUnavailable, "Signed media URLs are not configured")
+			return
+		}
+		h.respondWithSuccess(c, http.StatusOK, h.signMediaURL(messageID))
+		return
+	}
+
+	h.streamMedia(c, messageID, attachment.MediaURL)
+}
+
+// signMediaURL returns a signed URL for the media of a message; mediaSigner must be set
+func (h *Handler) signMediaURL(messageID uuid.UUID) SignedMediaURL {
+	signature, expiresAt := h.mediaSigner.Sign(messageID.String())
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", signature)
+	return SignedMediaURL{
+		URL:       "/api/media/" + messageID.String() + "/content?" + query.Encode(),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// @Summary Get media through a signed URL
+// @Description Stream media using a URL from GET /media/{id}?signed=true, with range request support. No other credentials are needed until the URL expires.
+// @Tags media
+// @Produce octet-stream
+// @Param id path string true "Message ID"
+// @Param expires query int true "Expiry as a Unix timestamp"
+// @Param signature query string true "URL signature"
+// @Param Range header string false "Byte range to fetch"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /media/{id}/content [get]
+func (h *Handler) GetSignedMedia(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	if h.mediaSigner == nil {
+		h.respondWithError(c, http.StatusForbidden, "Invalid signature")
+		return
+	}
+	err = h.mediaSigner.Verify(messageID.String(), c.Query("expires"), c.Query("signature"))
+	switch {
+	case errors.Is(err, media.ErrURLExpired):
+		h.respondWithError(c, http.StatusGone, "Signed URL has expired")
+		return
+	case err != nil:
+		h.respondWithError(c, http.StatusForbidden, "Invalid signature")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	mediaURL, err := messageService.GetMediaURL(messageID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Media not found")
+			return
+		}
+		logger.Error("Failed to get media", err, map[string]interface{}{
+			"message_id": messageID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get media")
+		return
+	}
+
+	h.streamMedia(c, messageID, mediaURL)
+}
+
+// streamMedia proxies media to the client. Media can take longer to send than the
+// server's write timeout allows, so the deadline is lifted for this response.
+func (h *Handler) streamMedia(c *gin.Context, messageID uuid.UUID, mediaURL string) {
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	err := h.mediaFetcher.Stream(c.Writer, c.Request, mediaURL)
+	switch {
+	case err == nil:
+	case errors.Is(err, media.ErrHostNotAllowed):
+		h.respondWithError(c, http.StatusNotFound, "Media is not served by this server")
+	default:
+		logger.Error("Failed to stream media", err, map[string]interface{}{
+			"message_id": messageID,
+		})
+		h.respondWithError(c, http.StatusBadGateway, "Failed to fetch media")
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// @Summary Get conversation membership log
+// @Description Get the history of who joined, left or was removed from a conversation and of role changes, with who made each change and when. Without after, the latest changes come first; with after, the changes logged since that event come oldest first, so integrations can follow the log. Participants and administrators can read it.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param after query int false "Only changes logged after this event ID, oldest first"
+// @Param limit query int false "Number of changes to return (1-100)" default(50)
+// @Param offset query int false "Number of changes to skip" default(0)
+// @Success 200 {array} models.MembershipEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/membership-log [get]
+func (h *Handler) GetConversationMembershipLog(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil || after < 0 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid after. Must be an event ID")
+		return
+	}
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	user, _ := c.Get("user")
+	if current, ok := user.(*models.User); !ok || !current.IsAdmin {
+		if _, err := conversationService.GetParticipantRole(conversationID, userID); err != nil {
+			if errors.Is(err, models.ErrInvalidParticipant) {
+				h.respondWithError(c, http.StatusForbidden, "You don't have access to this conversation")
+				return
+			}
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check conversation access")
+			return
+		}
+	}
+
+	events, err := conversationService.GetMembershipLog(conversationID, after, page.Limit, page.Offset)
+	if err != nil {
+		logger.Error("Failed to get membership log", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get membership log")
+		return
+	}
+	setPageHeaders(c, page, len(events), -1)
+	// Followers of the log pass the last event back as after instead
+	if after > 0 && len(events) > 0 {
+		c.Header("X-Next-Cursor", strconv.FormatInt(events[len(events)-1].ID, 10))
+	}
+	h.respondWithSuccess(c, http.StatusOK, events)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MarkMentionsReadRequest picks the mentions to mark read: the given messages, or else
+// those in a conversation, or else all of them
+type MarkMentionsReadRequest struct {
+	ConversationID *uuid.UUID  `json:"conversation_id,omitempty"`
+	MessageIDs     []uuid.UUID `json:"message_ids,omitempty" binding:"max=100"`
+}
+
+// MentionsUnreadResponse is how many mentions of the user are unread
+type MentionsUnreadResponse struct {
+	UnreadCount int `json:"unread_count" example:"3"`
+}
+
+func (h *Handler) RegisterMentionRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetMentions)
+		r.GET("/unread", h.GetUnreadMentions)
+		r.POST("/read", h.MarkMentionsRead)
+	}
+}
+
+// @Summary List mentions
+// @Description List the messages the user was mentioned in with @username, newest first, across the conversations they take part in. Mentions are read separately from conversations: reading a conversation leaves its mentions unread until they are marked read.
+// @Tags messages
+// @Produce json
+// @Param unread query bool false "Only unread mentions"
+// @Param limit query int false "Number of mentions to return (1-100)" default(50)
+// @Param offset query int false "Number of mentions to skip" default(0)
+// @Success 200 {array} models.Mention
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /mentions [get]
+func (h *Handler) GetMentions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	unreadOnly, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid unread. Must be true or false")
+		return
+	}
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	mentions, err := models.NewMentionService(h.db, h.encryptor).List(userID, unreadOnly, page.Limit, page.Offset)
+	if err != nil {
+		logger.Error("Failed to get mentions", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get mentions")
+		return
+	}
+	setPageHeaders(c, page, len(mentions), -1)
+	h.respondWithSuccess(c, http.StatusOK, mentions)
+}
+
+// @Summary Count unread mentions
+// @Description Get how many mentions of the user are unread, for the badge of a mentions tab. It is separate from the conversations' unread counts.
+// @Tags messages
+// @Produce json
+// @Success 200 {object} MentionsUnreadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /mentions/unread [get]
+func (h *Handler) GetUnreadMentions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	count, err := models.NewMentionService(h.db, h.encryptor).UnreadCount(userID)
+	if err != nil {
+		logger.Error("Failed to count unread mentions", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to count unread mentions")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, MentionsUnreadResponse{UnreadCount: count})
+}
+
+// @Summary Mark mentions read
+// @Description Mark the user's mentions in the given messages read, or else those in a conversation, or else all of them
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param request body MarkMentionsReadRequest false "Mentions to mark read"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /mentions/read [post]
+func (h *Handler) MarkMentionsRead(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req MarkMentionsReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	marked, err := models.NewMentionService(h.db, h.encryptor).MarkRead(userID, req.ConversationID, req.MessageIDs)
+	if err != nil {
+		logger.Error("Failed to mark mentions read", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to mark mentions read")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"marked": marked})
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
-	"strconv"
+	"time"
 
+	"talkify/apps/api/internal/logger"
 	"talkify/apps/api/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 // CreateMessageRequest represents the request body for creating a message
@@ -22,6 +24,11 @@ type CreateMessageRequest struct {
 	MediaThumbnailURL *string            `json:"media_thumbnail_url" example:"https://example.com/thumbnail.jpg"`
 	MediaSize         *int               `json:"media_size" example:"1024"`
 	MediaDuration     *int               `json:"media_duration" example:"60"`
+	// ViewOnce media is hidden from message lists; each recipient can open it once
+	ViewOnce bool `json:"view_once" example:"false"`
+	// Card lays out a text message for clients that render cards; content is its
+	// fallback. Only applications can send cards.
+	Card *models.MessageCard `json:"card"`
 }
 
 type UpdateMessageRequest struct {
@@ -33,28 +40,44 @@ type BatchUpdateMessageStatusRequest struct {
 	Status     models.MessageStatus `json:"status" binding:"required,oneof=sending sent delivered read failed"`
 }
 
+// messageRelations can be left out of listed messages with ?include=
+var messageRelations = []string{"sender", "reactions", "reply_to", "annotations"}
+
 func (h *Handler) RegisterMessageRoutes(r *gin.RouterGroup) {
 	r.Use(h.AuthMiddleware())
 	{
 		r.POST("", h.CreateMessage)
 		r.GET("/conversation/:id", h.GetConversationMessages)
+		r.POST("/batch", h.BatchGetMessages)
+		r.GET("/:id/permalink", h.GetMessagePermalink)
+		r.GET("/:id/context", h.GetMessageContext)
 		r.PUT("/:id", h.UpdateMessage)
 		r.DELETE("/:id", h.DeleteMessage)
+		r.DELETE("/:id/pending", h.CancelPendingMessage)
+		r.POST("/:id/open", h.OpenViewOnceMessage)
 		r.POST("/:id/status", h.UpdateMessageStatus)
 		r.POST("/status/batch", h.BatchUpdateMessageStatus)
 		r.POST("/:id/reactions", h.AddMessageReaction)
 		r.DELETE("/:id/reactions/:emoji", h.RemoveMessageReaction)
+		r.POST("/:id/annotations", h.AnnotateMessage)
+		r.DELETE("/:id/annotations/:key", h.RemoveMessageAnnotation)
+		r.PUT("/:id/card", h.UpdateMessageCard)
 	}
 }
 
 // @Summary Create a new message
-// @Description Create a new message in a conversation
+// @Description Create a new message in a conversation. When the sender has an undo send window set, the message is held for that long and answered 202; DELETE /messages/{id}/pending cancels it meanwhile. Applications can lay out text messages with a card, whose buttons and select menus are answered by the application through POST /interactions; messages with cards are never held. Profanity is masked with asterisks, or the message refused with 422, as the conversation's content filter says; the filter's decision is kept among the message's annotations.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param message body CreateMessageRequest true "Message information"
 // @Success 201 {object} models.Message
+// @Success 202 {object} PendingMessageResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /messages [post]
@@ -75,6 +98,25 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		h.respondWithError(c, http.StatusBadRequest, "message_type or type is required")
 		return
 	}
+	if messageType == models.SystemMessage {
+		h.respondWithError(c, http.StatusBadRequest, "System messages cannot be sent by clients")
+		return
+	}
+
+	if req.ViewOnce {
+		if messageType != models.ImageMessage && messageType != models.VideoMessage && messageType != models.AudioMessage {
+			h.respondWithError(c, http.StatusBadRequest, "Only image, video and audio messages can be view-once")
+			return
+		}
+		if req.MediaURL == nil || *req.MediaURL == "" {
+			h.respondWithError(c, http.StatusBadRequest, "View-once messages need a media_url")
+			return
+		}
+	}
+
+	if req.Card != nil && !h.prepareAppCard(c, req.Card, messageType) {
+		return
+	}
 
 	senderID, err := uuid.Parse(c.GetHeader("X-User-ID"))
 	if err != nil {
@@ -85,8 +127,9 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 	// Check if user is a participant in the conversation with a valid role
 	var participantRole string
 	err = h.db.Get(&participantRole, `
-		SELECT role FROM conversation_participants
-			WHERE conversation_id = $1 AND user_id = $2
+		SELECT cp.role FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		WHERE cp.conversation_id = $1 AND cp.user_id = $2
 	`, req.ConversationID, senderID)
 	if err == sql.ErrNoRows {
 		h.respondWithError(c, http.StatusForbidden, "Not a participant in this conversation")
@@ -102,6 +145,29 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		h.respondWithError(c, http.StatusForbidden, "Invalid participant role")
 		return
 	}
+	if !h.requirePermission(c, req.ConversationID, senderID, models.ActionSend) {
+		return
+	}
+	if req.ReplyToID != nil && !h.requirePermission(c, req.ConversationID, senderID, models.ActionReply) {
+		return
+	}
+
+	// Enforce storage and message quotas before accepting the message
+	var mediaSize int64
+	if req.MediaSize != nil {
+		mediaSize = int64(*req.MediaSize)
+	}
+	if err := h.quotaService().CheckMessage(senderID, mediaSize); err != nil {
+		switch {
+		case errors.Is(err, models.ErrMediaTooLarge):
+			h.respondWithError(c, http.StatusRequestEntityTooLarge, "Media exceeds the maximum allowed size")
+		case errors.Is(err, models.ErrQuotaExceeded):
+			h.respondWithError(c, http.StatusPaymentRequired, "Quota exceeded")
+		default:
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check quota")
+		}
+		return
+	}
 
 	messageService := models.NewMessageService(h.db, h.encryptor)
 	message := &models.Message{
@@ -114,12 +180,28 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		MediaThumbnailURL: req.MediaThumbnailURL,
 		MediaSize:         req.MediaSize,
 		MediaDuration:     req.MediaDuration,
+		ViewOnce:          req.ViewOnce,
+		Card:              req.Card,
+	}
+	if !h.applyContentFilter(c, message) {
+		return
+	}
+	content := message.Content
+
+	// Cards come from applications, which have no use for undo send
+	if user, ok := c.Get("user"); ok && req.Card == nil {
+		if sender, ok := user.(*models.User); ok && sender.UndoSendSeconds > 0 {
+			h.holdMessage(c, message, time.Duration(sender.UndoSendSeconds)*time.Second)
+			return
+		}
 	}
 
 	if err := messageService.Create(message); err != nil {
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to create message")
 		return
 	}
+	h.metrics.RecordMessage(message.ConversationID.String())
+	h.messageCreated(message, content)
 
 	h.respondWithSuccess(c, http.StatusCreated, message)
 }
@@ -132,6 +214,10 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 // @Param id path string true "Conversation ID"
 // @Param limit query int false "Number of messages to return (default: 50)"
 // @Param offset query int false "Number of messages to skip (default: 0)"
+// @Param fields query string false "Comma-separated fields of each message to return, e.g. id,content,created_at"
+// @Param include query string false "Comma-separated relations to embed: sender, reactions, reply_to, annotations"
+// @Param compact query bool false "Return CompactMessage objects, with reaction and read counts instead of the details; defaults to true when the Save-Data: on header is sent"
+// @Param display_hints query bool false "Add display to each message: whether it was sent today and on which local day and time, in the user's timezone"
 // @Success 200 {array} models.Message
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -154,8 +240,9 @@ func (h *Handler) GetConversationMessages(c *gin.Context) {
 	var isParticipant bool
 	err = h.db.Get(&isParticipant, `
 		SELECT EXISTS(
-			SELECT 1 FROM conversation_participants
-			WHERE conversation_id = $1 AND user_id = $2
+			SELECT 1 FROM conversation_participants cp
+			JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+			WHERE cp.conversation_id = $1 AND cp.user_id = $2
 		)
 	`, conversationID, userID)
 	if err != nil {
@@ -167,31 +254,47 @@ func (h *Handler) GetConversationMessages(c *gin.Context) {
 		return
 	}
 
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-
-	// Validate pagination parameters
-	if limit < 1 || limit > 100 {
-		h.respondWithError(c, http.StatusBadRequest, "Invalid limit. Must be between 1 and 100")
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+	selection, ok := h.selectFields(c, messageRelations)
+	if !ok {
+		return
+	}
+	compact, ok := h.wantsCompact(c)
+	if !ok {
+		return
+	}
+	if compact && c.Query("include") != "" {
+		h.respondWithError(c, http.StatusBadRequest, "Compact messages embed no relations, so include can't be used with them")
 		return
 	}
-	if offset < 0 {
-		h.respondWithError(c, http.StatusBadRequest, "Invalid offset. Must be non-negative")
+	timezone, ok := h.displayTimezone(c, userID)
+	if !ok {
 		return
 	}
 
 	messageService := models.NewMessageService(h.db, h.encryptor)
-	messages, err := messageService.GetConversationMessages(conversationID, limit, offset)
+	messages, err := messageService.GetConversationMessages(conversationID, userID, page.Limit, page.Offset)
 	if err != nil {
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to get messages")
 		return
 	}
+	setPageHeaders(c, page, len(messages), -1)
+	if timezone != "" {
+		addMessageHints(messages, timezone)
+	}
 
-	h.respondWithSuccess(c, http.StatusOK, messages)
+	if compact {
+		h.respondWithSelection(c, http.StatusOK, selection, compactMessages(messages))
+		return
+	}
+	h.respondWithSelection(c, http.StatusOK, selection, messages)
 }
 
 // @Summary Update message
-// @Description Update the content of an existing message
+// @Description Update the content of an existing message. The conversation's content filter applies as it does to new messages. Participants connected over WebSocket receive a message.updated event.
 // @Tags messages
 // @Accept json
 // @Produce json
@@ -199,6 +302,8 @@ func (h *Handler) GetConversationMessages(c *gin.Context) {
 // @Param message body UpdateMessageRequest true "Updated message content"
 // @Success 200 {object} models.Message
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /messages/{id} [put]
@@ -221,29 +326,67 @@ func (h *Handler) UpdateMessage(c *gin.Context) {
 		return
 	}
 
+	// The conversation's content filter applies to the new content
+	var conversationID uuid.UUID
+	err = h.db.Get(&conversationID, `
+		SELECT conversation_id FROM messages WHERE id = $1 AND sender_id = $2 AND NOT is_deleted
+	`, messageID, userID)
+	if err == sql.ErrNoRows {
+		h.respondWithError(c, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to update message")
+		return
+	}
+
 	messageService := models.NewMessageService(h.db, h.encryptor)
 	message := &models.Message{
-		ID:       messageID,
-		SenderID: userID,
-		Content:  req.Content,
+		ID:             messageID,
+		ConversationID: conversationID,
+		SenderID:       userID,
+		Content:        req.Content,
+	}
+	if !h.applyContentFilter(c, message) {
+		return
 	}
+	filtered := len(message.Annotations) > 0
 
 	if err := messageService.Update(message); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Message not found")
+			return
+		}
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to update message")
 		return
 	}
+	if !filtered {
+		// What the filter did to the earlier content no longer holds
+		if _, err := messageService.RemoveAnnotation(messageID, nil, contentFilterSource, contentFilterKey); err != nil && !errors.Is(err, models.ErrNotFound) {
+			logger.Error("Failed to remove content filter decision", err, map[string]interface{}{
+				"message_id": messageID,
+			})
+		}
+	}
+
+	// Return the message as other clients will see it; fall back to what was saved
+	if updated, err := messageService.GetByID(messageID); err == nil {
+		message = updated
+	}
 
+	h.publishToConversation(message.ConversationID, EventMessageUpdated, message)
 	h.respondWithSuccess(c, http.StatusOK, message)
 }
 
 // @Summary Delete message
-// @Description Soft delete a message
+// @Description Soft delete a message. Participants connected over WebSocket receive a message.deleted event.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param id path string true "Message ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /messages/{id} [delete]
@@ -261,11 +404,22 @@ func (h *Handler) DeleteMessage(c *gin.Context) {
 	}
 
 	messageService := models.NewMessageService(h.db, h.encryptor)
-	if err := messageService.Delete(messageID, userID); err != nil {
+	conversationID, err := messageService.Delete(messageID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Message not found")
+			return
+		}
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to delete message")
 		return
 	}
 
+	h.publishToConversation(conversationID, EventMessageDeleted, MessageDeletedEvent{
+		MessageID:      messageID,
+		ConversationID: conversationID,
+		DeletedAt:      time.Now().UTC(),
+	})
+
 	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Message deleted successfully"})
 }
 
@@ -355,6 +509,8 @@ func (h *Handler) BatchUpdateMessageStatus(c *gin.Context) {
 // @Param reaction body AddReactionRequest true "Reaction information"
 // @Success 201 {object} MessageReaction
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /messages/{id}/reactions [post]
@@ -379,6 +535,10 @@ func (h *Handler) AddMessageReaction(c *gin.Context) {
 		return
 	}
 
+	if !h.requireMessagePermission(c, messageID, userID, models.ActionReact) {
+		return
+	}
+
 	messageService := models.NewMessageService(h.db, h.encryptor)
 	err = messageService.AddReaction(messageID, userID, req.Emoji)
 	if err != nil {
@@ -429,3 +589,68 @@ func (h *Handler) RemoveMessageReaction(c *gin.Context) {
 
 	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Reaction removed successfully"})
 }
+
+// @Summary Open a view-once message
+// @Description Stream the whole media of a view-once message. Each recipient can open it once; later attempts fail with 410. Range and conditional requests are not supported, and the media is not served any other way. The sender is notified with a message.opened event. Screenshots cannot be prevented.
+// @Tags messages
+// @Produce octet-stream
+// @Param id path string true "Message ID"
+// @Success 200 {file} binary
+// @Header 200 {string} X-Opened-At "When the message was opened"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/open [post]
+func (h *Handler) OpenViewOnceMessage(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	media, err := messageService.OpenViewOnce(messageID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Message not found")
+		case errors.Is(err, models.ErrNotViewOnce):
+			h.respondWithError(c, http.StatusBadRequest, "Message is not a view-once message")
+		case errors.Is(err, models.ErrAlreadyViewed):
+			h.respondWithError(c, http.StatusGone, "View-once message was already opened")
+		default:
+			logger.Error("Failed to open view-once message", err, map[string]interface{}{
+				"message_id": messageID,
+				"user_id":    userID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to open message")
+		}
+		return
+	}
+
+	if media.SenderID != userID {
+		h.publishToUsers([]uuid.UUID{media.SenderID}, EventMessageOpened, MessageOpenedEvent{
+			MessageID:      media.MessageID,
+			ConversationID: media.ConversationID,
+			UserID:         userID,
+			OpenedAt:       media.OpenedAt,
+		})
+	}
+
+	// The media is sent whole, once, and kept out of caches
+	for _, name := range []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"} {
+		c.Request.Header.Del(name)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Opened-At", media.OpenedAt.UTC().Format(time.RFC3339Nano))
+	h.streamMedia(c, messageID, media.MediaURL)
+}
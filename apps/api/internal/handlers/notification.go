@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// NotificationList is a page of a user's notification center
+type NotificationList struct {
+	Notifications []models.Notification `json:"notifications"`
+	UnreadCount   int                   `json:"unread_count"`
+}
+
+func (h *Handler) RegisterNotificationRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetNotifications)
+		r.POST("/read", h.MarkAllNotificationsRead)
+		r.POST("/:id/read", h.MarkNotificationRead)
+	}
+}
+
+// notify adds a notification to a user's notification center and pushes it to their
+// connected clients
+func (h *Handler) notify(userID uuid.UUID, notificationType, title, body string) error {
+	notificationService := models.NewNotificationService(h.db)
+	notification, err := notificationService.Create(userID, notificationType, title, body)
+	if err != nil {
+		return err
+	}
+	h.publishToUsers([]uuid.UUID{userID}, EventNotificationCreated, notification)
+	return nil
+}
+
+// @Summary List notifications
+// @Description List the notifications in the user's notification center, newest first, with the number still unread
+// @Tags notifications
+// @Produce json
+// @Param unread query bool false "Only unread notifications" default(false)
+// @Param limit query int false "Number of notifications to return (1-100)" default(50)
+// @Param offset query int false "Number of notifications to skip" default(0)
+// @Success 200 {object} NotificationList
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notifications [get]
+func (h *Handler) GetNotifications(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	unreadOnly, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid unread. Must be true or false")
+		return
+	}
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	notificationService := models.NewNotificationService(h.db)
+	notifications, unread, err := notificationService.List(userID, unreadOnly, page.Limit, page.Offset)
+	if err != nil {
+		logger.Error("Failed to list notifications", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list notifications")
+		return
+	}
+	setPageHeaders(c, page, len(notifications), -1)
+	h.respondWithSuccess(c, http.StatusOK, NotificationList{Notifications: notifications, UnreadCount: unread})
+}
+
+// @Summary Mark a notification read
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Notification ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notifications/{id}/read [post]
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	notificationService := models.NewNotificationService(h.db)
+	if err := notificationService.MarkRead(userID, notificationID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Notification not found")
+			return
+		}
+		logger.Error("Failed to mark notification read", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to mark notification read")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"id": notificationID, "read": true})
+}
+
+// @Summary Mark all notifications read
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notifications/read [post]
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	notificationService := models.NewNotificationService(h.db)
+	marked, err := notificationService.MarkAllRead(userID)
+	if err != nil {
+		logger.Error("Failed to mark notifications read", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to mark notifications read")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"marked": marked})
+}
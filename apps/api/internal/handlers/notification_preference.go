@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/sms"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SetNotificationPreferencesRequest replaces how the user is notified of messages and
+// calls
+type SetNotificationPreferencesRequest struct {
+	// Routes maps dm, mention, group_message and call to the channels they go out on:
+	// push, email and sms, or ["none"]. Events left out keep their defaults.
+	Routes map[string][]string `json:"routes"`
+	// QuietHours maps channels to when they stay quiet each day
+	QuietHours map[string]models.QuietHours `json:"quiet_hours"`
+	// Preview is how much of a message notifications show: full, sender or generic.
+	// It defaults to sender.
+	Preview string `json:"preview" example:"sender"`
+}
+
+// SetNotificationPreviewRequest sets how much of a conversation's messages
+// notifications show
+type SetNotificationPreviewRequest struct {
+	// Preview is full, sender or generic, or default for the user's default preview
+	Preview string `json:"preview" binding:"required,oneof=full sender generic default" example:"generic"`
+}
+
+// previewDefault resets a conversation to the user's default preview
+const previewDefault = "default"
+
+// notificationEvents tells what a routed notification is about
+var notificationEvents = map[string]string{
+	models.NotifyDirectMessage: models.NotificationDirectMessage,
+	models.NotifyMention:       models.NotificationMention,
+	models.NotifyGroupMessage:  models.NotificationGroupMessage,
+}
+
+// SetSMSSender sets where notification text messages are sent through
+func (h *Handler) SetSMSSender(sender *sms.Sender) {
+	h.texter = sender
+}
+
+// @Summary Get notification preferences
+// @Description Get which channels direct messages, mentions, group messages and calls are sent out on, when each channel stays quiet, and how much of a message notifications show. Events the user hasn't routed show their defaults: push for everything but group messages. min_preview is the most revealing preview the server allows.
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/notification-preferences [get]
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	preferences, err := models.NewNotificationService(h.db).GetPreferences(userID)
+	if err != nil {
+		logger.Error("Failed to get notification preferences", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get notification preferences")
+		return
+	}
+	preferences.MinPreview = h.live.Runtime().MinNotificationPreview
+	h.respondWithSuccess(c, http.StatusOK, preferences)
+}
+
+// @Summary Set notification preferences
+// @Description Replace which channels direct messages, mentions, group messages and calls are sent out on, the daily quiet hours of each channel, and the preview of messages notifications show. Quiet hours are in the user's timezone, which is set with PATCH /users/me. A full preview shows the start of the message, sender only who sent it and where, and generic neither; it applies to every channel, and can be overridden per conversation. Previews more revealing than the server's min_preview are refused. Notifications wait a few seconds and are only sent if the message wasn't seen on a connected device meanwhile; channels in their quiet hours are skipped. Push adds the notification to the notification center, email goes to the account's address and sms to its phone number.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param preferences body SetNotificationPreferencesRequest true "Routes and quiet hours"
+// @Success 200 {object} models.NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/notification-preferences [put]
+func (h *Handler) SetNotificationPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req SetNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	minPreview := h.live.Runtime().MinNotificationPreview
+	if req.Preview != "" && !h.previewAllowed(c, req.Preview, minPreview) {
+		return
+	}
+
+	preferences, err := models.NewNotificationService(h.db).SetPreferences(userID, &models.NotificationPreferences{
+		Routes:     req.Routes,
+		QuietHours: req.QuietHours,
+		Preview:    req.Preview,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			h.respondWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Error("Failed to set notification preferences", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set notification preferences")
+		return
+	}
+	preferences.MinPreview = minPreview
+	h.respondWithSuccess(c, http.StatusOK, preferences)
+}
+
+// @Summary Set a conversation's notification preview
+// @Description Set how much of the conversation's messages the user's notifications show, overriding their default preview: full shows the start of the message, sender only who sent it and where, and generic neither. default goes back to the user's default. Previews more revealing than the server allows are refused. The user's devices get a conversations.state_changed event.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param preview body SetNotificationPreviewRequest true "Preview"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/notification-preview [put]
+func (h *Handler) SetConversationNotificationPreview(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	var req SetNotificationPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	var preview *string
+	if req.Preview != previewDefault {
+		if !h.previewAllowed(c, req.Preview, h.live.Runtime().MinNotificationPreview) {
+			return
+		}
+		preview = &req.Preview
+	}
+	err = models.NewConversationService(h.db, h.encryptor).SetNotificationPreview(conversationID, userID, preview)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidParticipant):
+			h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		case errors.Is(err, models.ErrInvalidInput):
+			h.respondWithError(c, http.StatusBadRequest, err.Error())
+		default:
+			logger.Error("Failed to set notification preview", err, map[string]interface{}{
+				"user_id":         userID,
+				"conversation_id": conversationID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to set notification preview")
+		}
+		return
+	}
+
+	h.publishToUsers([]uuid.UUID{userID}, EventConversationsChanged, ConversationsStateEvent{
+		ConversationIDs:     []uuid.UUID{conversationID},
+		NotificationPreview: &req.Preview,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"conversation_id":      conversationID,
+		"notification_preview": req.Preview,
+	})
+}
+
+// previewAllowed answers 400 and returns false for a preview more revealing than the
+// server allows
+func (h *Handler) previewAllowed(c *gin.Context, preview, minPreview string) bool {
+	if models.StricterPreview(preview, minPreview) == preview {
+		return true
+	}
+	h.respondWithError(c, http.StatusBadRequest,
+		fmt.Sprintf("Notification previews can't be more revealing than %s on this server", minPreview))
+	return false
+}
+
+// notifyMessage routes the notification of a new message to its recipients: a mention to
+// those it mentions, and otherwise a direct or group message. It waits out the notify
+// grace first, so recipients who see the message on a connected device meanwhile aren't
+// notified. Only the message's IDs are kept meanwhile; recipients with a full preview get
+// the message as it is once the grace is over.
+func (h *Handler) notifyMessage(message *models.Message) {
+	if message.MessageType == string(models.SystemMessage) {
+		return
+	}
+	message = &models.Message{ID: message.ID, ConversationID: message.ConversationID, SenderID: message.SenderID}
+	time.AfterFunc(h.cfg.Delivery.NotifyGrace, func() {
+		h.submitTask("notify_message", func() error {
+			return h.sendMessageNotifications(message)
+		})
+	})
+}
+
+// messageNotice is the title and body of a message notification
+type messageNotice struct {
+	Title string
+	Body  string
+}
+
+// notificationSnippetLength is how many characters of a message full previews show
+const notificationSnippetLength = 100
+
+// sendMessageNotifications sends the notifications of a new message, once its notify
+// grace is over. Each recipient gets the preview they picked, made no more revealing
+// than the server's minimum.
+func (h *Handler) sendMessageNotifications(message *models.Message) error {
+	notificationService := models.NewNotificationService(h.db)
+	recipients, err := notificationService.Recipients(message)
+	if err != nil || len(recipients) == 0 {
+		return err
+	}
+
+	var source struct {
+		Username string  `db:"username"`
+		Type     string  `db:"type"`
+		Name     *string `db:"name"`
+		models.GroupNameSource
+	}
+	err = h.db.Get(&source, `
+		SELECT u.username, c.type, c.name,
+			COALESCE(s.name_sample, '[]') AS name_sample, COALESCE(s.participant_count, 0) AS participant_count
+		FROM users u, conversations c
+		LEFT JOIN conversation_summaries s ON s.conversation_id = c.id
+		WHERE u.id = $1 AND c.id = $2
+	`, message.SenderID, message.ConversationID)
+	if err != nil {
+		return err
+	}
+	where := "a group"
+	if source.Name != nil && *source.Name != "" {
+		where = *source.Name
+	} else if source.Type == "group" {
+		where = h.groupName(uuid.Nil, &source.GroupNameSource)
+	}
+
+	type audience struct{ event, preview string }
+	minPreview := h.live.Runtime().MinNotificationPreview
+	byAudience := make(map[audience][]uuid.UUID)
+	for _, recipient := range recipients {
+		event := models.NotifyGroupMessage
+		switch {
+		case recipient.Mentioned:
+			event = models.NotifyMention
+		case source.Type == "direct":
+			event = models.NotifyDirectMessage
+		}
+		a := audience{event, models.StricterPreview(recipient.Preview, minPreview)}
+		byAudience[a] = append(byAudience[a], recipient.UserID)
+	}
+
+	// The message is only loaded for full previews, and those fall back to the sender
+	// preview if it was deleted meanwhile
+	var snippet *string
+	for a := range byAudience {
+		if a.preview == models.PreviewFull {
+			current, err := models.NewMessageService(h.db, h.encryptor).GetByID(message.ID)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == nil {
+				text := notificationSnippet(current)
+				snippet = &text
+			}
+			break
+		}
+	}
+
+	for a, userIDs := range byAudience {
+		stored := messageNotice{Title: "New message", Body: "Open Talkify to read it"}
+		if a.preview != models.PreviewGeneric {
+			switch a.event {
+			case models.NotifyMention:
+				stored = messageNotice{fmt.Sprintf("@%s mentioned you", source.Username), fmt.Sprintf("in %s", where)}
+			case models.NotifyDirectMessage:
+				stored = messageNotice{fmt.Sprintf("New message from @%s", source.Username), "Open Talkify to read it"}
+			default:
+				stored = messageNotice{fmt.Sprintf("New message in %s", where), fmt.Sprintf("@%s sent a message", source.Username)}
+			}
+		}
+		notice := stored
+		if a.preview == models.PreviewFull && snippet != nil {
+			switch a.event {
+			case models.NotifyMention:
+				notice = messageNotice{fmt.Sprintf("@%s mentioned you in %s", source.Username, where), *snippet}
+			case models.NotifyDirectMessage:
+				notice = messageNotice{"@" + source.Username, *snippet}
+			default:
+				notice = messageNotice{fmt.Sprintf("@%s in %s", source.Username, where), *snippet}
+			}
+		}
+		if err := h.routeNotification(userIDs, a.event, message, notice, stored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notificationSnippet is what a full preview shows of a message: the start of its text,
+// or what kind of media it is. View-once media never shows its caption.
+func notificationSnippet(message *models.Message) string {
+	text := strings.TrimSpace(message.Content)
+	if message.ViewOnce {
+		text = ""
+	}
+	if text == "" {
+		switch models.MessageType(message.MessageType) {
+		case models.ImageMessage:
+			return "Sent a photo"
+		case models.VideoMessage:
+			return "Sent a video"
+		case models.AudioMessage:
+			return "Sent a voice message"
+		case models.FileMessage:
+			return "Sent a file"
+		case models.LocationMessage:
+			return "Shared a location"
+		default:
+			return "Sent a message"
+		}
+	}
+	if runes := []rune(text); len(runes) > notificationSnippetLength {
+		return strings.TrimSpace(string(runes[:notificationSnippetLength-1])) + "…"
+	}
+	return text
+}
+
+// routeNotification sends the notification of an event about a message to users on the
+// channels each of them routed it to, leaving out channels in their quiet hours. Users
+// who saw the message on a connected device are left out, and the delivery ledger keeps
+// the message from being sent twice on a channel. Push adds stored to their notification
+// center and pushes notice to their clients; email and sms send notice. The notification
+// center only keeps stored, so that message content isn't kept outside the encrypted
+// messages. It is for callers already running in the background.
+func (h *Handler) routeNotification(userIDs []uuid.UUID, event string, message *models.Message, notice, stored messageNotice) error {
+	notificationService := models.NewNotificationService(h.db)
+	preferences, err := notificationService.GetPreferencesForUsers(userIDs)
+	if err != nil {
+		return err
+	}
+
+	// A message seen on another device needs no notification
+	seen, err := notificationService.SeenBy(message.ID, userIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	routes := make(map[string][]uuid.UUID)
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		for _, channel := range preferences[userID].Channels(event, now) {
+			routes[channel] = append(routes[channel], userID)
+		}
+	}
+	// The ledger keeps a message from going out twice on a channel
+	for channel, routed := range routes {
+		if routes[channel], err = notificationService.ClaimDeliveries(message.ID, channel, routed); err != nil {
+			return err
+		}
+	}
+
+	for _, userID := range routes[models.ChannelPush] {
+		notification, err := notificationService.CreateMessageNotification(userID, notificationEvents[event], message, stored.Title, stored.Body)
+		if err != nil {
+			return err
+		}
+		notification.Title, notification.Body = notice.Title, notice.Body
+		h.publishToUsers([]uuid.UUID{userID}, EventNotificationCreated, notification)
+	}
+
+	external := append(append([]uuid.UUID{}, routes[models.ChannelEmail]...), routes[models.ChannelSMS]...)
+	if len(external) == 0 {
+		return nil
+	}
+	users, err := models.NewUserService(h.db, h.encryptor).GetByIDs(external)
+	if err != nil {
+		return err
+	}
+	contacts := make(map[uuid.UUID]models.User, len(users))
+	for _, user := range users {
+		contacts[user.ID] = user
+	}
+	for _, userID := range routes[models.ChannelEmail] {
+		if h.mailer == nil || contacts[userID].Email == "" {
+			continue
+		}
+		if err := h.mailer.Send(contacts[userID].Email, notice.Title, notice.Body+"\n"); err != nil {
+			logger.Error("Failed to email notification", err, map[string]interface{}{
+				"user_id": userID,
+				"event":   event,
+			})
+		}
+	}
+	for _, userID := range routes[models.ChannelSMS] {
+		if h.texter == nil || contacts[userID].Phone == "" {
+			continue
+		}
+		if err := h.texter.Send(contacts[userID].Phone, notice.Title+": "+notice.Body); err != nil {
+			logger.Error("Failed to text notification", err, map[string]interface{}{
+				"user_id": userID,
+				"event":   event,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type AuthorizeRequest struct {
+	ClientID    string `json:"client_id" binding:"required"`
+	RedirectURI string `json:"redirect_uri" binding:"required"`
+	Scope       string `json:"scope" binding:"required" example:"read:messages read:profile"`
+	State       string `json:"state"`
+	Approve     bool   `json:"approve"`
+}
+
+// TokenRequest exchanges an authorization code for a token acting for the user who
+// approved it, or with the client_credentials grant, gets a bot token for the apps
+// installed in groups. Code and redirect_uri are only sent with authorization codes.
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type" binding:"required,oneof=authorization_code client_credentials"`
+	Code         string `json:"code" form:"code" binding:"required_if=GrantType authorization_code"`
+	ClientID     string `json:"client_id" form:"client_id" binding:"required"`
+	ClientSecret string `json:"client_secret" form:"client_secret" binding:"required"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri" binding:"required_if=GrantType authorization_code"`
+}
+
+func (h *Handler) RegisterAppRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.POST("", h.CreateApplication)
+		r.GET("", h.GetApplications)
+		r.DELETE("/:id", h.RevokeApplication)
+	}
+}
+
+func (h *Handler) RegisterOAuthRoutes(r *gin.RouterGroup) {
+	// The token endpoint authenticates with client credentials rather than a user token
+	r.POST("/token", h.ExchangeOAuthToken)
+
+	authorized := r.Group("", h.AuthMiddleware())
+	{
+		authorized.GET("/authorize", h.GetAuthorization)
+		authorized.POST("/authorize", h.Authorize)
+		authorized.GET("/grants", h.GetOAuthGrants)
+		authorized.DELETE("/grants/:client_id", h.RevokeOAuthGrant)
+	}
+}
+
+// @Summary Register a third-party application
+// @Description Register an application that can request scoped access on behalf of users. The client secret is only returned once.
+// @Tags apps
+// @Accept json
+// @Produce json
+// @Param application body models.CreateApplicationInput true "Application information"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /apps [post]
+func (h *Handler) CreateApplication(c *gin.Context) {
+	var input models.CreateApplicationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !auth.IsValidScope(scope) {
+			h.respondWithError(c, http.StatusBadRequest, "Unknown scope: "+scope)
+			return
+		}
+	}
+
+	ownerID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	app, secret, err := oauthService.CreateApplication(ownerID, &input)
+	if err != nil {
+		if errors.Is(err, models.ErrApplicationLimit) {
+			h.respondWithError(c, http.StatusTooManyRequests, "Application limit reached")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create application")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusCreated, gin.H{
+		"application":   app,
+		"client_secret": secret,
+	})
+}
+
+// @Summary List registered applications
+// @Description List the third-party applications registered by the authenticated user
+// @Tags apps
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.OAuthApplication
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /apps [get]
+func (h *Handler) GetApplications(c *gin.Context) {
+	ownerID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	apps, err := oauthService.GetUserApplications(ownerID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get applications")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, apps)
+}
+
+// @Summary Revoke an application
+// @Description Revoke a registered application. All tokens issued to it stop working immediately.
+// @Tags apps
+// @Accept json
+// @Produce json
+// @Param id path string true "Application ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /apps/{id} [delete]
+func (h *Handler) RevokeApplication(c *gin.Context) {
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid application ID")
+		return
+	}
+
+	ownerID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	clientID, err := oauthService.RevokeApplication(applicationID, ownerID)
+	if err != nil {
+		if errors.Is(err, models.ErrApplicationNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Application not found")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to revoke application")
+		return
+	}
+	// Open connections outlive the checks made when they were opened
+	h.hub.endApplication(applicationID, clientID, "")
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Application revoked successfully"})
+}
+
+// @Summary Get authorization request details
+// @Description Validate an authorization request and return the details the consent screen needs to display
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Redirect URI"
+// @Param scope query string true "Space separated scopes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /oauth/authorize [get]
+func (h *Handler) GetAuthorization(c *gin.Context) {
+	app, scopes, ok := h.validateAuthorizationRequest(c, c.Query("client_id"), c.Query("redirect_uri"), c.Query("scope"))
+	if !ok {
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"application": gin.H{
+			"name":      app.Name,
+			"client_id": app.ClientID,
+		},
+		"redirect_uri": c.Query("redirect_uri"),
+		"scopes":       scopes,
+	})
+}
+
+// @Summary Approve or deny an authorization request
+// @Description Record the user's consent decision and return the redirect URL carrying either an authorization code or an access_denied error
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param request body AuthorizeRequest true "Consent decision"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /oauth/authorize [post]
+func (h *Handler) Authorize(c *gin.Context) {
+	var req AuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app, scopes, ok := h.validateAuthorizationRequest(c, req.ClientID, req.RedirectURI, req.Scope)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid redirect URI")
+		return
+	}
+	query := redirect.Query()
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		query.Set("error", "access_denied")
+		redirect.RawQuery = query.Encode()
+		h.respondWithSuccess(c, http.StatusOK, gin.H{"redirect_url": redirect.String()})
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	code, err := oauthService.Authorize(app, userID, req.RedirectURI, scopes)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to authorize application")
+		return
+	}
+
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"redirect_url": redirect.String()})
+}
+
+// @Summary Exchange an authorization code for an access token
+// @Description Authenticate with client credentials and exchange a single-use authorization code for a scoped access token. With grant_type client_credentials, get a bot token instead: it connects to the WebSocket as the application and receives the events of the groups it is installed in with read:messages.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param request body TokenRequest true "Token request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /oauth/token [post]
+func (h *Handler) ExchangeOAuthToken(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.GrantType == "client_credentials" {
+		h.issueBotToken(c, &req)
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	userID, scopes, err := oauthService.ExchangeCode(req.ClientID, req.ClientSecret, req.Code, req.RedirectURI)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidClient):
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid client credentials")
+		case errors.Is(err, models.ErrInvalidGrant):
+			h.respondWithError(c, http.StatusBadRequest, "Authorization code is invalid or expired")
+		default:
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to exchange authorization code")
+		}
+		return
+	}
+
+	token, err := h.tokenManager.GenerateAppToken(userID, req.ClientID, scopes)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.AppTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// issueBotToken answers the client_credentials grant with a token for the application itself
+func (h *Handler) issueBotToken(c *gin.Context, req *TokenRequest) {
+	app, err := models.NewOAuthService(h.db).AuthenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidClient) {
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid client credentials")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to authenticate client")
+		return
+	}
+
+	token, err := h.tokenManager.GenerateBotToken(app.ID, app.Scopes, auth.AppTokenTTL)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.AppTokenTTL.Seconds()),
+		"scope":        strings.Join(app.Scopes, " "),
+	})
+}
+
+// @Summary List authorized applications
+// @Description List the applications the authenticated user has granted access to
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.OAuthGrant
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /oauth/grants [get]
+func (h *Handler) GetOAuthGrants(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	grants, err := oauthService.GetUserGrants(userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get grants")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, grants)
+}
+
+// @Summary Revoke application access
+// @Description Withdraw the authenticated user's consent for an application
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /oauth/grants/{client_id} [delete]
+func (h *Handler) RevokeOAuthGrant(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	if err := oauthService.RevokeGrant(c.Param("client_id"), userID); err != nil {
+		if errors.Is(err, models.ErrConsentRequired) {
+			h.respondWithError(c, http.StatusNotFound, "Grant not found")
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to revoke grant")
+		return
+	}
+	h.hub.endApplication(uuid.Nil, c.Param("client_id"), userID.String())
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Access revoked successfully"})
+}
+
+// validateAuthorizationRequest resolves the application and scopes of an authorization
+// request, writing an error response and returning false when it is invalid.
+func (h *Handler) validateAuthorizationRequest(c *gin.Context, clientID, redirectURI, rawScope string) (*models.OAuthApplication, []string, bool) {
+	scopes, err := auth.ParseScopes(rawScope)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+
+	oauthService := models.NewOAuthService(h.db)
+	app, err := oauthService.GetApplicationByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, models.ErrApplicationNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Application not found")
+			return nil, nil, false
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get application")
+		return nil, nil, false
+	}
+
+	if err := oauthService.ValidateAuthorizationRequest(app, redirectURI, scopes); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+
+	return app, scopes, true
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// releaseBatch is how many held messages a job run releases
+const releaseBatch = 100
+
+// PendingMessageResponse is a message held for the sender's undo send window. It is
+// sent with the same ID at release_at, unless cancelled before.
+type PendingMessageResponse struct {
+	*models.Message
+	Pending   bool      `json:"pending" example:"true"`
+	ReleaseAt time.Time `json:"release_at"`
+}
+
+// holdMessage keeps a new message for the sender's undo send window instead of sending it
+func (h *Handler) holdMessage(c *gin.Context, message *models.Message, window time.Duration) {
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	pending, err := messageService.Hold(message, window)
+	if err != nil {
+		logger.Error("Failed to hold message", err, map[string]interface{}{
+			"conversation_id": message.ConversationID,
+			"sender_id":       message.SenderID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create message")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusAccepted, PendingMessageResponse{
+		Message:   message,
+		Pending:   true,
+		ReleaseAt: pending.ReleaseAt,
+	})
+}
+
+// @Summary Undo sending a message
+// @Description Cancel a message held for the sender's undo send window, before it reaches the other participants. Messages already sent answer 404; delete those instead.
+// @Tags messages
+// @Produce json
+// @Param id path string true "Message ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/pending [delete]
+func (h *Handler) CancelPendingMessage(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	if _, err := messageService.CancelPending(messageID, userID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "No pending message; it may have been sent already")
+			return
+		}
+		logger.Error("Failed to cancel pending message", err, map[string]interface{}{
+			"message_id": messageID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to cancel message")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Message cancelled"})
+}
+
+// ReleaseHeldMessages sends the messages whose undo send window has ended
+func (h *Handler) ReleaseHeldMessages() error {
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	released, err := messageService.ReleaseDue(releaseBatch, h.refilterMessage)
+	for i := range released {
+		message := &released[i]
+		h.metrics.RecordMessage(message.ConversationID.String())
+		h.publishToConversation(message.ConversationID, EventNewMessage, message)
+		h.messageCreated(message, message.Content)
+	}
+	return err
+}
+
+// refilterMessage runs the content filter over a held message again on release, in case
+// the conversation's filter changed during the undo send window. Its decision replaces
+// the one made when the message was held.
+func (h *Handler) refilterMessage(message *models.Message) error {
+	content, annotation, err := h.filterContent(message.ConversationID, message.Content)
+	if err != nil {
+		return err
+	}
+	message.Content = content
+	if annotation == nil {
+		return nil
+	}
+	for i, existing := range message.Annotations {
+		if existing.Source == contentFilterSource && existing.Key == contentFilterKey {
+			message.Annotations[i] = *annotation
+			return nil
+		}
+	}
+	message.Annotations = append(message.Annotations, *annotation)
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageParams are the limit and offset of a list request
+type pageParams struct {
+	Limit  int
+	Offset int
+}
+
+// parseLimit reads the limit of a list request, defaultLimit when it is absent. A limit
+// above max, or above the configured maximum, is lowered to it rather than refused;
+// the limit applied is sent back in X-Page-Limit. It answers 400 for a limit that isn't
+// a positive number.
+func (h *Handler) parseLimit(c *gin.Context, defaultLimit, max int) (int, bool) {
+	if h.cfg.Pagination.MaxLimit > 0 && max > h.cfg.Pagination.MaxLimit {
+		max = h.cfg.Pagination.MaxLimit
+	}
+	limit := defaultLimit
+	if value, ok := c.GetQuery("limit"); ok {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid limit. Must be a positive number")
+			return 0, false
+		}
+	}
+	if limit > max {
+		limit = max
+	}
+	c.Header("X-Page-Limit", strconv.Itoa(limit))
+	return limit, true
+}
+
+// parsePage reads the limit and offset of a list request; see parseLimit. It answers
+// 400 for a negative offset.
+func (h *Handler) parsePage(c *gin.Context, defaultLimit, max int) (pageParams, bool) {
+	limit, ok := h.parseLimit(c, defaultLimit, max)
+	if !ok {
+		return pageParams{}, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid offset. Must be non-negative")
+		return pageParams{}, false
+	}
+	c.Set(pageOffsetKey, offset)
+	return pageParams{Limit: limit, Offset: offset}, true
+}
+
+// setPageHeaders tells the client where the next page starts. X-Total-Count is sent
+// when the total is known, which it isn't when negative, and X-Next-Offset when more
+// may follow: with a total, while it isn't reached, and otherwise after a full page.
+func setPageHeaders(c *gin.Context, page pageParams, returned, total int) {
+	more := returned == page.Limit
+	if total >= 0 {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		more = page.Offset+returned < total
+	}
+	if more {
+		c.Header("X-Next-Offset", strconv.Itoa(page.Offset+returned))
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/password"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ReasonPasswordChangeRequired is given with 403 responses to users an administrator
+// asked to choose a new password; only passwordChangeRoutes stay open to them
+const ReasonPasswordChangeRequired = "password_change_required"
+
+// passwordChangeRoutes are what users who must choose a new password can still reach
+var passwordChangeRoutes = map[string]bool{
+	"GET /api/users/me":          true,
+	"PUT /api/users/me/password": true,
+}
+
+// PasswordPolicyResponse is what new passwords must meet, for clients to explain it
+type PasswordPolicyResponse struct {
+	MinLength     int  `json:"min_length" example:"8"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	// BreachCheck refuses passwords that appeared in known data breaches
+	BreachCheck bool `json:"breach_check"`
+}
+
+// SetPasswordRotationRequest makes a user choose a new password, or lifts that
+type SetPasswordRotationRequest struct {
+	Required *bool `json:"required" binding:"required" example:"true"`
+}
+
+// newPasswordChecker builds the checker for the configured password policy
+func newPasswordChecker(cfg *config.PasswordConfig) *password.Checker {
+	var breaches *password.BreachClient
+	if cfg.BreachCheck {
+		breaches = password.NewBreachClient(cfg.BreachURL, cfg.BreachTimeout)
+	}
+	return password.NewChecker(password.Policy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		Banned:        cfg.Banned,
+	}, breaches)
+}
+
+// checkNewPassword answers 400 with the rules a new password breaks, or when it
+// appeared in a data breach. personal values, such as the username, may not be part of
+// it. Breach lookups that fail let the password through.
+func (h *Handler) checkNewPassword(c *gin.Context, newPassword string, personal ...string) bool {
+	var problems []string
+	var policyErr *password.PolicyError
+	if err := h.passwords.Check(newPassword, personal...); errors.As(err, &policyErr) {
+		problems = policyErr.Problems
+	}
+
+	if len(problems) == 0 {
+		breached, err := h.passwords.Breached(c.Request.Context(), newPassword)
+		if err != nil {
+			logger.Warn("Skipped password breach check", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if breached {
+			problems = append(problems, "has appeared in a data breach")
+		}
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Password does not meet the password policy",
+			"problems": problems,
+		})
+		return false
+	}
+	return true
+}
+
+// CountPasswordHashes updates the metrics on stored password hashes, to follow how many
+// legacy bcrypt hashes are left to upgrade
+func (h *Handler) CountPasswordHashes() error {
+	counts, err := models.NewUserService(h.db, h.encryptor).CountPasswordHashes()
+	if err != nil {
+		return err
+	}
+	h.metrics.SetPasswordHashes(counts)
+	return nil
+}
+
+// @Summary Get the password policy
+// @Description Get the rules new passwords must meet, at registration, password changes and account recovery
+// @Tags auth
+// @Produce json
+// @Success 200 {object} PasswordPolicyResponse
+// @Router /auth/password-policy [get]
+func (h *Handler) GetPasswordPolicy(c *gin.Context) {
+	policy := h.cfg.Password
+	h.respondWithSuccess(c, http.StatusOK, PasswordPolicyResponse{
+		MinLength:     policy.MinLength,
+		RequireUpper:  policy.RequireUpper,
+		RequireLower:  policy.RequireLower,
+		RequireDigit:  policy.RequireDigit,
+		RequireSymbol: policy.RequireSymbol,
+		BreachCheck:   policy.BreachCheck,
+	})
+}
+
+// @Summary Require a user to change their password
+// @Description Make a user choose a new password before using the API again, or lift the requirement. Until they do, every request but GET /users/me and PUT /users/me/password answers 403 with reason password_change_required.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetPasswordRotationRequest true "Whether a new password is required"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/password-rotation [put]
+func (h *Handler) SetPasswordRotation(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req SetPasswordRotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	if err := userService.SetPasswordChangeRequired(userID, *req.Required); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to set password rotation", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set password rotation")
+		return
+	}
+
+	logger.Info("Changed password rotation", map[string]interface{}{
+		"audit":    true,
+		"action":   "user.password_rotation",
+		"user_id":  userID,
+		"required": *req.Required,
+		"admin_id": c.GetHeader("X-User-ID"),
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"user_id": userID, "password_change_required": *req.Required})
+}
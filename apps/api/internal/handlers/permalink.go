@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// maxContextMessages is the most messages a jump returns on each side of a message
+const maxContextMessages = 100
+
+// PermalinkResponse is the link to share for a message
+type PermalinkResponse struct {
+	// Link opens the message in the apps
+	Link           string    `json:"link" example:"talkify://conversations/4f0c7d5e-8a61-4c4e-9b1e-2d3f4a5b6c7d/messages/9b2e6f1a-3c4d-4e5f-8a7b-1c2d3e4f5a6b"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	// ContextURL is where opening the link gets the message with those around it
+	ContextURL string `json:"context_url" example:"/api/messages/9b2e6f1a-3c4d-4e5f-8a7b-1c2d3e4f5a6b/context"`
+}
+
+// @Summary Get a message's permalink
+// @Description Get the canonical link of a message, to share with other participants. Opening it calls context_url, which only answers those who can read the message. Links stay the same for as long as the message exists.
+// @Tags messages
+// @Produce json
+// @Param id path string true "Message ID"
+// @Success 200 {object} PermalinkResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/permalink [get]
+func (h *Handler) GetMessagePermalink(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	messages, err := models.NewMessageService(h.db, h.encryptor).GetByIDsForUser([]uuid.UUID{messageID}, userID)
+	if err != nil {
+		logger.Error("Failed to get message permalink", err, map[string]interface{}{
+			"message_id": messageID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get permalink")
+		return
+	}
+	if len(messages) == 0 {
+		h.respondWithError(c, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, PermalinkResponse{
+		Link:           models.MessageLink(messages[0].ConversationID, messageID),
+		ConversationID: messages[0].ConversationID,
+		MessageID:      messageID,
+		ContextURL:     "/api/messages/" + messageID.String() + "/context",
+	})
+}
+
+// @Summary Jump to a message
+// @Description Get a message with the messages around it, oldest first, as opening its permalink does. Only participants who can see the message in their history get it; everyone else gets 404. Page on from offset with GET /messages/conversation/{id}.
+// @Tags messages
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param before query int false "Messages to return before it" default(25) maximum(100)
+// @Param after query int false "Messages to return after it" default(25) maximum(100)
+// @Param display_hints query bool false "Label when each message was sent in the user's timezone"
+// @Success 200 {object} models.MessageContext
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /messages/{id}/context [get]
+func (h *Handler) GetMessageContext(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	before, err := strconv.Atoi(c.DefaultQuery("before", "25"))
+	if err != nil || before < 0 || before > maxContextMessages {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid before. Must be between 0 and 100")
+		return
+	}
+	after, err := strconv.Atoi(c.DefaultQuery("after", "25"))
+	if err != nil || after < 0 || after > maxContextMessages {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid after. Must be between 0 and 100")
+		return
+	}
+	timezone, ok := h.displayTimezone(c, userID)
+	if !ok {
+		return
+	}
+
+	messageContext, err := models.NewMessageService(h.db, h.encryptor).GetContext(messageID, userID, before, after)
+	if err != nil {
+		if errors.Is(err, models.ErrMessageNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Message not found")
+			return
+		}
+		logger.Error("Failed to get message context", err, map[string]interface{}{
+			"message_id": messageID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get message context")
+		return
+	}
+	if timezone != "" {
+		addMessageHints(messageContext.Messages, timezone)
+	}
+	h.respondWithSuccess(c, http.StatusOK, messageContext)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// vCardContentType is the media type of .vcf files
+const vCardContentType = "text/vcard; charset=utf-8"
+
+// ProfileResponse is a public profile with the payload for the QR code that adds the
+// user as a contact in person
+type ProfileResponse struct {
+	*models.Profile
+	QRPayload string `json:"qr_payload" example:"talkify://users/4f0c7d5e-8a61-4c4e-9b1e-2d3f4a5b6c7d"`
+}
+
+// @Summary Get a user's public profile
+// @Description Get the public profile of a user, with only the contact details they chose to share and the payload of a QR code for adding them in person. With format=vcard, or an Accept header of text/vcard, the profile is returned as a .vcf file for phone address books. Responses carry an ETag; sending it back in If-None-Match gets a 304 while the profile is unchanged.
+// @Tags users
+// @Produce json
+// @Produce text/vcard
+// @Param id path string true "User ID"
+// @Param format query string false "Response format" Enums(json, vcard) default(json)
+// @Param If-None-Match header string false "ETag of the copy the client has"
+// @Success 200 {object} ProfileResponse
+// @Header 200 {string} ETag "Tag of the returned payload"
+// @Success 304 "Not modified"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/{id}/profile [get]
+func (h *Handler) GetUserProfile(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "vcard" {
+		h.respondWithError(c, http.StatusBadRequest, "Format must be json or vcard")
+		return
+	}
+	if strings.Contains(c.GetHeader("Accept"), "text/vcard") || strings.Contains(c.GetHeader("Accept"), "text/x-vcard") {
+		format = "vcard"
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	user, err := userService.GetByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to get user", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	profile := user.Profile()
+	if format == "vcard" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.vcf"`, vCardFilename(profile.Username)))
+		h.respondWithETagData(c, vCardContentType, []byte(profile.VCard()))
+		return
+	}
+	h.respondWithETag(c, ProfileResponse{Profile: profile, QRPayload: profile.Link()})
+}
+
+// vCardFilename keeps the characters of a username that are safe in a file name
+func vCardFilename(username string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return -1
+	}, username)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "contact"
+	}
+	return name
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// rateWindowSeconds is how far back event rates are measured
+const rateWindowSeconds = 60
+
+// RealtimeStats describes this instance's WebSocket hub. Each API instance runs its own
+// hub, so the figures cover the connections made to the instance answering.
+type RealtimeStats struct {
+	Connections int `json:"connections"`
+	Users       int `json:"users"`
+	// TopUsers are the users with the most connections, most first
+	TopUsers []UserConnections `json:"top_users"`
+	// UserConnections lists the connections of the user asked for with user_id
+	UserConnections []RealtimeConnection `json:"user_connections,omitempty"`
+	Throughput      RealtimeThroughput   `json:"throughput"`
+	Shards          []RealtimeShard      `json:"shards"`
+}
+
+// UserConnections is how many connections a user has open
+type UserConnections struct {
+	UserID      string `json:"user_id"`
+	Connections int    `json:"connections"`
+}
+
+// RealtimeConnection is an open WebSocket connection
+type RealtimeConnection struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      string    `json:"user_id"`
+	IP          string    `json:"ip"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// Acks is set for connections that acknowledge conversation events
+	Acks bool `json:"acks"`
+	// Device is what the client named its device; Standby is set while a newer
+	// connection of the device gets its events
+	Device  string `json:"device,omitempty"`
+	Standby bool   `json:"standby,omitempty"`
+	// Queued is how many events wait to be written to the connection
+	Queued int `json:"queued"`
+}
+
+// RealtimeThroughput counts events since the instance started, with their rates over
+// the last WindowSeconds
+type RealtimeThroughput struct {
+	WindowSeconds     int     `json:"window_seconds"`
+	SentPerSecond     float64 `json:"sent_per_second"`
+	ReceivedPerSecond float64 `json:"received_per_second"`
+	SentTotal         uint64  `json:"sent_total"`
+	ReceivedTotal     uint64  `json:"received_total"`
+	// DroppedTotal counts connections closed because they fell too far behind
+	DroppedTotal uint64 `json:"dropped_total"`
+}
+
+// RealtimeShard is the queue depth of a group of connections served together. The hub
+// serves every connection of the instance from one loop, so there is one shard.
+type RealtimeShard struct {
+	Shard       int `json:"shard"`
+	Connections int `json:"connections"`
+	Queued      int `json:"queued"`
+	MaxQueued   int `json:"max_queued"`
+	Capacity    int `json:"capacity"`
+}
+
+// eventRate counts events, keeping per-second counts for the last rateWindowSeconds
+type eventRate struct {
+	mutex   sync.Mutex
+	total   uint64
+	counts  [rateWindowSeconds]uint64
+	seconds [rateWindowSeconds]int64
+}
+
+func newEventRate() *eventRate {
+	return &eventRate{}
+}
+
+func (r *eventRate) add(n uint64) {
+	if n == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	i := now % rateWindowSeconds
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.seconds[i] != now {
+		r.seconds[i] = now
+		r.counts[i] = 0
+	}
+	r.counts[i] += n
+	r.total += n
+}
+
+// snapshot returns the events counted so far and their rate per second over the window
+func (r *eventRate) snapshot() (uint64, float64) {
+	now := time.Now().Unix()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var recent uint64
+	for i, second := range r.seconds {
+		if now-second < rateWindowSeconds {
+			recent += r.counts[i]
+		}
+	}
+	return r.total, float64(recent) / rateWindowSeconds
+}
+
+// Stats describes the hub's connections, listing the top users with the most and, when
+// userID is set, that user's connections
+func (h *Hub) Stats(top int, userID string) RealtimeStats {
+	stats := RealtimeStats{
+		TopUsers: []UserConnections{},
+		Shards:   []RealtimeShard{{Capacity: clientSendBuffer}},
+	}
+	shard := &stats.Shards[0]
+	perUser := make(map[string]int)
+
+	h.mutex.Lock()
+	for client := range h.clients {
+		perUser[client.userID]++
+		queued := len(client.send)
+		shard.Queued += queued
+		if queued > shard.MaxQueued {
+			shard.MaxQueued = queued
+		}
+		if userID != "" && client.userID == userID {
+			stats.UserConnections = append(stats.UserConnections, RealtimeConnection{
+				ID:          client.id,
+				UserID:      client.userID,
+				IP:          client.ip,
+				ConnectedAt: client.connectedAt,
+				Acks:        client.deliveries != nil,
+				Device:      client.device,
+				Standby:     !h.receives(client),
+				Queued:      queued,
+			})
+		}
+	}
+	stats.Connections = len(h.clients)
+	h.mutex.Unlock()
+
+	shard.Connections = stats.Connections
+	stats.Users = len(perUser)
+	for id, n := range perUser {
+		stats.TopUsers = append(stats.TopUsers, UserConnections{UserID: id, Connections: n})
+	}
+	sort.Slice(stats.TopUsers, func(i, j int) bool {
+		if stats.TopUsers[i].Connections != stats.TopUsers[j].Connections {
+			return stats.TopUsers[i].Connections > stats.TopUsers[j].Connections
+		}
+		return stats.TopUsers[i].UserID < stats.TopUsers[j].UserID
+	})
+	if len(stats.TopUsers) > top {
+		stats.TopUsers = stats.TopUsers[:top]
+	}
+	sort.Slice(stats.UserConnections, func(i, j int) bool {
+		return stats.UserConnections[i].ConnectedAt.Before(stats.UserConnections[j].ConnectedAt)
+	})
+
+	stats.Throughput.WindowSeconds = rateWindowSeconds
+	stats.Throughput.SentTotal, stats.Throughput.SentPerSecond = h.sent.snapshot()
+	stats.Throughput.ReceivedTotal, stats.Throughput.ReceivedPerSecond = h.received.snapshot()
+	stats.Throughput.DroppedTotal = h.dropped.Load()
+	return stats
+}
+
+// Disconnect closes a connection, which the client takes as a cue to reconnect. It
+// returns the user of the connection, and false when no connection has the ID.
+func (h *Hub) Disconnect(id uuid.UUID) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for client := range h.clients {
+		if client.id == id {
+			h.remove(client, closeDisconnected)
+			return client.userID, true
+		}
+	}
+	return "", false
+}
+
+// @Summary Get real-time connection stats
+// @Description Get this instance's WebSocket connections: how many are open and by how many users, the users with the most, events sent and received with their rates over the last minute, connections dropped for falling behind, and the queue depth of the hub's shards. Pass user_id to list a user's connections with their IDs, for disconnecting one.
+// @Tags admin
+// @Produce json
+// @Param top query int false "Number of users with the most connections to list, 1 to 100" default(20)
+// @Param user_id query string false "List this user's connections"
+// @Success 200 {object} RealtimeStats
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/realtime [get]
+func (h *Handler) GetRealtimeStats(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "20"))
+	if err != nil || top < 1 || top > 100 {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid top. Must be between 1 and 100")
+		return
+	}
+	userID := c.Query("user_id")
+	if userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		userID = id.String()
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, h.hub.Stats(top, userID))
+}
+
+// @Summary Disconnect a real-time connection
+// @Description Close one of this instance's WebSocket connections. Clients reconnect on their own, so this clears a stuck connection rather than locking anyone out.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/realtime/connections/{id} [delete]
+func (h *Handler) DisconnectRealtimeConnection(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	connectionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid connection ID")
+		return
+	}
+
+	userID, ok := h.hub.Disconnect(connectionID)
+	if !ok {
+		h.respondWithError(c, http.StatusNotFound, "Connection not found")
+		return
+	}
+	logger.Info("Disconnected real-time connection", map[string]interface{}{
+		"audit":         true,
+		"action":        "realtime.disconnect",
+		"admin_id":      adminID,
+		"connection_id": connectionID,
+		"user_id":       userID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Connection closed"})
+}
@@ -0,0 +1,626 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// GenerateRecoveryCodesRequest confirms the user's password before new codes are made
+type GenerateRecoveryCodesRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// RecoveryCodesResponse lists new recovery codes, which are only shown once
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes"`
+}
+
+// RecoveryCodesStatus tells how many recovery codes a user has left
+type RecoveryCodesStatus struct {
+	Remaining int `json:"remaining"`
+}
+
+// RecoverWithCodeRequest sets a new password with a recovery code
+type RecoverWithCodeRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Code        string `json:"code" binding:"required" example:"1a2b3-c4d5e"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// SetTrustedContactsRequest replaces the user's trusted contacts. An empty list turns
+// recovery through contacts off.
+type SetTrustedContactsRequest struct {
+	Password  string   `json:"password" binding:"required"`
+	UserIDs   []string `json:"user_ids"`
+	Threshold int      `json:"threshold" example:"2"`
+}
+
+// StartRecoveryRequest asks the trusted contacts of an account to approve recovering it
+type StartRecoveryRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// StartRecoveryResponse holds the secret needed to follow and complete a recovery
+// request. It is only shown once.
+type StartRecoveryResponse struct {
+	Request models.RecoveryRequest `json:"request"`
+	Secret  string                 `json:"secret"`
+}
+
+// RecoveryStatusRequest identifies the requester of a recovery
+type RecoveryStatusRequest struct {
+	Secret string `json:"secret" binding:"required"`
+}
+
+// CompleteRecoveryRequest sets a new password through an approved recovery request
+type CompleteRecoveryRequest struct {
+	Secret      string `json:"secret" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// @Summary Generate recovery codes
+// @Description Replace the user's recovery codes with ten new one-time codes. Each code sets a new password once if the password is lost. The codes are only shown in this response.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body GenerateRecoveryCodesRequest true "Current password"
+// @Success 201 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-codes [post]
+func (h *Handler) GenerateRecoveryCodes(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req GenerateRecoveryCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if !h.confirmPassword(c, userID, req.Password) {
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	codes, err := recoveryService.GenerateCodes(userID)
+	if err != nil {
+		logger.Error("Failed to generate recovery codes", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	logger.Info("Generated recovery codes", map[string]interface{}{
+		"audit":   true,
+		"action":  "recovery.codes_generated",
+		"user_id": userID,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, RecoveryCodesResponse{Codes: codes})
+}
+
+// @Summary Get recovery code status
+// @Description Tell how many unused recovery codes the user has left
+// @Tags users
+// @Produce json
+// @Success 200 {object} RecoveryCodesStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-codes [get]
+func (h *Handler) GetRecoveryCodesStatus(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	remaining, err := recoveryService.CodesRemaining(userID)
+	if err != nil {
+		logger.Error("Failed to count recovery codes", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get recovery codes")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, RecoveryCodesStatus{Remaining: remaining})
+}
+
+// @Summary Recover an account with a recovery code
+// @Description Set a new password using one of the account's recovery codes, which is used up. The account is signed out everywhere.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RecoverWithCodeRequest true "Username, recovery code and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/recover [post]
+func (h *Handler) RecoverWithCode(c *gin.Context) {
+	var req RecoverWithCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	if !h.checkNewPassword(c, req.NewPassword, req.Username) {
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	userID, err := recoveryService.RecoverWithCode(req.Username, req.Code, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrUnauthorized) {
+			logger.Warn("Rejected recovery code", map[string]interface{}{
+				"username": req.Username,
+				"ip":       c.ClientIP(),
+			})
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid username or recovery code")
+			return
+		}
+		logger.Error("Failed to recover account", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to recover account")
+		return
+	}
+
+	h.accountRecovered(userID, "recovery code", c.ClientIP())
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+// @Summary Get trusted contacts
+// @Description List the user's trusted contacts and how many of them have to approve recovering the account
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.TrustedContacts
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/trusted-contacts [get]
+func (h *Handler) GetTrustedContacts(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	contacts, err := recoveryService.GetContacts(userID)
+	if err != nil {
+		logger.Error("Failed to get trusted contacts", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get trusted contacts")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, contacts)
+}
+
+// @Summary Set trusted contacts
+// @Description Replace the user's trusted contacts, up to five, and how many of them have to approve recovering the account. Open recovery requests are cancelled. An empty list turns recovery through contacts off.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body SetTrustedContactsRequest true "Current password, contacts and threshold"
+// @Success 200 {object} models.TrustedContacts
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/trusted-contacts [put]
+func (h *Handler) SetTrustedContacts(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req SetTrustedContactsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	contactIDs := make([]uuid.UUID, 0, len(req.UserIDs))
+	for _, raw := range req.UserIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		contactIDs = append(contactIDs, id)
+	}
+	if !h.confirmPassword(c, userID, req.Password) {
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	if err := recoveryService.SetContacts(userID, contactIDs, req.Threshold); err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			h.respondWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Error("Failed to set trusted contacts", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to set trusted contacts")
+		return
+	}
+
+	logger.Info("Set trusted contacts", map[string]interface{}{
+		"audit":     true,
+		"action":    "recovery.contacts_set",
+		"user_id":   userID,
+		"contacts":  len(contactIDs),
+		"threshold": req.Threshold,
+	})
+
+	contacts, err := recoveryService.GetContacts(userID)
+	if err != nil {
+		logger.Error("Failed to get trusted contacts", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get trusted contacts")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, contacts)
+}
+
+// @Summary Start recovering an account through trusted contacts
+// @Description Ask the trusted contacts of an account to approve recovering it. The owner is notified and can cancel the request. Once enough contacts approve and the delay has passed, the returned secret sets a new password.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body StartRecoveryRequest true "Username of the account"
+// @Success 201 {object} StartRecoveryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/recovery-requests [post]
+func (h *Handler) StartRecovery(c *gin.Context) {
+	var req StartRecoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	request, secret, contacts, err := recoveryService.CreateRequest(req.Username, h.cfg.Recovery.Delay, h.cfg.Recovery.RequestTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Recovery through trusted contacts is not set up for this account")
+		case errors.Is(err, models.ErrConflict):
+			h.respondWithError(c, http.StatusConflict, "A recovery request for this account is already open")
+		default:
+			logger.Error("Failed to create recovery request", err)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to start recovery")
+		}
+		return
+	}
+
+	logger.Info("Started account recovery", map[string]interface{}{
+		"audit":      true,
+		"action":     "recovery.requested",
+		"user_id":    request.UserID,
+		"request_id": request.ID,
+		"ip":         c.ClientIP(),
+	})
+
+	username, ownerID, readyAt := req.Username, request.UserID, request.ReadyAt
+	h.submitTask("notify_recovery_request", func() error {
+		for _, contactID := range contacts {
+			body := fmt.Sprintf("%s asked to recover their account and named you as a trusted contact. "+
+				"Only approve if they asked you themselves, outside Talkify.", username)
+			if err := h.notify(contactID, models.NotificationRecoveryApproval, "Account recovery approval requested", body); err != nil {
+				return err
+			}
+		}
+		return h.alertRecoveryRequest(ownerID, readyAt)
+	})
+
+	h.respondWithSuccess(c, http.StatusCreated, StartRecoveryResponse{Request: *request, Secret: secret})
+}
+
+// alertRecoveryRequest warns an account's owner, in their notification center and by
+// email, that someone asked to recover the account
+func (h *Handler) alertRecoveryRequest(userID uuid.UUID, readyAt time.Time) error {
+	body := fmt.Sprintf("Someone asked your trusted contacts to approve recovering your account. "+
+		"If they do, your password can be reset after %s. If this wasn't you, cancel the request "+
+		"in your account settings.", readyAt.UTC().Format("January 2, 2006 15:04 MST"))
+	if err := h.notify(userID, models.NotificationRecoveryRequested, "Account recovery requested", body); err != nil {
+		return err
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	user, err := userService.GetByID(userID)
+	if err != nil || h.mailer == nil || user.Email == "" {
+		return nil
+	}
+	return h.mailer.Send(user.Email, "Recovery of your Talkify account was requested", body+"\n")
+}
+
+// @Summary Get the status of a recovery request
+// @Description Show how many approvals a recovery request has and when it can be completed, to whoever holds its secret
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path string true "Recovery request ID"
+// @Param request body RecoveryStatusRequest true "Secret of the request"
+// @Success 200 {object} models.RecoveryRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/recovery-requests/{id}/status [post]
+func (h *Handler) GetRecoveryStatus(c *gin.Context) {
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid recovery request ID")
+		return
+	}
+	var req RecoveryStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	request, err := recoveryService.Status(requestID, req.Secret)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Recovery request not found")
+			return
+		}
+		logger.Error("Failed to get recovery request", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get recovery request")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, request)
+}
+
+// @Summary Complete a recovery request
+// @Description Set a new password through a recovery request that enough trusted contacts approved, once its delay has passed. The account is signed out everywhere. Requests that are not ready yet are answered with 409 and their status.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path string true "Recovery request ID"
+// @Param request body CompleteRecoveryRequest true "Secret of the request and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/recovery-requests/{id}/complete [post]
+func (h *Handler) CompleteRecovery(c *gin.Context) {
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid recovery request ID")
+		return
+	}
+	var req CompleteRecoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	if !h.checkNewPassword(c, req.NewPassword) {
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	request, err := recoveryService.Complete(requestID, req.Secret, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecoveryNotReady):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Recovery request is not approved yet or still in its waiting period",
+				"request": request,
+			})
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusNotFound, "Recovery request not found")
+		default:
+			logger.Error("Failed to complete recovery request", err)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to recover account")
+		}
+		return
+	}
+
+	h.accountRecovered(request.UserID, "trusted contacts", c.ClientIP())
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+// @Summary List my recovery requests
+// @Description List the requests to recover the user's account, newest first
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.RecoveryRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-requests [get]
+func (h *Handler) GetMyRecoveryRequests(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	requests, err := recoveryService.ListRequests(userID)
+	if err != nil {
+		logger.Error("Failed to list recovery requests", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list recovery requests")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, requests)
+}
+
+// @Summary Cancel a recovery request
+// @Description Cancel an open request to recover the user's account
+// @Tags users
+// @Produce json
+// @Param id path string true "Recovery request ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-requests/{id}/cancel [post]
+func (h *Handler) CancelRecoveryRequest(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid recovery request ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	if err := recoveryService.Cancel(requestID, userID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Recovery request not found")
+			return
+		}
+		logger.Error("Failed to cancel recovery request", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to cancel recovery request")
+		return
+	}
+
+	logger.Info("Cancelled account recovery", map[string]interface{}{
+		"audit":      true,
+		"action":     "recovery.cancelled",
+		"user_id":    userID,
+		"request_id": requestID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Recovery request cancelled"})
+}
+
+// @Summary List recovery requests to approve
+// @Description List the open requests to recover accounts that named the user as a trusted contact
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.ContactRecoveryRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-approvals [get]
+func (h *Handler) GetRecoveryApprovals(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	requests, err := recoveryService.PendingForContact(userID)
+	if err != nil {
+		logger.Error("Failed to list recovery requests", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list recovery requests")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, requests)
+}
+
+// @Summary Approve a recovery request
+// @Description Approve recovering the account of someone who named the user as a trusted contact
+// @Tags users
+// @Produce json
+// @Param id path string true "Recovery request ID"
+// @Success 200 {object} models.RecoveryRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/recovery-approvals/{id} [post]
+func (h *Handler) ApproveRecoveryRequest(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid recovery request ID")
+		return
+	}
+
+	recoveryService := models.NewRecoveryService(h.db)
+	request, err := recoveryService.Approve(requestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Recovery request not found")
+			return
+		}
+		logger.Error("Failed to approve recovery request", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to approve recovery request")
+		return
+	}
+
+	logger.Info("Approved account recovery", map[string]interface{}{
+		"audit":      true,
+		"action":     "recovery.approved",
+		"user_id":    request.UserID,
+		"contact_id": userID,
+		"request_id": requestID,
+		"approvals":  request.Approvals,
+	})
+	h.respondWithSuccess(c, http.StatusOK, request)
+}
+
+// accountRecovered signs a recovered account out everywhere and tells its owner
+func (h *Handler) accountRecovered(userID uuid.UUID, method, ip string) {
+	logger.Info("Recovered account", map[string]interface{}{
+		"audit":   true,
+		"action":  "recovery.completed",
+		"user_id": userID,
+		"method":  method,
+		"ip":      ip,
+	})
+
+	sessionService := models.NewSessionService(h.db)
+	if _, err := sessionService.RevokeAll(userID, models.RevokedAccountRecovered); err != nil {
+		logger.Error("Failed to revoke sessions of recovered account", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	h.hub.endSessions(userID, func(uuid.UUID) bool { return true })
+
+	body := fmt.Sprintf("The password of your account was reset with %s at %s and every device was "+
+		"signed out. If this wasn't you, contact support.", method, time.Now().UTC().Format("January 2, 2006 15:04 MST"))
+	h.submitTask("alert_account_recovered", func() error {
+		if err := h.notify(userID, models.NotificationAccountRecovered, "Your password was reset", body); err != nil {
+			return err
+		}
+		userService := models.NewUserService(h.db, h.encryptor)
+		user, err := userService.GetByID(userID)
+		if err != nil || h.mailer == nil || user.Email == "" {
+			return nil
+		}
+		return h.mailer.Send(user.Email, "Your Talkify password was reset", body+"\n")
+	})
+}
+
+// confirmPassword checks the user's current password before a security setting changes,
+// responding when it is wrong
+func (h *Handler) confirmPassword(c *gin.Context, userID uuid.UUID, password string) bool {
+	userService := models.NewUserService(h.db, h.encryptor)
+	err := userService.CheckPassword(userID, password)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, models.ErrUnauthorized):
+		h.respondWithError(c, http.StatusUnauthorized, "Password is incorrect")
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+	default:
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check password")
+	}
+	return false
+}
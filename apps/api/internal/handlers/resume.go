@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	errResumeTokenInvalid = errors.New("invalid resume token")
+	errResumeTokenExpired = errors.New("resume token has expired")
+)
+
+// resumeClaims is who a WebSocket connection was opened for. Resume tokens carry them
+// so that a client reconnecting soon after losing its connection is taken at its word
+// instead of being authenticated again, which would load the database with every
+// client of a node at once after a deploy or network blip. The token is signed rather
+// than stored, so it can be presented to any node.
+type resumeClaims struct {
+	UserID    uuid.UUID `json:"u"`
+	SessionID uuid.UUID `json:"s"`
+	Bot       bool      `json:"b,omitempty"`
+	// ClientID is the application of an application token, whose grant is checked again
+	// on resuming
+	ClientID string `json:"c,omitempty"`
+	// Write is set for tokens allowed to write messages, whose connections may say the
+	// user is typing
+	Write bool `json:"w,omitempty"`
+	// LastEventID is the newest event when the token was issued; clients that reconnect
+	// without a last_event_id have the events since replayed
+	LastEventID uint64 `json:"e"`
+	ExpiresAt   int64  `json:"x"`
+}
+
+// issueResumeToken signs claims to be presented within the resume window, returning
+// the token and when it expires. A session revoked meanwhile is not noticed until the
+// token expires, which is why the window is kept short.
+func (h *Handler) issueResumeToken(claims resumeClaims) (string, time.Time, error) {
+	expiresAt := time.Now().Add(h.cfg.Events.ResumeWindow)
+	claims.ExpiresAt = expiresAt.Unix()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + h.resumeSignature(encoded), expiresAt, nil
+}
+
+// resumeSignature signs the encoded claims of a resume token with the configured key
+func (h *Handler) resumeSignature(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(h.cfg.Events.ResumeSigningKey))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseResumeToken checks the signature and expiry of a resume token
+func (h *Handler) parseResumeToken(token string) (*resumeClaims, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || h.cfg.Events.ResumeSigningKey == "" {
+		return nil, errResumeTokenInvalid
+	}
+	if !hmac.Equal([]byte(signature), []byte(h.resumeSignature(encoded))) {
+		return nil, errResumeTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errResumeTokenInvalid
+	}
+	var claims resumeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errResumeTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errResumeTokenExpired
+	}
+	return &claims, nil
+}
+
+// resumeTokenEvent returns a session.resume_token event for the connection of claims,
+// or nil when resuming is turned off
+func (h *Handler) resumeTokenEvent(claims resumeClaims) []byte {
+	if !h.cfg.Events.ResumeEnabled() {
+		return nil
+	}
+	claims.LastEventID = h.events.LastID()
+	token, expiresAt, err := h.issueResumeToken(claims)
+	if err != nil {
+		return nil
+	}
+	message, err := json.Marshal(Message{Type: EventResumeToken, Payload: ResumeTokenEvent{Token: token, ExpiresAt: expiresAt}})
+	if err != nil {
+		return nil
+	}
+	return message
+}
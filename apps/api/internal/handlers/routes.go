@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"time"
+
+	"talkify/apps/api/internal/cron"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes registers the public API on api, which is served under /api
+func (h *Handler) RegisterRoutes(api *gin.RouterGroup) {
+	// WebSocket endpoint
+	api.GET("/ws", h.WebSocket)
+
+	h.RegisterAuthRoutes(api.Group("/auth"))
+	h.RegisterUserRoutes(api.Group("/users"))
+	h.RegisterConversationRoutes(api.Group("/conversations"))
+	h.RegisterMessageRoutes(api.Group("/messages"))
+	h.RegisterInteractionRoutes(api.Group("/interactions"))
+	h.RegisterInboxRoutes(api.Group("/inbox"))
+	h.RegisterBookmarkRoutes(api.Group("/bookmarks"))
+	h.RegisterMentionRoutes(api.Group("/mentions"))
+	h.RegisterNotificationRoutes(api.Group("/notifications"))
+	h.RegisterBroadcastRoutes(api.Group("/broadcasts"))
+	h.RegisterMediaRoutes(api.Group("/media"))
+	h.RegisterEmbedRoutes(api.Group("/embed"))
+	h.RegisterTranscriptRoutes(api.Group("/transcripts"))
+	h.RegisterAppRoutes(api.Group("/apps"))
+	h.RegisterOAuthRoutes(api.Group("/oauth"))
+	h.RegisterFederationRoutes(api.Group("/federation"))
+	h.RegisterSupportRoutes(api.Group("/support"))
+	h.RegisterWorkspaceRoutes(api.Group("/workspace"))
+	h.RegisterAdminRoutes(api.Group("/admin"))
+	if h.graphql != nil {
+		h.RegisterGraphQLRoutes(api.Group("/graphql"))
+	}
+
+	// Public keys for verifying asymmetrically signed tokens
+	api.GET("/.well-known/jwks.json", h.GetJWKS)
+
+	// Signed answers to other deployments about this server's users
+	api.GET("/.well-known/webfinger", h.GetWebFinger)
+	api.GET("/.well-known/talkify-keys", h.GetFederationKeys)
+
+	// Service health for in-app status banners
+	api.GET("/status", h.GetStatus)
+}
+
+// StreamingRoutes are the public routes whose responses last as long as the client
+// listens or the download takes: the WebSockets, media and file downloads. They are
+// exempt from the request timeout, which buffers responses, and left out of the
+// latency metrics.
+var StreamingRoutes = []string{
+	"/api/ws",
+	"/api/graphql/ws",
+	"/api/media/:id",
+	"/api/media/:id/content",
+	"/api/messages/:id/open",
+	"/api/conversations/:id/files/archive/:archive_id/download",
+	"/api/conversations/:id/exports/:export_id/download",
+	"/api/transcripts/:id/download",
+	"/api/admin/compliance/export",
+}
+
+// RegisterServiceRoutes registers the service-to-service API on r
+func (h *Handler) RegisterServiceRoutes(r gin.IRouter) {
+	h.RegisterInternalRoutes(r.Group("/internal"))
+	h.RegisterMetricsRoutes(r.Group("/metrics"))
+}
+
+// Jobs returns the periodic background jobs the API needs
+func (h *Handler) Jobs() []cron.Job {
+	analyticsService := models.NewAnalyticsService(h.db)
+	return []cron.Job{
+		{
+			Name:     "conversation_daily_rollups",
+			Interval: 15 * time.Minute,
+			Handler:  analyticsService.RefreshRecentRollups,
+		},
+		{
+			Name:     "unread_count_reconciliation",
+			Interval: time.Hour,
+			Handler:  h.ReconcileUnreadCounts,
+		},
+		{
+			Name:     "email_index_fill",
+			Interval: time.Minute,
+			Handler:  h.FillMissingEmailIndexes,
+		},
+		{
+			Name:     "message_release",
+			Interval: time.Second,
+			Handler:  h.ReleaseHeldMessages,
+		},
+		{
+			Name:     "password_hash_census",
+			Interval: 10 * time.Minute,
+			Handler:  h.CountPasswordHashes,
+		},
+		{
+			Name:     "conversation_digests",
+			Interval: time.Minute,
+			Handler:  h.PostDueDigests,
+		},
+		{
+			Name:     "federation_delivery",
+			Interval: time.Minute,
+			Handler:  h.DeliverFederatedMessages,
+		},
+		{
+			Name:     "signing_key_refresh",
+			Interval: time.Minute,
+			Handler:  h.RefreshSigningKeys,
+		},
+		{
+			Name:     "conversation_unlock",
+			Interval: time.Minute,
+			Handler:  h.ReleaseExpiredLocks,
+		},
+		{
+			Name:     "message_preview_fill",
+			Interval: time.Minute,
+			Handler:  h.FillMissingPreviews,
+		},
+		{
+			Name:     "presence_sweep",
+			Interval: h.cfg.Presence.SweepInterval,
+			Handler:  h.SweepPresence,
+		},
+		{
+			Name:     "conversation_retention",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeDeletedConversations,
+		},
+		{
+			Name:     "message_retention",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeExpiredMessages,
+		},
+		{
+			Name:     "empty_conversation_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeEmptyConversations,
+		},
+		{
+			Name:     "orphan_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.CleanupOrphans,
+		},
+		{
+			Name:     "storage_report",
+			Interval: h.cfg.Media.ReportInterval,
+			Handler:  h.ReportStorage,
+		},
+		{
+			Name:     "file_archive_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeExpiredArchives,
+		},
+		{
+			Name:     "compliance_stream_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeComplianceEvents,
+		},
+		{
+			Name:     "staged_attachment_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeStagedAttachments,
+		},
+		{
+			Name:     "transcript_export_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeExpiredTranscripts,
+		},
+		{
+			Name:     "login_challenge_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeExpiredLoginChallenges,
+		},
+		{
+			Name:     "email_change_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeExpiredEmailChanges,
+		},
+		{
+			Name:     "session_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeStaleSessions,
+		},
+		{
+			Name:     "missed_delivery_resend",
+			Interval: h.cfg.Delivery.AckTimeout,
+			Handler:  h.ResendMissedDeliveries,
+		},
+		{
+			Name:     "message_delivery_cleanup",
+			Interval: h.cfg.Retention.Interval,
+			Handler:  h.PurgeMessageDeliveries,
+		},
+		{
+			Name:     "support_sla",
+			Interval: h.cfg.Support.Interval,
+			Handler:  h.CheckSupportSLA,
+		},
+		{
+			Name:     "inactive_account_policy",
+			Interval: h.cfg.Inactive.Interval,
+			Handler:  h.EnforceInactivePolicy,
+		},
+	}
+}
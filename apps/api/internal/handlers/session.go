@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Reasons given with 401 responses besides the session ones in models. Clients refresh
+// their tokens on token_expired and have to sign in again for every other reason.
+const (
+	ReasonTokenExpired = "token_expired"
+	ReasonTokenInvalid = "token_invalid"
+)
+
+// sessionTouchInterval is how often a session's last activity is recorded
+const sessionTouchInterval = time.Minute
+
+// respondUnauthorized answers 401 with a reason clients can act on
+func (h *Handler) respondUnauthorized(c *gin.Context, reason, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message, "reason": reason})
+}
+
+func (h *Handler) sessionPolicy() models.SessionPolicy {
+	return models.SessionPolicy{
+		IdleTimeout: h.cfg.Session.IdleTimeout,
+		MaxLifetime: h.cfg.Session.MaxLifetime,
+	}
+}
+
+// startSession records the session of a new token pair signed in from ip, signing out
+// the user's least recently used sessions beyond the configured cap
+func (h *Handler) startSession(userID uuid.UUID, pair *auth.TokenPair, device, ip string) error {
+	sessionService := models.NewSessionService(h.db)
+	revoked, err := sessionService.Start(pair.SessionID, userID, device, ip, h.cfg.Session.MaxPerUser)
+	if err != nil {
+		return err
+	}
+	for _, id := range revoked {
+		logger.Info("Revoked session over the limit", map[string]interface{}{
+			"audit":      true,
+			"action":     "session.revoke",
+			"user_id":    userID,
+			"session_id": id,
+			"reason":     models.RevokedSessionLimit,
+			"ip":         ip,
+		})
+	}
+	if len(revoked) > 0 {
+		h.hub.endSessions(userID, func(id uuid.UUID) bool { return slices.Contains(revoked, id) })
+	}
+	return nil
+}
+
+// checkSession returns why the session no longer grants access, or "" when it does.
+// Sessions started before they were tracked have no record and are let through until
+// their tokens expire.
+func (h *Handler) checkSession(sessionID uuid.UUID) (string, error) {
+	sessionService := models.NewSessionService(h.db)
+	session, err := sessionService.Get(sessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if reason := h.sessionPolicy().Check(session, now); reason != "" {
+		return reason, nil
+	}
+	if now.Sub(session.LastActiveAt) > sessionTouchInterval {
+		h.submitTask("touch_session", func() error {
+			return sessionService.Touch(sessionID)
+		})
+	}
+	return "", nil
+}
+
+// refreshSession checks the session of a refresh token before new tokens are handed
+// out to the client at ip and records the refresh. It returns why the session has
+// ended, or "" when it goes on.
+func (h *Handler) refreshSession(claims *auth.Claims, pair *auth.TokenPair, ip string) (string, error) {
+	if claims.SessionID == uuid.Nil {
+		return "", nil
+	}
+
+	sessionService := models.NewSessionService(h.db)
+	session, err := sessionService.Get(claims.SessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		// Sessions started before they were tracked are adopted on their next refresh
+		return "", h.startSession(claims.UserID, pair, claims.Device, ip)
+	}
+	if err != nil {
+		return "", err
+	}
+	if reason := h.sessionPolicy().Check(session, time.Now()); reason != "" {
+		return reason, nil
+	}
+	return "", sessionService.Refreshed(claims.SessionID, ip)
+}
+
+// sessionMessage explains a session reason to the user
+func sessionMessage(reason string) string {
+	switch reason {
+	case models.SessionIdle:
+		return "Signed out after a period of inactivity"
+	case models.SessionExpired:
+		return "Session has expired, sign in again"
+	default:
+		return "Session was signed out"
+	}
+}
+
+// PurgeStaleSessions removes sessions whose tokens have all expired
+func (h *Handler) PurgeStaleSessions() error {
+	sessionService := models.NewSessionService(h.db)
+	purged, err := sessionService.PurgeStale(auth.RefreshTokenTTL)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged stale sessions", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"math/rand/v2"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Reads compared in shadow, as labelled in logs and metrics
+const (
+	shadowReadConversations  = "conversations"
+	shadowReadUnread         = "unread"
+	shadowReadUnreadCounters = "unread_counters"
+)
+
+// shadowMismatchLogLimit is how many mismatches of one read are logged in full
+const shadowMismatchLogLimit = 20
+
+// shadowRead compares, for runtime.shadow_reads.sample_rate of reads, the conversation
+// summaries, unread counters and read watermarks a user was served from with values
+// computed from messages. The comparison runs on the worker pool so the request doesn't
+// wait for it; mismatches are logged and counted on /metrics. conversationIDs limits it
+// to the conversations served, nil compares all of the user's.
+func (h *Handler) shadowRead(read string, userID uuid.UUID, conversationIDs []uuid.UUID) {
+	rate := h.live.Runtime().ShadowReads.SampleRate
+	if rate <= 0 || rand.Float64() >= rate {
+		return
+	}
+	if conversationIDs != nil && len(conversationIDs) == 0 {
+		return
+	}
+	h.submitTask("shadow_read", func() error {
+		conversationService := models.NewConversationService(h.db, h.encryptor)
+		mismatches, err := conversationService.CompareConversationReads(userID, conversationIDs)
+		if err != nil {
+			return err
+		}
+
+		fields := make([]string, len(mismatches))
+		for i, mismatch := range mismatches {
+			fields[i] = mismatch.Field
+		}
+		h.metrics.RecordShadowRead(read, fields)
+		if len(mismatches) == 0 {
+			return nil
+		}
+
+		logged := mismatches
+		if len(logged) > shadowMismatchLogLimit {
+			logged = logged[:shadowMismatchLogLimit]
+		}
+		logger.Warn("Shadow read mismatched", map[string]interface{}{
+			"read":           read,
+			"user_id":        userID,
+			"mismatch_count": len(mismatches),
+			"mismatches":     logged,
+		})
+		return nil
+	})
+}
+
+// listedConversationIDs returns the IDs of listed conversations
+func listedConversationIDs(conversations []models.Conversation) []uuid.UUID {
+	ids := make([]uuid.UUID, len(conversations))
+	for i, conversation := range conversations {
+		ids[i] = conversation.ID
+	}
+	return ids
+}
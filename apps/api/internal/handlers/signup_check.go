@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// signupCheckWindow is the period a client's signup checks are counted over
+	signupCheckWindow = 10 * time.Minute
+	// maxSignupChecks is how many checks a client may make in a window
+	maxSignupChecks = 30
+	// maxEmailChecks is how many email checks a client gets a real answer to in a
+	// window, so that addresses can't be probed in bulk. Later ones are answered unknown
+	// rather than refused, which leaves the form working.
+	maxEmailChecks = 5
+	// minSignupCheckTime is the least time a check takes, with up to
+	// signupCheckJitter more, so that lookups can't be told apart by timing
+	minSignupCheckTime = 250 * time.Millisecond
+	signupCheckJitter  = 100 * time.Millisecond
+	// maxSignupCheckClients bounds the clients counted in memory
+	maxSignupCheckClients = 100000
+)
+
+// Answers of a signup check, per field
+const (
+	CheckAvailable = "available"
+	CheckTaken     = "taken"
+	CheckInvalid   = "invalid"
+	// CheckUnknown is given for emails once the client has used up its email checks
+	CheckUnknown = "unknown"
+)
+
+// FieldCheck is whether a field can be used to sign up
+type FieldCheck struct {
+	Status string `json:"status" example:"available" enums:"available,taken,invalid,unknown"`
+	// Reason says what is wrong with an invalid value
+	Reason string `json:"reason,omitempty"`
+}
+
+// SignupCheckResponse has a check for each field asked about
+type SignupCheckResponse struct {
+	Username *FieldCheck `json:"username,omitempty"`
+	Email    *FieldCheck `json:"email,omitempty"`
+}
+
+// signupCheckCounter counts each client's signup checks in fixed windows
+type signupCheckCounter struct {
+	mu      sync.Mutex
+	clients map[string]*signupCheckCount
+}
+
+type signupCheckCount struct {
+	start  time.Time
+	checks int
+	emails int
+}
+
+// take counts a check by key, and one of an email when email is set. It returns
+// whether the check is allowed, whether its email may be answered, and when the
+// client's window ends.
+func (sc *signupCheckCounter) take(key string, email bool, now time.Time) (bool, bool, time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	count, ok := sc.clients[key]
+	if !ok || now.Sub(count.start) >= signupCheckWindow {
+		if sc.clients == nil || len(sc.clients) >= maxSignupCheckClients {
+			sc.clients = make(map[string]*signupCheckCount)
+		}
+		count = &signupCheckCount{start: now}
+		sc.clients[key] = count
+	}
+	reset := count.start.Add(signupCheckWindow)
+
+	if count.checks >= maxSignupChecks {
+		return false, false, reset
+	}
+	count.checks++
+	if !email {
+		return true, false, reset
+	}
+	count.emails++
+	return true, count.emails <= maxEmailChecks, reset
+}
+
+// @Summary Check a username and email before signing up
+// @Description Tell whether a username and an email address can be used to register, so that signup forms can check them before submitting. Each field asked about is answered available, taken or invalid. Checks are limited per client; after a few email checks, emails are answered unknown until the limit resets, and registering is the only way to find out.
+// @Tags auth
+// @Produce json
+// @Param username query string false "Username to check"
+// @Param email query string false "Email address to check"
+// @Success 200 {object} SignupCheckResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/check [get]
+func (h *Handler) CheckSignup(c *gin.Context) {
+	username := strings.TrimSpace(c.Query("username"))
+	email := strings.TrimSpace(c.Query("email"))
+	if username == "" && email == "" {
+		h.respondWithError(c, http.StatusBadRequest, "Provide a username or an email to check")
+		return
+	}
+
+	now := time.Now()
+	allowed, answerEmail, reset := h.signupChecks.take(c.ClientIP(), email != "", now)
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reset.Sub(now).Seconds()))))
+		h.respondWithError(c, http.StatusTooManyRequests, "Too many checks")
+		return
+	}
+
+	// Answer no sooner than the slowest lookup would, whatever was looked up
+	defer func() {
+		wait := minSignupCheckTime + rand.N(signupCheckJitter) - time.Since(now)
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}()
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	response := SignupCheckResponse{}
+	if username != "" {
+		response.Username = &FieldCheck{Status: CheckAvailable}
+		if problem := usernameProblem(username); problem != "" {
+			response.Username = &FieldCheck{Status: CheckInvalid, Reason: problem}
+		} else if taken, err := userService.UsernameTaken(username); err != nil {
+			logger.Error("Failed to check username", err, nil)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check availability")
+			return
+		} else if taken {
+			response.Username.Status = CheckTaken
+		}
+	}
+	if email != "" {
+		response.Email = &FieldCheck{Status: CheckAvailable}
+		if problem := emailProblem(email); problem != "" {
+			response.Email = &FieldCheck{Status: CheckInvalid, Reason: problem}
+		} else if !answerEmail {
+			response.Email.Status = CheckUnknown
+		} else if taken, err := userService.EmailTaken(email); err != nil {
+			logger.Error("Failed to check email", err, nil)
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check availability")
+			return
+		} else if taken {
+			response.Email.Status = CheckTaken
+		}
+	}
+	h.respondWithSuccess(c, http.StatusOK, response)
+}
+
+// emailIndexFillBatch is how many users' emails a job run indexes
+const emailIndexFillBatch = 500
+
+// FillMissingEmailIndexes indexes the emails of users created before the index, a
+// batch at a time
+func (h *Handler) FillMissingEmailIndexes() error {
+	filled, err := models.NewUserService(h.db, h.encryptor).FillMissingEmailIndexes(emailIndexFillBatch)
+	if err != nil {
+		return err
+	}
+	if filled > 0 {
+		logger.Debug("Indexed user emails", map[string]interface{}{
+			"filled": filled,
+		})
+	}
+	return nil
+}
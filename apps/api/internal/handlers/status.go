@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusCacheTTL is how long a status report is served before it is rebuilt. Clients
+// poll the endpoint without credentials, so most of them get the cached copy.
+const statusCacheTTL = 10 * time.Second
+
+// StatusResponse is the service health shown in client status banners. It says nothing
+// about individual users, conversations or routes.
+type StatusResponse struct {
+	Status string `json:"status" example:"operational"`
+	// Incident is set by the operators while an incident is ongoing
+	Incident      bool          `json:"incident"`
+	Message       string        `json:"message,omitempty" example:"Message delivery is delayed"`
+	UptimeSeconds int64         `json:"uptime_seconds"`
+	Latency       StatusLatency `json:"latency"`
+	CheckedAt     time.Time     `json:"checked_at"`
+}
+
+// StatusLatency are API latency percentiles over the last metrics window, in
+// milliseconds. They are zero when the window saw no requests.
+type StatusLatency struct {
+	WindowSeconds int64 `json:"window_seconds"`
+	P50           int64 `json:"p50_ms"`
+	P95           int64 `json:"p95_ms"`
+	P99           int64 `json:"p99_ms"`
+}
+
+// statusCache holds the last status report
+type statusCache struct {
+	mu       sync.Mutex
+	response *StatusResponse
+	builtAt  time.Time
+}
+
+// @Summary Get service status
+// @Description Get the health of the service for in-app status banners: whether an incident is ongoing, uptime and API latency percentiles. Needs no credentials; the report is rebuilt at most every 10 seconds.
+// @Tags status
+// @Produce json
+// @Success 200 {object} StatusResponse
+// @Router /status [get]
+func (h *Handler) GetStatus(c *gin.Context) {
+	h.status.mu.Lock()
+	if h.status.response == nil || time.Since(h.status.builtAt) > statusCacheTTL {
+		h.status.response = h.buildStatus()
+		h.status.builtAt = time.Now()
+	}
+	response := h.status.response
+	h.status.mu.Unlock()
+
+	c.Header("Cache-Control", "public, max-age=10")
+	h.respondWithSuccess(c, http.StatusOK, response)
+}
+
+func (h *Handler) buildStatus() *StatusResponse {
+	runtime := h.live.Runtime()
+	latency := h.metrics.Latency()
+
+	status := "operational"
+	if runtime.Status.Incident {
+		status = "incident"
+	}
+	return &StatusResponse{
+		Status:        status,
+		Incident:      runtime.Status.Incident,
+		Message:       runtime.Status.Message,
+		UptimeSeconds: int64(time.Since(h.startedAt).Seconds()),
+		Latency: StatusLatency{
+			WindowSeconds: int64(latency.Window.Seconds()),
+			P50:           latency.P50.Milliseconds(),
+			P95:           latency.P95.Milliseconds(),
+			P99:           latency.P99.Milliseconds(),
+		},
+		CheckedAt: time.Now(),
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Cleanup actions
+const (
+	CleanupDeletedMessageMedia = "deleted_message_media"
+	CleanupOrphanedFiles       = "orphaned_files"
+	CleanupUsageDrift          = "usage_drift"
+)
+
+// storageCleanupBatch is how many deleted messages a cleanup clears the media of at most
+const storageCleanupBatch = 5000
+
+// orphanedFileAge keeps files younger than this out of the orphans, should their
+// archive or transcript be committed right after they are written
+const orphanedFileAge = time.Hour
+
+// StorageCleanupRequest picks what a cleanup reclaims
+type StorageCleanupRequest struct {
+	Actions []string `json:"actions" binding:"required,min=1,dive,oneof=deleted_message_media orphaned_files usage_drift" example:"deleted_message_media,orphaned_files"`
+	// DryRun reports what would be reclaimed without changing anything; it is the
+	// default, so reclaiming takes an explicit false
+	DryRun *bool `json:"dry_run"`
+}
+
+// @Summary Get the storage report
+// @Description Get how message media is spread across the conversations and users holding the most, and across media types, with what a cleanup could reclaim: media still attached to deleted messages, archive and transcript files nothing refers to, and storage users are charged for beyond their media. Recommendations say how to reclaim space, including setting a retention period when much media is over a year old. Reports are computed every media.report_interval and kept for a month; refresh computes one now.
+// @Tags admin
+// @Produce json
+// @Param refresh query bool false "Compute a new report instead of returning the latest"
+// @Success 200 {object} models.StorageReport
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/storage [get]
+func (h *Handler) GetStorageReport(c *gin.Context) {
+	storageService := models.NewStorageService(h.db)
+	report, err := storageService.Latest()
+	if c.Query("refresh") == "true" || errors.Is(err, models.ErrNotFound) {
+		report, err = h.reportStorage(storageService)
+	}
+	if err != nil {
+		logger.Error("Failed to get storage report", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get storage report")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, report)
+}
+
+// @Summary Reclaim storage
+// @Description Reclaim space as recommended by the storage report. deleted_message_media detaches the media of up to 5000 deleted messages at a time and stops charging their senders for it; messages in conversations on legal hold or keeping an integrity chain keep theirs. orphaned_files removes archive and transcript files nothing refers to, once over an hour old. usage_drift lowers the storage users are charged for to the media of their messages. Without dry_run false, nothing is changed and the response tells what would be reclaimed. Applied cleanups are audit logged.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body StorageCleanupRequest true "Actions"
+// @Success 200 {object} models.StorageCleanup
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/storage/cleanup [post]
+func (h *Handler) CleanupStorage(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req StorageCleanupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	cleanup := &models.StorageCleanup{DryRun: req.DryRun == nil || *req.DryRun}
+
+	storageService := models.NewStorageService(h.db)
+	for _, action := range req.Actions {
+		switch action {
+		case CleanupDeletedMessageMedia:
+			cleanup.DeletedMessageMedia, err = storageService.ClearDeletedMessageMedia(storageCleanupBatch, cleanup.DryRun)
+		case CleanupOrphanedFiles:
+			cleanup.OrphanedFiles, err = h.removeOrphanedFiles(storageService, cleanup.DryRun)
+		case CleanupUsageDrift:
+			cleanup.UsageDrift, err = storageService.CorrectUsage(cleanup.DryRun)
+		}
+		if err != nil {
+			logger.Error("Failed to clean up storage", err, map[string]interface{}{
+				"action": action,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to clean up storage")
+			return
+		}
+	}
+
+	if !cleanup.DryRun {
+		logger.Info("Cleaned up storage", map[string]interface{}{
+			"audit":    true,
+			"action":   "storage.cleanup",
+			"admin_id": adminID,
+			"actions":  req.Actions,
+			"cleanup":  cleanup,
+		})
+	}
+	h.respondWithSuccess(c, http.StatusOK, cleanup)
+}
+
+// ReportStorage computes and keeps a storage report for admins
+func (h *Handler) ReportStorage() error {
+	_, err := h.reportStorage(models.NewStorageService(h.db))
+	return err
+}
+
+// reportStorage computes a storage report with the files on disk and recommendations,
+// and keeps it
+func (h *Handler) reportStorage(storageService *models.StorageService) (*models.StorageReport, error) {
+	report, err := storageService.Report()
+	if err != nil {
+		return nil, err
+	}
+	known, err := storageService.KnownFiles()
+	if err != nil {
+		return nil, err
+	}
+	err = h.walkArchiveFiles(func(path string, info os.FileInfo, orphaned bool) {
+		report.Files.Bytes += info.Size()
+		report.Files.Count++
+		if orphaned {
+			report.OrphanedFiles.Bytes += info.Size()
+			report.OrphanedFiles.Count++
+		}
+	}, known)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := models.NewWorkspaceSettingsService(h.db).Get()
+	if err != nil {
+		return nil, err
+	}
+	report.Recommendations = storageRecommendations(report, settings)
+
+	if err := storageService.Save(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// storageRecommendations suggests how to reclaim the space a report found
+func storageRecommendations(report *models.StorageReport, settings *models.WorkspaceSettings) []models.StorageRecommendation {
+	recommendations := []models.StorageRecommendation{}
+	if media := report.DeletedMessageMedia; media.Count > 0 {
+		recommendations = append(recommendations, models.StorageRecommendation{
+			Kind:   CleanupDeletedMessageMedia,
+			Bytes:  media.Bytes,
+			Detail: fmt.Sprintf("%d deleted messages still have media attached; clean up deleted_message_media to detach it", media.Count),
+		})
+	}
+	if files := report.OrphanedFiles; files.Count > 0 {
+		recommendations = append(recommendations, models.StorageRecommendation{
+			Kind:   CleanupOrphanedFiles,
+			Bytes:  files.Bytes,
+			Detail: fmt.Sprintf("%d archive and transcript files belong to nothing; clean up orphaned_files to remove them", files.Count),
+		})
+	}
+	if drift := report.UsageDrift; drift.Count > 0 {
+		recommendations = append(recommendations, models.StorageRecommendation{
+			Kind:   CleanupUsageDrift,
+			Bytes:  drift.Bytes,
+			Detail: fmt.Sprintf("%d users are charged for more storage than their media takes; clean up usage_drift to correct their quotas", drift.Count),
+		})
+	}
+	if stale := report.StaleMedia; stale.Count > 0 && settings.RetentionDays == 0 {
+		recommendations = append(recommendations, models.StorageRecommendation{
+			Kind:   "retention",
+			Bytes:  stale.Bytes,
+			Detail: fmt.Sprintf("%d messages with media are over a year old and messages are kept for good; set retention_days in the workspace settings to delete old messages", stale.Count),
+		})
+	}
+	return recommendations
+}
+
+// walkArchiveFiles calls fn with each file in the archive directory, telling whether
+// it is orphaned: no archive or transcript in known refers to it and it is over
+// orphanedFileAge old
+func (h *Handler) walkArchiveFiles(fn func(path string, info os.FileInfo, orphaned bool), known map[uuid.UUID]bool) error {
+	entries, err := os.ReadDir(h.cfg.Media.ArchiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	cutoff := time.Now().Add(-orphanedFileAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		// Files are named after their archive or transcript, e.g. <id>.zip or <id>.zip.tmp
+		name, _, _ := strings.Cut(entry.Name(), ".")
+		id, err := uuid.Parse(name)
+		orphaned := (err != nil || !known[id]) && info.ModTime().Before(cutoff)
+		fn(filepath.Join(h.cfg.Media.ArchiveDir, entry.Name()), info, orphaned)
+	}
+	return nil
+}
+
+// removeOrphanedFiles removes the orphaned files of the archive directory, or only
+// counts them in a dry run
+func (h *Handler) removeOrphanedFiles(storageService *models.StorageService, dryRun bool) (models.ReclaimableStorage, error) {
+	var removed models.ReclaimableStorage
+	known, err := storageService.KnownFiles()
+	if err != nil {
+		return removed, err
+	}
+	err = h.walkArchiveFiles(func(path string, info os.FileInfo, orphaned bool) {
+		if !orphaned {
+			return
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				logger.Warn("Failed to remove orphaned file", map[string]interface{}{
+					"path":  path,
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+		removed.Bytes += info.Size()
+		removed.Count++
+	}, known)
+	return removed, err
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SupportInfo tells clients how to reach support
+type SupportInfo struct {
+	Enabled bool `json:"enabled"`
+	// UserID is the support account; a direct conversation with it is a support
+	// conversation
+	UserID   *uuid.UUID `json:"user_id,omitempty"`
+	Username string     `json:"username,omitempty"`
+	// Ticket is the state of the caller's own support conversation, once they wrote to it
+	Ticket *models.SupportTicket `json:"ticket,omitempty"`
+}
+
+// TransferSupportTicketRequest hands a ticket over to another agent
+type TransferSupportTicketRequest struct {
+	AgentID uuid.UUID `json:"agent_id" binding:"required"`
+}
+
+func (h *Handler) RegisterSupportRoutes(r *gin.RouterGroup) {
+	r.Use(h.AuthMiddleware())
+	{
+		r.GET("", h.GetSupport)
+		r.GET("/tickets", h.GetSupportTickets)
+		r.GET("/tickets/:id", h.GetSupportTicket)
+		r.POST("/tickets/:id/claim", h.ClaimSupportTicket)
+		r.POST("/tickets/:id/transfer", h.TransferSupportTicket)
+		r.POST("/tickets/:id/resolve", h.ResolveSupportTicket)
+	}
+}
+
+func (h *Handler) supportService() *models.SupportService {
+	team, _ := uuid.Parse(h.cfg.Support.TeamConversation)
+	return models.NewSupportService(h.db, h.encryptor, team, models.SupportSLA{
+		FirstResponse: h.cfg.Support.FirstResponseSLA,
+		Resolution:    h.cfg.Support.ResolutionSLA,
+	})
+}
+
+// EnsureSupportAccount creates or renames the support account when support is on
+func (h *Handler) EnsureSupportAccount() error {
+	if !h.cfg.Support.Enabled() {
+		return nil
+	}
+	return h.supportService().EnsureAccount(h.cfg.Support.Username)
+}
+
+// supportAgent returns the calling agent, answering 404 when support is off and 403 to
+// anyone who isn't an agent
+func (h *Handler) supportAgent(c *gin.Context) (uuid.UUID, bool) {
+	if !h.cfg.Support.Enabled() {
+		h.respondWithError(c, http.StatusNotFound, "Support is not enabled")
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return uuid.Nil, false
+	}
+	agent, err := h.supportService().IsAgent(userID)
+	if err != nil {
+		logger.Error("Failed to check support agent", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check support agent")
+		return uuid.Nil, false
+	}
+	if !agent {
+		h.respondWithError(c, http.StatusForbidden, "Only support agents can do this")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// @Summary Get support
+// @Description Get the support account, which users start a support conversation with by sending it a direct message, and the state of the caller's support conversation
+// @Tags support
+// @Produce json
+// @Success 200 {object} SupportInfo
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support [get]
+func (h *Handler) GetSupport(c *gin.Context) {
+	if !h.cfg.Support.Enabled() {
+		h.respondWithSuccess(c, http.StatusOK, SupportInfo{})
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	ticket, err := h.supportService().ForCustomer(userID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		logger.Error("Failed to get support ticket", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get support")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, SupportInfo{
+		Enabled:  true,
+		UserID:   &models.SupportBotID,
+		Username: h.cfg.Support.Username,
+		Ticket:   ticket,
+	})
+}
+
+// @Summary List support tickets
+// @Description List the support queue for agents, oldest first. Queued tickets wait for an agent to claim them.
+// @Tags support
+// @Produce json
+// @Param status query string false "queued (default), assigned or resolved"
+// @Param mine query bool false "Only list the tickets assigned to the caller"
+// @Param limit query int false "Number of tickets to return (default 50, max 100)"
+// @Param offset query int false "Number of tickets to skip (default 0)"
+// @Success 200 {array} models.SupportTicket
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support/tickets [get]
+func (h *Handler) GetSupportTickets(c *gin.Context) {
+	agentID, ok := h.supportAgent(c)
+	if !ok {
+		return
+	}
+	status := c.DefaultQuery("status", models.SupportQueued)
+	if status != models.SupportQueued && status != models.SupportAssigned && status != models.SupportResolved {
+		h.respondWithError(c, http.StatusBadRequest, "status must be queued, assigned or resolved")
+		return
+	}
+	var assignee *uuid.UUID
+	if c.Query("mine") == "true" {
+		assignee = &agentID
+	}
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	tickets, total, err := h.supportService().Queue(status, assignee, page.Limit, page.Offset)
+	if err != nil {
+		logger.Error("Failed to list support tickets", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to list support tickets")
+		return
+	}
+	setPageHeaders(c, page, len(tickets), total)
+	h.respondWithSuccess(c, http.StatusOK, tickets)
+}
+
+// @Summary Get a support ticket
+// @Description Get a support ticket, as an agent or as the customer it belongs to
+// @Tags support
+// @Produce json
+// @Param id path string true "Ticket ID"
+// @Success 200 {object} models.SupportTicket
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support/tickets/{id} [get]
+func (h *Handler) GetSupportTicket(c *gin.Context) {
+	if !h.cfg.Support.Enabled() {
+		h.respondWithError(c, http.StatusNotFound, "Support is not enabled")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	ticketID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid ticket ID")
+		return
+	}
+
+	supportService := h.supportService()
+	ticket, err := supportService.Get(ticketID)
+	if err != nil {
+		h.respondWithSupportError(c, err)
+		return
+	}
+	if ticket.CustomerID != userID {
+		agent, err := supportService.IsAgent(userID)
+		if err != nil {
+			h.respondWithSupportError(c, err)
+			return
+		}
+		// Tickets of others are hidden from non-agents as if they didn't exist
+		if !agent {
+			h.respondWithSupportError(c, models.ErrNotFound)
+			return
+		}
+	}
+	h.respondWithSuccess(c, http.StatusOK, ticket)
+}
+
+// @Summary Claim a support ticket
+// @Description Assign a queued ticket to the calling agent, who joins the support conversation to answer the customer
+// @Tags support
+// @Produce json
+// @Param id path string true "Ticket ID"
+// @Success 200 {object} models.SupportTicket
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support/tickets/{id}/claim [post]
+func (h *Handler) ClaimSupportTicket(c *gin.Context) {
+	agentID, ok := h.supportAgent(c)
+	if !ok {
+		return
+	}
+	ticketID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid ticket ID")
+		return
+	}
+
+	ticket, err := h.supportService().Claim(ticketID, agentID)
+	if err != nil {
+		h.respondWithSupportError(c, err)
+		return
+	}
+	logger.Info("Claimed support ticket", map[string]interface{}{
+		"ticket_id":       ticket.ID,
+		"conversation_id": ticket.ConversationID,
+		"agent_id":        agentID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, ticket)
+}
+
+// @Summary Transfer a support ticket
+// @Description Hand a ticket assigned to the caller over to another agent. The caller leaves the support conversation and the other agent joins it.
+// @Tags support
+// @Accept json
+// @Produce json
+// @Param id path string true "Ticket ID"
+// @Param transfer body TransferSupportTicketRequest true "Agent to transfer to"
+// @Success 200 {object} models.SupportTicket
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support/tickets/{id}/transfer [post]
+func (h *Handler) TransferSupportTicket(c *gin.Context) {
+	agentID, ok := h.supportAgent(c)
+	if !ok {
+		return
+	}
+	ticketID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid ticket ID")
+		return
+	}
+	var req TransferSupportTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ticket, err := h.supportService().Transfer(ticketID, agentID, req.AgentID)
+	if err != nil {
+		h.respondWithSupportError(c, err)
+		return
+	}
+	logger.Info("Transferred support ticket", map[string]interface{}{
+		"ticket_id":       ticket.ID,
+		"conversation_id": ticket.ConversationID,
+		"from_agent_id":   agentID,
+		"agent_id":        req.AgentID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, ticket)
+}
+
+// @Summary Resolve a support ticket
+// @Description Resolve a ticket assigned to the caller, who leaves the support conversation. The customer's next message queues the ticket again.
+// @Tags support
+// @Produce json
+// @Param id path string true "Ticket ID"
+// @Success 200 {object} models.SupportTicket
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /support/tickets/{id}/resolve [post]
+func (h *Handler) ResolveSupportTicket(c *gin.Context) {
+	agentID, ok := h.supportAgent(c)
+	if !ok {
+		return
+	}
+	ticketID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid ticket ID")
+		return
+	}
+
+	ticket, err := h.supportService().Resolve(ticketID, agentID)
+	if err != nil {
+		h.respondWithSupportError(c, err)
+		return
+	}
+	logger.Info("Resolved support ticket", map[string]interface{}{
+		"ticket_id":       ticket.ID,
+		"conversation_id": ticket.ConversationID,
+		"agent_id":        agentID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, ticket)
+}
+
+func (h *Handler) respondWithSupportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Ticket not found")
+	case errors.Is(err, models.ErrNotAgent):
+		h.respondWithError(c, http.StatusBadRequest, "Tickets can only be transferred to support agents")
+	case errors.Is(err, models.ErrTicketAssigned):
+		h.respondWithError(c, http.StatusConflict, "The ticket is assigned to another agent")
+	case errors.Is(err, models.ErrTicketSameAgent):
+		h.respondWithError(c, http.StatusConflict, "The ticket is already assigned to this agent")
+	case errors.Is(err, models.ErrTicketResolved):
+		h.respondWithError(c, http.StatusConflict, "The ticket is resolved")
+	case errors.Is(err, models.ErrTicketNotYours):
+		h.respondWithError(c, http.StatusConflict, "The ticket isn't assigned to you")
+	default:
+		logger.Error("Failed to manage support ticket", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage support ticket")
+	}
+}
+
+// CheckSupportSLA reports the support tickets whose SLA timers ran out
+func (h *Handler) CheckSupportSLA() error {
+	if !h.cfg.Support.Enabled() {
+		return nil
+	}
+	breached, err := h.supportService().MarkBreaches()
+	if err != nil {
+		return err
+	}
+	for _, ticket := range breached {
+		logger.Warn("Support ticket breached its SLA", map[string]interface{}{
+			"ticket_id":             ticket.ID,
+			"conversation_id":       ticket.ConversationID,
+			"status":                ticket.Status,
+			"agent_id":              ticket.AgentID,
+			"queued_at":             ticket.QueuedAt,
+			"first_response_due_at": ticket.FirstResponseDueAt,
+			"resolution_due_at":     ticket.ResolutionDueAt,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// maxTemplateParticipants bounds the users a template adds to every conversation
+const maxTemplateParticipants = 50
+
+// ConversationTemplateRequest defines a conversation template. Empty strings leave a
+// setting unset.
+type ConversationTemplateRequest struct {
+	Name        string  `json:"name" binding:"required,max=100" example:"Incident"`
+	Description *string `json:"description" example:"War room for production incidents"`
+	// NamePattern names the conversations; {title}, {creator} and {date} are filled in
+	NamePattern       string                       `json:"name_pattern" binding:"required,max=100" example:"Incident {date}: {title}"`
+	AvatarURL         *string                      `json:"avatar_url" example:"https://example.com/incident.png"`
+	AccentColor       *string                      `json:"accent_color" example:"#dc2626"`
+	Theme             *string                      `json:"theme" example:"alert"`
+	WelcomeMessage    *string                      `json:"welcome_message" example:"Post updates here. Keep chatter in the team channel."`
+	Rules             *string                      `json:"rules"`
+	HistoryVisibility *string                      `json:"history_visibility" example:"shared"`
+	Participants      []models.TemplateParticipant `json:"participants"`
+	Automations       []models.TemplateAutomation  `json:"automations"`
+}
+
+// ConversationTemplateSummary is what users see of a template when picking one. Its
+// participants and automations, webhook URLs included, are left to administrators.
+type ConversationTemplateSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name" example:"Incident"`
+	Description *string   `json:"description,omitempty"`
+	NamePattern string    `json:"name_pattern" example:"Incident {date}: {title}"`
+}
+
+// CreateFromTemplateRequest starts a conversation from a template
+type CreateFromTemplateRequest struct {
+	// Title fills in {title} in the template's name pattern
+	Title string `json:"title" binding:"max=100" example:"Checkout errors"`
+	// UserIDs are added on top of the template's participants
+	UserIDs []uuid.UUID `json:"user_ids" binding:"max=100"`
+}
+
+// CreateFromTemplateResponse is the new conversation along with the automations the
+// template set up on it. Webhook secrets are only shown here.
+type CreateFromTemplateResponse struct {
+	*models.Conversation
+	Automations []CreateAutomationResponse `json:"automations"`
+}
+
+// @Summary List conversation templates
+// @Description List the templates conversations can be created from
+// @Tags conversations
+// @Produce json
+// @Success 200 {array} ConversationTemplateSummary
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/templates [get]
+func (h *Handler) GetConversationTemplates(c *gin.Context) {
+	templateService := models.NewTemplateService(h.db)
+	templates, err := templateService.List()
+	if err != nil {
+		h.respondWithTemplateError(c, err)
+		return
+	}
+
+	summaries := make([]ConversationTemplateSummary, len(templates))
+	for i, template := range templates {
+		summaries[i] = ConversationTemplateSummary{
+			ID:          template.ID,
+			Name:        template.Name,
+			Description: template.Description,
+			NamePattern: template.NamePattern,
+		}
+	}
+	h.respondWithSuccess(c, http.StatusOK, summaries)
+}
+
+// @Summary Create a conversation from a template
+// @Description Start a group from a template: it is named after the template's pattern, gets the template's participants and roles, settings and automations, and its welcome message is posted. The caller owns the group.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param request body CreateFromTemplateRequest true "Title and extra participants"
+// @Success 201 {object} CreateFromTemplateResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/from-template/{id} [post]
+func (h *Handler) CreateConversationFromTemplate(c *gin.Context) {
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req CreateFromTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if !h.mayCreateGroup(c, userID) {
+		return
+	}
+
+	templateService := models.NewTemplateService(h.db)
+	template, err := templateService.GetByID(templateID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Template not found")
+			return
+		}
+		logger.Error("Failed to get conversation template", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create conversation")
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	creator, err := userService.GetByID(userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// The template's participants come first; whoever creates the group owns it
+	input := &models.CreateConversationInput{Group: true, Roles: map[uuid.UUID]string{}}
+	seen := map[uuid.UUID]bool{userID: true}
+	for _, participant := range template.Participants {
+		if !seen[participant.UserID] {
+			seen[participant.UserID] = true
+			input.UserIDs = append(input.UserIDs, participant.UserID)
+			input.Roles[participant.UserID] = participant.Role
+		}
+	}
+	for _, id := range req.UserIDs {
+		if !seen[id] {
+			seen[id] = true
+			input.UserIDs = append(input.UserIDs, id)
+		}
+	}
+	name := template.ConversationName(strings.TrimSpace(req.Title), creator.Username, time.Now())
+	input.Name = &name
+
+	conversationService := h.conversationService()
+	conversation, err := conversationService.Create(userID, input)
+	if err != nil {
+		if h.respondWithConversationLimit(c, userID, err) {
+			return
+		}
+		if errors.Is(err, models.ErrUserNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "One or more users not found")
+			return
+		}
+		if errors.Is(err, models.ErrGroupFull) {
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Groups can have at most %d participants", h.cfg.Group.MaxParticipants))
+			return
+		}
+		logger.Error("Failed to create conversation from template", err, map[string]interface{}{
+			"template_id": templateID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create conversation")
+		return
+	}
+
+	automations, err := h.applyTemplate(conversation.ID, userID, template)
+	if err != nil {
+		// Don't leave a half set up group behind
+		if deleteErr := conversationService.SoftDelete(conversation.ID, userID); deleteErr != nil {
+			logger.Error("Failed to remove conversation after template failure", deleteErr, map[string]interface{}{
+				"conversation_id": conversation.ID,
+			})
+		}
+		logger.Error("Failed to apply conversation template", err, map[string]interface{}{
+			"template_id":     templateID,
+			"conversation_id": conversation.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create conversation")
+		return
+	}
+
+	if template.WelcomeMessage != nil {
+		h.postSystemMessage(conversation.ID, userID, *template.WelcomeMessage)
+	}
+
+	if updated, err := conversationService.GetByID(conversation.ID); err == nil {
+		conversation = updated
+	}
+	logger.Info("Created conversation from template", map[string]interface{}{
+		"audit":           true,
+		"action":          "conversation.create_from_template",
+		"user_id":         userID,
+		"template_id":     templateID,
+		"conversation_id": conversation.ID,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, CreateFromTemplateResponse{Conversation: conversation, Automations: automations})
+}
+
+// applyTemplate gives a new group the template's settings and automations, on behalf
+// of its owner
+func (h *Handler) applyTemplate(conversationID, ownerID uuid.UUID, template *models.ConversationTemplate) ([]CreateAutomationResponse, error) {
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	err := conversationService.UpdateSettings(conversationID, ownerID, models.ConversationSettings{
+		AvatarURL:         template.AvatarURL,
+		AccentColor:       template.AccentColor,
+		Theme:             template.Theme,
+		WelcomeMessage:    template.WelcomeMessage,
+		Rules:             template.Rules,
+		HistoryVisibility: template.HistoryVisibility,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	automationService := models.NewAutomationService(h.db, h.encryptor)
+	created := []CreateAutomationResponse{}
+	for _, preset := range template.Automations {
+		automation := &models.Automation{
+			ConversationID: conversationID,
+			Event:          preset.Event,
+			Action:         preset.Action,
+			Message:        preset.Message,
+			WebhookURL:     preset.WebhookURL,
+		}
+		secret, err := automationService.Create(ownerID, automation, h.cfg.Automation.MaxPerConversation)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, CreateAutomationResponse{Automation: *automation, WebhookSecret: secret})
+	}
+	return created, nil
+}
+
+// @Summary List conversation templates
+// @Description List every conversation template with everything it sets up
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.ConversationTemplate
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversation-templates [get]
+func (h *Handler) AdminGetConversationTemplates(c *gin.Context) {
+	templateService := models.NewTemplateService(h.db)
+	templates, err := templateService.List()
+	if err != nil {
+		h.respondWithTemplateError(c, err)
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, templates)
+}
+
+// @Summary Create a conversation template
+// @Description Define a preset for groups that are created the same way again and again, such as support or incident channels: a name pattern, participants and their roles, settings, a welcome message and automations.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param template body ConversationTemplateRequest true "Template"
+// @Success 201 {object} models.ConversationTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversation-templates [post]
+func (h *Handler) CreateConversationTemplate(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	template, ok := h.bindConversationTemplate(c)
+	if !ok {
+		return
+	}
+	template.CreatedBy = &adminID
+
+	templateService := models.NewTemplateService(h.db)
+	if err := templateService.Create(template); err != nil {
+		h.respondWithTemplateError(c, err)
+		return
+	}
+
+	logger.Info("Created conversation template", map[string]interface{}{
+		"audit":       true,
+		"action":      "conversation_template.create",
+		"admin_id":    adminID,
+		"template_id": template.ID,
+	})
+	h.respondWithSuccess(c, http.StatusCreated, template)
+}
+
+// @Summary Update a conversation template
+// @Description Replace a conversation template. Conversations already created from it are left as they are.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param template body ConversationTemplateRequest true "Template"
+// @Success 200 {object} models.ConversationTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversation-templates/{id} [put]
+func (h *Handler) UpdateConversationTemplate(c *gin.Context) {
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+	template, ok := h.bindConversationTemplate(c)
+	if !ok {
+		return
+	}
+	template.ID = templateID
+
+	templateService := models.NewTemplateService(h.db)
+	if err := templateService.Update(template); err != nil {
+		h.respondWithTemplateError(c, err)
+		return
+	}
+
+	logger.Info("Updated conversation template", map[string]interface{}{
+		"audit":       true,
+		"action":      "conversation_template.update",
+		"admin_id":    c.GetHeader("X-User-ID"),
+		"template_id": templateID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, template)
+}
+
+// @Summary Delete a conversation template
+// @Description Remove a conversation template. Conversations already created from it are left as they are.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/conversation-templates/{id} [delete]
+func (h *Handler) DeleteConversationTemplate(c *gin.Context) {
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	templateService := models.NewTemplateService(h.db)
+	if err := templateService.Delete(templateID); err != nil {
+		h.respondWithTemplateError(c, err)
+		return
+	}
+
+	logger.Info("Deleted conversation template", map[string]interface{}{
+		"audit":       true,
+		"action":      "conversation_template.delete",
+		"admin_id":    c.GetHeader("X-User-ID"),
+		"template_id": templateID,
+	})
+	h.respondWithSuccess(c, http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// bindConversationTemplate reads and checks a template definition, answering 400 when
+// it is invalid
+func (h *Handler) bindConversationTemplate(c *gin.Context) (*models.ConversationTemplate, bool) {
+	var req ConversationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return nil, false
+	}
+
+	template := &models.ConversationTemplate{
+		Name:              strings.TrimSpace(req.Name),
+		Description:       emptyToNil(req.Description),
+		NamePattern:       strings.TrimSpace(req.NamePattern),
+		AvatarURL:         emptyToNil(req.AvatarURL),
+		AccentColor:       emptyToNil(req.AccentColor),
+		Theme:             emptyToNil(req.Theme),
+		WelcomeMessage:    emptyToNil(req.WelcomeMessage),
+		Rules:             emptyToNil(req.Rules),
+		HistoryVisibility: emptyToNil(req.HistoryVisibility),
+		Participants:      req.Participants,
+		Automations:       req.Automations,
+	}
+	if msg := h.validateConversationTemplate(template); msg != "" {
+		h.respondWithError(c, http.StatusBadRequest, msg)
+		return nil, false
+	}
+	return template, true
+}
+
+// validateConversationTemplate returns a message describing the first problem with a
+// template, if any
+func (h *Handler) validateConversationTemplate(template *models.ConversationTemplate) string {
+	if template.Name == "" || template.NamePattern == "" {
+		return "name and name_pattern must not be blank"
+	}
+	if msg := validateConversationSettings(&UpdateConversationSettingsRequest{
+		AvatarURL:         template.AvatarURL,
+		AccentColor:       template.AccentColor,
+		Theme:             template.Theme,
+		WelcomeMessage:    template.WelcomeMessage,
+		Rules:             template.Rules,
+		HistoryVisibility: template.HistoryVisibility,
+	}); msg != "" {
+		return msg
+	}
+
+	if len(template.Participants) > maxTemplateParticipants {
+		return fmt.Sprintf("A template can add at most %d participants", maxTemplateParticipants)
+	}
+	ids := make([]uuid.UUID, 0, len(template.Participants))
+	seen := map[uuid.UUID]bool{}
+	for _, participant := range template.Participants {
+		if participant.Role != "admin" && participant.Role != "member" {
+			return "Participant roles must be admin or member"
+		}
+		if seen[participant.UserID] {
+			return "Participants must not repeat"
+		}
+		seen[participant.UserID] = true
+		ids = append(ids, participant.UserID)
+	}
+	if len(ids) > 0 {
+		userService := models.NewUserService(h.db, h.encryptor)
+		users, err := userService.GetByIDs(ids)
+		if err != nil || len(users) != len(ids) {
+			return "One or more participants not found"
+		}
+	}
+
+	if len(template.Automations) > h.cfg.Automation.MaxPerConversation {
+		return fmt.Sprintf("A conversation can have at most %d automations", h.cfg.Automation.MaxPerConversation)
+	}
+	for _, automation := range template.Automations {
+		if automation.Event != models.AutomationParticipantJoined && automation.Event != models.AutomationParticipantLeft {
+			return "Automation events must be participant.joined or participant.left"
+		}
+		switch automation.Action {
+		case models.AutomationPostMessage:
+			if automation.Message == nil || strings.TrimSpace(*automation.Message) == "" || len(*automation.Message) > 2000 {
+				return "post_message automations need a message of at most 2000 characters"
+			}
+		case models.AutomationWebhook:
+			if automation.WebhookURL == nil || h.webhooks.Check(*automation.WebhookURL) != nil {
+				return "webhook automations need an HTTPS URL on an allowed host"
+			}
+		default:
+			return "Automation actions must be post_message or webhook"
+		}
+	}
+	return ""
+}
+
+func (h *Handler) respondWithTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		h.respondWithError(c, http.StatusNotFound, "Template not found")
+	case errors.Is(err, models.ErrConflict):
+		h.respondWithError(c, http.StatusConflict, "A template with this name already exists")
+	default:
+		logger.Error("Failed to manage conversation templates", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to manage templates")
+	}
+}
+
+// emptyToNil treats an empty or blank string as unset
+func emptyToNil(s *string) *string {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/media"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/transcript"
+	"talkify/apps/api/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// transcriptBuildTimeout bounds how long rendering one transcript may take
+	transcriptBuildTimeout = 30 * time.Minute
+	// transcriptImageMaxBytes bounds the avatar and each thumbnail fetched for a transcript
+	transcriptImageMaxBytes = 10 << 20
+	// Images are scaled to these sides, in pixels, before they are embedded
+	transcriptAvatarSide    = 160
+	transcriptThumbnailSide = 480
+)
+
+// transcriptAttachments name the media a message was sent with in transcripts
+var transcriptAttachments = map[string]string{
+	string(models.ImageMessage):    "Image",
+	string(models.VideoMessage):    "Video",
+	string(models.AudioMessage):    "Audio",
+	string(models.FileMessage):     "File",
+	string(models.LocationMessage): "Location",
+}
+
+// CreateTranscriptExportRequest is the part of a conversation to export. Without from
+// and to the whole conversation is exported.
+type CreateTranscriptExportRequest struct {
+	// From is the first moment covered
+	From *time.Time `json:"from" example:"2026-01-01T00:00:00Z"`
+	// To is the end of the range, which isn't covered itself
+	To *time.Time `json:"to" example:"2026-02-01T00:00:00Z"`
+	// Timezone shows times in this IANA zone instead of the user's
+	Timezone string `json:"timezone" example:"Europe/Berlin"`
+}
+
+// TranscriptExportResponse is a transcript export, with a link to download it once it's
+// ready
+type TranscriptExportResponse struct {
+	models.TranscriptExport
+	// DownloadURL serves the transcript without further credentials until
+	// DownloadExpiresAt; it is only offered when signed URLs are configured
+	DownloadURL       string     `json:"download_url,omitempty" example:"/api/transcripts/123e4567-e89b-12d3-a456-426614174000/download?expires=1700000000&signature=..."`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+func (h *Handler) RegisterTranscriptRoutes(r *gin.RouterGroup) {
+	// Signed URLs carry their own authorization, so they can be handed to a browser
+	r.GET("/:id/download", h.GetSignedTranscript)
+}
+
+// @Summary Export a conversation transcript
+// @Description Start rendering a PDF transcript of the conversation, or of the messages sent from from until to, with times in the user's timezone or the one given. Transcripts show who sent each message and when, with sender avatars, thumbnails of media and reactions, and leave out deleted messages and those from before the user could see history. Poll the returned export until it is ready, then download it. At most 10000 messages are exported at once; export longer conversations a date range at a time. The workspace settings may leave exporting to the owners and admins of groups, or to nobody.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body CreateTranscriptExportRequest false "Date range and timezone"
+// @Success 202 {object} TranscriptExportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/exports [post]
+func (h *Handler) CreateTranscriptExport(c *gin.Context) {
+	conversationID, userID, ok := h.fileAccess(c)
+	if !ok || !h.mayExport(c, conversationID, userID) {
+		return
+	}
+	var req CreateTranscriptExportRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+			return
+		}
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		h.respondWithError(c, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	timezone := req.Timezone
+	if timezone == "" {
+		var err error
+		if timezone, err = models.NewUserService(h.db, h.encryptor).Timezone(userID); err != nil {
+			logger.Error("Failed to get timezone", err, map[string]interface{}{
+				"user_id": userID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to create transcript export")
+			return
+		}
+	}
+	if _, err := time.LoadLocation(timezone); err != nil || len(timezone) > 64 {
+		h.respondWithError(c, http.StatusBadRequest, "timezone must be an IANA timezone such as Europe/Berlin")
+		return
+	}
+
+	exportService := models.NewTranscriptExportService(h.db, h.encryptor)
+	export, created, err := exportService.Create(conversationID, userID, req.From, req.To, timezone, h.cfg.Media.ArchiveTTL)
+	if err != nil {
+		logger.Error("Failed to create transcript export", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create transcript export")
+		return
+	}
+
+	if created {
+		job := *export
+		h.workerPool.Submit(worker.Task{
+			Name:    "transcript_export",
+			Handler: func() error { return h.buildTranscript(&job) },
+		})
+	}
+
+	h.respondWithSuccess(c, http.StatusAccepted, h.transcriptExportResponse(export))
+}
+
+// @Summary Get a transcript export
+// @Description Get the status of a transcript requested with POST /conversations/{id}/exports. Once it is ready, download_url serves it for a few minutes without further credentials, for handing to a browser.
+// @Tags conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param export_id path string true "Export ID"
+// @Success 200 {object} TranscriptExportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/exports/{export_id} [get]
+func (h *Handler) GetTranscriptExport(c *gin.Context) {
+	export, ok := h.requestedTranscript(c)
+	if !ok {
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, h.transcriptExportResponse(export))
+}
+
+// @Summary Download a transcript export
+// @Description Download a transcript once its status is ready
+// @Tags conversations
+// @Produce application/pdf
+// @Param id path string true "Conversation ID"
+// @Param export_id path string true "Export ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/exports/{export_id}/download [get]
+func (h *Handler) DownloadTranscriptExport(c *gin.Context) {
+	export, ok := h.requestedTranscript(c)
+	if !ok {
+		return
+	}
+	h.sendTranscript(c, export)
+}
+
+// @Summary Download a transcript through a signed URL
+// @Description Download a transcript using the download_url of its export. No other credentials are needed until the URL expires.
+// @Tags conversations
+// @Produce application/pdf
+// @Param id path string true "Export ID"
+// @Param expires query int true "Expiry as a Unix timestamp"
+// @Param signature query string true "URL signature"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Router /transcripts/{id}/download [get]
+func (h *Handler) GetSignedTranscript(c *gin.Context) {
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	if h.mediaSigner == nil {
+		h.respondWithError(c, http.StatusForbidden, "Invalid signature")
+		return
+	}
+	err = h.mediaSigner.Verify(transcriptSignatureID(exportID), c.Query("expires"), c.Query("signature"))
+	switch {
+	case errors.Is(err, media.ErrURLExpired):
+		h.respondWithError(c, http.StatusGone, "Signed URL has expired")
+		return
+	case err != nil:
+		h.respondWithError(c, http.StatusForbidden, "Invalid signature")
+		return
+	}
+
+	export, err := models.NewTranscriptExportService(h.db, h.encryptor).Get(exportID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Transcript not found")
+			return
+		}
+		logger.Error("Failed to get transcript export", err, map[string]interface{}{
+			"export_id": exportID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get transcript export")
+		return
+	}
+	h.sendTranscript(c, export)
+}
+
+// transcriptExportResponse adds a signed download link to a ready export
+func (h *Handler) transcriptExportResponse(export *models.TranscriptExport) TranscriptExportResponse {
+	response := TranscriptExportResponse{TranscriptExport: *export}
+	if export.Status != models.ArchiveReady || h.mediaSigner == nil {
+		return response
+	}
+	signature, expiresAt := h.mediaSigner.Sign(transcriptSignatureID(export.ID))
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", signature)
+	response.DownloadURL = "/api/transcripts/" + export.ID.String() + "/download?" + query.Encode()
+	response.DownloadExpiresAt = &expiresAt
+	return response
+}
+
+// transcriptSignatureID is what download links of an export are signed for. Media URLs
+// are signed for message IDs, so the prefix keeps one from being passed off as the other.
+func transcriptSignatureID(exportID uuid.UUID) string {
+	return "transcript:" + exportID.String()
+}
+
+// requestedTranscript loads the export named in the path. Transcripts hold what their
+// requester could see, so nobody else gets them.
+func (h *Handler) requestedTranscript(c *gin.Context) (*models.TranscriptExport, bool) {
+	conversationID, userID, ok := h.fileAccess(c)
+	if !ok {
+		return nil, false
+	}
+
+	exportID, err := uuid.Parse(c.Param("export_id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid export ID")
+		return nil, false
+	}
+
+	export, err := models.NewTranscriptExportService(h.db, h.encryptor).Get(exportID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "Transcript not found")
+			return nil, false
+		}
+		logger.Error("Failed to get transcript export", err, map[string]interface{}{
+			"export_id": exportID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get transcript export")
+		return nil, false
+	}
+	if export.ConversationID != conversationID || export.RequestedBy != userID {
+		h.respondWithError(c, http.StatusNotFound, "Transcript not found")
+		return nil, false
+	}
+	return export, true
+}
+
+// sendTranscript decrypts a ready transcript to the client
+func (h *Handler) sendTranscript(c *gin.Context, export *models.TranscriptExport) {
+	if export.Status != models.ArchiveReady {
+		h.respondWithError(c, http.StatusConflict, "Transcript is not ready")
+		return
+	}
+
+	dataKey, err := h.encryptor.UnwrapDataKey(*export.DataKey, *export.KeyID)
+	if err != nil {
+		logger.Error("Failed to unwrap transcript key", err, map[string]interface{}{
+			"export_id": export.ID,
+			"key_id":    *export.KeyID,
+		})
+		h.respondWithError(c, http.StatusGone, "Transcript can no longer be decrypted. Request a new one.")
+		return
+	}
+	file, err := os.Open(h.transcriptPath(export.ID))
+	if err != nil {
+		h.respondWithError(c, http.StatusNotFound, "Transcript not found")
+		return
+	}
+	defer file.Close()
+	reader, err := encryption.NewBlobReader(file, dataKey)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to read transcript")
+		return
+	}
+
+	// Long transcripts can take longer to send than the server's write timeout allows
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	fileName := fmt.Sprintf("transcript-%s%s", export.ConversationID, h.transcripts.Extension())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.DataFromReader(http.StatusOK, export.SizeBytes, h.transcripts.ContentType(), reader, nil)
+	if err := c.Errors.Last(); err != nil {
+		// Headers are sent by now, so the client only sees the download cut short
+		logger.Error("Failed to send transcript", err.Err, map[string]interface{}{
+			"export_id": export.ID,
+		})
+	}
+}
+
+func (h *Handler) transcriptPath(exportID uuid.UUID) string {
+	return filepath.Join(h.cfg.Media.ArchiveDir, exportID.String()+h.transcripts.Extension())
+}
+
+// buildTranscript renders the transcript of an export and records the outcome
+func (h *Handler) buildTranscript(export *models.TranscriptExport) error {
+	exportService := models.NewTranscriptExportService(h.db, h.encryptor)
+	messageCount, size, err := h.writeTranscript(export)
+	if err != nil {
+		reason := "Failed to render transcript"
+		if errors.Is(err, models.ErrInvalidInput) {
+			reason = fmt.Sprintf("The transcript would have over %d messages. Export a shorter date range.", models.MaxTranscriptMessages)
+		}
+		if failErr := exportService.Fail(export.ID, reason); failErr != nil {
+			logger.Error("Failed to mark transcript export failed", failErr, map[string]interface{}{
+				"export_id": export.ID,
+			})
+		}
+		return errors.Wrap(err, "failed to build transcript")
+	}
+
+	logger.Info("Built transcript", map[string]interface{}{
+		"export_id":       export.ID,
+		"conversation_id": export.ConversationID,
+		"messages":        messageCount,
+		"bytes":           size,
+	})
+	export.MessageCount, export.SizeBytes = messageCount, size
+	return exportService.Complete(export)
+}
+
+func (h *Handler) writeTranscript(export *models.TranscriptExport) (messageCount int, size int64, err error) {
+	exportService := models.NewTranscriptExportService(h.db, h.encryptor)
+	source, err := exportService.Source(export, models.MaxTranscriptMessages)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcriptBuildTimeout)
+	defer cancel()
+	doc := h.transcriptDocument(ctx, export, source)
+
+	if err := os.MkdirAll(h.cfg.Media.ArchiveDir, 0700); err != nil {
+		return 0, 0, err
+	}
+	// Render under a temporary name so a half-written transcript is never served
+	finalPath := h.transcriptPath(export.ID)
+	tmpPath := finalPath + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	// Like file archives, each transcript is encrypted at rest with its own data key
+	dataKey, wrappedKey, err := h.encryptor.NewDataKey()
+	if err != nil {
+		return 0, 0, err
+	}
+	sealed, err := encryption.NewBlobWriter(out, dataKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	plain := &countingWriter{w: sealed}
+	if err := h.transcripts.Render(plain, doc); err != nil {
+		return 0, 0, err
+	}
+	if err := sealed.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return 0, 0, err
+	}
+	keyID := h.encryptor.KeyID()
+	export.DataKey, export.KeyID = &wrappedKey, &keyID
+	return len(source.Messages), plain.n, nil
+}
+
+// transcriptDocument lays out the messages of an export for rendering. Images that
+// can't be fetched or decoded are left out.
+func (h *Handler) transcriptDocument(ctx context.Context, export *models.TranscriptExport, source *models.TranscriptSource) *transcript.Document {
+	location, _ := time.LoadLocation(export.Timezone)
+	if location == nil {
+		location = time.UTC
+	}
+	conversation := source.Conversation
+
+	title := "Group conversation"
+	switch {
+	case conversation.Name != nil && strings.TrimSpace(*conversation.Name) != "":
+		title = *conversation.Name
+	case conversation.Type == "direct" && len(source.Others) > 0:
+		title = "Conversation with " + strings.Join(source.Others, ", ")
+	case conversation.Unnamed() && conversation.ParticipantCount > 0:
+		title = h.groupName(export.RequestedBy, &models.GroupNameSource{Sample: conversation.NameSample, ParticipantCount: conversation.ParticipantCount})
+	}
+
+	day := func(t *time.Time) string { return t.In(location).Format("2 Jan 2006 15:04") }
+	covered := "All messages"
+	switch {
+	case export.From != nil && export.To != nil:
+		covered = fmt.Sprintf("Messages from %s to %s", day(export.From), day(export.To))
+	case export.From != nil:
+		covered = "Messages since " + day(export.From)
+	case export.To != nil:
+		covered = "Messages before " + day(export.To)
+	}
+
+	doc := &transcript.Document{
+		Title:       title,
+		Subtitle:    fmt.Sprintf("%s · %d messages · times in %s", covered, len(source.Messages), export.Timezone),
+		GeneratedAt: time.Now(),
+		Location:    location,
+		Entries:     make([]transcript.Entry, len(source.Messages)),
+	}
+	if conversation.AvatarURL != nil {
+		doc.Avatar = h.transcriptImage(ctx, *conversation.AvatarURL, transcriptAvatarSide)
+	}
+
+	for i, message := range source.Messages {
+		entry := transcript.Entry{
+			Sender:     message.SenderUsername,
+			SentAt:     message.CreatedAt,
+			Text:       message.Content,
+			System:     message.MessageType == string(models.SystemMessage),
+			Edited:     message.IsEdited,
+			Attachment: transcriptAttachments[message.MessageType],
+		}
+		if message.ViewOnce && entry.Attachment != "" {
+			entry.Attachment += " (view once, not included)"
+		}
+
+		preview := message.MediaThumbnailURL
+		if preview == nil && message.MessageType == string(models.ImageMessage) {
+			preview = message.MediaURL
+		}
+		if preview != nil {
+			entry.Thumbnail = h.transcriptImage(ctx, *preview, transcriptThumbnailSide)
+		}
+
+		counts := make(map[string]int)
+		for _, reaction := range message.Reactions {
+			if counts[reaction.Emoji] == 0 {
+				entry.Reactions = append(entry.Reactions, transcript.Reaction{Emoji: reaction.Emoji})
+			}
+			counts[reaction.Emoji]++
+		}
+		for j := range entry.Reactions {
+			entry.Reactions[j].Count = counts[entry.Reactions[j].Emoji]
+		}
+		doc.Entries[i] = entry
+	}
+	return doc
+}
+
+// transcriptImage fetches an image for a transcript, returning nil when it can't be
+// fetched, is too large or isn't an image
+func (h *Handler) transcriptImage(ctx context.Context, rawURL string, side int) *transcript.Image {
+	body, err := h.mediaFetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	// Read one byte past the limit to tell an exact fit from an overflow
+	data, err := io.ReadAll(io.LimitReader(body, transcriptImageMaxBytes+1))
+	if err != nil || len(data) > transcriptImageMaxBytes {
+		return nil
+	}
+	img, err := transcript.NewImage(data, side)
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// PurgeExpiredTranscripts deletes transcript exports past their expiry with their files.
+// Files of purged conversations are left to PurgeExpiredArchives, which clears the
+// directory they share with file archives.
+func (h *Handler) PurgeExpiredTranscripts() error {
+	ids, err := models.NewTranscriptExportService(h.db, h.encryptor).PurgeExpired()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := os.Remove(h.transcriptPath(id)); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove transcript", map[string]interface{}{
+				"export_id": id,
+				"error":     err.Error(),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// typingInterval is how often a participant may say they are typing in a
+	// conversation. Clients keep an indicator up for typingTTL, so one request every
+	// interval keeps it showing.
+	typingInterval = 3 * time.Second
+	typingTTL      = 6 * time.Second
+	// maxTypingSenders bounds the participants whose typing is tracked in memory
+	maxTypingSenders = 100000
+)
+
+// TypingRequest says whether the user is typing in a conversation
+type TypingRequest struct {
+	// Typing is false once the user stopped typing; it defaults to true
+	Typing *bool `json:"typing"`
+}
+
+// typingThrottle remembers when each participant last said they were typing
+type typingThrottle struct {
+	mu      sync.Mutex
+	senders map[string]time.Time
+}
+
+// take reports whether a typing event by key is sent at now, and when a start isn't,
+// how long to wait. Only starts are throttled; a stop is sent once after each start.
+func (t *typingThrottle) take(key string, typing bool, now time.Time) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.senders[key]
+	if !typing {
+		delete(t.senders, key)
+		return ok, 0
+	}
+	if ok && now.Sub(last) < typingInterval {
+		return false, typingInterval - now.Sub(last)
+	}
+	if t.senders == nil || len(t.senders) >= maxTypingSenders {
+		t.senders = make(map[string]time.Time)
+	}
+	t.senders[key] = now
+	return true, 0
+}
+
+// @Summary Say the user is typing
+// @Description Tell the other participants of a conversation that the user is typing, or stopped, for clients without a WebSocket connection. Participants get a typing_start event, or typing_stop; an indicator expires at expires_at, so send typing about every 3 seconds while the user types. Faster requests are refused with 429 and a Retry-After header; a stop is only sent to participants after a start. Nobody is told in large groups, and participants the group does not let send are refused.
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param typing body TypingRequest false "Whether the user is typing"
+// @Success 202 {object} TypingEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/typing [post]
+func (h *Handler) SendTyping(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	var req TypingRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+			return
+		}
+	}
+	typing := req.Typing == nil || *req.Typing
+
+	event, wait, err := h.sendTyping(conversationID, userID, typing, time.Now())
+	switch {
+	case errors.Is(err, models.ErrInvalidParticipant):
+		h.respondWithError(c, http.StatusForbidden, "User is not a participant in this conversation")
+		return
+	case err != nil:
+		h.respondToPermission(c, err, "Conversation not found", models.ActionSend)
+		return
+	case wait > 0:
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		h.respondWithError(c, http.StatusTooManyRequests, "Typing is sent too often")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusAccepted, event)
+}
+
+// socketTyping sends typing said over a WebSocket connection, which has nobody to tell
+// when it is refused
+func (h *Handler) socketTyping(conversationID, userID uuid.UUID, typing bool) {
+	_, _, err := h.sendTyping(conversationID, userID, typing, time.Now())
+	switch {
+	case err == nil,
+		errors.Is(err, models.ErrInvalidParticipant),
+		errors.Is(err, models.ErrConversationNotFound),
+		errors.Is(err, models.ErrPermissionDenied),
+		errors.Is(err, models.ErrConversationLocked):
+	default:
+		logger.Error("Failed to send typing", err, map[string]interface{}{
+			"conversation_id": conversationID,
+		})
+	}
+}
+
+// sendTyping tells the other participants of a conversation whether userID is typing,
+// provided the group's permissions let them send. A start sent too soon after the last
+// is dropped, and how long to wait is returned instead.
+func (h *Handler) sendTyping(conversationID, userID uuid.UUID, typing bool, now time.Time) (TypingEvent, time.Duration, error) {
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	if err := conversationService.CheckPermission(conversationID, userID, models.ActionSend); err != nil {
+		return TypingEvent{}, 0, err
+	}
+	recipients, err := conversationService.TypingRecipients(conversationID, userID)
+	if err != nil {
+		return TypingEvent{}, 0, err
+	}
+
+	send, wait := h.typing.take(userID.String()+":"+conversationID.String(), typing, now)
+	if !send && typing {
+		return TypingEvent{}, wait, nil
+	}
+
+	event := TypingEvent{ConversationID: conversationID, UserID: userID, IsTyping: typing}
+	if typing {
+		expiresAt := now.Add(typingTTL)
+		event.ExpiresAt = &expiresAt
+	}
+	if send {
+		eventType := EventTypingStop
+		if typing {
+			eventType = EventTypingStart
+		}
+		h.publishToUsers(recipients, eventType, event)
+	}
+	return event, 0, nil
+}
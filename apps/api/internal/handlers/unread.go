@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// @Summary Get unread counts
+// @Description Get how many messages the user has not read in each conversation that has any, and in total, for badges. Counts are kept as messages arrive and are read, so this is cheap enough to poll.
+// @Tags conversations
+// @Produce json
+// @Success 200 {object} models.UnreadSummary
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/unread [get]
+func (h *Handler) GetUnreadSummary(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	summary, err := models.NewConversationService(h.db, h.encryptor).GetUnreadSummary(userID)
+	if err != nil {
+		logger.Error("Failed to get unread counts", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get unread counts")
+		return
+	}
+	h.shadowRead(shadowReadUnread, userID, nil)
+	h.respondWithSuccess(c, http.StatusOK, summary)
+}
+
+// @Summary Poll for new messages
+// @Description Answer with headers only, for clients too constrained to fetch conversations to find out whether anything changed: X-Unread-Count is how many messages the user has not read across their conversations, and X-Last-Message-At when the latest message in any of them was sent, omitted while there are none. Both are read from counters kept up to date, so this is cheap to poll.
+// @Tags conversations
+// @Success 200 "X-Unread-Count and X-Last-Message-At headers"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations [head]
+func (h *Handler) HeadUserConversations(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	counters, err := models.NewConversationService(h.db, h.encryptor).GetUnreadCounters(userID)
+	if err != nil {
+		logger.Error("Failed to get unread counters", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get unread counts")
+		return
+	}
+	h.shadowRead(shadowReadUnreadCounters, userID, nil)
+	respondWithCounters(c, counters)
+}
+
+// @Summary Poll a conversation for new messages
+// @Description Answer with headers only, for clients too constrained to fetch messages to find out whether the conversation changed: X-Unread-Count is how many of its messages the user has not read, and X-Last-Message-At when its latest message was sent, omitted while there is none.
+// @Tags conversations
+// @Param id path string true "Conversation ID"
+// @Success 200 "X-Unread-Count and X-Last-Message-At headers"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /conversations/{id}/messages [head]
+func (h *Handler) HeadConversationMessages(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	conversationService := models.NewConversationService(h.db, h.encryptor)
+	counters, err := conversationService.GetConversationUnreadCounters(conversationID, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.respondWithError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get unread counters", err, map[string]interface{}{
+			"user_id":         userID,
+			"conversation_id": conversationID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get unread counts")
+		return
+	}
+	h.shadowRead(shadowReadUnreadCounters, userID, []uuid.UUID{conversationID})
+	respondWithCounters(c, counters)
+}
+
+// respondWithCounters answers a poll with the counters as headers and no body
+func respondWithCounters(c *gin.Context, counters *models.UnreadCounters) {
+	c.Header("X-Unread-Count", strconv.Itoa(counters.UnreadCount))
+	if counters.LastMessageAt != nil {
+		c.Header("X-Last-Message-At", counters.LastMessageAt.UTC().Format(time.RFC3339Nano))
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusOK)
+}
+
+// ReconcileUnreadCounts corrects unread counters that drifted from the messages
+func (h *Handler) ReconcileUnreadCounts() error {
+	corrected, err := models.NewConversationService(h.db, h.encryptor).ReconcileUnreadCounts()
+	if err != nil {
+		return err
+	}
+	if corrected > 0 {
+		logger.Warn("Corrected drifted unread counts", map[string]interface{}{
+			"corrected": corrected,
+		})
+	}
+	return nil
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"talkify/apps/api/internal/logger"
 	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/presence"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,25 +21,73 @@ type UpdateUserRequest struct {
 	Email    string `json:"email" binding:"omitempty,email" example:"john@example.com"`
 	Phone    string `json:"phone" example:"+1234567890"`
 	Status   string `json:"status" example:"Hello, I'm using Talkify!"`
+
+	// Whether the email and phone number are shown on the public profile
+	ShareEmail *bool `json:"share_email,omitempty"`
+	SharePhone *bool `json:"share_phone,omitempty"`
+}
+
+// HeartbeatResponse tells the client how long its online status lasts without another heartbeat
+type HeartbeatResponse struct {
+	IsOnline  bool      `json:"is_online"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PresenceResponse is whether a user is online and when they were last seen
+type PresenceResponse struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	IsOnline bool       `json:"is_online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
 }
 
 func (h *Handler) RegisterUserRoutes(r *gin.RouterGroup) {
 	r.Use(h.AuthMiddleware())
 	r.GET("/me", h.GetCurrentUser)
 	r.PUT("/me", h.UpdateUser)
+	r.PATCH("/me", h.PatchUser)
+	r.POST("/me/email/confirm", h.ConfirmEmailChange)
 	r.PUT("/me/password", h.ChangePassword)
+	r.GET("/me/usage", h.GetCurrentUserUsage)
+	r.GET("/me/devices", h.GetMyDevices)
+	r.POST("/me/login-alerts/:id/report", h.ReportLoginAlert)
+	r.GET("/me/keyword-alerts", h.GetKeywordAlerts)
+	r.POST("/me/keyword-alerts", h.CreateKeywordAlert)
+	r.DELETE("/me/keyword-alerts/:id", h.DeleteKeywordAlert)
+	r.GET("/me/notification-preferences", h.GetNotificationPreferences)
+	r.PUT("/me/notification-preferences", h.SetNotificationPreferences)
+	r.GET("/me/invite-link", h.GetInviteLink)
+	r.GET("/me/recovery-codes", h.GetRecoveryCodesStatus)
+	r.POST("/me/recovery-codes", h.GenerateRecoveryCodes)
+	r.GET("/me/trusted-contacts", h.GetTrustedContacts)
+	r.PUT("/me/trusted-contacts", h.SetTrustedContacts)
+	r.GET("/me/recovery-requests", h.GetMyRecoveryRequests)
+	r.POST("/me/recovery-requests/:id/cancel", h.CancelRecoveryRequest)
+	r.GET("/me/recovery-approvals", h.GetRecoveryApprovals)
+	r.POST("/me/recovery-approvals/:id", h.ApproveRecoveryRequest)
+	r.GET("/me/impersonations", h.GetMyImpersonations)
+	r.POST("/me/impersonations/:id/approve", h.ApproveImpersonation)
+	r.POST("/me/impersonations/:id/deny", h.DenyImpersonation)
+	r.POST("/me/impersonations/:id/end", h.EndMyImpersonation)
+	r.POST("/me/heartbeat", h.Heartbeat)
 	r.GET("/search", h.GetUserByUsername)
+	r.POST("/batch", h.BatchGetUsers)
 	r.GET("", h.GetUsers)
 	r.GET("/:id", h.GetUser)
+	r.GET("/:id/profile", h.GetUserProfile)
+	r.GET("/:id/presence", h.GetUserPresence)
 }
 
 // @Summary Get user by ID
-// @Description Get user details by their ID
+// @Description Get user details by their ID. Responses carry an ETag; sending it back in If-None-Match gets a 304 while the user is unchanged.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
+// @Param If-None-Match header string false "ETag of the copy the client has"
 // @Success 200 {object} models.User
+// @Header 200 {string} ETag "Tag of the returned payload"
+// @Success 304 "Not modified"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Security ApiKeyAuth
@@ -57,7 +110,7 @@ func (h *Handler) GetUser(c *gin.Context) {
 		return
 	}
 
-	h.respondWithSuccess(c, http.StatusOK, user)
+	h.respondWithETag(c, user)
 }
 
 type ChangePasswordInput struct {
@@ -90,6 +143,16 @@ func (h *Handler) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	var personal []string
+	if value, ok := c.Get("user"); ok {
+		if user, ok := value.(*models.User); ok {
+			personal = []string{user.Username, user.Email}
+		}
+	}
+	if !h.checkNewPassword(c, input.NewPassword, personal...) {
+		return
+	}
+
 	userService := models.NewUserService(h.db, h.encryptor)
 	err = userService.UpdatePassword(userID, input.CurrentPassword, input.NewPassword)
 	if err != nil {
@@ -170,6 +233,10 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if strings.Contains(req.Username, "@") {
+		h.respondWithError(c, http.StatusBadRequest, "Usernames can't contain '@'")
+		return
+	}
 	if req.Username != "" {
 		user.Username = req.Username
 	}
@@ -182,6 +249,12 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 	if req.Status != "" {
 		user.Status = req.Status
 	}
+	if req.ShareEmail != nil {
+		user.ShareEmail = *req.ShareEmail
+	}
+	if req.SharePhone != nil {
+		user.SharePhone = *req.SharePhone
+	}
 
 	if err := userService.Update(user); err != nil {
 		h.respondWithError(c, http.StatusInternalServerError, "Failed to update user")
@@ -191,25 +264,21 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 	h.respondWithSuccess(c, http.StatusOK, user)
 }
 
-// @Summary Get all users
-// @Description Get a list of all active users
+// @Summary List users
+// @Description List active users other than the caller, ordered by username. Only public profile fields are returned; the total number of matches is in the X-Total-Count header.
 // @Tags users
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.User
+// @Param q query string false "Username prefix to search for"
+// @Param limit query int false "Number of users to return (default: 50)"
+// @Param offset query int false "Number of users to skip (default: 0)"
+// @Success 200 {array} models.PublicUser
+// @Header 200 {integer} X-Total-Count "Total number of matching users"
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security ApiKeyAuth
 // @Router /users [get]
 func (h *Handler) GetUsers(c *gin.Context) {
-	userService := models.NewUserService(h.db, h.encryptor)
-	users, err := userService.GetAll()
-	if err != nil {
-		logger.Error("Failed to get users", err, nil)
-		h.respondWithError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get users: %v", err))
-		return
-	}
-
-	// Don't include the current user in the list
 	currentUserID, err := uuid.Parse(c.GetHeader("X-User-ID"))
 	if err != nil {
 		logger.Error("Failed to parse user ID", err, map[string]interface{}{
@@ -219,20 +288,37 @@ func (h *Handler) GetUsers(c *gin.Context) {
 		return
 	}
 
-	filteredUsers := make([]*models.User, 0)
+	page, ok := h.parsePage(c, 50, 100)
+	if !ok {
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	users, total, err := userService.List(models.UserListOptions{
+		Query:     strings.TrimSpace(c.Query("q")),
+		Limit:     page.Limit,
+		Offset:    page.Offset,
+		ExcludeID: currentUserID,
+	})
+	if err != nil {
+		logger.Error("Failed to get users", err, nil)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get users")
+		return
+	}
+
+	publicUsers := make([]*models.PublicUser, 0, len(users))
 	for _, user := range users {
-		if user.ID != currentUserID {
-			filteredUsers = append(filteredUsers, user)
-		}
+		publicUsers = append(publicUsers, user.Public())
 	}
 
 	logger.Debug("Retrieved users", map[string]interface{}{
-		"total_users":    len(users),
-		"filtered_users": len(filteredUsers),
-		"current_user":   currentUserID,
+		"returned":     len(publicUsers),
+		"total":        total,
+		"current_user": currentUserID,
 	})
 
-	h.respondWithSuccess(c, http.StatusOK, filteredUsers)
+	setPageHeaders(c, page, len(publicUsers), total)
+	h.respondWithSuccess(c, http.StatusOK, publicUsers)
 }
 
 // @Summary Get user by username
@@ -262,3 +348,199 @@ func (h *Handler) GetUserByUsername(c *gin.Context) {
 
 	h.respondWithSuccess(c, http.StatusOK, user)
 }
+
+// @Summary Get current user usage
+// @Description Get storage and message usage of the authenticated user along with the configured quotas
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Usage
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/usage [get]
+func (h *Handler) GetCurrentUserUsage(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	usage, err := h.quotaService().GetUsage(userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, usage)
+}
+
+// @Summary Send a presence heartbeat
+// @Description Keep the current user online without a WebSocket connection. Users are shown offline once no heartbeat, API call or WebSocket ping has been seen for the presence TTL; send heartbeats well before expires_at.
+// @Tags users
+// @Produce json
+// @Success 200 {object} HeartbeatResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/heartbeat [post]
+func (h *Handler) Heartbeat(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// With shared presence the database is brought up to date by SweepPresence
+	var seen time.Time
+	if h.presence != nil {
+		seen = time.Now()
+		err = h.presence.Touch(userID.String())
+	} else {
+		userService := models.NewUserService(h.db, h.encryptor)
+		seen, err = userService.Heartbeat(userID)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to record heartbeat", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to record heartbeat")
+		return
+	}
+
+	h.respondWithSuccess(c, http.StatusOK, HeartbeatResponse{
+		IsOnline:  true,
+		LastSeen:  seen,
+		ExpiresAt: seen.Add(h.cfg.Presence.OnlineTTL),
+	})
+}
+
+// @Summary Get a user's presence
+// @Description Get whether a user is online and when they were last seen, for clients without a WebSocket connection to get presence.changed events. Poll it no more often than the presence sweep interval; presence doesn't change in between.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} PresenceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/{id}/presence [get]
+func (h *Handler) GetUserPresence(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := models.NewUserService(h.db, h.encryptor).GetByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		logger.Error("Failed to get presence", err, map[string]interface{}{
+			"user_id": id,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get presence")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, PresenceResponse{
+		UserID:   user.ID,
+		IsOnline: user.IsOnline,
+		LastSeen: user.LastSeen,
+	})
+}
+
+// SweepPresence keeps users with an open WebSocket online and marks everyone else
+// offline once they have not been seen for the presence TTL. With shared presence,
+// expiry is left to Redis and the database is reconciled with it instead.
+func (h *Handler) SweepPresence() error {
+	userService := models.NewUserService(h.db, h.encryptor)
+	if h.presence != nil {
+		return h.reconcilePresence(userService)
+	}
+
+	if err := userService.TouchOnline(h.hub.ConnectedUserIDs()); err != nil {
+		return err
+	}
+
+	expired, err := userService.ExpireOnline(h.cfg.Presence.OnlineTTL)
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		logger.Debug("Expired online status", map[string]interface{}{
+			"users": expired,
+		})
+	}
+	return nil
+}
+
+// reconcilePresence refreshes the users connected to this node in Redis, copies the
+// online set to users.is_online and announces the users whose keys expired. Every node
+// runs it; the update only reports a user going offline once, so each is announced once.
+func (h *Handler) reconcilePresence(userService *models.UserService) error {
+	if err := h.presence.Touch(h.hub.ConnectedUserIDs()...); err != nil {
+		return err
+	}
+
+	online, err := h.presence.OnlineUserIDs()
+	if err != nil {
+		return err
+	}
+	offline, err := userService.ReconcileOnline(online)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]presence.Change, len(offline))
+	for i, id := range offline {
+		changes[i] = presence.Change{UserID: id.String(), Online: false}
+	}
+	if len(changes) > 0 {
+		logger.Debug("Expired online status", map[string]interface{}{
+			"users": len(changes),
+		})
+	}
+	return h.presence.Publish(changes...)
+}
+
+// WatchPresence pushes presence changes announced by any node to the users connected
+// here who share a conversation with the user. It blocks until ctx is done.
+func (h *Handler) WatchPresence(ctx context.Context) {
+	h.presence.Watch(ctx, func(change presence.Change) {
+		userID, err := uuid.Parse(change.UserID)
+		if err != nil {
+			return
+		}
+
+		h.submitTask("publish_"+EventPresenceChanged, func() error {
+			message, err := json.Marshal(Message{
+				Type:    EventPresenceChanged,
+				Payload: PresenceChangedEvent{UserID: userID, IsOnline: change.Online},
+			})
+			if err != nil {
+				return err
+			}
+
+			conversationService := models.NewConversationService(h.db, h.encryptor)
+			contacts, err := conversationService.ContactIDs(userID)
+			if err != nil {
+				return err
+			}
+
+			userIDs := make([]string, len(contacts))
+			for i, id := range contacts {
+				userIDs[i] = id.String()
+			}
+			h.hub.SendToUsers(userIDs, message)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// minUsernameLength and maxUsernameLength bound new usernames
+	minUsernameLength = 3
+	maxUsernameLength = 50
+	// maxStatusLength matches the status column
+	maxStatusLength = 50
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{4,19}$`)
+)
+
+// Patch is a field of a PATCH request. A field left out of the request is not Set;
+// one sent as null is Set and Null.
+type Patch[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for fields present in the request
+func (p *Patch[T]) UnmarshalJSON(data []byte) error {
+	p.Set = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		p.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &p.Value)
+}
+
+// PatchUserRequest changes some fields of the user's profile. Fields left out are kept;
+// phone, status, undo_send_seconds and timezone can be cleared with null. A new email only replaces the current one
+// once it is confirmed with the code sent to it.
+type PatchUserRequest struct {
+	Username   Patch[string] `json:"username" swaggertype:"string" example:"johndoe"`
+	Email      Patch[string] `json:"email" swaggertype:"string" example:"john@example.com"`
+	Phone      Patch[string] `json:"phone" swaggertype:"string" example:"+1234567890"`
+	Status     Patch[string] `json:"status" swaggertype:"string" example:"Hello, I'm using Talkify!"`
+	ShareEmail Patch[bool]   `json:"share_email" swaggertype:"boolean"`
+	SharePhone Patch[bool]   `json:"share_phone" swaggertype:"boolean"`
+	// UndoSendSeconds holds sent messages that long so they can be cancelled; null or 0 turns it off
+	UndoSendSeconds Patch[int] `json:"undo_send_seconds" swaggertype:"integer" example:"10"`
+	// Timezone is an IANA zone for quiet hours, digests and display hints; null resets it to UTC
+	Timezone Patch[string] `json:"timezone" swaggertype:"string" example:"Europe/Berlin"`
+}
+
+// PatchUserResponse is the updated user, and the email change waiting to be confirmed
+type PatchUserResponse struct {
+	*models.User
+	PendingEmail *models.EmailChange `json:"pending_email,omitempty"`
+}
+
+// ConfirmEmailRequest carries the code sent to a new email address
+type ConfirmEmailRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// usernameProblem returns what is wrong with a new username, if anything
+func usernameProblem(username string) string {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case length < minUsernameLength || length > maxUsernameLength:
+		return fmt.Sprintf("must be %d to %d characters", minUsernameLength, maxUsernameLength)
+	case !usernamePattern.MatchString(username):
+		return "may only contain letters, digits, '.', '_' and '-'"
+	}
+	return ""
+}
+
+// emailProblem returns what is wrong with a new email address, if anything
+func emailProblem(email string) string {
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+// validate checks each field set in the request and returns the problems by field,
+// along with the changes to make
+func (req *PatchUserRequest) validate(user *models.User) (models.ProfileChanges, map[string]string) {
+	changes := models.ProfileChanges{}
+	problems := map[string]string{}
+
+	if req.Username.Set {
+		username := strings.TrimSpace(req.Username.Value)
+		if req.Username.Null {
+			problems["username"] = "cannot be removed"
+		} else if problem := usernameProblem(username); problem != "" {
+			problems["username"] = problem
+		} else if username != user.Username {
+			changes.Username = &username
+		}
+	}
+	if req.Email.Set {
+		email := strings.TrimSpace(req.Email.Value)
+		if req.Email.Null {
+			problems["email"] = "cannot be removed"
+		} else if problem := emailProblem(email); problem != "" {
+			problems["email"] = problem
+		} else if !strings.EqualFold(email, user.Email) {
+			changes.Email = &email
+		}
+	}
+	if req.Phone.Set {
+		phone := strings.TrimSpace(req.Phone.Value)
+		if !req.Phone.Null && !phonePattern.MatchString(phone) {
+			problems["phone"] = "must be a phone number"
+		} else if phone != user.Phone {
+			changes.Phone = &phone
+		}
+	}
+	if req.Status.Set {
+		status := strings.TrimSpace(req.Status.Value)
+		if utf8.RuneCountInString(status) > maxStatusLength {
+			problems["status"] = fmt.Sprintf("must be at most %d characters", maxStatusLength)
+		} else if status != user.Status {
+			changes.Status = &status
+		}
+	}
+	if req.ShareEmail.Set {
+		if req.ShareEmail.Null {
+			problems["share_email"] = "must be true or false"
+		} else {
+			changes.ShareEmail = &req.ShareEmail.Value
+		}
+	}
+	if req.SharePhone.Set {
+		if req.SharePhone.Null {
+			problems["share_phone"] = "must be true or false"
+		} else {
+			changes.SharePhone = &req.SharePhone.Value
+		}
+	}
+	if req.UndoSendSeconds.Set {
+		seconds := req.UndoSendSeconds.Value
+		if seconds < 0 || seconds > models.MaxUndoSendSeconds {
+			problems["undo_send_seconds"] = fmt.Sprintf("must be 0 to %d", models.MaxUndoSendSeconds)
+		} else if seconds != user.UndoSendSeconds {
+			changes.UndoSendSeconds = &seconds
+		}
+	}
+	if req.Timezone.Set {
+		timezone := req.Timezone.Value
+		if req.Timezone.Null {
+			timezone = "UTC"
+		}
+		if !models.ValidTimezone(timezone) {
+			problems["timezone"] = "must be an IANA timezone, such as Europe/Berlin"
+		} else if timezone != user.Timezone {
+			changes.Timezone = &timezone
+		}
+	}
+	return changes, problems
+}
+
+// @Summary Update parts of the current user's profile
+// @Description Change only the profile fields in the request, leaving the others as they are. Phone, status, undo_send_seconds and timezone are cleared with null; the timezone is an IANA name and is used for quiet hours, digest schedules and display hints. A new email is not applied right away: a code is sent to it and the change is made once POST /users/me/email/confirm gets the code. Fields that don't validate are listed under fields in the error.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body PatchUserRequest true "Fields to change"
+// @Success 200 {object} PatchUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me [patch]
+func (h *Handler) PatchUser(c *gin.Context) {
+	var req PatchUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	user, err := userService.GetByID(userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	changes, problems := req.validate(user)
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile fields", "fields": problems})
+		return
+	}
+
+	// A new address waits for its code, sent before anything changes so that a failure
+	// leaves the profile as it was. Without mail there is no way to confirm an address,
+	// so it is changed right away.
+	var pending *models.EmailChange
+	if changes.Email != nil && h.mailer != nil {
+		if pending = h.requestEmailChange(c, user, *changes.Email); pending == nil {
+			return
+		}
+		changes.Email = nil
+	}
+
+	user, err = userService.UpdateProfile(userID, changes)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrConflict):
+			h.respondWithError(c, http.StatusConflict, "Username already exists")
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusNotFound, "User not found")
+		default:
+			logger.Error("Failed to update profile", err, map[string]interface{}{
+				"user_id": userID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to update user")
+		}
+		return
+	}
+
+	if changes.Email != nil {
+		logger.Info("Email changed", map[string]interface{}{
+			"audit":   true,
+			"action":  "user.email_change",
+			"user_id": userID,
+		})
+	}
+	h.respondWithSuccess(c, http.StatusOK, PatchUserResponse{User: user, PendingEmail: pending})
+}
+
+// requestEmailChange sends a confirmation code to the user's new address. It answers
+// the request itself and returns nil when it fails.
+func (h *Handler) requestEmailChange(c *gin.Context, user *models.User, email string) *models.EmailChange {
+	// Codes sent by email expire like sign-in codes
+	ttl := h.cfg.Login.CodeTTL
+	userService := models.NewUserService(h.db, h.encryptor)
+	change, code, err := userService.RequestEmailChange(user.ID, email, ttl)
+	if err != nil {
+		logger.Error("Failed to request email change", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to change email")
+		return nil
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Enter this code to use this address for your Talkify account:\n\n    %s\n\n"+
+		"The code expires in %d minutes. If you didn't ask for this, ignore this email.\n",
+		user.Username, code, int(ttl/time.Minute))
+	if err := h.mailer.Send(email, "Confirm your new Talkify email", body); err != nil {
+		logger.Error("Failed to send email change code", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		h.respondWithError(c, http.StatusServiceUnavailable, "Failed to send the verification code")
+		return nil
+	}
+	return change
+}
+
+// @Summary Confirm a new email address
+// @Description Apply the email change requested with PATCH /users/me, using the code sent to the new address. A change is ended after five wrong codes.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ConfirmEmailRequest true "Code sent to the new address"
+// @Success 200 {object} models.User
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /users/me/email/confirm [post]
+func (h *Handler) ConfirmEmailChange(c *gin.Context) {
+	var req ConfirmEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	userService := models.NewUserService(h.db, h.encryptor)
+	if _, err := userService.ConfirmEmailChange(userID, strings.TrimSpace(req.Code)); err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnauthorized):
+			h.respondWithError(c, http.StatusUnauthorized, "Invalid code")
+		case errors.Is(err, models.ErrNotFound):
+			h.respondWithError(c, http.StatusNotFound, "No email change is waiting. Request it again.")
+		default:
+			logger.Error("Failed to confirm email change", err, map[string]interface{}{
+				"user_id": userID,
+			})
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to change email")
+		}
+		return
+	}
+
+	logger.Info("Email changed", map[string]interface{}{
+		"audit":   true,
+		"action":  "user.email_change",
+		"user_id": userID,
+	})
+
+	user, err := userService.GetByID(userID)
+	if err != nil {
+		h.respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, user)
+}
+
+// PurgeExpiredEmailChanges removes email changes that were never confirmed
+func (h *Handler) PurgeExpiredEmailChanges() error {
+	purged, err := models.NewUserService(h.db, h.encryptor).PurgeExpiredEmailChanges()
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged expired email changes", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return nil
+}
@@ -1,16 +1,26 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/delivery"
+	"talkify/apps/api/internal/eventlog"
 	"talkify/apps/api/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -22,6 +32,19 @@ const (
 
 	// Send pings to peer with this period
 	pingPeriod = (pongWait * 9) / 10
+
+	// Events queued for a client before it is disconnected as too slow
+	clientSendBuffer = 256
+
+	// maxDeviceLength bounds the device a client names when connecting
+	maxDeviceLength = 64
+
+	// Messages a client may send per second before it is closed as rate limited
+	clientMessagesPerSecond = 30
+
+	// How long ended sessions are remembered, so that resume tokens issued to them are
+	// refused; it covers the longest resume window
+	endedSessionRetention = time.Hour
 )
 
 var upgrader = websocket.Upgrader{
@@ -38,27 +61,107 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan []byte
 	userID string
+	// sessionID is the session the connection was opened with; nil for tokens without one
+	sessionID uuid.UUID
+	// clientID is the application whose token opened the connection; empty for others
+	clientID string
+	// closeReason is what the connection is closed with once send is closed; the hub
+	// sets it before closing send, which the write pump reads it after
+	closeReason *CloseReason
+	// device groups the connections of one device, such as the tabs of a browser; only
+	// the newest connection of a device gets events. Empty for clients that didn't name
+	// their device, which are on their own.
+	device string
+	// id, ip and connectedAt describe the connection to administrators; see Hub.Stats
+	id          uuid.UUID
+	ip          string
+	connectedAt time.Time
+	// deliveries is set for clients that acknowledge the conversation events they receive,
+	// and seen is told of the new messages they acknowledge
+	deliveries *delivery.Tracker
+	seen       func(delivery.Delivery)
+	// batchInterval is set for clients that take batch frames; see nextFrame
+	batchInterval time.Duration
+	batchMax      int
+	// resumeToken returns a session.resume_token event, renewed every resumeEvery; nil
+	// when resuming is turned off
+	resumeToken func() []byte
+	resumeEvery time.Duration
+	// typing tells a conversation's participants whether the user is typing; nil for
+	// connections whose token may not write messages
+	typing func(conversationID uuid.UUID, typing bool)
+}
+
+// Events clients send. Frames of other types are ignored: clients only reach other
+// users through the events the server publishes to participants.
+const (
+	// ClientEventAck is what clients connected with acks=true send back for every
+	// conversation event they receive
+	ClientEventAck = "ack"
+	// ClientEventTyping says whether the user is typing in a conversation, as POST
+	// /conversations/{id}/typing does. Clients may also send typing_start and
+	// typing_stop.
+	ClientEventTyping = "typing"
+)
+
+// AckEvent is the payload of an ack sent by a client
+type AckEvent struct {
+	EventID uint64 `json:"event_id"`
+}
+
+// ClientTypingEvent is the payload of the typing events a client sends
+type ClientTypingEvent struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	// IsTyping is only read from typing events, where it defaults to true
+	IsTyping *bool `json:"is_typing"`
 }
 
 // Hub maintains the set of active clients
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	mutex      sync.Mutex
+	clients map[*Client]bool
+	// devices holds the connections of each user's devices, oldest first; the last one
+	// gets the device's events
+	devices map[string][]*Client
+	// singleSession closes a user's other connections when they connect again, instead
+	// of only grouping them by device
+	singleSession bool
+	register      chan *Client
+	unregister    chan *Client
+	quit          chan struct{}
+	stopOnce      sync.Once
+	mutex         sync.Mutex
+	// ended holds when sessions were ended while connected; see endSessions
+	ended map[uuid.UUID]time.Time
+	// Event throughput, for the realtime admin endpoint
+	sent     *eventRate
+	received *eventRate
+	dropped  atomic.Uint64
 }
 
-func NewHub() *Hub {
+func NewHub(singleSession bool) *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		quit:          make(chan struct{}),
+		clients:       make(map[*Client]bool),
+		devices:       make(map[string][]*Client),
+		ended:         make(map[uuid.UUID]time.Time),
+		singleSession: singleSession,
+		sent:          newEventRate(),
+		received:      newEventRate(),
 	}
 }
 
+// Stop closes every connection with CloseServerDraining, which clients take as a cue to
+// reconnect, and ends Run
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+}
+
 type Message struct {
+	// ID is set on server events kept in the event log; clients pass the last one they
+	// saw as last_event_id when reconnecting
+	ID      uint64      `json:"id,omitempty"`
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
 }
@@ -69,34 +172,218 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mutex.Lock()
 			h.clients[client] = true
+			h.takeOver(client)
 			h.mutex.Unlock()
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client, nil)
 			}
 			h.mutex.Unlock()
 
-		case message := <-h.broadcast:
+		case <-h.quit:
 			h.mutex.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+				client.closeReason = closeServerDraining
+				close(client.send)
+				delete(h.clients, client)
 			}
+			h.devices = make(map[string][]*Client)
 			h.mutex.Unlock()
+			return
 		}
 	}
 }
 
+// takeOver makes a new client the one its device's events go to, telling the
+// connection that had them. In single-session mode the user's other connections are
+// told and closed, leaving it alone on its device. The mutex must be held.
+func (h *Hub) takeOver(client *Client) {
+	if h.singleSession {
+		for other := range h.clients {
+			if other != client && other.userID == client.userID {
+				h.notify(other, EventSessionSuperseded, SessionSupersededEvent{ConnectionID: client.id, Closing: true})
+				h.remove(other, closeDuplicateSession)
+			}
+		}
+	}
+	if client.device == "" {
+		return
+	}
+	key := client.deviceKey()
+	if group := h.devices[key]; len(group) > 0 {
+		h.notify(group[len(group)-1], EventSessionSuperseded, SessionSupersededEvent{ConnectionID: client.id})
+	}
+	h.devices[key] = append(h.devices[key], client)
+}
+
+// remove closes a client's connection with reason, or normally when reason is nil. When
+// it was getting its device's events, the device's newest other connection gets them
+// from now on. The mutex must be held.
+func (h *Hub) remove(client *Client, reason *CloseReason) {
+	delete(h.clients, client)
+	client.closeReason = reason
+	close(client.send)
+	if client.device == "" {
+		return
+	}
+	key := client.deviceKey()
+	group := h.devices[key]
+	i := slices.Index(group, client)
+	if i < 0 {
+		return
+	}
+	group = slices.Delete(group, i, i+1)
+	if len(group) == 0 {
+		delete(h.devices, key)
+		return
+	}
+	h.devices[key] = group
+	if i == len(group) {
+		h.notify(group[len(group)-1], EventSessionResumed, nil)
+	}
+}
+
+// receives reports whether a client gets events: it has to be the newest connection of
+// its device. The mutex must be held.
+func (h *Hub) receives(client *Client) bool {
+	if client.device == "" {
+		return true
+	}
+	group := h.devices[client.deviceKey()]
+	return len(group) > 0 && group[len(group)-1] == client
+}
+
+// notify queues an event the hub itself sends to a client, skipping clients that have
+// fallen too far behind to take it
+func (h *Hub) notify(client *Client, eventType string, payload interface{}) {
+	message, err := json.Marshal(Message{Type: eventType, Payload: payload})
+	if err != nil {
+		return
+	}
+	select {
+	case client.send <- message:
+		h.sent.add(1)
+	default:
+	}
+}
+
+// deviceKey identifies the device of a client among every user's
+func (c *Client) deviceKey() string {
+	return c.userID + "/" + c.device
+}
+
+// SendToUsers delivers a message to every connection of the given users, once per
+// device. Clients that cannot keep up are disconnected. It returns the users
+// reached on at least one connection that acknowledges events, and those reached only
+// on connections that don't.
+func (h *Hub) SendToUsers(userIDs []string, message []byte) (acking, untracked []string) {
+	recipients := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		recipients[id] = true
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	reached := make(map[string]bool)
+	tracked := make(map[string]bool)
+	var sent uint64
+	for client := range h.clients {
+		if !recipients[client.userID] || !h.receives(client) {
+			continue
+		}
+		select {
+		case client.send <- message:
+			sent++
+			reached[client.userID] = true
+			if client.deliveries != nil {
+				tracked[client.userID] = true
+			}
+		default:
+			h.remove(client, closeTooSlow)
+			h.dropped.Add(1)
+		}
+	}
+	h.sent.add(sent)
+
+	for id := range reached {
+		if tracked[id] {
+			acking = append(acking, id)
+		} else {
+			untracked = append(untracked, id)
+		}
+	}
+	return acking, untracked
+}
+
+// endSessions closes the connections of a user's sessions that ended with
+// CloseAuthExpired, and remembers the sessions so that their resume tokens are refused.
+// Connections opened without a session are left open.
+func (h *Hub) endSessions(userID uuid.UUID, ended func(sessionID uuid.UUID) bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	for id, at := range h.ended {
+		if now.Sub(at) > endedSessionRetention {
+			delete(h.ended, id)
+		}
+	}
+	user := userID.String()
+	for client := range h.clients {
+		if client.userID != user || client.sessionID == uuid.Nil || !ended(client.sessionID) {
+			continue
+		}
+		h.ended[client.sessionID] = now
+		h.remove(client, closeAuthExpired)
+	}
+}
+
+// endApplication closes with CloseAuthExpired the connections of an application: its
+// bot's, and those opened with its tokens for userID, or for every user when userID is
+// empty
+func (h *Hub) endApplication(applicationID uuid.UUID, clientID, userID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for client := range h.clients {
+		bot := applicationID != uuid.Nil && client.userID == applicationID.String()
+		if bot || (client.clientID != "" && client.clientID == clientID && (userID == "" || client.userID == userID)) {
+			h.remove(client, closeAuthExpired)
+		}
+	}
+}
+
+// sessionEnded reports whether a session was ended while it had connections here
+func (h *Hub) sessionEnded(sessionID uuid.UUID) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	at, ok := h.ended[sessionID]
+	return ok && time.Since(at) <= endedSessionRetention
+}
+
+// ConnectedUserIDs returns the users with at least one open connection
+func (h *Hub) ConnectedUserIDs() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	seen := make(map[string]bool)
+	ids := make([]string, 0, len(h.clients))
+	for client := range h.clients {
+		if !seen[client.userID] {
+			seen[client.userID] = true
+			ids = append(ids, client.userID)
+		}
+	}
+	return ids
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.quit:
+		}
 		c.conn.Close()
 	}()
 
@@ -106,6 +393,8 @@ func (c *Client) readPump() {
 		return nil
 	})
 
+	windowStart := time.Now()
+	windowCount := 0
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -115,20 +404,85 @@ func (c *Client) readPump() {
 			break
 		}
 
+		c.hub.received.add(1)
+
+		if now := time.Now(); now.Sub(windowStart) >= time.Second {
+			windowStart, windowCount = now, 0
+		}
+		windowCount++
+		if windowCount > clientMessagesPerSecond {
+			c.closeWith(closeRateLimited)
+			return
+		}
+
 		// Parse and handle the message
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
 			log.Printf("error parsing message: %v", err)
-			continue
+			c.closeWith(closeProtocolError)
+			return
+		}
+
+		switch msg.Type {
+		case ClientEventAck:
+			c.acknowledge(message)
+		case ClientEventTyping, EventTypingStart, EventTypingStop:
+			c.sendTyping(msg.Type, message)
 		}
+	}
+}
+
+// closeWith sends a close frame with reason from the read pump, which then returns and
+// closes the connection. Control frames may be written alongside the write pump.
+func (c *Client) closeWith(reason *CloseReason) {
+	c.conn.WriteControl(websocket.CloseMessage, closeMessage(reason), time.Now().Add(writeWait))
+}
+
+// acknowledge records that the client received a conversation event
+func (c *Client) acknowledge(message []byte) {
+	if c.deliveries == nil {
+		return
+	}
+	var ack struct {
+		Payload AckEvent `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &ack); err != nil {
+		log.Printf("error parsing ack: %v", err)
+		return
+	}
+	if d, ok := c.deliveries.Acknowledge(c.userID, ack.Payload.EventID); ok && d.MessageID != "" && c.seen != nil {
+		c.seen(d)
+	}
+}
 
-		// Broadcast the message to all clients
-		c.hub.broadcast <- message
+// sendTyping passes on a typing event from the client, which is dropped when its token
+// may not write messages
+func (c *Client) sendTyping(eventType string, message []byte) {
+	if c.typing == nil {
+		return
 	}
+	var event struct {
+		Payload ClientTypingEvent `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &event); err != nil {
+		log.Printf("error parsing typing: %v", err)
+		return
+	}
+	typing := eventType == EventTypingStart
+	if eventType == ClientEventTyping {
+		typing = event.Payload.IsTyping == nil || *event.Payload.IsTyping
+	}
+	c.typing(event.Payload.ConversationID, typing)
 }
 
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
+	var renew <-chan time.Time
+	if c.resumeToken != nil {
+		renewTicker := time.NewTicker(c.resumeEvery)
+		defer renewTicker.Stop()
+		renew = renewTicker.C
+	}
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -137,9 +491,12 @@ func (c *Client) writePump() {
 	for {
 		select {
 		case message, ok := <-c.send:
+			if ok && c.batchInterval > 0 {
+				message, ok = c.nextFrame(message)
+			}
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage(c.closeReason))
 				return
 			}
 
@@ -158,45 +515,133 @@ func (c *Client) writePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case <-renew:
+			event := c.resumeToken()
+			if event == nil {
+				continue
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, event); err != nil {
+				return
+			}
 		}
 	}
 }
 
+// nextFrame gathers the events queued behind first into a batch frame. A client that
+// has fallen behind gets its backlog at once; otherwise events are awaited until
+// batchInterval after the first, so bursts of small events such as typing share a
+// frame. It returns false once the connection is closed, after the events gathered
+// until then were lost with it.
+func (c *Client) nextFrame(first []byte) ([]byte, bool) {
+	events := [][]byte{first}
+	// Waiting for more would only add to a backlog
+	var deadline <-chan time.Time
+	if len(c.send) == 0 {
+		timer := time.NewTimer(c.batchInterval)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+gather:
+	for len(events) < c.batchMax {
+		if deadline == nil && len(c.send) == 0 {
+			break
+		}
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return nil, false
+			}
+			events = append(events, message)
+		case <-deadline:
+			break gather
+		}
+	}
+	if len(events) == 1 {
+		return first, true
+	}
+
+	frame := bytes.NewBufferString(`{"type":"` + EventBatch + `","payload":[`)
+	for i, event := range events {
+		if i > 0 {
+			frame.WriteByte(',')
+		}
+		frame.Write(event)
+	}
+	frame.WriteString("]}")
+	return frame.Bytes(), true
+}
+
 // WebSocket godoc
 // @Summary WebSocket connection endpoint
-// @Description Establishes a WebSocket connection for real-time chat
+// @Description Establishes a WebSocket connection for real-time chat. Connections the server closes get a close code from 4000 up, with a JSON reason of the form {"reason", "reconnect", "retry_after"}: 4001 auth_expired (the session was revoked; get a new access token), 4002 duplicate_session (connected elsewhere in single-session mode), 4003 protocol_error (a frame could not be parsed), 4008 rate_limited, 4009 too_slow (reconnect with last_event_id), 4010 server_draining (reconnect after retry_after, with jitter), 4011 disconnected (by an administrator). Clients should not reconnect when reconnect is false. Clients send ack events, and typing events ({"type": "typing", "payload": {"conversation_id", "is_typing"}}, or typing_start and typing_stop) that are passed on like POST /conversations/{id}/typing when the token may write messages; other frames are ignored.
 // @Tags websocket
 // @Accept json
 // @Produce json
-// @Param token query string true "Authentication token"
+// @Param token query string false "Authentication token; required unless resume is given"
+// @Param resume query string false "Token from the last session.resume_token event of a lost connection. Reconnecting with it before it expires skips authentication; missed events are replayed from when it was issued unless last_event_id is given."
+// @Param last_event_id query int false "ID of the last event received before reconnecting; missed events are replayed"
+// @Param acks query bool false "The client sends an ack with the event_id of every conversation event it receives; events not acknowledged in time are resent through the notification center" default(false)
+// @Param batch query bool false "Events sent in quick succession may arrive together in one batch event, whose payload is the events in order" default(false)
+// @Param device query string false "Identifies the device, such as a browser profile shared by its tabs. Only the newest connection of a device gets events; the older ones get session.superseded and wait, getting session.resumed when they are the newest again."
 // @Success 101 {string} string "Switching Protocols"
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Router /ws [get]
 func (h *Handler) WebSocket(c *gin.Context) {
-	// Get token from query params
-	token := c.Query("token")
-	if token == "" {
-		h.respondWithError(c, http.StatusBadRequest, "Missing token")
+	device := c.Query("device")
+	if len(device) > maxDeviceLength {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("device must be at most %d bytes", maxDeviceLength))
 		return
 	}
 
-	// Validate token
-	claims, err := h.tokenManager.ValidateToken(token)
-	if err != nil {
-		h.respondWithError(c, http.StatusUnauthorized, "Invalid token")
-		return
+	// A resume token stands in for the access token shortly after a connection was lost.
+	// When it can't be used the client falls back to its access token, if it sent one.
+	var identity *resumeClaims
+	resumed := false
+	if resume := c.Query("resume"); resume != "" && h.cfg.Events.ResumeEnabled() {
+		claims, err := h.parseResumeToken(resume)
+		if err == nil && claims.SessionID != uuid.Nil && h.hub.sessionEnded(claims.SessionID) {
+			err = errResumeTokenInvalid
+		}
+		if err == nil && (claims.Bot || claims.ClientID != "") && !h.applicationAllowed(claims) {
+			err = errResumeTokenInvalid
+		}
+		if err == nil {
+			identity, resumed = claims, true
+		} else if c.Query("token") == "" {
+			reason := ReasonTokenInvalid
+			if errors.Is(err, errResumeTokenExpired) {
+				reason = ReasonTokenExpired
+			}
+			h.respondUnauthorized(c, reason, "Invalid resume token")
+			return
+		}
 	}
+	if !resumed {
+		token := c.Query("token")
+		if token == "" {
+			h.respondWithError(c, http.StatusUnauthorized, "Missing token")
+			return
+		}
+		var ok bool
+		if identity, ok = h.authenticateWebSocket(c, token); !ok {
+			return
+		}
+	}
+	bot := identity.Bot
 
 	// Set user ID in context
-	userID := claims.UserID.String()
-	c.Set("userID", claims.UserID)
+	userID := identity.UserID.String()
+	c.Set("userID", identity.UserID)
 	c.Request.Header.Set("X-User-ID", userID)
 
-	// Update user status
-	h.submitTask("update_user_status", func() error {
-		userService := models.NewUserService(h.db, h.encryptor)
-		return userService.SetOnlineStatus(claims.UserID, true)
-	})
+	// Update user status; a resumed connection's user was marked online moments ago
+	if !bot && !resumed {
+		h.markOnline(identity.UserID)
+	}
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -206,14 +651,181 @@ func (h *Handler) WebSocket(c *gin.Context) {
 	}
 
 	client := &Client{
-		hub:    h.hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: userID,
+		hub:         h.hub,
+		conn:        conn,
+		send:        make(chan []byte, clientSendBuffer),
+		userID:      userID,
+		sessionID:   identity.SessionID,
+		clientID:    identity.ClientID,
+		device:      device,
+		id:          uuid.New(),
+		ip:          c.ClientIP(),
+		connectedAt: time.Now(),
+	}
+	if acks, _ := strconv.ParseBool(c.Query("acks")); acks {
+		client.deliveries = h.deliveries
+		client.seen = h.messageSeen
+	}
+	if batch, _ := strconv.ParseBool(c.Query("batch")); batch {
+		client.batchInterval = h.cfg.Events.BatchInterval
+		client.batchMax = h.cfg.Events.BatchMaxEvents
+	}
+	if identity.Write && !bot {
+		client.typing = func(conversationID uuid.UUID, typing bool) {
+			h.socketTyping(conversationID, identity.UserID, typing)
+		}
+	}
+	if h.cfg.Events.ResumeEnabled() {
+		claims := *identity
+		client.resumeToken = func() []byte { return h.resumeTokenEvent(claims) }
+		client.resumeEvery = h.cfg.Events.ResumeWindow / 4
+	}
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.quit:
+		conn.Close()
+		return
+	}
+
+	if client.resumeToken != nil {
+		if event := client.resumeToken(); event != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.TextMessage, event); err != nil {
+				log.Printf("Failed to send resume token: %v", err)
+			}
+		}
+	}
+
+	// Catch the client up before live events, which queue in its send buffer meanwhile.
+	// A resumed connection that didn't say what it saw last is caught up from when its
+	// token was issued.
+	lastEventID := c.Query("last_event_id")
+	if lastEventID == "" && resumed {
+		lastEventID = strconv.FormatUint(identity.LastEventID, 10)
+	}
+	if lastEventID != "" {
+		if err := h.replayEvents(conn, identity.UserID, bot, lastEventID); err != nil {
+			log.Printf("Failed to replay events: %v", err)
+		}
 	}
-	client.hub.register <- client
 
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump()
 }
+
+// authenticateWebSocket validates the access token a connection is opened with and
+// checks its session, and its application's grant or its user as AuthMiddleware does.
+// It responds and returns false when the connection is refused.
+func (h *Handler) authenticateWebSocket(c *gin.Context, token string) (*resumeClaims, bool) {
+	claims, err := h.tokenManager.ValidateToken(token)
+	if err != nil {
+		reason := ReasonTokenInvalid
+		if errors.Is(err, auth.ErrTokenExpired) {
+			reason = ReasonTokenExpired
+		}
+		h.respondUnauthorized(c, reason, "Invalid token")
+		return nil, false
+	}
+	// Sessions are checked when connecting; an open connection outlives them
+	if claims.SessionID != uuid.Nil {
+		reason, err := h.checkSession(claims.SessionID)
+		if err != nil {
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check session")
+			return nil, false
+		}
+		if reason != "" {
+			h.respondUnauthorized(c, reason, sessionMessage(reason))
+			return nil, false
+		}
+	}
+	if !claims.Allows(auth.ScopeReadMessages) {
+		h.respondWithError(c, http.StatusForbidden, "Token does not have the required scope")
+		return nil, false
+	}
+	// Connections outlive the impersonation checks, which are made per request
+	if claims.Impersonation != nil {
+		h.respondWithError(c, http.StatusForbidden, "Impersonation tokens cannot open a WebSocket")
+		return nil, false
+	}
+	// Bots are the applications themselves, which have no user to mark online; everyone
+	// else is checked as on every request
+	bot := claims.Type == auth.TokenTypeBot
+	if bot {
+		active, err := models.NewOAuthService(h.db).IsActiveApplication(claims.UserID)
+		if err != nil {
+			h.respondWithError(c, http.StatusInternalServerError, "Failed to check application")
+			return nil, false
+		}
+		if !active {
+			h.respondWithError(c, http.StatusForbidden, "Access for this application has been revoked")
+			return nil, false
+		}
+	} else if _, ok := h.checkAccess(c, claims, auth.ScopeReadMessages); !ok {
+		return nil, false
+	}
+	return &resumeClaims{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		Bot:       bot,
+		ClientID:  claims.ClientID,
+		Write:     claims.Allows(auth.ScopeWriteMessages),
+	}, true
+}
+
+// applicationAllowed reports whether the application a resume token was issued to may
+// still connect: a bot's application must not be revoked, and an application token's
+// grant must still cover reading messages
+func (h *Handler) applicationAllowed(claims *resumeClaims) bool {
+	oauthService := models.NewOAuthService(h.db)
+	if claims.Bot {
+		active, err := oauthService.IsActiveApplication(claims.UserID)
+		return err == nil && active
+	}
+	granted, err := oauthService.GetGrantScopes(claims.ClientID, claims.UserID)
+	return err == nil && auth.HasScope(granted, auth.ScopeReadMessages)
+}
+
+// replayEvents writes the events a reconnecting client missed straight to its connection.
+// It runs before the write pump starts. Live events published meanwhile may repeat some
+// of them, so clients ignore IDs they have already seen. When the missed events are no
+// longer retained the client gets an events.reset instead. Bots replay the conversations
+// they are installed in.
+func (h *Handler) replayEvents(conn *websocket.Conn, userID uuid.UUID, bot bool, lastEventID string) error {
+	var events []eventlog.Event
+	complete := false
+	if afterID, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		var ids []uuid.UUID
+		if bot {
+			ids, err = models.NewOAuthService(h.db).EventConversationIDs(userID)
+		} else {
+			ids, err = models.NewConversationService(h.db, h.encryptor).UserConversationIDs(userID)
+		}
+		if err != nil {
+			log.Printf("Failed to get conversations to replay: %v", err)
+		} else {
+			conversationIDs := make([]string, len(ids))
+			for i, id := range ids {
+				conversationIDs[i] = id.String()
+			}
+			events, complete = h.events.Since(conversationIDs, afterID)
+		}
+	}
+
+	if !complete {
+		reset, err := json.Marshal(Message{Type: EventsReset, Payload: EventsResetEvent{LastEventID: h.events.LastID()}})
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteMessage(websocket.TextMessage, reset)
+	}
+
+	for _, event := range events {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteMessage(websocket.TextMessage, event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
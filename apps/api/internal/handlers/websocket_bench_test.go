@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// BenchmarkHubFanOut measures delivering an event to the connections of as many users
+// through SendToUsers, as conversation events are. Each client is drained by a
+// goroutine standing in for its write pump, which the benchmark waits for every half
+// send buffer so that clients keep up as they would at a realistic event rate. Clients
+// dropped for falling behind anyway are reported as a metric.
+func BenchmarkHubFanOut(b *testing.B) {
+	for _, clients := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			benchmarkHubFanOut(b, clients)
+		})
+	}
+}
+
+func benchmarkHubFanOut(b *testing.B, clients int) {
+	hub := NewHub(false)
+	userIDs := make([]string, clients)
+	var drained sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		client := &Client{
+			hub:    hub,
+			send:   make(chan []byte, clientSendBuffer),
+			userID: uuid.NewString(),
+			id:     uuid.New(),
+		}
+		hub.clients[client] = true
+		userIDs[i] = client.userID
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			for range client.send {
+			}
+		}()
+	}
+	message, err := json.Marshal(Message{ID: 1, Type: EventTypingStart, Payload: TypingEvent{
+		ConversationID: uuid.New(),
+		UserID:         uuid.New(),
+		IsTyping:       true,
+	}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.SendToUsers(userIDs, message)
+		if i%(clientSendBuffer/2) == 0 {
+			hub.mutex.Lock()
+			for client := range hub.clients {
+				for len(client.send) > 0 {
+					runtime.Gosched()
+				}
+			}
+			hub.mutex.Unlock()
+		}
+	}
+	b.StopTimer()
+
+	hub.mutex.Lock()
+	for client := range hub.clients {
+		hub.remove(client, nil)
+	}
+	hub.mutex.Unlock()
+	drained.Wait()
+	b.ReportMetric(float64(hub.dropped.Load()), "dropped")
+}
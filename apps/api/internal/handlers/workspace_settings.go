@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxRetentionDays keeps the retention period within what make_interval takes in
+// seconds without overflowing
+const maxRetentionDays = 36500
+
+// retentionBatch is how many expired messages are deleted at a time
+const retentionBatch = 1000
+
+// UpdateWorkspaceSettingsRequest replaces the workspace settings
+type UpdateWorkspaceSettingsRequest struct {
+	RetentionDays *int   `json:"retention_days" binding:"required" example:"365"`
+	ExportPolicy  string `json:"export_policy" binding:"required,oneof=everyone group_admins nobody" example:"group_admins"`
+	GroupCreation string `json:"group_creation" binding:"required,oneof=everyone verified admins" example:"verified"`
+	GuestAccess   *bool  `json:"guest_access" binding:"required"`
+}
+
+// @Summary Get workspace settings
+// @Description Get the workspace-wide defaults: how many days messages are kept, who may export transcripts and file archives, who may create groups and whether guest tokens are accepted.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.WorkspaceSettings
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/workspace/settings [get]
+func (h *Handler) GetWorkspaceSettings(c *gin.Context) {
+	settings, err := models.NewWorkspaceSettingsService(h.db).Get()
+	if err != nil {
+		logger.Error("Failed to get workspace settings", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to get workspace settings")
+		return
+	}
+	h.respondWithSuccess(c, http.StatusOK, settings)
+}
+
+// @Summary Update workspace settings
+// @Description Set the workspace-wide defaults. retention_days deletes messages older than that many days, within the hour, except in conversations on legal hold or keeping an integrity chain; 0 keeps messages. export_policy lets everyone, only the owners and admins of groups (both sides of direct conversations still can) or nobody export transcripts and file archives. group_creation lets everyone, only verified users or only administrators create groups. guest_access false refuses guest tokens. Administrators are exempt from the export and group creation policies. Changes are audit logged.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param settings body UpdateWorkspaceSettingsRequest true "Workspace settings"
+// @Success 200 {object} models.WorkspaceSettings
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Router /admin/workspace/settings [put]
+func (h *Handler) UpdateWorkspaceSettings(c *gin.Context) {
+	adminID, err := uuid.Parse(c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req UpdateWorkspaceSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if *req.RetentionDays < 0 || *req.RetentionDays > maxRetentionDays {
+		h.respondWithError(c, http.StatusBadRequest, fmt.Sprintf("retention_days must be 0 to %d", maxRetentionDays))
+		return
+	}
+
+	settingsService := models.NewWorkspaceSettingsService(h.db)
+	previous, err := settingsService.Get()
+	if err != nil {
+		logger.Error("Failed to get workspace settings", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to update workspace settings")
+		return
+	}
+	settings := &models.WorkspaceSettings{
+		RetentionDays: *req.RetentionDays,
+		ExportPolicy:  req.ExportPolicy,
+		GroupCreation: req.GroupCreation,
+		GuestAccess:   *req.GuestAccess,
+		UpdatedBy:     &adminID,
+	}
+	if err := settingsService.Update(settings); err != nil {
+		logger.Error("Failed to update workspace settings", err)
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to update workspace settings")
+		return
+	}
+
+	logger.Info("Updated workspace settings", map[string]interface{}{
+		"audit":    true,
+		"action":   "workspace.settings_update",
+		"admin_id": adminID,
+		"previous": previous,
+		"settings": settings,
+	})
+	h.respondWithSuccess(c, http.StatusOK, settings)
+}
+
+// mayCreateGroup answers 403 unless the group creation policy lets the user create
+// groups
+func (h *Handler) mayCreateGroup(c *gin.Context, userID uuid.UUID) bool {
+	allowed, err := models.NewWorkspaceSettingsService(h.db).CanCreateGroup(userID)
+	if err != nil {
+		logger.Error("Failed to check group creation policy", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to create conversation")
+		return false
+	}
+	if !allowed {
+		h.respondWithError(c, http.StatusForbidden, "Creating groups is restricted in this workspace")
+		return false
+	}
+	return true
+}
+
+// mayExport answers 403 unless the export policy lets the participant export the
+// conversation
+func (h *Handler) mayExport(c *gin.Context, conversationID, userID uuid.UUID) bool {
+	allowed, err := models.NewWorkspaceSettingsService(h.db).CanExport(conversationID, userID)
+	if err != nil {
+		logger.Error("Failed to check export policy", err, map[string]interface{}{
+			"conversation_id": conversationID,
+			"user_id":         userID,
+		})
+		h.respondWithError(c, http.StatusInternalServerError, "Failed to check export policy")
+		return false
+	}
+	if !allowed {
+		h.respondWithError(c, http.StatusForbidden, "Exporting this conversation is restricted in this workspace")
+		return false
+	}
+	return true
+}
+
+// PurgeExpiredMessages deletes messages older than the workspace retention period
+func (h *Handler) PurgeExpiredMessages() error {
+	settings, err := models.NewWorkspaceSettingsService(h.db).Get()
+	if err != nil {
+		return err
+	}
+	if settings.RetentionDays == 0 {
+		return nil
+	}
+
+	messageService := models.NewMessageService(h.db, h.encryptor)
+	var total int64
+	for {
+		purged, err := messageService.PurgeExpiredMessages(settings.Retention(), retentionBatch)
+		if err != nil {
+			return err
+		}
+		total += purged
+		if purged < retentionBatch {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Info("Purged expired messages", map[string]interface{}{
+			"messages":       total,
+			"retention_days": settings.RetentionDays,
+		})
+	}
+	return nil
+}
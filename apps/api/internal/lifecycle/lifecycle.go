@@ -0,0 +1,126 @@
+// Package lifecycle starts the server's subsystems in the order they were added and
+// stops them in reverse, so each one can still rely on everything started before it
+// while it drains.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+)
+
+// Hook starts and stops one subsystem. Either function may be nil.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	// Timeout bounds Stop within the overall shutdown deadline; zero leaves it to
+	// that deadline alone
+	Timeout time.Duration
+}
+
+// Manager runs hooks in order
+type Manager struct {
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+	stopped bool
+}
+
+// New creates an empty manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// Append adds a subsystem that starts after, and stops before, those added earlier
+func (m *Manager) Append(hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Start starts the subsystems not started yet, in order. When one fails, those that
+// already started are stopped again and its error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	for m.started < len(m.hooks) {
+		hook := m.hooks[m.started]
+		if hook.Start != nil {
+			if err := hook.Start(ctx); err != nil {
+				m.mu.Unlock()
+				err = fmt.Errorf("failed to start %s: %w", hook.Name, err)
+				if stopErr := m.Stop(context.Background()); stopErr != nil {
+					logger.Error("Failed to stop after a failed start", stopErr)
+				}
+				return err
+			}
+		}
+		logger.Debug("Started", map[string]interface{}{
+			"subsystem": hook.Name,
+		})
+		m.started++
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Stop stops the started subsystems in reverse order, each within its own timeout and
+// all within ctx. Every one is stopped even when some fail; their errors are joined.
+// Stopping again does nothing.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return nil
+	}
+	m.stopped = true
+
+	var errs []error
+	for i := m.started - 1; i >= 0; i-- {
+		hook := m.hooks[i]
+		if hook.Stop == nil {
+			continue
+		}
+
+		start := time.Now()
+		if err := stopHook(ctx, hook); err != nil {
+			logger.Error("Failed to stop cleanly", err, map[string]interface{}{
+				"subsystem": hook.Name,
+				"duration":  time.Since(start).String(),
+			})
+			errs = append(errs, fmt.Errorf("%s: %w", hook.Name, err))
+			continue
+		}
+		logger.Debug("Stopped", map[string]interface{}{
+			"subsystem": hook.Name,
+			"duration":  time.Since(start).String(),
+		})
+	}
+	m.started = 0
+	return errors.Join(errs...)
+}
+
+// stopHook runs a Stop hook, giving up once its deadline passes even if the hook
+// itself doesn't watch the context
+func stopHook(ctx context.Context, hook Hook) error {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
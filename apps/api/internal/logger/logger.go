@@ -6,12 +6,27 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 var Logger zerolog.Logger
 
+// errorHook receives everything logged through Error, e.g. to forward it to an error tracker
+var errorHook func(msg string, err error, fields map[string]interface{})
+
+// SetErrorHook registers a function called for every Error log
+func SetErrorHook(hook func(msg string, err error, fields map[string]interface{})) {
+	errorHook = hook
+}
+
+// RequestIDKey is the gin context key and RequestIDHeader the header carrying the request ID
+const (
+	RequestIDKey    = "request_id"
+	RequestIDHeader = "X-Request-ID"
+)
+
 // InitLogger initializes the global logger with pretty console output
 func InitLogger(isDevelopment bool) {
 	// Set up pretty console writer
@@ -38,9 +53,11 @@ func InitLogger(isDevelopment bool) {
 		logLevel = zerolog.DebugLevel
 	}
 
+	// The level is global so that SetLevel can change it while the server runs
+	zerolog.SetGlobalLevel(logLevel)
+
 	// Initialize logger with pretty console output
 	Logger = zerolog.New(output).
-		Level(logLevel).
 		With().
 		Timestamp().
 		Caller().
@@ -50,6 +67,31 @@ func InitLogger(isDevelopment bool) {
 	log.Logger = Logger
 }
 
+// SetLevel changes the minimum level that is logged, e.g. "debug" or "warn"
+func SetLevel(level string) error {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(parsed)
+	return nil
+}
+
+// RequestID returns middleware that tags each request with an ID, reusing the one sent
+// by a proxy when present, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.NewString()
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Writer.Header().Set(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
 // RequestLogger returns middleware for logging HTTP requests
 func RequestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -81,6 +123,7 @@ func RequestLogger() gin.HandlerFunc {
 			Dur("latency", latency).
 			Str("ip", ip).
 			Str("user_agent", userAgent).
+			Str("request_id", c.GetString(RequestIDKey)).
 			Msg("HTTP Request")
 	}
 }
@@ -112,6 +155,16 @@ func Error(msg string, err error, fields ...map[string]interface{}) {
 	}
 	addFields(event, fields...)
 	event.Msg(msg)
+
+	if errorHook != nil {
+		merged := make(map[string]interface{})
+		for _, field := range fields {
+			for k, v := range field {
+				merged[k] = v
+			}
+		}
+		errorHook(msg, err, merged)
+	}
 }
 
 func Fatal(msg string, err error, fields ...map[string]interface{}) {
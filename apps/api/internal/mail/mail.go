@@ -0,0 +1,74 @@
+// Package mail sends notification emails over SMTP. Without a server configured,
+// emails are written to the log instead so development setups need nothing extra.
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+)
+
+// Mailer sends plain-text emails
+type Mailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// New creates a mailer for an smtp://[user:password@]host[:port] URL. An empty URL
+// logs emails instead of sending them.
+func New(rawURL, from string) (*Mailer, error) {
+	m := &Mailer{from: from}
+	if rawURL == "" {
+		return m, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "smtp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SMTP URL")
+	}
+	m.addr = u.Host
+	if u.Port() == "" {
+		m.addr = net.JoinHostPort(u.Hostname(), "587")
+	}
+	if password, ok := u.User.Password(); ok {
+		m.auth = smtp.PlainAuth("", u.User.Username(), password, u.Hostname())
+	}
+	return m, nil
+}
+
+// Send emails body to a single recipient
+func (m *Mailer) Send(to, subject, body string) error {
+	if m.addr == "" {
+		// Addresses are personal data, so only the subject is logged
+		logger.Info("Email not sent, no SMTP server configured", map[string]interface{}{
+			"subject": subject,
+		})
+		return nil
+	}
+
+	// Header values come from our own templates, but never let a newline through
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	// net/smtp upgrades to TLS when the server offers STARTTLS
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
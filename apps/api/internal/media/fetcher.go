@@ -0,0 +1,138 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrHostNotAllowed is returned for media hosted somewhere the fetcher may not reach
+var ErrHostNotAllowed = errors.New("media host is not allowed")
+
+// Request headers passed upstream so players can seek and browsers can revalidate
+var forwardedRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// Response headers passed back to the client
+var forwardedResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified",
+}
+
+// Fetcher streams media from a fixed set of hosts. Media URLs are chosen by the
+// sender, so anything else is refused rather than fetched from inside the network.
+type Fetcher struct {
+	allowed map[string]bool
+	client  *http.Client
+}
+
+// NewFetcher creates a fetcher for the given host names
+func NewFetcher(allowedHosts []string) *Fetcher {
+	f := &Fetcher{allowed: make(map[string]bool)}
+	for _, host := range allowedHosts {
+		f.allowed[strings.ToLower(host)] = true
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 15 * time.Second
+	f.client = &http.Client{
+		// No overall timeout: a video can take longer to stream than any sensible limit
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.check(req.URL)
+		},
+	}
+	return f
+}
+
+// Stream copies the media at rawURL to w, honouring the range and conditional headers
+// of r. An error is only returned while nothing has been written to w yet; failures
+// mid-stream just cut the response short.
+func (f *Fetcher) Stream(w http.ResponseWriter, r *http.Request, rawURL string) error {
+	header := make(http.Header)
+	for _, name := range forwardedRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+
+	resp, err := f.get(r.Context(), rawURL, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+	default:
+		return fmt.Errorf("media host answered %d", resp.StatusCode)
+	}
+
+	for _, name := range forwardedResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	// The response depends on who asked, so shared caches must not keep it. Callers may
+	// set a stricter policy beforehand.
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "private, max-age=300")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	return nil
+}
+
+// Fetch returns the whole media at rawURL. The caller closes the body.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	resp, err := f.get(ctx, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("media host answered %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrHostNotAllowed
+	}
+	if err := f.check(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media: %w", err)
+	}
+	return resp, nil
+}
+
+func (f *Fetcher) check(u *url.URL) error {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return ErrHostNotAllowed
+	}
+	if !f.allowed[strings.ToLower(u.Hostname())] {
+		return ErrHostNotAllowed
+	}
+	return nil
+}
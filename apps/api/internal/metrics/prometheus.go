@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the top K figures of the last complete window to w
+func (r *Recorder) WritePrometheus(w io.Writer) error {
+	out := r.report()
+	b := bufio.NewWriter(w)
+
+	writeHeader(b, "talkify_metrics_window_seconds", "gauge", "Length of the window the other metrics are aggregated over.")
+	writeSample(b, "talkify_metrics_window_seconds", nil, r.window.Seconds())
+
+	writeHeader(b, "talkify_conversation_messages_per_second", "gauge", "Message rate of the busiest conversations over the last window.")
+	for _, sample := range out.messageRates {
+		writeSample(b, "talkify_conversation_messages_per_second", []string{"conversation_id", sample.conversationID}, sample.value)
+	}
+
+	writeHeader(b, "talkify_conversation_fanout_recipients", "gauge", "Largest number of users a conversation event was pushed to over the last window.")
+	for _, sample := range out.fanouts {
+		writeSample(b, "talkify_conversation_fanout_recipients", []string{"conversation_id", sample.conversationID}, sample.value)
+	}
+
+	writeHeader(b, "talkify_endpoint_requests", "gauge", "Requests served by the slowest endpoints over the last window.")
+	for _, sample := range out.endpoints {
+		writeSample(b, "talkify_endpoint_requests", []string{"method", sample.method, "route", sample.route}, float64(sample.count))
+	}
+
+	writeHeader(b, "talkify_endpoint_latency_mean_seconds", "gauge", "Mean latency of the slowest endpoints over the last window.")
+	for _, sample := range out.endpoints {
+		writeSample(b, "talkify_endpoint_latency_mean_seconds", []string{"method", sample.method, "route", sample.route}, sample.mean)
+	}
+
+	writeHeader(b, "talkify_endpoint_latency_max_seconds", "gauge", "Maximum latency of the slowest endpoints over the last window.")
+	for _, sample := range out.endpoints {
+		writeSample(b, "talkify_endpoint_latency_max_seconds", []string{"method", sample.method, "route", sample.route}, sample.max)
+	}
+
+	writeHeader(b, "talkify_password_hashes", "gauge", "Stored password hashes by scheme; bcrypt ones are legacy and upgraded at login.")
+	for _, sample := range out.passwordHashes {
+		writeSample(b, "talkify_password_hashes", []string{"scheme", sample.scheme}, float64(sample.count))
+	}
+
+	writeHeader(b, "talkify_shadow_reads_total", "counter", "Reads of denormalized summaries and counters also computed from messages to compare.")
+	for _, sample := range out.shadowReads {
+		writeSample(b, "talkify_shadow_reads_total", []string{"read", sample.read}, float64(sample.count))
+	}
+
+	writeHeader(b, "talkify_shadow_read_mismatches_total", "counter", "Values of shadow reads that differed from those computed from messages, by field.")
+	for _, sample := range out.mismatches {
+		writeSample(b, "talkify_shadow_read_mismatches_total", []string{"read", sample.read, "field", sample.field}, float64(sample.count))
+	}
+
+	return b.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample. labels holds alternating names and values.
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte('\n')
+}
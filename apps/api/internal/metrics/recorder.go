@@ -0,0 +1,349 @@
+// Package metrics aggregates operational metrics and writes them in the Prometheus
+// text exposition format. Per-conversation and per-endpoint figures are collected over
+// a fixed window and only the top K of each are exported, so label cardinality stays
+// bounded however many conversations are active.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder collects the metrics of the current window and keeps the last complete
+// window for export
+type Recorder struct {
+	topK   int
+	window time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	current     *snapshot
+	previous    *snapshot
+	// passwordHashes counts stored password hashes by scheme, as last counted
+	passwordHashes map[string]int64
+	// shadowReads and shadowMismatches count reads compared in shadow since start, and
+	// the fields found to differ
+	shadowReads      map[string]int64
+	shadowMismatches map[shadowKey]int64
+}
+
+// snapshot holds everything recorded during one window
+type snapshot struct {
+	conversations map[string]*conversationStats
+	endpoints     map[endpointKey]*endpointStats
+	// latencies counts every request by latencyBuckets, whatever its route
+	latencies  [len(latencyBuckets) + 1]int64
+	maxLatency time.Duration
+}
+
+// latencyBuckets are the upper bounds requests are counted under for percentiles.
+// Slower requests go in a last bucket of their own.
+var latencyBuckets = [...]time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+type conversationStats struct {
+	messages int64
+	fanout   int
+}
+
+type endpointKey struct {
+	method string
+	route  string
+}
+
+type shadowKey struct {
+	read  string
+	field string
+}
+
+type endpointStats struct {
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		conversations: make(map[string]*conversationStats),
+		endpoints:     make(map[endpointKey]*endpointStats),
+	}
+}
+
+// NewRecorder creates a recorder that exports the topK busiest conversations and
+// slowest endpoints of each window
+func NewRecorder(topK int, window time.Duration) *Recorder {
+	return &Recorder{
+		topK:        topK,
+		window:      window,
+		windowStart: time.Now(),
+		current:     newSnapshot(),
+		previous:    newSnapshot(),
+
+		shadowReads:      make(map[string]int64),
+		shadowMismatches: make(map[shadowKey]int64),
+	}
+}
+
+// rotate starts a new window once the current one is over. A window with no traffic
+// after it leaves an empty previous window rather than stale figures. Must be called
+// with the lock held.
+func (r *Recorder) rotate(now time.Time) {
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < r.window {
+		return
+	}
+
+	if elapsed < 2*r.window {
+		r.previous = r.current
+		r.windowStart = r.windowStart.Add(r.window)
+	} else {
+		r.previous = newSnapshot()
+		r.windowStart = now
+	}
+	r.current = newSnapshot()
+}
+
+func (r *Recorder) conversation(conversationID string) *conversationStats {
+	stats, ok := r.current.conversations[conversationID]
+	if !ok {
+		stats = &conversationStats{}
+		r.current.conversations[conversationID] = stats
+	}
+	return stats
+}
+
+// RecordMessage counts a message sent to a conversation
+func (r *Recorder) RecordMessage(conversationID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(time.Now())
+	r.conversation(conversationID).messages++
+}
+
+// RecordFanout records how many users an event for a conversation was pushed to
+func (r *Recorder) RecordFanout(conversationID string, recipients int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(time.Now())
+	stats := r.conversation(conversationID)
+	if recipients > stats.fanout {
+		stats.fanout = recipients
+	}
+}
+
+// SetPasswordHashes replaces the count of stored password hashes by scheme
+func (r *Recorder) SetPasswordHashes(counts map[string]int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.passwordHashes = counts
+}
+
+// RecordShadowRead counts a read compared in shadow and the fields found to differ in
+// it, once per mismatching value
+func (r *Recorder) RecordShadowRead(read string, mismatchedFields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.shadowReads[read]++
+	for _, field := range mismatchedFields {
+		r.shadowMismatches[shadowKey{read: read, field: field}]++
+	}
+}
+
+// RecordRequest records how long a request to a route took
+func (r *Recorder) RecordRequest(method, route string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(time.Now())
+	key := endpointKey{method: method, route: route}
+	stats, ok := r.current.endpoints[key]
+	if !ok {
+		stats = &endpointStats{}
+		r.current.endpoints[key] = stats
+	}
+	stats.count++
+	stats.total += duration
+	if duration > stats.max {
+		stats.max = duration
+	}
+
+	bucket := sort.Search(len(latencyBuckets), func(i int) bool { return duration <= latencyBuckets[i] })
+	r.current.latencies[bucket]++
+	if duration > r.current.maxLatency {
+		r.current.maxLatency = duration
+	}
+}
+
+// LatencySummary is the request latency across all routes over the last complete window
+type LatencySummary struct {
+	Window   time.Duration
+	Requests int64
+	// Percentiles are the upper bound of the bucket they fall in, so they err high
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// Latency returns the latency percentiles of the last complete window
+func (r *Recorder) Latency() LatencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(time.Now())
+	summary := LatencySummary{Window: r.window}
+	for _, count := range r.previous.latencies {
+		summary.Requests += count
+	}
+	summary.P50 = r.previous.percentile(0.50, summary.Requests)
+	summary.P95 = r.previous.percentile(0.95, summary.Requests)
+	summary.P99 = r.previous.percentile(0.99, summary.Requests)
+	return summary
+}
+
+// percentile returns the bucket bound below which a fraction q of total requests fell
+func (s *snapshot) percentile(q float64, total int64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, count := range s.latencies {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		if i == len(latencyBuckets) || s.maxLatency < latencyBuckets[i] {
+			return s.maxLatency
+		}
+		return latencyBuckets[i]
+	}
+	return s.maxLatency
+}
+
+// conversationSample is a conversation metric ready for export
+type conversationSample struct {
+	conversationID string
+	value          float64
+}
+
+// endpointSample is an endpoint's latency ready for export
+type endpointSample struct {
+	endpointKey
+	count int64
+	mean  float64
+	max   float64
+}
+
+// hashSample is a count of stored password hashes ready for export
+type hashSample struct {
+	scheme string
+	count  int64
+}
+
+// shadowSample is a count of shadow reads or mismatches ready for export; field is
+// empty for reads
+type shadowSample struct {
+	shadowKey
+	count int64
+}
+
+// report is the top K of the last complete window, and the gauges set outside windows
+type report struct {
+	messageRates   []conversationSample
+	fanouts        []conversationSample
+	endpoints      []endpointSample
+	passwordHashes []hashSample
+	shadowReads    []shadowSample
+	mismatches     []shadowSample
+}
+
+// report builds the top K figures of the last complete window
+func (r *Recorder) report() report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(time.Now())
+	seconds := r.window.Seconds()
+
+	var out report
+	for id, stats := range r.previous.conversations {
+		if stats.messages > 0 {
+			out.messageRates = append(out.messageRates, conversationSample{id, float64(stats.messages) / seconds})
+		}
+		if stats.fanout > 0 {
+			out.fanouts = append(out.fanouts, conversationSample{id, float64(stats.fanout)})
+		}
+	}
+	for key, stats := range r.previous.endpoints {
+		out.endpoints = append(out.endpoints, endpointSample{
+			endpointKey: key,
+			count:       stats.count,
+			mean:        stats.total.Seconds() / float64(stats.count),
+			max:         stats.max.Seconds(),
+		})
+	}
+
+	out.messageRates = topConversations(out.messageRates, r.topK)
+	out.fanouts = topConversations(out.fanouts, r.topK)
+
+	sort.Slice(out.endpoints, func(i, j int) bool {
+		if out.endpoints[i].max != out.endpoints[j].max {
+			return out.endpoints[i].max > out.endpoints[j].max
+		}
+		return out.endpoints[i].route < out.endpoints[j].route
+	})
+	if len(out.endpoints) > r.topK {
+		out.endpoints = out.endpoints[:r.topK]
+	}
+
+	for scheme, count := range r.passwordHashes {
+		out.passwordHashes = append(out.passwordHashes, hashSample{scheme, count})
+	}
+	sort.Slice(out.passwordHashes, func(i, j int) bool {
+		return out.passwordHashes[i].scheme < out.passwordHashes[j].scheme
+	})
+
+	for read, count := range r.shadowReads {
+		out.shadowReads = append(out.shadowReads, shadowSample{shadowKey{read: read}, count})
+	}
+	for key, count := range r.shadowMismatches {
+		out.mismatches = append(out.mismatches, shadowSample{key, count})
+	}
+	sortShadowSamples(out.shadowReads)
+	sortShadowSamples(out.mismatches)
+
+	return out
+}
+
+// sortShadowSamples sorts samples by read, then field
+func sortShadowSamples(samples []shadowSample) {
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].read != samples[j].read {
+			return samples[i].read < samples[j].read
+		}
+		return samples[i].field < samples[j].field
+	})
+}
+
+// topConversations sorts samples by value, highest first, and keeps the first k
+func topConversations(samples []conversationSample, k int) []conversationSample {
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].value != samples[j].value {
+			return samples[i].value > samples[j].value
+		}
+		return samples[i].conversationID < samples[j].conversationID
+	})
+	if len(samples) > k {
+		samples = samples[:k]
+	}
+	return samples
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const dayLayout = "2006-01-02"
+
+// ConversationDailyStats is a pre-aggregated rollup of a conversation's activity for one day
+type ConversationDailyStats struct {
+	Day           time.Time `db:"day" json:"day"`
+	MessageCount  int       `db:"message_count" json:"message_count"`
+	MediaCount    int       `db:"media_count" json:"media_count"`
+	MediaBytes    int64     `db:"media_bytes" json:"media_bytes"`
+	MembersJoined int       `db:"members_joined" json:"members_joined"`
+	MemberCount   int       `db:"member_count" json:"member_count"`
+}
+
+// ActiveMember represents a participant ranked by messages sent
+type ActiveMember struct {
+	UserID       uuid.UUID `db:"user_id" json:"user_id"`
+	Username     string    `db:"username" json:"username"`
+	MessageCount int       `db:"message_count" json:"message_count"`
+}
+
+// MediaUsage summarizes media shared in a conversation over a period
+type MediaUsage struct {
+	MediaCount int   `db:"media_count" json:"media_count"`
+	MediaBytes int64 `db:"media_bytes" json:"media_bytes"`
+}
+
+// ConversationAnalytics is the analytics report for a conversation over a period
+type ConversationAnalytics struct {
+	ConversationID    uuid.UUID                `json:"conversation_id"`
+	From              time.Time                `json:"from"`
+	To                time.Time                `json:"to"`
+	TotalMessages     int                      `json:"total_messages"`
+	Daily             []ConversationDailyStats `json:"daily"`
+	MostActiveMembers []ActiveMember           `json:"most_active_members"`
+	MediaUsage        MediaUsage               `json:"media_usage"`
+}
+
+// AnalyticsService maintains and reads conversation activity rollups
+type AnalyticsService struct {
+	db *sqlx.DB
+}
+
+// NewAnalyticsService creates a new analytics service
+func NewAnalyticsService(db *sqlx.DB) *AnalyticsService {
+	return &AnalyticsService{db: db}
+}
+
+// RefreshRecentRollups recomputes the rollups for yesterday and today. Yesterday
+// is included so late writes around midnight end up in the final numbers.
+func (s *AnalyticsService) RefreshRecentRollups() error {
+	today := time.Now().UTC()
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		if err := s.RefreshDailyRollups(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshDailyRollups recomputes the rollups for every conversation with activity on the given day
+func (s *AnalyticsService) RefreshDailyRollups(day time.Time) error {
+	d := day.UTC().Format(dayLayout)
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO conversation_daily_stats (
+			conversation_id, day, message_count, media_count, media_bytes,
+			members_joined, member_count, updated_at
+		)
+		SELECT
+			c.id,
+			$1::date,
+			COALESCE(m.message_count, 0),
+			COALESCE(m.media_count, 0),
+			COALESCE(m.media_bytes, 0),
+			COALESCE(p.members_joined, 0),
+			(
+				SELECT COUNT(*) FROM conversation_participants cp
+				WHERE cp.conversation_id = c.id AND cp.joined_at < $1::date + 1
+			),
+			CURRENT_TIMESTAMP
+		FROM conversations c
+		LEFT JOIN (
+			SELECT
+				conversation_id,
+				COUNT(*) AS message_count,
+				COUNT(*) FILTER (WHERE media_url IS NOT NULL) AS media_count,
+				COALESCE(SUM(media_size), 0) AS media_bytes
+			FROM messages
+			WHERE created_at >= $1::date AND created_at < $1::date + 1 AND NOT is_deleted
+			GROUP BY conversation_id
+		) m ON m.conversation_id = c.id
+		LEFT JOIN (
+			SELECT conversation_id, COUNT(*) AS members_joined
+			FROM conversation_participants
+			WHERE joined_at >= $1::date AND joined_at < $1::date + 1
+			GROUP BY conversation_id
+		) p ON p.conversation_id = c.id
+		WHERE m.conversation_id IS NOT NULL OR p.conversation_id IS NOT NULL
+		ON CONFLICT (conversation_id, day) DO UPDATE
+		SET message_count = EXCLUDED.message_count,
+			media_count = EXCLUDED.media_count,
+			media_bytes = EXCLUDED.media_bytes,
+			members_joined = EXCLUDED.members_joined,
+			member_count = EXCLUDED.member_count,
+			updated_at = EXCLUDED.updated_at
+	`, d)
+	if err != nil {
+		return fmt.Errorf("failed to refresh conversation rollups: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO conversation_member_daily_stats (conversation_id, user_id, day, message_count)
+		SELECT conversation_id, sender_id, $1::date, COUNT(*)
+		FROM messages
+		WHERE created_at >= $1::date AND created_at < $1::date + 1 AND NOT is_deleted
+		GROUP BY conversation_id, sender_id
+		ON CONFLICT (conversation_id, user_id, day) DO UPDATE
+		SET message_count = EXCLUDED.message_count
+	`, d)
+	if err != nil {
+		return fmt.Errorf("failed to refresh member rollups: %w", err)
+	}
+
+	if err := refreshReactionRollups(tx, d); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetConversationAnalytics reads the rollups for the last `days` days of a conversation
+func (s *AnalyticsService) GetConversationAnalytics(conversationID uuid.UUID, days int) (*ConversationAnalytics, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	return s.conversationAnalytics(conversationID, to.AddDate(0, 0, -(days-1)), to)
+}
+
+// conversationAnalytics reads the rollups of a conversation from one day to another,
+// both included
+func (s *AnalyticsService) conversationAnalytics(conversationID uuid.UUID, from, to time.Time) (*ConversationAnalytics, error) {
+	report := &ConversationAnalytics{
+		ConversationID:    conversationID,
+		From:              from,
+		To:                to,
+		Daily:             []ConversationDailyStats{},
+		MostActiveMembers: []ActiveMember{},
+	}
+
+	err := s.db.Select(&report.Daily, `
+		SELECT day, message_count, media_count, media_bytes, members_joined, member_count
+		FROM conversation_daily_stats
+		WHERE conversation_id = $1 AND day BETWEEN $2::date AND $3::date
+		ORDER BY day ASC
+	`, conversationID, from.Format(dayLayout), to.Format(dayLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+
+	for _, d := range report.Daily {
+		report.TotalMessages += d.MessageCount
+		report.MediaUsage.MediaCount += d.MediaCount
+		report.MediaUsage.MediaBytes += d.MediaBytes
+	}
+
+	err = s.db.Select(&report.MostActiveMembers, `
+		SELECT s.user_id, u.username, SUM(s.message_count) AS message_count
+		FROM conversation_member_daily_stats s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.conversation_id = $1 AND s.day BETWEEN $2::date AND $3::date
+		GROUP BY s.user_id, u.username
+		ORDER BY message_count DESC
+		LIMIT 10
+	`, conversationID, from.Format(dayLayout), to.Format(dayLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active members: %w", err)
+	}
+
+	return report, nil
+}
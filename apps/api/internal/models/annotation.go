@@ -0,0 +1,187 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxAnnotationsPerMessage bounds the annotations all sources attach to a message
+	maxAnnotationsPerMessage = 50
+	// MaxAnnotationValueBytes bounds the JSON value of an annotation
+	MaxAnnotationValueBytes = 4096
+)
+
+var (
+	// ErrAnnotationLimit is returned when a message has as many annotations as allowed
+	ErrAnnotationLimit = errors.New("annotation limit reached")
+	// ErrMessageNotFound is returned when annotating a message that doesn't exist or
+	// can't be read, to tell it apart from a missing annotation
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// MessageAnnotation is structured data an integration attaches to a message, such as
+// a ticket link, a sentiment score or a CI status. Annotations aren't content, so
+// changing them doesn't mark the message edited. Source is the application or service
+// that set it; each source has its own keys.
+type MessageAnnotation struct {
+	MessageID uuid.UUID       `db:"message_id" json:"message_id"`
+	Source    string          `db:"source" json:"source"`
+	Key       string          `db:"key" json:"key"`
+	Value     json.RawMessage `db:"value" json:"value" swaggertype:"object"`
+	CreatedBy *uuid.UUID      `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// Annotate sets a source's annotation of a message, replacing the value it had under
+// key, and returns it with the message's conversation. userID is who the source acts
+// for; it must be able to read the message. Nil is for internal services, which may
+// annotate any message.
+func (s *MessageService) Annotate(messageID uuid.UUID, userID *uuid.UUID, source, key string, value json.RawMessage) (*MessageAnnotation, uuid.UUID, error) {
+	conversationID, err := s.annotatable(messageID, userID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the message keeps concurrent sources from going past the limit together
+	if _, err := tx.Exec(`SELECT 1 FROM messages WHERE id = $1 FOR UPDATE`, messageID); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to lock message: %w", err)
+	}
+	var count int
+	err = tx.Get(&count, `
+		SELECT COUNT(*) FROM message_annotations
+		WHERE message_id = $1 AND NOT (source = $2 AND key = $3)
+	`, messageID, source, key)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to count annotations: %w", err)
+	}
+	if count >= maxAnnotationsPerMessage {
+		return nil, uuid.Nil, ErrAnnotationLimit
+	}
+
+	annotation := &MessageAnnotation{}
+	err = tx.Get(annotation, `
+		INSERT INTO message_annotations (message_id, source, key, value, created_by)
+		VALUES ($1, $2, $3, $4::jsonb, $5)
+		ON CONFLICT (message_id, source, key) DO UPDATE
+		SET value = EXCLUDED.value, created_by = EXCLUDED.created_by, updated_at = CURRENT_TIMESTAMP
+		RETURNING *
+	`, messageID, source, key, string(value), userID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to annotate message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return annotation, conversationID, nil
+}
+
+// RemoveAnnotation removes a source's annotation of a message and returns the
+// message's conversation. userID is checked as by Annotate.
+func (s *MessageService) RemoveAnnotation(messageID uuid.UUID, userID *uuid.UUID, source, key string) (uuid.UUID, error) {
+	conversationID, err := s.annotatable(messageID, userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM message_annotations WHERE message_id = $1 AND source = $2 AND key = $3
+	`, messageID, source, key)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to remove annotation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return uuid.Nil, ErrNotFound
+	}
+	return conversationID, nil
+}
+
+// storeAnnotations stores the annotations a message is created or edited with, such
+// as the server's own, replacing any set under the same source and key
+func storeAnnotations(tx *sqlx.Tx, messageID uuid.UUID, annotations []MessageAnnotation) error {
+	for i := range annotations {
+		annotation := &annotations[i]
+		err := tx.Get(annotation, `
+			INSERT INTO message_annotations (message_id, source, key, value)
+			VALUES ($1, $2, $3, $4::jsonb)
+			ON CONFLICT (message_id, source, key) DO UPDATE
+			SET value = EXCLUDED.value, created_by = NULL, updated_at = CURRENT_TIMESTAMP
+			RETURNING *
+		`, messageID, annotation.Source, annotation.Key, string(annotation.Value))
+		if err != nil {
+			return fmt.Errorf("failed to store annotation: %w", err)
+		}
+	}
+	return nil
+}
+
+// annotatable returns the conversation of a message that isn't deleted, which userID,
+// when set, has to be able to read. Otherwise it returns ErrMessageNotFound.
+func (s *MessageService) annotatable(messageID uuid.UUID, userID *uuid.UUID) (uuid.UUID, error) {
+	if userID != nil {
+		messages, err := s.GetByIDsForUser([]uuid.UUID{messageID}, *userID)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if len(messages) == 0 {
+			return uuid.Nil, ErrMessageNotFound
+		}
+		return messages[0].ConversationID, nil
+	}
+
+	var conversationID uuid.UUID
+	err := s.db.Get(&conversationID, `
+		SELECT conversation_id FROM messages WHERE id = $1 AND NOT is_deleted
+	`, messageID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return conversationID, nil
+}
+
+// attachAnnotations fills in the annotations of messages with a single query
+func (s *MessageService) attachAnnotations(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID.String()
+	}
+
+	annotations := []MessageAnnotation{}
+	err := s.db.Select(&annotations, `
+		SELECT * FROM message_annotations
+		WHERE message_id = ANY($1::uuid[])
+		ORDER BY source, key
+	`, pq.StringArray(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get annotations: %w", err)
+	}
+
+	byMessage := make(map[uuid.UUID][]MessageAnnotation)
+	for _, annotation := range annotations {
+		byMessage[annotation.MessageID] = append(byMessage[annotation.MessageID], annotation)
+	}
+	for _, message := range messages {
+		message.Annotations = byMessage[message.ID]
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Events automations run on
+const (
+	AutomationParticipantJoined = "participant.joined"
+	AutomationParticipantLeft   = "participant.left"
+	// AutomationMessageCreated runs on every message but system ones. Automations post
+	// system messages, so they can't set each other off through the conversation.
+	AutomationMessageCreated = "message.created"
+)
+
+// What automations do
+const (
+	// AutomationPostMessage posts a system message; {user} is replaced with the
+	// username of the participant who joined or left
+	AutomationPostMessage = "post_message"
+	// AutomationWebhook posts the event to a URL, signed with the automation's secret
+	AutomationWebhook = "webhook"
+	// AutomationNotifyUser sends the message, with {user} replaced, to the notification
+	// center of a participant
+	AutomationNotifyUser = "notify_user"
+	// AutomationAddLabel labels the conversation
+	AutomationAddLabel = "add_label"
+)
+
+// ErrAutomationTarget is returned when the user a rule would notify doesn't take part
+// in the conversation
+var ErrAutomationTarget = errors.New("only participants can be notified")
+
+// Automation is a rule run when participants join or leave a conversation, or when a
+// message is sent to it
+type Automation struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	CreatedBy      *uuid.UUID `db:"created_by" json:"created_by,omitempty"`
+	Event          string     `db:"event" json:"event"`
+	Action         string     `db:"action" json:"action"`
+	Message        *string    `db:"message" json:"message,omitempty"`
+	WebhookURL     *string    `db:"webhook_url" json:"webhook_url,omitempty"`
+	WebhookSecret  *string    `db:"webhook_secret" json:"-"`
+	Enabled        bool       `db:"enabled" json:"enabled"`
+	LastRunAt      *time.Time `db:"last_run_at" json:"last_run_at,omitempty"`
+	LastError      *string    `db:"last_error" json:"last_error,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+
+	// MessageTypes limits message.created automations to these types; empty means all
+	MessageTypes pq.StringArray `db:"message_types" json:"message_types"`
+	// SenderPattern limits the automation to senders, or participants joining or
+	// leaving, whose username matches this glob, such as deploy-*
+	SenderPattern *string `db:"sender_pattern" json:"sender_pattern,omitempty"`
+	// PayloadTemplate replaces the body of webhooks; see webhook.Template
+	PayloadTemplate *string `db:"payload_template" json:"payload_template,omitempty"`
+	// ContentPattern and Keywords limit message.created automations to messages whose
+	// content matches the regular expression, or uses one of the keywords as a word
+	ContentPattern *string        `db:"content_pattern" json:"content_pattern,omitempty"`
+	Keywords       pq.StringArray `db:"keywords" json:"keywords"`
+	// NotifyUserID is who notify_user automations notify
+	NotifyUserID *uuid.UUID `db:"notify_user_id" json:"notify_user_id,omitempty"`
+	// Label is what add_label automations label the conversation with
+	Label *string `db:"label" json:"label,omitempty"`
+	// Runs are counted per minute; see ClaimRun
+	WindowStartedAt *time.Time `db:"window_started_at" json:"-"`
+	WindowRuns      int        `db:"window_runs" json:"-"`
+}
+
+// AutomationTrigger is an event checked against automations' conditions. Username is
+// the sender of the message or the participant who joined or left; MessageType and
+// Content are only set for messages, Content in plaintext.
+type AutomationTrigger struct {
+	Username    string
+	MessageType string
+	Content     string
+}
+
+// AutomationService stores conversation automations. Only the owner and admins of a
+// group may manage them.
+type AutomationService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewAutomationService creates a new automation service
+func NewAutomationService(db *sqlx.DB, encryptor encryption.Encryptor) *AutomationService {
+	return &AutomationService{db: db, encryptor: encryptor}
+}
+
+// Create adds an automation to a conversation on behalf of userID, refusing more than
+// max per conversation. Webhooks get a new secret, which is returned.
+func (s *AutomationService) Create(userID uuid.UUID, automation *Automation, max int) (string, error) {
+	if err := s.requireAdmin(automation.ConversationID, userID); err != nil {
+		return "", err
+	}
+
+	var count int
+	err := s.db.Get(&count, `
+		SELECT COUNT(*) FROM conversation_automations WHERE conversation_id = $1
+	`, automation.ConversationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to count automations: %w", err)
+	}
+	if count >= max {
+		return "", ErrQuotaExceeded
+	}
+
+	if automation.NotifyUserID != nil {
+		isParticipant, err := NewConversationService(s.db, s.encryptor).IsParticipant(automation.ConversationID, *automation.NotifyUserID)
+		if err != nil {
+			return "", err
+		}
+		if !isParticipant {
+			return "", ErrAutomationTarget
+		}
+	}
+
+	var secret string
+	if automation.Action == AutomationWebhook {
+		if secret, err = randomToken(32); err != nil {
+			return "", err
+		}
+		encrypted, err := s.encryptor.EncryptString(secret)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+		}
+		automation.WebhookSecret = &encrypted
+	}
+
+	automation.CreatedBy = &userID
+	err = s.db.Get(automation, `
+		INSERT INTO conversation_automations
+			(conversation_id, created_by, event, action, message, webhook_url, webhook_secret,
+			 message_types, sender_pattern, payload_template, content_pattern, keywords,
+			 notify_user_id, label)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING *
+	`, automation.ConversationID, userID, automation.Event, automation.Action,
+		automation.Message, automation.WebhookURL, automation.WebhookSecret,
+		pq.StringArray(automation.MessageTypes), automation.SenderPattern, automation.PayloadTemplate,
+		automation.ContentPattern, pq.StringArray(automation.Keywords), automation.NotifyUserID, automation.Label)
+	if err != nil {
+		return "", fmt.Errorf("failed to create automation: %w", err)
+	}
+	return secret, nil
+}
+
+// List returns a conversation's automations, oldest first
+func (s *AutomationService) List(conversationID, userID uuid.UUID) ([]Automation, error) {
+	if err := s.requireAdmin(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	automations := []Automation{}
+	err := s.db.Select(&automations, `
+		SELECT * FROM conversation_automations WHERE conversation_id = $1 ORDER BY created_at
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list automations: %w", err)
+	}
+	return automations, nil
+}
+
+// AutomationUpdate changes an automation. Nil fields are left as they are; empty ones
+// clear the filter or template.
+type AutomationUpdate struct {
+	Enabled         *bool
+	MessageTypes    []string
+	SenderPattern   *string
+	PayloadTemplate *string
+	ContentPattern  *string
+	Keywords        []string
+}
+
+// Update changes an automation of a conversation
+func (s *AutomationService) Update(conversationID, id, userID uuid.UUID, update AutomationUpdate) (*Automation, error) {
+	if err := s.requireAdmin(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	automation := &Automation{}
+	err := s.db.Get(automation, `
+		UPDATE conversation_automations SET
+			enabled = COALESCE($3, enabled),
+			message_types = COALESCE($4, message_types),
+			sender_pattern = CASE WHEN $5::text IS NULL THEN sender_pattern ELSE NULLIF($5, '') END,
+			payload_template = CASE WHEN $6::text IS NULL THEN payload_template ELSE NULLIF($6, '') END,
+			content_pattern = CASE WHEN $7::text IS NULL THEN content_pattern ELSE NULLIF($7, '') END,
+			keywords = COALESCE($8, keywords)
+		WHERE id = $1 AND conversation_id = $2
+		RETURNING *
+	`, id, conversationID, update.Enabled, pq.StringArray(update.MessageTypes),
+		update.SenderPattern, update.PayloadTemplate, update.ContentPattern, pq.StringArray(update.Keywords))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update automation: %w", err)
+	}
+	return automation, nil
+}
+
+// Delete removes an automation
+func (s *AutomationService) Delete(conversationID, id, userID uuid.UUID) error {
+	if err := s.requireAdmin(conversationID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM conversation_automations WHERE id = $1 AND conversation_id = $2
+	`, id, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete automation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ForEvent returns the enabled automations of a conversation for event, with webhook
+// secrets decrypted
+func (s *AutomationService) ForEvent(conversationID uuid.UUID, event string) ([]Automation, error) {
+	automations := []Automation{}
+	err := s.db.Select(&automations, `
+		SELECT * FROM conversation_automations
+		WHERE conversation_id = $1 AND event = $2 AND enabled = true
+		ORDER BY created_at
+	`, conversationID, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list automations: %w", err)
+	}
+
+	for i := range automations {
+		if automations[i].WebhookSecret == nil {
+			continue
+		}
+		secret, err := s.encryptor.DecryptString(*automations[i].WebhookSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt webhook secret: %w", err)
+		}
+		automations[i].WebhookSecret = &secret
+	}
+	return automations, nil
+}
+
+// Matches reports whether a trigger meets the automation's conditions. Message types,
+// the content pattern and keywords are only checked for messages.
+func (a *Automation) Matches(trigger AutomationTrigger) bool {
+	if a.SenderPattern != nil {
+		matched, err := path.Match(strings.ToLower(*a.SenderPattern), strings.ToLower(trigger.Username))
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if a.Event != AutomationMessageCreated {
+		return true
+	}
+
+	if len(a.MessageTypes) > 0 {
+		found := false
+		for _, t := range a.MessageTypes {
+			found = found || t == trigger.MessageType
+		}
+		if !found {
+			return false
+		}
+	}
+	if a.ContentPattern != nil {
+		pattern, err := regexp.Compile(*a.ContentPattern)
+		if err != nil || !pattern.MatchString(trigger.Content) {
+			return false
+		}
+	}
+	if len(a.Keywords) > 0 {
+		found := false
+		for _, keyword := range a.Keywords {
+			found = found || containsKeyword(trigger.Content, keyword)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ClaimRun counts a run of an automation, returning false when it has already run max
+// times in the current minute
+func (s *AutomationService) ClaimRun(id uuid.UUID, max int) (bool, error) {
+	var runs int
+	err := s.db.Get(&runs, `
+		UPDATE conversation_automations SET
+			window_started_at = CASE WHEN window_started_at > NOW() - INTERVAL '1 minute'
+				THEN window_started_at ELSE NOW() END,
+			window_runs = CASE WHEN window_started_at > NOW() - INTERVAL '1 minute'
+				THEN window_runs + 1 ELSE 1 END
+		WHERE id = $1
+		RETURNING window_runs
+	`, id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to count automation run: %w", err)
+	}
+	return runs <= max, nil
+}
+
+// RecordRun records when an automation last ran and how it went
+func (s *AutomationService) RecordRun(id uuid.UUID, runErr error) error {
+	var lastError *string
+	if runErr != nil {
+		message := runErr.Error()
+		lastError = &message
+	}
+	_, err := s.db.Exec(`
+		UPDATE conversation_automations SET last_run_at = CURRENT_TIMESTAMP, last_error = $2
+		WHERE id = $1
+	`, id, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to record automation run: %w", err)
+	}
+	return nil
+}
+
+// requireAdmin checks that userID may manage the conversation's automations
+func (s *AutomationService) requireAdmin(conversationID, userID uuid.UUID) error {
+	return requireGroupAdmin(s.db, conversationID, userID)
+}
+
+// requireGroupAdmin returns ErrConversationNotFound unless userID takes part in the
+// conversation, ErrGroupOnly for direct conversations and ErrNotAdmin unless userID
+// is its owner or an admin
+func requireGroupAdmin(db sqlx.Queryer, conversationID, userID uuid.UUID) error {
+	role, err := groupRole(db, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" && role != "admin" {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+// groupRole returns userID's role in a group, ErrConversationNotFound unless they take
+// part in the conversation and ErrGroupOnly for direct conversations
+func groupRole(db sqlx.Queryer, conversationID, userID uuid.UUID) (string, error) {
+	var participant struct {
+		Type string `db:"type"`
+		Role string `db:"role"`
+	}
+	err := sqlx.Get(db, &participant, `
+		SELECT c.type, cp.role
+		FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = $2
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return "", ErrConversationNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check role: %w", err)
+	}
+	if participant.Type != "group" {
+		return "", ErrGroupOnly
+	}
+	return participant.Role, nil
+}
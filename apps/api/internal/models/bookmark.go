@@ -0,0 +1,339 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// maxBookmarks bounds the messages a user can save, which keeps searching them in
+	// memory cheap
+	maxBookmarks = 1000
+	// maxBookmarkFolders bounds the folders a user can file bookmarks in
+	maxBookmarkFolders = 100
+)
+
+var (
+	// ErrBookmarkFolderNotFound is returned for a folder the user doesn't have
+	ErrBookmarkFolderNotFound = errors.New("bookmark folder not found")
+	// ErrBookmarkLimit is returned when a user has as many bookmarks or folders as allowed
+	ErrBookmarkLimit = errors.New("bookmark limit reached")
+)
+
+// BookmarkFolder is a folder a user files saved messages in
+type BookmarkFolder struct {
+	ID            uuid.UUID `db:"id" json:"id"`
+	Name          string    `db:"name" json:"name" example:"Recipes"`
+	BookmarkCount int       `db:"bookmark_count" json:"bookmark_count"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Bookmark is a message a user saved, with the folder it is filed in and a note only
+// they can see
+type Bookmark struct {
+	MessageID uuid.UUID  `db:"message_id" json:"message_id"`
+	FolderID  *uuid.UUID `db:"folder_id" json:"folder_id,omitempty"`
+	Note      *string    `db:"note" json:"note,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+	Message   *Message   `db:"-" json:"message,omitempty"`
+}
+
+// BookmarkFilter narrows a user's bookmarks
+type BookmarkFilter struct {
+	// FolderID only keeps the bookmarks filed in this folder
+	FolderID *uuid.UUID
+	// Query only keeps bookmarks whose message, sender or note contains it, ignoring case
+	Query string
+}
+
+// BookmarkService handles saved messages and their folders
+type BookmarkService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewBookmarkService creates a new bookmark service
+func NewBookmarkService(db *sqlx.DB, encryptor encryption.Encryptor) *BookmarkService {
+	return &BookmarkService{db: db, encryptor: encryptor}
+}
+
+// GetFolders returns a user's folders by name, with how many bookmarks each holds
+func (s *BookmarkService) GetFolders(userID uuid.UUID) ([]BookmarkFolder, error) {
+	folders := []BookmarkFolder{}
+	err := s.db.Select(&folders, `
+		SELECT f.id, f.name, f.created_at, f.updated_at, COUNT(b.message_id) AS bookmark_count
+		FROM bookmark_folders f
+		LEFT JOIN message_bookmarks b ON b.folder_id = f.id
+		WHERE f.user_id = $1
+		GROUP BY f.id
+		ORDER BY f.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmark folders: %w", err)
+	}
+	return folders, nil
+}
+
+// CreateFolder adds a folder. A user's folder names are unique; ErrConflict is returned
+// for one that is taken.
+func (s *BookmarkService) CreateFolder(userID uuid.UUID, name string) (*BookmarkFolder, error) {
+	var count int
+	if err := s.db.Get(&count, `SELECT COUNT(*) FROM bookmark_folders WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to count bookmark folders: %w", err)
+	}
+	if count >= maxBookmarkFolders {
+		return nil, ErrBookmarkLimit
+	}
+
+	folder := &BookmarkFolder{}
+	err := s.db.Get(folder, `
+		INSERT INTO bookmark_folders (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, name, created_at, updated_at
+	`, userID, name)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bookmark folder: %w", err)
+	}
+	return folder, nil
+}
+
+// RenameFolder renames one of a user's folders
+func (s *BookmarkService) RenameFolder(id, userID uuid.UUID, name string) (*BookmarkFolder, error) {
+	folder := &BookmarkFolder{}
+	err := s.db.Get(folder, `
+		UPDATE bookmark_folders f
+		SET name = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE f.id = $1 AND f.user_id = $2
+		RETURNING f.id, f.name, f.created_at, f.updated_at,
+			(SELECT COUNT(*) FROM message_bookmarks b WHERE b.folder_id = f.id) AS bookmark_count
+	`, id, userID, name)
+	if err == sql.ErrNoRows {
+		return nil, ErrBookmarkFolderNotFound
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename bookmark folder: %w", err)
+	}
+	return folder, nil
+}
+
+// DeleteFolder removes one of a user's folders. Its bookmarks are kept, unfiled.
+func (s *BookmarkService) DeleteFolder(id, userID uuid.UUID) error {
+	result, err := s.db.Exec(`DELETE FROM bookmark_folders WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete bookmark folder: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrBookmarkFolderNotFound
+	}
+	return nil
+}
+
+// Save bookmarks a message the user can read, or refiles it and replaces its note
+// when it is bookmarked already. ErrNotFound is returned for messages they can't read.
+func (s *BookmarkService) Save(userID, messageID uuid.UUID, folderID *uuid.UUID, note *string) (*Bookmark, error) {
+	messages, err := NewMessageService(s.db, s.encryptor).GetByIDsForUser([]uuid.UUID{messageID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrNotFound
+	}
+	if err := s.checkFolder(userID, folderID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = s.db.Get(&count, `
+		SELECT COUNT(*) FROM message_bookmarks WHERE user_id = $1 AND message_id <> $2
+	`, userID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count bookmarks: %w", err)
+	}
+	if count >= maxBookmarks {
+		return nil, ErrBookmarkLimit
+	}
+
+	sealed, err := s.sealNote(note)
+	if err != nil {
+		return nil, err
+	}
+	bookmark := &Bookmark{}
+	err = s.db.Get(bookmark, `
+		INSERT INTO message_bookmarks (user_id, message_id, folder_id, note)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, message_id) DO UPDATE
+		SET folder_id = EXCLUDED.folder_id, note = EXCLUDED.note, updated_at = CURRENT_TIMESTAMP
+		RETURNING message_id, folder_id, note, created_at, updated_at
+	`, userID, messageID, folderID, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save bookmark: %w", err)
+	}
+	bookmark.Note = note
+	bookmark.Message = &messages[0]
+	return bookmark, nil
+}
+
+// Update refiles a bookmark and replaces its note. A nil folder unfiles it and a nil
+// note clears it.
+func (s *BookmarkService) Update(userID, messageID uuid.UUID, folderID *uuid.UUID, note *string) (*Bookmark, error) {
+	if err := s.checkFolder(userID, folderID); err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealNote(note)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmark := &Bookmark{}
+	err = s.db.Get(bookmark, `
+		UPDATE message_bookmarks
+		SET folder_id = $3, note = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND message_id = $2
+		RETURNING message_id, folder_id, note, created_at, updated_at
+	`, userID, messageID, folderID, sealed)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bookmark: %w", err)
+	}
+	bookmark.Note = note
+	return bookmark, nil
+}
+
+// Delete removes a bookmark
+func (s *BookmarkService) Delete(userID, messageID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		DELETE FROM message_bookmarks WHERE user_id = $1 AND message_id = $2
+	`, userID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete bookmark: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns a user's bookmarks matching filter, most recently saved first, with
+// their messages. Bookmarks of messages the user can no longer read, because they were
+// deleted or the user left the conversation, are left out. Message content and notes
+// are encrypted, so the query is matched after decrypting them.
+func (s *BookmarkService) List(userID uuid.UUID, filter BookmarkFilter, limit, offset int) ([]Bookmark, error) {
+	bookmarks := []Bookmark{}
+	err := s.db.Select(&bookmarks, `
+		SELECT message_id, folder_id, note, created_at, updated_at
+		FROM message_bookmarks
+		WHERE user_id = $1 AND ($2::uuid IS NULL OR folder_id = $2)
+		ORDER BY created_at DESC
+	`, userID, filter.FolderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmarks: %w", err)
+	}
+
+	ids := make([]uuid.UUID, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		ids[i] = bookmark.MessageID
+	}
+	messages, err := NewMessageService(s.db, s.encryptor).GetByIDsForUser(ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	readable := make(map[uuid.UUID]*Message, len(messages))
+	for i := range messages {
+		readable[messages[i].ID] = &messages[i]
+	}
+
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+	found := []Bookmark{}
+	for _, bookmark := range bookmarks {
+		message, ok := readable[bookmark.MessageID]
+		if !ok {
+			continue
+		}
+		if bookmark.Note, err = s.openNote(bookmark.Note); err != nil {
+			return nil, err
+		}
+		bookmark.Message = message
+		if query != "" && !bookmark.matches(query) {
+			continue
+		}
+		found = append(found, bookmark)
+	}
+
+	if offset >= len(found) {
+		return []Bookmark{}, nil
+	}
+	found = found[offset:]
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+// matches reports whether the bookmark's message, sender or note contains query,
+// which is lowercase
+func (b *Bookmark) matches(query string) bool {
+	if strings.Contains(strings.ToLower(b.Message.Content), query) ||
+		strings.Contains(strings.ToLower(b.Message.SenderUsername), query) {
+		return true
+	}
+	return b.Note != nil && strings.Contains(strings.ToLower(*b.Note), query)
+}
+
+// checkFolder returns ErrBookmarkFolderNotFound unless folderID is unset or one of the
+// user's folders
+func (s *BookmarkService) checkFolder(userID uuid.UUID, folderID *uuid.UUID) error {
+	if folderID == nil {
+		return nil
+	}
+	var owned bool
+	err := s.db.Get(&owned, `
+		SELECT EXISTS (SELECT 1 FROM bookmark_folders WHERE id = $1 AND user_id = $2)
+	`, *folderID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check bookmark folder: %w", err)
+	}
+	if !owned {
+		return ErrBookmarkFolderNotFound
+	}
+	return nil
+}
+
+func (s *BookmarkService) sealNote(note *string) (*string, error) {
+	if note == nil {
+		return note, nil
+	}
+	sealed, err := s.encryptor.EncryptString(*note)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt note: %w", err)
+	}
+	return &sealed, nil
+}
+
+func (s *BookmarkService) openNote(note *string) (*string, error) {
+	if note == nil {
+		return note, nil
+	}
+	opened, err := s.encryptor.DecryptString(*note)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt note: %w", err)
+	}
+	return &opened, nil
+}
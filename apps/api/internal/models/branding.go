@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultUserStatus is the status new users start with unless the workspace sets its own
+const DefaultUserStatus = "Hey, I'm using Talkify!"
+
+// WorkspaceBranding is how the workspace presents itself to clients
+type WorkspaceBranding struct {
+	Name          string     `db:"name" json:"name" example:"Talkify"`
+	LogoURL       *string    `db:"logo_url" json:"logo_url,omitempty" example:"https://example.com/logo.png"`
+	AccentColor   *string    `db:"accent_color" json:"accent_color,omitempty" example:"#3b82f6"`
+	DefaultStatus string     `db:"default_status" json:"default_status" example:"Hey, I'm using Talkify!"`
+	UpdatedBy     *uuid.UUID `db:"updated_by" json:"-"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type BrandingService struct {
+	db *sqlx.DB
+}
+
+func NewBrandingService(db *sqlx.DB) *BrandingService {
+	return &BrandingService{db: db}
+}
+
+// Get returns the workspace branding
+func (s *BrandingService) Get() (*WorkspaceBranding, error) {
+	branding := &WorkspaceBranding{}
+	err := s.db.Get(branding, `
+		SELECT name, logo_url, accent_color, default_status, updated_by, updated_at
+		FROM workspace_branding
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace branding: %w", err)
+	}
+	return branding, nil
+}
+
+// Update replaces the workspace branding. The default status only applies to users who
+// sign up afterwards.
+func (s *BrandingService) Update(branding *WorkspaceBranding) error {
+	err := s.db.Get(branding, `
+		UPDATE workspace_branding
+		SET name = $1, logo_url = $2, accent_color = $3, default_status = $4, updated_by = $5,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING name, logo_url, accent_color, default_status, updated_by, updated_at
+	`, branding.Name, branding.LogoURL, branding.AccentColor, branding.DefaultStatus, branding.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace branding: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Channels an urgent broadcast is delivered through
+const (
+	BroadcastChannelNotification = "notification"
+	BroadcastChannelEmail        = "email"
+)
+
+// UrgentBroadcast is a message administrators send during an incident. It goes out
+// through every channel a recipient can be reached on, and each of them is asked to
+// acknowledge it.
+type UrgentBroadcast struct {
+	ID       uuid.UUID  `db:"id" json:"id"`
+	SenderID *uuid.UUID `db:"sender_id" json:"sender_id,omitempty"`
+	// ConversationID limits the broadcast to the conversation's participants
+	ConversationID *uuid.UUID `db:"conversation_id" json:"conversation_id,omitempty"`
+	Title          string     `db:"title" json:"title" example:"Checkout is down"`
+	Body           string     `db:"body" json:"body" example:"Join the incident bridge now."`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
+
+// BroadcastRecipient is where a broadcast stands for one of its recipients
+type BroadcastRecipient struct {
+	UserID         uuid.UUID      `db:"user_id" json:"user_id"`
+	Username       string         `db:"username" json:"username"`
+	Channels       pq.StringArray `db:"channels" json:"channels"`
+	DeliveredAt    *time.Time     `db:"delivered_at" json:"delivered_at,omitempty"`
+	AcknowledgedAt *time.Time     `db:"acknowledged_at" json:"acknowledged_at,omitempty"`
+}
+
+// BroadcastSummary is a broadcast with how many of its recipients acknowledged it
+type BroadcastSummary struct {
+	UrgentBroadcast
+	Recipients   int `db:"recipients" json:"recipients"`
+	Delivered    int `db:"delivered" json:"delivered"`
+	Acknowledged int `db:"acknowledged" json:"acknowledged"`
+}
+
+// BroadcastService stores urgent broadcasts and their acknowledgments
+type BroadcastService struct {
+	db *sqlx.DB
+}
+
+// NewBroadcastService creates a new broadcast service
+func NewBroadcastService(db *sqlx.DB) *BroadcastService {
+	return &BroadcastService{db: db}
+}
+
+// Create stores a broadcast along with its recipients: the conversation's participants
+// when it has one, every active user otherwise. The sender is not a recipient.
+// ErrConversationNotFound is returned for a conversation that doesn't exist.
+func (s *BroadcastService) Create(broadcast *UrgentBroadcast) (int, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if broadcast.ConversationID != nil {
+		var exists bool
+		err := tx.Get(&exists, `
+			SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1 AND deleted_at IS NULL)
+		`, broadcast.ConversationID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check conversation: %w", err)
+		}
+		if !exists {
+			return 0, ErrConversationNotFound
+		}
+	}
+
+	err = tx.Get(broadcast, `
+		INSERT INTO urgent_broadcasts (sender_id, conversation_id, title, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *
+	`, broadcast.SenderID, broadcast.ConversationID, broadcast.Title, broadcast.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create broadcast: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO urgent_broadcast_recipients (broadcast_id, user_id)
+		SELECT $1, u.id FROM users u
+		WHERE u.is_active = true
+			AND u.id IS DISTINCT FROM $2
+			AND ($3::uuid IS NULL OR EXISTS (
+				SELECT 1 FROM conversation_participants cp
+				WHERE cp.conversation_id = $3 AND cp.user_id = u.id
+			))
+	`, broadcast.ID, broadcast.SenderID, broadcast.ConversationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add broadcast recipients: %w", err)
+	}
+	recipients, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(recipients), nil
+}
+
+// RecipientIDs returns the users a broadcast is for
+func (s *BroadcastService) RecipientIDs(broadcastID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT user_id FROM urgent_broadcast_recipients WHERE broadcast_id = $1
+	`, broadcastID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcast recipients: %w", err)
+	}
+	return ids, nil
+}
+
+// MarkDelivered records the channels a broadcast reached a recipient through
+func (s *BroadcastService) MarkDelivered(broadcastID, userID uuid.UUID, channels []string) error {
+	_, err := s.db.Exec(`
+		UPDATE urgent_broadcast_recipients
+		SET channels = $3, delivered_at = CURRENT_TIMESTAMP
+		WHERE broadcast_id = $1 AND user_id = $2
+	`, broadcastID, userID, pq.StringArray(channels))
+	if err != nil {
+		return fmt.Errorf("failed to mark broadcast delivered: %w", err)
+	}
+	return nil
+}
+
+// Acknowledge records that a recipient has seen a broadcast; acknowledging again keeps
+// the first time. ErrNotFound is returned when the user isn't a recipient.
+func (s *BroadcastService) Acknowledge(broadcastID, userID uuid.UUID) (time.Time, error) {
+	var acknowledgedAt time.Time
+	err := s.db.Get(&acknowledgedAt, `
+		UPDATE urgent_broadcast_recipients
+		SET acknowledged_at = COALESCE(acknowledged_at, CURRENT_TIMESTAMP)
+		WHERE broadcast_id = $1 AND user_id = $2
+		RETURNING acknowledged_at
+	`, broadcastID, userID)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to acknowledge broadcast: %w", err)
+	}
+	return acknowledgedAt, nil
+}
+
+// Pending returns the broadcasts a user has yet to acknowledge, newest first
+func (s *BroadcastService) Pending(userID uuid.UUID) ([]UrgentBroadcast, error) {
+	broadcasts := []UrgentBroadcast{}
+	err := s.db.Select(&broadcasts, `
+		SELECT b.* FROM urgent_broadcasts b
+		JOIN urgent_broadcast_recipients r ON r.broadcast_id = b.id
+		WHERE r.user_id = $1 AND r.acknowledged_at IS NULL
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending broadcasts: %w", err)
+	}
+	return broadcasts, nil
+}
+
+// broadcastSummaryQuery selects broadcasts with their recipient counts
+const broadcastSummaryQuery = `
+	SELECT b.*,
+		COUNT(r.user_id) AS recipients,
+		COUNT(r.delivered_at) AS delivered,
+		COUNT(r.acknowledged_at) AS acknowledged
+	FROM urgent_broadcasts b
+	LEFT JOIN urgent_broadcast_recipients r ON r.broadcast_id = b.id`
+
+// List returns broadcasts, newest first, with how far acknowledgment has got
+func (s *BroadcastService) List(limit, offset int) ([]BroadcastSummary, error) {
+	summaries := []BroadcastSummary{}
+	err := s.db.Select(&summaries, broadcastSummaryQuery+`
+		GROUP BY b.id
+		ORDER BY b.created_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broadcasts: %w", err)
+	}
+	return summaries, nil
+}
+
+// Report returns a broadcast with each of its recipients, those yet to acknowledge it
+// first
+func (s *BroadcastService) Report(broadcastID uuid.UUID) (*BroadcastSummary, []BroadcastRecipient, error) {
+	summary := &BroadcastSummary{}
+	err := s.db.Get(summary, broadcastSummaryQuery+`
+		WHERE b.id = $1
+		GROUP BY b.id
+	`, broadcastID)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get broadcast: %w", err)
+	}
+
+	recipients := []BroadcastRecipient{}
+	err = s.db.Select(&recipients, `
+		SELECT r.user_id, u.username, r.channels, r.delivered_at, r.acknowledged_at
+		FROM urgent_broadcast_recipients r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.broadcast_id = $1
+		ORDER BY r.acknowledged_at IS NOT NULL, r.acknowledged_at, u.username
+	`, broadcastID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get broadcast recipients: %w", err)
+	}
+	return summary, recipients, nil
+}
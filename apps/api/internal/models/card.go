@@ -0,0 +1,319 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	maxCardTitle      = 256
+	maxCardText       = 4000
+	maxCardFields     = 25
+	maxCardFieldName  = 256
+	maxCardFieldValue = 1024
+	maxCardImages     = 4
+	maxCardButtons    = 5
+	maxCardSelects    = 3
+	maxCardOptions    = 25
+	maxCardLabel      = 80
+	maxCardValue      = 2000
+	maxCardURL        = 2048
+)
+
+// Button styles
+const (
+	CardButtonDefault = ""
+	CardButtonPrimary = "primary"
+	CardButtonDanger  = "danger"
+)
+
+// ErrInvalidCard is returned for a card that doesn't follow the card schema
+var ErrInvalidCard = errors.New("invalid card")
+
+var cardActionPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+
+// MessageCard is a structured layout integrations attach to their messages. The
+// message's content is the card's fallback for clients that don't render cards.
+type MessageCard struct {
+	Title   string       `json:"title,omitempty" example:"Deploy #42 failed"`
+	Text    string       `json:"text,omitempty"`
+	Fields  []CardField  `json:"fields,omitempty"`
+	Images  []CardImage  `json:"images,omitempty"`
+	Buttons []CardButton `json:"buttons,omitempty"`
+	Selects []CardSelect `json:"selects,omitempty"`
+	// ApplicationID is the application that posted the card and answers its actions.
+	// It is set by the server.
+	ApplicationID *uuid.UUID `json:"application_id,omitempty"`
+
+	// secret signs the callback tokens of the card's actions
+	secret string
+}
+
+// CardField is a labelled value shown on a card
+type CardField struct {
+	Name  string `json:"name" example:"Branch"`
+	Value string `json:"value" example:"main"`
+	// Inline fields may be shown side by side
+	Inline bool `json:"inline,omitempty"`
+}
+
+// CardImage is an image shown on a card
+type CardImage struct {
+	URL     string `json:"url" example:"https://example.com/chart.png"`
+	AltText string `json:"alt_text,omitempty"`
+}
+
+// CardButton is a button on a card. A button either opens URL or sends Action, with
+// Value, back to the application that posted the card.
+type CardButton struct {
+	Label  string `json:"label" example:"Retry"`
+	Style  string `json:"style,omitempty" enums:"primary,danger"`
+	Action string `json:"action,omitempty" example:"retry"`
+	Value  string `json:"value,omitempty"`
+	URL    string `json:"url,omitempty"`
+	// CallbackToken is set by the server on action buttons; clicks post it to
+	// /interactions
+	CallbackToken string `json:"callback_token,omitempty"`
+}
+
+// CardSelect is a menu on a card. Picking one of its options sends Action, with the
+// option's value, back to the application that posted the card.
+type CardSelect struct {
+	Action      string       `json:"action" example:"assign"`
+	Placeholder string       `json:"placeholder,omitempty" example:"Assign to"`
+	Options     []CardOption `json:"options"`
+	// CallbackToken is set by the server; picks post it to /interactions
+	CallbackToken string `json:"callback_token,omitempty"`
+}
+
+// CardOption is an option of a card's select menu
+type CardOption struct {
+	Label string `json:"label" example:"Alice"`
+	Value string `json:"value" example:"alice"`
+}
+
+// Validate checks a card against the card schema. Action buttons are only allowed
+// when callbacks is set, for cards posted by an application that can answer them.
+func (c *MessageCard) Validate(callbacks bool) error {
+	if c.Title == "" && c.Text == "" && len(c.Fields) == 0 && len(c.Images) == 0 {
+		return fmt.Errorf("%w: a card needs a title, text, fields or images", ErrInvalidCard)
+	}
+	if len(c.Title) > maxCardTitle {
+		return fmt.Errorf("%w: title is longer than %d bytes", ErrInvalidCard, maxCardTitle)
+	}
+	if len(c.Text) > maxCardText {
+		return fmt.Errorf("%w: text is longer than %d bytes", ErrInvalidCard, maxCardText)
+	}
+
+	if len(c.Fields) > maxCardFields {
+		return fmt.Errorf("%w: at most %d fields are allowed", ErrInvalidCard, maxCardFields)
+	}
+	for i, field := range c.Fields {
+		if field.Name == "" || len(field.Name) > maxCardFieldName {
+			return fmt.Errorf("%w: field %d needs a name of at most %d bytes", ErrInvalidCard, i, maxCardFieldName)
+		}
+		if len(field.Value) > maxCardFieldValue {
+			return fmt.Errorf("%w: field %d has a value longer than %d bytes", ErrInvalidCard, i, maxCardFieldValue)
+		}
+	}
+
+	if len(c.Images) > maxCardImages {
+		return fmt.Errorf("%w: at most %d images are allowed", ErrInvalidCard, maxCardImages)
+	}
+	for i, image := range c.Images {
+		if !isCardURL(image.URL) {
+			return fmt.Errorf("%w: image %d needs an https URL", ErrInvalidCard, i)
+		}
+		if len(image.AltText) > maxCardFieldName {
+			return fmt.Errorf("%w: image %d has alt text longer than %d bytes", ErrInvalidCard, i, maxCardFieldName)
+		}
+	}
+
+	if len(c.Buttons) > maxCardButtons {
+		return fmt.Errorf("%w: at most %d buttons are allowed", ErrInvalidCard, maxCardButtons)
+	}
+	actions := make(map[string]bool)
+	for i, button := range c.Buttons {
+		if button.Label == "" || len(button.Label) > maxCardLabel {
+			return fmt.Errorf("%w: button %d needs a label of at most %d bytes", ErrInvalidCard, i, maxCardLabel)
+		}
+		switch button.Style {
+		case CardButtonDefault, CardButtonPrimary, CardButtonDanger:
+		default:
+			return fmt.Errorf("%w: button %d has an unknown style", ErrInvalidCard, i)
+		}
+		if (button.Action == "") == (button.URL == "") {
+			return fmt.Errorf("%w: button %d needs either an action or a url", ErrInvalidCard, i)
+		}
+		if button.URL != "" {
+			if !isCardURL(button.URL) {
+				return fmt.Errorf("%w: button %d needs an https URL", ErrInvalidCard, i)
+			}
+			if button.Value != "" {
+				return fmt.Errorf("%w: button %d has a value but no action", ErrInvalidCard, i)
+			}
+			continue
+		}
+		if !callbacks {
+			return fmt.Errorf("%w: action buttons can only be posted by applications", ErrInvalidCard)
+		}
+		if !cardActionPattern.MatchString(button.Action) {
+			return fmt.Errorf("%w: button %d has an invalid action", ErrInvalidCard, i)
+		}
+		if actions[button.Action] {
+			return fmt.Errorf("%w: action %q is used by more than one button", ErrInvalidCard, button.Action)
+		}
+		actions[button.Action] = true
+		if len(button.Value) > maxCardValue {
+			return fmt.Errorf("%w: button %d has a value longer than %d bytes", ErrInvalidCard, i, maxCardValue)
+		}
+	}
+
+	if len(c.Selects) > maxCardSelects {
+		return fmt.Errorf("%w: at most %d selects are allowed", ErrInvalidCard, maxCardSelects)
+	}
+	for i, menu := range c.Selects {
+		if !callbacks {
+			return fmt.Errorf("%w: selects can only be posted by applications", ErrInvalidCard)
+		}
+		if !cardActionPattern.MatchString(menu.Action) {
+			return fmt.Errorf("%w: select %d has an invalid action", ErrInvalidCard, i)
+		}
+		if actions[menu.Action] {
+			return fmt.Errorf("%w: action %q is used by more than one component", ErrInvalidCard, menu.Action)
+		}
+		actions[menu.Action] = true
+		if len(menu.Placeholder) > maxCardLabel {
+			return fmt.Errorf("%w: select %d has a placeholder longer than %d bytes", ErrInvalidCard, i, maxCardLabel)
+		}
+		if len(menu.Options) == 0 || len(menu.Options) > maxCardOptions {
+			return fmt.Errorf("%w: select %d needs 1 to %d options", ErrInvalidCard, i, maxCardOptions)
+		}
+		values := make(map[string]bool)
+		for j, option := range menu.Options {
+			if option.Label == "" || len(option.Label) > maxCardLabel {
+				return fmt.Errorf("%w: option %d of select %d needs a label of at most %d bytes", ErrInvalidCard, j, i, maxCardLabel)
+			}
+			if option.Value == "" || len(option.Value) > maxCardLabel {
+				return fmt.Errorf("%w: option %d of select %d needs a value of at most %d bytes", ErrInvalidCard, j, i, maxCardLabel)
+			}
+			if values[option.Value] {
+				return fmt.Errorf("%w: select %d has value %q more than once", ErrInvalidCard, i, option.Value)
+			}
+			values[option.Value] = true
+		}
+	}
+	return nil
+}
+
+func isCardURL(raw string) bool {
+	if len(raw) > maxCardURL {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != "" && u.User == nil
+}
+
+// storeCard keeps the card of a new message, encrypted like its content, with a new
+// secret for its callback tokens. The card gets its tokens.
+func storeCard(tx *sqlx.Tx, encryptor encryption.Encryptor, messageID uuid.UUID, card *MessageCard) error {
+	sealed, err := sealCard(encryptor, card)
+	if err != nil {
+		return err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate callback secret: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO message_cards (message_id, application_id, card, callback_secret)
+		VALUES ($1, $2, $3, $4)
+	`, messageID, card.ApplicationID, sealed, hex.EncodeToString(secret))
+	if err != nil {
+		return fmt.Errorf("failed to store card: %w", err)
+	}
+	card.secret = hex.EncodeToString(secret)
+	card.signActions(messageID)
+	return nil
+}
+
+// sealCard encodes a card for storage, without its callback tokens, encrypted like
+// message content
+func sealCard(encryptor encryption.Encryptor, card *MessageCard) (string, error) {
+	stored := *card
+	stored.Buttons = append([]CardButton(nil), card.Buttons...)
+	for i := range stored.Buttons {
+		stored.Buttons[i].CallbackToken = ""
+	}
+	stored.Selects = append([]CardSelect(nil), card.Selects...)
+	for i := range stored.Selects {
+		stored.Selects[i].CallbackToken = ""
+	}
+
+	encoded, err := json.Marshal(&stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode card: %w", err)
+	}
+	sealed, err := encryptor.EncryptString(string(encoded))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt card: %w", err)
+	}
+	return sealed, nil
+}
+
+// attachCards fills in the cards of messages with a single query
+func (s *MessageService) attachCards(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID.String()
+	}
+
+	rows := []struct {
+		MessageID      uuid.UUID  `db:"message_id"`
+		ApplicationID  *uuid.UUID `db:"application_id"`
+		Card           string     `db:"card"`
+		CallbackSecret string     `db:"callback_secret"`
+	}{}
+	err := s.db.Select(&rows, `
+		SELECT message_id, application_id, card, callback_secret FROM message_cards
+		WHERE message_id = ANY($1::uuid[])
+	`, pq.StringArray(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get cards: %w", err)
+	}
+
+	cards := make(map[uuid.UUID]*MessageCard, len(rows))
+	for _, row := range rows {
+		encoded, err := s.encryptor.DecryptString(row.Card)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt card of message %s: %w", row.MessageID, err)
+		}
+		card := &MessageCard{}
+		if err := json.Unmarshal([]byte(encoded), card); err != nil {
+			return fmt.Errorf("failed to decode card of message %s: %w", row.MessageID, err)
+		}
+		card.ApplicationID = row.ApplicationID
+		card.secret = row.CallbackSecret
+		card.signActions(row.MessageID)
+		cards[row.MessageID] = card
+	}
+	for _, message := range messages {
+		message.Card = cards[message.ID]
+	}
+	return nil
+}
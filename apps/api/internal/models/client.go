@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"talkify/apps/api/internal/clientversion"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ClientVersionCount is how many users last used a version of the app on a platform
+type ClientVersionCount struct {
+	Platform   string    `db:"platform" json:"platform" example:"ios"`
+	Version    string    `db:"version" json:"version" example:"2.3.0"`
+	Users      int       `db:"users" json:"users"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"`
+}
+
+// ClientService records the app versions users' clients report
+type ClientService struct {
+	db *sqlx.DB
+}
+
+// NewClientService creates a new client service
+func NewClientService(db *sqlx.DB) *ClientService {
+	return &ClientService{db: db}
+}
+
+// Record notes that the user was just seen using version of the app on platform
+func (s *ClientService) Record(userID uuid.UUID, platform, version string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_clients (user_id, platform, version)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, platform, version) DO UPDATE SET last_seen_at = CURRENT_TIMESTAMP
+	`, userID, platform, version)
+	if err != nil {
+		return fmt.Errorf("failed to record client version: %w", err)
+	}
+	return nil
+}
+
+// Distribution counts the users seen since then by the version they used last on each
+// platform, so users who upgraded are only counted once. It is ordered by platform,
+// newest version first.
+func (s *ClientService) Distribution(since time.Time) ([]ClientVersionCount, error) {
+	counts := []ClientVersionCount{}
+	err := s.db.Select(&counts, `
+		SELECT platform, version, COUNT(*) AS users, MAX(last_seen_at) AS last_seen_at
+		FROM (
+			SELECT DISTINCT ON (c.user_id, c.platform) c.platform, c.version, c.last_seen_at
+			FROM user_clients c
+			JOIN users u ON u.id = c.user_id
+			WHERE c.last_seen_at >= $1 AND u.deactivated_at IS NULL
+			ORDER BY c.user_id, c.platform, c.last_seen_at DESC
+		) latest
+		GROUP BY platform, version
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client versions: %w", err)
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Platform != counts[j].Platform {
+			return counts[i].Platform < counts[j].Platform
+		}
+		a, errA := clientversion.Parse(counts[i].Version)
+		b, errB := clientversion.Parse(counts[j].Version)
+		if errA != nil || errB != nil {
+			return counts[i].Version > counts[j].Version
+		}
+		return a.Compare(b) > 0
+	})
+	return counts, nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// HeldUser is a user on legal hold
+type HeldUser struct {
+	ID       uuid.UUID `db:"id" json:"id"`
+	Username string    `db:"username" json:"username"`
+	IsActive bool      `db:"is_active" json:"is_active"`
+}
+
+// HeldConversation is a conversation on legal hold
+type HeldConversation struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	Type      string     `db:"type" json:"type"`
+	Name      *string    `db:"name" json:"name,omitempty"`
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// LegalHolds lists everything on legal hold
+type LegalHolds struct {
+	Users         []HeldUser         `json:"users"`
+	Conversations []HeldConversation `json:"conversations"`
+}
+
+// ExportFilter selects the messages of a compliance export: those sent by UserID, or
+// those in ConversationID, optionally limited to a time range
+type ExportFilter struct {
+	UserID         *uuid.UUID
+	ConversationID *uuid.UUID
+	From           *time.Time
+	To             *time.Time
+}
+
+// ComplianceMessage is a message as recorded in a compliance export. Deleted messages
+// are included and marked as such.
+type ComplianceMessage struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	SenderID       uuid.UUID  `db:"sender_id" json:"sender_id"`
+	SenderUsername string     `db:"sender_username" json:"sender_username"`
+	ReplyToID      *uuid.UUID `db:"reply_to_id" json:"reply_to_id,omitempty"`
+	Content        string     `db:"content" json:"content"`
+	MessageType    string     `db:"message_type" json:"type"`
+	MediaURL       *string    `db:"media_url" json:"media_url,omitempty"`
+	MediaEncrypted bool       `db:"media_encrypted" json:"-"`
+	IsEdited       bool       `db:"is_edited" json:"is_edited"`
+	IsDeleted      bool       `db:"is_deleted" json:"is_deleted"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// ComplianceService manages legal holds and reads data for compliance exports
+type ComplianceService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewComplianceService creates a new compliance service
+func NewComplianceService(db *sqlx.DB, encryptor encryption.Encryptor) *ComplianceService {
+	return &ComplianceService{db: db, encryptor: encryptor}
+}
+
+// SetConversationHold puts a conversation on legal hold or lifts the hold. Deleted
+// conversations can be held too, which keeps them from being purged.
+func (s *ComplianceService) SetConversationHold(conversationID uuid.UUID, hold bool) error {
+	var updated uuid.UUID
+	err := s.db.Get(&updated, `
+		UPDATE conversations SET legal_hold = $2
+		WHERE id = $1
+		RETURNING id
+	`, conversationID, hold)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold: %w", err)
+	}
+	return nil
+}
+
+// ListHolds returns every user and conversation on legal hold
+func (s *ComplianceService) ListHolds() (*LegalHolds, error) {
+	holds := &LegalHolds{Users: []HeldUser{}, Conversations: []HeldConversation{}}
+	err := s.db.Select(&holds.Users, `
+		SELECT id, username, is_active FROM users
+		WHERE legal_hold
+		ORDER BY username
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held users: %w", err)
+	}
+	err = s.db.Select(&holds.Conversations, `
+		SELECT id, type, name, deleted_at FROM conversations
+		WHERE legal_hold
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held conversations: %w", err)
+	}
+	return holds, nil
+}
+
+// IsHeld reports whether the subject of an export filter is on legal hold. It returns
+// ErrNotFound when the user or conversation does not exist.
+func (s *ComplianceService) IsHeld(filter ExportFilter) (bool, error) {
+	var held bool
+	var err error
+	if filter.UserID != nil {
+		err = s.db.Get(&held, `SELECT legal_hold FROM users WHERE id = $1`, *filter.UserID)
+	} else {
+		err = s.db.Get(&held, `SELECT legal_hold FROM conversations WHERE id = $1`, *filter.ConversationID)
+	}
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check legal hold: %w", err)
+	}
+	return held, nil
+}
+
+// ExportMessages calls fn with every message matching filter, oldest first. Rows are
+// streamed so exports of any size run in constant memory.
+func (s *ComplianceService) ExportMessages(filter ExportFilter, fn func(*ComplianceMessage) error) error {
+	var conditions []string
+	var args []interface{}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("m.sender_id = $%d", len(args)))
+	}
+	if filter.ConversationID != nil {
+		args = append(args, *filter.ConversationID)
+		conditions = append(conditions, fmt.Sprintf("m.conversation_id = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("m.created_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("m.created_at < $%d", len(args)))
+	}
+	if len(conditions) == 0 {
+		return fmt.Errorf("export filter needs a user or conversation")
+	}
+
+	rows, err := s.db.Queryx(`
+		SELECT m.id, m.conversation_id, m.sender_id, u.username AS sender_username,
+			m.reply_to_id, m.content, m.message_type, m.media_url, m.media_encrypted, m.is_edited,
+			m.is_deleted, m.created_at, m.updated_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY m.created_at, m.id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message ComplianceMessage
+		if err := rows.StructScan(&message); err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		content, err := s.encryptor.DecryptString(message.Content)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt message %s: %w", message.ID, err)
+		}
+		message.Content = content
+		if message.MediaEncrypted && message.MediaURL != nil {
+			mediaURL, err := decryptMediaURL(s.encryptor, *message.MediaURL)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt message %s: %w", message.ID, err)
+			}
+			message.MediaURL = &mediaURL
+		}
+		if err := fn(&message); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
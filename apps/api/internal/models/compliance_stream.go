@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// complianceStreamLock serializes handing out stream offsets, so that they follow the
+// order events become visible in
+const complianceStreamLock int64 = 0x636f6d706c79 // "comply"
+
+// ComplianceEvent is a new, edited or deleted message as streamed to compliance
+// recorders. Content is what the message said at the time.
+type ComplianceEvent struct {
+	Offset         int64     `db:"stream_offset" json:"-"`
+	Event          string    `db:"event" json:"-"`
+	MessageID      uuid.UUID `db:"message_id" json:"message_id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	SenderID       uuid.UUID `db:"sender_id" json:"sender_id"`
+	MessageType    string    `db:"message_type" json:"type"`
+	Content        string    `db:"content" json:"content"`
+	OccurredAt     time.Time `db:"occurred_at" json:"-"`
+}
+
+// StreamEventsAfter returns up to limit message events with offsets after the given
+// one, oldest first, with their content decrypted. Events committed since the last
+// call are given offsets first.
+func (s *ComplianceService) StreamEventsAfter(after int64, limit int) ([]ComplianceEvent, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, complianceStreamLock); err != nil {
+		return nil, fmt.Errorf("failed to lock compliance stream: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE compliance_events ce SET stream_offset = numbered.stream_offset
+		FROM (
+			SELECT id, nextval('compliance_event_offsets') AS stream_offset
+			FROM (SELECT id FROM compliance_events WHERE stream_offset IS NULL ORDER BY id) unsequenced
+		) numbered
+		WHERE ce.id = numbered.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sequence compliance events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	events := []ComplianceEvent{}
+	err = s.db.Select(&events, `
+		SELECT stream_offset, event, message_id, conversation_id, sender_id, message_type, content, occurred_at
+		FROM compliance_events
+		WHERE stream_offset > $1
+		ORDER BY stream_offset
+		LIMIT $2
+	`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compliance events: %w", err)
+	}
+	for i := range events {
+		content, err := s.encryptor.DecryptString(events[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt compliance event %d: %w", events[i].Offset, err)
+		}
+		events[i].Content = content
+	}
+	return events, nil
+}
+
+// StreamBounds returns the oldest and newest offsets still retained, both zero when
+// the stream is empty
+func (s *ComplianceService) StreamBounds() (oldest, newest int64, err error) {
+	err = s.db.QueryRow(`
+		SELECT COALESCE(MIN(stream_offset), 0), COALESCE(MAX(stream_offset), 0)
+		FROM compliance_events
+		WHERE stream_offset IS NOT NULL
+	`).Scan(&oldest, &newest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get compliance stream bounds: %w", err)
+	}
+	return oldest, newest, nil
+}
+
+// Checkpoint returns the offset a recorder last stored, or zero when it never has
+func (s *ComplianceService) Checkpoint(recorder string) (int64, error) {
+	var offset int64
+	err := s.db.Get(&offset, `SELECT stream_offset FROM compliance_checkpoints WHERE recorder = $1`, recorder)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get compliance checkpoint: %w", err)
+	}
+	return offset, nil
+}
+
+// SaveCheckpoint records that a recorder stored every event up to offset. It may move
+// back, for a recorder that has to store events again.
+func (s *ComplianceService) SaveCheckpoint(recorder string, offset int64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO compliance_checkpoints (recorder, stream_offset) VALUES ($1, $2)
+		ON CONFLICT (recorder) DO UPDATE
+		SET stream_offset = EXCLUDED.stream_offset, updated_at = CURRENT_TIMESTAMP
+	`, recorder, offset)
+	if err != nil {
+		return fmt.Errorf("failed to save compliance checkpoint: %w", err)
+	}
+	return nil
+}
+
+// PurgeStreamEvents forgets the streamed events that occurred before the given time
+func (s *ComplianceService) PurgeStreamEvents(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`
+		DELETE FROM compliance_events WHERE occurred_at < $1 AND stream_offset IS NOT NULL
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge compliance events: %w", err)
+	}
+	return result.RowsAffected()
+}
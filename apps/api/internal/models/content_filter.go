@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ContentFilterTerm is a term an admin added to the profanity wordlist of a locale
+type ContentFilterTerm struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	Locale    string     `db:"locale" json:"locale" example:"en"`
+	Term      string     `db:"term" json:"term"`
+	CreatedBy *uuid.UUID `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// ConversationContentFilter is how a conversation overrides the server's profanity
+// filter; nil fields follow the server
+type ConversationContentFilter struct {
+	Mode   *string `db:"content_filter_mode"`
+	Locale *string `db:"content_filter_locale"`
+}
+
+type ContentFilterService struct {
+	db *sqlx.DB
+}
+
+func NewContentFilterService(db *sqlx.DB) *ContentFilterService {
+	return &ContentFilterService{db: db}
+}
+
+// List returns the custom terms of a locale, or of every locale when it is empty
+func (s *ContentFilterService) List(locale string) ([]ContentFilterTerm, error) {
+	terms := []ContentFilterTerm{}
+	err := s.db.Select(&terms, `
+		SELECT * FROM content_filter_terms
+		WHERE $1 = '' OR locale = $1
+		ORDER BY locale, term
+	`, locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list content filter terms: %w", err)
+	}
+	return terms, nil
+}
+
+// Terms returns the custom terms a locale is filtered with: its own and its language's
+func (s *ContentFilterService) Terms(locale string) ([]string, error) {
+	language, _, _ := strings.Cut(locale, "-")
+	terms := []string{}
+	err := s.db.Select(&terms, `
+		SELECT DISTINCT term FROM content_filter_terms WHERE locale IN ($1, $2)
+	`, locale, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content filter terms: %w", err)
+	}
+	return terms, nil
+}
+
+// Add adds a term to the wordlist of a locale. Terms already listed return ErrConflict.
+func (s *ContentFilterService) Add(term *ContentFilterTerm) error {
+	err := s.db.Get(term, `
+		INSERT INTO content_filter_terms (locale, term, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING *
+	`, term.Locale, term.Term, term.CreatedBy)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add content filter term: %w", err)
+	}
+	return nil
+}
+
+// Remove removes a custom term and returns it
+func (s *ContentFilterService) Remove(id uuid.UUID) (*ContentFilterTerm, error) {
+	term := &ContentFilterTerm{}
+	err := s.db.Get(term, `DELETE FROM content_filter_terms WHERE id = $1 RETURNING *`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove content filter term: %w", err)
+	}
+	return term, nil
+}
+
+// ConversationOverride returns how a conversation overrides the server's filter
+func (s *ContentFilterService) ConversationOverride(conversationID uuid.UUID) (*ConversationContentFilter, error) {
+	override := &ConversationContentFilter{}
+	err := s.db.Get(override, `
+		SELECT content_filter_mode, content_filter_locale FROM conversations WHERE id = $1
+	`, conversationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation content filter: %w", err)
+	}
+	return override, nil
+}
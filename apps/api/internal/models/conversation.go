@@ -11,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 var (
@@ -18,24 +19,131 @@ var (
 	ErrUserNotFound         = errors.New("user not found")
 	ErrInvalidParticipant   = errors.New("invalid participant")
 	ErrDuplicateParticipant = errors.New("users already have a conversation")
+	ErrNotOwner             = errors.New("only the conversation owner can do this")
+	ErrGracePeriodExpired   = errors.New("conversation can no longer be restored")
+	ErrDirectConversation   = errors.New("not supported for direct conversations")
+	ErrGroupFull            = errors.New("group has reached its participant limit")
 )
 
+// History visibility settings
+const (
+	// HistoryShared lets participants read the whole conversation
+	HistoryShared = "shared"
+	// HistoryJoined only shows participants the messages sent since they joined
+	HistoryJoined = "joined"
+)
+
+// visibleHistory is a condition limiting messages m to those the participant in the
+// given parameter may read. It is false when they are not a participant at all.
+func visibleHistory(userParam string) string {
+	return `m.created_at >= (
+		SELECT CASE WHEN vc.history_visibility = 'joined' THEN vp.joined_at ELSE '-infinity' END
+		FROM conversations vc
+		JOIN conversation_participants vp ON vp.conversation_id = vc.id AND vp.user_id = ` + userParam + `
+		WHERE vc.id = m.conversation_id
+	)`
+}
+
 type Conversation struct {
 	Base
-	CreatedBy    uuid.UUID                 `db:"created_by" json:"created_by"`
-	Type         string                    `db:"type" json:"type"`
-	Name         *string                   `db:"name" json:"name,omitempty"`
-	Participants []ConversationParticipant `db:"-" json:"participants"`
-	LastMessage  *Message                  `db:"-" json:"last_message,omitempty"`
-	UnreadCount  int                       `db:"-" json:"unread_count"`
+	CreatedBy   uuid.UUID `db:"created_by" json:"created_by"`
+	Type        string    `db:"type" json:"type"`
+	Name        *string   `db:"name" json:"name,omitempty"`
+	AvatarURL   *string   `db:"avatar_url" json:"avatar_url,omitempty"`
+	AccentColor *string   `db:"accent_color" json:"accent_color,omitempty"`
+	Theme       *string   `db:"theme" json:"theme,omitempty"`
+	// NameGenerated is set on groups without a name of their own, whose Name the API
+	// made up from their participants
+	NameGenerated bool `db:"-" json:"name_generated,omitempty"`
+	// HistoryVisibility is HistoryShared or HistoryJoined
+	HistoryVisibility string `db:"history_visibility" json:"history_visibility"`
+	// WelcomeMessage and Rules are only loaded with a single conversation
+	WelcomeMessage *string                   `db:"welcome_message" json:"welcome_message,omitempty"`
+	Rules          *string                   `db:"rules" json:"rules,omitempty"`
+	Participants   []ConversationParticipant `db:"-" json:"participants"`
+	LastMessage    *Message                  `db:"-" json:"last_message,omitempty"`
+	UnreadCount    int                       `db:"unread_count" json:"unread_count"`
+	DeletedAt      *time.Time                `db:"deleted_at" json:"deleted_at,omitempty"`
+	DeletedBy      *uuid.UUID                `db:"deleted_by" json:"deleted_by,omitempty"`
+	// LegalHold keeps retention jobs from removing the conversation
+	LegalHold bool `db:"legal_hold" json:"-"`
+	// LargeGroup groups only keep read watermarks
+	LargeGroup bool `db:"large_group" json:"large_group"`
+	// Permissions restrict who may take actions in a group; only loaded with a single
+	// conversation
+	Permissions ConversationPermissions `db:"permissions" json:"permissions,omitempty"`
+	// LockedUntil is set while admins have locked the group, leaving only them able to
+	// post. LockedBy and LockReason are only loaded with a single conversation.
+	LockedUntil *time.Time `db:"locked_until" json:"locked_until,omitempty"`
+	LockedBy    *uuid.UUID `db:"locked_by" json:"locked_by,omitempty"`
+	LockReason  *string    `db:"lock_reason" json:"lock_reason,omitempty"`
+	// ContentFilterMode and ContentFilterLocale override the server's profanity filter;
+	// only loaded with a single conversation
+	ContentFilterMode   *string `db:"content_filter_mode" json:"content_filter_mode,omitempty"`
+	ContentFilterLocale *string `db:"content_filter_locale" json:"content_filter_locale,omitempty"`
+	// IntegrityChainSince is when the conversation started keeping an integrity chain
+	IntegrityChainSince *time.Time `db:"integrity_chain_since" json:"integrity_chain_since,omitempty"`
+	// ParticipantCount, LastActivityAt and LastMessageID come from the conversation
+	// summary. Participants only holds the first ParticipantPageSize participants.
+	ParticipantCount int        `db:"participant_count" json:"participant_count,omitempty"`
+	LastActivityAt   *time.Time `db:"last_activity_at" json:"last_activity_at,omitempty"`
+	LastMessageID    *uuid.UUID `db:"last_message_id" json:"last_message_id,omitempty"`
+	// NameSample is the sample of participants groups without a name are named after,
+	// from the conversation summary
+	NameSample GroupNameSample `db:"name_sample" json:"-"`
+	// LastMessagePreview is the start of the last message, only loaded with a list of
+	// conversations
+	LastMessagePreview *string `db:"last_message_preview" json:"last_message_preview,omitempty"`
+	// Muted is set while the user muted the conversation, until MutedUntil when it is
+	// set. Muted, ArchivedAt and NotificationPreview are the user's, and only loaded with
+	// a list of conversations.
+	Muted      bool       `db:"muted" json:"muted"`
+	MutedUntil *time.Time `db:"muted_until" json:"muted_until,omitempty"`
+	ArchivedAt *time.Time `db:"archived_at" json:"archived_at,omitempty"`
+	// PinPosition is where the user pinned the conversation, from 1, when they did
+	PinPosition *int `db:"pin_position" json:"pin_position,omitempty"`
+	// NotificationPreview overrides the user's default preview for the conversation
+	NotificationPreview *string `db:"notification_preview" json:"notification_preview,omitempty"`
+	// Display labels the last activity in the user's timezone, when asked for
+	Display *DisplayHints `db:"-" json:"display,omitempty"`
 }
 
+// conversationListColumns are the columns of a listed conversation, from conversations c
+// joined with conversation_summaries s and the user's conversation_participants cp
+const conversationListColumns = `
+			c.id,
+			c.created_at,
+			c.updated_at,
+			c.created_by,
+			c.type,
+			c.name,
+			c.avatar_url,
+			c.accent_color,
+			c.theme,
+			c.history_visibility,
+			c.large_group,
+			CASE WHEN c.locked_until > NOW() THEN c.locked_until END AS locked_until,
+			COALESCE(s.participant_count, 0) AS participant_count,
+			s.last_activity_at,
+			s.last_message_id,
+			COALESCE(s.name_sample, '[]') AS name_sample,
+			CASE WHEN c.history_visibility = 'joined'
+				AND (SELECT created_at FROM messages WHERE id = s.last_message_id) < cp.joined_at
+				THEN NULL ELSE s.last_message_preview END AS last_message_preview,
+			cp.unread_count,
+			` + participantMuted + ` AS muted,
+			CASE WHEN ` + participantMuted + ` THEN cp.muted_until END AS muted_until,
+			cp.archived_at,
+			cp.pin_position,
+			cp.notification_preview`
+
 type ConversationParticipant struct {
 	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
 	UserID         uuid.UUID `db:"user_id" json:"user_id"`
 	JoinedAt       time.Time `db:"joined_at" json:"joined_at"`
 	LastReadAt     time.Time `db:"last_read_at" json:"last_read_at"`
 	Role           string    `db:"role" json:"role"`
+	Nickname       *string   `db:"nickname" json:"nickname,omitempty"`
 	User           *User     `db:"-" json:"user,omitempty"`
 	// Embedded user fields from the query
 	UserUsername  string     `db:"user_username" json:"-"`
@@ -52,14 +160,19 @@ type ConversationParticipant struct {
 type CreateConversationInput struct {
 	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1"`
 	Name    *string     `json:"name,omitempty"`
+	// Group makes a group even with a single other user, as templates do
+	Group bool `json:"-"`
+	// Roles gives users other than the creator a role other than member
+	Roles map[uuid.UUID]string `json:"-"`
 }
 
 type ConversationService struct {
 	db        *sqlx.DB
-	encryptor *encryption.Manager
+	encryptor encryption.Encryptor
+	limits    ConversationLimits
 }
 
-func NewConversationService(db *sqlx.DB, encryptor *encryption.Manager) *ConversationService {
+func NewConversationService(db *sqlx.DB, encryptor encryption.Encryptor) *ConversationService {
 	return &ConversationService{
 		db:        db,
 		encryptor: encryptor,
@@ -83,16 +196,19 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 	if count != len(userIDsWithCreator) {
 		return nil, ErrUserNotFound
 	}
+	if s.limits.MaxParticipants > 0 && len(userIDsWithCreator) > s.limits.MaxParticipants {
+		return nil, ErrGroupFull
+	}
 
 	// For direct conversations, check if conversation already exists
-	if len(input.UserIDs) == 1 {
+	if len(input.UserIDs) == 1 && !input.Group {
 		var existingCount int
 		err = s.db.Get(&existingCount, `
 			SELECT COUNT(*)
 			FROM conversations c
 			JOIN conversation_participants cp1 ON cp1.conversation_id = c.id AND cp1.user_id = $1
 			JOIN conversation_participants cp2 ON cp2.conversation_id = c.id AND cp2.user_id = $2
-			WHERE c.type = 'direct'
+			WHERE c.type IN ('direct', 'support') AND c.deleted_at IS NULL
 		`, creatorID, input.UserIDs[0])
 		if err != nil {
 			return nil, fmt.Errorf("failed to check existing conversation: %w", err)
@@ -108,36 +224,26 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 	}
 	defer tx.Rollback()
 
+	if err := s.checkCreationLimits(tx, creatorID); err != nil {
+		return nil, err
+	}
+
 	// Determine conversation type and name
 	conversationType := "group"
 	var conversationName *string
-	if len(input.UserIDs) == 1 {
+	if len(input.UserIDs) == 1 && !input.Group {
 		conversationType = "direct"
+		// Direct messages to the support account are queued for agents
+		if input.UserIDs[0] == SupportBotID {
+			conversationType = "support"
+		}
 		// For direct conversations, name is not used (UI shows other participant's name)
 		conversationName = nil
 	} else {
-		// For group conversations, use provided name or generate one
+		// Groups without a name are named after their participants when read, in the
+		// reader's language
 		if input.Name != nil && *input.Name != "" {
 			conversationName = input.Name
-		} else {
-			// Get usernames for default group name
-			var usernames []string
-			query, args, err = sqlx.In("SELECT username FROM users WHERE id IN (?) LIMIT 3", userIDsWithCreator)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create username query: %w", err)
-			}
-			query = s.db.Rebind(query)
-			err = s.db.Select(&usernames, query, args...)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get usernames: %w", err)
-			}
-			defaultName := ""
-			if len(usernames) > 2 {
-				defaultName = fmt.Sprintf("%s, %s & %d others", usernames[0], usernames[1], len(userIDsWithCreator)-2)
-			} else {
-				defaultName = fmt.Sprintf("%s, %s", usernames[0], usernames[1])
-			}
-			conversationName = &defaultName
 		}
 	}
 
@@ -149,12 +255,15 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 		"participant_count": len(userIDsWithCreator),
 	})
 
+	largeGroup := conversationType == "group" && s.limits.LargeGroupThreshold > 0 &&
+		len(userIDsWithCreator) > s.limits.LargeGroupThreshold
+
 	conv := &Conversation{}
 	err = tx.QueryRowx(`
-		INSERT INTO conversations (created_by, type, name)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at, created_by, type, name
-	`, creatorID, conversationType, conversationName).StructScan(conv)
+		INSERT INTO conversations (created_by, type, name, large_group)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, created_by, type, name, large_group
+	`, creatorID, conversationType, conversationName, largeGroup).StructScan(conv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create conversation: %w", err)
 	}
@@ -166,6 +275,8 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 			if conversationType == "group" {
 				role = "owner"
 			}
+		} else if assigned, ok := input.Roles[userID]; ok && conversationType == "group" {
+			role = assigned
 		}
 
 		// Log participant role assignment
@@ -193,6 +304,9 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 		if rows != 1 {
 			return nil, fmt.Errorf("failed to add participant, expected 1 row affected, got %d", rows)
 		}
+		if err := logMembership(tx, conv.ID, MembershipJoined, creatorID, userID, "", role); err != nil {
+			return nil, err
+		}
 
 		// Verify the role was set correctly
 		var assignedRole string
@@ -211,30 +325,8 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
-
-	// Get participants with full details
-	var participants []ConversationParticipant
-	err = s.db.Select(&participants, `
-		SELECT 
-			cp.conversation_id,
-			cp.user_id,
-			cp.joined_at,
-			cp.last_read_at,
-			cp.role,
-			u.id as user_id,
-			u.username as user_username,
-			u.email as user_email,
-			u.phone as user_phone,
-			u.status as user_status,
-			u.last_seen as user_last_seen,
-			u.is_online as user_is_online,
-			u.is_active as user_is_active,
-			u.created_at as user_created_at,
-			u.updated_at as user_updated_at
-		FROM conversation_participants cp
-		JOIN users u ON u.id = cp.user_id AND u.is_active = true
-		WHERE cp.conversation_id = $1
-	`, conv.ID)
+	// Get the first page of participants with full details
+	participants, err := s.firstParticipants(conv.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get participants: %w", err)
 	}
@@ -248,33 +340,47 @@ func (s *ConversationService) Create(creatorID uuid.UUID, input *CreateConversat
 			"is_creator":      p.UserID == creatorID,
 		})
 	}
-
-	// Create User objects from the query results
-	for i := range participants {
-		participants[i].User = &User{
-			ID:        participants[i].UserID,
-			CreatedAt: participants[i].UserCreatedAt,
-			UpdatedAt: participants[i].UserUpdatedAt,
-			Username:  participants[i].UserUsername,
-			Email:     participants[i].UserEmail,
-			Phone:     participants[i].UserPhone,
-			Status:    participants[i].UserStatus,
-			LastSeen:  participants[i].UserLastSeen,
-			IsOnline:  participants[i].UserIsOnline,
-			IsActive:  participants[i].UserIsActive,
+	conv.ParticipantCount = len(userIDsWithCreator)
+	conv.Participants = participants
+	if conv.Unnamed() {
+		source, err := s.GetGroupNameSource(conv.ID)
+		if err != nil {
+			return nil, err
 		}
+		conv.NameSample = source.Sample
 	}
-	conv.Participants = participants
 
 	return conv, nil
 }
 
+// FindDirect returns the ID of the direct conversation between two users
+func (s *ConversationService) FindDirect(userID, otherID uuid.UUID) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.Get(&id, `
+		SELECT c.id
+		FROM conversations c
+		JOIN conversation_participants cp1 ON cp1.conversation_id = c.id AND cp1.user_id = $1
+		JOIN conversation_participants cp2 ON cp2.conversation_id = c.id AND cp2.user_id = $2
+		WHERE c.type = 'direct' AND c.deleted_at IS NULL
+		LIMIT 1
+	`, userID, otherID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to find direct conversation: %w", err)
+	}
+	return id, nil
+}
+
 func (s *ConversationService) GetByID(id uuid.UUID) (*Conversation, error) {
 	conv := &Conversation{}
 	err := s.db.Get(conv, `
-		SELECT c.*
+		SELECT c.*, COALESCE(s.participant_count, 0) AS participant_count, s.last_activity_at, s.last_message_id,
+			COALESCE(s.name_sample, '[]') AS name_sample
 		FROM conversations c
-		WHERE c.id = $1
+		LEFT JOIN conversation_summaries s ON s.conversation_id = c.id
+		WHERE c.id = $1 AND c.deleted_at IS NULL
 		LIMIT 1
 	`, id)
 	if err == sql.ErrNoRows {
@@ -283,30 +389,8 @@ func (s *ConversationService) GetByID(id uuid.UUID) (*Conversation, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation: %w", err)
 	}
-
-	// Get participants with roles
-	var participants []ConversationParticipant
-	err = s.db.Select(&participants, `
-		SELECT 
-			cp.conversation_id,
-			cp.user_id,
-			cp.joined_at,
-			cp.last_read_at,
-			cp.role,
-			u.id as user_id,
-			u.username as user_username,
-			u.email as user_email,
-			u.phone as user_phone,
-			u.status as user_status,
-			u.last_seen as user_last_seen,
-			u.is_online as user_is_online,
-			u.is_active as user_is_active,
-			u.created_at as user_created_at,
-			u.updated_at as user_updated_at
-		FROM conversation_participants cp
-		JOIN users u ON u.id = cp.user_id AND u.is_active = true
-		WHERE cp.conversation_id = $1
-	`, id)
+	// Get the first page of participants with roles
+	participants, err := s.firstParticipants(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get participants: %w", err)
 	}
@@ -315,28 +399,67 @@ func (s *ConversationService) GetByID(id uuid.UUID) (*Conversation, error) {
 	if len(participants) == 0 {
 		return nil, ErrInvalidParticipant
 	}
-
-	// Create User objects from the query results
-	for i := range participants {
-		participants[i].User = &User{
-			ID:        participants[i].UserID,
-			CreatedAt: participants[i].UserCreatedAt,
-			UpdatedAt: participants[i].UserUpdatedAt,
-			Username:  participants[i].UserUsername,
-			Email:     participants[i].UserEmail,
-			Phone:     participants[i].UserPhone,
-			Status:    participants[i].UserStatus,
-			LastSeen:  participants[i].UserLastSeen,
-			IsOnline:  participants[i].UserIsOnline,
-			IsActive:  participants[i].UserIsActive,
-		}
-	}
 	conv.Participants = participants
 
 	return conv, nil
 }
 
-func (s *ConversationService) GetUserConversations(userID uuid.UUID) ([]Conversation, error) {
+// ConversationDetails picks what is loaded along with each conversation of a list
+type ConversationDetails struct {
+	Participants bool
+	LastMessage  bool
+}
+
+// AllConversationDetails loads everything
+var AllConversationDetails = ConversationDetails{Participants: true, LastMessage: true}
+
+// Orders a user's conversations can be listed in
+const (
+	// ConversationSortUpdated lists the most recently changed first, whatever changed
+	ConversationSortUpdated = "updated_at"
+	// ConversationSortLastMessage lists those with the latest message first
+	ConversationSortLastMessage = "last_message_at"
+	// ConversationSortUnreadFirst lists those with unread messages first, then by
+	// latest message
+	ConversationSortUnreadFirst = "unread_first"
+	// ConversationSortAlphabetical lists by name, naming groups without one and direct
+	// conversations after their first other participant
+	ConversationSortAlphabetical = "alphabetical"
+	// ConversationSortManual lists the user's pins in their order first, then by latest
+	// message
+	ConversationSortManual = "manual"
+)
+
+// ConversationSorts are the orders conversations can be listed in
+var ConversationSorts = []string{
+	ConversationSortUpdated,
+	ConversationSortLastMessage,
+	ConversationSortUnreadFirst,
+	ConversationSortAlphabetical,
+	ConversationSortManual,
+}
+
+// conversationOrders are the ORDER BY clauses of the sorts, over the columns of
+// conversationListColumns with the user's ID as $1
+var conversationOrders = map[string]string{
+	ConversationSortUpdated:     `c.updated_at DESC, c.id`,
+	ConversationSortLastMessage: `s.last_activity_at DESC NULLS LAST, c.id`,
+	ConversationSortUnreadFirst: `cp.unread_count > 0 DESC, s.last_activity_at DESC NULLS LAST, c.id`,
+	ConversationSortAlphabetical: `LOWER(COALESCE(NULLIF(c.name, ''), (
+			SELECT sample->>'name' FROM jsonb_array_elements(s.name_sample) sample
+			WHERE sample->>'id' <> $1::text LIMIT 1
+		), '')), c.id`,
+	ConversationSortManual: `cp.pin_position NULLS LAST, s.last_activity_at DESC NULLS LAST, c.id`,
+}
+
+// GetUserConversations returns a page of the user's conversations in the order of
+// sort, one of ConversationSorts, and how many they have in all
+func (s *ConversationService) GetUserConversations(userID uuid.UUID, details ConversationDetails, sort string, limit, offset int) ([]Conversation, int, error) {
+	order, ok := conversationOrders[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: unknown sort %q", ErrInvalidInput, sort)
+	}
+
 	// Verify user exists
 	var exists bool
 	err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID)
@@ -344,44 +467,50 @@ func (s *ConversationService) GetUserConversations(userID uuid.UUID) ([]Conversa
 		logger.Error("Failed to check user existence", err, map[string]interface{}{
 			"user_id": userID,
 		})
-		return nil, fmt.Errorf("failed to check user existence: %w", err)
+		return nil, 0, fmt.Errorf("failed to check user existence: %w", err)
 	}
 	if !exists {
-		return nil, ErrUserNotFound
+		return nil, 0, ErrUserNotFound
 	}
 
 	logger.Debug("Getting conversations", map[string]interface{}{
 		"user_id": userID,
 	})
 
+	var total int
+	err = s.db.Get(&total, `
+		SELECT COUNT(*) FROM conversations c
+		INNER JOIN conversation_participants cp ON cp.conversation_id = c.id
+		WHERE cp.user_id = $1 AND c.deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+
 	conversations := []Conversation{}
 	err = s.db.Select(&conversations, `
-		SELECT DISTINCT
-			c.id,
-			c.created_at,
-			c.updated_at,
-			c.created_by,
-			c.type,
-			c.name
+		SELECT`+conversationListColumns+`
 		FROM conversations c
 		INNER JOIN conversation_participants cp ON cp.conversation_id = c.id
-		WHERE cp.user_id = $1
-		ORDER BY c.updated_at DESC
-	`, userID)
+		LEFT JOIN conversation_summaries s ON s.conversation_id = c.id
+		WHERE cp.user_id = $1 AND c.deleted_at IS NULL
+		ORDER BY `+order+`
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
 
 	// If there are no conversations or no rows, return empty array
 	if err == sql.ErrNoRows || len(conversations) == 0 {
 		logger.Debug("No conversations found", map[string]interface{}{
 			"user_id": userID,
 		})
-		return []Conversation{}, nil
+		return []Conversation{}, total, nil
 	}
 
 	if err != nil {
 		logger.Error("Failed to get conversations", err, map[string]interface{}{
 			"user_id": userID,
 		})
-		return nil, fmt.Errorf("failed to get conversations: %w", err)
+		return nil, 0, fmt.Errorf("failed to get conversations: %w", err)
 	}
 
 	logger.Debug("Found conversations", map[string]interface{}{
@@ -389,148 +518,168 @@ func (s *ConversationService) GetUserConversations(userID uuid.UUID) ([]Conversa
 		"conversation_count": len(conversations),
 	})
 
-	// Get participants and last message for each conversation
-	for i := range conversations {
-		// Get participants with user data
-		var participants []ConversationParticipant
-		err = s.db.Select(&participants, `
-			SELECT 
-				cp.conversation_id,
-				cp.user_id,
-				cp.joined_at,
-				cp.last_read_at,
-				COALESCE(cp.role, 'member') as role,
-				u.id as user_id,
-				u.username as user_username,
-				u.email as user_email,
-				u.phone as user_phone,
-				u.status as user_status,
-				u.last_seen as user_last_seen,
-				u.is_online as user_is_online,
-				u.is_active as user_is_active,
-				u.created_at as user_created_at,
-				u.updated_at as user_updated_at
-			FROM conversation_participants cp
-			JOIN users u ON u.id = cp.user_id AND u.is_active = true
-			WHERE cp.conversation_id = $1
-		`, conversations[i].ID)
-		if err != nil {
-			logger.Error("Failed to get participants", err, map[string]interface{}{
-				"user_id":         userID,
-				"conversation_id": conversations[i].ID,
-			})
-			return nil, fmt.Errorf("failed to get participants for conversation %s: %w", conversations[i].ID, err)
+	if err := s.loadConversationDetails(userID, conversations, details); err != nil {
+		return nil, 0, err
+	}
+	return conversations, total, nil
+}
+
+// loadConversationDetails fills in the participants and last message of each conversation,
+// as picked by details, and opens the last message previews
+func (s *ConversationService) loadConversationDetails(userID uuid.UUID, conversations []Conversation, details ConversationDetails) error {
+	s.openPreviews(conversations)
+	if details.LastMessage {
+		if err := s.loadLastMessages(userID, conversations); err != nil {
+			return err
 		}
+	}
 
-		// Create User objects from the query results
-		for j := range participants {
-			participants[j].User = &User{
-				ID:        participants[j].UserID,
-				CreatedAt: participants[j].UserCreatedAt,
-				UpdatedAt: participants[j].UserUpdatedAt,
-				Username:  participants[j].UserUsername,
-				Email:     participants[j].UserEmail,
-				Phone:     participants[j].UserPhone,
-				Status:    participants[j].UserStatus,
-				LastSeen:  participants[j].UserLastSeen,
-				IsOnline:  participants[j].UserIsOnline,
-				IsActive:  participants[j].UserIsActive,
+	if details.Participants {
+		for i := range conversations {
+			if err := s.loadParticipants(userID, &conversations[i]); err != nil {
+				return err
 			}
 		}
-		conversations[i].Participants = participants
-
-		// Get last message
-		var lastMessage Message
-		err = s.db.Get(&lastMessage, `
-			SELECT 
-				m.*,
-				u.username as sender_username,
-				ARRAY_REMOVE(ARRAY_AGG(DISTINCT ms.user_id), NULL)::TEXT[] as read_by,
-				COALESCE(
-					json_agg(DISTINCT jsonb_build_object(
-						'id', mr.id,
-						'message_id', mr.message_id,
-						'user_id', mr.user_id,
-						'emoji', mr.emoji,
-						'created_at', mr.created_at
-					)) FILTER (WHERE mr.id IS NOT NULL),
-					'[]'
-				)::jsonb as reactions
-			FROM messages m
-			JOIN users u ON u.id = m.sender_id AND u.is_active = true
-			LEFT JOIN message_status ms ON m.id = ms.message_id AND ms.status = 'read'
-			LEFT JOIN message_reactions mr ON m.id = mr.message_id
-			WHERE m.conversation_id = $1
-			GROUP BY m.id, u.username
-			ORDER BY m.created_at DESC
-			LIMIT 1
-		`, conversations[i].ID)
-		if err != nil && err != sql.ErrNoRows {
-			logger.Error("Failed to get last message", err, map[string]interface{}{
-				"user_id":         userID,
-				"conversation_id": conversations[i].ID,
-			})
-			return nil, fmt.Errorf("failed to get last message for conversation %s: %w", conversations[i].ID, err)
-		}
-		if err != sql.ErrNoRows {
-			// Decrypt message content if encryption is enabled
-			if s.encryptor != nil {
-				content, err := s.encryptor.DecryptString(lastMessage.Content)
-				if err != nil {
-					logger.Error("Failed to decrypt message", err, map[string]interface{}{
-						"user_id":         userID,
-						"conversation_id": conversations[i].ID,
-						"message_id":      lastMessage.ID,
-					})
-					return nil, fmt.Errorf("failed to decrypt message: %w", err)
-				}
-				lastMessage.Content = content
-			}
-			conversations[i].LastMessage = &lastMessage
+	}
+
+	return nil
+}
+
+// loadParticipants fills in the first page of participants of a listed conversation,
+// with their users
+func (s *ConversationService) loadParticipants(userID uuid.UUID, conversation *Conversation) error {
+	participants, err := s.firstParticipants(conversation.ID)
+	if err != nil {
+		logger.Error("Failed to get participants", err, map[string]interface{}{
+			"user_id":         userID,
+			"conversation_id": conversation.ID,
+		})
+		return fmt.Errorf("failed to get participants for conversation %s: %w", conversation.ID, err)
+	}
+	conversation.Participants = participants
+	return nil
+}
+
+// loadLastMessages fills in the latest message of each listed conversation from its
+// summary, with a single query. Messages the user can't see, such as ones from before
+// they joined a group that hides earlier history, are left out.
+func (s *ConversationService) loadLastMessages(userID uuid.UUID, conversations []Conversation) error {
+	ids := []uuid.UUID{}
+	for i := range conversations {
+		if conversations[i].LastMessageID != nil {
+			ids = append(ids, *conversations[i].LastMessageID)
 		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
 
-		// Get unread count
-		var unreadCount int
-		err = s.db.Get(&unreadCount, `
-			SELECT COUNT(*)
-			FROM messages m
-			LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = $1
-			WHERE m.conversation_id = $2
-			  AND m.sender_id != $1
-			  AND (ms.status IS NULL OR ms.status = 'delivered')
-		`, userID, conversations[i].ID)
-		if err != nil {
-			logger.Error("Failed to get unread count", err, map[string]interface{}{
-				"user_id":         userID,
-				"conversation_id": conversations[i].ID,
-			})
-			return nil, fmt.Errorf("failed to get unread count for conversation %s: %w", conversations[i].ID, err)
+	messages, err := NewMessageService(s.db, s.encryptor).GetByIDsForUser(ids, userID)
+	if err != nil {
+		logger.Error("Failed to get last messages", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return fmt.Errorf("failed to get last messages: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	for i := range conversations {
+		if id := conversations[i].LastMessageID; id != nil {
+			conversations[i].LastMessage = byID[*id]
 		}
-		conversations[i].UnreadCount = unreadCount
 	}
+	return nil
+}
 
-	return conversations, nil
+// ConversationRead is what marking a conversation read changed
+type ConversationRead struct {
+	Cursor *ConversationCursor
+	// Receipts has the messages newly read, by sender
+	Receipts []ReadReceipt
+	// Unread is the reader's unread summary once the conversation is read
+	Unread *UnreadSummary
 }
 
-func (s *ConversationService) UpdateLastRead(conversationID, userID uuid.UUID) error {
-	result, err := s.db.Exec(`
-		UPDATE conversation_participants
-		SET last_read_at = CURRENT_TIMESTAMP
+// ReadReceipt is how many messages of a sender were newly read, up to the latest
+type ReadReceipt struct {
+	SenderID  uuid.UUID `db:"sender_id"`
+	MessageID uuid.UUID `db:"message_id"`
+	Count     int       `db:"count"`
+}
+
+// UpdateLastRead marks the whole conversation read in a single transaction: the user's
+// cursors move to the latest message, which advances their watermark and drops the
+// statuses it now implies, and their unread counter is cleared. It returns the new
+// cursors, the messages newly read for their senders to be told, and the user's unread
+// summary.
+func (s *ConversationService) UpdateLastRead(conversationID, userID uuid.UUID) (*ConversationRead, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	err = tx.Get(&locked, `
+		SELECT true FROM conversation_participants
 		WHERE conversation_id = $1 AND user_id = $2
+		FOR UPDATE
 	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidParticipant
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update last read: %w", err)
+		return nil, fmt.Errorf("failed to lock participant: %w", err)
 	}
 
-	rows, err := result.RowsAffected()
+	// Read before the watermark moves and drops the statuses telling what was unread
+	read := &ConversationRead{Receipts: []ReadReceipt{}}
+	err = tx.Select(&read.Receipts, `
+		SELECT DISTINCT ON (m.sender_id) m.sender_id, m.id AS message_id,
+			COUNT(*) OVER (PARTITION BY m.sender_id) AS count
+		FROM messages m
+		JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = $2
+		LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = $2
+		WHERE m.conversation_id = $1 AND m.sender_id != $2 AND NOT m.is_deleted
+		  AND m.created_at >= cp.joined_at
+		  AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at)
+		  AND (ms.status IS NULL OR ms.status != 'read')
+		ORDER BY m.sender_id, m.created_at DESC, m.id DESC
+	`, conversationID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to get messages read: %w", err)
 	}
-	if rows == 0 {
-		return ErrInvalidParticipant
+
+	read.Cursor = &ConversationCursor{}
+	err = tx.Get(read.Cursor, `
+		WITH latest AS (
+			SELECT id FROM messages
+			WHERE conversation_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		)
+		UPDATE conversation_participants
+		SET last_read_at = CURRENT_TIMESTAMP,
+			last_read_message_id = COALESCE((SELECT id FROM latest), last_read_message_id),
+			last_delivered_message_id = COALESCE((SELECT id FROM latest), last_delivered_message_id),
+			unread_count = 0
+		WHERE conversation_id = $1 AND user_id = $2
+		RETURNING user_id, last_read_message_id, last_delivered_message_id, last_read_at, unread_count
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update last read: %w", err)
 	}
 
-	return nil
+	if read.Unread, err = unreadSummary(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return read, nil
 }
 
 // IsParticipant checks if a user is a participant in a conversation
@@ -538,8 +687,9 @@ func (s *ConversationService) IsParticipant(conversationID, userID uuid.UUID) (b
 	var isParticipant bool
 	err := s.db.Get(&isParticipant, `
 		SELECT EXISTS(
-			SELECT 1 FROM conversation_participants
-			WHERE conversation_id = $1 AND user_id = $2
+			SELECT 1 FROM conversation_participants cp
+			JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+			WHERE cp.conversation_id = $1 AND cp.user_id = $2
 		)
 	`, conversationID, userID)
 	if err != nil {
@@ -548,12 +698,97 @@ func (s *ConversationService) IsParticipant(conversationID, userID uuid.UUID) (b
 	return isParticipant, nil
 }
 
+// ParticipantIDs returns the users taking part in a conversation
+func (s *ConversationService) ParticipantIDs(conversationID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT user_id FROM conversation_participants
+		WHERE conversation_id = $1
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participants: %w", err)
+	}
+	return ids, nil
+}
+
+// TypingRecipients returns who is told that a participant is typing: the other
+// participants, and no one in large groups
+func (s *ConversationService) TypingRecipients(conversationID, userID uuid.UUID) ([]uuid.UUID, error) {
+	isParticipant, err := s.IsParticipant(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant {
+		return nil, ErrInvalidParticipant
+	}
+
+	ids := []uuid.UUID{}
+	err = s.db.Select(&ids, `
+		SELECT cp.user_id
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND NOT c.large_group
+		WHERE cp.conversation_id = $1 AND cp.user_id != $2
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get typing recipients: %w", err)
+	}
+	return ids, nil
+}
+
+// UserConversationIDs returns the conversations a user takes part in
+func (s *ConversationService) UserConversationIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT cp.conversation_id
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		WHERE cp.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user conversations: %w", err)
+	}
+	return ids, nil
+}
+
+// ContactIDs returns the users who share at least one conversation with the user
+func (s *ConversationService) ContactIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT DISTINCT other.user_id
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		JOIN conversation_participants other ON other.conversation_id = cp.conversation_id
+		WHERE cp.user_id = $1 AND other.user_id != $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contacts: %w", err)
+	}
+	return ids, nil
+}
+
+// GetParticipantRole returns the role of a user in a conversation
+func (s *ConversationService) GetParticipantRole(conversationID, userID uuid.UUID) (string, error) {
+	var role string
+	err := s.db.Get(&role, `
+		SELECT cp.role FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		WHERE cp.conversation_id = $1 AND cp.user_id = $2
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidParticipant
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get participant role: %w", err)
+	}
+	return role, nil
+}
+
 // AddParticipant adds a user to a conversation
 func (s *ConversationService) AddParticipant(conversationID, userID, adderID uuid.UUID) error {
 	// Check if conversation exists and is a group
 	var convType string
 	err := s.db.Get(&convType, `
-		SELECT type FROM conversations WHERE id = $1
+		SELECT type FROM conversations WHERE id = $1 AND deleted_at IS NULL
 	`, conversationID)
 	if err == sql.ErrNoRows {
 		return ErrConversationNotFound
@@ -605,15 +840,46 @@ func (s *ConversationService) AddParticipant(conversationID, userID, adderID uui
 		return ErrDuplicateParticipant
 	}
 
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the conversation counts concurrent additions one after the other
+	var participantCount int
+	err = tx.Get(&participantCount, `
+		SELECT (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = c.id)
+		FROM conversations c WHERE c.id = $1
+		FOR UPDATE
+	`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to count participants: %w", err)
+	}
+	if s.limits.MaxParticipants > 0 && participantCount >= s.limits.MaxParticipants {
+		return ErrGroupFull
+	}
+
 	// Add participant
-	_, err = s.db.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO conversation_participants (conversation_id, user_id, role)
 		VALUES ($1, $2, 'member')
 	`, conversationID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to add participant: %w", err)
 	}
+	if err := logMembership(tx, conversationID, MembershipJoined, adderID, userID, "", "member"); err != nil {
+		return err
+	}
+	if s.limits.LargeGroupThreshold > 0 && participantCount+1 > s.limits.LargeGroupThreshold {
+		if err := switchToLargeGroup(tx, conversationID); err != nil {
+			return err
+		}
+	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -622,7 +888,7 @@ func (s *ConversationService) RemoveParticipant(conversationID, userID, removerI
 	// Check if conversation exists and is a group
 	var convType string
 	err := s.db.Get(&convType, `
-		SELECT type FROM conversations WHERE id = $1
+		SELECT type FROM conversations WHERE id = $1 AND deleted_at IS NULL
 	`, conversationID)
 	if err == sql.ErrNoRows {
 		return ErrConversationNotFound
@@ -668,8 +934,14 @@ func (s *ConversationService) RemoveParticipant(conversationID, userID, removerI
 		return errors.New("cannot remove conversation owner")
 	}
 
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Remove participant
-	result, err := s.db.Exec(`
+	result, err := tx.Exec(`
 		DELETE FROM conversation_participants
 		WHERE conversation_id = $1 AND user_id = $2
 	`, conversationID, userID)
@@ -685,6 +957,17 @@ func (s *ConversationService) RemoveParticipant(conversationID, userID, removerI
 		return ErrInvalidParticipant
 	}
 
+	event := MembershipRemoved
+	if userID == removerID {
+		event = MembershipLeft
+	}
+	if err := logMembership(tx, conversationID, event, removerID, userID, userRole, ""); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -698,7 +981,7 @@ func (s *ConversationService) UpdateParticipantRole(conversationID, userID, upda
 	// Check if conversation exists and is a group
 	var convType string
 	err := s.db.Get(&convType, `
-		SELECT type FROM conversations WHERE id = $1
+		SELECT type FROM conversations WHERE id = $1 AND deleted_at IS NULL
 	`, conversationID)
 	if err == sql.ErrNoRows {
 		return ErrConversationNotFound
@@ -744,8 +1027,19 @@ func (s *ConversationService) UpdateParticipantRole(conversationID, userID, upda
 		return errors.New("cannot change owner's role")
 	}
 
+	// Nothing changes, so there is nothing to log
+	if userRole == newRole {
+		return nil
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Update role
-	result, err := s.db.Exec(`
+	result, err := tx.Exec(`
 		UPDATE conversation_participants
 		SET role = $3
 		WHERE conversation_id = $1 AND user_id = $2
@@ -761,6 +1055,231 @@ func (s *ConversationService) UpdateParticipantRole(conversationID, userID, upda
 	if rows == 0 {
 		return ErrInvalidParticipant
 	}
+	if err := logMembership(tx, conversationID, MembershipRoleChanged, updaterID, userID, userRole, newRole); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SoftDelete hides a conversation from all participants. Only its owner may delete it;
+// the conversation is purged once the retention grace period has passed.
+func (s *ConversationService) SoftDelete(conversationID, userID uuid.UUID) error {
+	role, err := s.GetParticipantRole(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return ErrNotOwner
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE conversations
+		SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// Restore undeletes a conversation that was deleted less than grace ago
+func (s *ConversationService) Restore(conversationID uuid.UUID, grace time.Duration) error {
+	var deletedAt *time.Time
+	err := s.db.Get(&deletedAt, "SELECT deleted_at FROM conversations WHERE id = $1", conversationID)
+	if err == sql.ErrNoRows || (err == nil && deletedAt == nil) {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE conversations
+		SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at > CURRENT_TIMESTAMP - make_interval(secs => $2)
+	`, conversationID, grace.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to restore conversation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrGracePeriodExpired
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes conversations deleted more than grace ago, with
+// their messages, and returns how many were removed. Held conversations are kept.
+func (s *ConversationService) PurgeDeleted(grace time.Duration) (int64, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ids []uuid.UUID
+	err = tx.Select(&ids, `
+		SELECT c.id FROM conversations c
+		WHERE c.deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND `+notHeld("c")+`
+		FOR UPDATE
+	`, grace.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired conversations: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Messages do not cascade from conversations
+	if _, err := tx.Exec("DELETE FROM messages WHERE conversation_id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to purge messages: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM conversations WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to purge conversations: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(ids)), nil
+}
+
+// notHeld is the condition that neither the conversation aliased as alias nor any of
+// its participants is on legal hold
+func notHeld(alias string) string {
+	return `NOT ` + alias + `.legal_hold AND NOT EXISTS (
+		SELECT 1 FROM conversation_participants hp
+		JOIN users hu ON hu.id = hp.user_id
+		WHERE hp.conversation_id = ` + alias + `.id AND hu.legal_hold
+	)`
+}
+
+// RemovedConversation describes a conversation removed by a cleanup job
+type RemovedConversation struct {
+	ID        uuid.UUID `db:"id"`
+	Type      string    `db:"type"`
+	CreatedBy uuid.UUID `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// PurgeEmpty removes conversations that never had a message and have not changed for
+// longer than age. Deleted conversations are left to PurgeDeleted; held ones, and those
+// with a draft someone is writing, are kept.
+func (s *ConversationService) PurgeEmpty(age time.Duration) ([]RemovedConversation, error) {
+	removed := []RemovedConversation{}
+	err := s.db.Select(&removed, `
+		DELETE FROM conversations c
+		WHERE c.deleted_at IS NULL
+		  AND c.updated_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.conversation_id = c.id)
+		  AND NOT EXISTS (SELECT 1 FROM message_drafts d WHERE d.conversation_id = c.id)
+		  AND `+notHeld("c")+`
+		RETURNING c.id, c.type, c.created_by, c.created_at
+	`, age.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge empty conversations: %w", err)
+	}
+	return removed, nil
+}
+
+// TransferOwnership hands a group over to another participant. The previous owner
+// stays in the conversation as an admin.
+func (s *ConversationService) TransferOwnership(conversationID, ownerID, newOwnerID uuid.UUID) error {
+	if ownerID == newOwnerID {
+		return ErrInvalidInput
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var convType string
+	err = tx.Get(&convType, `
+		SELECT type FROM conversations WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, conversationID)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if convType != "group" {
+		return ErrDirectConversation
+	}
+
+	var ownerRole string
+	err = tx.Get(&ownerRole, `
+		SELECT role FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, ownerID)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check owner role: %w", err)
+	}
+	if ownerRole != "owner" {
+		return ErrNotOwner
+	}
+
+	var newOwnerRole string
+	err = tx.Get(&newOwnerRole, `
+		SELECT COALESCE(role, 'member') FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2
+		FOR UPDATE
+	`, conversationID, newOwnerID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidParticipant
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check new owner role: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE conversation_participants
+		SET role = 'owner'
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, newOwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to promote new owner: %w", err)
+	}
 
+	_, err = tx.Exec(`
+		UPDATE conversation_participants
+		SET role = 'admin'
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to demote previous owner: %w", err)
+	}
+
+	if err := logMembership(tx, conversationID, MembershipRoleChanged, ownerID, newOwnerID, newOwnerRole, "owner"); err != nil {
+		return err
+	}
+	if err := logMembership(tx, conversationID, MembershipRoleChanged, ownerID, ownerID, "owner", "admin"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/auth"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ConversationApp is a third-party application installed in a group, with the scopes
+// its members granted it there
+type ConversationApp struct {
+	ConversationID uuid.UUID      `db:"conversation_id" json:"conversation_id"`
+	ApplicationID  uuid.UUID      `db:"application_id" json:"application_id"`
+	Name           string         `db:"name" json:"name"`
+	ClientID       string         `db:"client_id" json:"client_id"`
+	Scopes         pq.StringArray `db:"scopes" json:"scopes"`
+	InstalledBy    *uuid.UUID     `db:"installed_by" json:"installed_by,omitempty"`
+	InstalledAt    time.Time      `db:"installed_at" json:"installed_at"`
+}
+
+// conversationAppColumns are the columns of a ConversationApp
+const conversationAppColumns = `
+	ca.conversation_id, ca.application_id, a.name, a.client_id,
+	ca.scopes, ca.installed_by, ca.installed_at`
+
+// GetApps returns the applications installed in a conversation that userID takes part
+// in, oldest first. Revoked applications are left out.
+func (s *OAuthService) GetApps(conversationID, userID uuid.UUID) ([]ConversationApp, error) {
+	var participant bool
+	err := s.db.Get(&participant, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+			WHERE cp.conversation_id = $1 AND cp.user_id = $2
+		)
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check participant: %w", err)
+	}
+	if !participant {
+		return nil, ErrConversationNotFound
+	}
+
+	apps := []ConversationApp{}
+	err = s.db.Select(&apps, `
+		SELECT `+conversationAppColumns+`
+		FROM conversation_apps ca
+		JOIN oauth_applications a ON a.id = ca.application_id AND a.revoked_at IS NULL
+		WHERE ca.conversation_id = $1
+		ORDER BY ca.installed_at
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get apps: %w", err)
+	}
+	return apps, nil
+}
+
+// InstallApp installs app in a group with scopes, which must be among those the app
+// was registered with. Installing it again replaces its scopes. Only the group's owner
+// and admins can install apps.
+func (s *OAuthService) InstallApp(conversationID, userID uuid.UUID, app *OAuthApplication, scopes []string) (*ConversationApp, error) {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return nil, err
+	}
+	if len(scopes) == 0 || !auth.IsSubset(scopes, app.Scopes) {
+		return nil, ErrInvalidScope
+	}
+
+	installed := &ConversationApp{}
+	err := s.db.Get(installed, `
+		WITH ca AS (
+			INSERT INTO conversation_apps (conversation_id, application_id, scopes, installed_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (conversation_id, application_id) DO UPDATE
+			SET scopes = EXCLUDED.scopes, installed_by = EXCLUDED.installed_by,
+				installed_at = CURRENT_TIMESTAMP
+			RETURNING *
+		)
+		SELECT `+conversationAppColumns+`
+		FROM ca JOIN oauth_applications a ON a.id = ca.application_id
+	`, conversationID, app.ID, pq.StringArray(scopes), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to install app: %w", err)
+	}
+	return installed, nil
+}
+
+// RemoveApp uninstalls an application from a group. It stops receiving the group's
+// events straight away, since they are only sent to the apps installed when they
+// happen. Only the group's owner and admins can remove apps.
+func (s *OAuthService) RemoveApp(conversationID, userID uuid.UUID, clientID string) (*ConversationApp, error) {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	removed := &ConversationApp{}
+	err := s.db.Get(removed, `
+		WITH ca AS (
+			DELETE FROM conversation_apps
+			WHERE conversation_id = $1
+			  AND application_id = (SELECT id FROM oauth_applications WHERE client_id = $2)
+			RETURNING *
+		)
+		SELECT `+conversationAppColumns+`
+		FROM ca JOIN oauth_applications a ON a.id = ca.application_id
+	`, conversationID, clientID)
+	if err == sql.ErrNoRows {
+		return nil, ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove app: %w", err)
+	}
+	return removed, nil
+}
+
+// EventConversationIDs returns the conversations whose events an active application
+// receives
+func (s *OAuthService) EventConversationIDs(applicationID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT ca.conversation_id
+		FROM conversation_apps ca
+		JOIN oauth_applications a ON a.id = ca.application_id AND a.revoked_at IS NULL
+		JOIN conversations c ON c.id = ca.conversation_id AND c.deleted_at IS NULL
+		WHERE ca.application_id = $1 AND $2 = ANY(ca.scopes)
+	`, applicationID, auth.ScopeReadMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app conversations: %w", err)
+	}
+	return ids, nil
+}
+
+// EventAppIDs returns the active applications installed in a conversation that may
+// receive its events
+func (s *OAuthService) EventAppIDs(conversationID uuid.UUID) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `
+		SELECT ca.application_id
+		FROM conversation_apps ca
+		JOIN oauth_applications a ON a.id = ca.application_id AND a.revoked_at IS NULL
+		WHERE ca.conversation_id = $1 AND $2 = ANY(ca.scopes)
+	`, conversationID, auth.ScopeReadMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installed apps: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ConversationLabel labels a conversation for all its participants. Labels are added
+// by automations or by the owner and admins, and removed by the owner and admins.
+type ConversationLabel struct {
+	Label        string     `db:"label" json:"label"`
+	AutomationID *uuid.UUID `db:"automation_id" json:"automation_id,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// ConversationLabelService manages conversation labels
+type ConversationLabelService struct {
+	db *sqlx.DB
+}
+
+// NewConversationLabelService creates a new conversation label service
+func NewConversationLabelService(db *sqlx.DB) *ConversationLabelService {
+	return &ConversationLabelService{db: db}
+}
+
+// Add labels a conversation on behalf of an automation. It reports whether the label
+// is new.
+func (s *ConversationLabelService) Add(conversationID, automationID uuid.UUID, label string) (bool, error) {
+	result, err := s.db.Exec(`
+		INSERT INTO conversation_labels (conversation_id, label, automation_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (conversation_id, label) DO NOTHING
+	`, conversationID, label, automationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to add conversation label: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// AddByAdmin labels a group on behalf of its owner or an admin. It reports whether the
+// label is new.
+func (s *ConversationLabelService) AddByAdmin(conversationID, userID uuid.UUID, label string) (bool, error) {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return false, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO conversation_labels (conversation_id, label)
+		VALUES ($1, $2)
+		ON CONFLICT (conversation_id, label) DO NOTHING
+	`, conversationID, label)
+	if err != nil {
+		return false, fmt.Errorf("failed to add conversation label: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// List returns a conversation's labels by name, for one of its participants
+func (s *ConversationLabelService) List(conversationID, userID uuid.UUID) ([]ConversationLabel, error) {
+	if _, err := groupRole(s.db, conversationID, userID); err != nil && err != ErrGroupOnly {
+		return nil, err
+	}
+
+	labels := []ConversationLabel{}
+	err := s.db.Select(&labels, `
+		SELECT label, automation_id, created_at FROM conversation_labels
+		WHERE conversation_id = $1
+		ORDER BY label
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation labels: %w", err)
+	}
+	return labels, nil
+}
+
+// Remove takes a label off a conversation on behalf of its owner or an admin
+func (s *ConversationLabelService) Remove(conversationID, userID uuid.UUID, label string) error {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM conversation_labels WHERE conversation_id = $1 AND label = $2
+	`, conversationID, label)
+	if err != nil {
+		return fmt.Errorf("failed to remove conversation label: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ConversationLimits cap how many conversations and groups a user may create per hour
+// and per day, and how large groups grow. Users an administrator verified get the
+// verified limits. A zero value means unlimited.
+type ConversationLimits struct {
+	PerHour         int
+	PerDay          int
+	VerifiedPerHour int
+	VerifiedPerDay  int
+	MaxParticipants int
+	// LargeGroupThreshold is the number of participants past which a group switches to
+	// large-group mode
+	LargeGroupThreshold int
+}
+
+// ConversationLimitError is returned when creating a conversation would exceed one of
+// the creator's limits
+type ConversationLimitError struct {
+	Limit  int
+	Window time.Duration
+	// RetryAt is when the oldest conversation counted leaves the window
+	RetryAt time.Time
+}
+
+func (e *ConversationLimitError) Error() string {
+	return fmt.Sprintf("conversation limit of %d per %s reached", e.Limit, e.Window)
+}
+
+// WithLimits makes Create enforce limits on the conversations each user creates, and
+// Create and AddParticipant limits on group sizes
+func (s *ConversationService) WithLimits(limits ConversationLimits) *ConversationService {
+	s.limits = limits
+	return s
+}
+
+// checkCreationLimits returns a *ConversationLimitError when creatorID has used up one
+// of their limits. It locks the creator's row for the rest of tx so that concurrent
+// creations are counted one after the other. Administrators and system accounts have
+// no limits.
+func (s *ConversationService) checkCreationLimits(tx *sqlx.Tx, creatorID uuid.UUID) error {
+	if s.limits.PerHour == 0 && s.limits.PerDay == 0 && s.limits.VerifiedPerHour == 0 && s.limits.VerifiedPerDay == 0 {
+		return nil
+	}
+
+	var creator struct {
+		IsAdmin  bool `db:"is_admin"`
+		IsSystem bool `db:"is_system"`
+		Verified bool `db:"verified"`
+	}
+	err := tx.Get(&creator, `
+		SELECT is_admin, is_system, verified_at IS NOT NULL AS verified
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, creatorID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get creator: %w", err)
+	}
+	if creator.IsAdmin || creator.IsSystem {
+		return nil
+	}
+
+	perHour, perDay := s.limits.PerHour, s.limits.PerDay
+	if creator.Verified {
+		perHour, perDay = s.limits.VerifiedPerHour, s.limits.VerifiedPerDay
+	}
+	for _, window := range []struct {
+		limit  int
+		period time.Duration
+	}{{perHour, time.Hour}, {perDay, 24 * time.Hour}} {
+		if window.limit <= 0 {
+			continue
+		}
+		// The limit-th latest conversation in the window, if there are that many
+		var createdAt time.Time
+		err := tx.Get(&createdAt, `
+			SELECT created_at FROM conversations
+			WHERE created_by = $1 AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $2)
+			ORDER BY created_at DESC
+			OFFSET $3 - 1 LIMIT 1
+		`, creatorID, window.period.Seconds(), window.limit)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to count created conversations: %w", err)
+		}
+		return &ConversationLimitError{
+			Limit:   window.limit,
+			Window:  window.period,
+			RetryAt: createdAt.Add(window.period),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxLockDuration is the longest a group can be locked for at once
+const MaxLockDuration = 7 * 24 * time.Hour
+
+var (
+	// ErrConversationLocked is returned when a participant posts in a locked group
+	ErrConversationLocked = errors.New("conversation is locked")
+	// ErrNotLocked is returned when unlocking a group that isn't locked
+	ErrNotLocked = errors.New("conversation is not locked")
+)
+
+// ConversationLock is a lock admins put on a group
+type ConversationLock struct {
+	ConversationID uuid.UUID  `db:"id" json:"conversation_id"`
+	LockedBy       *uuid.UUID `db:"locked_by" json:"locked_by,omitempty"`
+	LockedUntil    time.Time  `db:"locked_until" json:"locked_until"`
+	Reason         *string    `db:"lock_reason" json:"reason,omitempty"`
+}
+
+// Lock keeps everyone but the owner and admins of a group from posting until the lock
+// expires, replacing any lock it has. Only the owner and admins can lock a group.
+func (s *ConversationService) Lock(conversationID, userID uuid.UUID, duration time.Duration, reason *string) (*ConversationLock, error) {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	lock := &ConversationLock{}
+	err := s.db.Get(lock, `
+		UPDATE conversations
+		SET locked_until = NOW() + $3 * INTERVAL '1 second', locked_by = $2, lock_reason = $4,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING id, locked_by, locked_until, lock_reason
+	`, conversationID, userID, int64(duration/time.Second), reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock conversation: %w", err)
+	}
+	return lock, nil
+}
+
+// Unlock lifts the lock of a group before it expires. Only the owner and admins can
+// unlock a group.
+func (s *ConversationService) Unlock(conversationID, userID uuid.UUID) error {
+	if err := requireGroupAdmin(s.db, conversationID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE conversations
+		SET locked_until = NULL, locked_by = NULL, lock_reason = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND locked_until > NOW()
+	`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to unlock conversation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotLocked
+	}
+	return nil
+}
+
+// ClearExpiredLocks forgets up to limit locks that expired and returns them, for the
+// groups to be told they can post again
+func (s *ConversationService) ClearExpiredLocks(limit int) ([]ConversationLock, error) {
+	locks := []ConversationLock{}
+	err := s.db.Select(&locks, `
+		UPDATE conversations c
+		SET locked_until = NULL, locked_by = NULL, lock_reason = NULL, updated_at = CURRENT_TIMESTAMP
+		FROM (
+			SELECT id, locked_by, locked_until, lock_reason FROM conversations
+			WHERE locked_until <= NOW()
+			ORDER BY locked_until
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) expired
+		WHERE c.id = expired.id
+		RETURNING expired.id, COALESCE(expired.locked_by, c.created_by) AS locked_by,
+			expired.locked_until, expired.lock_reason
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear expired locks: %w", err)
+	}
+	return locks, nil
+}
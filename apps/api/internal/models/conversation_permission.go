@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Actions whose permission a group's owner can restrict
+const (
+	ActionSend  = "send"
+	ActionReply = "reply"
+	ActionReact = "react"
+	ActionStar  = "star"
+)
+
+// Who may take an action in a group
+const (
+	PermissionEveryone = "everyone"
+	PermissionAdmins   = "admins"
+	PermissionOwner    = "owner"
+)
+
+// ConversationActions are the actions a group's permissions cover
+var ConversationActions = []string{ActionSend, ActionReply, ActionReact, ActionStar}
+
+// ErrPermissionDenied is returned when a group's permissions don't let a participant
+// take an action
+var ErrPermissionDenied = errors.New("not permitted in this conversation")
+
+// ConversationPermissions maps actions to who may take them. Actions left out are open
+// to everyone.
+type ConversationPermissions map[string]string
+
+func (p *ConversationPermissions) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		*p = ConversationPermissions{}
+		return nil
+	}
+	return json.Unmarshal(bytes, p)
+}
+
+// IsPermissionLevel reports whether level is one of the permission levels
+func IsPermissionLevel(level string) bool {
+	return level == PermissionEveryone || level == PermissionAdmins || level == PermissionOwner
+}
+
+// IsConversationAction reports whether action is one permissions can be set for
+func IsConversationAction(action string) bool {
+	for _, a := range ConversationActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a participant with role may take an action at level
+func allows(level, role string) bool {
+	switch level {
+	case PermissionAdmins:
+		return role == "owner" || role == "admin"
+	case PermissionOwner:
+		return role == "owner"
+	default:
+		return true
+	}
+}
+
+// CheckPermission returns ErrPermissionDenied unless userID may take action in a
+// conversation, and ErrConversationNotFound unless they take part in it. While a group
+// is locked, only its owner and admins may send and reply, and others get
+// ErrConversationLocked. Direct conversations have no permissions to restrict.
+func (s *ConversationService) CheckPermission(conversationID, userID uuid.UUID, action string) error {
+	return s.checkPermission(`c.id = $1`, conversationID, userID, action)
+}
+
+// CheckMessagePermission is CheckPermission for the conversation of a message
+func (s *ConversationService) CheckMessagePermission(messageID, userID uuid.UUID, action string) error {
+	return s.checkPermission(`c.id = (SELECT conversation_id FROM messages WHERE id = $1)`, messageID, userID, action)
+}
+
+func (s *ConversationService) checkPermission(where string, id, userID uuid.UUID, action string) error {
+	var target struct {
+		Type   string         `db:"type"`
+		Level  sql.NullString `db:"level"`
+		Role   string         `db:"role"`
+		Locked bool           `db:"locked"`
+	}
+	err := s.db.Get(&target, `
+		SELECT c.type, c.permissions->>$3 AS level, cp.role,
+			COALESCE(c.locked_until > NOW(), false) AS locked
+		FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = $2
+		WHERE `+where+` AND c.deleted_at IS NULL
+	`, id, userID, action)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check permission: %w", err)
+	}
+	if target.Type != "group" {
+		return nil
+	}
+	if target.Locked && (action == ActionSend || action == ActionReply) && !allows(PermissionAdmins, target.Role) {
+		return ErrConversationLocked
+	}
+	if !allows(target.Level.String, target.Role) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotAdmin is returned when a change needs the conversation owner or an admin
+	ErrNotAdmin = errors.New("only conversation admins can do this")
+	// ErrGroupOnly is returned for settings that direct conversations do not have
+	ErrGroupOnly = errors.New("only group conversations have this setting")
+)
+
+// ConversationSettings changes how a conversation looks and behaves. Nil fields are
+// left as they are and empty strings clear them.
+type ConversationSettings struct {
+	AvatarURL   *string
+	AccentColor *string
+	Theme       *string
+	// ContentFilterMode and ContentFilterLocale override the server's profanity filter
+	ContentFilterMode   *string
+	ContentFilterLocale *string
+	// WelcomeMessage is posted when someone joins; it and Rules are owner-only group settings
+	WelcomeMessage *string
+	Rules          *string
+	// HistoryVisibility decides whether new members see earlier messages; owner-only, groups only
+	HistoryVisibility *string
+	// Nicknames maps participants to the name shown for them in this conversation
+	Nicknames map[uuid.UUID]string
+	// IntegrityChain starts keeping an integrity chain when true; it can't be stopped.
+	// Owner-only in groups.
+	IntegrityChain *bool
+	// Permissions sets who may take actions, merged into the ones set before; owner-only,
+	// groups only
+	Permissions map[string]string
+}
+
+// UpdateSettings applies settings on behalf of userID. Any participant may set
+// nicknames; in groups only the owner and admins may change the appearance and content
+// filter and only the owner may change the welcome message, rules, history visibility
+// and permissions or start an integrity chain.
+func (s *ConversationService) UpdateSettings(conversationID, userID uuid.UUID, settings ConversationSettings) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var convType string
+	err = tx.Get(&convType, `
+		SELECT type FROM conversations WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, conversationID)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	var role string
+	err = tx.Get(&role, `
+		SELECT role FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check role: %w", err)
+	}
+
+	sets := []string{"updated_at = CURRENT_TIMESTAMP"}
+	args := []interface{}{conversationID}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"avatar_url", settings.AvatarURL},
+		{"accent_color", settings.AccentColor},
+		{"theme", settings.Theme},
+		{"content_filter_mode", settings.ContentFilterMode},
+		{"content_filter_locale", settings.ContentFilterLocale},
+	} {
+		if field.value == nil {
+			continue
+		}
+		args = append(args, *field.value)
+		sets = append(sets, fmt.Sprintf("%s = NULLIF($%d, '')", field.column, len(args)))
+	}
+	if len(args) > 1 && convType == "group" && role != "owner" && role != "admin" {
+		return ErrNotAdmin
+	}
+
+	if settings.WelcomeMessage != nil || settings.Rules != nil || settings.HistoryVisibility != nil || settings.Permissions != nil {
+		if convType != "group" {
+			return ErrGroupOnly
+		}
+		if role != "owner" {
+			return ErrNotOwner
+		}
+		for _, field := range []struct {
+			column string
+			value  *string
+		}{
+			{"welcome_message", settings.WelcomeMessage},
+			{"rules", settings.Rules},
+		} {
+			if field.value == nil {
+				continue
+			}
+			args = append(args, *field.value)
+			sets = append(sets, fmt.Sprintf("%s = NULLIF($%d, '')", field.column, len(args)))
+		}
+		if settings.HistoryVisibility != nil {
+			args = append(args, *settings.HistoryVisibility)
+			sets = append(sets, fmt.Sprintf("history_visibility = $%d", len(args)))
+		}
+		if settings.Permissions != nil {
+			encoded, err := json.Marshal(settings.Permissions)
+			if err != nil {
+				return fmt.Errorf("failed to encode permissions: %w", err)
+			}
+			args = append(args, string(encoded))
+			sets = append(sets, fmt.Sprintf("permissions = permissions || $%d::jsonb", len(args)))
+		}
+	}
+
+	if settings.IntegrityChain != nil && *settings.IntegrityChain {
+		if convType == "group" && role != "owner" {
+			return ErrNotOwner
+		}
+		sets = append(sets, "integrity_chain_since = COALESCE(integrity_chain_since, CURRENT_TIMESTAMP)")
+	}
+
+	// Always touched, so nickname changes also show up in conversation list deltas
+	_, err = tx.Exec(`UPDATE conversations SET `+strings.Join(sets, ", ")+` WHERE id = $1`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	for participantID, nickname := range settings.Nicknames {
+		result, err := tx.Exec(`
+			UPDATE conversation_participants
+			SET nickname = NULLIF($3, '')
+			WHERE conversation_id = $1 AND user_id = $2
+		`, conversationID, participantID, nickname)
+		if err != nil {
+			return fmt.Errorf("failed to set nickname: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rows == 0 {
+			return ErrInvalidParticipant
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
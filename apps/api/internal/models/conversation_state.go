@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// participantMuted tells whether the participant cp muted their conversation
+const participantMuted = `(cp.muted_at IS NOT NULL AND (cp.muted_until IS NULL OR cp.muted_until > NOW()))`
+
+// SetMuted mutes or unmutes conversations for a user. Muted conversations don't notify
+// them of messages, except those mentioning them, until unmuted or until until when it
+// is set. It returns the conversations changed, leaving out those the user doesn't take
+// part in.
+func (s *ConversationService) SetMuted(conversationIDs []uuid.UUID, userID uuid.UUID, muted bool, until *time.Time) ([]uuid.UUID, error) {
+	changed := []uuid.UUID{}
+	err := s.db.Select(&changed, `
+		UPDATE conversation_participants cp
+		SET muted_at = CASE WHEN $3 THEN CURRENT_TIMESTAMP END,
+			muted_until = CASE WHEN $3 THEN $4::timestamptz END
+		FROM conversations c
+		WHERE c.id = cp.conversation_id AND c.deleted_at IS NULL
+		  AND cp.conversation_id = ANY($1::uuid[]) AND cp.user_id = $2
+		RETURNING cp.conversation_id
+	`, pq.StringArray(uuidStrings(conversationIDs)), userID, muted, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mute conversations: %w", err)
+	}
+	return changed, nil
+}
+
+// SetNotificationPreview sets how much of a conversation's messages the user's
+// notifications show, overriding their default; a nil preview goes back to it
+func (s *ConversationService) SetNotificationPreview(conversationID, userID uuid.UUID, preview *string) error {
+	if preview != nil && !contains(NotificationPreviews, *preview) {
+		return fmt.Errorf("%w: unknown preview %q", ErrInvalidInput, *preview)
+	}
+	result, err := s.db.Exec(`
+		UPDATE conversation_participants cp
+		SET notification_preview = $3
+		FROM conversations c
+		WHERE c.id = cp.conversation_id AND c.deleted_at IS NULL
+		  AND cp.conversation_id = $1 AND cp.user_id = $2
+	`, conversationID, userID, preview)
+	if err != nil {
+		return fmt.Errorf("failed to set notification preview: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrInvalidParticipant
+	}
+	return nil
+}
+
+// SetArchived archives or unarchives conversations for a user, who still gets their
+// messages. Archiving an archived conversation keeps when it was first archived. It
+// returns the conversations changed, leaving out those the user doesn't take part in.
+func (s *ConversationService) SetArchived(conversationIDs []uuid.UUID, userID uuid.UUID, archived bool) ([]uuid.UUID, error) {
+	changed := []uuid.UUID{}
+	err := s.db.Select(&changed, `
+		UPDATE conversation_participants cp
+		SET archived_at = CASE WHEN $3 THEN COALESCE(cp.archived_at, CURRENT_TIMESTAMP) END
+		FROM conversations c
+		WHERE c.id = cp.conversation_id AND c.deleted_at IS NULL
+		  AND cp.conversation_id = ANY($1::uuid[]) AND cp.user_id = $2
+		RETURNING cp.conversation_id
+	`, pq.StringArray(uuidStrings(conversationIDs)), userID, archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive conversations: %w", err)
+	}
+	return changed, nil
+}
+
+// SetPins pins conversations for a user in the order given, ahead of the others when
+// their list is sorted manually, and unpins the ones left out. It returns the
+// conversations whose pin changed, or ErrInvalidParticipant when the user doesn't take
+// part in one of them.
+func (s *ConversationService) SetPins(userID uuid.UUID, conversationIDs []uuid.UUID) ([]uuid.UUID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	changed := []uuid.UUID{}
+	err = tx.Select(&changed, `
+		WITH pins AS (
+			SELECT id, position::int AS position FROM unnest($2::uuid[]) WITH ORDINALITY AS p(id, position)
+		)
+		UPDATE conversation_participants cp
+		SET pin_position = pins.position
+		FROM conversation_participants previous
+		LEFT JOIN pins ON pins.id = previous.conversation_id
+		WHERE previous.user_id = $1 AND cp.user_id = $1 AND cp.conversation_id = previous.conversation_id
+		  AND (previous.pin_position IS NOT NULL OR pins.id IS NOT NULL)
+		  AND previous.pin_position IS DISTINCT FROM pins.position
+		RETURNING cp.conversation_id
+	`, userID, pq.StringArray(uuidStrings(conversationIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin conversations: %w", err)
+	}
+
+	var pinned int
+	err = tx.Get(&pinned, `
+		SELECT COUNT(*) FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		WHERE cp.user_id = $1 AND cp.conversation_id = ANY($2::uuid[])
+	`, userID, pq.StringArray(uuidStrings(conversationIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pinned conversations: %w", err)
+	}
+	if pinned != len(conversationIDs) {
+		return nil, ErrInvalidParticipant
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// syncOverlap is how far back sync tokens reach, so changes committed by transactions
+// that started before a sync are not missed. Clients may see a few conversations twice.
+const syncOverlap = 5 * time.Second
+
+// ConversationDelta lists what changed in a user's conversation list since a sync token
+type ConversationDelta struct {
+	// Conversations whose metadata, membership or messages changed
+	Conversations []Conversation `json:"conversations"`
+	// RemovedIDs are conversations the user left or that were deleted
+	RemovedIDs []uuid.UUID `json:"removed_ids"`
+	// SyncToken is passed as updated_since on the next sync
+	SyncToken string `json:"sync_token"`
+}
+
+// SyncToken returns a token marking the current point in the conversation change history
+func (s *ConversationService) SyncToken() (string, error) {
+	var now time.Time
+	if err := s.db.Get(&now, "SELECT CURRENT_TIMESTAMP"); err != nil {
+		return "", fmt.Errorf("failed to get sync token: %w", err)
+	}
+	return FormatSyncToken(now.Add(-syncOverlap)), nil
+}
+
+// FormatSyncToken encodes a point in time as a sync token
+func FormatSyncToken(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseSyncToken decodes a sync token. Any RFC 3339 timestamp is accepted as well.
+func ParseSyncToken(token string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, token)
+	if err != nil {
+		return time.Time{}, ErrInvalidInput
+	}
+	return t, nil
+}
+
+// GetUserConversationsSince returns the user's conversations that changed after since,
+// and the ones they left, along with the token for the next sync
+func (s *ConversationService) GetUserConversationsSince(userID uuid.UUID, since time.Time, details ConversationDetails) (*ConversationDelta, error) {
+	// Taken first so that anything changing while the delta is built is seen next time
+	token, err := s.SyncToken()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []Conversation{}
+	err = s.db.Select(&conversations, `
+		SELECT`+conversationListColumns+`
+		FROM conversations c
+		INNER JOIN conversation_participants cp ON cp.conversation_id = c.id
+		LEFT JOIN conversation_summaries s ON s.conversation_id = c.id
+		WHERE cp.user_id = $1 AND c.updated_at > $2 AND c.deleted_at IS NULL
+		ORDER BY c.updated_at DESC
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed conversations: %w", err)
+	}
+
+	if err := s.loadConversationDetails(userID, conversations, details); err != nil {
+		return nil, err
+	}
+
+	removed := []uuid.UUID{}
+	err = s.db.Select(&removed, `
+		SELECT d.conversation_id
+		FROM conversation_departures d
+		WHERE d.user_id = $1 AND d.departed_at > $2
+		  AND NOT EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			WHERE cp.conversation_id = d.conversation_id AND cp.user_id = $1
+		  )
+		UNION
+		SELECT c.id
+		FROM conversations c
+		INNER JOIN conversation_participants cp ON cp.conversation_id = c.id
+		WHERE cp.user_id = $1 AND c.deleted_at > $2
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get departed conversations: %w", err)
+	}
+
+	return &ConversationDelta{
+		Conversations: conversations,
+		RemovedIDs:    removed,
+		SyncToken:     token,
+	}, nil
+}
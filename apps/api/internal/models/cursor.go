@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidCursor is returned when a cursor points at a message outside the conversation
+var ErrInvalidCursor = errors.New("cursor message is not in this conversation")
+
+// ConversationCursor is how far a participant has received and read a conversation.
+// Messages are ordered by creation time, then ID.
+type ConversationCursor struct {
+	UserID                 uuid.UUID  `db:"user_id" json:"user_id"`
+	LastReadMessageID      *uuid.UUID `db:"last_read_message_id" json:"last_read_message_id"`
+	LastDeliveredMessageID *uuid.UUID `db:"last_delivered_message_id" json:"last_delivered_message_id"`
+	LastReadAt             time.Time  `db:"last_read_at" json:"last_read_at"`
+	// UnreadCount is only loaded when the participant moves their own cursors, for their
+	// other devices to catch up
+	UnreadCount int `db:"unread_count" json:"-"`
+}
+
+// CursorUpdate moves a participant's cursors. Nil fields are left as they are.
+type CursorUpdate struct {
+	ReadMessageID      *uuid.UUID
+	DeliveredMessageID *uuid.UUID
+}
+
+// messagePosition orders messages within a conversation
+type messagePosition struct {
+	CreatedAt time.Time `db:"created_at"`
+	ID        uuid.UUID `db:"id"`
+}
+
+func (p messagePosition) before(other messagePosition) bool {
+	if !p.CreatedAt.Equal(other.CreatedAt) {
+		return p.CreatedAt.Before(other.CreatedAt)
+	}
+	return p.ID.String() < other.ID.String()
+}
+
+// GetCursors returns the cursors of every participant in a conversation, as seen by
+// userID. Large groups don't share them: userID only gets their own.
+func (s *ConversationService) GetCursors(conversationID, userID uuid.UUID) ([]ConversationCursor, error) {
+	cursors := []ConversationCursor{}
+	err := s.db.Select(&cursors, `
+		SELECT cp.user_id, cp.last_read_message_id, cp.last_delivered_message_id, cp.last_read_at
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id
+		WHERE cp.conversation_id = $1 AND (NOT c.large_group OR cp.user_id = $2)
+		ORDER BY cp.joined_at ASC
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursors: %w", err)
+	}
+	return cursors, nil
+}
+
+// SetCursor atomically moves the user's cursors in a conversation. Cursors only move
+// forward, so a stale device cannot undo progress made on another, and reading a
+// message implies it was delivered.
+func (s *ConversationService) SetCursor(conversationID, userID uuid.UUID, update CursorUpdate) (*ConversationCursor, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var cursor ConversationCursor
+	err = tx.Get(&cursor, `
+		SELECT user_id, last_read_message_id, last_delivered_message_id, last_read_at
+		FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2
+		FOR UPDATE
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidParticipant
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor: %w", err)
+	}
+
+	readAdvanced, err := advanceCursor(tx, conversationID, &cursor.LastReadMessageID, update.ReadMessageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, delivered := range []*uuid.UUID{update.DeliveredMessageID, cursor.LastReadMessageID} {
+		if _, err := advanceCursor(tx, conversationID, &cursor.LastDeliveredMessageID, delivered); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Get(&cursor, `
+		UPDATE conversation_participants
+		SET last_read_message_id = $3,
+			last_delivered_message_id = $4,
+			last_read_at = CASE WHEN $5 THEN CURRENT_TIMESTAMP ELSE last_read_at END
+		WHERE conversation_id = $1 AND user_id = $2
+		RETURNING user_id, last_read_message_id, last_delivered_message_id, last_read_at
+	`, conversationID, userID, cursor.LastReadMessageID, cursor.LastDeliveredMessageID, readAdvanced)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update cursor: %w", err)
+	}
+
+	// Messages the read cursor moved past are no longer unread
+	if readAdvanced {
+		if err := recountUnread(tx, conversationID, userID); err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Get(&cursor.UnreadCount, `
+		SELECT unread_count FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &cursor, nil
+}
+
+// advanceCursor points current at next if next is later in the conversation and
+// reports whether it moved
+func advanceCursor(tx *sqlx.Tx, conversationID uuid.UUID, current **uuid.UUID, next *uuid.UUID) (bool, error) {
+	if next == nil {
+		return false, nil
+	}
+
+	nextPos, err := getMessagePosition(tx, conversationID, *next)
+	if err == sql.ErrNoRows {
+		return false, ErrInvalidCursor
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if *current != nil {
+		currentPos, err := getMessagePosition(tx, conversationID, **current)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		if err == nil && !currentPos.before(nextPos) {
+			return false, nil
+		}
+	}
+
+	id := *next
+	*current = &id
+	return true, nil
+}
+
+func getMessagePosition(tx *sqlx.Tx, conversationID, messageID uuid.UUID) (messagePosition, error) {
+	var pos messagePosition
+	err := tx.Get(&pos, `
+		SELECT created_at, id FROM messages
+		WHERE id = $1 AND conversation_id = $2
+	`, messageID, conversationID)
+	if err != nil && err != sql.ErrNoRows {
+		return pos, fmt.Errorf("failed to get message: %w", err)
+	}
+	return pos, err
+}
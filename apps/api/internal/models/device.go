@@ -0,0 +1,225 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxChallengeAttempts is how many wrong codes end a login challenge
+const maxChallengeAttempts = 5
+
+// LoginDevice is where a sign-in comes from
+type LoginDevice struct {
+	Fingerprint string `db:"fingerprint" json:"-"`
+	Name        string `db:"name" json:"name"`
+	IP          string `db:"last_ip" json:"ip"`
+	Country     string `db:"country" json:"country,omitempty"`
+}
+
+// UserDevice is a device a user has signed in from
+type UserDevice struct {
+	ID uuid.UUID `db:"id" json:"id"`
+	LoginDevice
+	UserID      uuid.UUID `db:"user_id" json:"-"`
+	FirstSeenAt time.Time `db:"first_seen_at" json:"first_seen_at"`
+	LastSeenAt  time.Time `db:"last_seen_at" json:"last_seen_at"`
+}
+
+// LoginChallenge is a sign-in from a new device waiting for the emailed code
+type LoginChallenge struct {
+	ID          uuid.UUID `db:"id"`
+	UserID      uuid.UUID `db:"user_id"`
+	CodeHash    string    `db:"code_hash"`
+	Fingerprint string    `db:"fingerprint"`
+	DeviceName  string    `db:"device_name"`
+	IP          string    `db:"ip"`
+	Country     string    `db:"country"`
+	Attempts    int       `db:"attempts"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Device returns the device the challenged sign-in came from
+func (c *LoginChallenge) Device() *LoginDevice {
+	return &LoginDevice{Fingerprint: c.Fingerprint, Name: c.DeviceName, IP: c.IP, Country: c.Country}
+}
+
+// DeviceService tracks the devices users sign in from
+type DeviceService struct {
+	db *sqlx.DB
+}
+
+// NewDeviceService creates a new device service
+func NewDeviceService(db *sqlx.DB) *DeviceService {
+	return &DeviceService{db: db}
+}
+
+// IsFamiliar reports whether a user has signed in from device before, and from its
+// country when known. A user's first device is always familiar, as there is nothing
+// to compare it with.
+func (s *DeviceService) IsFamiliar(userID uuid.UUID, device *LoginDevice) (bool, error) {
+	var familiar bool
+	err := s.db.Get(&familiar, `
+		SELECT NOT EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1)
+			OR (EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND fingerprint = $2)
+				AND ($3 = '' OR EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND country = $3)))
+	`, userID, device.Fingerprint, device.Country)
+	if err != nil {
+		return false, fmt.Errorf("failed to check device: %w", err)
+	}
+	return familiar, nil
+}
+
+// Record remembers that a user signed in from device
+func (s *DeviceService) Record(userID uuid.UUID, device *LoginDevice) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_devices (user_id, fingerprint, name, last_ip, country)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET name = EXCLUDED.name, last_ip = EXCLUDED.last_ip, country = EXCLUDED.country,
+			last_seen_at = CURRENT_TIMESTAMP
+	`, userID, device.Fingerprint, device.Name, device.IP, device.Country)
+	if err != nil {
+		return fmt.Errorf("failed to record device: %w", err)
+	}
+	return nil
+}
+
+// RecordLocation remembers that a user signed in from ip, in country when known, and
+// reports whether the IP or the country is new for them. A user's first sign-in is
+// never new, as there is nothing to compare it with.
+func (s *DeviceService) RecordLocation(userID uuid.UUID, ip, country string) (bool, error) {
+	var isNew bool
+	err := s.db.Get(&isNew, `
+		SELECT EXISTS (SELECT 1 FROM login_ips WHERE user_id = $1)
+			AND (NOT EXISTS (SELECT 1 FROM login_ips WHERE user_id = $1 AND ip = $2)
+				OR ($3 <> '' AND NOT EXISTS (SELECT 1 FROM login_ips WHERE user_id = $1 AND country = $3)))
+	`, userID, ip, country)
+	if err != nil {
+		return false, fmt.Errorf("failed to check login location: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO login_ips (user_id, ip, country)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, ip) DO UPDATE
+		SET country = EXCLUDED.country, last_seen_at = CURRENT_TIMESTAMP
+	`, userID, ip, country)
+	if err != nil {
+		return false, fmt.Errorf("failed to record login location: %w", err)
+	}
+	return isNew, nil
+}
+
+// List returns the devices a user has signed in from, most recently used first
+func (s *DeviceService) List(userID uuid.UUID) ([]UserDevice, error) {
+	devices := []UserDevice{}
+	err := s.db.Select(&devices, `
+		SELECT id, user_id, fingerprint, name, last_ip, country, first_seen_at, last_seen_at
+		FROM user_devices
+		WHERE user_id = $1
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// CreateChallenge holds back a sign-in from device until the user enters the returned
+// code, which is only stored hashed
+func (s *DeviceService) CreateChallenge(userID uuid.UUID, device *LoginDevice, ttl time.Duration) (*LoginChallenge, string, error) {
+	code, err := newChallengeCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	challenge := &LoginChallenge{}
+	id := uuid.New()
+	err = s.db.Get(challenge, `
+		INSERT INTO login_challenges (id, user_id, code_hash, fingerprint, device_name, ip, country, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING *
+	`, id, userID, hashChallengeCode(id, code), device.Fingerprint, device.Name, device.IP, device.Country,
+		time.Now().Add(ttl))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return challenge, code, nil
+}
+
+// VerifyChallenge checks the code of a login challenge and ends the challenge when it
+// is right. Wrong codes return ErrUnauthorized; unknown, expired and exhausted
+// challenges return ErrNotFound.
+func (s *DeviceService) VerifyChallenge(id uuid.UUID, code string) (*LoginChallenge, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	challenge := &LoginChallenge{}
+	err = tx.Get(challenge, `
+		SELECT * FROM login_challenges
+		WHERE id = $1 AND expires_at > NOW() AND attempts < $2
+		FOR UPDATE
+	`, id, maxChallengeAttempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashChallengeCode(id, code)), []byte(challenge.CodeHash)) != 1 {
+		if _, err := tx.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1`, id); err != nil {
+			return nil, fmt.Errorf("failed to count attempt: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, ErrUnauthorized
+	}
+
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to end login challenge: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return challenge, nil
+}
+
+// PurgeExpiredChallenges removes login challenges nobody completed
+func (s *DeviceService) PurgeExpiredChallenges() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM login_challenges WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge login challenges: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// newChallengeCode generates a six digit code to email to a user
+func newChallengeCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashChallengeCode binds a code to its challenge so hashes can't be compared across
+// challenges
+func hashChallengeCode(id uuid.UUID, code string) string {
+	sum := sha256.Sum256([]byte(id.String() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
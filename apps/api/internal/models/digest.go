@@ -0,0 +1,292 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// DigestDaily digests report on the day before they are posted
+	DigestDaily = "daily"
+	// DigestWeekly digests report on the seven days before they are posted
+	DigestWeekly = "weekly"
+	// digestTopLimit is how many members and threads a digest names
+	digestTopLimit = 3
+	// digestPreviewLength is how many characters of a thread's first message a digest quotes
+	digestPreviewLength = 60
+)
+
+// ConversationDigest is a recurring summary of a group's activity posted into it. Its
+// hour and weekday are in its timezone.
+type ConversationDigest struct {
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	Frequency      string    `db:"frequency" json:"frequency" example:"weekly"`
+	Hour           int       `db:"hour" json:"hour" example:"9"`
+	Timezone       string    `db:"timezone" json:"timezone" example:"Europe/Berlin"`
+	// Weekday is when weekly digests are posted, from Sunday (0) to Saturday (6)
+	Weekday      *int       `db:"weekday" json:"weekday,omitempty" example:"1"`
+	CreatedBy    *uuid.UUID `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+	LastPostedAt *time.Time `db:"last_posted_at" json:"last_posted_at,omitempty"`
+	NextPostAt   time.Time  `db:"next_post_at" json:"next_post_at"`
+}
+
+// DueDigest is a digest to post now, as the group's owner
+type DueDigest struct {
+	ConversationDigest
+	OwnerID *uuid.UUID `db:"owner_id"`
+}
+
+// DigestThread is a message that drew replies during a digest's period
+type DigestThread struct {
+	MessageID      uuid.UUID `db:"message_id"`
+	SenderUsername string    `db:"sender_username"`
+	ReplyCount     int       `db:"reply_count"`
+	// Preview quotes the message; it is left empty in groups whose new members don't
+	// see earlier messages
+	Preview string `db:"content"`
+}
+
+// DigestReport is what a digest says about a group's activity from one day to
+// another, both included
+type DigestReport struct {
+	From          time.Time
+	To            time.Time
+	TotalMessages int
+	MembersJoined int
+	NewMembers    []string
+	MostActive    []ActiveMember
+	TopThreads    []DigestThread
+}
+
+// DigestService handles conversation digests
+type DigestService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewDigestService creates a new digest service
+func NewDigestService(db *sqlx.DB, encryptor encryption.Encryptor) *DigestService {
+	return &DigestService{db: db, encryptor: encryptor}
+}
+
+// Get returns the digest of a group userID takes part in, or ErrNotFound when it has none
+func (s *DigestService) Get(conversationID, userID uuid.UUID) (*ConversationDigest, error) {
+	if _, err := groupRole(s.db, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	digest := &ConversationDigest{}
+	err := s.db.Get(digest, `SELECT * FROM conversation_digests WHERE conversation_id = $1`, conversationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest: %w", err)
+	}
+	return digest, nil
+}
+
+// Set schedules a group's digest at hour in timezone, replacing the one it had. weekday
+// is only kept for weekly digests. Only the owner can set the digest.
+func (s *DigestService) Set(conversationID, userID uuid.UUID, frequency string, hour int, weekday *int, timezone string) (*ConversationDigest, error) {
+	if err := s.requireOwner(conversationID, userID); err != nil {
+		return nil, err
+	}
+	if frequency != DigestWeekly {
+		weekday = nil
+	}
+
+	digest := &ConversationDigest{}
+	err := s.db.Get(digest, `
+		INSERT INTO conversation_digests (conversation_id, frequency, hour, weekday, timezone, created_by, next_post_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (conversation_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency, hour = EXCLUDED.hour, weekday = EXCLUDED.weekday,
+			timezone = EXCLUDED.timezone, created_by = EXCLUDED.created_by,
+			next_post_at = EXCLUDED.next_post_at, updated_at = CURRENT_TIMESTAMP
+		RETURNING *
+	`, conversationID, frequency, hour, weekday, timezone, userID, nextDigestAt(frequency, hour, weekday, timezone, time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set digest: %w", err)
+	}
+	return digest, nil
+}
+
+// Delete stops a group's digest. Only the owner can stop it.
+func (s *DigestService) Delete(conversationID, userID uuid.UUID) error {
+	if err := s.requireOwner(conversationID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM conversation_digests WHERE conversation_id = $1`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete digest: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDue returns up to limit digests that are due and schedules their next post.
+// Rows are taken with SKIP LOCKED, so each digest is claimed by one instance.
+func (s *DigestService) ClaimDue(limit int) ([]DueDigest, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	due := []DueDigest{}
+	err = tx.Select(&due, `
+		SELECT d.*,
+			(SELECT cp.user_id FROM conversation_participants cp
+			 WHERE cp.conversation_id = d.conversation_id AND cp.role = 'owner'
+			 LIMIT 1) AS owner_id
+		FROM conversation_digests d
+		JOIN conversations c ON c.id = d.conversation_id AND c.deleted_at IS NULL
+		WHERE d.next_post_at <= NOW()
+		ORDER BY d.next_post_at
+		LIMIT $1
+		FOR UPDATE OF d SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due digests: %w", err)
+	}
+
+	now := time.Now()
+	for _, digest := range due {
+		_, err := tx.Exec(`
+			UPDATE conversation_digests SET last_posted_at = $2, next_post_at = $3
+			WHERE conversation_id = $1
+		`, digest.ConversationID, now, nextDigestAt(digest.Frequency, digest.Hour, digest.Weekday, digest.Timezone, now))
+		if err != nil {
+			return nil, fmt.Errorf("failed to schedule digest: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return due, nil
+}
+
+// Report gathers what a digest posted on day says: the day before for daily digests
+// and the seven days before for weekly ones. Days are dated in the digest's timezone;
+// counts come from the analytics rollups.
+func (s *DigestService) Report(digest *ConversationDigest, day time.Time) (*DigestReport, error) {
+	local := day.In(location(digest.Timezone))
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	from := to
+	if digest.Frequency == DigestWeekly {
+		from = to.AddDate(0, 0, -6)
+	}
+
+	analytics, err := NewAnalyticsService(s.db).conversationAnalytics(digest.ConversationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &DigestReport{
+		From:          from,
+		To:            to,
+		TotalMessages: analytics.TotalMessages,
+		NewMembers:    []string{},
+		MostActive:    analytics.MostActiveMembers,
+		TopThreads:    []DigestThread{},
+	}
+	for _, d := range analytics.Daily {
+		report.MembersJoined += d.MembersJoined
+	}
+	if len(report.MostActive) > digestTopLimit {
+		report.MostActive = report.MostActive[:digestTopLimit]
+	}
+
+	end := to.AddDate(0, 0, 1)
+	err = s.db.Select(&report.NewMembers, `
+		SELECT `+displayedUsername+`
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.conversation_id = $1 AND cp.joined_at >= $2 AND cp.joined_at < $3
+		ORDER BY cp.joined_at
+		LIMIT 10
+	`, digest.ConversationID, from, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get new members: %w", err)
+	}
+
+	err = s.db.Select(&report.TopThreads, `
+		SELECT p.id AS message_id, `+displayedUsername+` AS sender_username, p.content, COUNT(*) AS reply_count
+		FROM messages r
+		JOIN messages p ON p.id = r.reply_to_id AND NOT p.is_deleted AND NOT p.view_once
+		JOIN users u ON u.id = p.sender_id
+		WHERE r.conversation_id = $1 AND r.created_at >= $2 AND r.created_at < $3 AND NOT r.is_deleted
+		GROUP BY p.id, u.id, p.content
+		ORDER BY reply_count DESC, p.created_at DESC
+		LIMIT $4
+	`, digest.ConversationID, from, end, digestTopLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top threads: %w", err)
+	}
+
+	// Everyone reads the digest, so messages are only quoted where everyone can read them
+	var visibility string
+	err = s.db.Get(&visibility, `SELECT history_visibility FROM conversations WHERE id = $1`, digest.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history visibility: %w", err)
+	}
+	for i := range report.TopThreads {
+		thread := &report.TopThreads[i]
+		content := thread.Preview
+		thread.Preview = ""
+		if visibility != HistoryShared {
+			continue
+		}
+		if content, err = s.encryptor.DecryptString(content); err != nil {
+			return nil, fmt.Errorf("failed to decrypt message: %w", err)
+		}
+		runes := []rune(content)
+		if len(runes) > digestPreviewLength {
+			content = string(runes[:digestPreviewLength]) + "…"
+		}
+		thread.Preview = content
+	}
+
+	return report, nil
+}
+
+// requireOwner returns ErrNotOwner unless userID owns the group
+func (s *DigestService) requireOwner(conversationID, userID uuid.UUID) error {
+	role, err := groupRole(s.db, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// nextDigestAt returns when a digest is next posted after now, at hour in timezone
+func nextDigestAt(frequency string, hour int, weekday *int, timezone string, now time.Time) time.Time {
+	loc := location(timezone)
+	now = now.In(loc)
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, loc)
+	if frequency == DigestWeekly && weekday != nil {
+		next = next.AddDate(0, 0, (*weekday-int(next.Weekday())+7)%7)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	}
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
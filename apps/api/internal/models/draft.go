@@ -0,0 +1,325 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrDraftNotFound is returned when the user has no draft in a conversation
+	ErrDraftNotFound = errors.New("draft not found")
+	// ErrDraftEmpty is returned for sending a draft without content
+	ErrDraftEmpty = errors.New("draft has no content")
+)
+
+// MessageDraft is the message a participant is writing in a conversation, kept on the
+// server so they can pick it up on any device
+type MessageDraft struct {
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	UserID         uuid.UUID  `db:"user_id" json:"user_id"`
+	Content        string     `db:"content" json:"content"`
+	ReplyToID      *uuid.UUID `db:"reply_to_id" json:"reply_to_id,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+	// Attachment is the media staged to be sent with the draft
+	Attachment *StagedAttachment `db:"-" json:"attachment,omitempty"`
+}
+
+// StagedAttachment is media uploaded for a draft, which becomes the media of the
+// message the draft is sent as
+type StagedAttachment struct {
+	ID                uuid.UUID `db:"id" json:"id"`
+	ConversationID    uuid.UUID `db:"conversation_id" json:"-"`
+	UserID            uuid.UUID `db:"user_id" json:"-"`
+	MessageType       string    `db:"message_type" json:"type" example:"image"`
+	MediaURL          string    `db:"media_url" json:"media_url"`
+	MediaThumbnailURL *string   `db:"media_thumbnail_url" json:"media_thumbnail_url,omitempty"`
+	MediaSize         *int      `db:"media_size" json:"media_size,omitempty"`
+	MediaDuration     *int      `db:"media_duration" json:"media_duration,omitempty"`
+	ViewOnce          bool      `db:"view_once" json:"view_once"`
+	StagedAt          time.Time `db:"staged_at" json:"staged_at"`
+}
+
+// DraftService keeps message drafts and the media staged for them
+type DraftService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewDraftService creates a new draft service
+func NewDraftService(db *sqlx.DB, encryptor encryption.Encryptor) *DraftService {
+	return &DraftService{db: db, encryptor: encryptor}
+}
+
+// Get returns the user's draft in a conversation with its staged attachment
+func (s *DraftService) Get(conversationID, userID uuid.UUID) (*MessageDraft, error) {
+	return s.get(s.db, conversationID, userID, "")
+}
+
+// get loads a draft through q, with lock appended to the query of the draft
+func (s *DraftService) get(q sqlx.Queryer, conversationID, userID uuid.UUID, lock string) (*MessageDraft, error) {
+	draft := &MessageDraft{}
+	err := sqlx.Get(q, draft, `
+		SELECT * FROM message_drafts WHERE conversation_id = $1 AND user_id = $2
+	`+lock, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if draft.Content, err = s.encryptor.DecryptString(draft.Content); err != nil {
+		return nil, fmt.Errorf("failed to decrypt draft: %w", err)
+	}
+
+	attachment := &StagedAttachment{}
+	err = sqlx.Get(q, attachment, `
+		SELECT * FROM draft_attachments WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return draft, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staged attachment: %w", err)
+	}
+	for _, url := range []*string{&attachment.MediaURL, attachment.MediaThumbnailURL} {
+		if url == nil {
+			continue
+		}
+		if *url, err = decryptMediaURL(s.encryptor, *url); err != nil {
+			return nil, fmt.Errorf("staged attachment %s: %w", attachment.ID, err)
+		}
+	}
+	draft.Attachment = attachment
+	return draft, nil
+}
+
+// Save writes the text of the user's draft and the message it replies to, keeping any
+// staged attachment. ErrInvalidParticipant is returned unless they take part in the
+// conversation.
+func (s *DraftService) Save(conversationID, userID uuid.UUID, content string, replyToID *uuid.UUID) (*MessageDraft, error) {
+	if err := s.requireParticipant(conversationID, userID); err != nil {
+		return nil, err
+	}
+	if replyToID != nil {
+		var exists bool
+		err := s.db.Get(&exists, `
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND conversation_id = $2 AND NOT is_deleted)
+		`, *replyToID, conversationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check reply: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: reply_to_id is not a message of this conversation", ErrInvalidInput)
+		}
+	}
+
+	sealed, err := s.encryptor.EncryptString(content)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO message_drafts (conversation_id, user_id, content, reply_to_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (conversation_id, user_id) DO UPDATE
+		SET content = EXCLUDED.content, reply_to_id = EXCLUDED.reply_to_id, updated_at = CURRENT_TIMESTAMP
+	`, conversationID, userID, sealed, replyToID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return s.Get(conversationID, userID)
+}
+
+// Delete discards the user's draft and its staged attachment
+func (s *DraftService) Delete(conversationID, userID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		DELETE FROM message_drafts WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDraftNotFound
+	}
+	return nil
+}
+
+// Stage attaches media to the user's draft, starting an empty draft when they have none.
+// A draft has one attachment, as a message has, so staging replaces the one staged
+// before. The media URLs are encrypted, as those of sent messages are.
+func (s *DraftService) Stage(conversationID, userID uuid.UUID, attachment *StagedAttachment) (*MessageDraft, error) {
+	if err := s.requireParticipant(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealMedia(s.encryptor, &attachment.MediaURL, attachment.MediaThumbnailURL)
+	if err != nil {
+		return nil, err
+	}
+	emptyContent, err := s.encryptor.EncryptString("")
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO message_drafts (conversation_id, user_id, content)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (conversation_id, user_id) DO UPDATE SET updated_at = CURRENT_TIMESTAMP
+	`, conversationID, userID, emptyContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO draft_attachments (
+			conversation_id, user_id, message_type, media_url, media_thumbnail_url,
+			media_size, media_duration, view_once
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (conversation_id, user_id) DO UPDATE
+		SET id = uuid_generate_v4(), message_type = EXCLUDED.message_type, media_url = EXCLUDED.media_url,
+			media_thumbnail_url = EXCLUDED.media_thumbnail_url, media_size = EXCLUDED.media_size,
+			media_duration = EXCLUDED.media_duration, view_once = EXCLUDED.view_once,
+			staged_at = CURRENT_TIMESTAMP
+	`, conversationID, userID, attachment.MessageType, *sealed[0], sealed[1],
+		attachment.MediaSize, attachment.MediaDuration, attachment.ViewOnce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage attachment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(conversationID, userID)
+}
+
+// Unstage removes the attachment staged for the user's draft, keeping its text
+func (s *DraftService) Unstage(conversationID, userID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		DELETE FROM draft_attachments WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unstage attachment: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.db.Exec(`
+		UPDATE message_drafts SET updated_at = CURRENT_TIMESTAMP WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update draft: %w", err)
+	}
+	return nil
+}
+
+// Send turns the user's draft into a message and discards the draft in one transaction,
+// so it is sent once however often it is submitted. The staged attachment becomes the
+// message's media. With a hold window the message goes to the outbox as Hold puts it,
+// and pending is returned; otherwise it is created. content is the message's plain text.
+// prepare, when set, may change the message before it is stored; its error is returned
+// as it is and leaves the draft in place.
+func (s *DraftService) Send(conversationID, userID uuid.UUID, hold time.Duration, prepare func(*Message) error) (message *Message, content string, pending *PendingMessage, err error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer tx.Rollback()
+
+	draft, err := s.get(tx, conversationID, userID, " FOR UPDATE")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if strings.TrimSpace(draft.Content) == "" {
+		return nil, "", nil, ErrDraftEmpty
+	}
+
+	message = &Message{
+		ConversationID: conversationID,
+		SenderID:       userID,
+		ReplyToID:      draft.ReplyToID,
+		Content:        draft.Content,
+		MessageType:    string(TextMessage),
+	}
+	if attachment := draft.Attachment; attachment != nil {
+		message.MessageType = attachment.MessageType
+		message.MediaURL = &attachment.MediaURL
+		message.MediaThumbnailURL = attachment.MediaThumbnailURL
+		message.MediaSize = attachment.MediaSize
+		message.MediaDuration = attachment.MediaDuration
+		message.ViewOnce = attachment.ViewOnce
+	}
+	if prepare != nil {
+		if err := prepare(message); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	content = message.Content
+
+	_, err = tx.Exec(`DELETE FROM message_drafts WHERE conversation_id = $1 AND user_id = $2`, conversationID, userID)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to delete draft: %w", err)
+	}
+	messageService := NewMessageService(s.db, s.encryptor)
+	if hold > 0 {
+		if pending, err = messageService.hold(tx, message, hold); err != nil {
+			return nil, "", nil, err
+		}
+	} else if err = messageService.create(tx, message); err != nil {
+		return nil, "", nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", nil, err
+	}
+	return message, content, pending, nil
+}
+
+// PurgeStaged removes attachments staged for drafts nobody touched in ttl, and the
+// drafts of users who left their conversation, returning how many attachments were
+// removed
+func (s *DraftService) PurgeStaged(ttl time.Duration) (int64, error) {
+	result, err := s.db.Exec(`
+		DELETE FROM draft_attachments a
+		USING message_drafts d
+		WHERE d.conversation_id = a.conversation_id AND d.user_id = a.user_id
+			AND d.updated_at < $1
+	`, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge staged attachments: %w", err)
+	}
+	purged, _ := result.RowsAffected()
+
+	_, err = s.db.Exec(`
+		DELETE FROM message_drafts d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			WHERE cp.conversation_id = d.conversation_id AND cp.user_id = d.user_id
+		)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge drafts: %w", err)
+	}
+	return purged, nil
+}
+
+func (s *DraftService) requireParticipant(conversationID, userID uuid.UUID) error {
+	isParticipant, err := NewConversationService(s.db, s.encryptor).IsParticipant(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrInvalidParticipant
+	}
+	return nil
+}
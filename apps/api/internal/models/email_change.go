@@ -0,0 +1,113 @@
+package models
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailChange is a new email address waiting for the code sent to it
+type EmailChange struct {
+	ID        uuid.UUID `db:"id" json:"-"`
+	UserID    uuid.UUID `db:"user_id" json:"-"`
+	Email     string    `db:"email" json:"email"`
+	CodeHash  string    `db:"code_hash" json:"-"`
+	Attempts  int       `db:"attempts" json:"-"`
+	CreatedAt time.Time `db:"created_at" json:"-"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// RequestEmailChange holds email until the user confirms it with the returned code,
+// replacing any change they requested before
+func (s *UserService) RequestEmailChange(userID uuid.UUID, email string, ttl time.Duration) (*EmailChange, string, error) {
+	code, err := newChallengeCode()
+	if err != nil {
+		return nil, "", err
+	}
+	encryptedEmail, err := s.encryptor.EncryptString(email)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt email: %w", err)
+	}
+
+	change := &EmailChange{}
+	id := uuid.New()
+	err = s.db.Get(change, `
+		INSERT INTO email_changes (id, user_id, email, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET id = EXCLUDED.id, email = EXCLUDED.email, code_hash = EXCLUDED.code_hash,
+			attempts = 0, created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at
+		RETURNING *
+	`, id, userID, encryptedEmail, hashChallengeCode(id, code), time.Now().Add(ttl))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to request email change: %w", err)
+	}
+	change.Email = email
+	return change, code, nil
+}
+
+// ConfirmEmailChange applies the user's pending email change when code is right. Wrong
+// codes return ErrUnauthorized; missing, expired and exhausted changes return ErrNotFound.
+func (s *UserService) ConfirmEmailChange(userID uuid.UUID, code string) (*EmailChange, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	change := &EmailChange{}
+	err = tx.Get(change, `
+		SELECT * FROM email_changes
+		WHERE user_id = $1 AND expires_at > NOW() AND attempts < $2
+		FOR UPDATE
+	`, userID, maxChallengeAttempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email change: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashChallengeCode(change.ID, code)), []byte(change.CodeHash)) != 1 {
+		if _, err := tx.Exec(`UPDATE email_changes SET attempts = attempts + 1 WHERE id = $1`, change.ID); err != nil {
+			return nil, fmt.Errorf("failed to count attempt: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, ErrUnauthorized
+	}
+
+	// The address is already encrypted the way users' addresses are stored
+	email, err := s.encryptor.DecryptString(change.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE users SET email = $2, email_index = $3 WHERE id = $1
+	`, userID, change.Email, emailIndex(s.encryptor, email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM email_changes WHERE id = $1`, change.ID); err != nil {
+		return nil, fmt.Errorf("failed to end email change: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	change.Email = email
+	return change, nil
+}
+
+// PurgeExpiredEmailChanges removes email changes that were never confirmed
+func (s *UserService) PurgeExpiredEmailChanges() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM email_changes WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge email changes: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// emailIndexPurpose derives the key email addresses are indexed with
+const emailIndexPurpose = "talkify/email-index"
+
+// emailIndex returns the blind index of an email address. Addresses differing only in
+// case or surrounding spaces share it.
+func emailIndex(encryptor encryption.Encryptor, email string) string {
+	return encryptor.Derive(emailIndexPurpose).Index(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// EmailTaken reports whether an account uses email. Accounts whose index the background
+// fill hasn't reached yet are not found.
+func (s *UserService) EmailTaken(email string) (bool, error) {
+	var taken bool
+	err := s.db.Get(&taken, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email_index = $1)
+	`, emailIndex(s.encryptor, email))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up email: %w", err)
+	}
+	return taken, nil
+}
+
+// FillMissingEmailIndexes indexes the email addresses of users created before the
+// index, up to limit of them. It returns how many it indexed.
+func (s *UserService) FillMissingEmailIndexes(limit int) (int, error) {
+	var missing []struct {
+		ID    uuid.UUID `db:"id"`
+		Email string    `db:"email"`
+	}
+	err := s.db.Select(&missing, `
+		SELECT id, email FROM users
+		WHERE email_index IS NULL AND anonymized_at IS NULL
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unindexed emails: %w", err)
+	}
+
+	for i, user := range missing {
+		// An empty index matches no address and keeps the user from being retried
+		index := ""
+		email, err := s.encryptor.DecryptString(user.Email)
+		if err != nil {
+			logger.Warn("Failed to decrypt email for index", map[string]interface{}{
+				"user_id": user.ID,
+			})
+		} else if email != "" {
+			index = emailIndex(s.encryptor, email)
+		}
+		if _, err := s.db.Exec(`UPDATE users SET email_index = $2 WHERE id = $1`, user.ID, index); err != nil {
+			return i, fmt.Errorf("failed to index email: %w", err)
+		}
+	}
+	return len(missing), nil
+}
+
+// EmailIndexSample counts what SampleEmailIndexes found
+type EmailIndexSample struct {
+	Checked int
+	// Mismatched indexes don't match their decrypted email, as when the key was changed
+	// without reindexing
+	Mismatched int
+	// Unreadable emails can't be decrypted with the current key
+	Unreadable int
+}
+
+// SampleEmailIndexes recomputes the blind index of up to n random indexed users and
+// compares it with the stored one
+func (s *UserService) SampleEmailIndexes(n int) (EmailIndexSample, error) {
+	var sample EmailIndexSample
+	var users []struct {
+		Email string `db:"email"`
+		Index string `db:"email_index"`
+	}
+	err := s.db.Select(&users, `
+		SELECT email, email_index FROM users
+		WHERE email_index IS NOT NULL AND email_index != '' AND anonymized_at IS NULL
+		ORDER BY random()
+		LIMIT $1
+	`, n)
+	if err != nil {
+		return sample, fmt.Errorf("failed to sample email indexes: %w", err)
+	}
+
+	for _, user := range users {
+		sample.Checked++
+		email, err := s.encryptor.DecryptString(user.Email)
+		if err != nil {
+			sample.Unreadable++
+			continue
+		}
+		if emailIndex(s.encryptor, email) != user.Index {
+			sample.Mismatched++
+		}
+	}
+	return sample, nil
+}
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// embedKeyPrefix starts every embed key, so that leaked keys are easy to recognize
+	embedKeyPrefix = "tke_"
+	// maxEmbedKeys bounds the live embed keys of a conversation
+	maxEmbedKeys = 20
+	// maxEmbedDomains bounds the domains a key can be restricted to
+	maxEmbedDomains = 20
+	// DefaultEmbedRequestsPerMinute and MaxEmbedRequestsPerMinute bound how often a key
+	// may be used
+	DefaultEmbedRequestsPerMinute = 60
+	MaxEmbedRequestsPerMinute     = 600
+	// MaxEmbedMessages is the most messages an embed feed returns at once
+	MaxEmbedMessages = 100
+)
+
+var (
+	// ErrEmbedKeyNotFound is returned for keys that don't exist or were revoked
+	ErrEmbedKeyNotFound = errors.New("embed key not found")
+	// ErrEmbedKeyLimit is returned when a conversation has as many live keys as allowed
+	ErrEmbedKeyLimit = errors.New("embed key limit reached")
+)
+
+// embedDomainPattern matches a host name, optionally with a leading *. for any of its
+// subdomains
+var embedDomainPattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// EmbedKey grants read-only access to the messages of a single conversation, for
+// embedding a live feed on a website or status screen
+type EmbedKey struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	CreatedBy      *uuid.UUID `db:"created_by" json:"created_by,omitempty"`
+	Name           string     `db:"name" json:"name"`
+	KeyHash        string     `db:"key_hash" json:"-"`
+	// Prefix is the start of the key, to tell keys apart
+	Prefix string `db:"key_prefix" json:"prefix" example:"tke_3q2x"`
+	// AllowedDomains are the sites whose pages may use the key; any site when empty
+	AllowedDomains    pq.StringArray `db:"allowed_domains" json:"allowed_domains"`
+	RequestsPerMinute int            `db:"requests_per_minute" json:"requests_per_minute"`
+	CreatedAt         time.Time      `db:"created_at" json:"created_at"`
+	LastUsedAt        *time.Time     `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt         *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+	// ConversationName is only loaded by Authenticate
+	ConversationName *string `db:"conversation_name" json:"-"`
+}
+
+// AllowsHost reports whether a page on host may use the key. A domain allows itself and,
+// written as *.example.com, its subdomains.
+func (k *EmbedKey) AllowsHost(host string) bool {
+	if len(k.AllowedDomains) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, domain := range k.AllowedDomains {
+		if parent, ok := strings.CutPrefix(domain, "*."); ok {
+			if strings.HasSuffix(host, "."+parent) {
+				return true
+			}
+			continue
+		}
+		if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbedKeyInput is what an embed key is created with
+type EmbedKeyInput struct {
+	Name              string
+	AllowedDomains    []string
+	RequestsPerMinute int
+}
+
+// EmbedMessage is a message as an embedded feed shows it
+type EmbedMessage struct {
+	ID             uuid.UUID `db:"id" json:"id"`
+	SenderUsername string    `db:"sender_username" json:"sender_username"`
+	Content        string    `db:"content" json:"content"`
+	MessageType    string    `db:"message_type" json:"type"`
+	IsEdited       bool      `db:"is_edited" json:"is_edited"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+// EmbedKeyService manages embed keys and serves the feeds they grant
+type EmbedKeyService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewEmbedKeyService creates a new embed key service
+func NewEmbedKeyService(db *sqlx.DB, encryptor encryption.Encryptor) *EmbedKeyService {
+	return &EmbedKeyService{db: db, encryptor: encryptor}
+}
+
+// List returns the keys of a group, revoked ones included, newest first. Only the owner
+// can see them.
+func (s *EmbedKeyService) List(conversationID, userID uuid.UUID) ([]EmbedKey, error) {
+	if err := requireGroupOwner(s.db, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	keys := []EmbedKey{}
+	err := s.db.Select(&keys, `
+		SELECT * FROM embed_keys
+		WHERE conversation_id = $1
+		ORDER BY created_at DESC
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embed keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Create issues a key to a group's feed and returns it with the key itself, which isn't
+// kept and can't be shown again. Only the owner can create keys.
+func (s *EmbedKeyService) Create(conversationID, userID uuid.UUID, input *EmbedKeyInput) (*EmbedKey, string, error) {
+	domains, err := normalizeEmbedDomains(input.AllowedDomains)
+	if err != nil {
+		return nil, "", err
+	}
+	rate := input.RequestsPerMinute
+	if rate == 0 {
+		rate = DefaultEmbedRequestsPerMinute
+	}
+	if rate < 1 || rate > MaxEmbedRequestsPerMinute {
+		return nil, "", fmt.Errorf("%w: requests_per_minute must be between 1 and %d", ErrInvalidInput, MaxEmbedRequestsPerMinute)
+	}
+	if err := requireGroupOwner(s.db, conversationID, userID); err != nil {
+		return nil, "", err
+	}
+
+	var count int
+	err = s.db.Get(&count, `
+		SELECT COUNT(*) FROM embed_keys WHERE conversation_id = $1 AND revoked_at IS NULL
+	`, conversationID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count embed keys: %w", err)
+	}
+	if count >= maxEmbedKeys {
+		return nil, "", ErrEmbedKeyLimit
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := embedKeyPrefix + secret
+
+	created := &EmbedKey{}
+	err = s.db.Get(created, `
+		INSERT INTO embed_keys (conversation_id, created_by, name, key_hash, key_prefix, allowed_domains, requests_per_minute)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *
+	`, conversationID, userID, input.Name, hashToken(key), key[:len(embedKeyPrefix)+4], pq.StringArray(domains), rate)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create embed key: %w", err)
+	}
+	return created, key, nil
+}
+
+// Revoke stops a key from working. Only the owner can revoke keys.
+func (s *EmbedKeyService) Revoke(conversationID, keyID, userID uuid.UUID) error {
+	if err := requireGroupOwner(s.db, conversationID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE embed_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND conversation_id = $2 AND revoked_at IS NULL
+	`, keyID, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke embed key: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrEmbedKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the live key matching key, of a conversation that wasn't
+// deleted, and notes that it was used
+func (s *EmbedKeyService) Authenticate(key string) (*EmbedKey, error) {
+	if !strings.HasPrefix(key, embedKeyPrefix) {
+		return nil, ErrEmbedKeyNotFound
+	}
+
+	embedKey := &EmbedKey{}
+	err := s.db.Get(embedKey, `
+		SELECT ek.*, c.name AS conversation_name FROM embed_keys ek
+		JOIN conversations c ON c.id = ek.conversation_id AND c.deleted_at IS NULL
+		WHERE ek.key_hash = $1 AND ek.revoked_at IS NULL
+	`, hashToken(key))
+	if err == sql.ErrNoRows {
+		return nil, ErrEmbedKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embed key: %w", err)
+	}
+
+	// Uses are noted once a minute at most, which is all last_used_at needs
+	_, err = s.db.Exec(`
+		UPDATE embed_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`, embedKey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to note embed key use: %w", err)
+	}
+	return embedKey, nil
+}
+
+// Messages returns up to limit messages of the key's conversation, oldest first: those
+// after the message after, or the latest ones without it. Deleted and view-once messages
+// are left out.
+func (s *EmbedKeyService) Messages(key *EmbedKey, after *uuid.UUID, limit int) ([]EmbedMessage, error) {
+	messages := []EmbedMessage{}
+	var err error
+	if after != nil {
+		err = s.db.Select(&messages, `
+			SELECT m.id, `+displayedUsername+` AS sender_username, m.content, m.message_type, m.is_edited, m.created_at
+			FROM messages m
+			JOIN users u ON u.id = m.sender_id
+			JOIN messages since ON since.id = $2 AND since.conversation_id = m.conversation_id
+			WHERE m.conversation_id = $1 AND NOT m.is_deleted AND NOT m.view_once
+				AND (m.created_at, m.id) > (since.created_at, since.id)
+			ORDER BY m.created_at, m.id
+			LIMIT $3
+		`, key.ConversationID, *after, limit)
+	} else {
+		err = s.db.Select(&messages, `
+			SELECT * FROM (
+				SELECT m.id, `+displayedUsername+` AS sender_username, m.content, m.message_type, m.is_edited, m.created_at
+				FROM messages m
+				JOIN users u ON u.id = m.sender_id
+				WHERE m.conversation_id = $1 AND NOT m.is_deleted AND NOT m.view_once
+				ORDER BY m.created_at DESC, m.id DESC
+				LIMIT $2
+			) latest
+			ORDER BY created_at, id
+		`, key.ConversationID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embed messages: %w", err)
+	}
+
+	for i := range messages {
+		content, err := s.encryptor.DecryptString(messages[i].Content)
+		if err != nil {
+			return nil, err
+		}
+		messages[i].Content = content
+	}
+	return messages, nil
+}
+
+// normalizeEmbedDomains lowercases the domains a key is restricted to, dropping
+// duplicates, and rejects those that aren't host names
+func normalizeEmbedDomains(domains []string) ([]string, error) {
+	if len(domains) > maxEmbedDomains {
+		return nil, fmt.Errorf("%w: a key can be restricted to at most %d domains", ErrInvalidInput, maxEmbedDomains)
+	}
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if len(domain) > 253 || !embedDomainPattern.MatchString(domain) {
+			return nil, fmt.Errorf("%w: %q is not a domain, such as example.com or *.example.com", ErrInvalidInput, domain)
+		}
+		if !contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized, nil
+}
+
+// requireGroupOwner returns ErrNotOwner unless userID owns the group; see groupRole
+func requireGroupOwner(db sqlx.Queryer, conversationID, userID uuid.UUID) error {
+	role, err := groupRole(db, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return ErrNotOwner
+	}
+	return nil
+}
@@ -11,4 +11,10 @@ var (
 	ErrUnauthorized = errors.New("invalid credentials")
 	// ErrConflict is returned when there is a conflict with existing data
 	ErrConflict = errors.New("conflict with existing data")
+	// ErrQuotaExceeded is returned when an action would exceed the user's quota
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrMediaTooLarge is returned when a single media item exceeds the size limit
+	ErrMediaTooLarge = errors.New("media too large")
+	// ErrRecoveryNotReady is returned when a recovery request lacks approvals or is still in its delay
+	ErrRecoveryNotReady = errors.New("recovery request is not ready")
 )
@@ -0,0 +1,4 @@
+package models
+
+// ConversationMessagesQuery lets the tests explain the query GetConversationMessages runs
+var ConversationMessagesQuery = conversationMessagesQuery
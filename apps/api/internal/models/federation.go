@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Directions of federated messages
+const (
+	FederatedOutgoing = "outgoing"
+	FederatedIncoming = "incoming"
+)
+
+// MaxFederationAttempts is how many times an outgoing message is offered to its peer
+// before it is given up on
+const MaxFederationAttempts = 10
+
+// federationClaim keeps a claimed delivery from being claimed again while it is tried
+const federationClaim = 5 * time.Minute
+
+// OutgoingFederatedMessage is a direct message waiting to be delivered to the
+// deployment of its recipient
+type OutgoingFederatedMessage struct {
+	MessageID      uuid.UUID `db:"message_id"`
+	ConversationID uuid.UUID `db:"conversation_id"`
+	Peer           string    `db:"peer"`
+	Attempts       int       `db:"attempts"`
+	SenderID       uuid.UUID `db:"sender_id"`
+	SenderUsername string    `db:"sender_username"`
+	RecipientID    uuid.UUID `db:"recipient_id"`
+	// RecipientAddress is the recipient's federated address
+	RecipientAddress string    `db:"recipient_address"`
+	Content          string    `db:"content"`
+	SentAt           time.Time `db:"created_at"`
+}
+
+// FederationService keeps the shadow accounts of other deployments' users and the
+// direct messages exchanged with them
+type FederationService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewFederationService creates a new federation service
+func NewFederationService(db *sqlx.DB, encryptor encryption.Encryptor) *FederationService {
+	return &FederationService{db: db, encryptor: encryptor}
+}
+
+// EnsureShadowUser returns the shadow account of the user of another deployment at
+// address, creating it on first contact. It is named by the address, and nobody can
+// sign in to it. ErrConflict is returned when a local account already has that name.
+func (s *FederationService) EnsureShadowUser(address string, remoteUserID uuid.UUID) (*User, error) {
+	empty, err := s.encryptor.EncryptString("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt contact details: %w", err)
+	}
+
+	user := &User{}
+	err = s.db.Get(user, `
+		INSERT INTO users (username, email, phone, password_hash, status, federated_address, federated_user_id)
+		VALUES ($1, $2, $2, '!', '', $1, $3)
+		ON CONFLICT (federated_address) DO UPDATE
+		SET federated_user_id = EXCLUDED.federated_user_id, updated_at = CURRENT_TIMESTAMP
+		RETURNING *
+	`, address, empty, remoteUserID)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: a local account is named %s", ErrConflict, address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shadow account: %w", err)
+	}
+	user.Email, user.Phone = "", ""
+	return user, nil
+}
+
+// FederatedPeer returns the shadow account on the other side of a direct conversation,
+// or nil when the conversation isn't with a user of another deployment
+func (s *FederationService) FederatedPeer(conversationID, userID uuid.UUID) (*User, error) {
+	user := &User{}
+	err := s.db.Get(user, `
+		SELECT u.* FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id != $2
+		JOIN users u ON u.id = cp.user_id AND u.federated_address IS NOT NULL
+		WHERE c.id = $1 AND c.type = 'direct' AND c.deleted_at IS NULL
+		LIMIT 1
+	`, conversationID, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get federated peer: %w", err)
+	}
+	return user, nil
+}
+
+// QueueOutgoing queues a message for delivery to peer
+func (s *FederationService) QueueOutgoing(messageID uuid.UUID, peer string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO federated_messages (message_id, peer, envelope_id, direction)
+		VALUES ($1, $2, $1, '`+FederatedOutgoing+`')
+		ON CONFLICT DO NOTHING
+	`, messageID, peer)
+	if err != nil {
+		return fmt.Errorf("failed to queue federated message: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutgoing claims up to limit outgoing messages that are due, or the one message
+// given by messageID, with their content decrypted. Claimed messages aren't claimed
+// again for a few minutes, so a delivery that dies midway is retried later.
+func (s *FederationService) ClaimOutgoing(messageID *uuid.UUID, limit int) ([]OutgoingFederatedMessage, error) {
+	due := []OutgoingFederatedMessage{}
+	err := s.db.Select(&due, `
+		WITH claimed AS (
+			UPDATE federated_messages
+			SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+			WHERE message_id IN (
+				SELECT message_id FROM federated_messages
+				WHERE direction = '`+FederatedOutgoing+`' AND status = 'pending'
+				  AND next_attempt_at <= CURRENT_TIMESTAMP
+				  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.id = message_id AND m.is_deleted)
+				  AND ($1::uuid IS NULL OR message_id = $1)
+				ORDER BY next_attempt_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING message_id, peer, attempts
+		)
+		SELECT cl.message_id, cl.peer, cl.attempts, m.conversation_id, m.sender_id, m.content, m.created_at,
+			su.username AS sender_username, ru.id AS recipient_id, ru.federated_address AS recipient_address
+		FROM claimed cl
+		JOIN messages m ON m.id = cl.message_id
+		JOIN users su ON su.id = m.sender_id
+		JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id != m.sender_id
+		JOIN users ru ON ru.id = cp.user_id AND ru.federated_address IS NOT NULL
+	`, messageID, limit, federationClaim.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim federated messages: %w", err)
+	}
+	for i := range due {
+		content, err := s.encryptor.DecryptString(due[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt message: %w", err)
+		}
+		due[i].Content = content
+	}
+	return due, nil
+}
+
+// MarkDelivered records that the peer acknowledged an outgoing message
+func (s *FederationService) MarkDelivered(messageID uuid.UUID, deliveredAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE federated_messages
+		SET status = 'delivered', attempts = attempts + 1, delivered_at = $2, last_error = NULL
+		WHERE message_id = $1 AND direction = '`+FederatedOutgoing+`'
+	`, messageID, deliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark federated message delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkAttemptFailed records a failed delivery. The next attempt backs off
+// exponentially, from a minute up to six hours, and the message is given up on after
+// MaxFederationAttempts.
+func (s *FederationService) MarkAttemptFailed(messageID uuid.UUID, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE federated_messages
+		SET attempts = attempts + 1, last_error = $2,
+			status = CASE WHEN attempts + 1 >= $3 THEN 'failed' ELSE status END,
+			next_attempt_at = CURRENT_TIMESTAMP + LEAST(make_interval(mins => 1 << LEAST(attempts, 9)), INTERVAL '6 hours')
+		WHERE message_id = $1 AND direction = '`+FederatedOutgoing+`'
+	`, messageID, reason, MaxFederationAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to record federated delivery attempt: %w", err)
+	}
+	return nil
+}
+
+// StoreIncoming stores a message delivered by peer as the envelope envelopeID. An
+// envelope delivered before isn't stored again; the message stored for it then is
+// returned with duplicate set. message.Content is encrypted in place, as by Create.
+func (s *FederationService) StoreIncoming(peer string, envelopeID uuid.UUID, message *Message) (stored *Message, duplicate bool, err error) {
+	existing, err := s.incoming(peer, envelopeID)
+	if err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	if err := NewMessageService(s.db, s.encryptor).create(tx, message); err != nil {
+		return nil, false, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO federated_messages (message_id, peer, envelope_id, direction, status, attempts, delivered_at)
+		VALUES ($1, $2, $3, '`+FederatedIncoming+`', 'delivered', 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (peer, envelope_id, direction) DO NOTHING
+	`, message.ID, peer, envelopeID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record federated message: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Delivered concurrently; the message stored then stands
+		tx.Rollback()
+		existing, err := s.incoming(peer, envelopeID)
+		return existing, existing != nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return message, false, nil
+}
+
+// incoming returns the message stored for an envelope peer delivered, or nil
+func (s *FederationService) incoming(peer string, envelopeID uuid.UUID) (*Message, error) {
+	message := &Message{}
+	err := s.db.Get(message, `
+		SELECT m.id, m.conversation_id, m.sender_id, m.created_at FROM federated_messages fm
+		JOIN messages m ON m.id = fm.message_id
+		WHERE fm.peer = $1 AND fm.envelope_id = $2 AND fm.direction = '`+FederatedIncoming+`'
+	`, peer, envelopeID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check federated message: %w", err)
+	}
+	return message, nil
+}
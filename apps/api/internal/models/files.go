@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Orders for listing conversation files
+const (
+	FileSortDate = "date"
+	FileSortName = "name"
+	FileSortSize = "size"
+)
+
+// File archive statuses
+const (
+	ArchivePending = "pending"
+	ArchiveReady   = "ready"
+	ArchiveFailed  = "failed"
+)
+
+// ConversationFile is a file attached to a message
+type ConversationFile struct {
+	MessageID        uuid.UUID `db:"id" json:"message_id"`
+	Name             string    `db:"-" json:"name"`
+	Size             *int64    `db:"media_size" json:"size,omitempty"`
+	UploaderID       uuid.UUID `db:"sender_id" json:"uploader_id"`
+	UploaderUsername string    `db:"sender_username" json:"uploader_username"`
+	// URL serves the file through the API; see GET /api/media/:id
+	URL            string    `db:"-" json:"url"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	Content        string    `db:"content" json:"-"`
+	MediaURL       string    `db:"media_url" json:"-"`
+	MediaEncrypted bool      `db:"media_encrypted" json:"-"`
+}
+
+// GetConversationFiles returns the files of a conversation the user can see. Names
+// are stored encrypted, so sorting happens here rather than in the database.
+func (s *MessageService) GetConversationFiles(conversationID, userID uuid.UUID, sortBy string, descending bool) ([]ConversationFile, error) {
+	files := []ConversationFile{}
+	err := s.db.Select(&files, `
+		SELECT m.id, m.media_size, m.sender_id, `+displayedUsername+` AS sender_username,
+			m.created_at, m.content, m.media_url, m.media_encrypted
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+		WHERE m.conversation_id = $1 AND m.message_type = 'file'
+			AND m.media_url IS NOT NULL AND NOT m.is_deleted
+			AND `+visibleHistory("$2")+`
+	`, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	for i := range files {
+		file := &files[i]
+		content, err := s.encryptor.DecryptString(file.Content)
+		if err != nil {
+			return nil, err
+		}
+		file.Content = content
+		if file.MediaEncrypted {
+			if file.MediaURL, err = decryptMediaURL(s.encryptor, file.MediaURL); err != nil {
+				return nil, err
+			}
+		}
+		file.Name = fileName(file.Content, file.MediaURL)
+		file.URL = "/api/media/" + file.MessageID.String()
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := &files[i], &files[j]
+		if descending {
+			a, b = b, a
+		}
+		switch sortBy {
+		case FileSortName:
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case FileSortSize:
+			return sizeOf(a) < sizeOf(b)
+		default:
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	})
+	return files, nil
+}
+
+// fileName is the caption a file was sent with, or the last part of its URL
+func fileName(content, mediaURL string) string {
+	if name := strings.TrimSpace(content); name != "" {
+		return name
+	}
+	if u, err := url.Parse(mediaURL); err == nil {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			return name
+		}
+	}
+	return "file"
+}
+
+func sizeOf(file *ConversationFile) int64 {
+	if file.Size == nil {
+		return 0
+	}
+	return *file.Size
+}
+
+// FileArchive is a zip of a conversation's files built in the background for one user
+type FileArchive struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	RequestedBy    uuid.UUID  `db:"requested_by" json:"requested_by"`
+	Status         string     `db:"status" json:"status"`
+	FileCount      int        `db:"file_count" json:"file_count"`
+	SkippedCount   int        `db:"skipped_count" json:"skipped_count"`
+	SizeBytes      int64      `db:"size_bytes" json:"size_bytes"`
+	Error          *string    `db:"error" json:"error,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	CompletedAt    *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `db:"expires_at" json:"expires_at"`
+	// DataKey is the archive's encryption key, wrapped with the master key named by KeyID
+	DataKey *string `db:"data_key" json:"-"`
+	KeyID   *string `db:"key_id" json:"-"`
+}
+
+// FileArchiveService tracks file archives
+type FileArchiveService struct {
+	db *sqlx.DB
+}
+
+// NewFileArchiveService creates a new file archive service
+func NewFileArchiveService(db *sqlx.DB) *FileArchiveService {
+	return &FileArchiveService{db: db}
+}
+
+// Create records a new pending archive, or returns the user's archive of the
+// conversation that is still being built. Archives pending for over an hour were lost
+// to a restart and are not reused.
+func (s *FileArchiveService) Create(conversationID, userID uuid.UUID, ttl time.Duration) (archive *FileArchive, created bool, err error) {
+	archive = &FileArchive{}
+	err = s.db.Get(archive, `
+		SELECT * FROM file_archives
+		WHERE conversation_id = $1 AND requested_by = $2 AND status = 'pending'
+			AND created_at > NOW() - INTERVAL '1 hour'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, conversationID, userID)
+	if err == nil {
+		return archive, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to get archive: %w", err)
+	}
+
+	err = s.db.Get(archive, `
+		INSERT INTO file_archives (conversation_id, requested_by, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING *
+	`, conversationID, userID, time.Now().Add(ttl))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create archive: %w", err)
+	}
+	return archive, true, nil
+}
+
+// Get returns an archive of a conversation
+func (s *FileArchiveService) Get(conversationID, archiveID uuid.UUID) (*FileArchive, error) {
+	archive := &FileArchive{}
+	err := s.db.Get(archive, `
+		SELECT * FROM file_archives
+		WHERE id = $1 AND conversation_id = $2 AND expires_at > NOW()
+	`, archiveID, conversationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archive: %w", err)
+	}
+	return archive, nil
+}
+
+// Complete marks an archive ready for download, recording its contents and key
+func (s *FileArchiveService) Complete(archive *FileArchive) error {
+	_, err := s.db.Exec(`
+		UPDATE file_archives
+		SET status = 'ready', file_count = $2, skipped_count = $3, size_bytes = $4,
+			data_key = $5, key_id = $6, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, archive.ID, archive.FileCount, archive.SkippedCount, archive.SizeBytes, archive.DataKey, archive.KeyID)
+	if err != nil {
+		return fmt.Errorf("failed to complete archive: %w", err)
+	}
+	return nil
+}
+
+// Fail marks an archive as failed with a reason the user can see
+func (s *FileArchiveService) Fail(archiveID uuid.UUID, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE file_archives
+		SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, archiveID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark archive failed: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired removes expired archives and returns their IDs so their files can be
+// deleted
+func (s *FileArchiveService) PurgeExpired() ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `DELETE FROM file_archives WHERE expires_at <= NOW() RETURNING id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge archives: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"talkify/apps/api/internal/groupname"
+
+	"github.com/google/uuid"
+)
+
+// GroupNameSample is the sample of participants a conversation summary keeps for
+// naming groups without a name of their own; see groupname
+type GroupNameSample []groupname.Member
+
+func (s *GroupNameSample) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		*s = GroupNameSample{}
+		return nil
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// Unnamed reports whether the conversation is a group the API names after its
+// participants
+func (c *Conversation) Unnamed() bool {
+	return c.Type == "group" && (c.Name == nil || *c.Name == "")
+}
+
+// GroupNameSource is what names a group without a name of its own
+type GroupNameSource struct {
+	Sample           GroupNameSample `db:"name_sample"`
+	ParticipantCount int             `db:"participant_count"`
+}
+
+// GetGroupNameSource returns the sample and participant count of a conversation
+func (s *ConversationService) GetGroupNameSource(conversationID uuid.UUID) (*GroupNameSource, error) {
+	source := &GroupNameSource{}
+	err := s.db.Get(source, `
+		SELECT name_sample, participant_count FROM conversation_summaries WHERE conversation_id = $1
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group name sample: %w", err)
+	}
+	return source, nil
+}
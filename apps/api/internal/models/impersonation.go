@@ -0,0 +1,271 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Impersonation modes
+const (
+	ImpersonationFull     = "full"
+	ImpersonationReadOnly = "read_only"
+)
+
+// Impersonation statuses. Pending and approved impersonations past their expiry are
+// listed as expired.
+const (
+	ImpersonationPending  = "pending"
+	ImpersonationApproved = "approved"
+	ImpersonationDenied   = "denied"
+	ImpersonationEnded    = "ended"
+	ImpersonationExpired  = "expired"
+)
+
+// ImpersonationRequestTTL is how long a request waits for a decision
+const ImpersonationRequestTTL = 24 * time.Hour
+
+var (
+	// ErrCannotImpersonate is returned for users that can't be impersonated: oneself,
+	// administrators, system accounts and inactive users
+	ErrCannotImpersonate = errors.New("user cannot be impersonated")
+	// ErrImpersonationNotPending is returned when deciding a request already decided,
+	// ended or expired
+	ErrImpersonationNotPending = errors.New("impersonation is no longer pending")
+	// ErrImpersonationInactive is returned for impersonations that are not approved or
+	// have ended or expired
+	ErrImpersonationInactive = errors.New("impersonation is not active")
+	// ErrSelfApproval is returned when an administrator approves their own break-glass request
+	ErrSelfApproval = errors.New("break-glass impersonations need another administrator's approval")
+)
+
+// Impersonation is an administrator's request to act as a user for support. The user
+// consents to it, or, break-glass, another administrator approves it. Once approved it
+// lasts DurationSeconds.
+type Impersonation struct {
+	ID         uuid.UUID `db:"id" json:"id"`
+	AdminID    uuid.UUID `db:"admin_id" json:"admin_id"`
+	UserID     uuid.UUID `db:"user_id" json:"user_id"`
+	Mode       string    `db:"mode" json:"mode" example:"read_only"`
+	Reason     string    `db:"reason" json:"reason"`
+	BreakGlass bool      `db:"break_glass" json:"break_glass"`
+	// DurationSeconds is how long the impersonation lasts once approved
+	DurationSeconds int        `db:"duration_seconds" json:"duration_seconds" example:"1800"`
+	Status          string     `db:"status" json:"status" example:"pending"`
+	DecidedBy       *uuid.UUID `db:"decided_by" json:"decided_by,omitempty"`
+	DecidedAt       *time.Time `db:"decided_at" json:"decided_at,omitempty"`
+	// ExpiresAt is when a pending request lapses, or when an approved impersonation ends
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	EndedBy   *uuid.UUID `db:"ended_by" json:"ended_by,omitempty"`
+	EndedAt   *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// impersonationColumns are the columns scanned into an Impersonation, with lapsed
+// requests and impersonations marked expired
+const impersonationColumns = `id, admin_id, user_id, mode, reason, break_glass, duration_seconds,
+	CASE WHEN status IN ('pending', 'approved') AND expires_at <= NOW() THEN 'expired' ELSE status END AS status,
+	decided_by, decided_at, expires_at, ended_by, ended_at, created_at`
+
+// ImpersonationService handles administrators' impersonation of users
+type ImpersonationService struct {
+	db *sqlx.DB
+}
+
+// NewImpersonationService creates a new impersonation service
+func NewImpersonationService(db *sqlx.DB) *ImpersonationService {
+	return &ImpersonationService{db: db}
+}
+
+// Request asks to impersonate userID for duration. An administrator can only have one
+// pending or active impersonation of a user at a time.
+func (s *ImpersonationService) Request(adminID, userID uuid.UUID, mode, reason string, duration time.Duration, breakGlass bool) (*Impersonation, error) {
+	var target struct {
+		IsAdmin  bool `db:"is_admin"`
+		IsSystem bool `db:"is_system"`
+		IsActive bool `db:"is_active"`
+	}
+	err := s.db.Get(&target, `
+		SELECT is_admin, is_system, is_active FROM users
+		WHERE id = $1 AND anonymized_at IS NULL
+	`, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if userID == adminID || target.IsAdmin || target.IsSystem || !target.IsActive {
+		return nil, ErrCannotImpersonate
+	}
+
+	var open bool
+	err = s.db.Get(&open, `
+		SELECT EXISTS (
+			SELECT 1 FROM impersonations
+			WHERE admin_id = $1 AND user_id = $2
+				AND status IN ('pending', 'approved') AND expires_at > NOW()
+		)
+	`, adminID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check impersonations: %w", err)
+	}
+	if open {
+		return nil, ErrConflict
+	}
+
+	impersonation := &Impersonation{}
+	err = s.db.Get(impersonation, `
+		INSERT INTO impersonations (admin_id, user_id, mode, reason, break_glass, duration_seconds, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+impersonationColumns,
+		adminID, userID, mode, reason, breakGlass, int(duration.Seconds()), time.Now().Add(ImpersonationRequestTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to request impersonation: %w", err)
+	}
+	return impersonation, nil
+}
+
+// Get returns an impersonation
+func (s *ImpersonationService) Get(id uuid.UUID) (*Impersonation, error) {
+	impersonation := &Impersonation{}
+	err := s.db.Get(impersonation, `SELECT `+impersonationColumns+` FROM impersonations WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	return impersonation, nil
+}
+
+// List returns the latest impersonations, newest first, of every administrator and
+// user, or only of userID when it is set
+func (s *ImpersonationService) List(userID *uuid.UUID, limit int) ([]Impersonation, error) {
+	impersonations := []Impersonation{}
+	err := s.db.Select(&impersonations, `
+		SELECT `+impersonationColumns+` FROM impersonations
+		WHERE $1::uuid IS NULL OR user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list impersonations: %w", err)
+	}
+	return impersonations, nil
+}
+
+// DecideAsUser gives or refuses a user's consent to a request to impersonate them.
+// Break-glass requests are decided by administrators.
+func (s *ImpersonationService) DecideAsUser(userID, id uuid.UUID, approve bool) (*Impersonation, error) {
+	return s.decide(id, userID, approve, func(i *Impersonation) error {
+		if i.UserID != userID || i.BreakGlass {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// DecideAsAdmin approves or denies a break-glass request of another administrator
+func (s *ImpersonationService) DecideAsAdmin(adminID, id uuid.UUID, approve bool) (*Impersonation, error) {
+	return s.decide(id, adminID, approve, func(i *Impersonation) error {
+		if !i.BreakGlass {
+			return ErrNotFound
+		}
+		if i.AdminID == adminID {
+			return ErrSelfApproval
+		}
+		return nil
+	})
+}
+
+func (s *ImpersonationService) decide(id, deciderID uuid.UUID, approve bool, allowed func(*Impersonation) error) (*Impersonation, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	impersonation := &Impersonation{}
+	err = tx.Get(impersonation, `SELECT `+impersonationColumns+` FROM impersonations WHERE id = $1 FOR UPDATE`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	if err := allowed(impersonation); err != nil {
+		return nil, err
+	}
+	if impersonation.Status != ImpersonationPending {
+		return nil, ErrImpersonationNotPending
+	}
+
+	// Approved impersonations last their duration from the approval
+	status, expiresAt := ImpersonationDenied, impersonation.ExpiresAt
+	if approve {
+		status = ImpersonationApproved
+		expiresAt = time.Now().Add(time.Duration(impersonation.DurationSeconds) * time.Second)
+	}
+	err = tx.Get(impersonation, `
+		UPDATE impersonations
+		SET status = $2, decided_by = $3, decided_at = CURRENT_TIMESTAMP, expires_at = $4
+		WHERE id = $1
+		RETURNING `+impersonationColumns,
+		id, status, deciderID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide impersonation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return impersonation, nil
+}
+
+// Active returns an impersonation that is approved and hasn't ended or expired, or
+// ErrImpersonationInactive
+func (s *ImpersonationService) Active(id uuid.UUID) (*Impersonation, error) {
+	impersonation, err := s.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrImpersonationInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.Status != ImpersonationApproved {
+		return nil, ErrImpersonationInactive
+	}
+	return impersonation, nil
+}
+
+// End ends a pending or active impersonation. The impersonated user can end theirs;
+// with byUser false, any administrator can end any.
+func (s *ImpersonationService) End(actorID, id uuid.UUID, byUser bool) (*Impersonation, error) {
+	impersonation := &Impersonation{}
+	err := s.db.Get(impersonation, `
+		UPDATE impersonations
+		SET status = 'ended', ended_by = $2, ended_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (NOT $3 OR user_id = $2)
+			AND status IN ('pending', 'approved') AND expires_at > NOW()
+		RETURNING `+impersonationColumns,
+		id, actorID, byUser)
+	if err == sql.ErrNoRows {
+		// Tell impersonations that aren't there from ones already over
+		current, getErr := s.Get(id)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if byUser && current.UserID != actorID {
+			return nil, ErrNotFound
+		}
+		return nil, ErrImpersonationInactive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	return impersonation, nil
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Steps of the inactive account policy
+const (
+	InactiveWarn       = "warn"
+	InactiveDeactivate = "deactivate"
+	InactiveAnonymize  = "anonymize"
+)
+
+// lastActive is when a user was last seen, or signed up if they never were
+const lastActive = "COALESCE(last_seen, created_at)"
+
+// inactiveColumns are the columns scanned into an InactiveUser
+const inactiveColumns = `id, username, email, ` + lastActive + ` AS last_active_at,
+	inactivity_warned_at, deactivated_at, legal_hold`
+
+// InactivityPolicy is how long users may be inactive before each step. A zero
+// AnonymizeAfter keeps deactivated accounts.
+type InactivityPolicy struct {
+	WarnAfter       time.Duration
+	DeactivateAfter time.Duration
+	AnonymizeAfter  time.Duration
+}
+
+// InactiveUser is a user the inactive account policy acts on
+type InactiveUser struct {
+	ID            uuid.UUID  `db:"id" json:"user_id"`
+	Username      string     `db:"username" json:"username"`
+	Email         string     `db:"email" json:"-"`
+	LastActiveAt  time.Time  `db:"last_active_at" json:"last_active_at"`
+	WarnedAt      *time.Time `db:"inactivity_warned_at" json:"warned_at,omitempty"`
+	DeactivatedAt *time.Time `db:"deactivated_at" json:"deactivated_at,omitempty"`
+	LegalHold     bool       `db:"legal_hold" json:"legal_hold"`
+	// Action is the next step for the user and DueAt when it is taken. Users on legal
+	// hold are listed but skipped.
+	Action string    `db:"-" json:"action"`
+	DueAt  time.Time `db:"-" json:"due_at"`
+}
+
+// warned reports whether the user was warned since they were last active
+func (u *InactiveUser) warned() bool {
+	return u.WarnedAt != nil && !u.WarnedAt.Before(u.LastActiveAt)
+}
+
+// next sets the user's next step and when it is due. It returns false when the
+// policy takes no further step.
+func (p InactivityPolicy) next(u *InactiveUser) bool {
+	switch {
+	case u.DeactivatedAt != nil:
+		if p.AnonymizeAfter <= 0 {
+			return false
+		}
+		u.Action = InactiveAnonymize
+		u.DueAt = u.LastActiveAt.Add(p.AnonymizeAfter)
+	case u.warned():
+		// Warned users always get the full notice period, however late the warning went out
+		u.Action = InactiveDeactivate
+		u.DueAt = u.LastActiveAt.Add(p.DeactivateAfter)
+		if notice := u.WarnedAt.Add(p.DeactivateAfter - p.WarnAfter); notice.After(u.DueAt) {
+			u.DueAt = notice
+		}
+	default:
+		u.Action = InactiveWarn
+		u.DueAt = u.LastActiveAt.Add(p.WarnAfter)
+	}
+	return true
+}
+
+// UsersToWarn returns up to limit active users who have been inactive long enough to
+// be warned and have not been since they were last active
+func (s *UserService) UsersToWarn(policy InactivityPolicy, limit int) ([]InactiveUser, error) {
+	users := []InactiveUser{}
+	err := s.db.Select(&users, `
+		SELECT `+inactiveColumns+`
+		FROM users
+		WHERE is_active AND NOT is_admin AND NOT is_system AND federated_address IS NULL AND NOT legal_hold AND anonymized_at IS NULL
+			AND `+lastActive+` < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			AND (inactivity_warned_at IS NULL OR inactivity_warned_at < `+lastActive+`)
+		ORDER BY last_active_at
+		LIMIT $2
+	`, policy.WarnAfter.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users to warn: %w", err)
+	}
+
+	for i := range users {
+		users[i].Email, err = s.encryptor.DecryptString(users[i].Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt email: %w", err)
+		}
+	}
+	return users, nil
+}
+
+// MarkInactivityWarned records that a user was warned about their inactivity
+func (s *UserService) MarkInactivityWarned(id uuid.UUID) error {
+	_, err := s.db.Exec(`UPDATE users SET inactivity_warned_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark user warned: %w", err)
+	}
+	return nil
+}
+
+// DeactivateInactive deactivates warned users whose notice period has passed and
+// returns them
+func (s *UserService) DeactivateInactive(policy InactivityPolicy) ([]InactiveUser, error) {
+	users := []InactiveUser{}
+	err := s.db.Select(&users, `
+		UPDATE users
+		SET is_active = false, is_online = false, deactivated_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE is_active AND NOT is_admin AND NOT is_system AND federated_address IS NULL AND NOT legal_hold AND anonymized_at IS NULL
+			AND `+lastActive+` < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			AND inactivity_warned_at >= `+lastActive+`
+			AND inactivity_warned_at < CURRENT_TIMESTAMP - make_interval(secs => $2)
+		RETURNING `+inactiveColumns+`
+	`, policy.DeactivateAfter.Seconds(), (policy.DeactivateAfter - policy.WarnAfter).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to deactivate inactive users: %w", err)
+	}
+	return users, nil
+}
+
+// AnonymizeInactive erases the personal data of up to limit users the policy
+// deactivated who stayed away for AnonymizeAfter, and returns them. Their messages
+// stay, attributed to a placeholder name.
+func (s *UserService) AnonymizeInactive(policy InactivityPolicy, limit int) ([]InactiveUser, error) {
+	if policy.AnonymizeAfter <= 0 {
+		return nil, nil
+	}
+
+	candidates := []InactiveUser{}
+	err := s.db.Select(&candidates, `
+		SELECT `+inactiveColumns+`
+		FROM users
+		WHERE NOT is_active AND NOT is_admin AND NOT is_system AND federated_address IS NULL AND NOT legal_hold
+			AND deactivated_at IS NOT NULL AND anonymized_at IS NULL
+			AND `+lastActive+` < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		ORDER BY last_active_at
+		LIMIT $2
+	`, policy.AnonymizeAfter.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users to anonymize: %w", err)
+	}
+
+	// Contact details are stored encrypted, so even the empty values are encrypted
+	empty, err := s.encryptor.EncryptString("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	anonymized := []InactiveUser{}
+	for _, user := range candidates {
+		// Check again in case the user was reactivated or put on hold meanwhile
+		result, err := s.db.Exec(`
+			UPDATE users
+			SET username = 'deleted-' || replace(id::text, '-', ''),
+				email = $2, email_index = NULL, phone = $2, password_hash = '', status = 'deleted',
+				anonymized_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND NOT is_active AND NOT legal_hold AND anonymized_at IS NULL
+		`, user.ID, empty)
+		if err != nil {
+			return anonymized, fmt.Errorf("failed to anonymize user: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			// The devices they signed in from record where they were
+			if _, err := s.db.Exec(`DELETE FROM user_devices WHERE user_id = $1`, user.ID); err != nil {
+				return anonymized, fmt.Errorf("failed to delete devices: %w", err)
+			}
+			user.Email = ""
+			anonymized = append(anonymized, user)
+		}
+	}
+	return anonymized, nil
+}
+
+// UpcomingInactive returns the users the policy will act on within the given time,
+// soonest first, with the step it will take. Overdue steps are included.
+func (s *UserService) UpcomingInactive(policy InactivityPolicy, within time.Duration, limit int) ([]InactiveUser, error) {
+	candidates := []InactiveUser{}
+	err := s.db.Select(&candidates, `
+		SELECT `+inactiveColumns+`
+		FROM users
+		WHERE NOT is_admin AND NOT is_system AND federated_address IS NULL AND anonymized_at IS NULL
+			AND (is_active OR deactivated_at IS NOT NULL)
+			AND `+lastActive+` < CURRENT_TIMESTAMP + make_interval(secs => $1)
+		ORDER BY last_active_at
+	`, (within - policy.WarnAfter).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find inactive users: %w", err)
+	}
+
+	cutoff := time.Now().Add(within)
+	upcoming := []InactiveUser{}
+	for _, user := range candidates {
+		if policy.next(&user) && !user.DueAt.After(cutoff) {
+			user.Email = ""
+			upcoming = append(upcoming, user)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool { return upcoming[i].DueAt.Before(upcoming[j].DueAt) })
+	if len(upcoming) > limit {
+		upcoming = upcoming[:limit]
+	}
+	return upcoming, nil
+}
+
+// SetLegalHold exempts a user from the inactive account policy, or lifts the exemption
+func (s *UserService) SetLegalHold(id uuid.UUID, hold bool) error {
+	var updated uuid.UUID
+	err := s.db.Get(&updated, `
+		UPDATE users SET legal_hold = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND anonymized_at IS NULL
+		RETURNING id
+	`, id, hold)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold: %w", err)
+	}
+	return nil
+}
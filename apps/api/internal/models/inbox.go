@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InboxConversation is a conversation with unread messages, as shown in the inbox
+type InboxConversation struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Type           string    `json:"type"`
+	Name           *string   `json:"name,omitempty"`
+	UnreadCount    int       `json:"unread_count"`
+	LatestAt       time.Time `json:"latest_at"`
+	// NameGenerated is set on groups whose Name the API made up; see Conversation
+	NameGenerated bool `json:"name_generated,omitempty"`
+	// Messages holds the most recent unread messages, newest first
+	Messages []Message `json:"messages"`
+
+	NameSample       GroupNameSample `json:"-"`
+	ParticipantCount int             `json:"-"`
+}
+
+// Unnamed reports whether the conversation is a group the API names after its
+// participants
+func (c *InboxConversation) Unnamed() bool {
+	return c.Type == "group" && (c.Name == nil || *c.Name == "")
+}
+
+// inboxRow is an unread message with the inbox details of its conversation
+type inboxRow struct {
+	Message
+	ConversationType string    `db:"conversation_type"`
+	ConversationName *string   `db:"conversation_name"`
+	UnreadCount      int       `db:"unread_count"`
+	LatestAt         time.Time `db:"latest_at"`
+	Position         int       `db:"position"`
+	ConversationRank int       `db:"conversation_rank"`
+
+	NameSample       GroupNameSample `db:"name_sample"`
+	ParticipantCount int             `db:"participant_count"`
+}
+
+// GetInbox returns the user's most recent unread messages across all conversations,
+// grouped by conversation. At most conversationLimit conversations are returned, most
+// recently active first, each with up to perConversation messages.
+func (s *MessageService) GetInbox(userID uuid.UUID, conversationLimit, perConversation int) ([]InboxConversation, error) {
+	rows := []inboxRow{}
+	err := s.db.Select(&rows, `
+		WITH unread AS (
+			SELECT m.*,
+				`+displayedUsername+` AS sender_username,
+				c.type AS conversation_type,
+				c.name AS conversation_name,
+				COALESCE(s.name_sample, '[]') AS name_sample,
+				COALESCE(s.participant_count, 0) AS participant_count,
+				ROW_NUMBER() OVER (PARTITION BY m.conversation_id ORDER BY m.created_at DESC, m.id DESC) AS position,
+				COUNT(*) OVER (PARTITION BY m.conversation_id) AS unread_count,
+				MAX(m.created_at) OVER (PARTITION BY m.conversation_id) AS latest_at
+			FROM messages m
+			JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+			JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = $1
+			JOIN users u ON u.id = m.sender_id
+			LEFT JOIN conversation_summaries s ON s.conversation_id = m.conversation_id
+			LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = $1
+			WHERE m.sender_id != $1
+			  AND NOT m.is_deleted
+			  AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at)
+			  AND (ms.status IS NULL OR ms.status IN ('sent', 'delivered'))
+			  AND `+visibleHistory("$1")+`
+		), ranked AS (
+			SELECT *, DENSE_RANK() OVER (ORDER BY latest_at DESC, conversation_id) AS conversation_rank
+			FROM unread
+			WHERE position <= $3
+		)
+		SELECT * FROM ranked
+		WHERE conversation_rank <= $2
+		ORDER BY conversation_rank, position
+	`, userID, conversationLimit, perConversation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inbox: %w", err)
+	}
+
+	inbox := []InboxConversation{}
+	for _, row := range rows {
+		content, err := s.encryptor.DecryptString(row.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt message %s: %w", row.ID, err)
+		}
+		row.Content = content
+
+		if len(inbox) == 0 || inbox[len(inbox)-1].ConversationID != row.ConversationID {
+			inbox = append(inbox, InboxConversation{
+				ConversationID:   row.ConversationID,
+				Type:             row.ConversationType,
+				Name:             row.ConversationName,
+				UnreadCount:      row.UnreadCount,
+				LatestAt:         row.LatestAt,
+				Messages:         []Message{},
+				NameSample:       row.NameSample,
+				ParticipantCount: row.ParticipantCount,
+			})
+		}
+		hideViewOnceMedia(&row.Message)
+		if err := openMedia(s.encryptor, &row.Message); err != nil {
+			return nil, err
+		}
+		last := &inbox[len(inbox)-1]
+		last.Messages = append(last.Messages, row.Message)
+	}
+
+	return inbox, nil
+}
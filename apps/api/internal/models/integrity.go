@@ -0,0 +1,299 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Events recorded in a conversation's integrity chain
+const (
+	ChainCreated        = "created"
+	ChainEdited         = "edited"
+	ChainDeleted        = "deleted"
+	ChainMediaEncrypted = "media_encrypted"
+)
+
+// Problems an integrity check can find
+const (
+	// IntegrityBrokenLink is a link whose sequence or previous hash doesn't follow on
+	IntegrityBrokenLink = "broken_link"
+	// IntegrityHashMismatch is a link whose own fields no longer hash to its hash
+	IntegrityHashMismatch = "hash_mismatch"
+	// IntegrityAltered is a message that differs from its latest link
+	IntegrityAltered = "altered"
+	// IntegrityMissing is a chained message that is no longer stored
+	IntegrityMissing = "missing"
+	// IntegrityUnchained is a message sent since the chain started that has no link
+	IntegrityUnchained = "unchained"
+)
+
+// maxIntegrityProblems bounds the problems listed in a report; all of them are counted
+const maxIntegrityProblems = 100
+
+// chainGenesis is the previous hash of a chain's first link
+var chainGenesis = strings.Repeat("0", 64)
+
+// chainedMessage is the canonical form of a stored message that a link's digest covers.
+// Content and media are hashed as stored, encrypted, so checking a chain needs no keys.
+type chainedMessage struct {
+	ID                uuid.UUID  `db:"id" json:"id"`
+	ConversationID    uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	SenderID          uuid.UUID  `db:"sender_id" json:"sender_id"`
+	ReplyToID         *uuid.UUID `db:"reply_to_id" json:"reply_to_id"`
+	MessageType       string     `db:"message_type" json:"type"`
+	Content           string     `db:"content" json:"content"`
+	MediaURL          *string    `db:"media_url" json:"media_url"`
+	MediaThumbnailURL *string    `db:"media_thumbnail_url" json:"media_thumbnail_url"`
+	IsDeleted         bool       `db:"is_deleted" json:"is_deleted"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+}
+
+// chainedMessageColumns are the columns scanned into a chainedMessage
+const chainedMessageColumns = `id, conversation_id, sender_id, reply_to_id, message_type,
+	content, media_url, media_thumbnail_url, is_deleted, created_at`
+
+func (m *chainedMessage) digest() string {
+	canonical := *m
+	canonical.CreatedAt = m.CreatedAt.UTC()
+	// Encoding a struct of plain fields cannot fail, and always lists them in order
+	data, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainLink is one entry of a conversation's integrity chain
+type ChainLink struct {
+	ConversationID uuid.UUID `db:"conversation_id" json:"-"`
+	Seq            int64     `db:"seq" json:"seq"`
+	MessageID      uuid.UUID `db:"message_id" json:"message_id"`
+	Event          string    `db:"event" json:"event"`
+	Digest         string    `db:"digest" json:"digest"`
+	PrevHash       string    `db:"prev_hash" json:"prev_hash"`
+	Hash           string    `db:"hash" json:"hash"`
+	LinkedAt       time.Time `db:"linked_at" json:"linked_at"`
+}
+
+// computeHash hashes the link's fields together with the previous link's hash
+func (l *ChainLink) computeHash() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		l.PrevHash,
+		strconv.FormatInt(l.Seq, 10),
+		l.MessageID.String(),
+		l.Event,
+		l.Digest,
+		l.LinkedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// IntegrityProblem is something an integrity check found wrong
+type IntegrityProblem struct {
+	Seq       int64     `json:"seq,omitempty"`
+	MessageID uuid.UUID `json:"message_id"`
+	Problem   string    `json:"problem"`
+}
+
+// IntegrityReport is the result of checking a conversation's integrity chain. Head is
+// the hash of the latest link: noting it down lets anyone later prove that history up
+// to that point was not rewritten, even by someone recomputing the whole chain.
+type IntegrityReport struct {
+	ConversationID uuid.UUID          `json:"conversation_id"`
+	Enabled        bool               `json:"enabled"`
+	Since          *time.Time         `json:"since,omitempty"`
+	Links          int64              `json:"links"`
+	Messages       int                `json:"messages"`
+	Head           string             `json:"head,omitempty"`
+	Valid          bool               `json:"valid"`
+	ProblemCount   int                `json:"problem_count"`
+	Problems       []IntegrityProblem `json:"problems"`
+	CheckedAt      time.Time          `json:"checked_at"`
+}
+
+func (r *IntegrityReport) add(problem IntegrityProblem) {
+	r.ProblemCount++
+	if len(r.Problems) < maxIntegrityProblems {
+		r.Problems = append(r.Problems, problem)
+	}
+}
+
+// chainMessage appends a link for the message as it is now stored, when its
+// conversation keeps an integrity chain. It runs in the transaction that changed the
+// message, so the link and the change are committed together.
+func chainMessage(tx *sqlx.Tx, conversationID, messageID uuid.UUID, event string) error {
+	var since *time.Time
+	err := tx.Get(&since, `SELECT integrity_chain_since FROM conversations WHERE id = $1`, conversationID)
+	if err == sql.ErrNoRows || (err == nil && since == nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check integrity chain: %w", err)
+	}
+
+	// Serialize links per conversation, so each one follows the previous
+	if _, err := tx.Exec(`SELECT 1 FROM conversations WHERE id = $1 FOR UPDATE`, conversationID); err != nil {
+		return fmt.Errorf("failed to lock integrity chain: %w", err)
+	}
+
+	var message chainedMessage
+	err = tx.Get(&message, `SELECT `+chainedMessageColumns+` FROM messages WHERE id = $1`, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get message to chain: %w", err)
+	}
+
+	link := ChainLink{
+		ConversationID: conversationID,
+		Seq:            1,
+		MessageID:      messageID,
+		Event:          event,
+		Digest:         message.digest(),
+		PrevHash:       chainGenesis,
+		// Postgres keeps microseconds, so the hash is computed over what is stored
+		LinkedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	var head ChainLink
+	err = tx.Get(&head, `
+		SELECT seq, hash FROM message_chain
+		WHERE conversation_id = $1
+		ORDER BY seq DESC
+		LIMIT 1
+	`, conversationID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get integrity chain head: %w", err)
+	}
+	if err == nil {
+		link.Seq = head.Seq + 1
+		link.PrevHash = head.Hash
+	}
+	link.Hash = link.computeHash()
+
+	_, err = tx.NamedExec(`
+		INSERT INTO message_chain (conversation_id, seq, message_id, event, digest, prev_hash, hash, linked_at)
+		VALUES (:conversation_id, :seq, :message_id, :event, :digest, :prev_hash, :hash, :linked_at)
+	`, &link)
+	if err != nil {
+		return fmt.Errorf("failed to append to integrity chain: %w", err)
+	}
+	return nil
+}
+
+// VerifyIntegrity checks a conversation's integrity chain: that every link follows
+// the one before it and still hashes the same, and that every message sent since the
+// chain started is stored as its latest link describes
+func (s *ConversationService) VerifyIntegrity(conversationID uuid.UUID) (*IntegrityReport, error) {
+	report := &IntegrityReport{
+		ConversationID: conversationID,
+		Problems:       []IntegrityProblem{},
+		CheckedAt:      time.Now(),
+	}
+	err := s.db.Get(&report.Since, `
+		SELECT integrity_chain_since FROM conversations WHERE id = $1 AND deleted_at IS NULL
+	`, conversationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	report.Enabled = report.Since != nil
+	if !report.Enabled {
+		report.Valid = true
+		return report, nil
+	}
+
+	// Walk the chain, remembering the latest digest of each message
+	latest := map[uuid.UUID]ChainLink{}
+	rows, err := s.db.Queryx(`
+		SELECT * FROM message_chain WHERE conversation_id = $1 ORDER BY seq
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integrity chain: %w", err)
+	}
+	defer rows.Close()
+
+	prevHash := chainGenesis
+	for rows.Next() {
+		var link ChainLink
+		if err := rows.StructScan(&link); err != nil {
+			return nil, fmt.Errorf("failed to read integrity chain: %w", err)
+		}
+		report.Links++
+		if link.Seq != report.Links || link.PrevHash != prevHash {
+			report.add(IntegrityProblem{Seq: link.Seq, MessageID: link.MessageID, Problem: IntegrityBrokenLink})
+		}
+		if link.computeHash() != link.Hash {
+			report.add(IntegrityProblem{Seq: link.Seq, MessageID: link.MessageID, Problem: IntegrityHashMismatch})
+		}
+		prevHash = link.Hash
+		report.Head = link.Hash
+		latest[link.MessageID] = link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read integrity chain: %w", err)
+	}
+
+	// Compare the messages as stored with their latest links
+	messages, err := s.db.Queryx(`
+		SELECT `+chainedMessageColumns+` FROM messages
+		WHERE conversation_id = $1 AND (created_at >= $2 OR id = ANY($3::uuid[]))
+		ORDER BY created_at, id
+	`, conversationID, report.Since, chainedIDs(latest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer messages.Close()
+
+	seen := make(map[uuid.UUID]bool, len(latest))
+	for messages.Next() {
+		var message chainedMessage
+		if err := messages.StructScan(&message); err != nil {
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+		report.Messages++
+		seen[message.ID] = true
+
+		link, ok := latest[message.ID]
+		switch {
+		case !ok:
+			report.add(IntegrityProblem{MessageID: message.ID, Problem: IntegrityUnchained})
+		case link.Digest != message.digest():
+			report.add(IntegrityProblem{Seq: link.Seq, MessageID: message.ID, Problem: IntegrityAltered})
+		}
+	}
+	if err := messages.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	missing := []ChainLink{}
+	for id, link := range latest {
+		if !seen[id] {
+			missing = append(missing, link)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Seq < missing[j].Seq })
+	for _, link := range missing {
+		report.add(IntegrityProblem{Seq: link.Seq, MessageID: link.MessageID, Problem: IntegrityMissing})
+	}
+
+	report.Valid = report.ProblemCount == 0
+	return report, nil
+}
+
+// chainedIDs lists the messages that have links
+func chainedIDs(links map[uuid.UUID]ChainLink) pq.StringArray {
+	ids := make([]uuid.UUID, 0, len(links))
+	for id := range links {
+		ids = append(ids, id)
+	}
+	return pq.StringArray(uuidStrings(ids))
+}
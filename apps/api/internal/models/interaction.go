@@ -0,0 +1,216 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCallback is returned for a callback token that wasn't issued for a card,
+// or for values that don't fit the component it was issued for
+var ErrInvalidCallback = errors.New("invalid callback token")
+
+// Interaction is a click on a card's button or a pick from one of its select menus,
+// for the application that posted the card to answer
+type Interaction struct {
+	ID             uuid.UUID `json:"id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	ApplicationID  uuid.UUID `json:"-"`
+	UserID         uuid.UUID `json:"user_id"`
+	Action         string    `json:"action"`
+	// Values are the options picked from a select menu, or the button's value
+	Values    []string  `json:"values,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// signActions sets the callback tokens of the card's buttons and select menus
+func (c *MessageCard) signActions(messageID uuid.UUID) {
+	for i, button := range c.Buttons {
+		if button.Action != "" {
+			c.Buttons[i].CallbackToken = c.callbackToken(messageID, button.Action)
+		}
+	}
+	for i, menu := range c.Selects {
+		c.Selects[i].CallbackToken = c.callbackToken(messageID, menu.Action)
+	}
+}
+
+// callbackToken names a message and one of its card's actions, signed with the card's
+// secret so that clients can't make up actions
+func (c *MessageCard) callbackToken(messageID uuid.UUID, action string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(messageID.String() + "/" + action))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.signCallback(payload))
+}
+
+func (c *MessageCard) signCallback(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(c.secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// parseCallbackToken returns the message and action a callback token names, without
+// checking its signature
+func parseCallbackToken(token string) (uuid.UUID, string, error) {
+	payload, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, "", ErrInvalidCallback
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidCallback
+	}
+	id, action, ok := strings.Cut(string(decoded), "/")
+	if !ok {
+		return uuid.Nil, "", ErrInvalidCallback
+	}
+	messageID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidCallback
+	}
+	return messageID, action, nil
+}
+
+// verify reports whether a callback token was signed with the card's secret
+func (c *MessageCard) verify(token string) bool {
+	payload, signature, _ := strings.Cut(token, ".")
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	return err == nil && c.secret != "" && hmac.Equal(decoded, c.signCallback(payload))
+}
+
+// Interact checks an interaction of userID with a card, given the callback token of
+// the component and, for select menus, the value picked. It returns ErrMessageNotFound
+// for messages they can't read, ErrInvalidCallback for tokens the card didn't issue or
+// values it doesn't offer, and ErrApplicationNotFound when the application that
+// answers the card was removed or revoked.
+func (s *MessageService) Interact(token string, userID uuid.UUID, values []string) (*Interaction, error) {
+	messageID, action, err := parseCallbackToken(token)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.GetByIDsForUser([]uuid.UUID{messageID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	message := messages[0]
+	card := message.Card
+	if card == nil || !card.verify(token) {
+		return nil, ErrInvalidCallback
+	}
+
+	picked, ok := card.pick(action, values)
+	if !ok {
+		return nil, ErrInvalidCallback
+	}
+	if card.ApplicationID == nil {
+		return nil, ErrApplicationNotFound
+	}
+	active, err := NewOAuthService(s.db).IsActiveApplication(*card.ApplicationID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrApplicationNotFound
+	}
+
+	return &Interaction{
+		ID:             uuid.New(),
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		ApplicationID:  *card.ApplicationID,
+		UserID:         userID,
+		Action:         action,
+		Values:         picked,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+// pick returns the values of an interaction with the card's action: the button's value,
+// which takes no values from the client, or the one option picked from a select menu.
+// Cards can be updated after the token was issued, so the action may be gone.
+func (c *MessageCard) pick(action string, values []string) ([]string, bool) {
+	for _, button := range c.Buttons {
+		if button.Action == action {
+			if len(values) > 0 {
+				return nil, false
+			}
+			if button.Value == "" {
+				return nil, true
+			}
+			return []string{button.Value}, true
+		}
+	}
+	for _, menu := range c.Selects {
+		if menu.Action != action {
+			continue
+		}
+		if len(values) != 1 {
+			return nil, false
+		}
+		for _, option := range menu.Options {
+			if option.Value == values[0] {
+				return values, true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// UpdateCard replaces the card of a message in place, on behalf of the application that
+// posted it, acting for userID. The message isn't marked edited, and the callback
+// tokens of the card stay valid for the actions it keeps. It returns the message, or
+// ErrMessageNotFound when userID can't read it and ErrNotFound when it has no card of
+// the application's.
+func (s *MessageService) UpdateCard(messageID, userID, applicationID uuid.UUID, card *MessageCard) (*Message, error) {
+	messages, err := s.GetByIDsForUser([]uuid.UUID{messageID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	message := &messages[0]
+	if message.Card == nil || message.Card.ApplicationID == nil || *message.Card.ApplicationID != applicationID {
+		return nil, ErrNotFound
+	}
+
+	card.ApplicationID = &applicationID
+	sealed, err := sealCard(s.encryptor, card)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE message_cards SET card = $1 WHERE message_id = $2`, sealed, messageID); err != nil {
+		return nil, fmt.Errorf("failed to update card: %w", err)
+	}
+	err = tx.Get(&message.UpdatedAt, `
+		UPDATE messages SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING updated_at
+	`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	card.secret = message.Card.secret
+	card.signActions(messageID)
+	message.Card = card
+	return message, nil
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxKeywordAlerts bounds the keywords a user can be alerted about
+const maxKeywordAlerts = 50
+
+// ErrKeywordAlertLimit is returned when a user has as many keyword alerts as allowed
+var ErrKeywordAlertLimit = errors.New("keyword alert limit reached")
+
+// KeywordAlert notifies a user when a keyword comes up in a conversation, or in any of
+// their conversations when ConversationID is nil
+type KeywordAlert struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	UserID         uuid.UUID  `db:"user_id" json:"-"`
+	ConversationID *uuid.UUID `db:"conversation_id" json:"conversation_id,omitempty"`
+	Keyword        string     `db:"keyword" json:"keyword"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
+
+// KeywordMatch is a participant with keyword alerts set off by a message
+type KeywordMatch struct {
+	UserID   uuid.UUID
+	Keywords []string
+}
+
+// KeywordAlertService manages users' keyword alerts
+type KeywordAlertService struct {
+	db *sqlx.DB
+}
+
+// NewKeywordAlertService creates a new keyword alert service
+func NewKeywordAlertService(db *sqlx.DB) *KeywordAlertService {
+	return &KeywordAlertService{db: db}
+}
+
+// List returns a user's keyword alerts, the ones for every conversation first
+func (s *KeywordAlertService) List(userID uuid.UUID) ([]KeywordAlert, error) {
+	alerts := []KeywordAlert{}
+	err := s.db.Select(&alerts, `
+		SELECT * FROM keyword_alerts
+		WHERE user_id = $1
+		ORDER BY conversation_id NULLS FIRST, LOWER(keyword)
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keyword alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// Create adds a keyword alert. Alerts for a conversation need the user to take part in
+// it; ErrConflict is returned for a keyword the user is already alerted about there.
+func (s *KeywordAlertService) Create(userID uuid.UUID, conversationID *uuid.UUID, keyword string) (*KeywordAlert, error) {
+	var count int
+	if err := s.db.Get(&count, `SELECT COUNT(*) FROM keyword_alerts WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to count keyword alerts: %w", err)
+	}
+	if count >= maxKeywordAlerts {
+		return nil, ErrKeywordAlertLimit
+	}
+
+	if conversationID != nil {
+		var isParticipant bool
+		err := s.db.Get(&isParticipant, `
+			SELECT EXISTS(
+				SELECT 1 FROM conversation_participants cp
+				JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+				WHERE cp.conversation_id = $1 AND cp.user_id = $2
+			)
+		`, *conversationID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check participant: %w", err)
+		}
+		if !isParticipant {
+			return nil, ErrConversationNotFound
+		}
+	}
+
+	alert := &KeywordAlert{}
+	err := s.db.Get(alert, `
+		INSERT INTO keyword_alerts (user_id, conversation_id, keyword)
+		VALUES ($1, $2, $3)
+		RETURNING *
+	`, userID, conversationID, keyword)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyword alert: %w", err)
+	}
+	return alert, nil
+}
+
+// Delete removes one of a user's keyword alerts
+func (s *KeywordAlertService) Delete(id, userID uuid.UUID) error {
+	result, err := s.db.Exec(`DELETE FROM keyword_alerts WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete keyword alert: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Match returns the participants other than the sender whose keyword alerts, for this
+// conversation or for all of theirs, come up in a message's plaintext content. Keywords
+// match whole words, ignoring case.
+func (s *KeywordAlertService) Match(message *Message, content string) ([]KeywordMatch, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+
+	alerts := []KeywordAlert{}
+	err := s.db.Select(&alerts, `
+		SELECT ka.* FROM keyword_alerts ka
+		JOIN conversation_participants cp ON cp.user_id = ka.user_id AND cp.conversation_id = $1
+		JOIN users u ON u.id = ka.user_id AND u.is_active = true
+		WHERE (ka.conversation_id IS NULL OR ka.conversation_id = $1) AND ka.user_id != $2
+		ORDER BY ka.user_id, ka.created_at
+	`, message.ConversationID, message.SenderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyword alerts: %w", err)
+	}
+
+	matches := []KeywordMatch{}
+	for _, alert := range alerts {
+		if !containsKeyword(content, alert.Keyword) {
+			continue
+		}
+		if n := len(matches); n > 0 && matches[n-1].UserID == alert.UserID {
+			// The same keyword may be set for this conversation and for all of them
+			if !containsFold(matches[n-1].Keywords, alert.Keyword) {
+				matches[n-1].Keywords = append(matches[n-1].Keywords, alert.Keyword)
+			}
+			continue
+		}
+		matches = append(matches, KeywordMatch{UserID: alert.UserID, Keywords: []string{alert.Keyword}})
+	}
+	return matches, nil
+}
+
+// containsKeyword reports whether keyword appears in content as whole words, ignoring case
+func containsKeyword(content, keyword string) bool {
+	pattern, err := regexp.Compile(`(?i)(?:^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(keyword) + `(?:$|[^\p{L}\p{N}_])`)
+	if err != nil {
+		return false
+	}
+	return pattern.MatchString(content)
+}
+
+func containsFold(keywords []string, keyword string) bool {
+	for _, k := range keywords {
+		if strings.EqualFold(k, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// switchToLargeGroup puts a group in large-group mode for good. The pending, delivered
+// and read statuses its watermarks don't imply are dropped: large groups don't keep them.
+func switchToLargeGroup(tx *sqlx.Tx, conversationID uuid.UUID) error {
+	result, err := tx.Exec(`
+		UPDATE conversations SET large_group = true, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND NOT large_group
+	`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to switch to large group: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM message_status ms
+		USING messages m
+		WHERE m.id = ms.message_id AND m.conversation_id = $1
+		  AND ms.user_id != m.sender_id AND ms.status IN ('sent', 'delivered', 'read')
+	`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to drop message statuses: %w", err)
+	}
+
+	logger.Info("Conversation switched to large-group mode", map[string]interface{}{
+		"conversation_id": conversationID,
+	})
+	return nil
+}
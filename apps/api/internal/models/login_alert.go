@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// The Talkify Security account messages users about sign-ins they may not have made.
+// It is created the first time it is needed.
+var (
+	SecurityBotID       = uuid.MustParse("00000000-0000-4000-8000-5ec000000001")
+	SecurityBotUsername = "Talkify Security"
+)
+
+// LoginAlert is a sign-in from a device, IP or country new for the user, which they can
+// report as not theirs
+type LoginAlert struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	UserID     uuid.UUID  `db:"user_id" json:"-"`
+	DeviceName string     `db:"device_name" json:"device"`
+	IP         string     `db:"ip" json:"ip"`
+	Country    string     `db:"country" json:"country,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ReportedAt *time.Time `db:"reported_at" json:"reported_at,omitempty"`
+}
+
+// LoginAlertService handles alerts about unusual sign-ins
+type LoginAlertService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewLoginAlertService creates a new login alert service
+func NewLoginAlertService(db *sqlx.DB, encryptor encryption.Encryptor) *LoginAlertService {
+	return &LoginAlertService{db: db, encryptor: encryptor}
+}
+
+// Create records an alert about a user's sign-in from device
+func (s *LoginAlertService) Create(userID uuid.UUID, device *LoginDevice) (*LoginAlert, error) {
+	alert := &LoginAlert{}
+	err := s.db.Get(alert, `
+		INSERT INTO login_alerts (user_id, device_name, ip, country)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *
+	`, userID, device.Name, device.IP, device.Country)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login alert: %w", err)
+	}
+	return alert, nil
+}
+
+// Report marks one of a user's login alerts as a sign-in they didn't make. Reporting an
+// alert again keeps the time of the first report.
+func (s *LoginAlertService) Report(userID, alertID uuid.UUID) (*LoginAlert, error) {
+	alert := &LoginAlert{}
+	err := s.db.Get(alert, `
+		UPDATE login_alerts SET reported_at = COALESCE(reported_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+		RETURNING *
+	`, alertID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to report login alert: %w", err)
+	}
+	return alert, nil
+}
+
+// EnsureSecurityBot creates the Talkify Security account unless it exists. Nobody can
+// sign in to it: it is a system account and its password hash matches no password.
+func (s *LoginAlertService) EnsureSecurityBot() error {
+	var exists bool
+	err := s.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, SecurityBotID)
+	if err != nil {
+		return fmt.Errorf("failed to check security account: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	empty, err := s.encryptor.EncryptString("")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt contact details: %w", err)
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO users (id, username, email, phone, password_hash, is_system)
+		VALUES ($1, $2, $3, $3, '!', true)
+		ON CONFLICT (id) DO NOTHING
+	`, SecurityBotID, SecurityBotUsername, empty)
+	if err != nil {
+		return fmt.Errorf("failed to create security account: %w", err)
+	}
+	return nil
+}
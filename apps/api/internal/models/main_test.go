@@ -0,0 +1,69 @@
+package models_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"talkify/apps/api/internal/config"
+	database "talkify/apps/api/internal/db"
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testDatabaseEnv opts into the tests and benchmarks that need a database. They run
+// against the database configured as for the server, which they write to, so they are
+// refused in production.
+const testDatabaseEnv = "TALKIFY_TEST_DATABASE"
+
+var (
+	connectOnce   sync.Once
+	testDB        *database.DB
+	testEncryptor encryption.Encryptor
+	connectErr    error
+	// cleanups run once every test and benchmark is done, before the database is closed
+	cleanups []func() error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		if err := cleanups[i](); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to clean up:", err)
+		}
+	}
+	if testDB != nil {
+		testDB.Close()
+	}
+	os.Exit(code)
+}
+
+// connect returns the configured database and encryptor, skipping tb unless
+// testDatabaseEnv is set
+func connect(tb testing.TB) (*sqlx.DB, encryption.Encryptor) {
+	tb.Helper()
+	if os.Getenv(testDatabaseEnv) == "" {
+		tb.Skipf("set %s=1 to run against the configured database", testDatabaseEnv)
+	}
+	connectOnce.Do(func() {
+		var cfg *config.Config
+		if cfg, connectErr = config.LoadConfig(); connectErr != nil {
+			return
+		}
+		if cfg.Profile == config.ProfileProduction {
+			connectErr = errors.New("tests write to the database and are not run in production")
+			return
+		}
+		if testEncryptor, connectErr = encryption.NewEncryptor(cfg.Encryption.Mode, cfg.Encryption.KeyFile); connectErr != nil {
+			return
+		}
+		testDB, connectErr = database.New(&cfg.Database)
+	})
+	if connectErr != nil {
+		tb.Fatalf("Failed to connect: %v", connectErr)
+	}
+	return testDB.DB, testEncryptor
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+)
+
+// errPlaintextMode is returned when asked to encrypt data in plaintext mode, where
+// there is no key to encrypt it with
+var errPlaintextMode = errors.New("data is stored in plaintext mode")
+
+// MessageMedia is the media attached to a message
+type MessageMedia struct {
+	MessageID      uuid.UUID `db:"id"`
+	ConversationID uuid.UUID `db:"conversation_id"`
+	SenderID       uuid.UUID `db:"sender_id"`
+	MediaURL       string    `db:"media_url"`
+	MediaEncrypted bool      `db:"media_encrypted"`
+	ViewOnce       bool      `db:"view_once"`
+}
+
+// GetMedia returns the media of a message the user can see. View-once media is only
+// returned to its sender; recipients go through OpenViewOnce.
+func (s *MessageService) GetMedia(messageID, userID uuid.UUID) (*MessageMedia, error) {
+	media := &MessageMedia{}
+	err := s.db.Get(media, `
+		SELECT m.id, m.conversation_id, m.sender_id, m.media_url, m.media_encrypted, m.view_once
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+		WHERE m.id = $1 AND m.media_url IS NOT NULL AND NOT m.is_deleted
+			AND `+visibleHistory("$2")+`
+	`, messageID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	if media.ViewOnce && media.SenderID != userID {
+		return nil, ErrNotFound
+	}
+	if media.MediaEncrypted {
+		if media.MediaURL, err = decryptMediaURL(s.encryptor, media.MediaURL); err != nil {
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// GetMediaURL returns the media URL of a message for a signed URL, which carries its
+// own authorization. Deleting the message revokes URLs already handed out. View-once
+// media is never served through signed URLs, which anyone holding them can reuse.
+func (s *MessageService) GetMediaURL(messageID uuid.UUID) (string, error) {
+	var media struct {
+		MediaURL       string `db:"media_url"`
+		MediaEncrypted bool   `db:"media_encrypted"`
+	}
+	err := s.db.Get(&media, `
+		SELECT m.media_url, m.media_encrypted
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+		WHERE m.id = $1 AND m.media_url IS NOT NULL AND NOT m.is_deleted AND NOT m.view_once
+	`, messageID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get media: %w", err)
+	}
+	if media.MediaEncrypted {
+		return decryptMediaURL(s.encryptor, media.MediaURL)
+	}
+	return media.MediaURL, nil
+}
+
+// sealMedia encrypts the media URLs of a message for storage. File names and often
+// the place a photo was taken show in them, so they are kept as private as the content.
+func sealMedia(encryptor encryption.Encryptor, urls ...*string) ([]*string, error) {
+	sealed := make([]*string, len(urls))
+	for i, url := range urls {
+		if url == nil {
+			continue
+		}
+		encrypted, err := encryptor.EncryptString(*url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt media URL: %w", err)
+		}
+		sealed[i] = &encrypted
+	}
+	return sealed, nil
+}
+
+// decryptMediaURL decrypts a media URL sealed by sealMedia
+func decryptMediaURL(encryptor encryption.Encryptor, url string) (string, error) {
+	decrypted, err := encryptor.DecryptString(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt media URL: %w", err)
+	}
+	return decrypted, nil
+}
+
+// openMedia decrypts the media URLs of messages stored with them encrypted. Messages
+// sent before media was encrypted are left as they are.
+func openMedia(encryptor encryption.Encryptor, messages ...*Message) error {
+	for _, message := range messages {
+		if !message.MediaEncrypted {
+			continue
+		}
+		for _, url := range []*string{message.MediaURL, message.MediaThumbnailURL} {
+			if url == nil {
+				continue
+			}
+			decrypted, err := decryptMediaURL(encryptor, *url)
+			if err != nil {
+				return fmt.Errorf("message %s: %w", message.ID, err)
+			}
+			*url = decrypted
+		}
+	}
+	return nil
+}
+
+// EncryptLegacyMedia encrypts the media URLs of up to limit messages sent before they
+// were stored encrypted, returning how many it encrypted. Run it until it returns 0.
+func (s *MessageService) EncryptLegacyMedia(limit int) (int, error) {
+	if encryption.IsPlaintext(s.encryptor) {
+		return 0, errPlaintextMode
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	messages := []Message{}
+	err = tx.Select(&messages, `
+		SELECT id, conversation_id, media_url, media_thumbnail_url
+		FROM messages
+		WHERE NOT media_encrypted AND (media_url IS NOT NULL OR media_thumbnail_url IS NOT NULL)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	for _, message := range messages {
+		sealed, err := sealMedia(s.encryptor, message.MediaURL, message.MediaThumbnailURL)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			UPDATE messages
+			SET media_url = $1, media_thumbnail_url = $2, media_encrypted = true
+			WHERE id = $3
+		`, sealed[0], sealed[1], message.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update message %s: %w", message.ID, err)
+		}
+		if err := chainMessage(tx, message.ConversationID, message.ID, ChainMediaEncrypted); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
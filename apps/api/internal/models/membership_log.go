@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Membership changes recorded in a conversation's membership log
+const (
+	MembershipJoined      = "joined"
+	MembershipLeft        = "left"
+	MembershipRemoved     = "removed"
+	MembershipRoleChanged = "role_changed"
+)
+
+// MembershipEvent is one change to who is in a conversation, or to their role
+type MembershipEvent struct {
+	ID             int64     `db:"id" json:"id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	Event          string    `db:"event" json:"event" example:"joined"`
+	// ActorID made the change; it is missing for members who joined before the log was kept
+	ActorID   *uuid.UUID `db:"actor_id" json:"actor_id,omitempty"`
+	TargetID  uuid.UUID  `db:"target_id" json:"target_id"`
+	OldRole   *string    `db:"old_role" json:"old_role,omitempty"`
+	NewRole   *string    `db:"new_role" json:"new_role,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// logMembership records a membership change. It runs with the change, in its
+// transaction, so the log never misses a change or lists one that was rolled back.
+// Roles that don't apply to the event are left empty.
+func logMembership(tx sqlx.Execer, conversationID uuid.UUID, event string, actorID, targetID uuid.UUID, oldRole, newRole string) error {
+	_, err := tx.Exec(`
+		INSERT INTO conversation_membership_log (conversation_id, event, actor_id, target_id, old_role, new_role)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+	`, conversationID, event, actorID, targetID, oldRole, newRole)
+	if err != nil {
+		return fmt.Errorf("failed to log membership change: %w", err)
+	}
+	return nil
+}
+
+// GetMembershipLog returns a page of a conversation's membership changes. With after
+// set, it returns the changes logged after that event, oldest first, for following the
+// log; otherwise it returns the latest changes first.
+func (s *ConversationService) GetMembershipLog(conversationID uuid.UUID, after int64, limit, offset int) ([]MembershipEvent, error) {
+	events := []MembershipEvent{}
+	query := `
+		SELECT * FROM conversation_membership_log
+		WHERE conversation_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+	args := []interface{}{conversationID, limit, offset}
+	if after > 0 {
+		query = `
+			SELECT * FROM conversation_membership_log
+			WHERE conversation_id = $1 AND id > $4
+			ORDER BY id
+			LIMIT $2 OFFSET $3`
+		args = append(args, after)
+	}
+	if err := s.db.Select(&events, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get membership log: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// mentionPattern finds @username mentions that don't follow a word or an email's local part
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@-])@([A-Za-z0-9_.-]+)`)
+
+// Mention is a message in which a user was mentioned
+type Mention struct {
+	MessageID      uuid.UUID  `db:"message_id" json:"message_id"`
+	ConversationID uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	ReadAt         *time.Time `db:"read_at" json:"read_at,omitempty"`
+	Message        *Message   `db:"-" json:"message,omitempty"`
+}
+
+// mentionedUsernames returns the lowercased usernames mentioned in content. Punctuation
+// ending a sentence may follow a mention, so each is also tried without it.
+func mentionedUsernames(content string) []string {
+	seen := map[string]bool{}
+	usernames := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(match[1])
+		for _, candidate := range []string{name, strings.TrimRight(name, ".-")} {
+			if candidate != "" && !seen[candidate] {
+				seen[candidate] = true
+				usernames = append(usernames, candidate)
+			}
+		}
+	}
+	return usernames
+}
+
+// storeMentions records the participants other than the sender mentioned in a message's
+// content, and forgets the ones an edit took out. Mentions already recorded keep
+// whether they were read.
+func storeMentions(tx *sqlx.Tx, message *Message, content string) error {
+	usernames := mentionedUsernames(content)
+	_, err := tx.Exec(`
+		DELETE FROM message_mentions mm
+		USING users u
+		WHERE mm.message_id = $1 AND u.id = mm.user_id AND NOT (LOWER(u.username) = ANY($2))
+	`, message.ID, pq.StringArray(usernames))
+	if err != nil {
+		return fmt.Errorf("failed to remove mentions: %w", err)
+	}
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO message_mentions (message_id, user_id, conversation_id)
+		SELECT $1, cp.user_id, cp.conversation_id
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id AND u.is_active = true
+		WHERE cp.conversation_id = $2 AND cp.user_id != $3 AND LOWER(u.username) = ANY($4)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, message.ID, message.ConversationID, message.SenderID, pq.StringArray(usernames))
+	if err != nil {
+		return fmt.Errorf("failed to store mentions: %w", err)
+	}
+	return nil
+}
+
+// readableMentions limits message_mentions mm of user $1 to those of messages m they can
+// still read: not deleted, in conversations they still take part in, within the history
+// they can see
+var readableMentions = `
+		FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id AND NOT m.is_deleted
+		JOIN conversations c ON c.id = mm.conversation_id AND c.deleted_at IS NULL
+		JOIN conversation_participants cp ON cp.conversation_id = mm.conversation_id AND cp.user_id = mm.user_id
+		WHERE mm.user_id = $1 AND ` + visibleHistory("$1")
+
+// MentionService handles the messages users were mentioned in
+type MentionService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewMentionService creates a new mention service
+func NewMentionService(db *sqlx.DB, encryptor encryption.Encryptor) *MentionService {
+	return &MentionService{db: db, encryptor: encryptor}
+}
+
+// List returns the messages a user was mentioned in, newest first, across their
+// conversations, or only the unread ones
+func (s *MentionService) List(userID uuid.UUID, unreadOnly bool, limit, offset int) ([]Mention, error) {
+	mentions := []Mention{}
+	err := s.db.Select(&mentions, `
+		SELECT mm.message_id, mm.conversation_id, mm.created_at, mm.read_at`+readableMentions+`
+		  AND (NOT $2 OR mm.read_at IS NULL)
+		ORDER BY mm.created_at DESC, mm.message_id
+		LIMIT $3 OFFSET $4
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	if len(mentions) == 0 {
+		return mentions, nil
+	}
+
+	ids := make([]uuid.UUID, len(mentions))
+	for i, mention := range mentions {
+		ids[i] = mention.MessageID
+	}
+	messages, err := NewMessageService(s.db, s.encryptor).GetByIDsForUser(ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	for i := range mentions {
+		mentions[i].Message = byID[mentions[i].MessageID]
+	}
+	return mentions, nil
+}
+
+// UnreadCount returns how many mentions of a user are unread
+func (s *MentionService) UnreadCount(userID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.Get(&count, `SELECT COUNT(*)`+readableMentions+` AND mm.read_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks a user's mentions read: those in messageIDs, or else those in
+// conversationID, or else all of them. It returns how many were unread.
+func (s *MentionService) MarkRead(userID uuid.UUID, conversationID *uuid.UUID, messageIDs []uuid.UUID) (int64, error) {
+	result, err := s.db.Exec(`
+		UPDATE message_mentions
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+		  AND ($2::uuid IS NULL OR conversation_id = $2)
+		  AND (CARDINALITY($3::uuid[]) = 0 OR message_id = ANY($3::uuid[]))
+	`, userID, conversationID, pq.StringArray(uuidStrings(messageIDs)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return marked, nil
+}
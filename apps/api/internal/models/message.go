@@ -1,7 +1,9 @@
 package models
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"talkify/apps/api/internal/encryption"
 	"time"
 
@@ -20,6 +22,8 @@ const (
 	AudioMessage    MessageType = "audio"
 	FileMessage     MessageType = "file"
 	LocationMessage MessageType = "location"
+	// SystemMessage is written by the server to announce conversation events
+	SystemMessage MessageType = "system"
 )
 
 // MessageStatus represents the delivery status of a message
@@ -72,7 +76,18 @@ type Message struct {
 	Reactions         MessageReactions `db:"reactions" json:"reactions,omitempty"`
 	IsEdited          bool             `db:"is_edited" json:"is_edited"`
 	IsDeleted         bool             `db:"is_deleted" json:"is_deleted"`
-	ReplyTo           *Message         `db:"-" json:"reply_to,omitempty"`
+	// MediaEncrypted is set once the media URLs, which name the file, are stored encrypted
+	MediaEncrypted bool `db:"media_encrypted" json:"-"`
+	// ViewOnce media is left out of message lists; recipients open it once through OpenViewOnce
+	ViewOnce bool          `db:"view_once" json:"view_once"`
+	ReplyTo  *ReplyPreview `db:"-" json:"reply_to,omitempty"`
+	// Annotations are set by integrations, see Annotate, and by the server on the
+	// messages it filters. Those a message is created or edited with are stored with it.
+	Annotations []MessageAnnotation `db:"-" json:"annotations,omitempty"`
+	// Card is the structured layout an integration sent the message with
+	Card *MessageCard `db:"-" json:"card,omitempty"`
+	// Display labels CreatedAt in the reader's timezone, when asked for
+	Display *DisplayHints `db:"-" json:"display,omitempty"`
 }
 
 type MessageReaction struct {
@@ -86,11 +101,11 @@ type MessageReaction struct {
 // MessageService handles message-related database operations
 type MessageService struct {
 	db        *sqlx.DB
-	encryptor *encryption.Manager
+	encryptor encryption.Encryptor
 }
 
 // NewMessageService creates a new message service
-func NewMessageService(db *sqlx.DB, encryptor *encryption.Manager) *MessageService {
+func NewMessageService(db *sqlx.DB, encryptor encryption.Encryptor) *MessageService {
 	return &MessageService{
 		db:        db,
 		encryptor: encryptor,
@@ -106,24 +121,44 @@ func (s *MessageService) Create(message *Message) error {
 	}
 	defer tx.Rollback()
 
-	// Encrypt message content if encryption is enabled
-	if s.encryptor != nil {
-		encryptedContent, err := s.encryptor.EncryptString(message.Content)
-		if err != nil {
-			return err
-		}
-		message.Content = encryptedContent
+	if err := s.create(tx, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// create writes a message in tx. A message that already has an ID keeps it.
+func (s *MessageService) create(tx *sqlx.Tx, message *Message) error {
+	content := message.Content
+
+	// Encrypt message content
+	encryptedContent, err := s.encryptor.EncryptString(message.Content)
+	if err != nil {
+		return err
 	}
+	message.Content = encryptedContent
+
+	// Media URLs are encrypted alongside the content, but handed back to the caller as sent
+	sealed, err := sealMedia(s.encryptor, message.MediaURL, message.MediaThumbnailURL)
+	if err != nil {
+		return err
+	}
+	mediaURL, thumbnailURL := sealed[0], sealed[1]
+	message.MediaEncrypted = true
 
 	// Insert message
 	query := `
 		INSERT INTO messages (
-			conversation_id, sender_id, reply_to_id,
-			content, message_type, media_url, media_thumbnail_url,
-			media_size, media_duration, is_edited, is_deleted
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			id, conversation_id, sender_id, reply_to_id,
+			content, message_type, media_url, media_thumbnail_url, media_encrypted,
+			media_size, media_duration, is_edited, is_deleted, view_once
+		) VALUES (COALESCE($14, uuid_generate_v4()), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		RETURNING id, created_at, updated_at`
 
+	var id *uuid.UUID
+	if message.ID != uuid.Nil {
+		id = &message.ID
+	}
 	err = tx.QueryRowx(
 		query,
 		message.ConversationID,
@@ -131,18 +166,44 @@ func (s *MessageService) Create(message *Message) error {
 		message.ReplyToID,
 		message.Content,
 		message.MessageType,
-		message.MediaURL,
-		message.MediaThumbnailURL,
+		mediaURL,
+		thumbnailURL,
+		message.MediaEncrypted,
 		message.MediaSize,
 		message.MediaDuration,
 		message.IsEdited,
 		message.IsDeleted,
+		message.ViewOnce,
+		id,
 	).StructScan(message)
 
 	if err != nil {
 		return err
 	}
 
+	if err := chainMessage(tx, message.ConversationID, message.ID, ChainCreated); err != nil {
+		return err
+	}
+	if message.Card != nil {
+		if err := storeCard(tx, s.encryptor, message.ID, message.Card); err != nil {
+			return err
+		}
+	}
+	if err := storeAnnotations(tx, message.ID, message.Annotations); err != nil {
+		return err
+	}
+	if err := storePreview(tx, s.encryptor, message.ConversationID, message.ID, content); err != nil {
+		return err
+	}
+	if MessageType(message.MessageType) != SystemMessage {
+		if err := storeMentions(tx, message, content); err != nil {
+			return err
+		}
+		if err := trackSupportMessage(tx, message); err != nil {
+			return err
+		}
+	}
+
 	// Set initial message status as sent
 	_, err = tx.Exec(`
 		INSERT INTO message_status (message_id, user_id, status)
@@ -152,15 +213,29 @@ func (s *MessageService) Create(message *Message) error {
 	if err != nil {
 		return err
 	}
+	if err := fanOutMessage(tx, message); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	// Track usage for quota enforcement; system messages are not the sender's doing
+	if MessageType(message.MessageType) != SystemMessage {
+		var mediaSize int64
+		if message.MediaSize != nil {
+			mediaSize = int64(*message.MediaSize)
+		}
+		if err := incrementUsage(tx, message.SenderID, mediaSize); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetByID retrieves a message by ID with its status
 func (s *MessageService) GetByID(id uuid.UUID) (*Message, error) {
 	message := &Message{}
 	err := s.db.Get(message, `
-		SELECT m.*, u.username as sender_username
+		SELECT m.*, `+displayedUsername+` as sender_username,
+			message_read_by(m.id, m.conversation_id, m.sender_id, m.created_at)::TEXT[] as read_by
 		FROM messages m
 		JOIN users u ON u.id = m.sender_id
 		WHERE m.id = $1 AND NOT m.is_deleted
@@ -182,78 +257,144 @@ func (s *MessageService) GetByID(id uuid.UUID) (*Message, error) {
 		message.Status = &status
 	}
 
-	// Get read by users
-	err = s.db.Select(&message.ReadBy, `
-		SELECT user_id FROM message_status 
-		WHERE message_id = $1 AND status = 'read'
-	`, id)
+	// Decrypt message content
+	content, err := s.encryptor.DecryptString(message.Content)
 	if err != nil {
 		return nil, err
 	}
+	message.Content = content
 
-	// Decrypt message content if encryption is enabled
-	if s.encryptor != nil {
-		content, err := s.encryptor.DecryptString(message.Content)
-		if err != nil {
-			return nil, err
-		}
-		message.Content = content
-	}
-
-	if message.ReplyToID != nil {
-		replyTo := &Message{}
-		err = s.db.Get(replyTo, `
-			SELECT m.*, u.username as sender_username
-			FROM messages m
-			JOIN users u ON u.id = m.sender_id
-			WHERE m.id = $1
-		`, message.ReplyToID)
-		if err == nil {
-			message.ReplyTo = replyTo
-		}
+	hideViewOnceMedia(message)
+	if err := openMedia(s.encryptor, message); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews([]*Message{message}); err != nil {
+		return nil, err
+	}
+	if err := s.attachAnnotations([]*Message{message}); err != nil {
+		return nil, err
+	}
+	if err := s.attachCards([]*Message{message}); err != nil {
+		return nil, err
 	}
 
 	return message, nil
 }
 
-// GetConversationMessages retrieves messages for a specific conversation with their status
-func (s *MessageService) GetConversationMessages(conversationID uuid.UUID, limit, offset int) ([]Message, error) {
+// messageReactionsJoin adds the reactions of each message m as mr.reactions, a JSON array
+// in the order they were made. A lateral subquery keeps them from being multiplied by
+// other rows joined to m, and looks up each message's own reactions by index.
+const messageReactionsJoin = `LEFT JOIN LATERAL (
+			SELECT COALESCE(jsonb_agg(jsonb_build_object(
+				'id', r.id,
+				'message_id', r.message_id,
+				'user_id', r.user_id,
+				'emoji', r.emoji,
+				'created_at', r.created_at
+			) ORDER BY r.created_at, r.id), '[]'::jsonb) AS reactions
+			FROM message_reactions r
+			WHERE r.message_id = m.id
+		) mr ON true`
+
+// GetByIDsForUser returns the messages among ids that userID may read: ones in
+// conversations they take part in, within the history they can see. Deleted messages
+// and everything else are left out.
+func (s *MessageService) GetByIDsForUser(ids []uuid.UUID, userID uuid.UUID) ([]Message, error) {
 	messages := []Message{}
 	err := s.db.Select(&messages, `
-		SELECT m.*, 
-			u.username as sender_username,
-			ARRAY_REMOVE(ARRAY_AGG(DISTINCT ms.user_id), NULL)::TEXT[] as read_by,
-			COALESCE(
-				json_agg(DISTINCT jsonb_build_object(
-					'id', mr.id,
-					'message_id', mr.message_id,
-					'user_id', mr.user_id,
-					'emoji', mr.emoji,
-					'created_at', mr.created_at
-				)) FILTER (WHERE mr.id IS NOT NULL),
-				'[]'
-			)::jsonb as reactions
+		SELECT m.*,
+			`+displayedUsername+` as sender_username,
+			message_read_by(m.id, m.conversation_id, m.sender_id, m.created_at)::TEXT[] as read_by,
+			mr.reactions
 		FROM messages m
-		JOIN users u ON u.id = m.sender_id AND u.is_active = true
-		LEFT JOIN message_status ms ON m.id = ms.message_id AND ms.status = 'read'
-		LEFT JOIN message_reactions mr ON m.id = mr.message_id
-		WHERE m.conversation_id = $1
-		GROUP BY m.id, u.username
+		JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+		JOIN users u ON u.id = m.sender_id
+		`+messageReactionsJoin+`
+		WHERE m.id = ANY($1::uuid[]) AND NOT m.is_deleted
+		  AND EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			WHERE cp.conversation_id = m.conversation_id AND cp.user_id = $2
+		  )
+		  AND `+visibleHistory("$2")+`
+	`, pq.StringArray(uuidStrings(ids)), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	found := make([]*Message, len(messages))
+	for i := range messages {
+		content, err := s.encryptor.DecryptString(messages[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt message: %w", err)
+		}
+		messages[i].Content = content
+		found[i] = &messages[i]
+	}
+
+	hideViewOnceMedia(found...)
+	if err := openMedia(s.encryptor, found...); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(found); err != nil {
+		return nil, err
+	}
+	if err := s.attachAnnotations(found); err != nil {
+		return nil, err
+	}
+	if err := s.attachCards(found); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// conversationMessagesQuery selects a page of the messages of conversation $1 that user
+// $4 may read, $2 at a time from offset $3
+var conversationMessagesQuery = `
+		SELECT m.*,
+			` + displayedUsername + ` as sender_username,
+			message_read_by(m.id, m.conversation_id, m.sender_id, m.created_at)::TEXT[] as read_by,
+			mr.reactions
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		` + messageReactionsJoin + `
+		WHERE m.conversation_id = $1 AND ` + visibleHistory("$4") + `
 		ORDER BY m.created_at ASC
 		LIMIT $2 OFFSET $3
-	`, conversationID, limit, offset)
+	`
+
+// GetConversationMessages retrieves the messages of a conversation that userID may read,
+// with their status
+func (s *MessageService) GetConversationMessages(conversationID, userID uuid.UUID, limit, offset int) ([]Message, error) {
+	messages := []Message{}
+	err := s.db.Select(&messages, conversationMessagesQuery, conversationID, limit, offset, userID)
 
 	if err != nil {
 		return nil, err
 	}
 
 	// Decrypt message content
+	replies := make([]*Message, len(messages))
 	for i := range messages {
 		decryptedContent, err := s.encryptor.DecryptString(messages[i].Content)
 		if err != nil {
 			return nil, err
 		}
 		messages[i].Content = decryptedContent
+		replies[i] = &messages[i]
+	}
+
+	hideViewOnceMedia(replies...)
+	if err := openMedia(s.encryptor, replies...); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(replies); err != nil {
+		return nil, err
+	}
+	if err := s.attachAnnotations(replies); err != nil {
+		return nil, err
+	}
+	if err := s.attachCards(replies); err != nil {
+		return nil, err
 	}
 
 	return messages, nil
@@ -263,7 +404,7 @@ func (s *MessageService) GetConversationMessages(conversationID uuid.UUID, limit
 func (s *MessageService) GetGroupMessages(groupID uuid.UUID, limit, offset int) ([]Message, error) {
 	messages := []Message{}
 	err := s.db.Select(&messages, `
-		SELECT m.*, u.username as sender_username
+		SELECT m.*, `+displayedUsername+` as sender_username
 		FROM messages m
 		JOIN users u ON u.id = m.sender_id
 		WHERE m.group_id = $1 AND NOT m.is_deleted
@@ -276,14 +417,28 @@ func (s *MessageService) GetGroupMessages(groupID uuid.UUID, limit, offset int)
 	}
 
 	// Decrypt messages if encryption is enabled
-	if s.encryptor != nil {
-		for i := range messages {
-			content, err := s.encryptor.DecryptString(messages[i].Content)
-			if err != nil {
-				return nil, err
-			}
-			messages[i].Content = content
+	replies := make([]*Message, len(messages))
+	for i := range messages {
+		content, err := s.encryptor.DecryptString(messages[i].Content)
+		if err != nil {
+			return nil, err
 		}
+		messages[i].Content = content
+		replies[i] = &messages[i]
+	}
+
+	hideViewOnceMedia(replies...)
+	if err := openMedia(s.encryptor, replies...); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(replies); err != nil {
+		return nil, err
+	}
+	if err := s.attachAnnotations(replies); err != nil {
+		return nil, err
+	}
+	if err := s.attachCards(replies); err != nil {
+		return nil, err
 	}
 
 	return messages, nil
@@ -291,80 +446,151 @@ func (s *MessageService) GetGroupMessages(groupID uuid.UUID, limit, offset int)
 
 // Update updates a message
 func (s *MessageService) Update(message *Message) error {
-	// Encrypt message content if encryption is enabled
-	if s.encryptor != nil {
-		encryptedContent, err := s.encryptor.EncryptString(message.Content)
-		if err != nil {
-			return err
-		}
-		message.Content = encryptedContent
+	// Encrypt message content
+	content, err := s.encryptor.EncryptString(message.Content)
+	if err != nil {
+		return err
 	}
 
-	result, err := s.db.Exec(`
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
 		UPDATE messages
 		SET content = $1, is_edited = true, updated_at = $2
 		WHERE id = $3 AND sender_id = $4 AND NOT is_deleted
-	`, message.Content, time.Now(), message.ID, message.SenderID)
-
+		RETURNING conversation_id, updated_at
+	`, content, time.Now(), message.ID, message.SenderID).Scan(&message.ConversationID, &message.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
+	if err := chainMessage(tx, message.ConversationID, message.ID, ChainEdited); err != nil {
 		return err
 	}
-
-	if rows == 0 {
-		return ErrNotFound
+	if err := storeAnnotations(tx, message.ID, message.Annotations); err != nil {
+		return err
+	}
+	if err := storePreview(tx, s.encryptor, message.ConversationID, message.ID, message.Content); err != nil {
+		return err
+	}
+	if err := storeMentions(tx, message, message.Content); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
+	message.IsEdited = true
 	return nil
 }
 
-// Delete soft deletes a message
-func (s *MessageService) Delete(messageID, userID uuid.UUID) error {
-	result, err := s.db.Exec(`
+// Delete soft deletes a message and returns the conversation it belonged to
+func (s *MessageService) Delete(messageID, userID uuid.UUID) (uuid.UUID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var conversationID uuid.UUID
+	err = tx.QueryRow(`
 		UPDATE messages
 		SET is_deleted = true, updated_at = $1
 		WHERE id = $2 AND sender_id = $3 AND NOT is_deleted
-	`, time.Now(), messageID, userID)
-
+		RETURNING conversation_id
+	`, time.Now(), messageID, userID).Scan(&conversationID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrNotFound
+	}
 	if err != nil {
-		return err
+		return uuid.Nil, err
+	}
+	if err := chainMessage(tx, conversationID, messageID, ChainDeleted); err != nil {
+		return uuid.Nil, err
 	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return conversationID, nil
+}
 
-	rows, err := result.RowsAffected()
+// fanOutMessage gives every other participant a pending status for a new message, sent
+// until one of their devices reports it delivered or read, so that what didn't reach
+// offline users is known. Large groups only keep watermarks and are left out.
+func fanOutMessage(tx *sqlx.Tx, message *Message) error {
+	_, err := tx.Exec(`
+		INSERT INTO message_status (message_id, user_id, status)
+		SELECT $1, cp.user_id, $4
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND NOT c.large_group
+		WHERE cp.conversation_id = $2 AND cp.user_id != $3
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, message.ID, message.ConversationID, message.SenderID, StatusSent)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to fan out message: %w", err)
 	}
+	return nil
+}
 
-	if rows == 0 {
-		return ErrNotFound
+// MarkDelivered moves a message that reached users from pending to delivered. Statuses
+// already further along are left alone.
+func (s *MessageService) MarkDelivered(messageID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(`
+		UPDATE message_status SET status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE message_id = $1 AND user_id = ANY($2::uuid[]) AND status = $4
+		  AND user_id != (SELECT sender_id FROM messages WHERE id = $1)
+	`, messageID, pq.StringArray(uuidStrings(userIDs)), StatusDelivered, StatusSent)
+	if err != nil {
+		return fmt.Errorf("failed to mark message delivered: %w", err)
 	}
-
 	return nil
 }
 
+// statusImplied holds for a status $3 of message m for user $2 that their read
+// watermark already implies, or, in large groups, that only watermarks are kept for.
+// Those are not stored: the watermark stands for them.
+const statusImplied = `$3::message_status_type IN ('delivered', 'read')
+	AND m.sender_id != $2
+	AND (EXISTS (
+		SELECT 1 FROM conversation_participants wp
+		WHERE wp.conversation_id = m.conversation_id AND wp.user_id = $2
+		  AND m.created_at >= wp.joined_at AND m.created_at <= wp.last_read_message_at
+	) OR EXISTS (
+		SELECT 1 FROM conversations lc WHERE lc.id = m.conversation_id AND lc.large_group
+	))`
+
 // UpdateMessageStatus updates the delivery/read status of a message
 func (s *MessageService) UpdateMessageStatus(messageID, userID uuid.UUID, status MessageStatus) error {
-	result, err := s.db.Exec(`
-		INSERT INTO message_status (message_id, user_id, status)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (message_id, user_id) DO UPDATE
-		SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
+	var exists bool
+	err := s.db.Get(&exists, `
+		WITH target AS (
+			SELECT id, conversation_id, sender_id, created_at FROM messages WHERE id = $1
+		), stored AS (
+			INSERT INTO message_status (message_id, user_id, status)
+			SELECT m.id, $2, $3::message_status_type FROM target m
+			WHERE NOT (`+statusImplied+`)
+			ON CONFLICT (message_id, user_id) DO UPDATE
+			SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
+			RETURNING 1
+		)
+		SELECT EXISTS (SELECT 1 FROM target)
 	`, messageID, userID, status)
 
 	if err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rows == 0 {
+	if !exists {
 		return ErrNotFound
 	}
 
@@ -373,19 +599,13 @@ func (s *MessageService) UpdateMessageStatus(messageID, userID uuid.UUID, status
 
 // BatchUpdateMessageStatus updates the status of multiple messages at once
 func (s *MessageService) BatchUpdateMessageStatus(messageIDs []uuid.UUID, userID uuid.UUID, status MessageStatus) error {
-	query, args, err := sqlx.In(`
+	_, err := s.db.Exec(`
 		INSERT INTO message_status (message_id, user_id, status)
-		VALUES (:message_id, :user_id, :status)
+		SELECT m.id, $2, $3::message_status_type FROM messages m
+		WHERE m.id = ANY($1::uuid[]) AND NOT (`+statusImplied+`)
 		ON CONFLICT (message_id, user_id) DO UPDATE
 		SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
-	`, messageIDs)
-
-	if err != nil {
-		return err
-	}
-
-	query = s.db.Rebind(query)
-	_, err = s.db.Exec(query, args...)
+	`, pq.StringArray(uuidStrings(messageIDs)), userID, status)
 	return err
 }
 
@@ -415,3 +635,44 @@ func (s *MessageService) GetMessageReactions(messageID uuid.UUID) ([]MessageReac
 	`, messageID)
 	return reactions, err
 }
+
+// PurgeExpiredMessages deletes up to limit messages sent before the retention period,
+// leaving out conversations on legal hold and those keeping an integrity chain, whose
+// verification needs every message. Replies to them lose their quote.
+func (s *MessageService) PurgeExpiredMessages(retention time.Duration, limit int) (int64, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ids []uuid.UUID
+	err = tx.Select(&ids, `
+		SELECT m.id FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND c.integrity_chain_since IS NULL
+		  AND `+notHeld("c")+`
+		ORDER BY m.created_at
+		LIMIT $2
+		FOR UPDATE OF m
+	`, retention.Seconds(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired messages: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec("UPDATE messages SET reply_to_id = NULL WHERE reply_to_id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to detach replies: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to purge messages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,68 @@
+package models_test
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"talkify/apps/api/internal/bench"
+	"talkify/apps/api/internal/models"
+)
+
+// benchMessagesEnv is how many messages the conversation read by the benchmarks holds
+const benchMessagesEnv = "TALKIFY_BENCH_MESSAGES"
+
+// benchPageSize is how many messages the read benchmark gets at once, the app's page size
+const benchPageSize = 50
+
+var (
+	seedOnce    sync.Once
+	benchSeeded *bench.Fixture
+	seedErr     error
+)
+
+// fixture seeds the conversation the message benchmarks share, once, and removes it
+// after the last of them
+func fixture(b *testing.B) (*bench.Fixture, *models.MessageService) {
+	db, encryptor := connect(b)
+	seedOnce.Do(func() {
+		messages := 1000
+		if value := os.Getenv(benchMessagesEnv); value != "" {
+			if messages, seedErr = strconv.Atoi(value); seedErr != nil {
+				return
+			}
+		}
+		if benchSeeded, seedErr = bench.Seed(db, encryptor, messages); seedErr == nil {
+			cleanups = append(cleanups, benchSeeded.Close)
+		}
+	})
+	if seedErr != nil {
+		b.Fatalf("Failed to seed: %v", seedErr)
+	}
+	return benchSeeded, models.NewMessageService(db, encryptor)
+}
+
+func BenchmarkGetConversationMessages(b *testing.B) {
+	f, messageService := fixture(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := messageService.GetConversationMessages(f.ConversationID, f.Users[0], benchPageSize, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateMessage grows the conversation; go test runs it after the read
+// benchmark, as it comes later in the file
+func BenchmarkCreateMessage(b *testing.B) {
+	f, messageService := fixture(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := messageService.Create(f.Message(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ChannelWebSocket is the ledger channel of messages that reached a connected device
+const ChannelWebSocket = "websocket"
+
+// RecordDeliveries notes in the delivery ledger that a message reached users on a
+// channel
+func (s *NotificationService) RecordDeliveries(messageID uuid.UUID, channel string, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO message_deliveries (message_id, user_id, channel)
+		SELECT $1, u.id, $2 FROM users u WHERE u.id = ANY($3::uuid[])
+		ON CONFLICT (message_id, user_id, channel) DO NOTHING
+	`, messageID, channel, pq.StringArray(uuidStrings(userIDs)))
+	if err != nil {
+		return fmt.Errorf("failed to record deliveries: %w", err)
+	}
+	return nil
+}
+
+// ClaimDeliveries records in the delivery ledger that a message is about to be sent to
+// users on a channel, and returns those it wasn't sent to on it before. Only they are
+// to be sent it, even when several servers route the same message.
+func (s *NotificationService) ClaimDeliveries(messageID uuid.UUID, channel string, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	claimed := []uuid.UUID{}
+	if len(userIDs) == 0 {
+		return claimed, nil
+	}
+	err := s.db.Select(&claimed, `
+		INSERT INTO message_deliveries (message_id, user_id, channel)
+		SELECT $1, u.id, $2 FROM users u WHERE u.id = ANY($3::uuid[])
+		ON CONFLICT (message_id, user_id, channel) DO NOTHING
+		RETURNING user_id
+	`, messageID, channel, pq.StringArray(uuidStrings(userIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	return claimed, nil
+}
+
+// SeenBy returns which of the users already saw a message: it reached one of their
+// connected devices, or one of their devices reported it delivered or read
+func (s *NotificationService) SeenBy(messageID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	seen := []uuid.UUID{}
+	err := s.db.Select(&seen, `
+		SELECT user_id FROM message_deliveries
+		WHERE message_id = $1 AND channel = $2 AND user_id = ANY($3::uuid[])
+		UNION
+		SELECT user_id FROM message_status
+		WHERE message_id = $1 AND status IN ('delivered', 'read') AND user_id = ANY($3::uuid[])
+	`, messageID, ChannelWebSocket, pq.StringArray(uuidStrings(userIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check deliveries: %w", err)
+	}
+	seenBy := make(map[uuid.UUID]bool, len(seen))
+	for _, id := range seen {
+		seenBy[id] = true
+	}
+	return seenBy, nil
+}
+
+// PurgeDeliveries forgets deliveries older than a cutoff, once no notification waits on
+// them, and returns how many were removed
+func (s *NotificationService) PurgeDeliveries(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM message_deliveries WHERE delivered_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,169 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"talkify/apps/api/internal/bench"
+	"talkify/apps/api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// reactionEmojis are the reactions each participant leaves on every message
+var reactionEmojis = []string{"👍", "❤️", "😂"}
+
+const reactedMessages = 20
+
+// seedReactions creates a conversation whose messages every participant has read and
+// reacted to with each of reactionEmojis, so that joining statuses or read receipts to
+// reactions would multiply them
+func seedReactions(t *testing.T) (*bench.Fixture, *models.MessageService, []uuid.UUID) {
+	db, encryptor := connect(t)
+	f, err := bench.Seed(db, encryptor, reactedMessages)
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := f.Close(); err != nil {
+			t.Errorf("Failed to clean up: %v", err)
+		}
+	})
+
+	var ids []uuid.UUID
+	if err := db.Select(&ids, `SELECT id FROM messages WHERE conversation_id = $1 ORDER BY created_at`, f.ConversationID); err != nil {
+		t.Fatalf("Failed to list messages: %v", err)
+	}
+	messageService := models.NewMessageService(db, encryptor)
+	for _, userID := range f.Users {
+		if err := messageService.BatchUpdateMessageStatus(ids, userID, models.StatusRead); err != nil {
+			t.Fatalf("Failed to read messages: %v", err)
+		}
+		for _, id := range ids {
+			for _, emoji := range reactionEmojis {
+				if err := messageService.AddReaction(id, userID, emoji); err != nil {
+					t.Fatalf("Failed to react: %v", err)
+				}
+			}
+		}
+	}
+	return f, messageService, ids
+}
+
+// checkReactions fails unless each message has every reaction made to it exactly once,
+// in the order they were made
+func checkReactions(t *testing.T, messages []models.Message, users int) {
+	t.Helper()
+	want := users * len(reactionEmojis)
+	for _, message := range messages {
+		if len(message.Reactions) != want {
+			t.Errorf("message %s has %d reactions, want %d", message.ID, len(message.Reactions), want)
+			continue
+		}
+		seen := map[uuid.UUID]bool{}
+		for i, reaction := range message.Reactions {
+			if seen[reaction.ID] {
+				t.Errorf("message %s has reaction %s more than once", message.ID, reaction.ID)
+			}
+			seen[reaction.ID] = true
+			if reaction.MessageID != message.ID {
+				t.Errorf("message %s has reaction %s of message %s", message.ID, reaction.ID, reaction.MessageID)
+			}
+			if i > 0 && reaction.CreatedAt.Before(message.Reactions[i-1].CreatedAt) {
+				t.Errorf("message %s has reaction %s out of order", message.ID, reaction.ID)
+			}
+		}
+	}
+}
+
+func TestConversationMessagesReactions(t *testing.T) {
+	f, messageService, _ := seedReactions(t)
+	messages, err := messageService.GetConversationMessages(f.ConversationID, f.Users[0], reactedMessages, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != reactedMessages {
+		t.Fatalf("got %d messages, want %d", len(messages), reactedMessages)
+	}
+	checkReactions(t, messages, len(f.Users))
+}
+
+func TestMessagesByIDReactions(t *testing.T) {
+	f, messageService, ids := seedReactions(t)
+	messages, err := messageService.GetByIDsForUser(ids, f.Users[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(ids) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(ids))
+	}
+	checkReactions(t, messages, len(f.Users))
+}
+
+// planNode is the part of a node of EXPLAIN (ANALYZE, FORMAT JSON) output the plan test
+// reads
+type planNode struct {
+	NodeType       string     `json:"Node Type"`
+	RelationName   string     `json:"Relation Name"`
+	ActualRows     float64    `json:"Actual Rows"`
+	ActualLoops    float64    `json:"Actual Loops"`
+	RemovedFilter  float64    `json:"Rows Removed by Filter"`
+	RemovedRecheck float64    `json:"Rows Removed by Index Recheck"`
+	Plans          []planNode `json:"Plans"`
+}
+
+// examined adds up the rows the nodes under n read from relation, counting every loop
+func (n planNode) examined(relation string) (rows float64, scans []string) {
+	if n.RelationName == relation {
+		rows = (n.ActualRows + n.RemovedFilter + n.RemovedRecheck) * n.ActualLoops
+		scans = append(scans, n.NodeType)
+	}
+	for _, child := range n.Plans {
+		childRows, childScans := child.examined(relation)
+		rows += childRows
+		scans = append(scans, childScans...)
+	}
+	return rows, scans
+}
+
+// TestConversationMessagesPlan checks that reading a conversation reads no more
+// reactions than it holds, however many statuses its messages have. A test database
+// holds too few reactions for the planner to prefer their index, so sequential scans
+// are turned off to see the plan a large one gets.
+func TestConversationMessagesPlan(t *testing.T) {
+	f, _, _ := seedReactions(t)
+	db, _ := connect(t)
+	if _, err := db.Exec(`ANALYZE message_reactions`); err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SET LOCAL enable_seqscan = off`); err != nil {
+		t.Fatal(err)
+	}
+	var output []byte
+	err = tx.QueryRow(`EXPLAIN (ANALYZE, FORMAT JSON) `+models.ConversationMessagesQuery,
+		f.ConversationID, reactedMessages, 0, f.Users[0]).Scan(&output)
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(output, &plans); err != nil || len(plans) != 1 {
+		t.Fatalf("Failed to read plan %s: %v", output, err)
+	}
+
+	rows, scans := plans[0].Plan.examined("message_reactions")
+	if len(scans) == 0 {
+		t.Fatalf("message_reactions is not read:\n%s", output)
+	}
+	reactions := float64(reactedMessages * len(f.Users) * len(reactionEmojis))
+	if rows > reactions {
+		t.Errorf("read %.0f message_reactions rows for %.0f reactions:\n%s", rows, reactions, output)
+	}
+}
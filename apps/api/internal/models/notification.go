@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Notification types
+const (
+	NotificationNewLogin          = "security.new_login"
+	NotificationRecoveryRequested = "security.recovery_requested"
+	NotificationRecoveryApproval  = "security.recovery_approval"
+	NotificationAccountRecovered  = "security.account_recovered"
+	NotificationUrgentBroadcast   = "broadcast.urgent"
+	NotificationMissedUpdates     = "delivery.missed"
+
+	NotificationImpersonationRequested = "security.impersonation_requested"
+	NotificationImpersonationApproved  = "security.impersonation_approved"
+	NotificationImpersonationDecided   = "support.impersonation_decided"
+
+	NotificationKeywordAlert = "message.keyword"
+	NotificationAutomation   = "conversation.automation"
+
+	NotificationDirectMessage = "message.direct"
+	NotificationMention       = "message.mention"
+	NotificationGroupMessage  = "message.group"
+)
+
+// Notification is an entry in a user's notification center
+type Notification struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	UserID    uuid.UUID  `db:"user_id" json:"-"`
+	Type      string     `db:"type" json:"type"`
+	Title     string     `db:"title" json:"title"`
+	Body      string     `db:"body" json:"body"`
+	ReadAt    *time.Time `db:"read_at" json:"read_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	// LoginAlertID is set on sign-in notifications, which the user can report as not
+	// theirs; see LoginAlertService.Report
+	LoginAlertID *uuid.UUID `db:"login_alert_id" json:"login_alert_id,omitempty"`
+	// ConversationID and MessageID are set on keyword alerts and message notifications,
+	// for opening the message
+	ConversationID *uuid.UUID `db:"conversation_id" json:"conversation_id,omitempty"`
+	MessageID      *uuid.UUID `db:"message_id" json:"message_id,omitempty"`
+}
+
+// NotificationService manages users' notification centers
+type NotificationService struct {
+	db *sqlx.DB
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(db *sqlx.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Create adds a notification to a user's notification center
+func (s *NotificationService) Create(userID uuid.UUID, notificationType, title, body string) (*Notification, error) {
+	return s.create(&Notification{UserID: userID, Type: notificationType, Title: title, Body: body})
+}
+
+// CreateLoginAlert adds the notification of a sign-in to its user's notification center
+func (s *NotificationService) CreateLoginAlert(alert *LoginAlert, title, body string) (*Notification, error) {
+	return s.create(&Notification{
+		UserID: alert.UserID, Type: NotificationNewLogin, Title: title, Body: body, LoginAlertID: &alert.ID,
+	})
+}
+
+// CreateKeywordAlert adds the notification of a keyword coming up in a message to a
+// user's notification center
+func (s *NotificationService) CreateKeywordAlert(userID uuid.UUID, message *Message, title, body string) (*Notification, error) {
+	return s.create(&Notification{
+		UserID: userID, Type: NotificationKeywordAlert, Title: title, Body: body,
+		ConversationID: &message.ConversationID, MessageID: &message.ID,
+	})
+}
+
+// CreateMessageNotification adds the notification of a new message to a user's
+// notification center
+func (s *NotificationService) CreateMessageNotification(userID uuid.UUID, notificationType string, message *Message, title, body string) (*Notification, error) {
+	return s.create(&Notification{
+		UserID: userID, Type: notificationType, Title: title, Body: body,
+		ConversationID: &message.ConversationID, MessageID: &message.ID,
+	})
+}
+
+// MessageRecipient is a participant to notify of a new message
+type MessageRecipient struct {
+	UserID    uuid.UUID `db:"user_id"`
+	Mentioned bool      `db:"mentioned"`
+	// Preview is the one the participant picked for the conversation, or their default
+	Preview string `db:"preview"`
+}
+
+// Recipients returns the active participants of a message's conversation other than its
+// sender, whether it mentions them and the preview they want. Participants who muted the
+// conversation are left out unless it mentions them, as are shadow accounts of other
+// deployments' users, who are reached through federation instead.
+func (s *NotificationService) Recipients(message *Message) ([]MessageRecipient, error) {
+	recipients := []MessageRecipient{}
+	err := s.db.Select(&recipients, `
+		SELECT cp.user_id, mm.user_id IS NOT NULL AS mentioned,
+			COALESCE(cp.notification_preview, np.preview, '`+defaultNotificationPreview+`') AS preview
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id AND u.is_active AND NOT u.is_system AND u.federated_address IS NULL
+		LEFT JOIN notification_preferences np ON np.user_id = cp.user_id
+		LEFT JOIN message_mentions mm ON mm.message_id = $2 AND mm.user_id = cp.user_id
+		WHERE cp.conversation_id = $1 AND cp.user_id != $3
+		  AND (mm.user_id IS NOT NULL OR NOT `+participantMuted+`)
+	`, message.ConversationID, message.ID, message.SenderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+func (s *NotificationService) create(n *Notification) (*Notification, error) {
+	notification := &Notification{}
+	err := s.db.Get(notification, `
+		INSERT INTO notifications (user_id, type, title, body, login_alert_id, conversation_id, message_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *
+	`, n.UserID, n.Type, n.Title, n.Body, n.LoginAlertID, n.ConversationID, n.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+	return notification, nil
+}
+
+// List returns a user's notifications, newest first, along with how many are unread
+func (s *NotificationService) List(userID uuid.UUID, unreadOnly bool, limit, offset int) ([]Notification, int, error) {
+	notifications := []Notification{}
+	err := s.db.Select(&notifications, `
+		SELECT * FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	var unread int
+	err = s.db.Get(&unread, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return notifications, unread, nil
+}
+
+// MarkRead marks one of a user's notifications read
+func (s *NotificationService) MarkRead(userID, notificationID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every notification of a user read and returns how many were unread
+func (s *NotificationService) MarkAllRead(userID uuid.UUID) (int64, error) {
+	result, err := s.db.Exec(`
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return result.RowsAffected()
+}
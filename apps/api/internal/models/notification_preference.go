@@ -0,0 +1,301 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Events users route to notification channels
+const (
+	NotifyDirectMessage = "dm"
+	NotifyMention       = "mention"
+	NotifyGroupMessage  = "group_message"
+	NotifyCall          = "call"
+)
+
+// Notification channels. ChannelNone, alone, routes an event nowhere.
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelNone  = "none"
+)
+
+// Notification previews, from most to least revealing: the message itself, only who
+// sent it, or neither
+const (
+	PreviewFull    = "full"
+	PreviewSender  = "sender"
+	PreviewGeneric = "generic"
+)
+
+// NotificationPreviews are the previews users pick from, most revealing first
+var NotificationPreviews = []string{PreviewFull, PreviewSender, PreviewGeneric}
+
+// defaultNotificationPreview names the sender but doesn't show the message
+const defaultNotificationPreview = PreviewSender
+
+// StricterPreview returns the less revealing of two previews. Unknown previews count
+// as generic.
+func StricterPreview(a, b string) string {
+	if previewRank(a) >= previewRank(b) {
+		return a
+	}
+	return b
+}
+
+func previewRank(preview string) int {
+	for i, p := range NotificationPreviews {
+		if p == preview {
+			return i
+		}
+	}
+	return len(NotificationPreviews)
+}
+
+// NotificationEvents are the events notification preferences cover
+var NotificationEvents = []string{NotifyDirectMessage, NotifyMention, NotifyGroupMessage, NotifyCall}
+
+// NotificationChannels are the channels events can be routed to
+var NotificationChannels = []string{ChannelPush, ChannelEmail, ChannelSMS}
+
+// defaultNotificationRoutes apply to events a user hasn't routed. Group messages are
+// only seen in the app unless asked for.
+var defaultNotificationRoutes = NotificationRoutes{
+	NotifyDirectMessage: {ChannelPush},
+	NotifyMention:       {ChannelPush},
+	NotifyGroupMessage:  {},
+	NotifyCall:          {ChannelPush},
+}
+
+// NotificationRoutes maps events to the channels they go out on
+type NotificationRoutes map[string][]string
+
+func (r *NotificationRoutes) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		*r = NotificationRoutes{}
+		return nil
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// QuietHours is when a channel stays quiet each day, from Start to End in the user's
+// timezone. A Start after End spans midnight.
+type QuietHours struct {
+	Start string `json:"start" example:"22:00"`
+	End   string `json:"end" example:"07:00"`
+}
+
+// ChannelQuietHours maps channels to their quiet hours
+type ChannelQuietHours map[string]QuietHours
+
+func (q *ChannelQuietHours) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		*q = ChannelQuietHours{}
+		return nil
+	}
+	return json.Unmarshal(bytes, q)
+}
+
+// NotificationPreferences are how a user wants to be notified of messages and calls
+type NotificationPreferences struct {
+	UserID uuid.UUID `db:"user_id" json:"-"`
+	// Routes has the channels of every event, defaults included
+	Routes     NotificationRoutes `db:"routes" json:"routes"`
+	QuietHours ChannelQuietHours  `db:"quiet_hours" json:"quiet_hours"`
+	// Preview is how much of a message its notifications show, unless a conversation
+	// overrides it
+	Preview string `db:"preview" json:"preview" example:"sender"`
+	// MinPreview is the most revealing preview the server allows; notifications never
+	// show more, whatever the user picked
+	MinPreview string `db:"-" json:"min_preview" example:"full"`
+	// Timezone is the user's, which quiet hours are in; it is set on the user's profile
+	Timezone  string     `db:"timezone" json:"timezone" example:"Europe/Berlin"`
+	UpdatedAt *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+}
+
+// DefaultNotificationPreferences are the preferences of users who haven't set any
+func DefaultNotificationPreferences(userID uuid.UUID) *NotificationPreferences {
+	p := &NotificationPreferences{UserID: userID, QuietHours: ChannelQuietHours{}, Preview: defaultNotificationPreview, Timezone: "UTC"}
+	p.fillDefaults()
+	return p
+}
+
+// fillDefaults routes the events left out to their default channels
+func (p *NotificationPreferences) fillDefaults() {
+	if p.Routes == nil {
+		p.Routes = NotificationRoutes{}
+	}
+	for event, channels := range defaultNotificationRoutes {
+		if _, ok := p.Routes[event]; !ok {
+			p.Routes[event] = append([]string{}, channels...)
+		}
+	}
+	if p.QuietHours == nil {
+		p.QuietHours = ChannelQuietHours{}
+	}
+}
+
+// Validate checks preferences and normalizes their routes, turning "none" into no
+// channels. Events left out keep their defaults, as does a missing preview.
+func (p *NotificationPreferences) Validate() error {
+	if p.Preview == "" {
+		p.Preview = defaultNotificationPreview
+	}
+	if !contains(NotificationPreviews, p.Preview) {
+		return fmt.Errorf("%w: unknown preview %q", ErrInvalidInput, p.Preview)
+	}
+	for event, channels := range p.Routes {
+		if !contains(NotificationEvents, event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidInput, event)
+		}
+		if channels == nil || (len(channels) == 1 && channels[0] == ChannelNone) {
+			p.Routes[event] = []string{}
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, channel := range channels {
+			if channel == ChannelNone {
+				return fmt.Errorf("%w: \"none\" can't be combined with other channels for %s", ErrInvalidInput, event)
+			}
+			if !contains(NotificationChannels, channel) {
+				return fmt.Errorf("%w: unknown channel %q for %s", ErrInvalidInput, channel, event)
+			}
+			if seen[channel] {
+				return fmt.Errorf("%w: channel %q is listed twice for %s", ErrInvalidInput, channel, event)
+			}
+			seen[channel] = true
+		}
+	}
+	for channel, hours := range p.QuietHours {
+		if !contains(NotificationChannels, channel) {
+			return fmt.Errorf("%w: unknown channel %q in quiet hours", ErrInvalidInput, channel)
+		}
+		start, errStart := clockMinutes(hours.Start)
+		end, errEnd := clockMinutes(hours.End)
+		if errStart != nil || errEnd != nil {
+			return fmt.Errorf("%w: quiet hours of %s need a start and end as HH:MM", ErrInvalidInput, channel)
+		}
+		if start == end {
+			return fmt.Errorf("%w: quiet hours of %s start when they end", ErrInvalidInput, channel)
+		}
+	}
+	return nil
+}
+
+// Channels returns the channels event goes out on at now, leaving out those in their
+// quiet hours
+func (p *NotificationPreferences) Channels(event string, now time.Time) []string {
+	local := now.In(location(p.Timezone))
+	minute := local.Hour()*60 + local.Minute()
+
+	channels := []string{}
+	for _, channel := range p.Routes[event] {
+		if hours, ok := p.QuietHours[channel]; ok && hours.covers(minute) {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// covers reports whether a minute of the day falls within the quiet hours
+func (q QuietHours) covers(minute int) bool {
+	start, errStart := clockMinutes(q.Start)
+	end, errEnd := clockMinutes(q.End)
+	if errStart != nil || errEnd != nil {
+		return false
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// clockMinutes parses an HH:MM time of day into minutes since midnight
+func clockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPreferences returns a user's notification preferences, defaults included
+func (s *NotificationService) GetPreferences(userID uuid.UUID) (*NotificationPreferences, error) {
+	preferences, err := s.GetPreferencesForUsers([]uuid.UUID{userID})
+	if err != nil {
+		return nil, err
+	}
+	return preferences[userID], nil
+}
+
+// GetPreferencesForUsers returns the notification preferences of several users with a
+// single query, defaults included
+func (s *NotificationService) GetPreferencesForUsers(userIDs []uuid.UUID) (map[uuid.UUID]*NotificationPreferences, error) {
+	rows := []NotificationPreferences{}
+	err := s.db.Select(&rows, `
+		SELECT u.id AS user_id, np.routes, np.quiet_hours, COALESCE(np.preview, '`+defaultNotificationPreview+`') AS preview,
+			u.timezone, np.updated_at
+		FROM users u
+		LEFT JOIN notification_preferences np ON np.user_id = u.id
+		WHERE u.id = ANY($1::uuid[])
+	`, pq.StringArray(uuidStrings(userIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	preferences := make(map[uuid.UUID]*NotificationPreferences, len(userIDs))
+	for i := range rows {
+		rows[i].fillDefaults()
+		preferences[rows[i].UserID] = &rows[i]
+	}
+	for _, id := range userIDs {
+		if preferences[id] == nil {
+			preferences[id] = DefaultNotificationPreferences(id)
+		}
+	}
+	return preferences, nil
+}
+
+// SetPreferences replaces a user's notification preferences; see Validate
+func (s *NotificationService) SetPreferences(userID uuid.UUID, preferences *NotificationPreferences) (*NotificationPreferences, error) {
+	if err := preferences.Validate(); err != nil {
+		return nil, err
+	}
+	routes, err := json.Marshal(preferences.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode routes: %w", err)
+	}
+	quietHours, err := json.Marshal(preferences.QuietHours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode quiet hours: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO notification_preferences (user_id, routes, quiet_hours, preview)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET routes = EXCLUDED.routes, quiet_hours = EXCLUDED.quiet_hours, preview = EXCLUDED.preview,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, routes, quietHours, preferences.Preview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set notification preferences: %w", err)
+	}
+	return s.GetPreferences(userID)
+}
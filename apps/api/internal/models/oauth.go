@@ -0,0 +1,380 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxApplicationsPerUser bounds how many applications a single user may register
+	maxApplicationsPerUser = 10
+	// authorizationCodeTTL is how long an authorization code can be exchanged for a token
+	authorizationCodeTTL = 10 * time.Minute
+)
+
+var (
+	ErrApplicationNotFound = errors.New("application not found")
+	ErrApplicationLimit    = errors.New("application limit reached")
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidRedirectURI  = errors.New("redirect uri is not registered for this application")
+	ErrInvalidScope        = errors.New("requested scope is not allowed for this application")
+	ErrInvalidGrant        = errors.New("authorization code is invalid or expired")
+	ErrConsentRequired     = errors.New("user has not granted access to this application")
+)
+
+// OAuthApplication is a third-party application registered by a user
+type OAuthApplication struct {
+	ID               uuid.UUID      `db:"id" json:"id"`
+	OwnerID          uuid.UUID      `db:"owner_id" json:"owner_id"`
+	Name             string         `db:"name" json:"name"`
+	ClientID         string         `db:"client_id" json:"client_id"`
+	ClientSecretHash string         `db:"client_secret_hash" json:"-"`
+	RedirectURIs     pq.StringArray `db:"redirect_uris" json:"redirect_uris"`
+	Scopes           pq.StringArray `db:"scopes" json:"scopes"`
+	RevokedAt        *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt        time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// OAuthGrant records the scopes a user consented to for an application
+type OAuthGrant struct {
+	ApplicationID   uuid.UUID      `db:"application_id" json:"application_id"`
+	ApplicationName string         `db:"application_name" json:"application_name"`
+	ClientID        string         `db:"client_id" json:"client_id"`
+	UserID          uuid.UUID      `db:"user_id" json:"user_id"`
+	Scopes          pq.StringArray `db:"scopes" json:"scopes"`
+	CreatedAt       time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+type CreateApplicationInput struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,url"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+}
+
+// OAuthService manages third-party applications, consent and authorization codes
+type OAuthService struct {
+	db *sqlx.DB
+}
+
+// NewOAuthService creates a new OAuth service
+func NewOAuthService(db *sqlx.DB) *OAuthService {
+	return &OAuthService{db: db}
+}
+
+// CreateApplication registers an application and returns it with its plaintext client secret.
+// The secret is only stored hashed and cannot be retrieved again.
+func (s *OAuthService) CreateApplication(ownerID uuid.UUID, input *CreateApplicationInput) (*OAuthApplication, string, error) {
+	var count int
+	err := s.db.Get(&count, `
+		SELECT COUNT(*) FROM oauth_applications
+		WHERE owner_id = $1 AND revoked_at IS NULL
+	`, ownerID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count applications: %w", err)
+	}
+	if count >= maxApplicationsPerUser {
+		return nil, "", ErrApplicationLimit
+	}
+
+	clientID, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to hash client secret: %w", err)
+	}
+
+	app := &OAuthApplication{}
+	err = s.db.QueryRowx(`
+		INSERT INTO oauth_applications (owner_id, name, client_id, client_secret_hash, redirect_uris, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *
+	`, ownerID, input.Name, clientID, string(secretHash), pq.StringArray(input.RedirectURIs), pq.StringArray(input.Scopes)).StructScan(app)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create application: %w", err)
+	}
+
+	return app, secret, nil
+}
+
+// GetUserApplications lists the applications registered by a user
+func (s *OAuthService) GetUserApplications(ownerID uuid.UUID) ([]OAuthApplication, error) {
+	apps := []OAuthApplication{}
+	err := s.db.Select(&apps, `
+		SELECT * FROM oauth_applications
+		WHERE owner_id = $1
+		ORDER BY created_at DESC
+	`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applications: %w", err)
+	}
+	return apps, nil
+}
+
+// GetApplicationByClientID returns an active application by its client ID
+func (s *OAuthService) GetApplicationByClientID(clientID string) (*OAuthApplication, error) {
+	app := &OAuthApplication{}
+	err := s.db.Get(app, `
+		SELECT * FROM oauth_applications
+		WHERE client_id = $1 AND revoked_at IS NULL
+	`, clientID)
+	if err == sql.ErrNoRows {
+		return nil, ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get application: %w", err)
+	}
+	return app, nil
+}
+
+// AuthenticateClient returns the active application with clientID when clientSecret
+// is its secret, and ErrInvalidClient otherwise
+func (s *OAuthService) AuthenticateClient(clientID, clientSecret string) (*OAuthApplication, error) {
+	app, err := s.GetApplicationByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, ErrApplicationNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(app.ClientSecretHash), []byte(clientSecret)); err != nil {
+		return nil, ErrInvalidClient
+	}
+	return app, nil
+}
+
+// IsActiveApplication reports whether an application exists and is not revoked
+func (s *OAuthService) IsActiveApplication(applicationID uuid.UUID) (bool, error) {
+	var active bool
+	err := s.db.Get(&active, `
+		SELECT EXISTS (SELECT 1 FROM oauth_applications WHERE id = $1 AND revoked_at IS NULL)
+	`, applicationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check application: %w", err)
+	}
+	return active, nil
+}
+
+// RevokeApplication disables an application owned by the user, returning its client
+// ID. Tokens already issued to it stop working because the auth middleware checks the
+// grant on every request.
+func (s *OAuthService) RevokeApplication(applicationID, ownerID uuid.UUID) (string, error) {
+	var clientID string
+	err := s.db.Get(&clientID, `
+		UPDATE oauth_applications
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND owner_id = $2 AND revoked_at IS NULL
+		RETURNING client_id
+	`, applicationID, ownerID)
+	if err == sql.ErrNoRows {
+		return "", ErrApplicationNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke application: %w", err)
+	}
+	return clientID, nil
+}
+
+// ValidateAuthorizationRequest checks that the redirect URI and scopes are allowed for the application
+func (s *OAuthService) ValidateAuthorizationRequest(app *OAuthApplication, redirectURI string, scopes []string) error {
+	registered := false
+	for _, uri := range app.RedirectURIs {
+		if uri == redirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return ErrInvalidRedirectURI
+	}
+
+	if len(scopes) == 0 {
+		return ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		allowed := false
+		for _, appScope := range app.Scopes {
+			if appScope == scope {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+// Authorize records the user's consent and issues a single-use authorization code
+func (s *OAuthService) Authorize(app *OAuthApplication, userID uuid.UUID, redirectURI string, scopes []string) (string, error) {
+	if err := s.ValidateAuthorizationRequest(app, redirectURI, scopes); err != nil {
+		return "", err
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO oauth_grants (application_id, user_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (application_id, user_id) DO UPDATE
+		SET scopes = EXCLUDED.scopes, updated_at = CURRENT_TIMESTAMP
+	`, app.ID, userID, pq.StringArray(scopes))
+	if err != nil {
+		return "", fmt.Errorf("failed to record consent: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO oauth_authorization_codes (code_hash, application_id, user_id, redirect_uri, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, hashToken(code), app.ID, userID, redirectURI, pq.StringArray(scopes), time.Now().Add(authorizationCodeTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return code, nil
+}
+
+// ExchangeCode authenticates the client and consumes an authorization code,
+// returning the user and scopes the token should be issued for.
+func (s *OAuthService) ExchangeCode(clientID, clientSecret, code, redirectURI string) (uuid.UUID, []string, error) {
+	app, err := s.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	var grant struct {
+		UserID      uuid.UUID      `db:"user_id"`
+		RedirectURI string         `db:"redirect_uri"`
+		Scopes      pq.StringArray `db:"scopes"`
+	}
+	// Mark the code as used in the same statement so it can never be exchanged twice
+	err = s.db.Get(&grant, `
+		UPDATE oauth_authorization_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE code_hash = $1
+		  AND application_id = $2
+		  AND used_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id, redirect_uri, scopes
+	`, hashToken(code), app.ID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if grant.RedirectURI != redirectURI {
+		return uuid.Nil, nil, ErrInvalidGrant
+	}
+
+	return grant.UserID, grant.Scopes, nil
+}
+
+// GetGrantScopes returns the scopes currently granted by a user to an active application
+func (s *OAuthService) GetGrantScopes(clientID string, userID uuid.UUID) ([]string, error) {
+	var scopes pq.StringArray
+	err := s.db.Get(&scopes, `
+		SELECT g.scopes
+		FROM oauth_grants g
+		JOIN oauth_applications a ON a.id = g.application_id AND a.revoked_at IS NULL
+		WHERE a.client_id = $1 AND g.user_id = $2
+	`, clientID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrConsentRequired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grant: %w", err)
+	}
+	return scopes, nil
+}
+
+// GetUserGrants lists the applications a user has granted access to
+func (s *OAuthService) GetUserGrants(userID uuid.UUID) ([]OAuthGrant, error) {
+	grants := []OAuthGrant{}
+	err := s.db.Select(&grants, `
+		SELECT
+			g.application_id,
+			a.name as application_name,
+			a.client_id,
+			g.user_id,
+			g.scopes,
+			g.created_at,
+			g.updated_at
+		FROM oauth_grants g
+		JOIN oauth_applications a ON a.id = g.application_id AND a.revoked_at IS NULL
+		WHERE g.user_id = $1
+		ORDER BY g.updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grants: %w", err)
+	}
+	return grants, nil
+}
+
+// RevokeGrant withdraws a user's consent for an application
+func (s *OAuthService) RevokeGrant(clientID string, userID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		DELETE FROM oauth_grants g
+		USING oauth_applications a
+		WHERE a.id = g.application_id AND a.client_id = $1 AND g.user_id = $2
+	`, clientID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke grant: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrConsentRequired
+	}
+	return nil
+}
+
+// randomToken returns a URL-safe random string built from n random bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DeletedUserName is shown in place of the username of deactivated users, whose
+// messages and memberships stay visible
+const DeletedUserName = "Deleted user"
+
+// displayedUsername is the username of the users row u as others see it
+const displayedUsername = `CASE WHEN u.is_active THEN u.username ELSE '` + DeletedUserName + `' END`
+
+// OrphanCleanup counts the rows a cleanup removed
+type OrphanCleanup struct {
+	Participants int64
+	Statuses     int64
+	Reactions    int64
+}
+
+// Total is the number of rows removed
+func (o OrphanCleanup) Total() int64 {
+	return o.Participants + o.Statuses + o.Reactions
+}
+
+type OrphanService struct {
+	db *sqlx.DB
+}
+
+func NewOrphanService(db *sqlx.DB) *OrphanService {
+	return &OrphanService{db: db}
+}
+
+// Cleanup removes up to limit rows of each kind left behind by soft deletes:
+//   - memberships of anonymized users in groups, other than owners, who stay listed
+//     as DeletedUserName until the group has another owner. Direct conversations keep
+//     them, so the other participant still has the conversation.
+//   - statuses and reactions on deleted messages
+//   - statuses and reactions of deactivated users who no longer take part in the
+//     message's conversation
+//
+// Conversations on legal hold are left alone.
+func (s *OrphanService) Cleanup(limit int) (OrphanCleanup, error) {
+	var cleanup OrphanCleanup
+
+	result, err := s.db.Exec(`
+		DELETE FROM conversation_participants
+		WHERE (conversation_id, user_id) IN (
+			SELECT cp.conversation_id, cp.user_id
+			FROM conversation_participants cp
+			JOIN users u ON u.id = cp.user_id AND u.anonymized_at IS NOT NULL
+			JOIN conversations c ON c.id = cp.conversation_id AND c.type = 'group'
+			WHERE COALESCE(cp.role, 'member') != 'owner' AND `+notHeld("c")+`
+			LIMIT $1
+		)
+	`, limit)
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to remove orphaned participants: %w", err)
+	}
+	cleanup.Participants, _ = result.RowsAffected()
+
+	result, err = s.db.Exec(`
+		DELETE FROM message_status
+		WHERE (message_id, user_id) IN (
+			SELECT ms.message_id, ms.user_id
+			FROM message_status ms
+			JOIN messages m ON m.id = ms.message_id
+			JOIN conversations c ON c.id = m.conversation_id
+			JOIN users u ON u.id = ms.user_id
+			WHERE (m.is_deleted OR (NOT u.is_active AND NOT EXISTS (
+				SELECT 1 FROM conversation_participants cp
+				WHERE cp.conversation_id = m.conversation_id AND cp.user_id = ms.user_id
+			))) AND `+notHeld("c")+`
+			LIMIT $1
+		)
+	`, limit)
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to remove orphaned statuses: %w", err)
+	}
+	cleanup.Statuses, _ = result.RowsAffected()
+
+	result, err = s.db.Exec(`
+		DELETE FROM message_reactions
+		WHERE id IN (
+			SELECT r.id
+			FROM message_reactions r
+			JOIN messages m ON m.id = r.message_id
+			JOIN conversations c ON c.id = m.conversation_id
+			JOIN users u ON u.id = r.user_id
+			WHERE (m.is_deleted OR (NOT u.is_active AND NOT EXISTS (
+				SELECT 1 FROM conversation_participants cp
+				WHERE cp.conversation_id = m.conversation_id AND cp.user_id = r.user_id
+			))) AND `+notHeld("c")+`
+			LIMIT $1
+		)
+	`, limit)
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to remove orphaned reactions: %w", err)
+	}
+	cleanup.Reactions, _ = result.RowsAffected()
+	return cleanup, nil
+}
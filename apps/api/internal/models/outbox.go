@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/contentfilter"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// MaxUndoSendSeconds is the longest undo send window a user can choose
+	MaxUndoSendSeconds = 30
+	// maxReleaseAttempts is how often releasing a held message is tried before it is dropped
+	maxReleaseAttempts = 5
+	// releaseRetryDelay is how much longer a held message waits after each failed release
+	releaseRetryDelay = 10 * time.Second
+)
+
+// PendingMessage is a message held in the outbox for its sender's undo send window
+type PendingMessage struct {
+	ID             uuid.UUID `db:"id" json:"id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	SenderID       uuid.UUID `db:"sender_id" json:"sender_id"`
+	Payload        string    `db:"payload" json:"-"`
+	Attempts       int       `db:"attempts" json:"-"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	ReleaseAt      time.Time `db:"release_at" json:"release_at"`
+}
+
+// Hold keeps message in the outbox until window has passed, giving it the ID it will
+// have once released. The content is encrypted like that of sent messages.
+func (s *MessageService) Hold(message *Message, window time.Duration) (*PendingMessage, error) {
+	return s.hold(s.db, message, window)
+}
+
+// hold writes message to the outbox through q; see Hold
+func (s *MessageService) hold(q sqlx.Queryer, message *Message, window time.Duration) (*PendingMessage, error) {
+	message.ID = uuid.New()
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	sealed, err := s.encryptor.EncryptString(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	pending := &PendingMessage{}
+	err = sqlx.Get(q, pending, `
+		INSERT INTO message_outbox (id, conversation_id, sender_id, payload, release_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *
+	`, message.ID, message.ConversationID, message.SenderID, sealed, time.Now().Add(window))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hold message: %w", err)
+	}
+	message.CreatedAt = pending.CreatedAt
+	message.UpdatedAt = pending.CreatedAt
+	return pending, nil
+}
+
+// CancelPending withdraws a held message of the sender's. Messages that were released,
+// or whose window has passed, return ErrNotFound.
+func (s *MessageService) CancelPending(id, senderID uuid.UUID) (*PendingMessage, error) {
+	pending := &PendingMessage{}
+	err := s.db.Get(pending, `
+		DELETE FROM message_outbox
+		WHERE id = $1 AND sender_id = $2 AND release_at > NOW()
+		RETURNING *
+	`, id, senderID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel message: %w", err)
+	}
+	return pending, nil
+}
+
+// ReleaseDue writes up to limit held messages whose window has passed to their
+// conversations, in the order they were sent, and returns them. Each is released in
+// its own transaction, taken with SKIP LOCKED so that several instances can release at
+// once. The checks a new message passes are run again, since the conversation may have
+// changed during the window: a message its sender may no longer send, because they left,
+// lost the permission or the conversation is locked, is dropped, and so is one filter
+// blocks. filter runs the conversation's content filter over the message. One that
+// keeps failing is dropped after maxReleaseAttempts.
+func (s *MessageService) ReleaseDue(limit int, filter func(*Message) error) ([]Message, error) {
+	released := []Message{}
+	for len(released) < limit {
+		message, pending, err := s.releaseNext(filter)
+		if err != nil {
+			if pending == nil {
+				return released, err
+			}
+			// A release that can't be counted would be taken again straight away
+			if err := s.releaseFailed(pending, err); err != nil {
+				return released, err
+			}
+			continue
+		}
+		if pending == nil {
+			break
+		}
+		if message != nil {
+			released = append(released, *message)
+		}
+	}
+	return released, nil
+}
+
+// releaseNext releases the next due message. It returns no pending message when none
+// is due, and no message when the pending one was dropped.
+func (s *MessageService) releaseNext(filter func(*Message) error) (*Message, *PendingMessage, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	pending := &PendingMessage{}
+	err = tx.Get(pending, `
+		SELECT * FROM message_outbox
+		WHERE release_at <= NOW() AND attempts < $1
+		ORDER BY release_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, maxReleaseAttempts)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get due message: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM message_outbox WHERE id = $1`, pending.ID); err != nil {
+		return nil, pending, fmt.Errorf("failed to take message from outbox: %w", err)
+	}
+
+	payload, err := s.encryptor.DecryptString(pending.Payload)
+	if err != nil {
+		return nil, pending, fmt.Errorf("failed to decrypt held message: %w", err)
+	}
+	message := &Message{}
+	if err := json.Unmarshal([]byte(payload), message); err != nil {
+		return nil, pending, fmt.Errorf("failed to decode held message: %w", err)
+	}
+	message.ID = pending.ID
+
+	conversationService := NewConversationService(s.db, s.encryptor)
+	err = conversationService.CheckPermission(pending.ConversationID, pending.SenderID, ActionSend)
+	if err == nil && message.ReplyToID != nil {
+		err = conversationService.CheckPermission(pending.ConversationID, pending.SenderID, ActionReply)
+	}
+	if err == nil {
+		err = filter(message)
+	}
+	switch {
+	case errors.Is(err, ErrConversationNotFound), errors.Is(err, ErrPermissionDenied),
+		errors.Is(err, ErrConversationLocked), errors.Is(err, contentfilter.ErrBlocked):
+		logger.Info("Dropped held message its sender can no longer send", map[string]interface{}{
+			"message_id":      pending.ID,
+			"conversation_id": pending.ConversationID,
+			"reason":          err.Error(),
+		})
+		return nil, pending, tx.Commit()
+	case err != nil:
+		return nil, pending, fmt.Errorf("failed to check held message: %w", err)
+	}
+
+	content := message.Content
+	if err := s.create(tx, message); err != nil {
+		return nil, pending, fmt.Errorf("failed to release message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, pending, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	// create leaves the stored, encrypted content behind
+	message.Content = content
+	return message, pending, nil
+}
+
+// releaseFailed counts a failed release and retries it later, dropping the message once
+// it has failed too often. It returns the error of counting the attempt.
+func (s *MessageService) releaseFailed(pending *PendingMessage, cause error) error {
+	var attempts int
+	err := s.db.Get(&attempts, `
+		UPDATE message_outbox
+		SET attempts = attempts + 1, release_at = NOW() + make_interval(secs => (attempts + 1) * $2)
+		WHERE id = $1
+		RETURNING attempts
+	`, pending.ID, releaseRetryDelay.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to count release attempt of message %s (%v): %w", pending.ID, cause, err)
+	}
+	if attempts < maxReleaseAttempts {
+		logger.Warn("Failed to release held message", map[string]interface{}{
+			"message_id": pending.ID,
+			"attempts":   attempts,
+			"error":      cause.Error(),
+		})
+		return nil
+	}
+	logger.Error("Dropped held message after failed releases", cause, map[string]interface{}{
+		"message_id":      pending.ID,
+		"conversation_id": pending.ConversationID,
+	})
+	if _, err := s.db.Exec(`DELETE FROM message_outbox WHERE id = $1`, pending.ID); err != nil {
+		logger.Error("Failed to drop held message", err, map[string]interface{}{
+			"message_id": pending.ID,
+		})
+	}
+	return nil
+}
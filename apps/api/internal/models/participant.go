@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ParticipantPageSize is how many participants conversations embed; the rest are listed
+// with ListParticipants
+const ParticipantPageSize = 50
+
+// ParticipantListOptions picks a page of participants, optionally only those with Role
+// or whose username or nickname starts with Query
+type ParticipantListOptions struct {
+	Query  string
+	Role   string
+	Limit  int
+	Offset int
+}
+
+// participantFilter limits conversation_participants cp joined with users u to the
+// conversation $1 and the role $2 and username or nickname pattern $3, when set.
+// Deactivated users stay listed, as DeletedUserName.
+const participantFilter = `
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.conversation_id = $1
+		  AND ($2 = '' OR COALESCE(cp.role, 'member') = $2)
+		  AND ((` + displayedUsername + `) ILIKE $3 OR cp.nickname ILIKE $3)`
+
+// ListParticipants returns a page of a conversation's participants, owners and admins
+// first and then in the order they joined, with the total number of matches
+func (s *ConversationService) ListParticipants(conversationID uuid.UUID, opts ParticipantListOptions) ([]ConversationParticipant, int, error) {
+	pattern := "%"
+	if opts.Query != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		pattern = escaper.Replace(opts.Query) + "%"
+	}
+
+	var total int
+	err := s.db.Get(&total, `SELECT COUNT(*)`+participantFilter, conversationID, opts.Role, pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count participants: %w", err)
+	}
+
+	participants, err := s.participantPage(conversationID, opts.Role, pattern, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return participants, total, nil
+}
+
+// firstParticipants returns the page of participants a conversation embeds
+func (s *ConversationService) firstParticipants(conversationID uuid.UUID) ([]ConversationParticipant, error) {
+	return s.participantPage(conversationID, "", "%", ParticipantPageSize, 0)
+}
+
+func (s *ConversationService) participantPage(conversationID uuid.UUID, role, pattern string, limit, offset int) ([]ConversationParticipant, error) {
+	participants := []ConversationParticipant{}
+	err := s.db.Select(&participants, `
+		SELECT
+			cp.conversation_id,
+			cp.user_id,
+			cp.joined_at,
+			cp.last_read_at,
+			COALESCE(cp.role, 'member') as role,
+			cp.nickname,
+			`+displayedUsername+` as user_username,
+			CASE WHEN u.is_active THEN u.email ELSE '' END as user_email,
+			CASE WHEN u.is_active THEN u.phone ELSE '' END as user_phone,
+			CASE WHEN u.is_active THEN u.status ELSE '' END as user_status,
+			CASE WHEN u.is_active THEN u.last_seen END as user_last_seen,
+			u.is_online AND u.is_active as user_is_online,
+			u.is_active as user_is_active,
+			u.created_at as user_created_at,
+			u.updated_at as user_updated_at`+participantFilter+`
+		ORDER BY CASE COALESCE(cp.role, 'member') WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END,
+			cp.joined_at, cp.user_id
+		LIMIT $4 OFFSET $5
+	`, conversationID, role, pattern, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list participants: %w", err)
+	}
+
+	for i := range participants {
+		participants[i].User = &User{
+			ID:        participants[i].UserID,
+			CreatedAt: participants[i].UserCreatedAt,
+			UpdatedAt: participants[i].UserUpdatedAt,
+			Username:  participants[i].UserUsername,
+			Email:     participants[i].UserEmail,
+			Phone:     participants[i].UserPhone,
+			Status:    participants[i].UserStatus,
+			LastSeen:  participants[i].UserLastSeen,
+			IsOnline:  participants[i].UserIsOnline,
+			IsActive:  participants[i].UserIsActive,
+		}
+	}
+	return participants, nil
+}
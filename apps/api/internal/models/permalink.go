@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// MessageLinkPrefix starts the permalinks of messages, which the apps open
+const MessageLinkPrefix = "talkify://conversations/"
+
+// MessageLink returns the permalink of a message, which stays the same for as long as
+// the message exists
+func MessageLink(conversationID, messageID uuid.UUID) string {
+	return MessageLinkPrefix + conversationID.String() + "/messages/" + messageID.String()
+}
+
+// MessageContext is a message with the messages around it, for jumping to it
+type MessageContext struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	// Messages are oldest first, the message jumped to among them
+	Messages []Message `json:"messages"`
+	// Offset is where the message is in GET /messages/conversation/{id}, to page on from
+	Offset        int  `json:"offset"`
+	HasMoreBefore bool `json:"has_more_before"`
+	HasMoreAfter  bool `json:"has_more_after"`
+}
+
+// GetContext returns a message userID may read with up to before messages before it and
+// after messages after it. ErrMessageNotFound is returned for messages they can't read,
+// as GetByIDsForUser leaves them out.
+func (s *MessageService) GetContext(messageID, userID uuid.UUID, before, after int) (*MessageContext, error) {
+	found, err := s.GetByIDsForUser([]uuid.UUID{messageID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	target := found[0]
+
+	// One more than asked for on each side tells whether there are more
+	var earlier, later []uuid.UUID
+	err = s.db.Select(&earlier, `
+		SELECT m.id FROM messages m
+		WHERE m.conversation_id = $1 AND NOT m.is_deleted
+		  AND (m.created_at, m.id) < ($2, $3) AND `+visibleHistory("$4")+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $5
+	`, target.ConversationID, target.CreatedAt, target.ID, userID, before+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earlier messages: %w", err)
+	}
+	err = s.db.Select(&later, `
+		SELECT m.id FROM messages m
+		WHERE m.conversation_id = $1 AND NOT m.is_deleted
+		  AND (m.created_at, m.id) > ($2, $3) AND `+visibleHistory("$4")+`
+		ORDER BY m.created_at, m.id
+		LIMIT $5
+	`, target.ConversationID, target.CreatedAt, target.ID, userID, after+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get later messages: %w", err)
+	}
+
+	messageContext := &MessageContext{
+		ConversationID: target.ConversationID,
+		MessageID:      target.ID,
+		HasMoreBefore:  len(earlier) > before,
+		HasMoreAfter:   len(later) > after,
+	}
+	ids := append(earlier[:min(len(earlier), before)], later[:min(len(later), after)]...)
+	if len(ids) > 0 {
+		if messageContext.Messages, err = s.GetByIDsForUser(ids, userID); err != nil {
+			return nil, err
+		}
+	}
+	messageContext.Messages = append(messageContext.Messages, target)
+	sort.Slice(messageContext.Messages, func(i, j int) bool {
+		a, b := messageContext.Messages[i], messageContext.Messages[j]
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.ID.String() < b.ID.String()
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	// Counted as GetConversationMessages lists them, deleted messages included
+	err = s.db.Get(&messageContext.Offset, `
+		SELECT COUNT(*) FROM messages m
+		WHERE m.conversation_id = $1 AND m.created_at < $2 AND `+visibleHistory("$3")+`
+	`, target.ConversationID, target.CreatedAt, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message offset: %w", err)
+	}
+	return messageContext, nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"fmt"
+
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// previewLength is how many characters of the last message a conversation previews
+	previewLength = 120
+	// previewKeyPurpose derives the key previews are encrypted with, so the short,
+	// often repeated previews never share a key with whole messages
+	previewKeyPurpose = "talkify/message-preview"
+)
+
+// messagePreview cuts content down to a preview
+func messagePreview(content string) string {
+	runes := []rune(content)
+	if len(runes) <= previewLength {
+		return content
+	}
+	return string(runes[:previewLength])
+}
+
+// sealPreview returns the stored form of the preview of content
+func sealPreview(encryptor encryption.Encryptor, content string) (string, error) {
+	return encryptor.Derive(previewKeyPurpose).EncryptString(messagePreview(content))
+}
+
+// openPreview returns the preview from its stored form
+func openPreview(encryptor encryption.Encryptor, sealed string) (string, error) {
+	return encryptor.Derive(previewKeyPurpose).DecryptString(sealed)
+}
+
+// storePreview saves the preview of a conversation's last message, unless another
+// message has become the last one meanwhile
+func storePreview(tx sqlx.Execer, encryptor encryption.Encryptor, conversationID, messageID uuid.UUID, content string) error {
+	sealed, err := sealPreview(encryptor, content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message preview: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE conversation_summaries
+		SET last_message_preview = $3
+		WHERE conversation_id = $1 AND last_message_id = $2
+	`, conversationID, messageID, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to store message preview: %w", err)
+	}
+	return nil
+}
+
+// openPreviews decrypts the previews of listed conversations. A preview that can't be
+// decrypted is left out rather than failing the list; the next write replaces it.
+func (s *ConversationService) openPreviews(conversations []Conversation) {
+	for i := range conversations {
+		sealed := conversations[i].LastMessagePreview
+		if sealed == nil {
+			continue
+		}
+		preview, err := openPreview(s.encryptor, *sealed)
+		if err != nil {
+			conversations[i].LastMessagePreview = nil
+			continue
+		}
+		conversations[i].LastMessagePreview = &preview
+	}
+}
+
+// FillMissingPreviews computes the previews that are missing, of conversations whose
+// last message was deleted or that predate previews, up to limit of them. It returns
+// how many it filled.
+func (s *MessageService) FillMissingPreviews(limit int) (int, error) {
+	var missing []struct {
+		ConversationID uuid.UUID `db:"conversation_id"`
+		MessageID      uuid.UUID `db:"id"`
+		Content        string    `db:"content"`
+	}
+	err := s.db.Select(&missing, `
+		SELECT cs.conversation_id, m.id, m.content
+		FROM conversation_summaries cs
+		JOIN messages m ON m.id = cs.last_message_id
+		WHERE cs.last_message_preview IS NULL AND cs.last_message_id IS NOT NULL
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get missing previews: %w", err)
+	}
+
+	for i, message := range missing {
+		content, err := s.encryptor.DecryptString(message.Content)
+		if err != nil {
+			// An empty preview keeps the message from being retried on every run
+			logger.Warn("Failed to decrypt message for preview", map[string]interface{}{
+				"conversation_id": message.ConversationID,
+				"message_id":      message.MessageID,
+			})
+			content = ""
+		}
+		if err := storePreview(s.db, s.encryptor, message.ConversationID, message.MessageID, content); err != nil {
+			return i, err
+		}
+	}
+	return len(missing), nil
+}
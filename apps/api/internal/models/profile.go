@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Profile is a user's public profile: the public fields plus the contact details
+// the user chose to share
+type Profile struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	Email     string    `json:"email,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Profile returns what the user shares on their public profile
+func (u *User) Profile() *Profile {
+	profile := &Profile{
+		ID:        u.ID,
+		Username:  u.Username,
+		Status:    u.Status,
+		CreatedAt: u.CreatedAt,
+	}
+	if u.ShareEmail {
+		profile.Email = u.Email
+	}
+	if u.SharePhone {
+		profile.Phone = u.Phone
+	}
+	return profile
+}
+
+// Link is the deep link that opens the profile in the apps, as encoded in QR codes
+func (p *Profile) Link() string {
+	return "talkify://users/" + p.ID.String()
+}
+
+// VCard renders the profile as a vCard 3.0, the version phone address books import
+// most reliably
+func (p *Profile) VCard() string {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCARD")
+	line("VERSION", "3.0")
+	line("UID", "urn:uuid:"+p.ID.String())
+	line("FN", escapeVCard(p.Username))
+	line("N", escapeVCard(p.Username)+";;;;")
+	line("NICKNAME", escapeVCard(p.Username))
+	if p.Email != "" {
+		line("EMAIL;TYPE=INTERNET", escapeVCard(p.Email))
+	}
+	if p.Phone != "" {
+		line("TEL;TYPE=CELL", escapeVCard(p.Phone))
+	}
+	if p.Status != "" {
+		line("NOTE", escapeVCard(p.Status))
+	}
+	line("URL", p.Link())
+	line("END", "VCARD")
+	return b.String()
+}
+
+// escapeVCard escapes the characters with a meaning in vCard values
+func escapeVCard(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		",", `\,`,
+		";", `\;`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(value)
+}
+
+// writeFolded writes a content line, folding it at 75 octets without splitting a
+// UTF-8 sequence
+func writeFolded(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Quotas holds the usage limits applied to every user. A zero value means unlimited.
+type Quotas struct {
+	MaxStorageBytes int64 `json:"max_storage_bytes"`
+	MaxMessages     int64 `json:"max_messages"`
+	MaxMediaSize    int64 `json:"max_media_size"`
+}
+
+// Usage represents a user's current consumption together with the applicable limits
+type Usage struct {
+	UserID       uuid.UUID `db:"user_id" json:"user_id"`
+	StorageBytes int64     `db:"storage_bytes" json:"storage_bytes"`
+	MessageCount int64     `db:"message_count" json:"message_count"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	Limits       Quotas    `db:"-" json:"limits"`
+}
+
+// QuotaService tracks usage and enforces quotas
+type QuotaService struct {
+	db     *sqlx.DB
+	quotas Quotas
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *sqlx.DB, quotas Quotas) *QuotaService {
+	return &QuotaService{
+		db:     db,
+		quotas: quotas,
+	}
+}
+
+// GetUsage returns the current usage of a user
+func (s *QuotaService) GetUsage(userID uuid.UUID) (*Usage, error) {
+	usage := &Usage{}
+	err := s.db.Get(usage, `
+		SELECT user_id, storage_bytes, message_count, updated_at
+		FROM user_usage
+		WHERE user_id = $1
+	`, userID)
+	if err == sql.ErrNoRows {
+		usage = &Usage{UserID: userID, UpdatedAt: time.Now()}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	usage.Limits = s.quotas
+	return usage, nil
+}
+
+// CheckMessage verifies that the user may send a message with the given media size
+func (s *QuotaService) CheckMessage(userID uuid.UUID, mediaSize int64) error {
+	if s.quotas.MaxMediaSize > 0 && mediaSize > s.quotas.MaxMediaSize {
+		return ErrMediaTooLarge
+	}
+
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return err
+	}
+
+	if s.quotas.MaxMessages > 0 && usage.MessageCount >= s.quotas.MaxMessages {
+		return ErrQuotaExceeded
+	}
+	if s.quotas.MaxStorageBytes > 0 && usage.StorageBytes+mediaSize > s.quotas.MaxStorageBytes {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// incrementUsage records a new message and its media size against the user's usage
+func incrementUsage(tx *sqlx.Tx, userID uuid.UUID, mediaSize int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_usage (user_id, storage_bytes, message_count)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (user_id) DO UPDATE
+		SET storage_bytes = user_usage.storage_bytes + EXCLUDED.storage_bytes,
+			message_count = user_usage.message_count + 1,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, mediaSize)
+	if err != nil {
+		return fmt.Errorf("failed to update usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// reactionReportLimit is how many emoji and messages a reaction report ranks
+const reactionReportLimit = 10
+
+// TrendingReaction is an emoji ranked by how much more it was used than in the
+// period before
+type TrendingReaction struct {
+	Emoji string `db:"emoji" json:"emoji" example:"🔥"`
+	Count int    `db:"reaction_count" json:"count"`
+	// PreviousCount is how often it was used in the period of the same length before
+	PreviousCount int `db:"previous_count" json:"previous_count"`
+	Change        int `db:"change" json:"change"`
+}
+
+// ReactedMessage is a message ranked by the reactions it got in a period
+type ReactedMessage struct {
+	MessageID      uuid.UUID `db:"message_id" json:"message_id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	SenderID       uuid.UUID `db:"sender_id" json:"sender_id"`
+	ReactionCount  int       `db:"reaction_count" json:"reaction_count"`
+}
+
+// ReactionAnalytics reports how members reacted over a period, for a conversation or,
+// without one, every conversation
+type ReactionAnalytics struct {
+	ConversationID *uuid.UUID `json:"conversation_id,omitempty"`
+	From           time.Time  `json:"from"`
+	To             time.Time  `json:"to"`
+	TotalReactions int        `json:"total_reactions"`
+	// TopReactions are the most used emoji
+	TopReactions []TrendingReaction `json:"top_reactions"`
+	// Trending are the emoji whose use grew the most over the period before
+	Trending    []TrendingReaction `json:"trending"`
+	MostReacted []ReactedMessage   `json:"most_reacted_messages"`
+}
+
+// refreshReactionRollups recomputes the reaction rollups for day, replacing the day's
+// rows so that removed reactions stop counting
+func refreshReactionRollups(tx *sqlx.Tx, day string) error {
+	for _, table := range []string{"reaction_daily_stats", "message_reaction_daily_stats"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE day = $1::date`, day); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO reaction_daily_stats (conversation_id, emoji, day, reaction_count)
+		SELECT m.conversation_id, r.emoji, $1::date, COUNT(*)
+		FROM message_reactions r
+		JOIN messages m ON m.id = r.message_id AND NOT m.is_deleted
+		WHERE r.created_at >= $1::date AND r.created_at < $1::date + 1
+		GROUP BY m.conversation_id, r.emoji
+	`, day)
+	if err != nil {
+		return fmt.Errorf("failed to refresh reaction rollups: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO message_reaction_daily_stats (message_id, conversation_id, day, reaction_count)
+		SELECT r.message_id, m.conversation_id, $1::date, COUNT(*)
+		FROM message_reactions r
+		JOIN messages m ON m.id = r.message_id AND NOT m.is_deleted
+		WHERE r.created_at >= $1::date AND r.created_at < $1::date + 1
+		GROUP BY r.message_id, m.conversation_id
+	`, day)
+	if err != nil {
+		return fmt.Errorf("failed to refresh message reaction rollups: %w", err)
+	}
+	return nil
+}
+
+// GetReactionAnalytics reads the reaction rollups for the last `days` days of a
+// conversation, or of every conversation when conversationID is nil
+func (s *AnalyticsService) GetReactionAnalytics(conversationID *uuid.UUID, days int) (*ReactionAnalytics, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -(days - 1))
+	previous := from.AddDate(0, 0, -days)
+
+	report := &ReactionAnalytics{
+		ConversationID: conversationID,
+		From:           from,
+		To:             to,
+		TopReactions:   []TrendingReaction{},
+		Trending:       []TrendingReaction{},
+		MostReacted:    []ReactedMessage{},
+	}
+
+	// Counts of both periods, so the change can be ranked on
+	emoji := []TrendingReaction{}
+	err := s.db.Select(&emoji, `
+		SELECT emoji, reaction_count, previous_count, reaction_count - previous_count AS change
+		FROM (
+			SELECT emoji,
+				COALESCE(SUM(reaction_count) FILTER (WHERE day >= $2::date), 0) AS reaction_count,
+				COALESCE(SUM(reaction_count) FILTER (WHERE day < $2::date), 0) AS previous_count
+			FROM reaction_daily_stats
+			WHERE day BETWEEN $1::date AND $3::date
+			  AND ($4::uuid IS NULL OR conversation_id = $4)
+			GROUP BY emoji
+		) counts
+		ORDER BY reaction_count DESC, emoji
+	`, previous.Format(dayLayout), from.Format(dayLayout), to.Format(dayLayout), conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reaction stats: %w", err)
+	}
+
+	for _, e := range emoji {
+		report.TotalReactions += e.Count
+		if e.Count > 0 && len(report.TopReactions) < reactionReportLimit {
+			report.TopReactions = append(report.TopReactions, e)
+		}
+	}
+	for _, e := range emoji {
+		if e.Change <= 0 {
+			continue
+		}
+		report.Trending = append(report.Trending, e)
+	}
+	sort.SliceStable(report.Trending, func(i, j int) bool {
+		return report.Trending[i].Change > report.Trending[j].Change
+	})
+	if len(report.Trending) > reactionReportLimit {
+		report.Trending = report.Trending[:reactionReportLimit]
+	}
+
+	err = s.db.Select(&report.MostReacted, `
+		SELECT s.message_id, s.conversation_id, m.sender_id, SUM(s.reaction_count) AS reaction_count
+		FROM message_reaction_daily_stats s
+		JOIN messages m ON m.id = s.message_id AND NOT m.is_deleted
+		WHERE s.day BETWEEN $1::date AND $2::date
+		  AND ($3::uuid IS NULL OR s.conversation_id = $3)
+		GROUP BY s.message_id, s.conversation_id, m.sender_id
+		ORDER BY reaction_count DESC
+		LIMIT $4
+	`, from.Format(dayLayout), to.Format(dayLayout), conversationID, reactionReportLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get most reacted messages: %w", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,521 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/password"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes a user is given at a time
+	RecoveryCodeCount = 10
+	// MaxTrustedContacts is how many trusted contacts a user can name
+	MaxTrustedContacts = 5
+)
+
+// Recovery request statuses
+const (
+	RecoveryPending   = "pending"
+	RecoveryCompleted = "completed"
+	RecoveryCancelled = "cancelled"
+)
+
+// recoveryCodeEncoding is Crockford's base32, which leaves out letters easily misread
+// on paper
+var recoveryCodeEncoding = base32.NewEncoding("0123456789abcdefghjkmnpqrstvwxyz").WithPadding(base32.NoPadding)
+
+// TrustedContact is a user who can approve recovering someone else's account
+type TrustedContact struct {
+	UserID    uuid.UUID `db:"contact_id" json:"user_id"`
+	Username  string    `db:"username" json:"username"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// TrustedContacts are a user's trusted contacts and how many of them have to approve
+// a recovery
+type TrustedContacts struct {
+	Threshold int              `json:"threshold"`
+	Contacts  []TrustedContact `json:"contacts"`
+}
+
+// RecoveryRequest is a request to recover an account through its trusted contacts
+type RecoveryRequest struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	UserID      uuid.UUID  `db:"user_id" json:"-"`
+	SecretHash  string     `db:"secret_hash" json:"-"`
+	Status      string     `db:"status" json:"status"`
+	Threshold   int        `db:"threshold" json:"threshold"`
+	Approvals   int        `db:"approvals" json:"approvals"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	ReadyAt     time.Time  `db:"ready_at" json:"ready_at"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	CancelledAt *time.Time `db:"cancelled_at" json:"cancelled_at,omitempty"`
+}
+
+// Ready reports whether a pending request has enough approvals and its delay has
+// passed at now
+func (r *RecoveryRequest) Ready(now time.Time) bool {
+	return r.Status == RecoveryPending && r.Approvals >= r.Threshold && !now.Before(r.ReadyAt)
+}
+
+// ContactRecoveryRequest is a recovery request as seen by one of the trusted contacts
+type ContactRecoveryRequest struct {
+	RecoveryRequest
+	Username string `db:"username" json:"username"`
+	Approved bool   `db:"approved" json:"approved"`
+}
+
+// recoveryRequestColumns selects a request with its number of approvals
+const recoveryRequestColumns = `
+	r.id, r.user_id, r.secret_hash, r.status, r.threshold, r.created_at, r.ready_at,
+	r.expires_at, r.completed_at, r.cancelled_at,
+	(SELECT COUNT(*) FROM recovery_approvals a WHERE a.request_id = r.id) AS approvals`
+
+// RecoveryService recovers accounts whose password was lost, with one-time recovery
+// codes or the approval of trusted contacts
+type RecoveryService struct {
+	db *sqlx.DB
+}
+
+// NewRecoveryService creates a new recovery service
+func NewRecoveryService(db *sqlx.DB) *RecoveryService {
+	return &RecoveryService{db: db}
+}
+
+// GenerateCodes replaces a user's recovery codes with new ones. The codes are only
+// stored hashed, so this is the only time they can be shown.
+func (s *RecoveryService) GenerateCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+	for _, code := range codes {
+		_, err := tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hashRecoveryCode(userID, code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// CodesRemaining returns how many unused recovery codes a user has
+func (s *RecoveryService) CodesRemaining(userID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.Get(&count, `
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// RecoverWithCode sets a new password for the user with username, using up one of
+// their recovery codes. Unknown users and wrong codes both return ErrUnauthorized.
+func (s *RecoveryService) RecoverWithCode(username, code, newPassword string) (uuid.UUID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.Get(&userID, `SELECT id FROM users WHERE username = $1 AND is_active = true`, username)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrUnauthorized
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashRecoveryCode(userID, code))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return uuid.Nil, ErrUnauthorized
+	}
+
+	if err := setPassword(tx, userID, newPassword); err != nil {
+		return uuid.Nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// GetContacts returns a user's trusted contacts
+func (s *RecoveryService) GetContacts(userID uuid.UUID) (*TrustedContacts, error) {
+	contacts := &TrustedContacts{Contacts: []TrustedContact{}}
+	err := s.db.Get(&contacts.Threshold, `SELECT recovery_threshold FROM users WHERE id = $1`, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recovery threshold: %w", err)
+	}
+
+	err = s.db.Select(&contacts.Contacts, `
+		SELECT t.contact_id, u.username, t.created_at
+		FROM trusted_contacts t
+		JOIN users u ON u.id = t.contact_id
+		WHERE t.user_id = $1
+		ORDER BY t.created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trusted contacts: %w", err)
+	}
+	return contacts, nil
+}
+
+// SetContacts replaces a user's trusted contacts, threshold of whom have to approve a
+// recovery. Pending requests are cancelled, as they were approved under the old
+// contacts. No contacts turns recovery through contacts off.
+func (s *RecoveryService) SetContacts(userID uuid.UUID, contactIDs []uuid.UUID, threshold int) error {
+	if len(contactIDs) > MaxTrustedContacts {
+		return fmt.Errorf("%w: at most %d trusted contacts", ErrInvalidInput, MaxTrustedContacts)
+	}
+	if len(contactIDs) > 0 && (threshold < 1 || threshold > len(contactIDs)) {
+		return fmt.Errorf("%w: threshold must be between 1 and the number of contacts", ErrInvalidInput)
+	}
+	if len(contactIDs) == 0 {
+		threshold = 0
+	}
+	seen := make(map[uuid.UUID]bool, len(contactIDs))
+	for _, id := range contactIDs {
+		if id == userID {
+			return fmt.Errorf("%w: you can't be your own trusted contact", ErrInvalidInput)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: duplicate trusted contact", ErrInvalidInput)
+		}
+		seen[id] = true
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(contactIDs) > 0 {
+		ids := make([]string, len(contactIDs))
+		for i, id := range contactIDs {
+			ids[i] = id.String()
+		}
+		var found int
+		err := tx.Get(&found, `
+			SELECT COUNT(*) FROM users WHERE id = ANY($1::uuid[]) AND is_active = true
+		`, pq.StringArray(ids))
+		if err != nil {
+			return fmt.Errorf("failed to check trusted contacts: %w", err)
+		}
+		if found != len(contactIDs) {
+			return fmt.Errorf("%w: trusted contact not found", ErrInvalidInput)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM trusted_contacts WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to remove trusted contacts: %w", err)
+	}
+	for _, id := range contactIDs {
+		_, err := tx.Exec(`INSERT INTO trusted_contacts (user_id, contact_id) VALUES ($1, $2)`, userID, id)
+		if err != nil {
+			return fmt.Errorf("failed to add trusted contact: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE users SET recovery_threshold = $2 WHERE id = $1`, userID, threshold); err != nil {
+		return fmt.Errorf("failed to set recovery threshold: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE recovery_requests SET status = $2, cancelled_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND status = $3
+	`, userID, RecoveryCancelled, RecoveryPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel recovery requests: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateRequest opens a request to recover the account of the user with username and
+// returns it with the secret needed to complete it, and the contacts who can approve
+// it. It returns ErrNotFound when the user has no trusted contacts and ErrConflict
+// while another request is open.
+func (s *RecoveryService) CreateRequest(username string, delay, ttl time.Duration) (*RecoveryRequest, string, []uuid.UUID, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var user struct {
+		ID        uuid.UUID `db:"id"`
+		Threshold int       `db:"recovery_threshold"`
+	}
+	err = tx.Get(&user, `
+		SELECT id, recovery_threshold FROM users
+		WHERE username = $1 AND is_active = true
+		FOR UPDATE
+	`, username)
+	if err == sql.ErrNoRows || (err == nil && user.Threshold == 0) {
+		return nil, "", nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var open bool
+	err = tx.Get(&open, `
+		SELECT EXISTS (SELECT 1 FROM recovery_requests WHERE user_id = $1 AND status = $2 AND expires_at > NOW())
+	`, user.ID, RecoveryPending)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to check recovery requests: %w", err)
+	}
+	if open {
+		return nil, "", nil, ErrConflict
+	}
+
+	contacts := []uuid.UUID{}
+	if err := tx.Select(&contacts, `SELECT contact_id FROM trusted_contacts WHERE user_id = $1`, user.ID); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to list trusted contacts: %w", err)
+	}
+
+	now := time.Now()
+	request := &RecoveryRequest{}
+	err = tx.Get(request, `
+		INSERT INTO recovery_requests (user_id, secret_hash, threshold, ready_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *, 0 AS approvals
+	`, user.ID, hashToken(secret), user.Threshold, now.Add(delay), now.Add(ttl))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create recovery request: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, secret, contacts, nil
+}
+
+// ListRequests returns the recovery requests for a user's account, newest first
+func (s *RecoveryService) ListRequests(userID uuid.UUID) ([]RecoveryRequest, error) {
+	requests := []RecoveryRequest{}
+	err := s.db.Select(&requests, `
+		SELECT `+recoveryRequestColumns+`
+		FROM recovery_requests r
+		WHERE r.user_id = $1
+		ORDER BY r.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery requests: %w", err)
+	}
+	return requests, nil
+}
+
+// PendingForContact returns the open recovery requests a user can approve as a
+// trusted contact
+func (s *RecoveryService) PendingForContact(contactID uuid.UUID) ([]ContactRecoveryRequest, error) {
+	requests := []ContactRecoveryRequest{}
+	err := s.db.Select(&requests, `
+		SELECT `+recoveryRequestColumns+`, u.username,
+			EXISTS (SELECT 1 FROM recovery_approvals a WHERE a.request_id = r.id AND a.contact_id = $1) AS approved
+		FROM recovery_requests r
+		JOIN trusted_contacts t ON t.user_id = r.user_id AND t.contact_id = $1
+		JOIN users u ON u.id = r.user_id
+		WHERE r.status = $2 AND r.expires_at > NOW()
+		ORDER BY r.created_at DESC
+	`, contactID, RecoveryPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery requests: %w", err)
+	}
+	return requests, nil
+}
+
+// Approve records a trusted contact's approval of an open recovery request. Requests
+// the contact can't approve return ErrNotFound.
+func (s *RecoveryService) Approve(requestID, contactID uuid.UUID) (*RecoveryRequest, error) {
+	result, err := s.db.Exec(`
+		INSERT INTO recovery_approvals (request_id, contact_id)
+		SELECT r.id, t.contact_id
+		FROM recovery_requests r
+		JOIN trusted_contacts t ON t.user_id = r.user_id AND t.contact_id = $2
+		WHERE r.id = $1 AND r.status = $3 AND r.expires_at > NOW()
+		ON CONFLICT DO NOTHING
+	`, requestID, contactID, RecoveryPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve recovery request: %w", err)
+	}
+
+	request, err := s.getRequest(s.db, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Approving twice is fine; anything else was not the contact's to approve
+		var approved bool
+		err := s.db.Get(&approved, `
+			SELECT EXISTS (SELECT 1 FROM recovery_approvals WHERE request_id = $1 AND contact_id = $2)
+		`, requestID, contactID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check approval: %w", err)
+		}
+		if !approved || request.Status != RecoveryPending {
+			return nil, ErrNotFound
+		}
+	}
+	return request, nil
+}
+
+// Cancel ends an open recovery request for a user's account
+func (s *RecoveryService) Cancel(requestID, userID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		UPDATE recovery_requests SET status = $3, cancelled_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND status = $4
+	`, requestID, userID, RecoveryCancelled, RecoveryPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel recovery request: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Status returns a recovery request to whoever holds its secret. Wrong secrets return
+// ErrNotFound so request IDs can't be probed.
+func (s *RecoveryService) Status(requestID uuid.UUID, secret string) (*RecoveryRequest, error) {
+	request, err := s.getRequest(s.db, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(request.SecretHash)) != 1 {
+		return nil, ErrNotFound
+	}
+	return request, nil
+}
+
+// Complete sets a new password through an approved recovery request whose delay has
+// passed. Requests that are not ready yet are returned with ErrRecoveryNotReady.
+func (s *RecoveryService) Complete(requestID uuid.UUID, secret, newPassword string) (*RecoveryRequest, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM recovery_requests WHERE id = $1 FOR UPDATE`, requestID); err != nil {
+		return nil, fmt.Errorf("failed to lock recovery request: %w", err)
+	}
+	request, err := s.getRequest(tx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(request.SecretHash)) != 1 {
+		return nil, ErrNotFound
+	}
+	if request.Status != RecoveryPending || !time.Now().Before(request.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	if !request.Ready(time.Now()) {
+		return request, ErrRecoveryNotReady
+	}
+
+	if err := setPassword(tx, request.UserID, newPassword); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE recovery_requests SET status = $2, completed_at = $3 WHERE id = $1
+	`, requestID, RecoveryCompleted, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete recovery request: %w", err)
+	}
+	request.Status = RecoveryCompleted
+	request.CompletedAt = &now
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
+}
+
+func (s *RecoveryService) getRequest(q sqlx.Queryer, requestID uuid.UUID) (*RecoveryRequest, error) {
+	request := &RecoveryRequest{}
+	err := sqlx.Get(q, request, `SELECT `+recoveryRequestColumns+` FROM recovery_requests r WHERE r.id = $1`, requestID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recovery request: %w", err)
+	}
+	return request, nil
+}
+
+// setPassword replaces a user's password without asking for the current one
+func setPassword(tx *sqlx.Tx, userID uuid.UUID, plain string) error {
+	hashed, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = $1, password_change_required = false, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, hashed, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	return nil
+}
+
+// hashRecoveryCode binds a code to its user. Codes are compared regardless of case,
+// spaces and dashes, as users type them in from paper.
+func hashRecoveryCode(userID uuid.UUID, code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(userID.String() + ":" + code)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// replyPreviewLength is how many characters of the replied-to message a preview carries
+const replyPreviewLength = 120
+
+// ReplyPreview is a compact view of the message a reply points at. Deleted messages
+// are returned as tombstones without content.
+type ReplyPreview struct {
+	ID             uuid.UUID `db:"id" json:"id"`
+	SenderID       uuid.UUID `db:"sender_id" json:"sender_id"`
+	SenderUsername string    `db:"sender_username" json:"sender_username"`
+	Content        string    `db:"content" json:"content"`
+	MessageType    string    `db:"message_type" json:"type"`
+	IsDeleted      bool      `db:"is_deleted" json:"is_deleted"`
+}
+
+// attachReplyPreviews fills in ReplyTo for every message that is a reply, with a single query
+func (s *MessageService) attachReplyPreviews(messages []*Message) error {
+	ids := []string{}
+	seen := map[uuid.UUID]bool{}
+	for _, message := range messages {
+		if message.ReplyToID != nil && !seen[*message.ReplyToID] {
+			seen[*message.ReplyToID] = true
+			ids = append(ids, message.ReplyToID.String())
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	previews := []ReplyPreview{}
+	err := s.db.Select(&previews, `
+		SELECT m.id, m.sender_id, `+displayedUsername+` as sender_username,
+			m.content, m.message_type, m.is_deleted
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.id = ANY($1::uuid[])
+	`, pq.StringArray(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get reply previews: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*ReplyPreview, len(previews))
+	for i := range previews {
+		preview := &previews[i]
+		if preview.IsDeleted {
+			preview.Content = ""
+		} else {
+			content, err := s.encryptor.DecryptString(preview.Content)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt reply preview: %w", err)
+			}
+			preview.Content = truncate(content, replyPreviewLength)
+		}
+		byID[preview.ID] = preview
+	}
+
+	for _, message := range messages {
+		if message.ReplyToID != nil {
+			message.ReplyTo = byID[*message.ReplyToID]
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Why a session no longer grants access. Clients have to sign in again for all of them.
+const (
+	SessionIdle    = "session_idle"
+	SessionExpired = "session_expired"
+	SessionRevoked = "session_revoked"
+)
+
+// Why a session was revoked
+const (
+	RevokedSessionLimit     = "session_limit"
+	RevokedAccountRecovered = "account_recovered"
+	RevokedLoginReported    = "login_reported"
+)
+
+// Session is a sign-in on one device. Its ID is carried by the tokens issued for it.
+type Session struct {
+	ID     uuid.UUID `db:"id" json:"id"`
+	UserID uuid.UUID `db:"user_id" json:"-"`
+	Device string    `db:"device" json:"device"`
+	// IP is where the session was signed in from, and LastIP where its tokens were
+	// last refreshed from
+	IP            string     `db:"ip" json:"ip"`
+	LastIP        string     `db:"last_ip" json:"last_ip"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	LastActiveAt  time.Time  `db:"last_active_at" json:"last_active_at"`
+	RefreshedAt   time.Time  `db:"refreshed_at" json:"refreshed_at"`
+	RevokedAt     *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	RevokedReason *string    `db:"revoked_reason" json:"revoked_reason,omitempty"`
+}
+
+// SessionPolicy limits how long sessions last. Zero values disable each limit.
+type SessionPolicy struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+// Check returns why session no longer grants access at now, or "" when it does
+func (p SessionPolicy) Check(session *Session, now time.Time) string {
+	switch {
+	case session.RevokedAt != nil:
+		return SessionRevoked
+	case p.MaxLifetime > 0 && now.Sub(session.CreatedAt) > p.MaxLifetime:
+		return SessionExpired
+	case p.IdleTimeout > 0 && now.Sub(session.LastActiveAt) > p.IdleTimeout:
+		return SessionIdle
+	}
+	return ""
+}
+
+// SessionService tracks sign-in sessions
+type SessionService struct {
+	db *sqlx.DB
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(db *sqlx.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// Start records a new session signed in from ip. With maxPerUser above zero, the user's least recently
+// used sessions beyond that many are revoked and returned.
+func (s *SessionService) Start(id, userID uuid.UUID, device, ip string, maxPerUser int) ([]uuid.UUID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO sessions (id, user_id, device, ip, last_ip)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (id) DO NOTHING
+	`, id, userID, device, ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+
+	revoked := []uuid.UUID{}
+	if maxPerUser > 0 {
+		err = tx.Select(&revoked, `
+			UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $3
+			WHERE id IN (
+				SELECT id FROM sessions
+				WHERE user_id = $1 AND revoked_at IS NULL
+				ORDER BY last_active_at DESC, created_at DESC
+				OFFSET $2
+			)
+			RETURNING id
+		`, userID, maxPerUser, RevokedSessionLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions over the limit: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return revoked, nil
+}
+
+// Get returns a session
+func (s *SessionService) Get(id uuid.UUID) (*Session, error) {
+	session := &Session{}
+	err := s.db.Get(session, `SELECT * FROM sessions WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+// Touch records that a session was just used
+func (s *SessionService) Touch(id uuid.UUID) error {
+	_, err := s.db.Exec(`UPDATE sessions SET last_active_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// Refreshed records that new tokens were issued for a session to a client at ip
+func (s *SessionService) Refreshed(id uuid.UUID, ip string) error {
+	_, err := s.db.Exec(`
+		UPDATE sessions SET last_active_at = CURRENT_TIMESTAMP, refreshed_at = CURRENT_TIMESTAMP, last_ip = $2
+		WHERE id = $1
+	`, id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to refresh session: %w", err)
+	}
+	return nil
+}
+
+// PurgeStale removes sessions that have not had tokens issued for longer than
+// tokenTTL, as every token they had has expired
+func (s *SessionService) PurgeStale(tokenTTL time.Duration) (int64, error) {
+	result, err := s.db.Exec(`
+		DELETE FROM sessions WHERE refreshed_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`, tokenTTL.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RevokeAll signs a user out everywhere
+func (s *SessionService) RevokeAll(userID uuid.UUID, reason string) (int64, error) {
+	result, err := s.db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RevokeOthers signs a user out everywhere but the session keepID, which may be
+// uuid.Nil to sign out everywhere
+func (s *SessionService) RevokeOthers(userID, keepID uuid.UUID, reason string) (int64, error) {
+	result, err := s.db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $3
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`, userID, keepID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Fields of the denormalized conversation reads compared in shadow
+const (
+	ShadowFieldParticipantCount = "participant_count"
+	ShadowFieldLastMessage      = "last_message_id"
+	ShadowFieldUnreadCount      = "unread_count"
+	ShadowFieldReadWatermark    = "read_watermark"
+)
+
+// ShadowMismatch is a value read from conversation summaries or participant counters
+// that differs from the one computed from messages and participants
+type ShadowMismatch struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Field          string    `json:"field"`
+	Stored         string    `json:"stored"`
+	Computed       string    `json:"computed"`
+}
+
+// shadowRow holds both paths of a conversation as one statement read them
+type shadowRow struct {
+	ConversationID           uuid.UUID  `db:"conversation_id"`
+	ParticipantCount         int        `db:"participant_count"`
+	ComputedParticipantCount int        `db:"computed_participant_count"`
+	LastMessageID            *uuid.UUID `db:"last_message_id"`
+	ComputedLastMessageID    *uuid.UUID `db:"computed_last_message_id"`
+	UnreadCount              int        `db:"unread_count"`
+	ComputedUnreadCount      int        `db:"computed_unread_count"`
+	ReadWatermark            *time.Time `db:"read_watermark"`
+	ReadCursorAt             *time.Time `db:"read_cursor_at"`
+}
+
+// CompareConversationReads reads the summaries, unread counters and read watermarks of
+// a user's conversations, or of all of them when conversationIDs is nil, along with the
+// values computed from messages and participants, and returns those that differ. Both
+// are read in one statement, so messages sent meanwhile don't show up as mismatches.
+// A watermark only mismatches when it is behind the read cursor: it may be ahead.
+func (s *ConversationService) CompareConversationReads(userID uuid.UUID, conversationIDs []uuid.UUID) ([]ShadowMismatch, error) {
+	var ids interface{}
+	if conversationIDs != nil {
+		ids = pq.Array(conversationIDs)
+	}
+	var rows []shadowRow
+	err := s.db.Select(&rows, `
+		SELECT cp.conversation_id,
+			COALESCE(s.participant_count, 0) AS participant_count,
+			(SELECT COUNT(*) FROM conversation_participants p
+				WHERE p.conversation_id = cp.conversation_id) AS computed_participant_count,
+			s.last_message_id,
+			(SELECT m.id FROM messages m
+				WHERE m.conversation_id = cp.conversation_id AND NOT m.is_deleted
+				ORDER BY m.created_at DESC, m.id DESC
+				LIMIT 1) AS computed_last_message_id,
+			cp.unread_count,
+			conversation_unread_count(cp.conversation_id, cp.user_id) AS computed_unread_count,
+			cp.last_read_message_at AS read_watermark,
+			lr.created_at AS read_cursor_at
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		LEFT JOIN conversation_summaries s ON s.conversation_id = cp.conversation_id
+		LEFT JOIN messages lr ON lr.id = cp.last_read_message_id
+		WHERE cp.user_id = $1 AND ($2::uuid[] IS NULL OR cp.conversation_id = ANY($2::uuid[]))
+	`, userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare conversation reads: %w", err)
+	}
+
+	mismatches := []ShadowMismatch{}
+	for _, row := range rows {
+		mismatch := func(field, stored, computed string) {
+			mismatches = append(mismatches, ShadowMismatch{
+				ConversationID: row.ConversationID,
+				Field:          field,
+				Stored:         stored,
+				Computed:       computed,
+			})
+		}
+		if row.ParticipantCount != row.ComputedParticipantCount {
+			mismatch(ShadowFieldParticipantCount, strconv.Itoa(row.ParticipantCount), strconv.Itoa(row.ComputedParticipantCount))
+		}
+		if uuidString(row.LastMessageID) != uuidString(row.ComputedLastMessageID) {
+			mismatch(ShadowFieldLastMessage, uuidString(row.LastMessageID), uuidString(row.ComputedLastMessageID))
+		}
+		if row.UnreadCount != row.ComputedUnreadCount {
+			mismatch(ShadowFieldUnreadCount, strconv.Itoa(row.UnreadCount), strconv.Itoa(row.ComputedUnreadCount))
+		}
+		if row.ReadCursorAt != nil && (row.ReadWatermark == nil || row.ReadWatermark.Before(*row.ReadCursorAt)) {
+			mismatch(ShadowFieldReadWatermark, timeString(row.ReadWatermark), timeString(row.ReadCursorAt))
+		}
+	}
+	return mismatches, nil
+}
+
+// uuidString formats an optional ID, empty when there is none
+func uuidString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// timeString formats an optional time, empty when there is none
+func timeString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SigningKeyStore keeps the JWT signing keys rotated through the admin API in the
+// database, encrypted, so that every node validates the tokens signed with them
+type SigningKeyStore struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+func NewSigningKeyStore(db *sqlx.DB, encryptor encryption.Encryptor) *SigningKeyStore {
+	return &SigningKeyStore{db: db, encryptor: encryptor}
+}
+
+// LoadKeys returns every stored key and the active kid, empty when none is active
+func (s *SigningKeyStore) LoadKeys() ([]auth.StoredKey, string, error) {
+	var rows []struct {
+		ID        string    `db:"kid"`
+		Algorithm string    `db:"algorithm"`
+		Data      string    `db:"key_data"`
+		Active    bool      `db:"active"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	if err := s.db.Select(&rows, `SELECT kid, algorithm, key_data, active, created_at FROM signing_keys`); err != nil {
+		return nil, "", fmt.Errorf("failed to get signing keys: %w", err)
+	}
+
+	keys := make([]auth.StoredKey, len(rows))
+	var activeKID string
+	for i, row := range rows {
+		data, err := s.encryptor.DecryptString(row.Data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt signing key %s: %w", row.ID, err)
+		}
+		keys[i] = auth.StoredKey{ID: row.ID, Algorithm: row.Algorithm, Data: []byte(data), CreatedAt: row.CreatedAt}
+		if row.Active {
+			activeKID = row.ID
+		}
+	}
+	return keys, activeKID, nil
+}
+
+// SaveKey stores a new key as the active one
+func (s *SigningKeyStore) SaveKey(key auth.StoredKey) error {
+	data, err := s.encryptor.EncryptString(string(key.Data))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE signing_keys SET active = false WHERE active`); err != nil {
+		return fmt.Errorf("failed to deactivate signing key: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO signing_keys (kid, algorithm, key_data, active, created_at)
+		VALUES ($1, $2, $3, true, $4)
+	`, key.ID, key.Algorithm, data, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save signing key: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SetActiveKey makes kid the active key; none is when kid isn't stored, as for keys
+// from a node's key directory
+func (s *SigningKeyStore) SetActiveKey(kid string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE signing_keys SET active = false WHERE active AND kid != $1`, kid); err != nil {
+		return fmt.Errorf("failed to deactivate signing key: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE signing_keys SET active = true WHERE kid = $1`, kid); err != nil {
+		return fmt.Errorf("failed to activate signing key: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RemoveKey deletes a stored key
+func (s *SigningKeyStore) RemoveKey(kid string) error {
+	if _, err := s.db.Exec(`DELETE FROM signing_keys WHERE kid = $1`, kid); err != nil {
+		return fmt.Errorf("failed to remove signing key: %w", err)
+	}
+	return nil
+}
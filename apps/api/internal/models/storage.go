@@ -0,0 +1,328 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// storageReportTop is how many conversations and users a storage report lists
+const storageReportTop = 20
+
+// storageReportKeep is how long storage reports are kept
+const storageReportKeep = 30 * 24 * time.Hour
+
+// StaleMediaAge is the age past which media counts as stale in storage reports, which
+// a retention period would reclaim
+const StaleMediaAge = 365 * 24 * time.Hour
+
+// StorageUsage is how much media one conversation, user or media type holds
+type StorageUsage struct {
+	// ID is the conversation or user, unset for media types
+	ID *uuid.UUID `db:"id" json:"id,omitempty"`
+	// Type is the media type, e.g. image, unset for conversations and users
+	Type  string `db:"type" json:"type,omitempty"`
+	Bytes int64  `db:"bytes" json:"bytes"`
+	Count int64  `db:"count" json:"count"`
+}
+
+// ReclaimableStorage is media or files a cleanup can remove
+type ReclaimableStorage struct {
+	Bytes int64 `db:"bytes" json:"bytes"`
+	Count int64 `db:"count" json:"count"`
+}
+
+// StorageRecommendation suggests a way to reclaim space
+type StorageRecommendation struct {
+	// Kind is deleted_message_media, orphaned_files or usage_drift, which a cleanup
+	// takes care of, or retention, which the workspace settings do
+	Kind   string `json:"kind" example:"deleted_message_media"`
+	Bytes  int64  `json:"bytes"`
+	Detail string `json:"detail"`
+}
+
+// StorageReport is how the media of messages is spread across conversations, media types
+// and users, and what could be reclaimed. Media sizes are as the clients reported them
+// when sending; files are the zips and transcripts kept by the server.
+type StorageReport struct {
+	GeneratedAt    time.Time      `json:"generated_at"`
+	TotalBytes     int64          `json:"total_bytes"`
+	MediaCount     int64          `json:"media_count"`
+	ByConversation []StorageUsage `json:"by_conversation"`
+	ByMediaType    []StorageUsage `json:"by_media_type"`
+	ByUser         []StorageUsage `json:"by_user"`
+	// DeletedMessageMedia is still attached to deleted messages, which nobody can see
+	DeletedMessageMedia ReclaimableStorage `json:"deleted_message_media"`
+	// OrphanedFiles are files no archive or transcript refers to
+	OrphanedFiles ReclaimableStorage `json:"orphaned_files"`
+	// Files are all the archives and transcripts on disk
+	Files ReclaimableStorage `json:"files"`
+	// StaleMedia is the media of messages older than StaleMediaAge
+	StaleMedia ReclaimableStorage `json:"stale_media"`
+	// UsageDrift is how much the storage users are charged for exceeds their media
+	UsageDrift      ReclaimableStorage      `json:"usage_drift"`
+	Recommendations []StorageRecommendation `json:"recommendations"`
+}
+
+// StorageCleanup is what a cleanup removed, or would remove in a dry run
+type StorageCleanup struct {
+	DryRun              bool               `json:"dry_run"`
+	DeletedMessageMedia ReclaimableStorage `json:"deleted_message_media"`
+	OrphanedFiles       ReclaimableStorage `json:"orphaned_files"`
+	// UsageDrift counts users whose charged storage was corrected, and by how much
+	UsageDrift ReclaimableStorage `json:"usage_drift"`
+}
+
+type StorageService struct {
+	db *sqlx.DB
+}
+
+func NewStorageService(db *sqlx.DB) *StorageService {
+	return &StorageService{db: db}
+}
+
+// reclaimableMedia is the condition that the message m has media a cleanup may clear:
+// the message was deleted, and neither legal holds nor the integrity chain of its
+// conversation c need it kept
+var reclaimableMedia = `m.is_deleted AND m.media_url IS NOT NULL
+	AND c.integrity_chain_since IS NULL AND ` + notHeld("c")
+
+// Report computes how message media is spread. Files and recommendations are left to
+// the caller, which knows where files are kept.
+func (s *StorageService) Report() (*StorageReport, error) {
+	report := &StorageReport{GeneratedAt: time.Now()}
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(media_size), 0), COUNT(*)
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+	`).Scan(&report.TotalBytes, &report.MediaCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum media: %w", err)
+	}
+
+	report.ByConversation = []StorageUsage{}
+	err = s.db.Select(&report.ByConversation, `
+		SELECT conversation_id AS id, COALESCE(SUM(media_size), 0) AS bytes, COUNT(*) AS count
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+		GROUP BY conversation_id
+		ORDER BY bytes DESC, count DESC
+		LIMIT $1
+	`, storageReportTop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum media by conversation: %w", err)
+	}
+
+	report.ByMediaType = []StorageUsage{}
+	err = s.db.Select(&report.ByMediaType, `
+		SELECT message_type AS type, COALESCE(SUM(media_size), 0) AS bytes, COUNT(*) AS count
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+		GROUP BY message_type
+		ORDER BY bytes DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum media by type: %w", err)
+	}
+
+	report.ByUser = []StorageUsage{}
+	err = s.db.Select(&report.ByUser, `
+		SELECT sender_id AS id, COALESCE(SUM(media_size), 0) AS bytes, COUNT(*) AS count
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+		GROUP BY sender_id
+		ORDER BY bytes DESC, count DESC
+		LIMIT $1
+	`, storageReportTop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum media by user: %w", err)
+	}
+
+	err = s.db.Get(&report.DeletedMessageMedia, `
+		SELECT COALESCE(SUM(m.media_size), 0) AS bytes, COUNT(*) AS count
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE `+reclaimableMedia)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum media of deleted messages: %w", err)
+	}
+
+	err = s.db.Get(&report.StaleMedia, `
+		SELECT COALESCE(SUM(media_size), 0) AS bytes, COUNT(*) AS count
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+		  AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`, StaleMediaAge.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum stale media: %w", err)
+	}
+
+	if report.UsageDrift, err = s.CorrectUsage(true); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// senderMedia sums the media of each sender's messages that are not deleted
+const senderMedia = `
+		SELECT sender_id, SUM(media_size) AS bytes
+		FROM messages
+		WHERE media_url IS NOT NULL AND NOT is_deleted
+		GROUP BY sender_id`
+
+// Save keeps a report and drops those older than a month
+func (s *StorageService) Save(report *StorageReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode storage report: %w", err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO storage_reports (report, generated_at) VALUES ($1, $2)`, data, report.GeneratedAt); err != nil {
+		return fmt.Errorf("failed to save storage report: %w", err)
+	}
+	_, err = s.db.Exec(`
+		DELETE FROM storage_reports WHERE generated_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+	`, storageReportKeep.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to purge storage reports: %w", err)
+	}
+	return nil
+}
+
+// Latest returns the most recent report, or ErrNotFound before the first one
+func (s *StorageService) Latest() (*StorageReport, error) {
+	var data []byte
+	err := s.db.Get(&data, `SELECT report FROM storage_reports ORDER BY generated_at DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage report: %w", err)
+	}
+	report := &StorageReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("failed to decode storage report: %w", err)
+	}
+	return report, nil
+}
+
+// KnownFiles returns the IDs of the archives and transcripts whose files are kept
+func (s *StorageService) KnownFiles() (map[uuid.UUID]bool, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `SELECT id FROM file_archives UNION ALL SELECT id FROM transcript_exports`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives and transcripts: %w", err)
+	}
+	known := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	return known, nil
+}
+
+// ClearDeletedMessageMedia detaches the media of up to limit deleted messages, as
+// reported in DeletedMessageMedia, and stops charging their senders for it. In a dry
+// run nothing is changed.
+func (s *StorageService) ClearDeletedMessageMedia(limit int, dryRun bool) (ReclaimableStorage, error) {
+	var cleared ReclaimableStorage
+	if dryRun {
+		err := s.db.Get(&cleared, `
+			SELECT COALESCE(SUM(bytes), 0) AS bytes, COUNT(*) AS count FROM (
+				SELECT COALESCE(m.media_size, 0) AS bytes
+				FROM messages m
+				JOIN conversations c ON c.id = m.conversation_id
+				WHERE `+reclaimableMedia+`
+				LIMIT $1
+			) reclaimable
+		`, limit)
+		if err != nil {
+			return cleared, fmt.Errorf("failed to sum media of deleted messages: %w", err)
+		}
+		return cleared, nil
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return cleared, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var freed []struct {
+		SenderID uuid.UUID `db:"sender_id"`
+		Bytes    int64     `db:"bytes"`
+		Count    int64     `db:"count"`
+	}
+	err = tx.Select(&freed, `
+		WITH reclaimable AS (
+			SELECT m.id FROM messages m
+			JOIN conversations c ON c.id = m.conversation_id
+			WHERE `+reclaimableMedia+`
+			LIMIT $1
+			FOR UPDATE OF m
+		), cleared AS (
+			UPDATE messages m
+			SET media_url = NULL, media_thumbnail_url = NULL, media_size = NULL, media_duration = NULL,
+				media_encrypted = false
+			FROM reclaimable r, messages before
+			WHERE m.id = r.id AND before.id = r.id
+			RETURNING m.sender_id, COALESCE(before.media_size, 0) AS bytes
+		)
+		SELECT sender_id, SUM(bytes) AS bytes, COUNT(*) AS count FROM cleared GROUP BY sender_id
+	`, limit)
+	if err != nil {
+		return cleared, fmt.Errorf("failed to clear media of deleted messages: %w", err)
+	}
+	for _, sender := range freed {
+		_, err := tx.Exec(`
+			UPDATE user_usage
+			SET storage_bytes = GREATEST(storage_bytes - $2, 0), updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1
+		`, sender.SenderID, sender.Bytes)
+		if err != nil {
+			return cleared, fmt.Errorf("failed to update usage: %w", err)
+		}
+		cleared.Bytes += sender.Bytes
+		cleared.Count += sender.Count
+	}
+	if err := tx.Commit(); err != nil {
+		return cleared, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return cleared, nil
+}
+
+// CorrectUsage lowers the storage users are charged for to the media of their messages
+// that are not deleted, as reported in UsageDrift. In a dry run nothing is changed.
+func (s *StorageService) CorrectUsage(dryRun bool) (ReclaimableStorage, error) {
+	var corrected ReclaimableStorage
+	if dryRun {
+		err := s.db.Get(&corrected, `
+			SELECT COALESCE(SUM(uu.storage_bytes - COALESCE(media.bytes, 0)), 0) AS bytes, COUNT(*) AS count
+			FROM user_usage uu
+			LEFT JOIN (`+senderMedia+`) media ON media.sender_id = uu.user_id
+			WHERE uu.storage_bytes > COALESCE(media.bytes, 0)
+		`)
+		if err != nil {
+			return corrected, fmt.Errorf("failed to compare usage: %w", err)
+		}
+		return corrected, nil
+	}
+
+	err := s.db.Get(&corrected, `
+		WITH corrected AS (
+			UPDATE user_usage uu
+			SET storage_bytes = COALESCE(media.bytes, 0), updated_at = CURRENT_TIMESTAMP
+			FROM user_usage before
+			LEFT JOIN (`+senderMedia+`) media ON media.sender_id = before.user_id
+			WHERE uu.user_id = before.user_id AND before.storage_bytes > COALESCE(media.bytes, 0)
+			RETURNING before.storage_bytes - uu.storage_bytes AS bytes
+		)
+		SELECT COALESCE(SUM(bytes), 0) AS bytes, COUNT(*) AS count FROM corrected
+	`)
+	if err != nil {
+		return corrected, fmt.Errorf("failed to correct usage: %w", err)
+	}
+	return corrected, nil
+}
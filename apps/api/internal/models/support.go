@@ -0,0 +1,368 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SupportBotID is the support account. Direct messages to it start support
+// conversations, whose tickets agents pick up from the queue.
+var SupportBotID = uuid.MustParse("00000000-0000-4000-8000-50c000000001")
+
+// Support ticket statuses
+const (
+	SupportQueued   = "queued"
+	SupportAssigned = "assigned"
+	SupportResolved = "resolved"
+)
+
+var (
+	ErrNotAgent        = errors.New("not a support agent")
+	ErrTicketAssigned  = errors.New("ticket is assigned to another agent")
+	ErrTicketNotYours  = errors.New("ticket is not assigned to this agent")
+	ErrTicketResolved  = errors.New("ticket is resolved")
+	ErrTicketSameAgent = errors.New("ticket is already assigned to this agent")
+)
+
+// SupportSLA is how long after a ticket is queued an agent should first answer and
+// resolve it; zero disables each timer
+type SupportSLA struct {
+	FirstResponse time.Duration
+	Resolution    time.Duration
+}
+
+// SupportTicket is the state of a support conversation in the queue
+type SupportTicket struct {
+	ID               uuid.UUID  `db:"id" json:"id"`
+	ConversationID   uuid.UUID  `db:"conversation_id" json:"conversation_id"`
+	CustomerID       uuid.UUID  `db:"customer_id" json:"customer_id"`
+	CustomerUsername string     `db:"customer_username" json:"customer_username"`
+	Status           string     `db:"status" json:"status" example:"queued"`
+	AgentID          *uuid.UUID `db:"agent_id" json:"agent_id,omitempty"`
+	AgentUsername    *string    `db:"agent_username" json:"agent_username,omitempty"`
+	QueuedAt         time.Time  `db:"queued_at" json:"queued_at"`
+	AssignedAt       *time.Time `db:"assigned_at" json:"assigned_at,omitempty"`
+	FirstResponseAt  *time.Time `db:"first_response_at" json:"first_response_at,omitempty"`
+	ResolvedAt       *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+	SLABreachedAt    *time.Time `db:"sla_breached_at" json:"sla_breached_at,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+
+	// FirstResponseDueAt and ResolutionDueAt are when the SLA timers run out, while they
+	// are running
+	FirstResponseDueAt *time.Time `db:"-" json:"first_response_due_at,omitempty"`
+	ResolutionDueAt    *time.Time `db:"-" json:"resolution_due_at,omitempty"`
+}
+
+// supportTicketColumns are the columns scanned into a SupportTicket t, joined with the
+// customer u and the agent a
+const supportTicketColumns = `t.*, ` + displayedUsername + ` AS customer_username,
+	CASE WHEN a.is_active THEN a.username ELSE '` + DeletedUserName + `' END AS agent_username`
+
+const supportTicketJoins = `
+	JOIN users u ON u.id = t.customer_id
+	LEFT JOIN users a ON a.id = t.agent_id`
+
+type SupportService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+	team      uuid.UUID
+	sla       SupportSLA
+}
+
+// NewSupportService creates a support service whose agents are the participants of the
+// team conversation
+func NewSupportService(db *sqlx.DB, encryptor encryption.Encryptor, team uuid.UUID, sla SupportSLA) *SupportService {
+	return &SupportService{db: db, encryptor: encryptor, team: team, sla: sla}
+}
+
+// EnsureAccount creates the support account named username, or renames it. Nobody can
+// sign in to it: it is a system account and its password hash matches no password.
+func (s *SupportService) EnsureAccount(username string) error {
+	empty, err := s.encryptor.EncryptString("")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt contact details: %w", err)
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO users (id, username, email, phone, password_hash, is_system)
+		VALUES ($1, $2, $3, $3, '!', true)
+		ON CONFLICT (id) DO UPDATE SET username = EXCLUDED.username, updated_at = CURRENT_TIMESTAMP
+		WHERE users.username != EXCLUDED.username
+	`, SupportBotID, username, empty)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("support username %q is taken", username)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create support account: %w", err)
+	}
+	return nil
+}
+
+// IsAgent reports whether a user is a support agent, which participants of the team
+// conversation are
+func (s *SupportService) IsAgent(userID uuid.UUID) (bool, error) {
+	var agent bool
+	err := s.db.Get(&agent, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+			JOIN users u ON u.id = cp.user_id AND u.is_active
+			WHERE cp.conversation_id = $1 AND cp.user_id = $2
+		)
+	`, s.team, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check support agent: %w", err)
+	}
+	return agent, nil
+}
+
+// Queue returns a page of tickets with a status, oldest first, with the total number of
+// them. A non-nil agentID only returns the tickets assigned to them.
+func (s *SupportService) Queue(status string, agentID *uuid.UUID, limit, offset int) ([]SupportTicket, int, error) {
+	var total int
+	err := s.db.Get(&total, `
+		SELECT COUNT(*) FROM support_tickets t
+		WHERE t.status = $1 AND ($2::uuid IS NULL OR t.agent_id = $2)
+	`, status, agentID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count support tickets: %w", err)
+	}
+
+	tickets := []SupportTicket{}
+	err = s.db.Select(&tickets, `
+		SELECT `+supportTicketColumns+`
+		FROM support_tickets t`+supportTicketJoins+`
+		WHERE t.status = $1 AND ($2::uuid IS NULL OR t.agent_id = $2)
+		ORDER BY t.queued_at, t.id
+		LIMIT $3 OFFSET $4
+	`, status, agentID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list support tickets: %w", err)
+	}
+	for i := range tickets {
+		s.setDue(&tickets[i])
+	}
+	return tickets, total, nil
+}
+
+// Get returns a ticket
+func (s *SupportService) Get(id uuid.UUID) (*SupportTicket, error) {
+	return s.get(`t.id = $1`, id)
+}
+
+// ForCustomer returns the ticket of a customer's support conversation, if they have
+// written to support
+func (s *SupportService) ForCustomer(customerID uuid.UUID) (*SupportTicket, error) {
+	return s.get(`t.customer_id = $1 ORDER BY t.queued_at DESC LIMIT 1`, customerID)
+}
+
+func (s *SupportService) get(condition string, arg interface{}) (*SupportTicket, error) {
+	ticket := &SupportTicket{}
+	err := s.db.Get(ticket, `
+		SELECT `+supportTicketColumns+`
+		FROM support_tickets t`+supportTicketJoins+`
+		WHERE `+condition, arg)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get support ticket: %w", err)
+	}
+	s.setDue(ticket)
+	return ticket, nil
+}
+
+// Claim assigns a queued ticket to an agent, who joins the support conversation
+func (s *SupportService) Claim(id, agentID uuid.UUID) (*SupportTicket, error) {
+	return s.change(id, func(tx *sqlx.Tx, ticket *SupportTicket) error {
+		switch {
+		case ticket.Status == SupportResolved:
+			return ErrTicketResolved
+		case ticket.AgentID != nil && *ticket.AgentID == agentID:
+			return ErrTicketSameAgent
+		case ticket.Status == SupportAssigned:
+			return ErrTicketAssigned
+		}
+		return s.assign(tx, ticket, agentID)
+	})
+}
+
+// Transfer hands a ticket assigned to an agent over to another agent. The first agent
+// leaves the support conversation and the other joins it.
+func (s *SupportService) Transfer(id, agentID, toAgentID uuid.UUID) (*SupportTicket, error) {
+	return s.change(id, func(tx *sqlx.Tx, ticket *SupportTicket) error {
+		switch {
+		case ticket.Status != SupportAssigned || ticket.AgentID == nil || *ticket.AgentID != agentID:
+			return ErrTicketNotYours
+		case toAgentID == agentID:
+			return ErrTicketSameAgent
+		}
+		agent, err := s.IsAgent(toAgentID)
+		if err != nil {
+			return err
+		}
+		if !agent {
+			return ErrNotAgent
+		}
+		if err := leaveSupportConversation(tx, ticket.ConversationID, agentID); err != nil {
+			return err
+		}
+		return s.assign(tx, ticket, toAgentID)
+	})
+}
+
+// Resolve closes a ticket assigned to an agent, who leaves the support conversation.
+// The customer's next message queues it again.
+func (s *SupportService) Resolve(id, agentID uuid.UUID) (*SupportTicket, error) {
+	return s.change(id, func(tx *sqlx.Tx, ticket *SupportTicket) error {
+		if ticket.Status != SupportAssigned || ticket.AgentID == nil || *ticket.AgentID != agentID {
+			return ErrTicketNotYours
+		}
+		if err := leaveSupportConversation(tx, ticket.ConversationID, agentID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			UPDATE support_tickets
+			SET status = 'resolved', resolved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, ticket.ID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve support ticket: %w", err)
+		}
+		return nil
+	})
+}
+
+// change runs apply on a ticket locked for update and returns the ticket as it is after
+func (s *SupportService) change(id uuid.UUID, apply func(*sqlx.Tx, *SupportTicket) error) (*SupportTicket, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ticket := &SupportTicket{}
+	err = tx.Get(ticket, `
+		SELECT t.*, '' AS customer_username, NULL AS agent_username
+		FROM support_tickets t WHERE t.id = $1 FOR UPDATE
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get support ticket: %w", err)
+	}
+	if err := apply(tx, ticket); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return s.Get(id)
+}
+
+// assign gives a ticket to an agent, who joins its conversation
+func (s *SupportService) assign(tx *sqlx.Tx, ticket *SupportTicket, agentID uuid.UUID) error {
+	_, err := tx.Exec(`
+		INSERT INTO conversation_participants (conversation_id, user_id, role)
+		VALUES ($1, $2, 'member')
+		ON CONFLICT (conversation_id, user_id) DO NOTHING
+	`, ticket.ConversationID, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to add agent to support conversation: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE support_tickets
+		SET status = 'assigned', agent_id = $2, assigned_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, ticket.ID, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to assign support ticket: %w", err)
+	}
+	return nil
+}
+
+func leaveSupportConversation(tx *sqlx.Tx, conversationID, agentID uuid.UUID) error {
+	_, err := tx.Exec(`
+		DELETE FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to remove agent from support conversation: %w", err)
+	}
+	return nil
+}
+
+// MarkBreaches records the open tickets whose SLA timers ran out since the last call,
+// and returns them
+func (s *SupportService) MarkBreaches() ([]SupportTicket, error) {
+	if s.sla.FirstResponse <= 0 && s.sla.Resolution <= 0 {
+		return nil, nil
+	}
+	breached := []SupportTicket{}
+	err := s.db.Select(&breached, `
+		UPDATE support_tickets t
+		SET sla_breached_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE t.status != 'resolved' AND t.sla_breached_at IS NULL AND (
+			($1::float8 > 0 AND t.first_response_at IS NULL
+				AND t.queued_at < CURRENT_TIMESTAMP - make_interval(secs => $1::float8))
+			OR ($2::float8 > 0 AND t.queued_at < CURRENT_TIMESTAMP - make_interval(secs => $2::float8))
+		)
+		RETURNING t.*, '' AS customer_username, NULL AS agent_username
+	`, s.sla.FirstResponse.Seconds(), s.sla.Resolution.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark breached support tickets: %w", err)
+	}
+	for i := range breached {
+		s.setDue(&breached[i])
+	}
+	return breached, nil
+}
+
+// setDue sets when the running SLA timers of a ticket run out
+func (s *SupportService) setDue(ticket *SupportTicket) {
+	if ticket.Status == SupportResolved {
+		return
+	}
+	if s.sla.FirstResponse > 0 && ticket.FirstResponseAt == nil {
+		due := ticket.QueuedAt.Add(s.sla.FirstResponse)
+		ticket.FirstResponseDueAt = &due
+	}
+	if s.sla.Resolution > 0 {
+		due := ticket.QueuedAt.Add(s.sla.Resolution)
+		ticket.ResolutionDueAt = &due
+	}
+}
+
+// trackSupportMessage updates the ticket of a support conversation for a new message:
+// the customer's messages queue it unless it is open, and the assigned agent's first
+// answer stops the first response timer
+func trackSupportMessage(tx *sqlx.Tx, message *Message) error {
+	_, err := tx.Exec(`
+		INSERT INTO support_tickets (conversation_id, customer_id)
+		SELECT c.id, c.created_by FROM conversations c
+		WHERE c.id = $1 AND c.type = 'support' AND c.created_by = $2
+		ON CONFLICT (conversation_id) DO UPDATE
+		SET status = 'queued', agent_id = NULL, queued_at = CURRENT_TIMESTAMP, assigned_at = NULL,
+			first_response_at = NULL, resolved_at = NULL, sla_breached_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE support_tickets.status = 'resolved'
+	`, message.ConversationID, message.SenderID)
+	if err != nil {
+		return fmt.Errorf("failed to queue support ticket: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE support_tickets
+		SET first_response_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE conversation_id = $1 AND agent_id = $2 AND status = 'assigned' AND first_response_at IS NULL
+	`, message.ConversationID, message.SenderID)
+	if err != nil {
+		return fmt.Errorf("failed to record support response: %w", err)
+	}
+	return nil
+}
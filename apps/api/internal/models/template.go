@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// TemplateParticipant is a user added to every conversation created from a template
+type TemplateParticipant struct {
+	UserID uuid.UUID `json:"user_id"`
+	// Role is "admin" or "member"; the user creating the conversation owns it
+	Role string `json:"role" example:"admin"`
+}
+
+// TemplateAutomation is an automation set up on every conversation created from a
+// template; see Automation
+type TemplateAutomation struct {
+	Event      string  `json:"event" example:"participant.joined"`
+	Action     string  `json:"action" example:"webhook"`
+	Message    *string `json:"message,omitempty"`
+	WebhookURL *string `json:"webhook_url,omitempty"`
+}
+
+// TemplateParticipants is stored as a JSON array
+type TemplateParticipants []TemplateParticipant
+
+// Scan implements sql.Scanner
+func (p *TemplateParticipants) Scan(value interface{}) error {
+	return scanJSONArray(value, p)
+}
+
+// Value implements driver.Valuer
+func (p TemplateParticipants) Value() (driver.Value, error) {
+	return jsonArrayValue(p, len(p))
+}
+
+// TemplateAutomations is stored as a JSON array
+type TemplateAutomations []TemplateAutomation
+
+// Scan implements sql.Scanner
+func (a *TemplateAutomations) Scan(value interface{}) error {
+	return scanJSONArray(value, a)
+}
+
+// Value implements driver.Valuer
+func (a TemplateAutomations) Value() (driver.Value, error) {
+	return jsonArrayValue(a, len(a))
+}
+
+// ConversationTemplate presets the name, participants, settings and automations of
+// group conversations that are created the same way again and again
+type ConversationTemplate struct {
+	ID          uuid.UUID `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description *string   `db:"description" json:"description,omitempty"`
+	// NamePattern names the conversations; {title}, {creator} and {date} are filled in
+	NamePattern       string               `db:"name_pattern" json:"name_pattern" example:"Incident {date}: {title}"`
+	AvatarURL         *string              `db:"avatar_url" json:"avatar_url,omitempty"`
+	AccentColor       *string              `db:"accent_color" json:"accent_color,omitempty"`
+	Theme             *string              `db:"theme" json:"theme,omitempty"`
+	WelcomeMessage    *string              `db:"welcome_message" json:"welcome_message,omitempty"`
+	Rules             *string              `db:"rules" json:"rules,omitempty"`
+	HistoryVisibility *string              `db:"history_visibility" json:"history_visibility,omitempty"`
+	Participants      TemplateParticipants `db:"participants" json:"participants"`
+	Automations       TemplateAutomations  `db:"automations" json:"automations"`
+	CreatedBy         *uuid.UUID           `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt         time.Time            `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time            `db:"updated_at" json:"updated_at"`
+}
+
+// maxConversationNameLength matches the conversations.name column
+const maxConversationNameLength = 255
+
+// ConversationName fills in the name pattern. Patterns that come out empty, such as
+// a lone {title} without one, fall back to the template's name.
+func (t *ConversationTemplate) ConversationName(title, creator string, now time.Time) string {
+	name := strings.NewReplacer(
+		"{title}", title,
+		"{creator}", creator,
+		"{date}", now.UTC().Format("2006-01-02"),
+	).Replace(t.NamePattern)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return t.Name
+	}
+	return truncate(name, maxConversationNameLength)
+}
+
+// TemplateService stores conversation templates, which only administrators manage
+type TemplateService struct {
+	db *sqlx.DB
+}
+
+// NewTemplateService creates a new template service
+func NewTemplateService(db *sqlx.DB) *TemplateService {
+	return &TemplateService{db: db}
+}
+
+// List returns every template by name
+func (s *TemplateService) List() ([]ConversationTemplate, error) {
+	templates := []ConversationTemplate{}
+	if err := s.db.Select(&templates, `SELECT * FROM conversation_templates ORDER BY name`); err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+// GetByID returns a template
+func (s *TemplateService) GetByID(id uuid.UUID) (*ConversationTemplate, error) {
+	template := &ConversationTemplate{}
+	err := s.db.Get(template, `SELECT * FROM conversation_templates WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return template, nil
+}
+
+// Create stores a new template. Names are unique; ErrConflict is returned for one
+// that is taken.
+func (s *TemplateService) Create(template *ConversationTemplate) error {
+	err := s.db.Get(template, `
+		INSERT INTO conversation_templates
+			(name, description, name_pattern, avatar_url, accent_color, theme,
+			 welcome_message, rules, history_visibility, participants, automations, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING *
+	`, template.Name, template.Description, template.NamePattern, template.AvatarURL, template.AccentColor,
+		template.Theme, template.WelcomeMessage, template.Rules, template.HistoryVisibility,
+		template.Participants, template.Automations, template.CreatedBy)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	return nil
+}
+
+// Update replaces a template's contents
+func (s *TemplateService) Update(template *ConversationTemplate) error {
+	err := s.db.Get(template, `
+		UPDATE conversation_templates
+		SET name = $2, description = $3, name_pattern = $4, avatar_url = $5, accent_color = $6,
+			theme = $7, welcome_message = $8, rules = $9, history_visibility = $10,
+			participants = $11, automations = $12, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING *
+	`, template.ID, template.Name, template.Description, template.NamePattern, template.AvatarURL,
+		template.AccentColor, template.Theme, template.WelcomeMessage, template.Rules,
+		template.HistoryVisibility, template.Participants, template.Automations)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a template. Conversations created from it are left as they are.
+func (s *TemplateService) Delete(id uuid.UUID) error {
+	result, err := s.db.Exec(`DELETE FROM conversation_templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// scanJSONArray reads a JSON array column into dst; NULL reads as empty
+func scanJSONArray(value interface{}, dst interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		data = []byte("[]")
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported type %T for a JSON array", value)
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// jsonArrayValue encodes v for a JSON array column, writing empty arrays rather than null
+func jsonArrayValue(v interface{}, length int) (driver.Value, error) {
+	if length == 0 {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Day buckets of display hints, from the most recent
+const (
+	DayToday     = "today"
+	DayYesterday = "yesterday"
+	DayThisWeek  = "this_week"
+	DayThisYear  = "this_year"
+	DayOlder     = "older"
+)
+
+// DisplayHints help clients label a timestamp the way the user sees the calendar, in
+// their timezone
+type DisplayHints struct {
+	IsToday bool `json:"is_today"`
+	// DayBucket is today, yesterday, this_week for the five days before, this_year
+	// or older
+	DayBucket string `json:"day_bucket" example:"yesterday"`
+	LocalDate string `json:"local_date" example:"2026-10-17"`
+	LocalTime string `json:"local_time" example:"21:40"`
+}
+
+// ValidTimezone reports whether name is an IANA timezone, such as Europe/Berlin
+func ValidTimezone(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// location returns the timezone called name, falling back to UTC for names that
+// don't load
+func location(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NewDisplayHints describes t as seen at now in a timezone
+func NewDisplayHints(t time.Time, timezone string, now time.Time) *DisplayHints {
+	loc := location(timezone)
+	local := t.In(loc)
+	now = now.In(loc)
+
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	hints := &DisplayHints{
+		LocalDate: local.Format("2006-01-02"),
+		LocalTime: local.Format("15:04"),
+	}
+	switch {
+	case !day.Before(today):
+		hints.IsToday = !day.After(today)
+		hints.DayBucket = DayToday
+	case !day.Before(today.AddDate(0, 0, -1)):
+		hints.DayBucket = DayYesterday
+	case !day.Before(today.AddDate(0, 0, -6)):
+		hints.DayBucket = DayThisWeek
+	case local.Year() == now.Year():
+		hints.DayBucket = DayThisYear
+	default:
+		hints.DayBucket = DayOlder
+	}
+	return hints
+}
+
+// Timezone returns the timezone of a user
+func (s *UserService) Timezone(userID uuid.UUID) (string, error) {
+	var timezone string
+	if err := s.db.Get(&timezone, `SELECT timezone FROM users WHERE id = $1`, userID); err != nil {
+		return "", fmt.Errorf("failed to get timezone: %w", err)
+	}
+	return timezone, nil
+}
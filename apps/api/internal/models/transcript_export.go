@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"talkify/apps/api/internal/encryption"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxTranscriptMessages is the most messages one transcript covers; longer
+// conversations are exported a date range at a time
+const MaxTranscriptMessages = 10000
+
+// TranscriptExport is a rendered transcript of a conversation, or of a date range in
+// it, built in the background for one user. Its statuses are those of file archives.
+type TranscriptExport struct {
+	ID             uuid.UUID `db:"id" json:"id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	RequestedBy    uuid.UUID `db:"requested_by" json:"requested_by"`
+	Status         string    `db:"status" json:"status"`
+	// From and To bound when the messages were sent, From included and To not
+	From *time.Time `db:"from_at" json:"from,omitempty"`
+	To   *time.Time `db:"to_at" json:"to,omitempty"`
+	// Timezone is the IANA zone the transcript shows times in
+	Timezone     string     `db:"timezone" json:"timezone" example:"Europe/Berlin"`
+	MessageCount int        `db:"message_count" json:"message_count"`
+	SizeBytes    int64      `db:"size_bytes" json:"size_bytes"`
+	Error        *string    `db:"error" json:"error,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	CompletedAt  *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
+	// DataKey is the transcript's encryption key, wrapped with the master key named by KeyID
+	DataKey *string `db:"data_key" json:"-"`
+	KeyID   *string `db:"key_id" json:"-"`
+}
+
+// TranscriptSource is what a transcript is rendered from
+type TranscriptSource struct {
+	Conversation *Conversation
+	// Others are the usernames of the other participants, which name direct conversations
+	Others []string
+	// Messages are oldest first, without deleted ones
+	Messages []Message
+}
+
+// TranscriptExportService tracks transcript exports
+type TranscriptExportService struct {
+	db        *sqlx.DB
+	encryptor encryption.Encryptor
+}
+
+// NewTranscriptExportService creates a new transcript export service
+func NewTranscriptExportService(db *sqlx.DB, encryptor encryption.Encryptor) *TranscriptExportService {
+	return &TranscriptExportService{db: db, encryptor: encryptor}
+}
+
+// Create records a new pending export, or returns the user's export of the same range
+// that is still being built. As with file archives, exports pending for over an hour
+// were lost to a restart and are not reused.
+func (s *TranscriptExportService) Create(conversationID, userID uuid.UUID, from, to *time.Time, timezone string, ttl time.Duration) (export *TranscriptExport, created bool, err error) {
+	export = &TranscriptExport{}
+	err = s.db.Get(export, `
+		SELECT * FROM transcript_exports
+		WHERE conversation_id = $1 AND requested_by = $2 AND status = 'pending'
+			AND from_at IS NOT DISTINCT FROM $3 AND to_at IS NOT DISTINCT FROM $4 AND timezone = $5
+			AND created_at > NOW() - INTERVAL '1 hour'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, conversationID, userID, from, to, timezone)
+	if err == nil {
+		return export, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to get transcript export: %w", err)
+	}
+
+	err = s.db.Get(export, `
+		INSERT INTO transcript_exports (conversation_id, requested_by, from_at, to_at, timezone, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *
+	`, conversationID, userID, from, to, timezone, time.Now().Add(ttl))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create transcript export: %w", err)
+	}
+	return export, true, nil
+}
+
+// Get returns an export that hasn't expired
+func (s *TranscriptExportService) Get(exportID uuid.UUID) (*TranscriptExport, error) {
+	export := &TranscriptExport{}
+	err := s.db.Get(export, `
+		SELECT * FROM transcript_exports WHERE id = $1 AND expires_at > NOW()
+	`, exportID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transcript export: %w", err)
+	}
+	return export, nil
+}
+
+// Source loads the conversation of an export and the messages in its range that the
+// requester can see. More than limit messages fail with ErrInvalidInput.
+func (s *TranscriptExportService) Source(export *TranscriptExport, limit int) (*TranscriptSource, error) {
+	conversation, err := NewConversationService(s.db, s.encryptor).GetByID(export.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	source := &TranscriptSource{Conversation: conversation, Others: []string{}}
+	err = s.db.Select(&source.Others, `
+		SELECT `+displayedUsername+` FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.conversation_id = $1 AND cp.user_id != $2
+		ORDER BY cp.joined_at, u.username
+		LIMIT 5
+	`, export.ConversationID, export.RequestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participants: %w", err)
+	}
+
+	// Messages from before the requester could see history are left out, as are all of
+	// them once the requester has left
+	err = s.db.Select(&source.Messages, `
+		SELECT m.*, `+displayedUsername+` as sender_username, mr.reactions
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		`+messageReactionsJoin+`
+		WHERE m.conversation_id = $1 AND NOT m.is_deleted AND `+visibleHistory("$2")+`
+			AND ($3::timestamptz IS NULL OR m.created_at >= $3)
+			AND ($4::timestamptz IS NULL OR m.created_at < $4)
+		ORDER BY m.created_at, m.id
+		LIMIT $5
+	`, export.ConversationID, export.RequestedBy, export.From, export.To, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transcript messages: %w", err)
+	}
+	if len(source.Messages) > limit {
+		return nil, fmt.Errorf("%w: the transcript would have over %d messages; export a shorter date range", ErrInvalidInput, limit)
+	}
+
+	found := make([]*Message, len(source.Messages))
+	for i := range source.Messages {
+		content, err := s.encryptor.DecryptString(source.Messages[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt message: %w", err)
+		}
+		source.Messages[i].Content = content
+		found[i] = &source.Messages[i]
+	}
+	hideViewOnceMedia(found...)
+	if err := openMedia(s.encryptor, found...); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Complete marks an export ready for download, recording its size and key
+func (s *TranscriptExportService) Complete(export *TranscriptExport) error {
+	_, err := s.db.Exec(`
+		UPDATE transcript_exports
+		SET status = 'ready', message_count = $2, size_bytes = $3, data_key = $4, key_id = $5,
+			completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, export.ID, export.MessageCount, export.SizeBytes, export.DataKey, export.KeyID)
+	if err != nil {
+		return fmt.Errorf("failed to complete transcript export: %w", err)
+	}
+	return nil
+}
+
+// Fail marks an export as failed with a reason the user can see
+func (s *TranscriptExportService) Fail(exportID uuid.UUID, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE transcript_exports
+		SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, exportID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark transcript export failed: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired removes expired exports and returns their IDs so their files can be
+// deleted
+func (s *TranscriptExportService) PurgeExpired() ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := s.db.Select(&ids, `DELETE FROM transcript_exports WHERE expires_at <= NOW() RETURNING id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge transcript exports: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// reconcileUnreadBatch is how many participants one reconciliation statement checks
+const reconcileUnreadBatch = 1000
+
+// UnreadCount is how many messages a user has not read in a conversation
+type UnreadCount struct {
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	UnreadCount    int       `db:"unread_count" json:"unread_count"`
+}
+
+// UnreadSummary is a user's unread messages across their conversations
+type UnreadSummary struct {
+	Total int `json:"total"`
+	// Conversations lists the conversations with unread messages
+	Conversations []UnreadCount `json:"conversations"`
+}
+
+// UnreadCounters are what polling clients compare to tell whether anything changed,
+// read from the counters and conversation summaries without touching messages
+type UnreadCounters struct {
+	UnreadCount int `db:"unread_count"`
+	// LastMessageAt is when the latest message was sent; nil without messages
+	LastMessageAt *time.Time `db:"last_message_at"`
+}
+
+// GetUnreadCounters returns a user's unread messages and latest message across their
+// conversations
+func (s *ConversationService) GetUnreadCounters(userID uuid.UUID) (*UnreadCounters, error) {
+	var counters UnreadCounters
+	err := s.db.Get(&counters, `
+		SELECT COALESCE(SUM(cp.unread_count), 0) AS unread_count,
+			MAX(cs.last_activity_at) FILTER (WHERE cs.last_message_id IS NOT NULL) AS last_message_at
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		LEFT JOIN conversation_summaries cs ON cs.conversation_id = cp.conversation_id
+		WHERE cp.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counters: %w", err)
+	}
+	return &counters, nil
+}
+
+// GetConversationUnreadCounters returns a participant's unread messages and the latest
+// message of one conversation, or ErrNotFound when the user is not a participant
+func (s *ConversationService) GetConversationUnreadCounters(conversationID, userID uuid.UUID) (*UnreadCounters, error) {
+	var counters UnreadCounters
+	err := s.db.Get(&counters, `
+		SELECT cp.unread_count,
+			CASE WHEN cs.last_message_id IS NOT NULL THEN cs.last_activity_at END AS last_message_at
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		LEFT JOIN conversation_summaries cs ON cs.conversation_id = cp.conversation_id
+		WHERE cp.conversation_id = $1 AND cp.user_id = $2
+	`, conversationID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counters: %w", err)
+	}
+	return &counters, nil
+}
+
+// recountUnread recomputes a participant's unread counter, for changes the triggers
+// keeping it up to date can't follow message by message
+func recountUnread(tx *sqlx.Tx, conversationID, userID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE conversation_participants
+		SET unread_count = conversation_unread_count(conversation_id, user_id)
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to recount unread messages: %w", err)
+	}
+	return nil
+}
+
+// GetUnreadSummary returns the user's unread counters, read as they are kept rather
+// than counted
+func (s *ConversationService) GetUnreadSummary(userID uuid.UUID) (*UnreadSummary, error) {
+	return unreadSummary(s.db, userID)
+}
+
+func unreadSummary(q sqlx.Queryer, userID uuid.UUID) (*UnreadSummary, error) {
+	summary := &UnreadSummary{Conversations: []UnreadCount{}}
+	err := sqlx.Select(q, &summary.Conversations, `
+		SELECT cp.conversation_id, cp.unread_count
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id AND c.deleted_at IS NULL
+		WHERE cp.user_id = $1 AND cp.unread_count > 0
+		ORDER BY cp.unread_count DESC, cp.conversation_id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+	for _, count := range summary.Conversations {
+		summary.Total += count.UnreadCount
+	}
+	return summary, nil
+}
+
+// ReconcileUnreadCounts recomputes every unread counter and corrects the ones that
+// drifted, returning how many were corrected. Participants are checked in batches so
+// no statement holds many rows locked.
+func (s *ConversationService) ReconcileUnreadCounts() (int, error) {
+	var (
+		corrected         int
+		afterConversation = uuid.Nil
+		afterUser         = uuid.Nil
+	)
+	for {
+		var batch struct {
+			Checked        int        `db:"checked"`
+			Corrected      int        `db:"corrected"`
+			ConversationID *uuid.UUID `db:"conversation_id"`
+			UserID         *uuid.UUID `db:"user_id"`
+		}
+		err := s.db.Get(&batch, `
+			WITH batch AS (
+				SELECT conversation_id, user_id, unread_count
+				FROM conversation_participants
+				WHERE (conversation_id, user_id) > ($1, $2)
+				ORDER BY conversation_id, user_id
+				LIMIT $3
+			), counted AS (
+				SELECT conversation_id, user_id, unread_count,
+					conversation_unread_count(conversation_id, user_id) AS actual
+				FROM batch
+			), fixed AS (
+				UPDATE conversation_participants cp
+				SET unread_count = counted.actual
+				FROM counted
+				WHERE cp.conversation_id = counted.conversation_id
+				  AND cp.user_id = counted.user_id
+				  AND counted.unread_count != counted.actual
+				  -- Counters a trigger moved meanwhile are left for the next run
+				  AND cp.unread_count = counted.unread_count
+				RETURNING 1
+			), last AS (
+				SELECT conversation_id, user_id FROM batch
+				ORDER BY conversation_id DESC, user_id DESC
+				LIMIT 1
+			)
+			SELECT (SELECT COUNT(*) FROM batch) AS checked,
+				(SELECT COUNT(*) FROM fixed) AS corrected,
+				last.conversation_id, last.user_id
+			FROM (SELECT 1) one
+			LEFT JOIN last ON true
+		`, afterConversation, afterUser, reconcileUnreadBatch)
+		if err != nil {
+			return corrected, fmt.Errorf("failed to reconcile unread counts: %w", err)
+		}
+		corrected += batch.Corrected
+		if batch.Checked < reconcileUnreadBatch || batch.ConversationID == nil {
+			return corrected, nil
+		}
+		afterConversation, afterUser = *batch.ConversationID, *batch.UserID
+	}
+}
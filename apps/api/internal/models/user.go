@@ -1,36 +1,105 @@
 package models
 
 import (
+	"database/sql"
 	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/password"
 	"time"
 
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
 )
 
 type User struct {
 	ID           uuid.UUID  `db:"id" json:"id"`
 	Username     string     `db:"username" json:"username"`
 	Email        string     `db:"email" json:"email"`
+	EmailIndex   *string    `db:"email_index" json:"-"`
 	Phone        string     `db:"phone" json:"phone"`
 	PasswordHash string     `db:"password_hash" json:"-"`
 	Status       string     `db:"status" json:"status"`
 	LastSeen     *time.Time `db:"last_seen" json:"last_seen,omitempty"`
 	IsOnline     bool       `db:"is_online" json:"is_online"`
 	IsActive     bool       `db:"is_active" json:"is_active"`
+	IsAdmin      bool       `db:"is_admin" json:"-"`
 	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+
+	// Contact details shown on the public profile; see profile.go
+	ShareEmail bool `db:"share_email" json:"share_email"`
+	SharePhone bool `db:"share_phone" json:"share_phone"`
+
+	// PasswordChangeRequired is set by administrators; the user has to choose a new
+	// password before using the API again
+	PasswordChangeRequired bool `db:"password_change_required" json:"password_change_required"`
+
+	// IsSystem accounts, such as Talkify Security, are posted as by the server; nobody
+	// can sign in to them
+	IsSystem bool `db:"is_system" json:"-"`
+
+	// UndoSendSeconds holds the user's messages that long before sending; see outbox.go
+	UndoSendSeconds int `db:"undo_send_seconds" json:"undo_send_seconds"`
+
+	// Timezone is the IANA zone quiet hours, digests and display hints follow
+	Timezone string `db:"timezone" json:"timezone"`
+
+	// Managed by the inactive account policy; see inactive.go
+	LegalHold          bool       `db:"legal_hold" json:"-"`
+	InactivityWarnedAt *time.Time `db:"inactivity_warned_at" json:"-"`
+	DeactivatedAt      *time.Time `db:"deactivated_at" json:"-"`
+	AnonymizedAt       *time.Time `db:"anonymized_at" json:"-"`
+
+	// FederatedAddress is set on shadow accounts standing for users of other
+	// deployments, along with their ID there; see federation.go
+	FederatedAddress *string    `db:"federated_address" json:"federated_address,omitempty"`
+	FederatedUserID  *uuid.UUID `db:"federated_user_id" json:"-"`
+}
+
+// PublicUser is what other users may see of an account. Contact details stay private.
+type PublicUser struct {
+	ID        uuid.UUID  `json:"id"`
+	Username  string     `json:"username"`
+	Status    string     `json:"status"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	IsOnline  bool       `json:"is_online"`
+	CreatedAt time.Time  `json:"created_at"`
+	// FederatedAddress is set for users of other deployments
+	FederatedAddress *string `json:"federated_address,omitempty"`
+}
+
+// Public projects the user onto the fields visible to other users
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:        u.ID,
+		Username:  u.Username,
+		Status:    u.Status,
+		LastSeen:  u.LastSeen,
+		IsOnline:  u.IsOnline,
+		CreatedAt: u.CreatedAt,
+
+		FederatedAddress: u.FederatedAddress,
+	}
+}
+
+// UserListOptions filters and paginates a user listing
+type UserListOptions struct {
+	Query     string
+	Limit     int
+	Offset    int
+	ExcludeID uuid.UUID
 }
 
 type UserService struct {
 	db        *sqlx.DB
-	encryptor *encryption.Manager
+	encryptor encryption.Encryptor
 }
 
-func NewUserService(db *sqlx.DB, encryptor *encryption.Manager) *UserService {
+func NewUserService(db *sqlx.DB, encryptor encryption.Encryptor) *UserService {
 	return &UserService{
 		db:        db,
 		encryptor: encryptor,
@@ -46,7 +115,7 @@ type CreateUserInput struct {
 
 func (s *UserService) Create(input *CreateUserInput) (*User, error) {
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(input.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %v", err)
 	}
@@ -68,22 +137,24 @@ func (s *UserService) Create(input *CreateUserInput) (*User, error) {
 		Phone:        encryptedPhone,
 		PasswordHash: string(hashedPassword),
 		IsActive:     true,
-		Status:       "Hey, I'm using Talkify!", // Default status
+		Status:       DefaultUserStatus,
 	}
 
+	// New users start with the workspace's default status
 	query := `
-		INSERT INTO users (username, email, phone, password_hash, is_active, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at`
+		INSERT INTO users (username, email, email_index, phone, password_hash, is_active, status)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE((SELECT default_status FROM workspace_branding), $7))
+		RETURNING id, status, created_at, updated_at`
 
 	err = s.db.QueryRowx(query,
 		user.Username,
 		user.Email,
+		emailIndex(s.encryptor, input.Email),
 		user.Phone,
 		user.PasswordHash,
 		user.IsActive,
 		user.Status,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Status, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %v", err)
@@ -105,7 +176,7 @@ func (s *UserService) Login(input *LoginInput) (*User, error) {
 	user := &User{}
 	err := s.db.Get(user, `
 		SELECT * FROM users 
-		WHERE username = $1 AND is_active = true
+		WHERE username = $1 AND is_active = true AND NOT is_system AND federated_address IS NULL
 	`, input.Username)
 
 	if err != nil {
@@ -113,10 +184,15 @@ func (s *UserService) Login(input *LoginInput) (*User, error) {
 	}
 
 	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
-	if err != nil {
+	if ok, err := password.Verify(user.PasswordHash, input.Password); !ok {
+		if err != nil {
+			logger.Error("Failed to verify password", err, map[string]interface{}{
+				"user_id": user.ID,
+			})
+		}
 		return nil, ErrUnauthorized
 	}
+	s.rehashPassword(user, input.Password)
 
 	// Decrypt sensitive data
 	var decryptErr error
@@ -166,6 +242,24 @@ func (s *UserService) GetByID(id uuid.UUID) (*User, error) {
 	return user, nil
 }
 
+// GetByIDs returns the active users among ids, in no particular order
+func (s *UserService) GetByIDs(ids []uuid.UUID) ([]User, error) {
+	users := []User{}
+	err := s.db.Select(&users, `
+		SELECT * FROM users
+		WHERE id = ANY($1::uuid[]) AND is_active = true
+	`, pq.StringArray(uuidStrings(ids)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	for i := range users {
+		users[i].Email, _ = s.encryptor.DecryptString(users[i].Email)
+		users[i].Phone, _ = s.encryptor.DecryptString(users[i].Phone)
+	}
+	return users, nil
+}
+
 func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassword string) error {
 	user := &User{}
 	err := s.db.Get(user, "SELECT password_hash FROM users WHERE id = $1", userID)
@@ -174,13 +268,12 @@ func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassw
 	}
 
 	// Verify current password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword))
-	if err != nil {
+	if ok, _ := password.Verify(user.PasswordHash, currentPassword); !ok {
 		return ErrUnauthorized
 	}
 
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(newPassword)
 	if err != nil {
 		return err
 	}
@@ -188,13 +281,113 @@ func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassw
 	// Update password
 	_, err = s.db.Exec(`
 		UPDATE users 
-		SET password_hash = $1, updated_at = CURRENT_TIMESTAMP 
+		SET password_hash = $1, password_change_required = false, updated_at = CURRENT_TIMESTAMP 
 		WHERE id = $2
-	`, string(hashedPassword), userID)
+	`, hashedPassword, userID)
 
 	return err
 }
 
+// SetPasswordChangeRequired makes a user choose a new password before using the API
+// again, or lifts the requirement
+func (s *UserService) SetPasswordChangeRequired(id uuid.UUID, required bool) error {
+	var updated uuid.UUID
+	err := s.db.Get(&updated, `
+		UPDATE users SET password_change_required = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND anonymized_at IS NULL
+		RETURNING id
+	`, id, required)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set password change requirement: %w", err)
+	}
+	return nil
+}
+
+// SetVerified marks a user verified, raising their conversation limits, or unmarks them
+func (s *UserService) SetVerified(id uuid.UUID, verified bool) error {
+	var updated uuid.UUID
+	err := s.db.Get(&updated, `
+		UPDATE users
+		SET verified_at = CASE WHEN $2 THEN COALESCE(verified_at, CURRENT_TIMESTAMP) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND anonymized_at IS NULL
+		RETURNING id
+	`, id, verified)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set verified: %w", err)
+	}
+	return nil
+}
+
+// CheckPassword returns ErrUnauthorized unless plain is the user's password
+func (s *UserService) CheckPassword(userID uuid.UUID, plain string) error {
+	var hash string
+	err := s.db.Get(&hash, "SELECT password_hash FROM users WHERE id = $1", userID)
+	if err != nil {
+		return ErrNotFound
+	}
+	if ok, _ := password.Verify(hash, plain); !ok {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// rehashPassword replaces a legacy or outdated hash of a password that just verified.
+// Failures are only logged; the old hash keeps working until the next login.
+func (s *UserService) rehashPassword(user *User, plain string) {
+	if !password.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := password.Hash(plain)
+	if err == nil {
+		// Only replace the hash that was verified, should the password change meanwhile
+		_, err = s.db.Exec(`
+			UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3
+		`, hash, user.ID, user.PasswordHash)
+	}
+	if err != nil {
+		logger.Warn("Failed to rehash password", map[string]interface{}{
+			"user_id": user.ID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	user.PasswordHash = hash
+}
+
+// CountPasswordHashes counts stored password hashes by scheme, for tracking how many
+// legacy hashes remain
+func (s *UserService) CountPasswordHashes() (map[string]int64, error) {
+	rows := []struct {
+		Scheme string `db:"scheme"`
+		Count  int64  `db:"count"`
+	}{}
+	err := s.db.Select(&rows, `
+		SELECT CASE
+				WHEN password_hash LIKE '$argon2id$%' THEN 'argon2id'
+				WHEN password_hash LIKE '$2_$%' THEN 'bcrypt'
+				ELSE 'other'
+			END AS scheme, COUNT(*) AS count
+		FROM users
+		WHERE anonymized_at IS NULL
+		GROUP BY 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count password hashes: %w", err)
+	}
+	counts := map[string]int64{password.SchemeArgon2id: 0, password.SchemeBcrypt: 0}
+	for _, row := range rows {
+		counts[row.Scheme] = row.Count
+	}
+	return counts, nil
+}
+
 func (s *UserService) GetByUsername(username string) (*User, error) {
 	var user User
 	err := s.db.Get(&user, "SELECT * FROM users WHERE username = $1", username)
@@ -204,23 +397,124 @@ func (s *UserService) GetByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// UsernameTaken reports whether an account, active or not, has username
+func (s *UserService) UsernameTaken(username string) (bool, error) {
+	var taken bool
+	err := s.db.Get(&taken, `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, username)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up username: %w", err)
+	}
+	return taken, nil
+}
+
 func (s *UserService) Update(user *User) error {
+	// Contact details are stored encrypted, like on creation
+	encryptedEmail, err := s.encryptor.EncryptString(user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt email: %v", err)
+	}
+	encryptedPhone, err := s.encryptor.EncryptString(user.Phone)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt phone: %v", err)
+	}
+
 	query := `
 		UPDATE users 
-		SET username = $1, email = $2, phone = $3, status = $4, is_online = $5
-		WHERE id = $6
+		SET username = $1, email = $2, phone = $3, status = $4, is_online = $5,
+			share_email = $6, share_phone = $7, email_index = $9
+		WHERE id = $8
 		RETURNING updated_at`
 
 	return s.db.QueryRowx(query,
 		user.Username,
-		user.Email,
-		user.Phone,
+		encryptedEmail,
+		encryptedPhone,
 		user.Status,
 		user.IsOnline,
+		user.ShareEmail,
+		user.SharePhone,
 		user.ID,
+		emailIndex(s.encryptor, user.Email),
 	).Scan(&user.UpdatedAt)
 }
 
+// ProfileChanges are the profile fields to change. Nil fields are left as they are; an
+// empty phone or status clears it.
+type ProfileChanges struct {
+	Username        *string
+	Email           *string
+	Phone           *string
+	Status          *string
+	ShareEmail      *bool
+	SharePhone      *bool
+	UndoSendSeconds *int
+	Timezone        *string
+}
+
+// UpdateProfile changes only the given fields of a user's profile, encrypting only the
+// contact details that change, and returns the updated user. A username that is taken
+// returns ErrConflict.
+func (s *UserService) UpdateProfile(userID uuid.UUID, changes ProfileChanges) (*User, error) {
+	sets := []string{}
+	args := []interface{}{userID}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if changes.Username != nil {
+		set("username", *changes.Username)
+	}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{{"email", changes.Email}, {"phone", changes.Phone}} {
+		if field.value == nil {
+			continue
+		}
+		encrypted, err := s.encryptor.EncryptString(*field.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", field.column, err)
+		}
+		set(field.column, encrypted)
+	}
+	if changes.Email != nil {
+		set("email_index", emailIndex(s.encryptor, *changes.Email))
+	}
+	if changes.Status != nil {
+		set("status", *changes.Status)
+	}
+	if changes.ShareEmail != nil {
+		set("share_email", *changes.ShareEmail)
+	}
+	if changes.SharePhone != nil {
+		set("share_phone", *changes.SharePhone)
+	}
+	if changes.UndoSendSeconds != nil {
+		set("undo_send_seconds", *changes.UndoSendSeconds)
+	}
+	if changes.Timezone != nil {
+		set("timezone", *changes.Timezone)
+	}
+
+	if len(sets) > 0 {
+		result, err := s.db.Exec(`
+			UPDATE users SET `+strings.Join(sets, ", ")+`
+			WHERE id = $1 AND is_active = true
+		`, args...)
+		if isUniqueViolation(err) {
+			return nil, ErrConflict
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update profile: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, ErrNotFound
+		}
+	}
+	return s.GetByID(userID)
+}
+
 func (s *UserService) Delete(id uuid.UUID) error {
 	_, err := s.db.Exec("UPDATE users SET is_active = false WHERE id = $1", id)
 	return err
@@ -236,6 +530,70 @@ func (s *UserService) SetOnlineStatus(id uuid.UUID, isOnline bool) error {
 	return err
 }
 
+// Heartbeat marks the user online and returns the time they were seen
+func (s *UserService) Heartbeat(id uuid.UUID) (time.Time, error) {
+	var seen time.Time
+	err := s.db.Get(&seen, `
+		UPDATE users SET is_online = true, last_seen = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_active = true
+		RETURNING last_seen
+	`, id)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+	return seen, nil
+}
+
+// TouchOnline marks the given users online as of now
+func (s *UserService) TouchOnline(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(`
+		UPDATE users SET is_online = true, last_seen = CURRENT_TIMESTAMP
+		WHERE id = ANY($1::uuid[])
+	`, pq.StringArray(ids))
+	if err != nil {
+		return fmt.Errorf("failed to touch online users: %w", err)
+	}
+	return nil
+}
+
+// ExpireOnline marks users offline who have not been seen within ttl and returns how many were
+func (s *UserService) ExpireOnline(ttl time.Duration) (int64, error) {
+	result, err := s.db.Exec(`
+		UPDATE users SET is_online = false
+		WHERE is_online = true AND (last_seen IS NULL OR last_seen < CURRENT_TIMESTAMP - make_interval(secs => $1))
+	`, ttl.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire online users: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ReconcileOnline makes is_online match the given set of online users, as tracked
+// outside the database, and returns the users it marked offline
+func (s *UserService) ReconcileOnline(onlineIDs []string) ([]uuid.UUID, error) {
+	offline := []uuid.UUID{}
+	err := s.db.Select(&offline, `
+		WITH changed AS (
+			UPDATE users SET
+				is_online = (id = ANY($1::uuid[])),
+				last_seen = CASE WHEN id = ANY($1::uuid[]) THEN CURRENT_TIMESTAMP ELSE last_seen END
+			WHERE is_online OR id = ANY($1::uuid[])
+			RETURNING id, is_online
+		)
+		SELECT id FROM changed WHERE NOT is_online
+	`, pq.StringArray(onlineIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile online users: %w", err)
+	}
+	return offline, nil
+}
+
 func (s *UserService) GetAll() ([]*User, error) {
 	var users []*User
 	err := s.db.Select(&users, `
@@ -267,3 +625,36 @@ func (s *UserService) GetAll() ([]*User, error) {
 
 	return users, nil
 }
+
+// List returns a page of active users ordered by username, optionally filtered by a
+// username prefix, along with the total number of matches. Contact details are left
+// encrypted since listings only expose public fields.
+func (s *UserService) List(opts UserListOptions) ([]*User, int, error) {
+	pattern := "%"
+	if opts.Query != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		pattern = escaper.Replace(opts.Query) + "%"
+	}
+
+	var total int
+	err := s.db.Get(&total, `
+		SELECT COUNT(*) FROM users
+		WHERE is_active = true AND id != $1 AND username ILIKE $2
+	`, opts.ExcludeID, pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	users := []*User{}
+	err = s.db.Select(&users, `
+		SELECT * FROM users
+		WHERE is_active = true AND id != $1 AND username ILIKE $2
+		ORDER BY username ASC
+		LIMIT $3 OFFSET $4
+	`, opts.ExcludeID, pattern, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, total, nil
+}
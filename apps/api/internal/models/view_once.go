@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotViewOnce is returned when opening a message that is not view-once
+	ErrNotViewOnce = errors.New("message is not a view-once message")
+	// ErrAlreadyViewed is returned when a recipient opens a view-once message again
+	ErrAlreadyViewed = errors.New("view-once message was already opened")
+)
+
+// ViewOnceMedia is a view-once message opened by a participant. Its media is streamed
+// from MediaURL by the server, which never hands the URL out.
+type ViewOnceMedia struct {
+	MessageID      uuid.UUID `db:"id" json:"message_id"`
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversation_id"`
+	SenderID       uuid.UUID `db:"sender_id" json:"sender_id"`
+	MediaURL       string    `db:"media_url" json:"-"`
+	MediaEncrypted bool      `db:"media_encrypted" json:"-"`
+	ViewOnce       bool      `db:"view_once" json:"-"`
+	OpenedAt       time.Time `db:"-" json:"opened_at"`
+}
+
+// hideViewOnceMedia strips the media of view-once messages, which is only handed out
+// by OpenViewOnce
+func hideViewOnceMedia(messages ...*Message) {
+	for _, message := range messages {
+		if message.ViewOnce {
+			message.MediaURL = nil
+			message.MediaThumbnailURL = nil
+		}
+	}
+}
+
+// OpenViewOnce records a participant opening a view-once message with media, whose
+// caller then streams the media to them. Each recipient opens it once; senders can
+// always open their own message.
+func (s *MessageService) OpenViewOnce(messageID, userID uuid.UUID) (*ViewOnceMedia, error) {
+	media := &ViewOnceMedia{}
+	err := s.db.Get(media, `
+		SELECT m.id, m.conversation_id, m.sender_id, m.media_url, m.media_encrypted, m.view_once
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+		WHERE m.id = $1 AND m.media_url IS NOT NULL AND NOT m.is_deleted
+			AND `+visibleHistory("$2")+`
+	`, messageID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if !media.ViewOnce {
+		return nil, ErrNotViewOnce
+	}
+	if media.MediaEncrypted {
+		if media.MediaURL, err = decryptMediaURL(s.encryptor, media.MediaURL); err != nil {
+			return nil, err
+		}
+	}
+	if media.SenderID == userID {
+		media.OpenedAt = time.Now()
+		return media, nil
+	}
+
+	err = s.db.Get(&media.OpenedAt, `
+		INSERT INTO message_views (message_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+		RETURNING opened_at
+	`, messageID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlreadyViewed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record view: %w", err)
+	}
+	return media, nil
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Who may export transcripts and file archives of conversations
+const (
+	ExportEveryone = "everyone"
+	// ExportGroupAdmins leaves exporting groups to their owners and admins; both sides
+	// of direct conversations still may
+	ExportGroupAdmins = "group_admins"
+	ExportNobody      = "nobody"
+)
+
+// ExportPolicies are the values of WorkspaceSettings.ExportPolicy
+var ExportPolicies = []string{ExportEveryone, ExportGroupAdmins, ExportNobody}
+
+// Who may create groups
+const (
+	GroupCreationEveryone = "everyone"
+	// GroupCreationVerified leaves it to users an administrator verified
+	GroupCreationVerified = "verified"
+	GroupCreationAdmins   = "admins"
+)
+
+// GroupCreationPolicies are the values of WorkspaceSettings.GroupCreation
+var GroupCreationPolicies = []string{GroupCreationEveryone, GroupCreationVerified, GroupCreationAdmins}
+
+// WorkspaceSettings are the workspace-wide defaults admins set. Administrators and
+// system accounts are exempt from the export and group creation policies.
+type WorkspaceSettings struct {
+	// RetentionDays is how many days messages are kept; 0 keeps them
+	RetentionDays int        `db:"retention_days" json:"retention_days" example:"365"`
+	ExportPolicy  string     `db:"export_policy" json:"export_policy" example:"everyone"`
+	GroupCreation string     `db:"group_creation" json:"group_creation" example:"everyone"`
+	GuestAccess   bool       `db:"guest_access" json:"guest_access"`
+	UpdatedBy     *uuid.UUID `db:"updated_by" json:"updated_by,omitempty"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Retention is how long messages are kept, 0 when they are kept for good
+func (s *WorkspaceSettings) Retention() time.Duration {
+	return time.Duration(s.RetentionDays) * 24 * time.Hour
+}
+
+type WorkspaceSettingsService struct {
+	db *sqlx.DB
+}
+
+func NewWorkspaceSettingsService(db *sqlx.DB) *WorkspaceSettingsService {
+	return &WorkspaceSettingsService{db: db}
+}
+
+// Get returns the workspace settings
+func (s *WorkspaceSettingsService) Get() (*WorkspaceSettings, error) {
+	settings := &WorkspaceSettings{}
+	err := s.db.Get(settings, `
+		SELECT retention_days, export_policy, group_creation, guest_access, updated_by, updated_at
+		FROM workspace_settings
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Update replaces the workspace settings
+func (s *WorkspaceSettingsService) Update(settings *WorkspaceSettings) error {
+	if settings.RetentionDays < 0 || !contains(ExportPolicies, settings.ExportPolicy) ||
+		!contains(GroupCreationPolicies, settings.GroupCreation) {
+		return ErrInvalidInput
+	}
+	err := s.db.Get(settings, `
+		UPDATE workspace_settings
+		SET retention_days = $1, export_policy = $2, group_creation = $3, guest_access = $4,
+			updated_by = $5, updated_at = CURRENT_TIMESTAMP
+		RETURNING retention_days, export_policy, group_creation, guest_access, updated_by, updated_at
+	`, settings.RetentionDays, settings.ExportPolicy, settings.GroupCreation, settings.GuestAccess, settings.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace settings: %w", err)
+	}
+	return nil
+}
+
+// CanCreateGroup reports whether the group creation policy lets a user create groups
+func (s *WorkspaceSettingsService) CanCreateGroup(userID uuid.UUID) (bool, error) {
+	var allowed bool
+	err := s.db.Get(&allowed, `
+		SELECT u.is_admin OR u.is_system OR CASE ws.group_creation
+			WHEN $2 THEN true
+			WHEN $3 THEN u.verified_at IS NOT NULL
+			ELSE false
+		END
+		FROM workspace_settings ws, users u
+		WHERE u.id = $1
+	`, userID, GroupCreationEveryone, GroupCreationVerified)
+	if err != nil {
+		return false, fmt.Errorf("failed to check group creation policy: %w", err)
+	}
+	return allowed, nil
+}
+
+// CanExport reports whether the export policy lets a participant export a conversation
+func (s *WorkspaceSettingsService) CanExport(conversationID, userID uuid.UUID) (bool, error) {
+	var allowed bool
+	err := s.db.Get(&allowed, `
+		SELECT u.is_admin OR CASE ws.export_policy
+			WHEN $3 THEN true
+			WHEN $4 THEN c.type = 'direct' OR cp.role IN ('owner', 'admin')
+			ELSE false
+		END
+		FROM workspace_settings ws, users u
+		JOIN conversation_participants cp ON cp.user_id = u.id AND cp.conversation_id = $1
+		JOIN conversations c ON c.id = cp.conversation_id
+		WHERE u.id = $2
+	`, conversationID, userID, ExportEveryone, ExportGroupAdmins)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check export policy: %w", err)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,21 @@
+package password
+
+// commonPasswords are refused whatever the policy. They are compared ignoring case.
+var commonPasswords = []string{
+	"123456", "123456789", "12345678", "1234567890", "12345", "1234567", "111111",
+	"000000", "123123", "654321", "666666", "121212", "112233", "987654321",
+	"11111111", "88888888", "00000000", "12341234", "123321", "qwerty", "qwerty123",
+	"qwertyuiop", "1q2w3e4r", "1q2w3e4r5t", "1qaz2wsx", "zaq12wsx", "asdfghjkl",
+	"asdf1234", "password", "password1", "password12", "password123", "passw0rd",
+	"p@ssw0rd", "p@ssword", "pa$$word", "letmein", "letmein123", "welcome",
+	"welcome1", "welcome123", "iloveyou", "iloveyou1", "admin", "admin123",
+	"administrator", "root", "toor", "changeme", "secret", "default", "guest",
+	"login", "master", "hello123", "abc123", "abcd1234", "abcdefg", "abcdefgh",
+	"monkey", "dragon", "football", "baseball", "basketball", "soccer", "superman",
+	"batman", "trustno1", "sunshine", "princess", "shadow", "michael", "jennifer",
+	"charlie", "jordan23", "starwars", "pokemon", "whatever", "freedom", "computer",
+	"internet", "mustang", "access", "flower", "cheese", "summer", "winter",
+	"autumn", "spring", "loveme", "lovely", "666666666", "7777777", "987654",
+	"q1w2e3r4", "q1w2e3r4t5", "zxcvbnm", "zxcvbnm123", "aa123456", "a1b2c3d4",
+	"talkify", "talkify123",
+}
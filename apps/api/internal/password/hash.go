@@ -0,0 +1,139 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// SchemeArgon2id hashes are what new passwords are stored as
+	SchemeArgon2id = "argon2id"
+	// SchemeBcrypt hashes were stored before Argon2id; they are still verified and
+	// replaced at the next successful login
+	SchemeBcrypt = "bcrypt"
+
+	saltLength = 16
+	keyLength  = 32
+)
+
+// ErrUnknownHash is returned for stored hashes of no supported scheme
+var ErrUnknownHash = errors.New("unknown password hash scheme")
+
+// HashParams are the Argon2id cost parameters
+type HashParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultHashParams follow the OWASP recommendation for Argon2id
+var DefaultHashParams = HashParams{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+var (
+	paramsMu sync.RWMutex
+	params   = DefaultHashParams
+)
+
+// SetHashParams sets the parameters new hashes are made with. Hashes made with other
+// parameters still verify, and NeedsRehash reports them.
+func SetHashParams(p HashParams) {
+	paramsMu.Lock()
+	defer paramsMu.Unlock()
+	params = p
+}
+
+func currentParams() HashParams {
+	paramsMu.RLock()
+	defer paramsMu.RUnlock()
+	return params
+}
+
+// Hash hashes password with Argon2id, in the PHC string format:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+func Hash(password string) (string, error) {
+	p := currentParams()
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, keyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", SchemeArgon2id, argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches hash, an Argon2id or legacy bcrypt hash
+func Verify(hash, password string) (bool, error) {
+	switch Scheme(hash) {
+	case SchemeArgon2id:
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case SchemeBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+// NeedsRehash reports whether hash should be replaced: it is a legacy bcrypt hash or
+// was made with other parameters than the current ones
+func NeedsRehash(hash string) bool {
+	if Scheme(hash) != SchemeArgon2id {
+		return true
+	}
+	p, _, _, err := decodeArgon2id(hash)
+	return err != nil || p != currentParams()
+}
+
+// Scheme names the scheme of a stored hash, or returns "" when it is unknown
+func Scheme(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$"+SchemeArgon2id+"$"):
+		return SchemeArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return SchemeBcrypt
+	default:
+		return ""
+	}
+}
+
+func decodeArgon2id(hash string) (HashParams, []byte, []byte, error) {
+	var p HashParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id key")
+	}
+	return p, salt, key, nil
+}
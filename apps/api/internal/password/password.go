@@ -0,0 +1,175 @@
+// Package password hashes passwords and checks new ones against the configured policy
+// and, optionally, against the Have I Been Pwned list of passwords seen in data breaches.
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxBytes bounds what a single password can make the server hash
+const maxBytes = 256
+
+// Policy is what new passwords must meet
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Banned passwords are refused on top of the built-in list of common passwords
+	Banned []string
+}
+
+// PolicyError lists every rule a password breaks
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Problems, "; ")
+}
+
+// Checker checks passwords against a policy and, when it has a breach client, against
+// breached passwords
+type Checker struct {
+	policy   Policy
+	banned   map[string]bool
+	breaches *BreachClient
+}
+
+// NewChecker creates a checker for policy. breaches may be nil to skip breach checks.
+func NewChecker(policy Policy, breaches *BreachClient) *Checker {
+	c := &Checker{policy: policy, banned: make(map[string]bool), breaches: breaches}
+	for _, list := range [][]string{commonPasswords, policy.Banned} {
+		for _, password := range list {
+			c.banned[strings.ToLower(password)] = true
+		}
+	}
+	return c
+}
+
+// Check returns a *PolicyError listing the rules password breaks. Passwords containing
+// one of personal, such as the username, are refused too. The breach check is not part
+// of it; see Breached.
+func (c *Checker) Check(password string, personal ...string) error {
+	var problems []string
+	if n := len([]rune(password)); n < c.policy.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", c.policy.MinLength))
+	}
+	if len(password) > maxBytes {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", maxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	for _, rule := range []struct {
+		required, met bool
+		problem       string
+	}{
+		{c.policy.RequireUpper, upper, "must contain an uppercase letter"},
+		{c.policy.RequireLower, lower, "must contain a lowercase letter"},
+		{c.policy.RequireDigit, digit, "must contain a digit"},
+		{c.policy.RequireSymbol, symbol, "must contain a symbol"},
+	} {
+		if rule.required && !rule.met {
+			problems = append(problems, rule.problem)
+		}
+	}
+
+	lowered := strings.ToLower(password)
+	if c.banned[lowered] {
+		problems = append(problems, "is too common")
+	}
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if len(value) >= 3 && strings.Contains(lowered, value) {
+			problems = append(problems, "must not contain your username or email")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// Breached reports whether password was seen in a data breach. It is always false
+// when breach checks are off.
+func (c *Checker) Breached(ctx context.Context, password string) (bool, error) {
+	if c.breaches == nil {
+		return false, nil
+	}
+	return c.breaches.Breached(ctx, password)
+}
+
+// BreachClient looks passwords up in a Have I Been Pwned compatible range API. Only
+// the first five characters of a password's SHA-1 hash are sent (k-anonymity); the
+// matching suffixes come back and are compared locally.
+type BreachClient struct {
+	url    string
+	client *http.Client
+}
+
+// NewBreachClient creates a client for the range API at url, such as
+// https://api.pwnedpasswords.com/range/, whose lookups give up after timeout
+func NewBreachClient(url string, timeout time.Duration) *BreachClient {
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+	return &BreachClient{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Breached reports whether password appears in the breach list
+func (b *BreachClient) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build breach lookup: %w", err)
+	}
+	// Padding hides from onlookers how many suffixes the prefix has
+	req.Header.Set("Add-Padding", "true")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up breached passwords: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breach lookup answered %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		found, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of 0
+		if ok && found == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breach lookup: %w", err)
+	}
+	return false, nil
+}
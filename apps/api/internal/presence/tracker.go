@@ -0,0 +1,151 @@
+// Package presence shares online status between API nodes through Redis. Each online
+// user has a key that expires after the presence TTL unless a heartbeat, API call or
+// open WebSocket refreshes it. Changes are announced on a channel every node listens to.
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/redis"
+)
+
+const (
+	keyPrefix = "talkify:presence:"
+	channel   = "talkify:presence"
+)
+
+// Change is a user coming online or going offline
+type Change struct {
+	UserID string `json:"user_id"`
+	Online bool   `json:"online"`
+}
+
+// Tracker records presence in Redis
+type Tracker struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewTracker creates a tracker whose keys expire after ttl
+func NewTracker(client *redis.Client, ttl time.Duration) *Tracker {
+	return &Tracker{client: client, ttl: ttl}
+}
+
+// Touch marks users online for another TTL and announces the ones that were offline
+func (t *Tracker) Touch(userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// SET ... GET returns the previous value, so a nil reply means the user just came online
+	ttl := strconv.FormatInt(t.ttl.Milliseconds(), 10)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	cmds := make([][]string, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = []string{"SET", keyPrefix + id, now, "PX", ttl, "GET"}
+	}
+	replies, err := t.client.Pipeline(cmds)
+	if err != nil {
+		return err
+	}
+
+	var changes []Change
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redis.Error); ok {
+			return replyErr
+		}
+		if reply == nil {
+			changes = append(changes, Change{UserID: userIDs[i], Online: true})
+		}
+	}
+	return t.Publish(changes...)
+}
+
+// OnlineUserIDs returns every user with a live presence key
+func (t *Tracker) OnlineUserIDs() ([]string, error) {
+	ids := []string{}
+	cursor := "0"
+	for {
+		reply, err := t.client.Do("SCAN", cursor, "MATCH", keyPrefix+"*", "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+		// SCAN replies with [next cursor, [keys...]]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, redis.Error("unexpected SCAN reply")
+		}
+		keys, _ := parts[1].([]interface{})
+		for _, key := range keys {
+			if key, ok := key.(string); ok {
+				ids = append(ids, strings.TrimPrefix(key, keyPrefix))
+			}
+		}
+
+		cursor, _ = parts[0].(string)
+		if cursor == "0" || cursor == "" {
+			return ids, nil
+		}
+	}
+}
+
+// Publish announces presence changes to every node
+func (t *Tracker) Publish(changes ...Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	cmds := make([][]string, len(changes))
+	for i, change := range changes {
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		cmds[i] = []string{"PUBLISH", channel, string(payload)}
+	}
+	_, err := t.client.Pipeline(cmds)
+	return err
+}
+
+// Watch calls handle with every presence change announced by any node until ctx is
+// done, resubscribing when the connection drops
+func (t *Tracker) Watch(ctx context.Context, handle func(Change)) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := t.client.Subscribe(ctx, channel, func(payload string) {
+			var change Change
+			if err := json.Unmarshal([]byte(payload), &change); err != nil {
+				logger.Warn("Ignoring malformed presence change", map[string]interface{}{
+					"payload": payload,
+				})
+				return
+			}
+			handle(change)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+
+		logger.Warn("Presence subscription lost, retrying", map[string]interface{}{
+			"error":   err.Error(),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
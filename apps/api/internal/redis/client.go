@@ -0,0 +1,296 @@
+// Package redis is a minimal Redis client covering the commands this service uses.
+// It speaks RESP2 over a single connection that is redialled after an error.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Options describe how to reach the server
+type Options struct {
+	Addr        string
+	Password    string
+	DB          int
+	DialTimeout time.Duration
+	IOTimeout   time.Duration
+}
+
+// ParseURL reads options from a redis://[:password@]host[:port][/db] URL
+func ParseURL(raw string) (Options, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Options{}, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return Options{}, fmt.Errorf("invalid redis URL scheme %q", u.Scheme)
+	}
+
+	opts := Options{
+		Addr:        u.Host,
+		DialTimeout: 5 * time.Second,
+		IOTimeout:   5 * time.Second,
+	}
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		opts.Password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return opts, nil
+}
+
+// Client runs commands on one connection. Commands are serialised, so callers that
+// send many should use Pipeline.
+type Client struct {
+	opts Options
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// New creates a client. The connection is made on first use.
+func New(opts Options) *Client {
+	return &Client{opts: opts}
+}
+
+// Do runs a command and returns its reply: a string, int64, []interface{}, nil or Error
+func (c *Client) Do(args ...string) (interface{}, error) {
+	replies, err := c.Pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(Error); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends all commands before reading any reply. Error replies are returned in
+// place; the error is only set when the connection failed.
+func (c *Client) Pipeline(cmds [][]string) ([]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		cn, err := dial(c.opts)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = cn
+	}
+
+	replies, err := c.conn.pipeline(cmds)
+	if err != nil {
+		// The connection state is unknown now; start over on the next command
+		c.conn.Close()
+		c.conn = nil
+		return nil, err
+	}
+	return replies, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Subscribe listens on a channel on its own connection and calls handle with every
+// message. It blocks until ctx is done or the connection fails.
+func (c *Client) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	cn, err := dial(c.opts)
+	if err != nil {
+		return err
+	}
+	defer cn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cn.Close()
+		case <-stop:
+		}
+	}()
+
+	if err := cn.write([][]string{{"SUBSCRIBE", channel}}); err != nil {
+		return err
+	}
+	for {
+		// Pushed messages arrive whenever they are published, so there is no read deadline
+		cn.SetReadDeadline(time.Time{})
+		reply, err := readReply(cn.rd)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		// Messages are ["message", channel, payload]; the subscribe confirmation is skipped
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		if payload, ok := parts[2].(string); ok {
+			handle(payload)
+		}
+	}
+}
+
+// conn is one authenticated connection
+type conn struct {
+	net.Conn
+	rd        *bufio.Reader
+	ioTimeout time.Duration
+}
+
+func dial(opts Options) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", opts.Addr, opts.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	cn := &conn{Conn: nc, rd: bufio.NewReader(nc), ioTimeout: opts.IOTimeout}
+
+	var setup [][]string
+	if opts.Password != "" {
+		setup = append(setup, []string{"AUTH", opts.Password})
+	}
+	if opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(opts.DB)})
+	}
+	if len(setup) > 0 {
+		replies, err := cn.pipeline(setup)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, ok := reply.(Error); ok {
+					err = replyErr
+					break
+				}
+			}
+		}
+		if err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("failed to set up redis connection: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) pipeline(cmds [][]string) ([]interface{}, error) {
+	if err := cn.write(cmds); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := cn.read()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// write sends commands as RESP arrays of bulk strings
+func (cn *conn) write(cmds [][]string) error {
+	var b strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+
+	if cn.ioTimeout > 0 {
+		cn.SetWriteDeadline(time.Now().Add(cn.ioTimeout))
+	}
+	_, err := io.WriteString(cn.Conn, b.String())
+	return err
+}
+
+func (cn *conn) read() (interface{}, error) {
+	if cn.ioTimeout > 0 {
+		cn.SetReadDeadline(time.Now().Add(cn.ioTimeout))
+	}
+	return readReply(cn.rd)
+}
+
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
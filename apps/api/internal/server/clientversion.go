@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+
+	"talkify/apps/api/internal/clientversion"
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rejectClientOutdated is the reason given to apps older than the minimum version
+const rejectClientOutdated = "client_outdated"
+
+// ClientVersionPolicy holds the oldest app version served on each platform. The
+// minimums are parsed again whenever live is reloaded.
+type ClientVersionPolicy struct {
+	mu       sync.RWMutex
+	minimums map[string]clientversion.Version
+}
+
+// NewClientVersionPolicy creates a policy using the minimum versions in live
+func NewClientVersionPolicy(live *config.Live) *ClientVersionPolicy {
+	p := &ClientVersionPolicy{}
+	p.apply(live.Runtime().MinClientVersions)
+	live.OnChange(func(runtime config.RuntimeConfig) {
+		p.apply(runtime.MinClientVersions)
+	})
+	return p
+}
+
+func (p *ClientVersionPolicy) apply(versions map[string]string) {
+	minimums := make(map[string]clientversion.Version, len(versions))
+	for platform, version := range versions {
+		// Versions were validated with the rest of the configuration
+		if parsed, err := clientversion.Parse(version); err == nil {
+			minimums[platform] = parsed
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.minimums = minimums
+}
+
+// Check returns the minimum version when an app at version on platform is too old to
+// be served, or nil when it may connect. Clients that do not report a version, or
+// report one that cannot be parsed, are let through.
+func (p *ClientVersionPolicy) Check(platform, version string) clientversion.Version {
+	p.mu.RLock()
+	minimum, ok := p.minimums[platform]
+	p.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	parsed, err := clientversion.Parse(version)
+	if err != nil || parsed.Compare(minimum) >= 0 {
+		return nil
+	}
+	return minimum
+}
+
+// RequireClientVersion answers requests from apps older than the configured minimum for
+// their platform with 426 Upgrade Required, telling them which version to update to.
+// Paths in skipPaths, such as the status endpoint, stay reachable.
+func RequireClientVersion(p *ClientVersionPolicy, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		platform := clientversion.Platform(c.GetHeader(clientversion.PlatformHeader))
+		version := c.GetHeader(clientversion.VersionHeader)
+		if platform == "" || version == "" || skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		if minimum := p.Check(platform, version); minimum != nil {
+			logger.Debug("Rejected outdated client", map[string]interface{}{
+				"platform":    platform,
+				"version":     version,
+				"min_version": minimum.String(),
+				"path":        c.Request.URL.Path,
+			})
+			c.AbortWithStatusJSON(http.StatusUpgradeRequired, gin.H{
+				"error":       "This version of the app is no longer supported, please update it",
+				"reason":      rejectClientOutdated,
+				"platform":    platform,
+				"version":     version,
+				"min_version": minimum.String(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+
+	"talkify/apps/api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS allows browser requests from the configured origins. The origin list is read
+// from live on every request so a reload takes effect immediately.
+func CORS(live *config.Live) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin != "" && originAllowed(live.Runtime().CORSOrigins, origin) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-User-ID, X-Request-ID, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After, X-Total-Count, X-Sync-Token, X-Unread-Count, X-Last-Message-At, X-Opened-At")
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"time"
+
+	"talkify/apps/api/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the latency of every request by route. Long-lived endpoints such as
+// the WebSocket must be listed in skipPaths so they do not show up as the slowest.
+func Metrics(recorder *metrics.Recorder, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if skip[route] {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		// Unmatched paths share one label so scanners cannot inflate cardinality
+		if route == "" {
+			route = "unmatched"
+		}
+		recorder.RecordRequest(c.Request.Method, route, time.Since(start))
+	}
+}
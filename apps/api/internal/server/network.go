@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a request is rejected by the network policy
+const (
+	rejectAddress = "address_not_allowed"
+	rejectCountry = "country_blocked"
+)
+
+// NetworkPolicy restricts access to allowed networks and away from blocked countries.
+// The rules are parsed again whenever live is reloaded.
+type NetworkPolicy struct {
+	mu       sync.RWMutex
+	networks []*net.IPNet
+	blocked  map[string]bool
+}
+
+// NewNetworkPolicy creates a policy using the rules in live. Countries are those the
+// trusted proxies tell of; see ResolveClient.
+func NewNetworkPolicy(live *config.Live) *NetworkPolicy {
+	p := &NetworkPolicy{}
+	p.apply(live.Runtime().Network)
+	live.OnChange(func(runtime config.RuntimeConfig) {
+		p.apply(runtime.Network)
+	})
+	return p
+}
+
+func (p *NetworkPolicy) apply(cfg config.NetworkConfig) {
+	networks := parseNetworks(cfg.AllowedCIDRs)
+	blocked := make(map[string]bool, len(cfg.BlockedCountries))
+	for _, country := range cfg.BlockedCountries {
+		blocked[country] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.networks = networks
+	p.blocked = blocked
+}
+
+// parseNetworks parses IPs and CIDRs, taking IPs as networks of their own. Entries
+// were validated with the rest of the configuration; invalid ones are skipped.
+func parseNetworks(entries []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// Check returns why a client at ip in country may not connect, or "" when it may
+func (p *NetworkPolicy) Check(ip net.IP, country string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.networks) > 0 {
+		allowed := false
+		for _, network := range p.networks {
+			if ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return rejectAddress
+		}
+	}
+	if p.blocked[country] {
+		return rejectCountry
+	}
+	return ""
+}
+
+// RestrictNetwork rejects requests, WebSocket upgrades included, from outside the
+// allowed networks or from blocked countries with 403 and audits every rejection
+func RestrictNetwork(p *NetworkPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		country := ClientCountry(c)
+
+		if reason := p.Check(net.ParseIP(clientIP), country); reason != "" {
+			logger.Warn("Rejected request from restricted network", map[string]interface{}{
+				"audit":   true,
+				"action":  "network.reject",
+				"reason":  reason,
+				"ip":      clientIP,
+				"country": country,
+				"method":  c.Request.Method,
+				"path":    c.Request.URL.Path,
+			})
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access from your network is not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"talkify/apps/api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientCountryKey holds the country ResolveClient found for a request
+const clientCountryKey = "clientCountry"
+
+// TrustedProxies are the peers whose forwarding headers are believed: the client
+// address in X-Forwarded-For or X-Real-IP, and the client's country
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// NewTrustedProxies creates the set of proxies in entries, IPs or CIDRs. Without
+// entries no peer is trusted and every request is taken to come from its peer.
+func NewTrustedProxies(entries []string) *TrustedProxies {
+	return &TrustedProxies{networks: parseNetworks(entries)}
+}
+
+// Trusts reports whether the peer at ip is a trusted proxy
+func (p *TrustedProxies) Trusts(ip net.IP) bool {
+	for _, network := range p.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseTrustedProxies makes r take client addresses from the headers in cfg, only when
+// the request comes through one of its trusted proxies
+func UseTrustedProxies(r *gin.Engine, cfg *config.ServerConfig) error {
+	r.RemoteIPHeaders = cfg.RemoteIPHeaders
+	// Unlike gin's default of trusting every peer, no proxies trust none
+	return r.SetTrustedProxies(cfg.TrustedProxies)
+}
+
+// ResolveClient reads the client's country from countryHeader when the request comes
+// through one of the trusted proxies, for ClientCountry. Headers from any other peer
+// could be set by the client itself and are ignored.
+func ResolveClient(proxies *TrustedProxies, countryHeader string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if countryHeader != "" && proxies.Trusts(net.ParseIP(c.RemoteIP())) {
+			country := strings.ToUpper(strings.TrimSpace(c.GetHeader(countryHeader)))
+			c.Set(clientCountryKey, country)
+		}
+		c.Next()
+	}
+}
+
+// ClientCountry returns the country trusted proxies told a request comes from, or ""
+// when they didn't
+func ClientCountry(c *gin.Context) string {
+	return c.GetString(clientCountryKey)
+}
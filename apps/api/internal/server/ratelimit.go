@@ -0,0 +1,94 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bucketIdleTTL is how long an unused client bucket is kept
+const bucketIdleTTL = 10 * time.Minute
+
+// RateLimiter is an in-memory token bucket per client. Limits are read from live on
+// every request, so reloads apply to existing clients straight away.
+type RateLimiter struct {
+	live      *config.Live
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a rate limiter using the limits in live
+func NewRateLimiter(live *config.Live) *RateLimiter {
+	return &RateLimiter{
+		live:      live,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token for key. When none is left it returns false and how long to wait.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	limit := rl.live.Runtime().RateLimit
+	if limit.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+	rate := float64(limit.RequestsPerMinute) / 60 // tokens per second
+	capacity := float64(limit.Burst)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > time.Minute {
+		rl.sweep(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (rl *RateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > bucketIdleTTL {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// RateLimit rejects clients that exceed the limit with 429 and a Retry-After header
+func RateLimit(rl *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, wait := rl.Allow(c.ClientIP())
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"syscall"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicsTotal counts recovered panics per route, exposed through expvar
+var panicsTotal = expvar.NewMap("http_panics_total")
+
+// PanicReporter forwards recovered panics to an external error tracker
+type PanicReporter interface {
+	ReportPanic(c *gin.Context, value interface{}, stack []byte)
+}
+
+// Recovery replaces gin.Recovery. It logs the panic with its stack trace and request ID,
+// counts it, hands it to the reporters and answers with the standard error envelope.
+func Recovery(reporters ...PanicReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+
+			// A client that went away is not a server bug; there is nobody to answer either
+			if isBrokenPipe(value) {
+				logger.Warn("Client connection closed", map[string]interface{}{
+					"path":       c.Request.URL.Path,
+					"request_id": c.GetString(logger.RequestIDKey),
+					"error":      fmt.Sprint(value),
+				})
+				c.Abort()
+				return
+			}
+
+			stack := debug.Stack()
+			route := c.FullPath()
+			if route == "" {
+				route = "unmatched"
+			}
+			panicsTotal.Add(route, 1)
+
+			fields := map[string]interface{}{
+				"method":     c.Request.Method,
+				"path":       c.Request.URL.Path,
+				"route":      route,
+				"request_id": c.GetString(logger.RequestIDKey),
+				"stack":      string(stack),
+			}
+			if userID, ok := c.Get("userID"); ok {
+				fields["user_id"] = userID
+			}
+			// Logged directly rather than through logger.Error so the error hook does not
+			// report the panic a second time next to the reporters below
+			logger.Logger.Error().Err(fmt.Errorf("panic: %v", value)).Fields(fields).Msg("Recovered from panic")
+
+			for _, reporter := range reporters {
+				reporter.ReportPanic(c, value, stack)
+			}
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}()
+
+		c.Next()
+	}
+}
+
+func isBrokenPipe(value interface{}) bool {
+	err, ok := value.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(err, http.ErrAbortHandler) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		var sysErr *os.SyscallError
+		if errors.As(opErr.Err, &sysErr) {
+			msg := strings.ToLower(sysErr.Error())
+			return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/logger"
+	"talkify/apps/api/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouterOptions are what NewRouter needs besides the configuration
+type RouterOptions struct {
+	// Live holds the runtime settings the CORS, network, client version and rate limit
+	// policies follow across reloads
+	Live *config.Live
+	// Metrics records the latency of each route
+	Metrics *metrics.Recorder
+	// Streaming are the routes exempt from the request timeout and latency metrics
+	Streaming []string
+	// Reporters are told of recovered panics
+	Reporters []PanicReporter
+}
+
+// NewRouter creates a router with the middleware every deployment of the public API
+// runs, whether the API server or a program embedding it, so that none of them skips
+// the workspace's network restrictions or rate limits
+func NewRouter(cfg *config.Config, opts RouterOptions) (*gin.Engine, error) {
+	r := gin.New()
+	if err := UseTrustedProxies(r, &cfg.Server); err != nil {
+		return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+	}
+
+	// Allow the configured browser origins; the list can be changed by a reload
+	r.Use(CORS(opts.Live))
+
+	// Tell browsers to stick to HTTPS once TLS is terminated here
+	if cfg.Server.TLSEnabled() {
+		r.Use(func(c *gin.Context) {
+			c.Writer.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+			c.Next()
+		})
+	}
+
+	r.Use(logger.RequestID())
+	r.Use(logger.RequestLogger())
+	r.Use(Recovery(opts.Reporters...))
+
+	// Believe the country the trusted proxies tell of, and keep out networks and
+	// countries the admins have restricted; reloads change the rules
+	r.Use(ResolveClient(NewTrustedProxies(cfg.Server.TrustedProxies), cfg.Server.CountryHeader))
+	r.Use(RestrictNetwork(NewNetworkPolicy(opts.Live)))
+
+	// Tell apps older than the minimum version for their platform to update; the status
+	// endpoint stays reachable so they can still show banners
+	r.Use(RequireClientVersion(NewClientVersionPolicy(opts.Live), "/api/status"))
+
+	// Record endpoint latency for /metrics, leaving out responses that stream
+	r.Use(Metrics(opts.Metrics, opts.Streaming...))
+
+	// Limit how fast each client can call the API
+	r.Use(RateLimit(NewRateLimiter(opts.Live)))
+
+	// Give every request a deadline, except responses that stream
+	r.Use(Timeout(cfg.Server.RequestTimeout, opts.Streaming...))
+	return r, nil
+}
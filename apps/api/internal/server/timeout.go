@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout gives every request a deadline. The request context is cancelled when it
+// passes and the client gets a 504, even if the handler has not returned yet; anything
+// the handler writes afterwards is discarded. Responses are buffered until the handler
+// finishes, so streaming endpoints such as the WebSocket must be listed in skipPaths.
+func Timeout(timeout time.Duration, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if timeout <= 0 || skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		tw := &timeoutWriter{
+			ResponseWriter: c.Writer,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+		}
+		c.Writer = tw
+
+		timer := time.AfterFunc(timeout, func() {
+			if tw.timeout() {
+				logger.Warn("Request timed out", map[string]interface{}{
+					"method":  c.Request.Method,
+					"path":    c.Request.URL.Path,
+					"timeout": timeout.String(),
+				})
+			}
+		})
+		defer timer.Stop()
+
+		// On panic drop the buffered response and hand the real writer back so the
+		// recovery middleware can answer
+		defer func() {
+			if p := recover(); p != nil {
+				tw.discard()
+				c.Writer = tw.ResponseWriter
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		tw.flush()
+		c.Writer = tw.ResponseWriter
+	}
+}
+
+// timeoutWriter buffers a response so it can be dropped in favour of a 504.
+// The underlying writer is only touched under mu, by whichever of the handler
+// or the deadline timer gets there first.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	size     int
+	wrote    bool
+	timedOut bool
+	flushed  bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wrote = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wrote = true
+	w.size += len(data)
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote {
+		return -1
+	}
+	return w.size
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wrote
+}
+
+// Flush is a no-op; the response is only sent once the handler is done
+func (w *timeoutWriter) Flush() {}
+
+// timeout sends the 504 unless the response was already sent. It reports whether it did.
+func (w *timeoutWriter) timeout() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.flushed {
+		return false
+	}
+	w.timedOut = true
+	w.status = http.StatusGatewayTimeout
+
+	dst := w.ResponseWriter
+	dst.Header().Set("Content-Type", "application/json; charset=utf-8")
+	dst.WriteHeader(http.StatusGatewayTimeout)
+	dst.Write([]byte(`{"error":"Request timed out"}`))
+	return true
+}
+
+// discard drops the buffered response and stops the deadline from answering
+func (w *timeoutWriter) discard() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushed = true
+}
+
+// flush copies the buffered response to the client unless the deadline already answered it
+func (w *timeoutWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.flushed {
+		return
+	}
+	w.flushed = true
+
+	dst := w.ResponseWriter
+	for key, values := range w.header {
+		dst.Header()[key] = values
+	}
+	dst.WriteHeader(w.status)
+	dst.Write(w.buf.Bytes())
+}
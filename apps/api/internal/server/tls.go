@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+
+	"talkify/apps/api/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS holds what is needed to terminate TLS in the server
+type TLS struct {
+	Config   *tls.Config
+	CertFile string
+	KeyFile  string
+	manager  *autocert.Manager
+}
+
+// NewTLS builds the TLS setup from config. Certificates either come from files or
+// are obtained from Let's Encrypt when autocert is enabled.
+func NewTLS(cfg config.ServerConfig) (*TLS, error) {
+	t := &TLS{}
+
+	if cfg.AutocertEnabled {
+		if len(cfg.AutocertHosts) == 0 {
+			return nil, errors.New("TLS_AUTOCERT_HOSTS must be set when autocert is enabled")
+		}
+		t.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		t.Config = t.manager.TLSConfig()
+	} else {
+		t.CertFile = cfg.TLSCertFile
+		t.KeyFile = cfg.TLSKeyFile
+		t.Config = &tls.Config{}
+	}
+
+	t.Config.MinVersion = tls.VersionTLS12
+	t.Config.NextProtos = nextProtos(t.Config.NextProtos, cfg.HTTP2Enabled)
+
+	return t, nil
+}
+
+// Configure applies the TLS settings to srv. HTTP/2 is negotiated over ALPN by
+// net/http unless it has been disabled.
+func (t *TLS) Configure(srv *http.Server, http2Enabled bool) {
+	srv.TLSConfig = t.Config
+	if !http2Enabled {
+		// A non-nil empty map turns off the automatic HTTP/2 upgrade
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+}
+
+// RedirectHandler redirects plain HTTP requests to HTTPS on httpsPort. With autocert
+// it also answers ACME http-01 challenges.
+func (t *TLS) RedirectHandler(httpsPort string) http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+
+	if t.manager != nil {
+		return t.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// nextProtos returns the ALPN protocols to advertise, keeping any the autocert
+// manager needs for tls-alpn-01 challenges
+func nextProtos(existing []string, http2Enabled bool) []string {
+	protos := []string{}
+	if http2Enabled {
+		protos = append(protos, "h2")
+	}
+	protos = append(protos, "http/1.1")
+	for _, p := range existing {
+		if p != "h2" && p != "http/1.1" {
+			protos = append(protos, p)
+		}
+	}
+	return protos
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// apiV2Prefix is where version 2 of the API is served
+const apiV2Prefix = "/api/v2"
+
+type apiVersionKey struct{}
+
+// APIVersions serves version 2 of the API under /api/v2 with the routes of version 1,
+// which is served under /api. The prefix is rewritten before routing, so both versions
+// share routes, authorization rules and middleware; handlers tell them apart with
+// APIVersion.
+func APIVersions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, apiV2Prefix)
+		if !ok || (rest != "" && rest[0] != '/') {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		versioned := r.Clone(context.WithValue(r.Context(), apiVersionKey{}, 2))
+		versioned.URL.Path = "/api" + rest
+		if r.URL.RawPath != "" {
+			versioned.URL.RawPath = "/api" + strings.TrimPrefix(r.URL.RawPath, apiV2Prefix)
+		}
+		next.ServeHTTP(w, versioned)
+	})
+}
+
+// APIVersion returns the version of the API a request was made to
+func APIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return 1
+}
@@ -0,0 +1,76 @@
+// Package sms sends text messages through an HTTP gateway. Without a gateway
+// configured, text messages are written to the log instead, like emails without an
+// SMTP server.
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"talkify/apps/api/internal/logger"
+)
+
+// sendTimeout bounds a request to the gateway
+const sendTimeout = 10 * time.Second
+
+// Sender sends text messages through a gateway that takes a JSON POST of
+// {"to", "body"}
+type Sender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// New creates a sender for a gateway URL, authenticating with token as a bearer token
+// when it is set. An empty URL logs text messages instead of sending them.
+func New(gatewayURL, token string) (*Sender, error) {
+	s := &Sender{token: token, client: &http.Client{Timeout: sendTimeout}}
+	if gatewayURL == "" {
+		return s, nil
+	}
+
+	u, err := url.Parse(gatewayURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid SMS gateway URL")
+	}
+	s.url = u.String()
+	return s, nil
+}
+
+// Send texts body to a single phone number
+func (s *Sender) Send(to, body string) error {
+	if s.url == "" {
+		// Phone numbers are personal data, so only the length is logged
+		logger.Info("Text message not sent, no SMS gateway configured", map[string]interface{}{
+			"length": len(body),
+		})
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{"to": to, "body": body})
+	if err != nil {
+		return fmt.Errorf("failed to encode text message: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create gateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send text message: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("SMS gateway answered %d", resp.StatusCode)
+	}
+	return nil
+}
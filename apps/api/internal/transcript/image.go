@@ -0,0 +1,80 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // decoded for thumbnails
+	"image/jpeg"
+	_ "image/png" // decoded for thumbnails
+)
+
+// ErrImageTooLarge is returned for images too large to decode safely
+var ErrImageTooLarge = errors.New("image too large")
+
+// maxImagePixels bounds the images decoded for a transcript, so a hostile file can't
+// exhaust memory
+const maxImagePixels = 40_000_000
+
+// Image is a JPEG to place in a document
+type Image struct {
+	JPEG   []byte
+	Width  int
+	Height int
+}
+
+// NewImage decodes a JPEG, PNG or GIF and re-encodes it as a JPEG at most maxSide
+// pixels wide and high, which every renderer can embed
+func NewImage(data []byte, maxSide int) (*Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	scaled := scaleDown(decoded, maxSide)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	bounds := scaled.Bounds()
+	return &Image{JPEG: buf.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// scaleDown returns src as RGB, shrunk by sampling to fit within maxSide, over white
+// where it was transparent
+func scaleDown(src image.Image, maxSide int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			width, height = maxSide, max(1, height*maxSide/width)
+		} else {
+			width, height = max(1, width*maxSide/height), maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/width
+			// Colors are premultiplied, so white shows through by what alpha leaves
+			r, g, b, a := src.At(sx, sy).RGBA()
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + 0xffff - a) >> 8),
+				G: uint8((g + 0xffff - a) >> 8),
+				B: uint8((b + 0xffff - a) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
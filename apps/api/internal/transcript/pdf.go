@@ -0,0 +1,480 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Page geometry in points, for A4 paper
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	margin     = 50.0
+	// textLeft leaves room for the sender avatars left of the messages
+	textLeft       = margin + 34
+	textWidth      = pageWidth - margin - textLeft
+	thumbnailWidth = 220.0
+	thumbnailHigh  = 165.0
+)
+
+// The standard fonts transcripts are set in, as named in page resources
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontItalic  = "F3"
+)
+
+// avatarColors are the fills of sender avatars, picked by name so each sender keeps
+// theirs throughout a transcript
+var avatarColors = [][3]float64{
+	{0.26, 0.52, 0.96}, {0.86, 0.27, 0.22}, {0.96, 0.62, 0.04}, {0.06, 0.62, 0.35},
+	{0.61, 0.35, 0.71}, {0.0, 0.59, 0.65}, {0.91, 0.33, 0.55}, {0.45, 0.48, 0.52},
+}
+
+// PDFRenderer renders documents as paginated A4 PDFs. Text is set in the standard
+// Helvetica fonts, which readers provide, so no fonts are embedded; they cover Western
+// European scripts only, and other characters are written as "?" or, for reactions, as
+// their code points. Images are embedded as JPEGs.
+type PDFRenderer struct{}
+
+// NewPDFRenderer creates a PDF renderer
+func NewPDFRenderer() *PDFRenderer {
+	return &PDFRenderer{}
+}
+
+// ContentType is application/pdf
+func (r *PDFRenderer) ContentType() string {
+	return "application/pdf"
+}
+
+// Extension is .pdf
+func (r *PDFRenderer) Extension() string {
+	return ".pdf"
+}
+
+// Render lays out doc into pages and writes them to w
+func (r *PDFRenderer) Render(w io.Writer, doc *Document) error {
+	layout := &pdfLayout{doc: doc, location: doc.Location, placed: make(map[*Image]int)}
+	if layout.location == nil {
+		layout.location = time.UTC
+	}
+	layout.newPage()
+	layout.header()
+	if len(doc.Entries) == 0 {
+		layout.paragraph(fontItalic, 10, 13, 0.45, textLeft, "No messages in this transcript.")
+	}
+	for i := range doc.Entries {
+		layout.entry(&doc.Entries[i])
+	}
+	layout.footers()
+	return layout.write(w)
+}
+
+// pdfPage is the content of one page and the images it shows
+type pdfPage struct {
+	content bytes.Buffer
+	images  []int
+}
+
+// pdfLayout places a document on pages from the top down
+type pdfLayout struct {
+	doc      *Document
+	location *time.Location
+	pages    []*pdfPage
+	page     *pdfPage
+	// y is where the next line goes, measured up from the bottom of the page
+	y      float64
+	images []*Image
+	// placed tells where images shown before are in images, so each is embedded once
+	placed map[*Image]int
+}
+
+func (l *pdfLayout) newPage() {
+	l.page = &pdfPage{}
+	l.pages = append(l.pages, l.page)
+	l.y = pageHeight - margin
+}
+
+// reserve starts a new page unless height fits above the bottom margin
+func (l *pdfLayout) reserve(height float64) {
+	if l.y-height < margin {
+		l.newPage()
+	}
+}
+
+func (l *pdfLayout) header() {
+	doc := l.doc
+	left := margin
+	if doc.Avatar != nil {
+		width, height := fit(doc.Avatar, 40, 40)
+		l.image(doc.Avatar, margin, l.y-height, width, height)
+		left += 52
+	}
+	l.text(fontBold, 16, left, l.y-16, 0, truncate(fontBold, 16, pageWidth-margin-left, doc.Title))
+	l.text(fontRegular, 9, left, l.y-30, 0.4, truncate(fontRegular, 9, pageWidth-margin-left, doc.Subtitle))
+	generated := "Generated " + doc.GeneratedAt.In(l.location).Format("2 Jan 2006 15:04 MST")
+	l.text(fontRegular, 9, left, l.y-42, 0.4, generated)
+	l.y -= 54
+	fmt.Fprintf(&l.page.content, "0.8 G 0.5 w %.2f %.2f m %.2f %.2f l S\n", margin, l.y, pageWidth-margin, l.y)
+	l.y -= 16
+}
+
+func (l *pdfLayout) entry(e *Entry) {
+	if e.System {
+		l.paragraph(fontItalic, 9, 12, 0.45, textLeft, e.Text)
+		l.y -= 8
+		return
+	}
+
+	// The sender stays on the page of the message's first line
+	l.reserve(29)
+	l.avatar(e.Sender, margin+12, l.y-10)
+	l.text(fontBold, 10, textLeft, l.y-10, 0, e.Sender)
+	stamp := e.SentAt.In(l.location).Format("2 Jan 2006 15:04")
+	if e.Edited {
+		stamp += " (edited)"
+	}
+	l.text(fontRegular, 8, textLeft+measure(fontBold, 10, e.Sender)+8, l.y-10, 0.45, stamp)
+	l.y -= 16
+
+	if e.Text != "" {
+		l.paragraph(fontRegular, 10, 13, 0.1, textLeft, e.Text)
+	}
+	if e.Attachment != "" {
+		l.paragraph(fontItalic, 9, 12, 0.45, textLeft, "Attachment: "+e.Attachment)
+	}
+	if e.Thumbnail != nil {
+		width, height := fit(e.Thumbnail, thumbnailWidth, thumbnailHigh)
+		l.reserve(height + 8)
+		l.image(e.Thumbnail, textLeft, l.y-height-4, width, height)
+		l.y -= height + 8
+	}
+	if len(e.Reactions) > 0 {
+		labels := make([]string, len(e.Reactions))
+		for i, reaction := range e.Reactions {
+			labels[i] = fmt.Sprintf("%s %d", reactionLabel(reaction.Emoji), reaction.Count)
+		}
+		l.paragraph(fontRegular, 8, 11, 0.35, textLeft, strings.Join(labels, " · "))
+	}
+	l.y -= 10
+}
+
+// paragraph wraps text to the width right of left, breaking pages between lines
+func (l *pdfLayout) paragraph(font string, size, leading, gray, left float64, text string) {
+	for _, line := range wrap(font, size, pageWidth-margin-left, text) {
+		l.reserve(leading)
+		l.text(font, size, left, l.y-size, gray, line)
+		l.y -= leading
+	}
+}
+
+// footers names the transcript and numbers the pages at the bottom of each
+func (l *pdfLayout) footers() {
+	for i, page := range l.pages {
+		l.page = page
+		number := fmt.Sprintf("Page %d of %d", i+1, len(l.pages))
+		numberWidth := measure(fontRegular, 8, number)
+		title := truncate(fontRegular, 8, pageWidth-2*margin-numberWidth-20, l.doc.Title)
+		l.text(fontRegular, 8, margin, margin-22, 0.5, title)
+		l.text(fontRegular, 8, pageWidth-margin-numberWidth, margin-22, 0.5, number)
+	}
+}
+
+func (l *pdfLayout) text(font string, size, x, y, gray float64, s string) {
+	fmt.Fprintf(&l.page.content, "BT /%s %.1f Tf %.2f g %.2f %.2f Td (%s) Tj ET\n", font, size, gray, x, y, escape(encode(s)))
+}
+
+// image places img with its bottom left corner at x, y
+func (l *pdfLayout) image(img *Image, x, y, width, height float64) {
+	index, ok := l.placed[img]
+	if !ok {
+		l.images = append(l.images, img)
+		index = len(l.images) - 1
+		l.placed[img] = index
+	}
+	l.page.images = append(l.page.images, index)
+	fmt.Fprintf(&l.page.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", width, height, x, y, index)
+}
+
+// avatar draws the initial of name in a colored circle centered on x, y
+func (l *pdfLayout) avatar(name string, x, y float64) {
+	const radius = 12.0
+	// Control points at this distance make four Bézier curves a circle
+	const k = 0.5523 * radius
+	var sum int
+	for _, r := range name {
+		sum += int(r)
+	}
+	color := avatarColors[sum%len(avatarColors)]
+
+	content := &l.page.content
+	fmt.Fprintf(content, "%.2f %.2f %.2f rg %.2f %.2f m\n", color[0], color[1], color[2], x+radius, y)
+	fmt.Fprintf(content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", x+radius, y+k, x+k, y+radius, x, y+radius)
+	fmt.Fprintf(content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", x-k, y+radius, x-radius, y+k, x-radius, y)
+	fmt.Fprintf(content, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", x-radius, y-k, x-k, y-radius, x, y-radius)
+	fmt.Fprintf(content, "%.2f %.2f %.2f %.2f %.2f %.2f c f\n", x+k, y-radius, x+radius, y-k, x+radius, y)
+
+	initial := "?"
+	if r, _ := utf8.DecodeRuneInString(name); r != utf8.RuneError {
+		initial = strings.ToUpper(string(r))
+	}
+	width := measure(fontBold, 11, initial)
+	fmt.Fprintf(content, "BT /%s 11 Tf 1 g %.2f %.2f Td (%s) Tj ET\n", fontBold, x-width/2, y-4, escape(encode(initial)))
+}
+
+// write serializes the laid out pages as a PDF file
+func (l *pdfLayout) write(w io.Writer) error {
+	// Fixed objects come first, then the images, then each page and its content
+	const (
+		catalogID = 1
+		pagesID   = 2
+		infoID    = 3
+		fontsID   = 4
+		imagesID  = fontsID + 3
+	)
+	firstPageID := imagesID + len(l.images)
+	objects := firstPageID + 2*len(l.pages)
+
+	out := &pdfWriter{w: bufio.NewWriter(w), offsets: make([]int64, objects)}
+	out.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	out.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageID+2*i)
+	}
+	out.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	out.object(infoID, fmt.Sprintf("<< /Title (%s) /Producer (Talkify) /CreationDate (D:%s) >>",
+		escape(encode(l.doc.Title)), l.doc.GeneratedAt.UTC().Format("20060102150405Z")))
+	for i, name := range []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique"} {
+		out.object(fontsID+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	for i, img := range l.images {
+		out.stream(imagesID+i, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode",
+			img.Width, img.Height), img.JPEG)
+	}
+
+	fonts := fmt.Sprintf("/%s %d 0 R /%s %d 0 R /%s %d 0 R", fontRegular, fontsID, fontBold, fontsID+1, fontItalic, fontsID+2)
+	for i, page := range l.pages {
+		var xobjects strings.Builder
+		named := make(map[int]bool)
+		for _, index := range page.images {
+			if !named[index] {
+				named[index] = true
+				fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", index, imagesID+index)
+			}
+		}
+		out.object(firstPageID+2*i, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> /XObject << %s>> >> /Contents %d 0 R >>",
+			pagesID, pageWidth, pageHeight, fonts, xobjects.String(), firstPageID+2*i+1))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(page.content.Bytes())
+		zw.Close()
+		out.stream(firstPageID+2*i+1, "/Filter /FlateDecode", compressed.Bytes())
+	}
+
+	xref := out.offset
+	out.printf("xref\n0 %d\n0000000000 65535 f \n", objects)
+	for _, offset := range out.offsets[1:] {
+		out.printf("%010d 00000 n \n", offset)
+	}
+	out.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", objects, catalogID, infoID, xref)
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// pdfWriter writes PDF objects, noting where each starts for the cross-reference table.
+// The first error is kept and later writes are skipped.
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets []int64
+	err     error
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id] = p.offset
+	p.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (p *pdfWriter) stream(id int, dict string, data []byte) {
+	p.offsets[id] = p.offset
+	p.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dict, len(data))
+	if p.err == nil {
+		n, err := p.w.Write(data)
+		p.offset += int64(n)
+		p.err = err
+	}
+	p.printf("\nendstream\nendobj\n")
+}
+
+// fit scales img to fit within width and height, never enlarging it past its pixels
+func fit(img *Image, width, height float64) (float64, float64) {
+	scale := min(width/float64(img.Width), height/float64(img.Height), 1)
+	return float64(img.Width) * scale, float64(img.Height) * scale
+}
+
+// wrap breaks text into lines at most width wide, at spaces where it can, keeping the
+// line breaks it already has
+func wrap(font string, size, width float64, text string) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if measure(font, size, candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Words wider than a line are broken wherever they reach the edge
+			line = ""
+			for _, r := range word {
+				if line != "" && measure(font, size, line+string(r)) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncate shortens text to fit width, ending it with an ellipsis when cut
+func truncate(font string, size, width float64, text string) string {
+	if measure(font, size, text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && measure(font, size, string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// reactionLabel returns emoji as written when the fonts have it, and as its code points
+// otherwise, leaving out the joiners and variation selectors between them
+func reactionLabel(emoji string) string {
+	encoded := encode(emoji)
+	if !bytes.ContainsRune(encoded, '?') || strings.Contains(emoji, "?") {
+		return emoji
+	}
+	points := []string{}
+	for _, r := range emoji {
+		if r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f) {
+			continue
+		}
+		points = append(points, fmt.Sprintf("U+%04X", r))
+	}
+	return strings.Join(points, " ")
+}
+
+// measure returns how wide text is set in font at size
+func measure(font string, size float64, text string) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+	var total int
+	for _, b := range encode(text) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			// Close enough for the accented letters and punctuation of the upper half
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// encode converts text to WinAnsiEncoding, the encoding of the standard fonts, writing
+// characters it lacks as "?"
+func encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			encoded = append(encoded, ' ')
+		case r >= 32 && r <= 126, r >= 160 && r <= 255:
+			encoded = append(encoded, byte(r))
+		default:
+			if b, ok := winAnsiExtras[r]; ok {
+				encoded = append(encoded, b)
+			} else if r >= 32 {
+				encoded = append(encoded, '?')
+			}
+		}
+	}
+	return encoded
+}
+
+// escape makes encoded text safe inside a PDF string literal
+func escape(encoded []byte) string {
+	var b strings.Builder
+	for _, c := range encoded {
+		switch {
+		case c == '\\' || c == '(' || c == ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// winAnsiExtras are the characters WinAnsiEncoding places between 128 and 159
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// helveticaWidths and helveticaBoldWidths are the widths of the printable ASCII
+// characters, from space to tilde, in thousandths of the font size. The oblique face
+// shares the regular widths.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,52 @@
+// Package transcript renders conversations into documents people can keep, print or
+// hand over, such as paginated PDF transcripts.
+package transcript
+
+import (
+	"io"
+	"time"
+)
+
+// Document is a conversation, or part of one, laid out for rendering
+type Document struct {
+	Title string
+	// Subtitle describes what the transcript covers, such as its date range
+	Subtitle string
+	// Avatar is the conversation's picture, when it has one that could be fetched
+	Avatar      *Image
+	GeneratedAt time.Time
+	// Location is the timezone times are shown in
+	Location *time.Location
+	Entries  []Entry
+}
+
+// Entry is one message of a transcript
+type Entry struct {
+	Sender string
+	SentAt time.Time
+	Text   string
+	// System entries were written by the server to announce conversation events
+	System bool
+	Edited bool
+	// Attachment names media sent with the message, such as "Image" or "Voice message"
+	Attachment string
+	// Thumbnail previews the attachment, when it could be fetched
+	Thumbnail *Image
+	Reactions []Reaction
+}
+
+// Reaction is how many people reacted to an entry with an emoji
+type Reaction struct {
+	Emoji string
+	Count int
+}
+
+// Renderer writes documents in one format. Renderers are safe for concurrent use.
+type Renderer interface {
+	// Render writes doc to w
+	Render(w io.Writer, doc *Document) error
+	// ContentType is the media type of rendered documents
+	ContentType() string
+	// Extension is the file extension of rendered documents, with its dot
+	Extension() string
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// maxRenderedBytes bounds the body a template may produce
+const maxRenderedBytes = 64 << 10
+
+// ErrInvalidTemplate is returned for a payload template that doesn't parse
+var ErrInvalidTemplate = errors.New("invalid payload template")
+
+// Template shapes the body of deliveries for receivers that want something other than
+// the default payload. It is a text/template run on the payload as decoded from its
+// JSON, so fields keep their JSON names, as in {{.conversation_id}}, and {{json .x}}
+// writes a value as JSON. It has to produce JSON.
+type Template struct {
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseTemplate parses a payload template
+func ParseTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("payload").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Render runs the template on payload and checks that it produced JSON
+func (t *Template) Render(payload interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	var data interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := t.tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("failed to render payload template: %w", err)
+	}
+	if body.Len() > maxRenderedBytes {
+		return nil, fmt.Errorf("payload template produced more than %d bytes", maxRenderedBytes)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, errors.New("payload template did not produce JSON")
+	}
+	return body.Bytes(), nil
+}
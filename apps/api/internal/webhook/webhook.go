@@ -0,0 +1,119 @@
+// Package webhook delivers signed event payloads to URLs outside the server.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the webhook's secret.
+const (
+	SignatureHeader = "X-Talkify-Signature"
+	TimestampHeader = "X-Talkify-Timestamp"
+)
+
+// ErrHostNotAllowed is returned for a URL on a host webhooks may not be sent to
+var ErrHostNotAllowed = errors.New("webhook host is not allowed")
+
+// Client sends webhooks to a fixed set of hosts. Webhook URLs are chosen by users, so
+// anything else is refused rather than called from inside the network.
+type Client struct {
+	allowed map[string]bool
+	client  *http.Client
+}
+
+// NewClient creates a client for the given host names whose deliveries give up after
+// timeout
+func NewClient(allowedHosts []string, timeout time.Duration) *Client {
+	c := &Client{allowed: make(map[string]bool)}
+	for _, host := range allowedHosts {
+		c.allowed[strings.ToLower(host)] = true
+	}
+	c.client = &http.Client{
+		Timeout: timeout,
+		// A redirect could lead anywhere; receivers have to give their final URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return c
+}
+
+// Enabled reports whether webhooks can be sent anywhere
+func (c *Client) Enabled() bool {
+	return len(c.allowed) > 0
+}
+
+// Check returns ErrHostNotAllowed unless rawURL is an HTTPS URL on an allowed host
+func (c *Client) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return ErrHostNotAllowed
+	}
+	if !c.allowed[strings.ToLower(u.Hostname())] {
+		return ErrHostNotAllowed
+	}
+	return nil
+}
+
+// Deliver posts payload as JSON to rawURL, signed with secret. Anything but a 2xx
+// answer is an error.
+func (c *Client) Deliver(ctx context.Context, rawURL, secret string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return c.DeliverBody(ctx, rawURL, secret, body)
+}
+
+// DeliverBody posts a JSON body that is already encoded, such as one rendered from a
+// Template, as Deliver does
+func (c *Client) DeliverBody(ctx context.Context, rawURL, secret string, body []byte) error {
+	if err := c.Check(rawURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Talkify-Webhook/1.0")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook receiver answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a delivery, for receivers to compare with the
+// signature header
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
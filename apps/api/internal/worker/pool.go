@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"runtime"
 	"sync"
 	"talkify/apps/api/internal/logger"
@@ -20,6 +21,10 @@ type Pool struct {
 	wg         sync.WaitGroup
 	ctx        context.Context
 	cancel     context.CancelFunc
+
+	// closed is set once Stop stops taking tasks
+	mu     sync.RWMutex
+	closed bool
 }
 
 // NewPool creates a new worker pool with the specified number of workers
@@ -50,16 +55,46 @@ func (p *Pool) Start() {
 	}
 }
 
-// Stop gracefully shuts down the worker pool
-func (p *Pool) Stop() {
-	logger.Info("Stopping worker pool")
-	p.cancel()
-	close(p.tasks)
-	p.wg.Wait()
+// Stop stops taking tasks and waits for the queued ones to be processed. When ctx
+// ends first, workers give up on the tasks still queued once their current one is done.
+func (p *Pool) Stop(ctx context.Context) error {
+	logger.Info("Stopping worker pool", map[string]interface{}{
+		"queued": len(p.tasks),
+	})
+
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return fmt.Errorf("worker pool stopped with %d task(s) queued: %w", len(p.tasks), ctx.Err())
+	}
 }
 
-// Submit adds a new task to the pool
+// Submit adds a new task to the pool. Tasks submitted after Stop are dropped.
 func (p *Pool) Submit(task Task) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		logger.Warn("Worker pool is shutting down, task rejected", map[string]interface{}{
+			"task": task.Name,
+		})
+		return
+	}
+
 	select {
 	case p.tasks <- task:
 		logger.Debug("Task submitted to pool", map[string]interface{}{
@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_conversation_member_daily_stats_day;
+DROP INDEX IF EXISTS idx_conversation_daily_stats_day;
+
+-- Drop tables
+DROP TABLE IF EXISTS conversation_member_daily_stats;
+DROP TABLE IF EXISTS conversation_daily_stats;
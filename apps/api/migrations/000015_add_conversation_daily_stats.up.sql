@@ -0,0 +1,25 @@
+-- Create pre-aggregated daily rollups for conversation analytics
+CREATE TABLE conversation_daily_stats (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    message_count INTEGER NOT NULL DEFAULT 0,
+    media_count INTEGER NOT NULL DEFAULT 0,
+    media_bytes BIGINT NOT NULL DEFAULT 0,
+    members_joined INTEGER NOT NULL DEFAULT 0,
+    member_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, day)
+);
+
+-- Create per-member daily rollups used for most active members
+CREATE TABLE conversation_member_daily_stats (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    message_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (conversation_id, user_id, day)
+);
+
+-- Create indexes
+CREATE INDEX idx_conversation_daily_stats_day ON conversation_daily_stats(day);
+CREATE INDEX idx_conversation_member_daily_stats_day ON conversation_member_daily_stats(conversation_id, day);
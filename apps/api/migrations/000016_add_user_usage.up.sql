@@ -0,0 +1,13 @@
+-- Create per-user usage counters used for quota enforcement
+CREATE TABLE user_usage (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    storage_bytes BIGINT NOT NULL DEFAULT 0,
+    message_count BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Backfill usage from existing messages
+INSERT INTO user_usage (user_id, storage_bytes, message_count)
+SELECT sender_id, COALESCE(SUM(media_size), 0), COUNT(*)
+FROM messages
+GROUP BY sender_id;
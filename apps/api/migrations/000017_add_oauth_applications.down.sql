@@ -0,0 +1,11 @@
+-- Drop triggers
+DROP TRIGGER IF EXISTS update_oauth_applications_updated_at ON oauth_applications;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_oauth_grants_user;
+DROP INDEX IF EXISTS idx_oauth_applications_owner;
+
+-- Drop tables
+DROP TABLE IF EXISTS oauth_grants;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_applications;
@@ -0,0 +1,45 @@
+-- Create third-party applications registered by users
+CREATE TABLE oauth_applications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    client_id VARCHAR(64) NOT NULL UNIQUE,
+    client_secret_hash TEXT NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create single-use authorization codes issued after user consent
+CREATE TABLE oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    application_id UUID NOT NULL REFERENCES oauth_applications(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create user consent grants per application
+CREATE TABLE oauth_grants (
+    application_id UUID NOT NULL REFERENCES oauth_applications(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (application_id, user_id)
+);
+
+-- Create indexes
+CREATE INDEX idx_oauth_applications_owner ON oauth_applications(owner_id);
+CREATE INDEX idx_oauth_grants_user ON oauth_grants(user_id);
+
+-- Create triggers for updated_at
+CREATE TRIGGER update_oauth_applications_updated_at
+    BEFORE UPDATE ON oauth_applications
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
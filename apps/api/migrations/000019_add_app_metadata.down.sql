@@ -0,0 +1,2 @@
+-- Drop app metadata table
+DROP TABLE IF EXISTS app_metadata;
@@ -0,0 +1,6 @@
+-- Key/value store for instance-wide metadata such as the encryption canary
+CREATE TABLE app_metadata (
+    key VARCHAR(100) PRIMARY KEY,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Drop the presence sweep index
+DROP INDEX IF EXISTS idx_users_online_last_seen;
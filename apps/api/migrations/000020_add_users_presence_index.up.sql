@@ -0,0 +1,2 @@
+-- Lets the presence sweep find online users that have gone quiet
+CREATE INDEX IF NOT EXISTS idx_users_online_last_seen ON users(last_seen) WHERE is_online = true;
@@ -0,0 +1,4 @@
+-- Drop participant read and delivery cursors
+ALTER TABLE conversation_participants
+    DROP COLUMN IF EXISTS last_delivered_message_id,
+    DROP COLUMN IF EXISTS last_read_message_id;
@@ -0,0 +1,4 @@
+-- Per-participant read and delivery cursors for cross-device sync
+ALTER TABLE conversation_participants
+    ADD COLUMN last_read_message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    ADD COLUMN last_delivered_message_id UUID REFERENCES messages(id) ON DELETE SET NULL;
@@ -0,0 +1,7 @@
+-- Drop conversation change tracking
+DROP TRIGGER IF EXISTS record_departure_on_membership ON conversation_participants;
+DROP FUNCTION IF EXISTS record_conversation_departure();
+DROP TABLE IF EXISTS conversation_departures;
+DROP TRIGGER IF EXISTS touch_conversation_on_membership ON conversation_participants;
+DROP TRIGGER IF EXISTS touch_conversation_on_message ON messages;
+DROP FUNCTION IF EXISTS touch_conversation();
@@ -0,0 +1,46 @@
+-- Track conversation changes so clients can fetch conversation list deltas
+
+-- Bump a conversation's updated_at whenever its messages or membership change
+CREATE OR REPLACE FUNCTION touch_conversation()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.conversation_id;
+        RETURN OLD;
+    END IF;
+    UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.conversation_id;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER touch_conversation_on_message
+    AFTER INSERT OR UPDATE ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION touch_conversation();
+
+CREATE TRIGGER touch_conversation_on_membership
+    AFTER INSERT OR DELETE OR UPDATE OF role ON conversation_participants
+    FOR EACH ROW
+    EXECUTE FUNCTION touch_conversation();
+
+-- Remember who left which conversation, so deltas can tell clients to drop it
+CREATE TABLE conversation_departures (
+    conversation_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    departed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_conversation_departures_user ON conversation_departures(user_id, departed_at);
+
+CREATE OR REPLACE FUNCTION record_conversation_departure()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO conversation_departures (conversation_id, user_id) VALUES (OLD.conversation_id, OLD.user_id);
+    RETURN OLD;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER record_departure_on_membership
+    AFTER DELETE ON conversation_participants
+    FOR EACH ROW
+    EXECUTE FUNCTION record_conversation_departure();
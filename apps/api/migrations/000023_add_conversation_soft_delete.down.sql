@@ -0,0 +1,5 @@
+-- Drop conversation soft deletion
+DROP INDEX IF EXISTS idx_conversations_deleted_at;
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,2 @@
+-- Enum values cannot be dropped; turn system messages back into text
+UPDATE messages SET message_type = 'text' WHERE message_type = 'system';
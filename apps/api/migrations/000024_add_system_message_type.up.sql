@@ -0,0 +1,2 @@
+-- System messages announce conversation events such as ownership transfers
+ALTER TYPE message_type ADD VALUE IF NOT EXISTS 'system';
@@ -0,0 +1,8 @@
+-- Drop conversation appearance settings and participant nicknames
+ALTER TABLE conversation_participants
+    DROP COLUMN IF EXISTS nickname;
+
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS theme,
+    DROP COLUMN IF EXISTS accent_color,
+    DROP COLUMN IF EXISTS avatar_url;
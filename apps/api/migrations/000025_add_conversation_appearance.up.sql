@@ -0,0 +1,8 @@
+-- Conversation avatar, accent color and theme, and participant nicknames
+ALTER TABLE conversations
+    ADD COLUMN avatar_url TEXT,
+    ADD COLUMN accent_color VARCHAR(7),
+    ADD COLUMN theme VARCHAR(32);
+
+ALTER TABLE conversation_participants
+    ADD COLUMN nickname VARCHAR(64);
@@ -0,0 +1,4 @@
+-- Drop group welcome message and rules
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS rules,
+    DROP COLUMN IF EXISTS welcome_message;
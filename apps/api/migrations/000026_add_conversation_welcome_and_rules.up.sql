@@ -0,0 +1,4 @@
+-- Group welcome message posted to new participants, and group rules
+ALTER TABLE conversations
+    ADD COLUMN welcome_message TEXT,
+    ADD COLUMN rules TEXT;
@@ -0,0 +1,3 @@
+-- Drop conversation history visibility
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS history_visibility;
@@ -0,0 +1,4 @@
+-- Whether participants see messages sent before they joined
+ALTER TABLE conversations
+    ADD COLUMN history_visibility VARCHAR(16) NOT NULL DEFAULT 'shared'
+        CHECK (history_visibility IN ('shared', 'joined'));
@@ -0,0 +1,5 @@
+-- Drop view-once media messages
+DROP TABLE IF EXISTS message_views;
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS view_once;
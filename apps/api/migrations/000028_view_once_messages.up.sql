@@ -0,0 +1,10 @@
+-- View-once media messages and the record of who opened them
+ALTER TABLE messages
+    ADD COLUMN view_once BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE message_views (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
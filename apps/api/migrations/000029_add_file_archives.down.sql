@@ -0,0 +1,2 @@
+-- Drop conversation file archives
+DROP TABLE IF EXISTS file_archives;
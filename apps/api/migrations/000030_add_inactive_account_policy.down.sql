@@ -0,0 +1,8 @@
+-- Drop the inactive account policy columns
+DROP INDEX IF EXISTS idx_users_last_active;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS legal_hold,
+    DROP COLUMN IF EXISTS inactivity_warned_at,
+    DROP COLUMN IF EXISTS deactivated_at,
+    DROP COLUMN IF EXISTS anonymized_at;
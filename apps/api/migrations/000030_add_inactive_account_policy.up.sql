@@ -0,0 +1,10 @@
+-- Inactive account policy: warnings, deactivation, anonymization and legal holds
+ALTER TABLE users
+    ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN inactivity_warned_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN anonymized_at TIMESTAMP WITH TIME ZONE;
+
+-- Lets the policy find users by when they were last active
+CREATE INDEX IF NOT EXISTS idx_users_last_active ON users((COALESCE(last_seen, created_at)))
+    WHERE anonymized_at IS NULL;
@@ -0,0 +1,3 @@
+-- Drop the conversation legal hold
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS legal_hold;
@@ -0,0 +1,3 @@
+-- Legal hold on conversations, which suspends retention deletion
+ALTER TABLE conversations
+    ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT false;
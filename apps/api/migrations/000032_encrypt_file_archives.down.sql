@@ -0,0 +1,5 @@
+-- Drop file archive data keys, along with the archives that can't be read without them
+DELETE FROM file_archives WHERE data_key IS NOT NULL;
+ALTER TABLE file_archives
+    DROP COLUMN IF EXISTS key_id,
+    DROP COLUMN IF EXISTS data_key;
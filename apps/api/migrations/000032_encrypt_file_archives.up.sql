@@ -0,0 +1,4 @@
+-- Record the wrapped data key each file archive is encrypted with at rest
+ALTER TABLE file_archives
+    ADD COLUMN data_key TEXT,
+    ADD COLUMN key_id VARCHAR(16);
@@ -0,0 +1,4 @@
+-- Drop login devices, login challenges and notifications
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS user_devices;
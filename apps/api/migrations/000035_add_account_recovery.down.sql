@@ -0,0 +1,6 @@
+-- Drop account recovery
+DROP TABLE IF EXISTS recovery_approvals;
+DROP TABLE IF EXISTS recovery_requests;
+DROP TABLE IF EXISTS trusted_contacts;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS recovery_threshold;
@@ -0,0 +1,4 @@
+-- Drop profile sharing settings
+ALTER TABLE users
+    DROP COLUMN IF EXISTS share_email,
+    DROP COLUMN IF EXISTS share_phone;
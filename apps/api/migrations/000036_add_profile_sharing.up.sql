@@ -0,0 +1,4 @@
+-- Contact details users choose to show on their public profile
+ALTER TABLE users
+    ADD COLUMN share_email BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN share_phone BOOLEAN NOT NULL DEFAULT false;
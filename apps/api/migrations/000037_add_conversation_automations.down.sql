@@ -0,0 +1,2 @@
+-- Drop conversation automations
+DROP TABLE IF EXISTS conversation_automations;
@@ -0,0 +1,17 @@
+-- Automation rules run when participants join or leave a conversation
+CREATE TABLE conversation_automations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    event VARCHAR(32) NOT NULL CHECK (event IN ('participant.joined', 'participant.left')),
+    action VARCHAR(32) NOT NULL CHECK (action IN ('post_message', 'webhook')),
+    message TEXT,
+    webhook_url TEXT,
+    webhook_secret TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_conversation_automations_conversation_id ON conversation_automations(conversation_id);
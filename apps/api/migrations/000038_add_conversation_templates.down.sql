@@ -0,0 +1,2 @@
+-- Drop conversation templates
+DROP TABLE IF EXISTS conversation_templates;
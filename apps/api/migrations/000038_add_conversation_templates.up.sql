@@ -0,0 +1,22 @@
+-- Presets administrators define for conversations that are created the same way again
+-- and again, such as support or incident channels
+CREATE TABLE conversation_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    -- {title}, {creator} and {date} are filled in when a conversation is created
+    name_pattern VARCHAR(100) NOT NULL,
+    avatar_url TEXT,
+    accent_color VARCHAR(7),
+    theme VARCHAR(32),
+    welcome_message TEXT,
+    rules TEXT,
+    history_visibility VARCHAR(16) CHECK (history_visibility IN ('shared', 'joined')),
+    -- [{"user_id": ..., "role": "admin" | "member"}]
+    participants JSONB NOT NULL DEFAULT '[]',
+    -- [{"event": ..., "action": ..., "message": ..., "webhook_url": ...}], as conversation_automations
+    automations JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Drop urgent broadcasts
+DROP TABLE IF EXISTS urgent_broadcast_recipients;
+DROP TABLE IF EXISTS urgent_broadcasts;
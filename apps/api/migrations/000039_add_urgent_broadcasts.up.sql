@@ -0,0 +1,24 @@
+-- Urgent broadcasts administrators send during incidents. Every recipient is asked to
+-- acknowledge them, so the administrators can see who has not.
+CREATE TABLE urgent_broadcasts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- The conversation whose participants receive the broadcast; everyone when NULL
+    conversation_id UUID REFERENCES conversations(id) ON DELETE SET NULL,
+    title VARCHAR(200) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE urgent_broadcast_recipients (
+    broadcast_id UUID NOT NULL REFERENCES urgent_broadcasts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Channels the broadcast reached the user through, e.g. {notification,email}
+    channels TEXT[] NOT NULL DEFAULT '{}',
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+
+CREATE INDEX idx_urgent_broadcast_recipients_pending ON urgent_broadcast_recipients(user_id)
+    WHERE acknowledged_at IS NULL;
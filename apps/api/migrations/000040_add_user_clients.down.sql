@@ -0,0 +1,2 @@
+-- Drop reported client versions
+DROP TABLE IF EXISTS user_clients;
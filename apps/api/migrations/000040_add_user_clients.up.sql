@@ -0,0 +1,12 @@
+-- App versions users' clients report in X-Client-Platform and X-Client-Version, so
+-- administrators can see who is still on a version before raising the minimum
+CREATE TABLE user_clients (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(32) NOT NULL,
+    version VARCHAR(32) NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, platform, version)
+);
+
+CREATE INDEX idx_user_clients_last_seen ON user_clients(last_seen_at);
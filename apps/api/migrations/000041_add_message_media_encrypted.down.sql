@@ -0,0 +1,3 @@
+-- Drop the media encryption flag. Run this only before any media was encrypted.
+DROP INDEX IF EXISTS idx_messages_media_unencrypted;
+ALTER TABLE messages DROP COLUMN IF EXISTS media_encrypted;
@@ -0,0 +1,6 @@
+-- Media URLs name the file and are now stored encrypted like message content. Rows
+-- written before keep them in the clear until cmd/encrypt_media is run.
+ALTER TABLE messages ADD COLUMN media_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_messages_media_unencrypted ON messages(id)
+    WHERE NOT media_encrypted AND (media_url IS NOT NULL OR media_thumbnail_url IS NOT NULL);
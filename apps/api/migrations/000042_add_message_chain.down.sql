@@ -0,0 +1,3 @@
+-- Drop message integrity chains
+DROP TABLE IF EXISTS message_chain;
+ALTER TABLE conversations DROP COLUMN IF EXISTS integrity_chain_since;
@@ -0,0 +1,17 @@
+-- Optional tamper evidence for a conversation's history. Once enabled, every message
+-- written, edited or deleted appends a link holding a digest of the stored message and
+-- a hash over the previous link, so rewriting history breaks the chain.
+ALTER TABLE conversations ADD COLUMN integrity_chain_since TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE message_chain (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    message_id UUID NOT NULL,
+    -- What happened to the message: created, edited, deleted or media_encrypted
+    event VARCHAR(32) NOT NULL,
+    digest CHAR(64) NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    linked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (conversation_id, seq)
+);
@@ -0,0 +1,8 @@
+-- Drop conversation summaries
+DROP TRIGGER IF EXISTS summarize_conversation_on_membership ON conversation_participants;
+DROP FUNCTION IF EXISTS summarize_conversation_membership();
+DROP TRIGGER IF EXISTS summarize_conversation_on_message ON messages;
+DROP FUNCTION IF EXISTS summarize_conversation_message();
+DROP TRIGGER IF EXISTS summarize_conversation_on_insert ON conversations;
+DROP FUNCTION IF EXISTS summarize_new_conversation();
+DROP TABLE IF EXISTS conversation_summaries;
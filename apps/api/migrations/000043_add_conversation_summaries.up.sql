@@ -0,0 +1,86 @@
+-- Denormalized conversation details for the conversation list, kept up to date by
+-- triggers in the same transaction as the writes they summarize
+CREATE TABLE conversation_summaries (
+    conversation_id UUID PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+    -- The latest message that is not deleted
+    last_message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    last_activity_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    participant_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO conversation_summaries (conversation_id, last_message_id, last_activity_at, participant_count)
+SELECT c.id, latest.id, COALESCE(latest.created_at, c.created_at),
+    (SELECT COUNT(*) FROM conversation_participants cp WHERE cp.conversation_id = c.id)
+FROM conversations c
+LEFT JOIN LATERAL (
+    SELECT m.id, m.created_at FROM messages m
+    WHERE m.conversation_id = c.id AND NOT m.is_deleted
+    ORDER BY m.created_at DESC, m.id DESC
+    LIMIT 1
+) latest ON true;
+
+CREATE OR REPLACE FUNCTION summarize_new_conversation()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO conversation_summaries (conversation_id, last_activity_at)
+    VALUES (NEW.id, NEW.created_at)
+    ON CONFLICT (conversation_id) DO NOTHING;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER summarize_conversation_on_insert
+    AFTER INSERT ON conversations
+    FOR EACH ROW
+    EXECUTE FUNCTION summarize_new_conversation();
+
+-- New messages become the last message; deleting the last message falls back to the
+-- latest one left
+CREATE OR REPLACE FUNCTION summarize_conversation_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_summaries
+        SET last_message_id = NEW.id, last_activity_at = NEW.created_at, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_summaries
+        SET last_message_id = (
+                SELECT m.id FROM messages m
+                WHERE m.conversation_id = NEW.conversation_id AND NOT m.is_deleted
+                ORDER BY m.created_at DESC, m.id DESC
+                LIMIT 1
+            ),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER summarize_conversation_on_message
+    AFTER INSERT OR UPDATE OF is_deleted ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION summarize_conversation_message();
+
+CREATE OR REPLACE FUNCTION summarize_conversation_membership()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE conversation_summaries
+        SET participant_count = participant_count - 1, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = OLD.conversation_id;
+        RETURN OLD;
+    END IF;
+    UPDATE conversation_summaries
+    SET participant_count = participant_count + 1, updated_at = CURRENT_TIMESTAMP
+    WHERE conversation_id = NEW.conversation_id;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER summarize_conversation_on_membership
+    AFTER INSERT OR DELETE ON conversation_participants
+    FOR EACH ROW
+    EXECUTE FUNCTION summarize_conversation_membership();
@@ -0,0 +1,7 @@
+-- Drop unread counters
+DROP TRIGGER IF EXISTS count_read_on_status ON message_status;
+DROP FUNCTION IF EXISTS count_read_message();
+DROP TRIGGER IF EXISTS count_unread_on_message ON messages;
+DROP FUNCTION IF EXISTS count_unread_message();
+DROP FUNCTION IF EXISTS conversation_unread_count(UUID, UUID);
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS unread_count;
@@ -0,0 +1,90 @@
+-- Per-participant unread counters, kept up to date by triggers so listing
+-- conversations doesn't count unread messages on every request
+ALTER TABLE conversation_participants
+    ADD COLUMN unread_count INTEGER NOT NULL DEFAULT 0;
+
+-- The messages a participant has not read: sent by someone else since they joined,
+-- not deleted, after their read cursor and not marked read. The counters are kept
+-- equal to it, and the reconciliation job recomputes them with it.
+CREATE OR REPLACE FUNCTION conversation_unread_count(conv UUID, usr UUID)
+RETURNS INTEGER AS $$
+    SELECT COUNT(*)::INTEGER
+    FROM conversation_participants cp
+    JOIN messages m ON m.conversation_id = cp.conversation_id
+    LEFT JOIN messages lr ON lr.id = cp.last_read_message_id
+    LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = cp.user_id
+    WHERE cp.conversation_id = conv AND cp.user_id = usr
+      AND m.sender_id != cp.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
+      AND (ms.status IS NULL OR ms.status = 'delivered')
+$$ LANGUAGE sql STABLE;
+
+UPDATE conversation_participants
+SET unread_count = conversation_unread_count(conversation_id, user_id);
+
+-- A new message is unread for everyone else in the conversation; deleting one takes it
+-- off the counters it was on
+CREATE OR REPLACE FUNCTION count_unread_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_participants
+        SET unread_count = unread_count + 1
+        WHERE conversation_id = NEW.conversation_id AND user_id != NEW.sender_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_participants cp
+        SET unread_count = GREATEST(cp.unread_count - 1, 0)
+        WHERE cp.conversation_id = NEW.conversation_id
+          AND cp.user_id != NEW.sender_id
+          AND NEW.created_at >= cp.joined_at
+          AND NOT EXISTS (
+              SELECT 1 FROM messages lr
+              WHERE lr.id = cp.last_read_message_id
+                AND (NEW.created_at, NEW.id) <= (lr.created_at, lr.id)
+          )
+          AND NOT EXISTS (
+              SELECT 1 FROM message_status ms
+              WHERE ms.message_id = NEW.id AND ms.user_id = cp.user_id AND ms.status != 'delivered'
+          );
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER count_unread_on_message
+    AFTER INSERT OR UPDATE OF is_deleted ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION count_unread_message();
+
+-- Marking a message read takes it off the reader's counter, unless their read cursor
+-- had already passed it
+CREATE OR REPLACE FUNCTION count_read_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status != 'read' OR (TG_OP = 'UPDATE' AND OLD.status != 'delivered') THEN
+        RETURN NEW;
+    END IF;
+    UPDATE conversation_participants cp
+    SET unread_count = GREATEST(cp.unread_count - 1, 0)
+    FROM messages m
+    WHERE m.id = NEW.message_id
+      AND cp.conversation_id = m.conversation_id
+      AND cp.user_id = NEW.user_id
+      AND m.sender_id != NEW.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND NOT EXISTS (
+          SELECT 1 FROM messages lr
+          WHERE lr.id = cp.last_read_message_id
+            AND (m.created_at, m.id) <= (lr.created_at, lr.id)
+      );
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER count_read_on_status
+    AFTER INSERT OR UPDATE OF status ON message_status
+    FOR EACH ROW
+    EXECUTE FUNCTION count_read_message();
@@ -0,0 +1,153 @@
+-- Read watermarks: a participant has read every message from others sent between
+-- joining and their watermark, so message_status only keeps the exceptions, messages
+-- read or delivered past it
+ALTER TABLE conversation_participants
+    ADD COLUMN last_read_message_at TIMESTAMP WITH TIME ZONE;
+
+-- Start each watermark at the read cursor, or past it at the last message before the
+-- first one still unread, whichever is later
+UPDATE conversation_participants cp
+SET last_read_message_at = GREATEST(
+    (SELECT lr.created_at FROM messages lr WHERE lr.id = cp.last_read_message_id),
+    (
+        SELECT MAX(m.created_at) FROM messages m
+        WHERE m.conversation_id = cp.conversation_id
+          AND m.created_at < COALESCE((
+              SELECT MIN(u.created_at) FROM messages u
+              LEFT JOIN message_status ms ON ms.message_id = u.id AND ms.user_id = cp.user_id
+              WHERE u.conversation_id = cp.conversation_id
+                AND u.sender_id != cp.user_id
+                AND NOT u.is_deleted
+                AND u.created_at >= cp.joined_at
+                AND (ms.status IS NULL OR ms.status = 'delivered')
+          ), 'infinity')
+    )
+);
+
+-- Drop the statuses the watermarks now imply
+DELETE FROM message_status ms
+USING messages m, conversation_participants cp
+WHERE m.id = ms.message_id
+  AND cp.conversation_id = m.conversation_id
+  AND cp.user_id = ms.user_id
+  AND ms.user_id != m.sender_id
+  AND ms.status IN ('delivered', 'read')
+  AND m.created_at >= cp.joined_at
+  AND m.created_at <= cp.last_read_message_at;
+
+-- Moving the read cursor moves the watermark, never back, and drops the statuses it
+-- passed
+CREATE OR REPLACE FUNCTION sync_read_watermark()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.last_read_message_at := GREATEST(
+        NEW.last_read_message_at,
+        (SELECT created_at FROM messages WHERE id = NEW.last_read_message_id)
+    );
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER sync_read_watermark_on_cursor
+    BEFORE INSERT OR UPDATE OF last_read_message_id ON conversation_participants
+    FOR EACH ROW
+    EXECUTE FUNCTION sync_read_watermark();
+
+CREATE OR REPLACE FUNCTION compact_read_statuses()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.last_read_message_at IS NOT DISTINCT FROM OLD.last_read_message_at THEN
+        RETURN NEW;
+    END IF;
+    DELETE FROM message_status ms
+    USING messages m
+    WHERE m.id = ms.message_id
+      AND m.conversation_id = NEW.conversation_id
+      AND ms.user_id = NEW.user_id
+      AND m.sender_id != NEW.user_id
+      AND ms.status IN ('delivered', 'read')
+      AND m.created_at >= NEW.joined_at
+      AND m.created_at <= NEW.last_read_message_at;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER compact_read_statuses_on_watermark
+    AFTER UPDATE OF last_read_message_at ON conversation_participants
+    FOR EACH ROW
+    EXECUTE FUNCTION compact_read_statuses();
+
+-- Who has read a message: participants whose watermark passed it, and the ones with
+-- an exception
+CREATE OR REPLACE FUNCTION message_read_by(msg UUID, conv UUID, sender UUID, sent_at TIMESTAMP WITH TIME ZONE)
+RETURNS UUID[] AS $$
+    SELECT COALESCE(ARRAY_AGG(readers.user_id), '{}')
+    FROM (
+        SELECT cp.user_id FROM conversation_participants cp
+        WHERE cp.conversation_id = conv
+          AND cp.user_id != sender
+          AND sent_at >= cp.joined_at
+          AND sent_at <= cp.last_read_message_at
+        UNION
+        SELECT ms.user_id FROM message_status ms
+        WHERE ms.message_id = msg AND ms.status = 'read'
+    ) readers
+$$ LANGUAGE sql STABLE;
+
+-- Unread counting follows the watermark instead of the read cursor
+CREATE OR REPLACE FUNCTION conversation_unread_count(conv UUID, usr UUID)
+RETURNS INTEGER AS $$
+    SELECT COUNT(*)::INTEGER
+    FROM conversation_participants cp
+    JOIN messages m ON m.conversation_id = cp.conversation_id
+    LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = cp.user_id
+    WHERE cp.conversation_id = conv AND cp.user_id = usr
+      AND m.sender_id != cp.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at)
+      AND (ms.status IS NULL OR ms.status = 'delivered')
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION count_unread_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_participants
+        SET unread_count = unread_count + 1
+        WHERE conversation_id = NEW.conversation_id AND user_id != NEW.sender_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_participants cp
+        SET unread_count = GREATEST(cp.unread_count - 1, 0)
+        WHERE cp.conversation_id = NEW.conversation_id
+          AND cp.user_id != NEW.sender_id
+          AND NEW.created_at >= cp.joined_at
+          AND (cp.last_read_message_at IS NULL OR NEW.created_at > cp.last_read_message_at)
+          AND NOT EXISTS (
+              SELECT 1 FROM message_status ms
+              WHERE ms.message_id = NEW.id AND ms.user_id = cp.user_id AND ms.status != 'delivered'
+          );
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION count_read_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status != 'read' OR (TG_OP = 'UPDATE' AND OLD.status != 'delivered') THEN
+        RETURN NEW;
+    END IF;
+    UPDATE conversation_participants cp
+    SET unread_count = GREATEST(cp.unread_count - 1, 0)
+    FROM messages m
+    WHERE m.id = NEW.message_id
+      AND cp.conversation_id = m.conversation_id
+      AND cp.user_id = NEW.user_id
+      AND m.sender_id != NEW.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
@@ -0,0 +1,32 @@
+-- Drop last message previews
+DROP TRIGGER IF EXISTS summarize_conversation_on_message ON messages;
+
+CREATE OR REPLACE FUNCTION summarize_conversation_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_summaries
+        SET last_message_id = NEW.id, last_activity_at = NEW.created_at, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_summaries
+        SET last_message_id = (
+                SELECT m.id FROM messages m
+                WHERE m.conversation_id = NEW.conversation_id AND NOT m.is_deleted
+                ORDER BY m.created_at DESC, m.id DESC
+                LIMIT 1
+            ),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER summarize_conversation_on_message
+    AFTER INSERT OR UPDATE OF is_deleted ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION summarize_conversation_message();
+
+DROP INDEX IF EXISTS idx_conversation_summaries_missing_preview;
+ALTER TABLE conversation_summaries DROP COLUMN IF EXISTS last_message_preview;
@@ -0,0 +1,43 @@
+-- Encrypted previews of each conversation's last message, so listing conversations
+-- doesn't decrypt whole messages. A preview is cleared whenever the last message
+-- changes and written again by the API, in the same transaction or in the background.
+ALTER TABLE conversation_summaries
+    ADD COLUMN last_message_preview TEXT;
+
+CREATE INDEX idx_conversation_summaries_missing_preview
+    ON conversation_summaries (conversation_id)
+    WHERE last_message_preview IS NULL AND last_message_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION summarize_conversation_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_summaries
+        SET last_message_id = NEW.id, last_activity_at = NEW.created_at,
+            last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_summaries
+        SET last_message_id = (
+                SELECT m.id FROM messages m
+                WHERE m.conversation_id = NEW.conversation_id AND NOT m.is_deleted
+                ORDER BY m.created_at DESC, m.id DESC
+                LIMIT 1
+            ),
+            last_message_preview = NULL,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    ELSIF NEW.content IS DISTINCT FROM OLD.content THEN
+        UPDATE conversation_summaries
+        SET last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS summarize_conversation_on_message ON messages;
+CREATE TRIGGER summarize_conversation_on_message
+    AFTER INSERT OR UPDATE OF is_deleted, content ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION summarize_conversation_message();
@@ -0,0 +1,2 @@
+-- Drop the conversation membership log
+DROP TABLE IF EXISTS conversation_membership_log;
@@ -0,0 +1,21 @@
+-- The history of who joined, left and was removed from each conversation, and of role
+-- changes. Users are kept by ID only, so the history outlives their accounts.
+CREATE TABLE conversation_membership_log (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    event VARCHAR(20) NOT NULL CHECK (event IN ('joined', 'left', 'removed', 'role_changed')),
+    -- Who made the change; missing for changes made before the log was kept
+    actor_id UUID,
+    target_id UUID NOT NULL,
+    old_role VARCHAR(20),
+    new_role VARCHAR(20),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_conversation_membership_log_conversation ON conversation_membership_log(conversation_id, id);
+
+-- Current members are known to have joined
+INSERT INTO conversation_membership_log (conversation_id, event, target_id, new_role, created_at)
+SELECT conversation_id, 'joined', user_id, COALESCE(role, 'member'), COALESCE(joined_at, CURRENT_TIMESTAMP)
+FROM conversation_participants
+ORDER BY joined_at;
@@ -0,0 +1,2 @@
+-- Drop pending email changes
+DROP TABLE IF EXISTS email_changes;
@@ -0,0 +1,3 @@
+-- Drop the email blind index
+DROP INDEX IF EXISTS idx_users_email_index;
+ALTER TABLE users DROP COLUMN IF EXISTS email_index;
@@ -0,0 +1,6 @@
+-- Blind index of users' email addresses, a keyed hash of the normalized address, so
+-- that addresses can be looked up while they stay encrypted. The API fills it in for
+-- existing users in the background.
+ALTER TABLE users ADD COLUMN email_index VARCHAR(64);
+
+CREATE INDEX idx_users_email_index ON users(email_index);
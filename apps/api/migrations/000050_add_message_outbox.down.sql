@@ -0,0 +1,3 @@
+-- Drop the outbox; messages still in it are never sent
+DROP TABLE IF EXISTS message_outbox;
+ALTER TABLE users DROP COLUMN IF EXISTS undo_send_seconds;
@@ -0,0 +1,18 @@
+-- Undo send: with a window set, messages wait in the outbox for that many seconds
+-- before they are written to the conversation, and the sender can cancel them meanwhile
+ALTER TABLE users ADD COLUMN undo_send_seconds INTEGER NOT NULL DEFAULT 0
+    CHECK (undo_send_seconds BETWEEN 0 AND 30);
+
+-- The payload is the message as sent, encrypted like message content. The row's ID
+-- becomes the message's once it is released.
+CREATE TABLE message_outbox (
+    id UUID PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    release_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_message_outbox_release_at ON message_outbox(release_at);
@@ -0,0 +1,2 @@
+-- Drop conversation app installations
+DROP TABLE IF EXISTS conversation_apps;
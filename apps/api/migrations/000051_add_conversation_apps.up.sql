@@ -0,0 +1,12 @@
+-- Third-party applications installed in a group. Installed applications receive the
+-- group's events over WebSocket, as bots, when the installation grants read:messages.
+CREATE TABLE conversation_apps (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    application_id UUID NOT NULL REFERENCES oauth_applications(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    installed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    installed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, application_id)
+);
+
+CREATE INDEX idx_conversation_apps_application ON conversation_apps(application_id);
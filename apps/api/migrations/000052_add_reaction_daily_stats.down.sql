@@ -0,0 +1,3 @@
+-- Drop reaction rollups
+DROP TABLE IF EXISTS message_reaction_daily_stats;
+DROP TABLE IF EXISTS reaction_daily_stats;
@@ -0,0 +1,34 @@
+-- Daily rollups of reactions, by emoji per conversation and by message, for trending
+-- reactions and most reacted messages. Reactions count on the day they were added.
+CREATE TABLE reaction_daily_stats (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    emoji VARCHAR(32) NOT NULL,
+    day DATE NOT NULL,
+    reaction_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (conversation_id, emoji, day)
+);
+
+CREATE TABLE message_reaction_daily_stats (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    reaction_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, day)
+);
+
+CREATE INDEX idx_reaction_daily_stats_day ON reaction_daily_stats(day);
+CREATE INDEX idx_message_reaction_daily_stats_day ON message_reaction_daily_stats(day);
+CREATE INDEX idx_message_reaction_daily_stats_conversation ON message_reaction_daily_stats(conversation_id, day);
+
+-- Roll up the reactions added so far; the rollup job keeps the recent days current
+INSERT INTO reaction_daily_stats (conversation_id, emoji, day, reaction_count)
+SELECT m.conversation_id, r.emoji, (r.created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+FROM message_reactions r
+JOIN messages m ON m.id = r.message_id AND NOT m.is_deleted
+GROUP BY 1, 2, 3;
+
+INSERT INTO message_reaction_daily_stats (message_id, conversation_id, day, reaction_count)
+SELECT r.message_id, m.conversation_id, (r.created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+FROM message_reactions r
+JOIN messages m ON m.id = r.message_id AND NOT m.is_deleted
+GROUP BY 1, 2, 3;
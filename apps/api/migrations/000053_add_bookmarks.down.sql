@@ -0,0 +1,3 @@
+-- Drop bookmarks and their folders
+DROP TABLE IF EXISTS message_bookmarks;
+DROP TABLE IF EXISTS bookmark_folders;
@@ -0,0 +1,2 @@
+-- Drop conversation digests
+DROP TABLE IF EXISTS conversation_digests;
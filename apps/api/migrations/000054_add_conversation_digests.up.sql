@@ -0,0 +1,15 @@
+-- Recurring digests of a group's activity, posted into it as system messages. Times
+-- are UTC; weekday counts from Sunday (0) and only applies to weekly digests.
+CREATE TABLE conversation_digests (
+    conversation_id UUID PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+    hour SMALLINT NOT NULL CHECK (hour BETWEEN 0 AND 23),
+    weekday SMALLINT CHECK (weekday BETWEEN 0 AND 6),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_posted_at TIMESTAMP WITH TIME ZONE,
+    next_post_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_conversation_digests_next_post ON conversation_digests(next_post_at);
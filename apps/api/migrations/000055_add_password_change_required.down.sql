@@ -0,0 +1,2 @@
+-- Drop forced password rotation
+ALTER TABLE users DROP COLUMN IF EXISTS password_change_required;
@@ -0,0 +1,2 @@
+-- Administrators can make a user choose a new password before using the API again
+ALTER TABLE users ADD COLUMN password_change_required BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- Drop login alerts and system accounts; their messages keep them as inactive users
+UPDATE users SET is_active = false WHERE is_system;
+ALTER TABLE users DROP COLUMN IF EXISTS is_system;
+ALTER TABLE notifications DROP COLUMN IF EXISTS login_alert_id;
+DROP TABLE IF EXISTS login_alerts;
+DROP TABLE IF EXISTS login_ips;
@@ -0,0 +1,34 @@
+-- Sign-ins from IPs or countries a user hasn't used before, which users can report
+CREATE TABLE login_ips (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(45) NOT NULL,
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, ip)
+);
+
+-- Devices remember the IP they last signed in from; start from those
+INSERT INTO login_ips (user_id, ip, country, first_seen_at, last_seen_at)
+SELECT user_id, last_ip, country, first_seen_at, last_seen_at
+FROM user_devices
+WHERE last_ip <> ''
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE login_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_name VARCHAR(128) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reported_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_login_alerts_user_created ON login_alerts(user_id, created_at DESC);
+
+-- Sign-in notifications point at their alert, for the "that wasn't me" action
+ALTER TABLE notifications ADD COLUMN login_alert_id UUID REFERENCES login_alerts(id) ON DELETE CASCADE;
+
+-- Accounts the server posts as, such as Talkify Security; nobody can sign in to them
+ALTER TABLE users ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Drop impersonations
+DROP TABLE IF EXISTS impersonations;
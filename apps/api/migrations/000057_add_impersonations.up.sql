@@ -0,0 +1,22 @@
+-- Administrators acting as users for support, with the user's consent or, break-glass,
+-- another administrator's approval
+CREATE TABLE impersonations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    admin_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mode VARCHAR(16) NOT NULL CHECK (mode IN ('full', 'read_only')),
+    reason TEXT NOT NULL,
+    break_glass BOOLEAN NOT NULL DEFAULT false,
+    duration_seconds INTEGER NOT NULL CHECK (duration_seconds > 0),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'denied', 'ended')),
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_impersonations_user ON impersonations(user_id, created_at DESC);
+CREATE INDEX idx_impersonations_created ON impersonations(created_at DESC);
@@ -0,0 +1,3 @@
+-- Drop the verified flag and the index for counting conversations users created
+DROP INDEX IF EXISTS idx_conversations_created_by;
+ALTER TABLE users DROP COLUMN IF EXISTS verified_at;
@@ -0,0 +1,4 @@
+-- Verified users, marked by administrators, may create more conversations per hour and day
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_created_by ON conversations(created_by, created_at);
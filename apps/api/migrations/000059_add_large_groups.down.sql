@@ -0,0 +1,18 @@
+-- List the readers of messages in every conversation again
+CREATE OR REPLACE FUNCTION message_read_by(msg UUID, conv UUID, sender UUID, sent_at TIMESTAMP WITH TIME ZONE)
+RETURNS UUID[] AS $$
+    SELECT COALESCE(ARRAY_AGG(readers.user_id), '{}')
+    FROM (
+        SELECT cp.user_id FROM conversation_participants cp
+        WHERE cp.conversation_id = conv
+          AND cp.user_id != sender
+          AND sent_at >= cp.joined_at
+          AND sent_at <= cp.last_read_message_at
+        UNION
+        SELECT ms.user_id FROM message_status ms
+        WHERE ms.message_id = msg AND ms.status = 'read'
+    ) readers
+$$ LANGUAGE sql STABLE;
+
+DROP INDEX IF EXISTS idx_conversation_participants_joined;
+ALTER TABLE conversations DROP COLUMN IF EXISTS large_group;
@@ -0,0 +1,21 @@
+-- Large groups only keep read watermarks: nobody is listed as having read a message
+ALTER TABLE conversations ADD COLUMN large_group BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_conversation_participants_joined
+    ON conversation_participants(conversation_id, joined_at, user_id);
+
+CREATE OR REPLACE FUNCTION message_read_by(msg UUID, conv UUID, sender UUID, sent_at TIMESTAMP WITH TIME ZONE)
+RETURNS UUID[] AS $$
+    SELECT COALESCE(ARRAY_AGG(readers.user_id), '{}')
+    FROM (
+        SELECT cp.user_id FROM conversation_participants cp
+        WHERE cp.conversation_id = conv
+          AND cp.user_id != sender
+          AND sent_at >= cp.joined_at
+          AND sent_at <= cp.last_read_message_at
+        UNION
+        SELECT ms.user_id FROM message_status ms
+        WHERE ms.message_id = msg AND ms.status = 'read'
+    ) readers
+    WHERE NOT EXISTS (SELECT 1 FROM conversations c WHERE c.id = conv AND c.large_group)
+$$ LANGUAGE sql STABLE;
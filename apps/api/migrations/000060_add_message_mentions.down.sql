@@ -0,0 +1,2 @@
+-- Drop the mentions feed
+DROP TABLE IF EXISTS message_mentions;
@@ -0,0 +1,13 @@
+-- Participants mentioned by @username in a message, for the mentions feed. Mentions are
+-- read separately from the conversation's unread count.
+CREATE TABLE message_mentions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX idx_message_mentions_user ON message_mentions(user_id, created_at DESC);
+CREATE INDEX idx_message_mentions_unread ON message_mentions(user_id, conversation_id) WHERE read_at IS NULL;
@@ -0,0 +1,4 @@
+-- Drop keyword alerts
+ALTER TABLE notifications DROP COLUMN IF EXISTS message_id;
+ALTER TABLE notifications DROP COLUMN IF EXISTS conversation_id;
+DROP TABLE IF EXISTS keyword_alerts;
@@ -0,0 +1,18 @@
+-- Keywords a user is notified about when they come up in a conversation, or in any
+-- conversation when conversation_id is NULL
+CREATE TABLE keyword_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    keyword VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_keyword_alerts_unique ON keyword_alerts(
+    user_id, COALESCE(conversation_id, '00000000-0000-0000-0000-000000000000'), LOWER(keyword)
+);
+CREATE INDEX idx_keyword_alerts_conversation ON keyword_alerts(conversation_id) WHERE conversation_id IS NOT NULL;
+
+-- Keyword alert notifications point at the message that set them off
+ALTER TABLE notifications ADD COLUMN conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE;
+ALTER TABLE notifications ADD COLUMN message_id UUID REFERENCES messages(id) ON DELETE CASCADE;
@@ -0,0 +1,10 @@
+-- Drop automation filters and message automations
+DROP INDEX IF EXISTS idx_conversation_automations_event;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS payload_template;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS sender_pattern;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS message_types;
+
+DELETE FROM conversation_automations WHERE event = 'message.created';
+ALTER TABLE conversation_automations DROP CONSTRAINT conversation_automations_event_check;
+ALTER TABLE conversation_automations ADD CONSTRAINT conversation_automations_event_check
+    CHECK (event IN ('participant.joined', 'participant.left'));
@@ -0,0 +1,11 @@
+-- Webhook automations can run on new messages, filtered by message type and sender, and
+-- shape their payload with a template
+ALTER TABLE conversation_automations DROP CONSTRAINT conversation_automations_event_check;
+ALTER TABLE conversation_automations ADD CONSTRAINT conversation_automations_event_check
+    CHECK (event IN ('participant.joined', 'participant.left', 'message.created'));
+
+ALTER TABLE conversation_automations ADD COLUMN message_types TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE conversation_automations ADD COLUMN sender_pattern VARCHAR(64);
+ALTER TABLE conversation_automations ADD COLUMN payload_template TEXT;
+
+CREATE INDEX idx_conversation_automations_event ON conversation_automations(conversation_id, event) WHERE enabled = true;
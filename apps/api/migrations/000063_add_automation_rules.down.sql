@@ -0,0 +1,14 @@
+-- Drop automation rules
+DROP TABLE IF EXISTS conversation_labels;
+
+DELETE FROM conversation_automations WHERE action IN ('notify_user', 'add_label');
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS window_runs;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS window_started_at;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS label;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS notify_user_id;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS keywords;
+ALTER TABLE conversation_automations DROP COLUMN IF EXISTS content_pattern;
+
+ALTER TABLE conversation_automations DROP CONSTRAINT conversation_automations_action_check;
+ALTER TABLE conversation_automations ADD CONSTRAINT conversation_automations_action_check
+    CHECK (action IN ('post_message', 'webhook'));
@@ -0,0 +1,22 @@
+-- Automations become rules: messages can be matched by pattern or keywords, and rules
+-- can notify a participant or label the conversation. Runs are counted per minute to
+-- stop rules that set themselves off.
+ALTER TABLE conversation_automations DROP CONSTRAINT conversation_automations_action_check;
+ALTER TABLE conversation_automations ADD CONSTRAINT conversation_automations_action_check
+    CHECK (action IN ('post_message', 'webhook', 'notify_user', 'add_label'));
+
+ALTER TABLE conversation_automations ADD COLUMN content_pattern VARCHAR(200);
+ALTER TABLE conversation_automations ADD COLUMN keywords TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE conversation_automations ADD COLUMN notify_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE conversation_automations ADD COLUMN label VARCHAR(50);
+ALTER TABLE conversation_automations ADD COLUMN window_started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE conversation_automations ADD COLUMN window_runs INTEGER NOT NULL DEFAULT 0;
+
+-- Labels on a conversation, shared by its participants
+CREATE TABLE conversation_labels (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    label VARCHAR(50) NOT NULL,
+    automation_id UUID REFERENCES conversation_automations(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, label)
+);
@@ -0,0 +1,2 @@
+-- Drop message annotations
+DROP TABLE IF EXISTS message_annotations;
@@ -0,0 +1,12 @@
+-- Structured data integrations attach to messages, such as ticket links or CI statuses.
+-- Each source (an application or internal service) keeps its own keys.
+CREATE TABLE message_annotations (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    source VARCHAR(128) NOT NULL,
+    key VARCHAR(64) NOT NULL,
+    value JSONB NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, source, key)
+);
@@ -0,0 +1,2 @@
+-- Drop message cards
+DROP TABLE IF EXISTS message_cards;
@@ -0,0 +1,8 @@
+-- Cards integrations attach to their messages: a title, text, fields, images and
+-- buttons. The card is kept as JSON, encrypted like message content. Buttons with a
+-- callback action are answered by the application that posted the card.
+CREATE TABLE message_cards (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    application_id UUID REFERENCES oauth_applications(id) ON DELETE SET NULL,
+    card TEXT NOT NULL
+);
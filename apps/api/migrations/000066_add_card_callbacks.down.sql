@@ -0,0 +1,2 @@
+-- Drop card callback secrets
+ALTER TABLE message_cards DROP COLUMN IF EXISTS callback_secret;
@@ -0,0 +1,6 @@
+-- Interactive cards: each card gets a secret that signs the callback tokens of its
+-- buttons and select menus. Cards posted before are given one.
+ALTER TABLE message_cards ADD COLUMN callback_secret TEXT;
+UPDATE message_cards
+SET callback_secret = replace(uuid_generate_v4()::text || uuid_generate_v4()::text, '-', '');
+ALTER TABLE message_cards ALTER COLUMN callback_secret SET NOT NULL;
@@ -0,0 +1,2 @@
+-- Drop conversation permissions
+ALTER TABLE conversations DROP COLUMN IF EXISTS permissions;
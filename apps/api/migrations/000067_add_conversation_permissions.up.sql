@@ -0,0 +1,3 @@
+-- Who may send, reply, react and star in a group, set by its owner. Each action maps
+-- to everyone, admins or owner; actions left out are open to everyone.
+ALTER TABLE conversations ADD COLUMN permissions JSONB NOT NULL DEFAULT '{}';
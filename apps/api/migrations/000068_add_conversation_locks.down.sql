@@ -0,0 +1,5 @@
+-- Drop conversation locks
+DROP INDEX IF EXISTS idx_conversations_locked_until;
+ALTER TABLE conversations DROP COLUMN IF EXISTS lock_reason;
+ALTER TABLE conversations DROP COLUMN IF EXISTS locked_by;
+ALTER TABLE conversations DROP COLUMN IF EXISTS locked_until;
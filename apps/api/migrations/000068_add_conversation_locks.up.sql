@@ -0,0 +1,8 @@
+-- Admins can lock a group for a while, leaving only the owner and admins able to post.
+-- The lock lifts by itself at locked_until.
+ALTER TABLE conversations ADD COLUMN locked_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE conversations ADD COLUMN locked_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE conversations ADD COLUMN lock_reason VARCHAR(200);
+
+CREATE INDEX idx_conversations_locked_until ON conversations(locked_until)
+    WHERE locked_until IS NOT NULL;
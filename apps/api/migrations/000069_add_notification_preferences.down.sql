@@ -0,0 +1,2 @@
+-- Drop notification preferences
+DROP TABLE IF EXISTS notification_preferences;
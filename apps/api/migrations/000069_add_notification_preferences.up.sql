@@ -0,0 +1,9 @@
+-- Users choose which channels each kind of notification goes out on, and when each
+-- channel stays quiet. Users without a row get the default routes.
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    routes JSONB NOT NULL DEFAULT '{}',
+    quiet_hours JSONB NOT NULL DEFAULT '{}',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
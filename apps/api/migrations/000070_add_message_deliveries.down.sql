@@ -0,0 +1,2 @@
+-- Drop the message delivery ledger
+DROP TABLE IF EXISTS message_deliveries;
@@ -0,0 +1,11 @@
+-- Ledger of the channels each message reached each recipient on, so that notifications
+-- aren't sent for messages already seen on a connected device, nor twice on a channel
+CREATE TABLE message_deliveries (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel VARCHAR(16) NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, channel)
+);
+
+CREATE INDEX idx_message_deliveries_delivered_at ON message_deliveries(delivered_at);
@@ -0,0 +1,5 @@
+-- Move timezones back to notification preferences
+ALTER TABLE conversation_digests DROP COLUMN IF EXISTS timezone;
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+UPDATE notification_preferences np SET timezone = u.timezone FROM users u WHERE u.id = np.user_id;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
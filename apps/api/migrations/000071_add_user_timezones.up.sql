@@ -0,0 +1,8 @@
+-- Users keep one timezone, for quiet hours, digests and display hints. Notification
+-- preferences had their own, which moves to the user.
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+UPDATE users u SET timezone = np.timezone FROM notification_preferences np WHERE np.user_id = u.id;
+ALTER TABLE notification_preferences DROP COLUMN timezone;
+
+-- Digests are posted at their hour in the timezone they were scheduled in
+ALTER TABLE conversation_digests ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
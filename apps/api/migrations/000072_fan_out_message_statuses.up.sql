@@ -0,0 +1,82 @@
+-- Messages are fanned out to the participants of groups not in large-group mode: each
+-- gets a 'sent' status, pending until it is delivered or read. Pending messages count
+-- as unread like delivered ones, and watermarks drop them with the rest.
+CREATE OR REPLACE FUNCTION conversation_unread_count(conv UUID, usr UUID)
+RETURNS INTEGER AS $$
+    SELECT COUNT(*)::INTEGER
+    FROM conversation_participants cp
+    JOIN messages m ON m.conversation_id = cp.conversation_id
+    LEFT JOIN message_status ms ON ms.message_id = m.id AND ms.user_id = cp.user_id
+    WHERE cp.conversation_id = conv AND cp.user_id = usr
+      AND m.sender_id != cp.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at)
+      AND (ms.status IS NULL OR ms.status IN ('sent', 'delivered'))
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION count_unread_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_participants
+        SET unread_count = unread_count + 1
+        WHERE conversation_id = NEW.conversation_id AND user_id != NEW.sender_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_participants cp
+        SET unread_count = GREATEST(cp.unread_count - 1, 0)
+        WHERE cp.conversation_id = NEW.conversation_id
+          AND cp.user_id != NEW.sender_id
+          AND NEW.created_at >= cp.joined_at
+          AND (cp.last_read_message_at IS NULL OR NEW.created_at > cp.last_read_message_at)
+          AND NOT EXISTS (
+              SELECT 1 FROM message_status ms
+              WHERE ms.message_id = NEW.id AND ms.user_id = cp.user_id
+                AND ms.status NOT IN ('sent', 'delivered')
+          );
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION count_read_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status != 'read' OR (TG_OP = 'UPDATE' AND OLD.status NOT IN ('sent', 'delivered')) THEN
+        RETURN NEW;
+    END IF;
+    UPDATE conversation_participants cp
+    SET unread_count = GREATEST(cp.unread_count - 1, 0)
+    FROM messages m
+    WHERE m.id = NEW.message_id
+      AND cp.conversation_id = m.conversation_id
+      AND cp.user_id = NEW.user_id
+      AND m.sender_id != NEW.user_id
+      AND NOT m.is_deleted
+      AND m.created_at >= cp.joined_at
+      AND (cp.last_read_message_at IS NULL OR m.created_at > cp.last_read_message_at);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION compact_read_statuses()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.last_read_message_at IS NOT DISTINCT FROM OLD.last_read_message_at THEN
+        RETURN NEW;
+    END IF;
+    DELETE FROM message_status ms
+    USING messages m
+    WHERE m.id = ms.message_id
+      AND m.conversation_id = NEW.conversation_id
+      AND ms.user_id = NEW.user_id
+      AND m.sender_id != NEW.user_id
+      AND ms.status IN ('sent', 'delivered', 'read')
+      AND m.created_at >= NEW.joined_at
+      AND m.created_at <= NEW.last_read_message_at;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Finds the messages still pending for a participant
+CREATE INDEX idx_message_status_pending ON message_status(user_id, message_id) WHERE status = 'sent';
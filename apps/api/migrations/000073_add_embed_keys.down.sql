@@ -0,0 +1,2 @@
+-- Drop embed keys
+DROP TABLE IF EXISTS embed_keys;
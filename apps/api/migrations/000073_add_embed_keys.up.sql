@@ -0,0 +1,17 @@
+-- Keys granting read-only access to a single conversation's messages, for embedding a
+-- live feed on a website or status screen. Only a hash of each key is kept.
+CREATE TABLE embed_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    key_prefix VARCHAR(16) NOT NULL,
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    requests_per_minute INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_embed_keys_conversation ON embed_keys(conversation_id, created_at);
@@ -0,0 +1,5 @@
+-- Drop muting and archiving of conversations
+ALTER TABLE conversation_participants
+    DROP COLUMN IF EXISTS muted_at,
+    DROP COLUMN IF EXISTS muted_until,
+    DROP COLUMN IF EXISTS archived_at;
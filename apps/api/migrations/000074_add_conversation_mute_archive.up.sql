@@ -0,0 +1,5 @@
+-- Let each participant mute a conversation, for a while or until unmuted, and archive it
+ALTER TABLE conversation_participants
+    ADD COLUMN muted_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN muted_until TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
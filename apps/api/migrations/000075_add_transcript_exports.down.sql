@@ -0,0 +1,2 @@
+-- Drop transcript exports
+DROP TABLE IF EXISTS transcript_exports;
@@ -0,0 +1,21 @@
+-- Transcripts of conversations, or of a date range in one, rendered for one user
+CREATE TABLE transcript_exports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed')),
+    from_at TIMESTAMP WITH TIME ZONE,
+    to_at TIMESTAMP WITH TIME ZONE,
+    timezone VARCHAR(64) NOT NULL,
+    message_count INTEGER NOT NULL DEFAULT 0,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    data_key TEXT,
+    key_id VARCHAR(16),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_transcript_exports_expires_at ON transcript_exports(expires_at);
@@ -0,0 +1,3 @@
+-- Drop message drafts and their staged media
+DROP TABLE IF EXISTS draft_attachments;
+DROP TABLE IF EXISTS message_drafts;
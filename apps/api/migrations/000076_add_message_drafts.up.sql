@@ -0,0 +1,27 @@
+-- Keep each participant's unsent message per conversation, with media staged for it
+CREATE TABLE message_drafts (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL DEFAULT '',
+    reply_to_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE TABLE draft_attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    message_type VARCHAR(16) NOT NULL CHECK (message_type IN ('image', 'video', 'audio', 'file')),
+    media_url TEXT NOT NULL,
+    media_thumbnail_url TEXT,
+    media_size INTEGER,
+    media_duration INTEGER,
+    view_once BOOLEAN NOT NULL DEFAULT FALSE,
+    staged_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (conversation_id, user_id),
+    FOREIGN KEY (conversation_id, user_id) REFERENCES message_drafts(conversation_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_drafts_updated_at ON message_drafts(updated_at);
@@ -0,0 +1,3 @@
+-- Drop notification previews
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS notification_preview;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS preview;
@@ -0,0 +1,10 @@
+-- How much of a message its notifications show: full shows the message, sender only
+-- who sent it and generic neither. Users pick a default and may override it per
+-- conversation.
+ALTER TABLE notification_preferences
+    ADD COLUMN preview VARCHAR(10) NOT NULL DEFAULT 'sender'
+        CHECK (preview IN ('full', 'sender', 'generic'));
+
+ALTER TABLE conversation_participants
+    ADD COLUMN notification_preview VARCHAR(10)
+        CHECK (notification_preview IN ('full', 'sender', 'generic'));
@@ -0,0 +1,6 @@
+-- Drop federated direct messages and shadow accounts
+DROP TABLE IF EXISTS federated_messages;
+DELETE FROM users WHERE federated_address IS NOT NULL;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS federated_user_id,
+    DROP COLUMN IF EXISTS federated_address;
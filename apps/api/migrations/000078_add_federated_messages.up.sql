@@ -0,0 +1,24 @@
+-- Users of other deployments that local users exchange direct messages with are kept
+-- as shadow accounts nobody can sign in to, named by their federated address
+ALTER TABLE users
+    ADD COLUMN federated_address VARCHAR(255) UNIQUE,
+    ADD COLUMN federated_user_id UUID;
+
+-- Direct messages exchanged with other deployments. Outgoing ones are retried until
+-- the peer acknowledges them; incoming ones are remembered so that envelopes delivered
+-- twice are stored once.
+CREATE TABLE federated_messages (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    peer VARCHAR(255) NOT NULL,
+    envelope_id UUID NOT NULL,
+    direction VARCHAR(8) NOT NULL CHECK (direction IN ('outgoing', 'incoming')),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (peer, envelope_id, direction)
+);
+
+CREATE INDEX idx_federated_messages_due ON federated_messages(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- Remove the compliance stream
+DROP TABLE IF EXISTS compliance_checkpoints;
+DROP TRIGGER IF EXISTS record_compliance_event_on_message ON messages;
+DROP FUNCTION IF EXISTS record_compliance_event();
+DROP TABLE IF EXISTS compliance_events;
+DROP SEQUENCE IF EXISTS compliance_event_offsets;
@@ -0,0 +1,52 @@
+-- Message events streamed to compliance recorders. Triggers record every new, edited
+-- and deleted message with its content as stored, encrypted. Offsets are only given
+-- out once an event is committed, one batch at a time, so a recorder reading after
+-- an offset never misses an event committed late.
+CREATE SEQUENCE compliance_event_offsets;
+
+CREATE TABLE compliance_events (
+    id BIGSERIAL PRIMARY KEY,
+    stream_offset BIGINT UNIQUE,
+    event VARCHAR(20) NOT NULL CHECK (event IN ('message.created', 'message.updated', 'message.deleted')),
+    message_id UUID NOT NULL,
+    conversation_id UUID NOT NULL,
+    sender_id UUID NOT NULL,
+    message_type VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,  -- Stored encrypted
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_compliance_events_unsequenced ON compliance_events(id) WHERE stream_offset IS NULL;
+CREATE INDEX idx_compliance_events_occurred ON compliance_events(occurred_at);
+
+CREATE OR REPLACE FUNCTION record_compliance_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    kind VARCHAR(20);
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        kind := 'message.created';
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        kind := 'message.deleted';
+    ELSIF NEW.content IS DISTINCT FROM OLD.content AND NOT NEW.is_deleted THEN
+        kind := 'message.updated';
+    ELSE
+        RETURN NEW;
+    END IF;
+    INSERT INTO compliance_events (event, message_id, conversation_id, sender_id, message_type, content)
+    VALUES (kind, NEW.id, NEW.conversation_id, NEW.sender_id, NEW.message_type::text, NEW.content);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER record_compliance_event_on_message
+    AFTER INSERT OR UPDATE OF content, is_deleted ON messages
+    FOR EACH ROW
+    EXECUTE FUNCTION record_compliance_event();
+
+-- The offset each recorder has durably stored, where its stream resumes
+CREATE TABLE compliance_checkpoints (
+    recorder VARCHAR(100) PRIMARY KEY,
+    stream_offset BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
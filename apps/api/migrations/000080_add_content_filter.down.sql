@@ -0,0 +1,5 @@
+-- Drop custom filter terms and conversation filter overrides
+DROP TABLE IF EXISTS content_filter_terms;
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS content_filter_locale,
+    DROP COLUMN IF EXISTS content_filter_mode;
@@ -0,0 +1,15 @@
+-- Conversations can filter profanity differently from the server, with another mode
+-- or another locale's wordlist; NULL follows the server
+ALTER TABLE conversations
+    ADD COLUMN content_filter_mode VARCHAR(5) CHECK (content_filter_mode IN ('off', 'mask', 'block')),
+    ADD COLUMN content_filter_locale VARCHAR(16);
+
+-- Terms admins add to the wordlist of a locale, stored lowercased
+CREATE TABLE content_filter_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    locale VARCHAR(16) NOT NULL,
+    term VARCHAR(100) NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (locale, term)
+);
@@ -0,0 +1,3 @@
+-- Drop support tickets; support conversations become direct conversations again
+DROP TABLE IF EXISTS support_tickets;
+UPDATE conversations SET type = 'direct' WHERE type::text = 'support';
@@ -0,0 +1,29 @@
+-- Direct messages to the support account are support conversations. The type column is
+-- an enum on databases created before it became VARCHAR.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_type WHERE typname = 'conversation_type') THEN
+        EXECUTE 'ALTER TYPE conversation_type ADD VALUE IF NOT EXISTS ''support''';
+    END IF;
+END$$;
+
+-- A support conversation's ticket is queued by the customer's messages, claimed by an
+-- agent and resolved; a message after resolution queues it again
+CREATE TABLE support_tickets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL UNIQUE REFERENCES conversations(id) ON DELETE CASCADE,
+    customer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(8) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'assigned', 'resolved')),
+    agent_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    queued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    assigned_at TIMESTAMP WITH TIME ZONE,
+    first_response_at TIMESTAMP WITH TIME ZONE,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    -- When a timer was first found breached, so each breach is reported once
+    sla_breached_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_support_tickets_status_queued ON support_tickets(status, queued_at);
+CREATE INDEX idx_support_tickets_agent ON support_tickets(agent_id) WHERE status = 'assigned';
@@ -0,0 +1,2 @@
+-- Drop workspace branding; new users start with the built-in status again
+DROP TABLE IF EXISTS workspace_branding;
@@ -0,0 +1,13 @@
+-- How the workspace presents itself to clients, set by admins. There is a single row.
+CREATE TABLE workspace_branding (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    name VARCHAR(100) NOT NULL DEFAULT 'Talkify',
+    logo_url TEXT,
+    accent_color VARCHAR(7),
+    -- The status new users start with, as long as users.status
+    default_status VARCHAR(50) NOT NULL DEFAULT 'Hey, I''m using Talkify!',
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO workspace_branding DEFAULT VALUES;
@@ -0,0 +1,4 @@
+-- Drop the addresses of sessions
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS last_ip,
+    DROP COLUMN IF EXISTS ip;
@@ -0,0 +1,5 @@
+-- The client address each session was signed in from and last refreshed from, as
+-- resolved through the trusted proxies
+ALTER TABLE sessions
+    ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN last_ip VARCHAR(45) NOT NULL DEFAULT '';
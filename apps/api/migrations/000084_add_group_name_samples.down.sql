@@ -0,0 +1,36 @@
+-- Store names for groups without one again, as they were generated before
+ALTER TABLE conversations DISABLE TRIGGER update_conversations_updated_at;
+UPDATE conversations c
+SET name = CASE
+        WHEN s.participant_count > 2 THEN
+            (s.name_sample->0->>'name') || ', ' || (s.name_sample->1->>'name') || ' & ' || (s.participant_count - 2) || ' others'
+        ELSE (s.name_sample->0->>'name') || ', ' || (s.name_sample->1->>'name')
+    END
+FROM conversation_summaries s
+WHERE s.conversation_id = c.id AND c.type = 'group' AND c.name IS NULL
+    AND jsonb_array_length(s.name_sample) >= 2;
+ALTER TABLE conversations ENABLE TRIGGER update_conversations_updated_at;
+
+DROP TRIGGER IF EXISTS summarize_participant_name_on_user ON users;
+DROP FUNCTION IF EXISTS summarize_participant_name();
+
+CREATE OR REPLACE FUNCTION summarize_conversation_membership()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE conversation_summaries
+        SET participant_count = participant_count - 1, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = OLD.conversation_id;
+        RETURN OLD;
+    END IF;
+    UPDATE conversation_summaries
+    SET participant_count = participant_count + 1, updated_at = CURRENT_TIMESTAMP
+    WHERE conversation_id = NEW.conversation_id;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP FUNCTION IF EXISTS conversation_name_sample(UUID);
+
+ALTER TABLE conversation_summaries
+    DROP COLUMN IF EXISTS name_sample;
@@ -0,0 +1,75 @@
+-- Groups without a name of their own are named by the API after their first
+-- participants, in each viewer's language. Summaries keep a sample of those
+-- participants in the order they joined, up to one more than a name lists so the
+-- viewer can be left out, refreshed as members come and go or rename.
+ALTER TABLE conversation_summaries
+    ADD COLUMN name_sample JSONB NOT NULL DEFAULT '[]';
+
+CREATE OR REPLACE FUNCTION conversation_name_sample(conversation UUID)
+RETURNS JSONB AS $$
+    SELECT COALESCE(jsonb_agg(jsonb_build_object('id', sample.user_id, 'name', sample.name)
+            ORDER BY sample.joined_at, sample.user_id), '[]')
+    FROM (
+        SELECT cp.user_id, cp.joined_at,
+            CASE WHEN u.is_active THEN u.username ELSE 'Deleted user' END AS name
+        FROM conversation_participants cp
+        JOIN users u ON u.id = cp.user_id
+        WHERE cp.conversation_id = conversation
+        ORDER BY cp.joined_at, cp.user_id
+        LIMIT 6
+    ) sample
+$$ LANGUAGE sql STABLE;
+
+UPDATE conversation_summaries
+SET name_sample = conversation_name_sample(conversation_id);
+
+CREATE OR REPLACE FUNCTION summarize_conversation_membership()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE conversation_summaries
+        SET participant_count = participant_count - 1,
+            name_sample = conversation_name_sample(OLD.conversation_id),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = OLD.conversation_id;
+        RETURN OLD;
+    END IF;
+    UPDATE conversation_summaries
+    SET participant_count = participant_count + 1,
+        name_sample = conversation_name_sample(NEW.conversation_id),
+        updated_at = CURRENT_TIMESTAMP
+    WHERE conversation_id = NEW.conversation_id;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Renamed and deactivated users are renamed in the samples they are part of
+CREATE OR REPLACE FUNCTION summarize_participant_name()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE conversation_summaries s
+    SET name_sample = conversation_name_sample(s.conversation_id), updated_at = CURRENT_TIMESTAMP
+    FROM conversation_participants cp
+    WHERE cp.user_id = NEW.id AND s.conversation_id = cp.conversation_id
+        AND s.name_sample @> jsonb_build_array(jsonb_build_object('id', NEW.id));
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER summarize_participant_name_on_user
+    AFTER UPDATE OF username, is_active ON users
+    FOR EACH ROW
+    WHEN (OLD.username IS DISTINCT FROM NEW.username OR OLD.is_active IS DISTINCT FROM NEW.is_active)
+    EXECUTE FUNCTION summarize_participant_name();
+
+-- Names the API generated before were stored with the group, in English and frozen at
+-- creation; they are cleared so those groups are named like new ones. Their place in
+-- conversation lists is kept.
+ALTER TABLE conversations DISABLE TRIGGER update_conversations_updated_at;
+UPDATE conversations c
+SET name = NULL
+WHERE c.type = 'group'
+    AND c.name ~ '^[^,]+, [^,&]+( & [0-9]+ others)?$'
+    AND EXISTS (SELECT 1 FROM users u WHERE u.username = split_part(c.name, ', ', 1))
+    AND EXISTS (SELECT 1 FROM users u WHERE u.username = split_part(split_part(c.name, ', ', 2), ' & ', 1));
+ALTER TABLE conversations ENABLE TRIGGER update_conversations_updated_at;
@@ -0,0 +1,33 @@
+-- Restores the message summary of 000046_add_message_previews and drops pins
+CREATE OR REPLACE FUNCTION summarize_conversation_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_summaries
+        SET last_message_id = NEW.id, last_activity_at = NEW.created_at,
+            last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id;
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_summaries
+        SET last_message_id = (
+                SELECT m.id FROM messages m
+                WHERE m.conversation_id = NEW.conversation_id AND NOT m.is_deleted
+                ORDER BY m.created_at DESC, m.id DESC
+                LIMIT 1
+            ),
+            last_message_preview = NULL,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    ELSIF NEW.content IS DISTINCT FROM OLD.content THEN
+        UPDATE conversation_summaries
+        SET last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP INDEX IF EXISTS idx_conversation_participants_pins;
+
+ALTER TABLE conversation_participants
+    DROP COLUMN IF EXISTS pin_position;
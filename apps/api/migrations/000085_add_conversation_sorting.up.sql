@@ -0,0 +1,39 @@
+-- Conversation lists can be sorted by activity rather than by updated_at, which any
+-- change to a conversation bumps. Users pin conversations to the top of their list in
+-- an order of their own.
+ALTER TABLE conversation_participants
+    ADD COLUMN pin_position INTEGER;
+
+CREATE INDEX idx_conversation_participants_pins ON conversation_participants(user_id, pin_position)
+    WHERE pin_position IS NOT NULL;
+
+-- Messages sent with an earlier time than the last one, such as imported or federated
+-- ones, no longer become the last message or move the last activity back
+CREATE OR REPLACE FUNCTION summarize_conversation_message()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE conversation_summaries
+        SET last_message_id = NEW.id, last_activity_at = GREATEST(last_activity_at, NEW.created_at),
+            last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id
+            AND (last_message_id IS NULL OR last_activity_at <= NEW.created_at);
+    ELSIF NEW.is_deleted AND NOT OLD.is_deleted THEN
+        UPDATE conversation_summaries
+        SET last_message_id = (
+                SELECT m.id FROM messages m
+                WHERE m.conversation_id = NEW.conversation_id AND NOT m.is_deleted
+                ORDER BY m.created_at DESC, m.id DESC
+                LIMIT 1
+            ),
+            last_message_preview = NULL,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    ELSIF NEW.content IS DISTINCT FROM OLD.content THEN
+        UPDATE conversation_summaries
+        SET last_message_preview = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE conversation_id = NEW.conversation_id AND last_message_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
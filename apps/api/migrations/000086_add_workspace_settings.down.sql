@@ -0,0 +1,3 @@
+-- Drop workspace settings; messages are kept, and everyone may export, create groups
+-- and use guest tokens again
+DROP TABLE IF EXISTS workspace_settings;
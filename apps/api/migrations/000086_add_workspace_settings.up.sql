@@ -0,0 +1,17 @@
+-- Workspace-wide defaults set by admins: how long messages are kept, who may export
+-- conversations and create groups, and whether guest tokens are accepted. There is a
+-- single row.
+CREATE TABLE workspace_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    -- Messages older than this many days are deleted; 0 keeps them
+    retention_days INTEGER NOT NULL DEFAULT 0 CHECK (retention_days >= 0),
+    -- everyone, group_admins or nobody
+    export_policy VARCHAR(20) NOT NULL DEFAULT 'everyone',
+    -- everyone, verified or admins
+    group_creation VARCHAR(20) NOT NULL DEFAULT 'everyone',
+    guest_access BOOLEAN NOT NULL DEFAULT true,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO workspace_settings DEFAULT VALUES;
@@ -0,0 +1,3 @@
+-- Drop storage reports
+DROP INDEX IF EXISTS idx_messages_deleted_media;
+DROP TABLE IF EXISTS storage_reports;
@@ -0,0 +1,13 @@
+-- Storage usage reports, computed on a schedule or on request, kept for a month so
+-- growth can be followed
+CREATE TABLE storage_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    report JSONB NOT NULL,
+    generated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_storage_reports_generated_at ON storage_reports(generated_at);
+
+-- Finds the media of deleted messages the cleanup may clear
+CREATE INDEX idx_messages_deleted_media ON messages(id)
+    WHERE is_deleted AND media_url IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Drop shared signing keys
+DROP TABLE IF EXISTS signing_keys;
@@ -0,0 +1,12 @@
+-- JWT signing keys rotated through the admin API, shared by every node. Private keys
+-- are encrypted like message content.
+CREATE TABLE signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    key_data TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- At most one key is the one new tokens are signed with
+CREATE UNIQUE INDEX idx_signing_keys_active ON signing_keys(active) WHERE active;
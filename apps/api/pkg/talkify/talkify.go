@@ -0,0 +1,317 @@
+// Package talkify embeds the Talkify chat backend in other Go programs. It wires up
+// the same services, WebSocket hub, authentication and background jobs as the API
+// server, and serves the API as a plain http.Handler that can be mounted on any
+// router. The program embedding it owns the HTTP server and, optionally, the
+// database connection.
+package talkify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"talkify/apps/api/internal/auth"
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/cron"
+	database "talkify/apps/api/internal/db"
+	"talkify/apps/api/internal/encryption"
+	"talkify/apps/api/internal/handlers"
+	"talkify/apps/api/internal/lifecycle"
+	"talkify/apps/api/internal/mail"
+	"talkify/apps/api/internal/models"
+	"talkify/apps/api/internal/presence"
+	"talkify/apps/api/internal/redis"
+	"talkify/apps/api/internal/server"
+	"talkify/apps/api/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Types shared with the API server, so embedding programs can name them
+type (
+	Config              = config.Config
+	User                = models.User
+	Conversation        = models.Conversation
+	Message             = models.Message
+	UserService         = models.UserService
+	ConversationService = models.ConversationService
+	MessageService      = models.MessageService
+	TokenManager        = auth.TokenManager
+	TokenPair           = auth.TokenPair
+	Claims              = auth.Claims
+)
+
+// LoadConfig loads and validates configuration the way the API server does: profile
+// defaults, then the YAML file at path (optional), then environment variables
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfigFile(path)
+}
+
+// Options wire an embedded backend
+type Options struct {
+	// Config is required; see LoadConfig. It is validated again by New.
+	Config *Config
+	// ConfigFile is where Config was loaded from, read again by Reload
+	ConfigFile string
+	// DB is an open connection to a database the migrations were applied to. When nil,
+	// New connects with Config.Database and Close disconnects.
+	DB *sqlx.DB
+	// Workers sizes the pool running background tasks; 0 uses one per CPU core
+	Workers int
+}
+
+// Talkify is an embedded chat backend
+type Talkify struct {
+	cfg       *Config
+	live      *config.Live
+	db        *sqlx.DB
+	ownsDB    bool
+	redis     *redis.Client
+	encryptor encryption.Encryptor
+	tokens    *auth.TokenManager
+	handler   *handlers.Handler
+	app       *lifecycle.Manager
+	router    *gin.Engine
+}
+
+// New sets up the backend: the database, encryption, signing keys and, when
+// configured, mail and Redis presence. Background workers and jobs run from Start.
+func New(opts Options) (_ *Talkify, err error) {
+	if opts.Config == nil {
+		return nil, errors.New("talkify: a config is required")
+	}
+	cfg := opts.Config
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := &Talkify{cfg: cfg, live: config.NewLive(cfg, opts.ConfigFile), db: opts.DB, app: lifecycle.New()}
+	// Nothing has started when a step fails, so only the connections need closing
+	defer func() {
+		if err != nil {
+			t.closeConnections()
+		}
+	}()
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+
+	// Stopped in reverse: jobs, presence, connections and queued tasks, then Redis and
+	// the database
+	t.app.Append(lifecycle.Hook{
+		Name: "connections",
+		Stop: func(context.Context) error { return t.closeConnections() },
+	})
+	pool := worker.NewPool(opts.Workers)
+	t.handler = handlers.NewHandler(cfg, t.live, t.db, t.encryptor, pool, t.tokens)
+	t.app.Append(lifecycle.Hook{
+		Name: "worker pool",
+		Start: func(context.Context) error {
+			pool.Start()
+			return nil
+		},
+		Stop: pool.Stop,
+	})
+	t.app.Append(lifecycle.Hook{
+		Name: "websocket hub",
+		Stop: func(context.Context) error {
+			t.handler.Close()
+			return nil
+		},
+	})
+
+	mailer, err := mail.New(cfg.Mail.SMTPURL, cfg.Mail.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail configuration: %w", err)
+	}
+	t.handler.SetMailer(mailer)
+
+	if t.redis != nil {
+		t.handler.SetPresence(presence.NewTracker(t.redis, cfg.Presence.OnlineTTL))
+		presenceCtx, stopPresence := context.WithCancel(context.Background())
+		t.app.Append(lifecycle.Hook{
+			Name: "presence watcher",
+			Start: func(context.Context) error {
+				go t.handler.WatchPresence(presenceCtx)
+				return nil
+			},
+			Stop: func(context.Context) error {
+				stopPresence()
+				return nil
+			},
+		})
+	}
+
+	jobs := cron.NewRunner()
+	for _, job := range t.handler.Jobs() {
+		jobs.Register(job)
+	}
+	t.app.Append(lifecycle.Hook{
+		Name: "cron runner",
+		Start: func(context.Context) error {
+			jobs.Start()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			jobs.Stop()
+			return nil
+		},
+	})
+
+	if t.router, err = t.newRouter(); err != nil {
+		return nil, err
+	}
+	if uncovered := handlers.UncoveredRoutes(t.router.Routes()); len(uncovered) > 0 {
+		return nil, fmt.Errorf("routes without an authorization rule: %v", uncovered)
+	}
+	t.handler.SetRoutes(t.router.Routes)
+	return t, nil
+}
+
+// connect connects to the database and Redis and loads the keys
+func (t *Talkify) connect() error {
+	cfg := t.cfg
+	if t.db == nil {
+		db, err := database.Connect(&cfg.Database, cfg.Database.StartupMaxWait)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		t.db = db
+		t.ownsDB = true
+	}
+
+	var err error
+	t.encryptor, err = encryption.NewEncryptor(cfg.Encryption.Mode, cfg.Encryption.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize encryption manager: %w", err)
+	}
+	if _, err := database.CheckMigrations(t.db, cfg.Database.MigrationsDir); err != nil {
+		return err
+	}
+	if err := database.VerifyEncryptionCanary(t.db, t.encryptor); err != nil && !errors.Is(err, database.ErrCanaryUnavailable) {
+		return fmt.Errorf("encryption does not match existing data: %w", err)
+	}
+
+	signingKeys := auth.NewKeySet(cfg.JWT.SecretKID, []byte(cfg.JWT.SecretKey))
+	if err := signingKeys.LoadDir(cfg.JWT.KeysDir); err != nil {
+		return fmt.Errorf("failed to load JWT signing keys: %w", err)
+	}
+	if cfg.JWT.ActiveKID != "" {
+		if err := signingKeys.SetActive(cfg.JWT.ActiveKID); err != nil {
+			return fmt.Errorf("failed to activate JWT signing key: %w", err)
+		}
+	}
+	if err := signingKeys.UseStore(models.NewSigningKeyStore(t.db, t.encryptor)); err != nil {
+		return fmt.Errorf("failed to load stored JWT signing keys: %w", err)
+	}
+	t.tokens = auth.NewTokenManager(signingKeys, cfg.JWT.Issuer, cfg.JWT.Audience)
+
+	// Share presence between nodes when Redis is configured
+	if cfg.Redis.URL != "" {
+		redisOpts, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			return fmt.Errorf("invalid Redis URL: %w", err)
+		}
+		t.redis = redis.New(redisOpts)
+		if _, err := t.redis.Do("PING"); err != nil {
+			return fmt.Errorf("failed to reach Redis at %s: %w", redisOpts.Addr, err)
+		}
+	}
+	return nil
+}
+
+// closeConnections closes Redis and, when New connected to it, the database
+func (t *Talkify) closeConnections() error {
+	var errs []error
+	if t.redis != nil {
+		errs = append(errs, t.redis.Close())
+	}
+	if t.ownsDB && t.db != nil {
+		errs = append(errs, t.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newRouter serves the public API under /api with the API server's middleware: CORS,
+// network restrictions, rate limits, metrics and timeouts follow the configuration.
+// TLS is left to the embedding program.
+func (t *Talkify) newRouter() (*gin.Engine, error) {
+	r, err := server.NewRouter(t.cfg, server.RouterOptions{
+		Live:      t.live,
+		Metrics:   t.handler.Metrics(),
+		Streaming: handlers.StreamingRoutes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.handler.RegisterRoutes(r.Group("/api"))
+	return r, nil
+}
+
+// Start runs the background workers and jobs: retention, presence sweeps, rollups and
+// the like
+func (t *Talkify) Start(ctx context.Context) error {
+	return t.app.Start(ctx)
+}
+
+// Shutdown ends the WebSocket connections, lets the running jobs and queued tasks
+// finish within ctx and, when New connected to it, closes the database. Stop serving
+// the Handler first.
+func (t *Talkify) Shutdown(ctx context.Context) error {
+	return t.app.Stop(ctx)
+}
+
+// Close shuts down within the configured server.shutdown_timeout
+func (t *Talkify) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.Server.ShutdownTimeout)
+	defer cancel()
+	return t.Shutdown(ctx)
+}
+
+// Handler serves the API. Every route is under /api, so mount it there:
+//
+//	mux.Handle("/api/", t.Handler())
+func (t *Talkify) Handler() http.Handler {
+	return t.router
+}
+
+// Reload applies the runtime settings from Options.ConfigFile and the environment
+func (t *Talkify) Reload() error {
+	_, err := t.live.Reload("embedded")
+	return err
+}
+
+// Users returns the service managing user accounts
+func (t *Talkify) Users() *UserService {
+	return models.NewUserService(t.db, t.encryptor)
+}
+
+// Conversations returns the service managing conversations and their participants
+func (t *Talkify) Conversations() *ConversationService {
+	return models.NewConversationService(t.db, t.encryptor)
+}
+
+// Messages returns the service storing messages; content is encrypted at rest
+func (t *Talkify) Messages() *MessageService {
+	return models.NewMessageService(t.db, t.encryptor)
+}
+
+// Tokens issues and validates the access tokens clients call the API with, for
+// programs that authenticate users themselves
+func (t *Talkify) Tokens() *TokenManager {
+	return t.tokens
+}
+
+// Publish pushes an event to the WebSocket clients of the given users. The payload is
+// sent as JSON.
+func (t *Talkify) Publish(userIDs []uuid.UUID, eventType string, payload interface{}) error {
+	if _, err := json.Marshal(payload); err != nil {
+		return fmt.Errorf("invalid event payload: %w", err)
+	}
+	t.handler.PublishToUsers(userIDs, eventType, payload)
+	return nil
+}
@@ -0,0 +1,44 @@
+package talkify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"talkify/apps/api/internal/config"
+	"talkify/apps/api/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandlerRestrictsNetworks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Runtime.Network.AllowedCIDRs = []string{"10.0.0.0/8"}
+
+	// Routes are only matched, never served, so no database or keys are needed
+	live := config.NewLive(cfg, "")
+	embedded := &Talkify{cfg: cfg, live: live, handler: handlers.NewHandler(cfg, live, nil, nil, nil, nil)}
+	if embedded.router, err = embedded.newRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		blocked    bool
+	}{
+		{"203.0.113.7:41000", true},
+		{"10.1.2.3:41000", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/no-such-route", nil)
+		req.RemoteAddr = tc.remoteAddr
+		rec := httptest.NewRecorder()
+		embedded.Handler().ServeHTTP(rec, req)
+		if blocked := rec.Code == http.StatusForbidden; blocked != tc.blocked {
+			t.Errorf("request from %s: got %d, want blocked=%v", tc.remoteAddr, rec.Code, tc.blocked)
+		}
+	}
+}
@@ -327,7 +327,7 @@ export const ChatBox = ({ conversation }: ChatBoxProps) => {
                       {message.reply_to && (
                         <div className="mb-1 text-sm opacity-70 border-l-2 pl-2">
                           <p className="font-medium">{message.reply_to.sender_username}</p>
-                          <p className="truncate">{message.reply_to.content}</p>
+                          <p className="truncate">{message.reply_to.is_deleted ? 'Message deleted' : message.reply_to.content}</p>
                         </div>
                       )}
                       <p>{message.content}</p>
@@ -67,7 +67,7 @@ export const ChatProvider = ({ children }: { children: ReactNode }) => {
             return conv;
           });
         });
-      } else if (event.type === 'message_updated') {
+      } else if (event.type === 'message.updated') {
         // Update message in cache
         queryClient.setQueryData(['messages', event.payload.conversation_id], (oldMessages: Message[] | undefined) => {
           if (!oldMessages) return oldMessages;
@@ -75,6 +75,34 @@ export const ChatProvider = ({ children }: { children: ReactNode }) => {
             msg.id === event.payload.id ? event.payload : msg
           );
         });
+      } else if (event.type === 'message.deleted') {
+        // Mark message as deleted in cache
+        queryClient.setQueryData(['messages', event.payload.conversation_id], (oldMessages: Message[] | undefined) => {
+          if (!oldMessages) return oldMessages;
+          return oldMessages.map(msg =>
+            msg.id === event.payload.message_id ? { ...msg, is_deleted: true, content: '' } : msg
+          );
+        });
+      } else if (event.type === 'conversation.ownership_transferred') {
+        // Participant roles changed; refetch them
+        queryClient.invalidateQueries({ queryKey: ['conversations'] as const });
+      } else if (event.type === 'presence.changed') {
+        // Update the participant's online status wherever they appear
+        queryClient.setQueryData(['conversations'], (oldConversations: Conversation[] | undefined) => {
+          if (!oldConversations) return oldConversations;
+          return oldConversations.map(conv => ({
+            ...conv,
+            participants: conv.participants.map(p =>
+              p.user_id === event.payload.user_id && p.user
+                ? { ...p, user: { ...p.user, is_online: event.payload.is_online } }
+                : p
+            )
+          }));
+        });
+      } else if (event.type === 'events.reset') {
+        // Missed events could not be replayed; reload everything
+        queryClient.invalidateQueries({ queryKey: ['conversations'] as const });
+        queryClient.invalidateQueries({ queryKey: ['messages'] as const });
       } else if (event.type === 'message_read') {
         // Update messages read status
         const conversation = queryClient.getQueryData<Conversation[]>(['conversations'])?.find(
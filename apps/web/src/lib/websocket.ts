@@ -3,8 +3,12 @@ import type { Message } from '../types/api';
 
 type ChatEvent = 
   | { type: 'new_message'; payload: Message }
-  | { type: 'message_updated'; payload: Message }
-  | { type: 'message_deleted'; payload: { message_id: string } }
+  | { type: 'message.updated'; payload: Message }
+  | { type: 'message.deleted'; payload: { message_id: string; conversation_id: string; deleted_at: string } }
+  | { type: 'conversation.ownership_transferred'; payload: { conversation_id: string; previous_owner_id: string; new_owner_id: string } }
+  | { type: 'message.opened'; payload: { message_id: string; conversation_id: string; user_id: string; opened_at: string } }
+  | { type: 'events.reset'; payload: { last_event_id: number } }
+  | { type: 'presence.changed'; payload: { user_id: string; is_online: boolean } }
   | { type: 'typing_start'; payload: { conversation_id: string; user_id: string } }
   | { type: 'typing_stop'; payload: { conversation_id: string; user_id: string } }
   | { type: 'message_read'; payload: { conversation_id: string; user_id: string; message_ids: string[] } };
@@ -24,6 +28,8 @@ class ChatWebSocketService {
   private pongTimeout: number | null = null;
   private connectionPromise: Promise<void> | null = null;
   private connectionResolve: (() => void) | null = null;
+  // ID of the last server event received, so missed events are replayed on reconnect
+  private lastEventId: number | null = null;
 
   constructor() {
     this.setupTokenListener();
@@ -101,7 +107,8 @@ class ChatWebSocketService {
         this.socket = null;
       }
 
-      this.socket = new WebSocket(`${wsUrl}?token=${token}`);
+      const replay = this.lastEventId !== null ? `&last_event_id=${this.lastEventId}` : '';
+      this.socket = new WebSocket(`${wsUrl}?token=${token}${replay}`);
 
       this.socket.onopen = () => {
         console.log('WebSocket: Connected successfully');
@@ -143,6 +150,17 @@ class ChatWebSocketService {
             return;
           }
 
+          // Replayed and live events can overlap after a reconnect
+          if (typeof data.id === 'number') {
+            if (this.lastEventId !== null && data.id <= this.lastEventId) {
+              return;
+            }
+            this.lastEventId = data.id;
+          }
+          if (data.type === 'events.reset') {
+            this.lastEventId = data.payload.last_event_id;
+          }
+
           const chatEvent = data as ChatEvent;
           if (this.isValidChatEvent(chatEvent)) {
             this.eventHandlers.forEach((handler) => handler(chatEvent));
@@ -278,8 +296,12 @@ class ChatWebSocketService {
   private isValidChatEvent(event: any): event is ChatEvent {
     const validTypes = [
       'new_message',
-      'message_updated',
-      'message_deleted',
+      'message.updated',
+      'message.deleted',
+      'message.opened',
+      'conversation.ownership_transferred',
+      'events.reset',
+      'presence.changed',
       'typing_start',
       'typing_stop',
       'message_read'
@@ -34,6 +34,7 @@ export interface ConversationParticipant {
   joined_at: string;
   last_read_at: string;
   role: string;
+  nickname?: string;
   user?: User;
 }
 
@@ -42,6 +43,12 @@ export interface Conversation {
   created_by: string;
   name?: string;
   type: 'direct' | 'group';
+  avatar_url?: string;
+  accent_color?: string;
+  theme?: string;
+  welcome_message?: string;
+  rules?: string;
+  history_visibility: 'shared' | 'joined';
   created_at: string;
   updated_at: string;
   last_message?: Message;
@@ -57,6 +64,15 @@ export interface MessageReaction {
   created_at: string;
 }
 
+export interface ReplyPreview {
+  id: string;
+  sender_id: string;
+  sender_username: string;
+  content: string;
+  type: Message['type'];
+  is_deleted: boolean;
+}
+
 export interface Message {
   id: string;
   conversation_id: string;
@@ -64,9 +80,9 @@ export interface Message {
   sender_username: string;
   sender?: User;
   reply_to_id?: string;
-  reply_to?: Message;
+  reply_to?: ReplyPreview;
   content: string;
-  type: 'text' | 'image' | 'video' | 'audio' | 'file' | 'location';
+  type: 'text' | 'image' | 'video' | 'audio' | 'file' | 'location' | 'system';
   media_url?: string;
   media_thumbnail_url?: string;
   media_size?: number;
@@ -78,6 +94,7 @@ export interface Message {
   reactions?: MessageReaction[];
   is_edited: boolean;
   is_deleted: boolean;
+  view_once: boolean;
 }
 
 export interface CreateMessageInput {